@@ -0,0 +1,428 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/config"
+	"github.com/tullo/backend/internal/database"
+)
+
+// tables lists every application table in foreign-key order: parents before
+// children, so a restore can load them front to back. New tables must be
+// added here; export warns about any table it finds that is missing.
+var tables = []string{
+	"users",
+	"conversations",
+	"channels",
+	"streams",
+	"channel_follows",
+	"conversation_members",
+	"messages",
+	"messages_archive",
+	"message_reads",
+	"conversation_moderations",
+	"channel_banned_words",
+	"moderation_logs",
+	"email_tokens",
+	"email_preferences",
+	"analytics_daily",
+	"data_exports",
+	"refresh_token_families",
+	"refresh_tokens",
+	"sessions",
+	"message_reports",
+	"channel_auto_messages",
+	"channel_welcomes",
+	"channel_commands",
+	"user_identities",
+	"api_keys",
+	"auth_events",
+	"overlay_tokens",
+	"watch_history",
+	"content_preferences",
+	"message_requests",
+	"analytics_events",
+	"channel_links",
+	"channel_link_clicks",
+	"follow_bot_reports",
+	"channel_points",
+	"assets",
+	"channel_badges",
+	"device_keys",
+	"announcements",
+	"channel_emotes",
+	"bot_scores",
+	"message_translations",
+	"attachments",
+}
+
+// manifest is stored as manifest.json at the start of every backup archive
+type manifest struct {
+	CreatedAt     time.Time        `json:"created_at"`
+	SchemaVersion int              `json:"schema_version"`
+	Tables        []string         `json:"tables"`
+	Rows          map[string]int64 `json:"rows"`
+}
+
+func usage() {
+	fmt.Println(`Usage:
+  go run cmd/backup/main.go export  -out backup.tar.gz [-s3 s3://bucket/key.tar.gz]
+  go run cmd/backup/main.go restore -in backup.tar.gz|s3://bucket/key.tar.gz [-clean]
+
+S3 transfers use the aws CLI, which must be installed and configured.`)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Start the in-process Postgres for local development
+	if cfg.Database.Embedded {
+		stopDB, err := database.StartEmbedded(cfg.GetEmbeddedDB())
+		if err != nil {
+			log.Fatalf("Failed to start embedded database: %v", err)
+		}
+		defer stopDB()
+	}
+
+	db, err := database.NewPostgresDB(cfg.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	switch os.Args[1] {
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		out := fs.String("out", "tullo-backup-"+time.Now().UTC().Format("20060102-150405")+".tar.gz", "archive file to write")
+		s3 := fs.String("s3", "", "optional s3:// URL to upload the archive to")
+		fs.Parse(os.Args[2:])
+
+		if err := export(db, *out); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		log.Printf("Wrote %s", *out)
+
+		if *s3 != "" {
+			if err := awsCopy(*out, *s3); err != nil {
+				log.Fatalf("Upload failed: %v", err)
+			}
+			log.Printf("Uploaded to %s", *s3)
+		}
+
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ExitOnError)
+		in := fs.String("in", "", "archive file or s3:// URL to restore from")
+		clean := fs.Bool("clean", false, "truncate all tables before loading")
+		fs.Parse(os.Args[2:])
+
+		if *in == "" {
+			usage()
+		}
+		path := *in
+		if strings.HasPrefix(path, "s3://") {
+			tmp, err := os.CreateTemp("", "tullo-restore-*.tar.gz")
+			if err != nil {
+				log.Fatalf("Failed to create temp file: %v", err)
+			}
+			tmp.Close()
+			defer os.Remove(tmp.Name())
+			if err := awsCopy(path, tmp.Name()); err != nil {
+				log.Fatalf("Download failed: %v", err)
+			}
+			path = tmp.Name()
+		}
+
+		if err := restore(db, path, *clean); err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		log.Println("Restore completed successfully")
+
+	default:
+		usage()
+	}
+}
+
+// export dumps every table as CSV inside a single repeatable-read snapshot so
+// the archive is consistent even while the server keeps writing.
+func export(db *database.DB, out string) error {
+	ctx := context.Background()
+	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	warnUnlistedTables(ctx, tx)
+
+	m := manifest{CreatedAt: time.Now().UTC(), Tables: tables, Rows: map[string]int64{}}
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&m.SchemaVersion); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tullo-backup-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, table := range tables {
+		f, err := os.Create(filepath.Join(tmpDir, table+".csv"))
+		if err != nil {
+			return err
+		}
+		tag, err := tx.Conn().PgConn().CopyTo(ctx, f, fmt.Sprintf(`COPY %s TO STDOUT WITH (FORMAT csv, HEADER true)`, pgx.Identifier{table}.Sanitize()))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", table, err)
+		}
+		m.Rows[table] = tag.RowsAffected()
+		log.Printf("Exported %s (%d rows)", table, tag.RowsAffected())
+	}
+
+	manifestJSON, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "manifest.json"), manifestJSON, 0o644); err != nil {
+		return err
+	}
+
+	return writeArchive(out, tmpDir, append([]string{"manifest.json"}, csvNames()...))
+}
+
+// restore loads an archive written by export. The target schema must be at the
+// same migration version; run `migrate up` first.
+func restore(db *database.DB, path string, clean bool) error {
+	tmpDir, err := os.MkdirTemp("", "tullo-restore-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extractArchive(path, tmpDir); err != nil {
+		return err
+	}
+
+	raw, err := os.ReadFile(filepath.Join(tmpDir, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("archive has no manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	current, err := database.CurrentVersion(db)
+	if err != nil {
+		return err
+	}
+	if current != m.SchemaVersion {
+		return fmt.Errorf("backup is at schema version %d but database is at %d", m.SchemaVersion, current)
+	}
+
+	ctx := context.Background()
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if clean {
+		names := make([]string, len(m.Tables))
+		for i, t := range m.Tables {
+			names[i] = pgx.Identifier{t}.Sanitize()
+		}
+		if _, err := tx.Exec(ctx, `TRUNCATE `+strings.Join(names, ", ")+` CASCADE`); err != nil {
+			return fmt.Errorf("failed to truncate tables: %w", err)
+		}
+	}
+
+	for _, table := range m.Tables {
+		n, err := copyIn(ctx, tx, table, filepath.Join(tmpDir, table+".csv"))
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", table, err)
+		}
+		if n != m.Rows[table] {
+			return fmt.Errorf("restored %d rows into %s, manifest says %d", n, table, m.Rows[table])
+		}
+		log.Printf("Restored %s (%d rows)", table, n)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// copyIn loads one CSV file, using its header line as the column list so the
+// load does not depend on physical column order in the target database.
+func copyIn(ctx context.Context, tx pgx.Tx, table, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	headerLine, err := br.ReadString('\n')
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns, err := csv.NewReader(strings.NewReader(headerLine)).Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse header: %w", err)
+	}
+	for i, c := range columns {
+		columns[i] = pgx.Identifier{c}.Sanitize()
+	}
+
+	sql := fmt.Sprintf(`COPY %s (%s) FROM STDIN WITH (FORMAT csv)`, pgx.Identifier{table}.Sanitize(), strings.Join(columns, ", "))
+	tag, err := tx.Conn().PgConn().CopyFrom(ctx, br, sql)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func warnUnlistedTables(ctx context.Context, tx pgx.Tx) {
+	rows, err := tx.Query(ctx, `SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_type = 'BASE TABLE'`)
+	if err != nil {
+		log.Printf("Warning: could not list tables: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	known := map[string]bool{"schema_migrations": true}
+	for _, t := range tables {
+		known[t] = true
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil && !known[name] {
+			log.Printf("Warning: table %s is not included in the backup", name)
+		}
+	}
+}
+
+func csvNames() []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t + ".csv"
+	}
+	return names
+}
+
+func writeArchive(out, dir string, names []string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", out, err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		if err := addFile(tw, filepath.Join(dir, name), name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func addFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func extractArchive(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("not a gzip archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// archives only ever contain flat file names
+		name := filepath.Base(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || name != hdr.Name {
+			return fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+		out, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// awsCopy shells out to `aws s3 cp`, which handles credentials, regions and
+// multipart uploads for large archives.
+func awsCopy(src, dst string) error {
+	cmd := exec.Command("aws", "s3", "cp", src, dst)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
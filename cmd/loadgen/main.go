@@ -0,0 +1,282 @@
+// Command loadgen drives a running server with chat traffic and reports the
+// end-to-end latency of message delivery: from a client writing message.send
+// to its socket until each member's socket reads the message.new, through
+// the database, Redis and the hub's fan-out.
+//
+// It signs in the users created by cmd/seed, puts them in a new group
+// conversation, connects one WebSocket client per user and sends -rate
+// messages per second for -duration, spread over the clients. Run the target
+// with its send, auth and per-IP limits disabled (see GETTING_STARTED.md).
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/tullo/backend/internal/models"
+)
+
+type client struct {
+	user  models.User
+	token string
+	conn  *websocket.Conn
+	// mu serializes writes to conn
+	mu sync.Mutex
+}
+
+// stats collects the deliveries of one run
+type stats struct {
+	mu         sync.Mutex
+	latencies  []time.Duration
+	sent       int
+	sendErrors int
+	serverErrs map[string]int
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "base URL of the server under test")
+	origin := flag.String("origin", "http://localhost:3000", "Origin header for WebSocket upgrades; must be in CORS_ALLOWED_ORIGINS")
+	numClients := flag.Int("clients", 20, "number of WebSocket clients, one per seeded user")
+	rate := flag.Float64("rate", 10, "messages per second across all clients")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send")
+	drain := flag.Duration("drain", 5*time.Second, "how long to wait for deliveries after the last send")
+	email := flag.String("email", "demo%d@tullo.local", "email pattern of the seeded users, %d is 1..clients")
+	password := flag.String("password", "password123", "password of the seeded users")
+	flag.Parse()
+
+	if *numClients < 2 {
+		log.Fatal("Need at least 2 clients")
+	}
+	if *rate <= 0 {
+		log.Fatal("-rate must be positive")
+	}
+	base := strings.TrimSuffix(*server, "/")
+
+	clients := make([]*client, 0, *numClients)
+	for i := 1; i <= *numClients; i++ {
+		c, err := login(base, fmt.Sprintf(*email, i), *password)
+		if err != nil {
+			log.Fatalf("Failed to sign in user %d: %v", i, err)
+		}
+		clients = append(clients, c)
+	}
+	log.Printf("Signed in %d users", len(clients))
+
+	convID, err := createGroup(base, clients)
+	if err != nil {
+		log.Fatalf("Failed to create conversation: %v", err)
+	}
+	log.Printf("Created group conversation %s", convID)
+
+	run := uuid.NewString()[:8]
+	st := &stats{serverErrs: map[string]int{}}
+	var readers sync.WaitGroup
+	for _, c := range clients {
+		if err := c.connect(base, *origin); err != nil {
+			log.Fatalf("Failed to connect %s: %v", c.user.Email, err)
+		}
+		readers.Add(1)
+		go func(c *client) {
+			defer readers.Done()
+			c.read(run, st)
+		}(c)
+	}
+	log.Printf("Connected %d WebSocket clients; sending %.1f msg/s for %s", len(clients), *rate, *duration)
+
+	interval := time.Duration(float64(time.Second) / *rate)
+	ticker := time.NewTicker(interval)
+	deadline := time.After(*duration)
+send:
+	for seq := 0; ; seq++ {
+		select {
+		case <-deadline:
+			break send
+		case <-ticker.C:
+		}
+		c := clients[seq%len(clients)]
+		body := fmt.Sprintf("loadgen %s %d %d", run, seq, time.Now().UnixNano())
+		err := c.send(models.WSMessage{
+			Event:   models.EventMessageSend,
+			Payload: models.WSMessageSendPayload{ConversationID: convID, Body: body},
+		})
+		st.mu.Lock()
+		if err != nil {
+			st.sendErrors++
+		} else {
+			st.sent++
+		}
+		st.mu.Unlock()
+	}
+	ticker.Stop()
+
+	time.Sleep(*drain)
+	for _, c := range clients {
+		c.conn.Close()
+	}
+	readers.Wait()
+
+	st.report(len(clients))
+}
+
+// login signs in a seeded user
+func login(base, email, password string) (*client, error) {
+	var resp models.LoginResponse
+	err := call(http.MethodPost, base+"/auth/login", "", models.LoginRequest{Email: email, Password: password}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &client{user: resp.User, token: resp.Token}, nil
+}
+
+// createGroup makes the first client create a group with all the others
+func createGroup(base string, clients []*client) (uuid.UUID, error) {
+	name := "loadgen " + time.Now().Format(time.RFC3339)
+	req := models.CreateConversationRequest{IsGroup: true, Name: &name}
+	for _, c := range clients[1:] {
+		req.Members = append(req.Members, c.user.ID)
+	}
+	var conv models.Conversation
+	if err := call(http.MethodPost, base+"/api/v1/conversations", clients[0].token, req, &conv); err != nil {
+		return uuid.Nil, err
+	}
+	return conv.ID, nil
+}
+
+// call sends body as JSON and decodes the response into out
+func call(method, url, token string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var env struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&env)
+		return fmt.Errorf("%s %s: %d %s %s", method, url, resp.StatusCode, env.Error.Code, env.Error.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// connect opens the client's WebSocket with the latest protocol
+func (c *client) connect(base, origin string) error {
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path = "/ws"
+
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second, Subprotocols: []string{"tullo.v2"}}
+	header := http.Header{"Authorization": {"Bearer " + c.token}, "Origin": {origin}}
+	conn, _, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+func (c *client) send(msg models.WSMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteJSON(msg)
+}
+
+// read records the latency of every message.new from this run until the
+// connection closes
+func (c *client) read(run string, st *stats) {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		var in struct {
+			Event   string          `json:"event"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if json.Unmarshal(data, &in) != nil {
+			continue
+		}
+		switch in.Event {
+		case models.EventMessageNew:
+			var m models.Message
+			if json.Unmarshal(in.Payload, &m) != nil {
+				continue
+			}
+			f := strings.Fields(m.Body)
+			if len(f) != 4 || f[0] != "loadgen" || f[1] != run {
+				continue
+			}
+			sentAt, err := strconv.ParseInt(f[3], 10, 64)
+			if err != nil {
+				continue
+			}
+			st.mu.Lock()
+			st.latencies = append(st.latencies, now.Sub(time.Unix(0, sentAt)))
+			st.mu.Unlock()
+		case models.EventError:
+			var e models.WSErrorPayload
+			json.Unmarshal(in.Payload, &e)
+			st.mu.Lock()
+			st.serverErrs[strings.TrimSpace(e.Code+" "+e.Message)]++
+			st.mu.Unlock()
+		}
+	}
+}
+
+func (st *stats) report(members int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	expected := st.sent * members
+	fmt.Printf("sent %d messages (%d send errors), %d of %d deliveries", st.sent, st.sendErrors, len(st.latencies), expected)
+	if expected > 0 {
+		fmt.Printf(" (%.1f%%)", 100*float64(len(st.latencies))/float64(expected))
+	}
+	fmt.Println()
+	for msg, n := range st.serverErrs {
+		fmt.Printf("server error x%d: %s\n", n, msg)
+	}
+	if len(st.latencies) == 0 {
+		return
+	}
+
+	sort.Slice(st.latencies, func(i, j int) bool { return st.latencies[i] < st.latencies[j] })
+	pct := func(p float64) time.Duration {
+		return st.latencies[int(p*float64(len(st.latencies)-1))]
+	}
+	fmt.Printf("latency p50=%s p90=%s p99=%s max=%s\n",
+		pct(0.50).Round(time.Microsecond), pct(0.90).Round(time.Microsecond),
+		pct(0.99).Round(time.Microsecond), st.latencies[len(st.latencies)-1].Round(time.Microsecond))
+}
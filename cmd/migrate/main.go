@@ -1,19 +1,21 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
 	"github.com/tullo/backend/config"
 	"github.com/tullo/backend/internal/database"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run cmd/migrate/main.go [up|down|status]")
+		fmt.Println("Usage: go run cmd/migrate/main.go [up [--dry-run]|down|status]")
 		os.Exit(1)
 	}
 
@@ -25,8 +27,17 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Start the in-process Postgres for local development
+	if cfg.Database.Embedded {
+		stopDB, err := database.StartEmbedded(cfg.GetEmbeddedDB())
+		if err != nil {
+			log.Fatalf("Failed to start embedded database: %v", err)
+		}
+		defer stopDB()
+	}
+
 	// Connect to database
-	db, err := sql.Open("postgres", cfg.GetDSN())
+	db, err := database.NewPostgresDB(cfg.GetDSN())
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -34,6 +45,15 @@ func main() {
 
 	switch command {
 	case "up":
+		upFlags := flag.NewFlagSet("up", flag.ExitOnError)
+		dryRun := upFlags.Bool("dry-run", false, "print the SQL for pending migrations without executing it")
+		upFlags.Parse(os.Args[2:])
+
+		if *dryRun {
+			printPendingSQL(db)
+			return
+		}
+
 		log.Println("Running migrations...")
 		if err := database.RunMigrations(db); err != nil {
 			log.Fatalf("Migration failed: %v", err)
@@ -54,8 +74,8 @@ func main() {
 	}
 }
 
-func showMigrationStatus(db *sql.DB) {
-	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations ORDER BY version")
+func showMigrationStatus(db *database.DB) {
+	rows, err := db.Pool.Query(context.Background(), "SELECT version, applied_at FROM schema_migrations ORDER BY version")
 	if err != nil {
 		log.Printf("No migrations found or table doesn't exist: %v", err)
 		return
@@ -66,11 +86,51 @@ func showMigrationStatus(db *sql.DB) {
 	fmt.Println("-------------------")
 	for rows.Next() {
 		var version int
-		var appliedAt string
+		var appliedAt time.Time
 		if err := rows.Scan(&version, &appliedAt); err != nil {
 			log.Printf("Error scanning row: %v", err)
 			continue
 		}
-		fmt.Printf("Version %d - Applied at: %s\n", version, appliedAt)
+		fmt.Printf("Version %d - Applied at: %s\n", version, appliedAt.Format(time.RFC3339))
+	}
+
+	status, err := database.Status(db)
+	if err != nil {
+		log.Printf("Failed to compute migration status: %v", err)
+		return
+	}
+
+	fmt.Println("\nPending Migrations:")
+	fmt.Println("-------------------")
+	if len(status.Pending) == 0 {
+		fmt.Println("None - database is up to date")
+	}
+	for _, m := range status.Pending {
+		fmt.Printf("Version %d\n", m.Version)
+	}
+
+	if len(status.Gaps) > 0 {
+		fmt.Printf("\nWarning: versions %v are older than the latest applied migration but were never applied\n", status.Gaps)
+	}
+	if len(status.Unknown) > 0 {
+		fmt.Printf("\nWarning: applied versions %v are not registered in this build\n", status.Unknown)
+	}
+	if len(status.Duplicates) > 0 {
+		fmt.Printf("\nError: versions %v are registered more than once\n", status.Duplicates)
+	}
+}
+
+func printPendingSQL(db *database.DB) {
+	pending, err := database.PendingMigrations(db)
+	if err != nil {
+		log.Fatalf("Failed to compute pending migrations: %v", err)
+	}
+	if len(pending) == 0 {
+		fmt.Println("-- No pending migrations")
+		return
+	}
+	for _, m := range pending {
+		fmt.Printf("-- Migration %d\n%s\n", m.Version, strings.TrimSpace(m.Up))
+		fmt.Printf("INSERT INTO schema_migrations (version) VALUES (%d);\n\n", m.Version)
 	}
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/config"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+const seedPassword = "password123"
+
+var sampleLines = []string{
+	"hey everyone 👋",
+	"what's up chat",
+	"that play was insane",
+	"gg",
+	"anyone else lagging?",
+	"first time here, loving the stream",
+	"lol",
+	"can you explain that again?",
+	"POG",
+	"see you all tomorrow",
+}
+
+func main() {
+	numUsers := flag.Int("users", 20, "number of demo users to create")
+	numChannels := flag.Int("channels", 5, "number of demo channels to create")
+	numMessages := flag.Int("messages", 3000, "number of chat messages to spread across conversations")
+	opts := config.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.LoadWithOptions(*opts)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Server.Env == "production" {
+		log.Fatal("Refusing to seed a production database")
+	}
+
+	// Start the in-process Postgres for local development
+	if cfg.Database.Embedded {
+		stopDB, err := database.StartEmbedded(cfg.GetEmbeddedDB())
+		if err != nil {
+			log.Fatalf("Failed to start embedded database: %v", err)
+		}
+		defer stopDB()
+	}
+
+	// Connect to database
+	db, err := database.NewPostgresDB(cfg.GetDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := database.RunMigrations(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	if err := db.PrepareStatements(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	chRepo := repository.NewChannelRepository(db)
+	convRepo := repository.NewConversationRepository(db)
+	msgRepo := repository.NewMessageRepository(db)
+
+	hash, err := auth.HashPassword(seedPassword)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+
+	// Users
+	users := make([]*models.User, 0, *numUsers)
+	for i := 1; i <= *numUsers; i++ {
+		email := fmt.Sprintf("demo%d@tullo.local", i)
+		if u, err := userRepo.GetByEmail(email); err == nil {
+			users = append(users, u)
+			continue
+		}
+		u := &models.User{
+			ID:           uuid.New(),
+			Email:        email,
+			DisplayName:  fmt.Sprintf("Demo User %d", i),
+			PasswordHash: hash,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		if err := userRepo.Create(u); err != nil {
+			log.Fatalf("Failed to create user %s: %v", email, err)
+		}
+		users = append(users, u)
+	}
+	log.Printf("Seeded %d users (password: %s)", len(users), seedPassword)
+
+	if len(users) < 2 {
+		log.Fatal("Need at least 2 users to seed conversations")
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var convIDs []uuid.UUID
+	convMembers := map[uuid.UUID][]uuid.UUID{}
+
+	// Channels with their chat conversations and followers
+	for i := 1; i <= *numChannels; i++ {
+		owner := users[(i-1)%len(users)]
+		slug := fmt.Sprintf("demo-channel-%d", i)
+		ch, err := chRepo.GetBySlug(slug)
+		if err != nil {
+			ch = &models.Channel{
+				ID:        uuid.New(),
+				OwnerID:   owner.ID,
+				Slug:      slug,
+				Title:     fmt.Sprintf("Demo Channel %d", i),
+				Tags:      []string{"demo", "seed"},
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			}
+			if err := chRepo.Create(ch); err != nil {
+				log.Fatalf("Failed to create channel %s: %v", slug, err)
+			}
+		}
+
+		convID, err := chRepo.GetOrCreateConversation(ch.ID)
+		if err != nil {
+			log.Fatalf("Failed to create channel conversation: %v", err)
+		}
+
+		members := []models.ConversationMember{{
+			ID: uuid.New(), ConversationID: convID, UserID: ch.OwnerID, Role: "moderator", JoinedAt: time.Now(),
+		}}
+		ids := []uuid.UUID{ch.OwnerID}
+		for _, u := range users {
+			if u.ID == ch.OwnerID || rng.Intn(2) == 0 {
+				continue
+			}
+			if _, err := chRepo.AddFollower(ch.ID, u.ID, models.FollowOrigin{}); err != nil {
+				log.Fatalf("Failed to add follower: %v", err)
+			}
+			members = append(members, models.ConversationMember{
+				ID: uuid.New(), ConversationID: convID, UserID: u.ID, Role: "member", JoinedAt: time.Now(),
+			})
+			ids = append(ids, u.ID)
+		}
+		err = convRepo.WithTx(func(tx pgx.Tx) error {
+			_, err := convRepo.AddMembers(tx, members)
+			return err
+		})
+		if err != nil {
+			log.Fatalf("Failed to add channel members: %v", err)
+		}
+
+		convIDs = append(convIDs, convID)
+		convMembers[convID] = ids
+	}
+	log.Printf("Seeded %d channels", *numChannels)
+
+	// Direct conversations between neighbouring users
+	for i := 0; i+1 < len(users); i += 2 {
+		conv, err := convRepo.GetOrCreateDirectConversation(users[i].ID, users[i+1].ID)
+		if err != nil {
+			log.Fatalf("Failed to create direct conversation: %v", err)
+		}
+		convIDs = append(convIDs, conv.ID)
+		convMembers[conv.ID] = []uuid.UUID{users[i].ID, users[i+1].ID}
+	}
+	log.Printf("Seeded %d conversations", len(convIDs))
+
+	// Messages, spread over the last week so history pagination has something to page through
+	start := time.Now().Add(-7 * 24 * time.Hour)
+	step := 7 * 24 * time.Hour / time.Duration(max(*numMessages, 1))
+	for i := 0; i < *numMessages; i++ {
+		convID := convIDs[rng.Intn(len(convIDs))]
+		members := convMembers[convID]
+		ts := start.Add(time.Duration(i) * step)
+		msg := &models.Message{
+			ID:             uuid.New(),
+			ConversationID: convID,
+			SenderID:       members[rng.Intn(len(members))],
+			Body:           sampleLines[rng.Intn(len(sampleLines))],
+			CreatedAt:      ts,
+			UpdatedAt:      ts,
+		}
+		if err := msgRepo.Create(msg); err != nil {
+			log.Fatalf("Failed to create message: %v", err)
+		}
+	}
+	log.Printf("Seeded %d messages", *numMessages)
+	log.Println("Seeding completed successfully")
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/handlers"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/openapi"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// messageResponse is the {"message": "..."} body returned by simple actions
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+type addMembersResponse struct {
+	Message string      `json:"message"`
+	Added   []uuid.UUID `json:"added"`
+}
+
+type apiKeysResponse struct {
+	Keys []models.APIKey `json:"keys"`
+}
+
+type deviceKeysResponse struct {
+	Keys []models.DeviceKey `json:"keys"`
+}
+
+type emotesResponse struct {
+	Emotes []models.Emote `json:"emotes"`
+}
+
+type botScoresResponse struct {
+	Scores []models.BotScore `json:"scores"`
+}
+
+type announcementsResponse struct {
+	Announcements []models.Announcement `json:"announcements"`
+}
+
+type sessionsResponse struct {
+	Sessions []models.Session `json:"sessions"`
+}
+
+type setRoleResponse struct {
+	ID      uuid.UUID `json:"id"`
+	Role    string    `json:"role"`
+	Changed bool      `json:"changed"`
+}
+
+type chatStatsResponse struct {
+	Channels []models.ChannelChatStats `json:"channels"`
+}
+
+type commandsResponse struct {
+	Commands []models.ChannelCommand `json:"commands"`
+}
+
+type badgesResponse struct {
+	Badges []models.ChannelBadge `json:"badges"`
+}
+
+// describeAPI documents the routes registered in main. Routes missing here
+// still appear in /openapi.json with a summary taken from the handler name.
+func describeAPI(spec *openapi.Spec) {
+	page := []string{"limit", "cursor"}
+	ok := messageResponse{}
+
+	// Health
+	spec.Describe("GET", "/health", openapi.Operation{Summary: "Liveness probe", Tags: []string{"health"}, Public: true})
+	spec.Describe("GET", "/health/live", openapi.Operation{Summary: "Liveness probe", Tags: []string{"health"}, Public: true})
+	spec.Describe("GET", "/health/ready", openapi.Operation{Summary: "Readiness probe (database, Redis, migrations)", Tags: []string{"health"}, Public: true})
+	spec.Describe("GET", "/metrics", openapi.Operation{Summary: "Prometheus metrics", Description: "Requires METRICS_TOKEN as the bearer token rather than a user token. Only registered when METRICS_TOKEN is set.", Tags: []string{"health"}})
+
+	// Auth and profile
+	spec.Describe("POST", "/auth/register", openapi.Operation{Summary: "Register a new user", Tags: []string{"auth"}, Public: true, Request: models.CreateUserRequest{}, Response: models.LoginResponse{}, Status: 201})
+	spec.Describe("POST", "/auth/refresh", openapi.Operation{Summary: "Exchange a refresh token for new tokens", Description: "Refresh tokens are single-use; replaying one revokes every token from the same login.", Tags: []string{"auth"}, Public: true, Request: models.RefreshRequest{}, Response: models.RefreshResponse{}})
+	spec.Describe("POST", "/auth/guest", openapi.Operation{Summary: "Get a read-only guest token", Description: "Lets a signed-out viewer read channels and their live chat. Only registered when JWT_GUEST_EXPIRY_MINUTES is above 0.", Tags: []string{"auth"}, Public: true, Response: models.GuestTokenResponse{}})
+	spec.Describe("POST", "/auth/login", openapi.Operation{Summary: "Log in with email and password", Tags: []string{"auth"}, Public: true, Request: models.LoginRequest{}, Response: models.LoginResponse{}})
+	spec.Describe("POST", "/auth/verify-email", openapi.Operation{Summary: "Confirm an email address", Description: "Takes the token from a verification email.", Tags: []string{"auth"}, Public: true, Request: models.VerifyEmailRequest{}, Response: ok})
+	spec.Describe("POST", "/auth/password/forgot", openapi.Operation{Summary: "Email a password reset link", Description: "Always returns 202, whether or not the address has an account.", Tags: []string{"auth"}, Public: true, Request: models.ForgotPasswordRequest{}, Response: ok, Status: 202})
+	spec.Describe("POST", "/auth/password/reset", openapi.Operation{Summary: "Set a new password with a reset token", Tags: []string{"auth"}, Public: true, Request: models.ResetPasswordRequest{}, Response: ok})
+	spec.Describe("GET", "/auth/oauth/:provider", openapi.Operation{Summary: "Sign in with Google or GitHub", Description: "Redirects to the provider (google or github). Returns 404 for providers that are not configured.", Tags: []string{"auth"}, Public: true, Status: 302})
+	spec.Describe("GET", "/auth/oauth/:provider/callback", openapi.Operation{Summary: "OAuth sign-in callback", Description: "Called by the provider. Redirects to APP_URL/oauth/callback with token, refresh_token and expires_in, or error, in the URL fragment.", Tags: []string{"auth"}, Query: []string{"code", "state"}, Public: true, Status: 302})
+	spec.Describe("POST", "/auth/oidc/exchange", openapi.Operation{Summary: "Exchange an SSO token for a session", Description: "Only registered when OIDC_ISSUER is set. Takes a token from the configured issuer; the user is linked or created on first sign-in.", Tags: []string{"auth"}, Public: true, Request: models.SSOExchangeRequest{}, Response: models.LoginResponse{}})
+	spec.Describe("GET", "/email/unsubscribe", openapi.Operation{Summary: "Unsubscribe confirmation page", Description: "Linked from notification emails; returns HTML.", Tags: []string{"email"}, Query: []string{"token", "list"}, Public: true})
+	spec.Describe("POST", "/email/unsubscribe", openapi.Operation{Summary: "Unsubscribe from an email list", Description: "Also serves one-click List-Unsubscribe-Post requests; returns HTML.", Tags: []string{"email"}, Query: []string{"token", "list"}, Public: true})
+	spec.Describe("GET", "/overlay/events", openapi.Operation{Summary: "Channel alerts for stream overlays", Description: "A text/event-stream of the alerts of the channel owning the overlay token, such as channel.followed.", Tags: []string{"realtime"}, Query: []string{"token"}, Public: true})
+	spec.Describe("GET", "/l/:code", openapi.Operation{Summary: "Follow a short link", Description: "Counts a click and redirects (302) to the link's target or its channel's page.", Tags: []string{"channels"}, Public: true, Status: 302})
+	spec.Describe("HEAD", "/l/:code", openapi.Operation{Summary: "Resolve a short link", Description: "Redirects like GET without counting a click.", Tags: []string{"channels"}, Public: true, Status: 302})
+	spec.Describe("GET", "/assets/:hash", openapi.Operation{Summary: "Get an uploaded image", Description: "Served by content hash with Cache-Control: public, max-age=31536000, immutable and an ETag.", Tags: []string{"channels"}, Public: true})
+	spec.Describe("GET", "/ws", openapi.Operation{Summary: "WebSocket upgrade", Description: "Send the JWT as a bearer Authorization header or a tullo.auth.<token> subprotocol. The token query parameter is deprecated (WS_QUERY_TOKEN). resume takes the resume_token of connection.ready to restore a closed connection's subscriptions.", Tags: []string{"realtime"}, Query: []string{"protocol", "resume"}, Public: true})
+	spec.Describe("GET", "/api/v1/me", openapi.Operation{Summary: "Get the current user", Tags: []string{"users"}, Response: models.User{}})
+	spec.Describe("PATCH", "/api/v1/me", openapi.Operation{Summary: "Update the current user", Description: "Returns 409 if version does not match.", Tags: []string{"users"}, Request: models.UpdateUserRequest{}, Response: models.User{}})
+	spec.Describe("PUT", "/api/v1/me/username", openapi.Operation{Summary: "Set your username", Description: "3 to 20 letters, digits or underscores, stored lowercase; some names are reserved. Other users @mention you by it and channel chats show it instead of your email. Returns 409 USERNAME_TAKEN if another account has it.", Tags: []string{"users"}, Request: models.SetUsernameRequest{}, Response: models.User{}})
+	spec.Describe("DELETE", "/api/v1/me", openapi.Operation{Summary: "Delete your account", Description: "Requires the password if the account has one. Soft-deletes the account and its channels, removes memberships and follows, revokes sessions and API keys, and anonymizes or deletes the messages (DELETED_ACCOUNT_MESSAGES). Not available with an API key.", Tags: []string{"users"}, Request: models.DeleteAccountRequest{}, Response: ok})
+	spec.Describe("POST", "/api/v1/me/verify-email", openapi.Operation{Summary: "Resend the verification email", Description: "Returns 409 if the address is already verified.", Tags: []string{"users"}, Response: ok, Status: 202})
+	spec.Describe("GET", "/api/v1/me/email-preferences", openapi.Operation{Summary: "Get email notification preferences", Tags: []string{"users"}, Response: models.EmailPreferences{}})
+	spec.Describe("PATCH", "/api/v1/me/email-preferences", openapi.Operation{Summary: "Update email notification preferences", Tags: []string{"users"}, Request: models.UpdateEmailPreferencesRequest{}, Response: models.EmailPreferences{}})
+	spec.Describe("GET", "/api/v1/me/dnd", openapi.Operation{Summary: "Get do not disturb", Tags: []string{"users"}, Response: models.DoNotDisturb{}})
+	spec.Describe("PUT", "/api/v1/me/dnd", openapi.Operation{Summary: "Turn on do not disturb", Description: "Holds back email and push notifications for minutes. Mentions are sent in a digest afterwards; \"went live\" emails are skipped.", Tags: []string{"users"}, Request: models.SetDoNotDisturbRequest{}, Response: models.DoNotDisturb{}})
+	spec.Describe("DELETE", "/api/v1/me/dnd", openapi.Operation{Summary: "Turn off do not disturb", Tags: []string{"users"}, Status: 204})
+	spec.Describe("GET", "/api/v1/me/privacy", openapi.Operation{Summary: "Get privacy settings", Tags: []string{"users"}, Response: models.PrivacySettings{}})
+	spec.Describe("PATCH", "/api/v1/me/privacy", openapi.Operation{Summary: "Update privacy settings", Description: "dm_policy decides who may start a direct conversation: everyone, shared_channels, followers or none. Others start a message request.", Tags: []string{"users"}, Request: models.UpdatePrivacySettingsRequest{}, Response: models.PrivacySettings{}})
+	spec.Describe("GET", "/api/v1/me/message-requests", openapi.Operation{Summary: "List message requests", Description: "Direct conversations started by users outside the caller's network, newest first, with their last message.", Tags: []string{"conversations"}, Query: page, Response: pagination.Page[models.MessageRequest]{}})
+	spec.Describe("POST", "/api/v1/message-requests/:id/accept", openapi.Operation{Summary: "Accept a message request", Tags: []string{"conversations"}, Status: 204})
+	spec.Describe("POST", "/api/v1/message-requests/:id/decline", openapi.Operation{Summary: "Decline a message request", Description: "Deletes the conversation.", Tags: []string{"conversations"}, Status: 204})
+	spec.Describe("GET", "/api/v1/me/content-preferences", openapi.Operation{Summary: "Get content preferences", Tags: []string{"users"}, Response: models.ContentPreferences{}})
+	spec.Describe("PATCH", "/api/v1/me/content-preferences", openapi.Operation{Summary: "Update content preferences", Description: "show_mature acknowledges 18+ content: until it is set, mature streams are left out of explore and come without hls_url. Streams with a hidden tag are left out of explore.", Tags: []string{"users"}, Request: models.UpdateContentPreferencesRequest{}, Response: models.ContentPreferences{}})
+	spec.Describe("GET", "/api/v1/me/history", openapi.Operation{Summary: "Watch history", Description: "Streams the user watched with their resume positions, most recent first.", Tags: []string{"streams"}, Query: page, Response: pagination.Page[models.WatchHistoryEntry]{}})
+	spec.Describe("GET", "/api/v1/me/dashboard", openapi.Operation{Summary: "Creator dashboard", Description: "The caller's channels with live status, viewers, followers, unread chat mentions, active bans and mutes and pending message reports.", Tags: []string{"channels"}, Response: models.Dashboard{}})
+	spec.Describe("POST", "/api/v1/me/read-all", openapi.Operation{Summary: "Mark all messages read", Description: "Optionally limited to conversation_ids. Sends one message.read_all event to the user's sessions.", Tags: []string{"messages"}, Request: models.MarkAllReadRequest{}, Response: models.MarkAllReadResponse{}})
+	spec.Describe("POST", "/api/v1/me/export", openapi.Operation{Summary: "Request a copy of your data", Description: "Queues an export of the profile, messages, memberships, follows and moderation history. Returns 409 if one is already in progress.", Tags: []string{"users"}, Response: models.DataExport{}, Status: 202})
+	spec.Describe("GET", "/api/v1/me/exports/:id", openapi.Operation{Summary: "Get data export status", Description: "Once ready, includes a short-lived signed download_url.", Tags: []string{"users"}, Response: models.DataExport{}})
+	spec.Describe("GET", "/api/v1/me/sessions", openapi.Operation{Summary: "List your signed-in devices", Description: "Most recently seen first; current marks the session making the request. Not available with an API key.", Tags: []string{"users"}, Response: sessionsResponse{}})
+	spec.Describe("DELETE", "/api/v1/me/sessions/:id", openapi.Operation{Summary: "Sign out a device", Description: "Its refresh token and access tokens stop working and its WebSocket connections are closed. Not available with an API key.", Tags: []string{"users"}, Response: ok})
+	spec.Describe("GET", "/api/v1/me/security-events", openapi.Operation{Summary: "List your security log", Description: "Registrations, logins, failed logins, password resets and revoked sessions and API keys, newest first. Not available with an API key.", Tags: []string{"users"}, Query: page, Response: pagination.Page[models.AuthEvent]{}})
+	spec.Describe("GET", "/api/v1/announcements", openapi.Operation{Summary: "Current announcements", Description: "Sent, unexpired platform announcements for your audience, newest first, for showing in-app.", Tags: []string{"users"}, Response: announcementsResponse{}})
+	spec.Describe("GET", "/api/v1/me/device-keys", openapi.Operation{Summary: "List your device keys", Description: "Public keys your devices published for end-to-end encrypted direct messages.", Tags: []string{"encryption"}, Response: deviceKeysResponse{}})
+	spec.Describe("PUT", "/api/v1/me/device-keys/:device_id", openapi.Operation{Summary: "Publish a device key", Description: "Publishes or rotates the public key of a device. device_id is 1 to 64 letters, digits, dots, dashes or underscores; public_key and signature are base64. Returns 409 once you have 20 devices.", Tags: []string{"encryption"}, Request: models.PublishDeviceKeyRequest{}, Response: models.DeviceKey{}})
+	spec.Describe("DELETE", "/api/v1/me/device-keys/:device_id", openapi.Operation{Summary: "Delete a device key", Tags: []string{"encryption"}, Status: 204})
+	spec.Describe("GET", "/api/v1/keys", openapi.Operation{Summary: "List your API keys", Description: "Revoked keys are omitted. Not available with an API key.", Tags: []string{"keys"}, Response: apiKeysResponse{}})
+	spec.Describe("POST", "/api/v1/keys", openapi.Operation{Summary: "Create an API key", Description: "The key is returned only in this response. Not available with an API key.", Tags: []string{"keys"}, Request: models.CreateAPIKeyRequest{}, Response: models.CreateAPIKeyResponse{}, Status: 201})
+	spec.Describe("GET", "/api/v1/keys/:id", openapi.Operation{Summary: "Get an API key", Tags: []string{"keys"}, Response: models.APIKey{}})
+	spec.Describe("PATCH", "/api/v1/keys/:id", openapi.Operation{Summary: "Rename an API key or change its scopes", Tags: []string{"keys"}, Request: models.UpdateAPIKeyRequest{}, Response: models.APIKey{}})
+	spec.Describe("DELETE", "/api/v1/keys/:id", openapi.Operation{Summary: "Revoke an API key", Tags: []string{"keys"}, Response: ok})
+	spec.Describe("GET", "/exports/:id/download", openapi.Operation{Summary: "Download a data export", Description: "Takes the expires and sig parameters from download_url; returns a zip archive.", Tags: []string{"users"}, Public: true, Query: []string{"expires", "sig"}})
+
+	// Conversations
+	spec.Describe("GET", "/api/v1/conversations", openapi.Operation{Summary: "List the current user's conversations", Tags: []string{"conversations"}, Query: page, Response: pagination.Page[models.Conversation]{}})
+	spec.Describe("POST", "/api/v1/conversations", openapi.Operation{Summary: "Create a conversation", Description: "A 1:1 request returns the existing conversation if there is one. Otherwise the recipient's DM policy applies: 403 DM_NOT_ALLOWED, or a message request (request_pending) from outside their network.", Tags: []string{"conversations"}, Request: models.CreateConversationRequest{}, Response: models.Conversation{}, Status: 201})
+	spec.Describe("GET", "/api/v1/conversations/unread", openapi.Operation{Summary: "Unread counts of all your conversations", Description: "One entry per conversation, zero counts included, and their total, for badges. Counts are the other members' messages after your read marker.", Tags: []string{"conversations"}, Response: models.UnreadCountsResponse{}})
+	spec.Describe("GET", "/api/v1/conversations/:id", openapi.Operation{Summary: "Get a conversation", Tags: []string{"conversations"}, Response: models.Conversation{}})
+	spec.Describe("PATCH", "/api/v1/conversations/:id", openapi.Operation{Summary: "Rename a group conversation or turn formatting on or off", Description: "formatting decides whether new text messages get Markdown rendered to html.", Tags: []string{"conversations"}, Request: models.UpdateConversationRequest{}, Response: models.Conversation{}})
+	spec.Describe("GET", "/api/v1/conversations/:id/draft", openapi.Operation{Summary: "Get your draft in a conversation", Description: "The body is empty when there is no draft.", Tags: []string{"conversations"}, Response: models.Draft{}})
+	spec.Describe("PUT", "/api/v1/conversations/:id/draft", openapi.Operation{Summary: "Save your draft in a conversation", Description: "Replaces the unsent message shown on your other devices and in the conversation list. An empty body discards it.", Tags: []string{"conversations"}, Request: models.SaveDraftRequest{}, Response: models.Draft{}})
+	spec.Describe("GET", "/api/v1/conversations/:id/notifications", openapi.Operation{Summary: "Get notification settings for a conversation", Tags: []string{"conversations"}, Response: models.NotificationSettings{}})
+	spec.Describe("PUT", "/api/v1/conversations/:id/notifications", openapi.Operation{Summary: "Mute or unmute a conversation's notifications", Description: "Muted conversations send no notifications on any channel; messages still arrive. minutes limits the mute.", Tags: []string{"conversations"}, Request: models.UpdateNotificationSettingsRequest{}, Response: models.NotificationSettings{}})
+	spec.Describe("PUT", "/api/v1/conversations/:id/read", openapi.Operation{Summary: "Mark a conversation read", Description: "Moves your read marker forward to message_id, or to the newest message without a body; it never moves back. Unread counts are the messages after the marker. Sends one conversation.read event to your sessions when the marker moves. No per-message read receipts are stored.", Tags: []string{"messages"}, Request: models.ReadConversationRequest{}, Response: models.ReadConversationResponse{}})
+	spec.Describe("GET", "/api/v1/conversations/:id/storage", openapi.Operation{Summary: "Get a conversation's attachment storage (admin)", Description: "Bytes and number of attachments stored for the conversation, against ATTACHMENT_QUOTA_MIB, and when the oldest expires.", Tags: []string{"conversations"}, Response: models.StorageUsage{}})
+	spec.Describe("GET", "/api/v1/conversations/:id/keys", openapi.Operation{Summary: "Get a conversation's key bundle", Description: "Every member with the device keys to encrypt to; members without keys cannot receive encrypted messages. Members only.", Tags: []string{"encryption"}, Response: models.ConversationKeyBundle{}})
+	spec.Describe("POST", "/api/v1/conversations/:id/members", openapi.Operation{Summary: "Add members to a group conversation", Tags: []string{"conversations"}, Request: models.AddMembersRequest{}, Response: addMembersResponse{}})
+	spec.Describe("DELETE", "/api/v1/conversations/:id/members/:user_id", openapi.Operation{Summary: "Remove a member", Tags: []string{"conversations"}, Response: ok})
+	spec.Describe("POST", "/api/v1/conversations/:id/mutes", openapi.Operation{Summary: "Mute a user in a group conversation", Description: "Admins and moderators only. duration_min 0 mutes until lifted; muting again replaces the duration and reason.", Tags: []string{"moderation"}, Request: models.RestrictUserRequest{}, Response: models.RestrictionResponse{}})
+	spec.Describe("DELETE", "/api/v1/conversations/:id/mutes/:user_id", openapi.Operation{Summary: "Lift a mute", Description: "The conversation gets a chat.user_unmuted event.", Tags: []string{"moderation"}, Response: ok})
+	spec.Describe("POST", "/api/v1/conversations/:id/bans", openapi.Operation{Summary: "Ban a user from a group conversation", Description: "Admins and moderators only. duration_min 0 bans until lifted; banning again replaces the duration and reason.", Tags: []string{"moderation"}, Request: models.RestrictUserRequest{}, Response: models.RestrictionResponse{}})
+	spec.Describe("DELETE", "/api/v1/conversations/:id/bans/:user_id", openapi.Operation{Summary: "Lift a ban", Description: "The conversation gets a chat.user_unbanned event.", Tags: []string{"moderation"}, Response: ok})
+	spec.Describe("POST", "/api/v1/conversations/:id/moderation", openapi.Operation{Summary: "Mute or ban a member", Description: "Deprecated: use POST /conversations/:id/mutes or /bans.", Tags: []string{"moderation"}, Request: models.AddModerationRequest{}, Response: models.RestrictionResponse{}})
+	spec.Describe("DELETE", "/api/v1/conversations/:id/moderation/:user_id", openapi.Operation{Summary: "Lift a mute or ban", Description: "Deprecated: use DELETE /conversations/:id/mutes/:user_id or /bans/:user_id.", Tags: []string{"moderation"}, Query: []string{"action"}, Response: ok})
+
+	// Messages
+	spec.Describe("GET", "/api/v1/messages", openapi.Operation{Summary: "List messages in a conversation", Description: "before_id acts as a cursor at that message; after_id returns newer messages, oldest first; send its next_cursor as cursor with the same after_id.", Tags: []string{"messages"}, Query: append([]string{"conversation_id", "before_id", "after_id"}, page...), Response: pagination.Page[models.Message]{}})
+	spec.Describe("POST", "/api/v1/messages", openapi.Operation{Summary: "Send a message", Tags: []string{"messages"}, Request: models.SendMessageRequest{}, Response: models.Message{}, Status: 201})
+	spec.Describe("PUT", "/api/v1/messages/:id/read", openapi.Operation{Summary: "Mark a message as read", Description: "Earlier messages count as read too. Moves the read marker and sends conversation.read to the user's sessions.", Tags: []string{"messages"}, Response: ok})
+	spec.Describe("DELETE", "/api/v1/messages/:id", openapi.Operation{Summary: "Delete a message", Description: "Allowed for the sender, channel moderators and conversation admins. The message stays listed as a tombstone and the conversation receives message.deleted.", Tags: []string{"messages"}, Status: 204})
+	spec.Describe("POST", "/api/v1/messages/:id/restore", openapi.Operation{Summary: "Restore a deleted message", Description: "Allowed for channel moderators and conversation admins, and for senders who deleted the message themselves. The conversation receives message.restored.", Tags: []string{"messages"}, Response: models.Message{}})
+	spec.Describe("POST", "/api/v1/messages/:id/report", openapi.Operation{Summary: "Report a message", Description: "Pass the message's report_token to report it after it was deleted. Returns 409 if already reported.", Tags: []string{"moderation"}, Request: models.ReportMessageRequest{}, Response: models.MessageReport{}, Status: 201})
+	spec.Describe("GET", "/api/v1/channels/:slug/reports", openapi.Operation{Summary: "List reports against a channel's chat", Description: "Owner and moderators only. status is pending (default), resolved or dismissed; newest first.", Tags: []string{"moderation"}, Query: append([]string{"status"}, page...), Response: pagination.Page[models.MessageReport]{}})
+	spec.Describe("PATCH", "/api/v1/channels/:slug/reports/:report_id", openapi.Operation{Summary: "Resolve or dismiss a pending report against a channel's chat", Tags: []string{"moderation"}, Request: models.ResolveReportRequest{}, Response: models.MessageReport{}})
+	spec.Describe("GET", "/api/v1/conversations/:id/reports", openapi.Operation{Summary: "List reports against a conversation", Description: "For whoever may delete the conversation's messages. status is pending (default), resolved or dismissed; newest first.", Tags: []string{"moderation"}, Query: append([]string{"status"}, page...), Response: pagination.Page[models.MessageReport]{}})
+	spec.Describe("PATCH", "/api/v1/conversations/:id/reports/:report_id", openapi.Operation{Summary: "Resolve or dismiss a pending report against a conversation", Tags: []string{"moderation"}, Request: models.ResolveReportRequest{}, Response: models.MessageReport{}})
+	spec.Describe("POST", "/api/v1/messages/:id/translate", openapi.Operation{Summary: "Translate a message", Description: "Translates the message body into language for anyone who can read it, with the configured provider (DeepL or Google). Translations are cached per language. Returns 503 when TRANSLATION_PROVIDER is not set.", Tags: []string{"messages"}, Request: models.TranslateMessageRequest{}, Response: models.MessageTranslation{}})
+	spec.Describe("GET", "/api/v1/online-users", openapi.Operation{Summary: "List online users", Tags: []string{"realtime"}})
+
+	// Channels and streams
+	spec.Describe("GET", "/api/v1/channels", openapi.Operation{Summary: "List channels", Tags: []string{"channels"}, Query: page, Response: pagination.Page[models.Channel]{}})
+	spec.Describe("POST", "/api/v1/channels", openapi.Operation{Summary: "Create a channel", Description: "Users may own CHANNELS_PER_USER channels (403 CHANNEL_LIMIT_REACHED) and create one every CHANNEL_CREATE_COOLDOWN_MINUTES (429 CHANNEL_COOLDOWN with Retry-After). Admins are exempt.", Tags: []string{"channels"}, Request: models.CreateChannelRequest{}, Response: models.Channel{}, Status: 201})
+	spec.Describe("GET", "/api/v1/channels/:slug", openapi.Operation{Summary: "Get a channel page", Description: "The channel with its latest stream, viewers, followers, pinned chat rules, and whether the caller follows it and their role (owner, banned, moderator, vip or viewer).", Tags: []string{"channels"}, Response: models.ChannelPage{}})
+	spec.Describe("PATCH", "/api/v1/channels/:slug", openapi.Operation{Summary: "Update channel metadata (owner)", Tags: []string{"channels"}, Request: models.UpdateChannelRequest{}, Response: models.Channel{}})
+	spec.Describe("POST", "/api/v1/channels/:slug/start", openapi.Operation{Summary: "Start a stream (owner)", Description: "The body is optional; it marks the stream mature and sets its content tags.", Tags: []string{"streams"}, Request: models.StartStreamRequest{}, Response: models.Stream{}, Status: 201})
+	spec.Describe("POST", "/api/v1/channels/:slug/end", openapi.Operation{Summary: "End the live stream (owner)", Tags: []string{"streams"}, Response: ok})
+	spec.Describe("GET", "/api/v1/streams", openapi.Operation{Summary: "List live streams", Description: "Each stream comes with its channel, owner, follower count and current viewers. sort=recommended puts the channels the caller watched most in the last 30 days first. Mature streams and those with a hidden content tag are left out per the caller's content preferences.", Tags: []string{"streams"}, Query: []string{"sort"}, Response: []models.StreamWithChannel{}})
+	spec.Describe("PUT", "/api/v1/streams/:id/progress", openapi.Operation{Summary: "Record watch progress", Description: "Player heartbeat, about every 30 seconds: saves the resume position and adds up to a minute of watch time.", Tags: []string{"streams"}, Request: models.WatchProgressRequest{}, Response: models.WatchEntry{}})
+	spec.Describe("POST", "/api/v1/streams/:id/heartbeat", openapi.Operation{Summary: "Send a player heartbeat", Description: "Sent about every 30 seconds while a stream plays, also with a guest token. Counts the caller as a viewer of a live stream; for signed-in users it also saves the resume position, adds up to a minute of watch time and earns channel points. Repeats from the same viewer and device_id within 20 seconds return counted=false and change nothing.", Tags: []string{"streams"}, Request: models.HeartbeatRequest{}, Response: models.HeartbeatResponse{}})
+	spec.Describe("POST", "/api/v1/analytics/events", openapi.Operation{Summary: "Report analytics events", Description: "Stores a batch of up to 100 player and chat events for channel analytics. A batch with an event breaking its type's schema is rejected; events for unknown channels or streams are dropped.", Tags: []string{"streams"}, Request: models.IngestAnalyticsRequest{}, Response: models.IngestAnalyticsResponse{}, Status: 202})
+	spec.Describe("POST", "/api/v1/channels/:slug/follow", openapi.Operation{Summary: "Follow a channel", Description: "Sends the owner a channel.followed WebSocket event unless they turned follow alerts off. Returns 429 FOLLOW_THROTTLED when too many new accounts from the caller's IP or network followed the channel recently.", Tags: []string{"channels"}, Response: ok})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/unfollow", openapi.Operation{Summary: "Unfollow a channel", Tags: []string{"channels"}, Response: ok})
+	spec.Describe("GET", "/api/v1/channels/:slug/overlay-token", openapi.Operation{Summary: "Describe the channel's overlay token (owner)", Tags: []string{"channels"}, Response: models.OverlayToken{}})
+	spec.Describe("POST", "/api/v1/channels/:slug/overlay-token", openapi.Operation{Summary: "Create an overlay token (owner)", Description: "Replaces the channel's previous token. The token and the overlay's events URL are only returned here.", Tags: []string{"channels"}, Response: models.CreateOverlayTokenResponse{}, Status: 201})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/overlay-token", openapi.Operation{Summary: "Revoke the overlay token (owner)", Tags: []string{"channels"}, Status: 204})
+	spec.Describe("GET", "/api/v1/channels/:slug/emotes", openapi.Operation{Summary: "List the channel's emotes", Description: "Custom emotes, written :name: in the channel's chat.", Tags: []string{"channels"}, Response: emotesResponse{}})
+	spec.Describe("PUT", "/api/v1/channels/:slug/emotes/:name", openapi.Operation{Summary: "Add or replace an emote (owner)", Description: "name is 2 to 32 letters, digits or underscores. Send images, base64 encoded by scale (1x required, as for badges), or an https image_url. Returns 409 once the channel has 50 emotes.", Tags: []string{"channels"}, Request: models.PutEmoteRequest{}, Response: models.Emote{}})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/emotes/:name", openapi.Operation{Summary: "Delete an emote (owner)", Description: "Messages already sent keep their tokens.", Tags: []string{"channels"}, Status: 204})
+	spec.Describe("GET", "/api/v1/channels/:slug/links", openapi.Operation{Summary: "List the channel's short links (owner)", Description: "Tracked short links with their click totals, newest first.", Tags: []string{"channels"}, Query: page, Response: pagination.Page[models.ChannelLink]{}})
+	spec.Describe("POST", "/api/v1/channels/:slug/links", openapi.Operation{Summary: "Create a short link (owner)", Description: "Leads to target_url, or to the channel's page without one.", Tags: []string{"channels"}, Request: models.CreateChannelLinkRequest{}, Response: models.ChannelLink{}, Status: 201})
+	spec.Describe("GET", "/api/v1/channels/:slug/links/:code", openapi.Operation{Summary: "Short link clicks (owner)", Description: "The link with its clicks per UTC day over the last days days (default 30, at most 90).", Tags: []string{"channels"}, Query: []string{"days"}, Response: models.ChannelLinkStats{}})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/links/:code", openapi.Operation{Summary: "Delete a short link (owner)", Tags: []string{"channels"}, Status: 204})
+	spec.Describe("GET", "/api/v1/channels/:slug/followers", openapi.Operation{Summary: "List channel followers", Tags: []string{"channels"}, Query: page, Response: pagination.Page[models.Follower]{}})
+	spec.Describe("GET", "/api/v1/channels/:slug/auto-messages", openapi.Operation{Summary: "Get the bot's welcome and announcement (owner)", Tags: []string{"moderation"}, Response: models.ChannelAutoMessages{}})
+	spec.Describe("PUT", "/api/v1/channels/:slug/auto-messages", openapi.Operation{Summary: "Configure the bot's welcome and announcement (owner)", Description: "Empty texts turn them off. {user} in the welcome mentions the newcomer. Announcements repeat every announcement_interval_min minutes while live.", Tags: []string{"moderation"}, Request: models.UpdateAutoMessagesRequest{}, Response: models.ChannelAutoMessages{}})
+	spec.Describe("GET", "/api/v1/channels/:slug/commands", openapi.Operation{Summary: "List the channel's chat commands", Tags: []string{"moderation"}, Response: commandsResponse{}})
+	spec.Describe("POST", "/api/v1/channels/:slug/commands", openapi.Operation{Summary: "Add a chat command (owner/mod)", Description: "The bot answers messages starting with !name. The response may use {user}, {channel}, {args} and {count}. Returns 409 if the name is taken.", Tags: []string{"moderation"}, Request: models.CreateCommandRequest{}, Response: models.ChannelCommand{}, Status: 201})
+	spec.Describe("PATCH", "/api/v1/channels/:slug/commands/:name", openapi.Operation{Summary: "Change a chat command (owner/mod)", Tags: []string{"moderation"}, Request: models.UpdateCommandRequest{}, Response: models.ChannelCommand{}})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/commands/:name", openapi.Operation{Summary: "Delete a chat command (owner/mod)", Tags: []string{"moderation"}, Response: ok})
+	spec.Describe("GET", "/api/v1/channels/:slug/badges", openapi.Operation{Summary: "List the channel's chat badges", Tags: []string{"channels"}, Response: badgesResponse{}})
+	spec.Describe("PUT", "/api/v1/channels/:slug/badges/:role", openapi.Operation{Summary: "Set the chat badge of a role (owner)", Description: "Role is owner, moderator or vip. Images are base64 PNG, GIF or WebP at 1x (required), 2x and 4x, at most 128 KiB each.", Tags: []string{"channels"}, Request: models.PutBadgeRequest{}, Response: models.ChannelBadge{}})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/badges/:role", openapi.Operation{Summary: "Remove the chat badge of a role (owner)", Tags: []string{"channels"}, Status: 204})
+	spec.Describe("GET", "/api/v1/channels/:slug/moderation/logs", openapi.Operation{Summary: "List moderation log entries (owner or moderator)", Tags: []string{"moderation"}, Query: page, Response: pagination.Page[models.ModerationLog]{}})
+	spec.Describe("GET", "/api/v1/channels/:slug/storage", openapi.Operation{Summary: "Get the chat's attachment storage (owner)", Description: "Bytes and number of attachments stored for the channel's chat, against ATTACHMENT_QUOTA_MIB, and when the oldest expires.", Tags: []string{"channels"}, Response: models.StorageUsage{}})
+	spec.Describe("GET", "/api/v1/channels/:slug/bot-scores", openapi.Operation{Summary: "List chatters' bot scores (owner or moderator)", Description: "Scores from 0 (human) to 1 (bot) kept by the moderation bot, most suspicious first.", Tags: []string{"moderation"}, Query: []string{"min_score", "limit"}, Response: botScoresResponse{}})
+	spec.Describe("POST", "/api/v1/channels/:slug/mods", openapi.Operation{Summary: "Assign a channel moderator (owner)", Tags: []string{"moderation"}, Request: models.AssignModeratorRequest{}, Response: ok})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/mods/:user_id", openapi.Operation{Summary: "Remove a channel moderator (owner)", Tags: []string{"moderation"}, Response: ok})
+	spec.Describe("POST", "/api/v1/channels/:slug/vips", openapi.Operation{Summary: "Make a user a channel VIP (owner)", Description: "Returns 409 for moderators.", Tags: []string{"moderation"}, Request: models.AssignVIPRequest{}, Response: ok})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/vips/:user_id", openapi.Operation{Summary: "Remove a channel VIP (owner)", Tags: []string{"moderation"}, Response: ok})
+	spec.Describe("POST", "/api/v1/channels/:slug/ban/:user_id", openapi.Operation{Summary: "Ban a user from channel chat", Tags: []string{"moderation"}, Request: models.BanUserRequest{}, Response: ok})
+	spec.Describe("DELETE", "/api/v1/channels/:slug/unban/:user_id", openapi.Operation{Summary: "Unban a user", Tags: []string{"moderation"}, Response: ok})
+	spec.Describe("GET", "/api/v1/channels/:slug/chat", openapi.Operation{Summary: "Read channel chat", Description: "Users banned from the chat get 403 BANNED. before_id acts as a cursor at that message; after_id returns newer messages, oldest first; send its next_cursor as cursor with the same after_id. include_deleted=true (moderators only) shows deleted messages in full with the moderation log entry behind their deletion.", Tags: []string{"chat"}, Query: append([]string{"before_id", "after_id", "include_deleted"}, page...), Response: pagination.Page[models.Message]{}})
+	spec.Describe("POST", "/api/v1/channels/:slug/chat", openapi.Operation{Summary: "Post to channel chat", Tags: []string{"chat"}, Request: models.SendMessageRequest{}, Response: models.Message{}, Status: 201})
+
+	// GraphQL
+	spec.Describe("POST", "/api/v1/graphql", openapi.Operation{Summary: "Run a GraphQL query", Description: "Read API for nested data (conversations with members, last messages and unread counts, channels with streams) in one request. Takes {query, variables, operationName}; the schema is available by introspection.", Tags: []string{"graphql"}})
+
+	// Admin
+	incl := []string{"include_deleted"}
+	spec.Describe("GET", "/api/v1/admin/users/:id", openapi.Operation{Summary: "Get a user", Tags: []string{"admin"}, Query: incl, Response: models.User{}})
+	spec.Describe("DELETE", "/api/v1/admin/users/:id", openapi.Operation{Summary: "Soft-delete a user", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("POST", "/api/v1/admin/users/:id/restore", openapi.Operation{Summary: "Restore a soft-deleted user", Description: "Returns 409 if another account has registered with the user's email since.", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("PUT", "/api/v1/admin/users/:id/role", openapi.Operation{Summary: "Change a user's platform role", Description: "A changed role signs the user out of every session.", Tags: []string{"admin"}, Request: models.SetRoleRequest{}, Response: setRoleResponse{}})
+	spec.Describe("GET", "/api/v1/admin/channels/:slug", openapi.Operation{Summary: "Get a channel", Tags: []string{"admin"}, Query: incl, Response: models.Channel{}})
+	spec.Describe("DELETE", "/api/v1/admin/channels/:slug", openapi.Operation{Summary: "Soft-delete a channel", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("POST", "/api/v1/admin/channels/:slug/restore", openapi.Operation{Summary: "Restore a soft-deleted channel", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("GET", "/api/v1/admin/conversations/:id", openapi.Operation{Summary: "Get a conversation", Tags: []string{"admin"}, Query: incl, Response: models.Conversation{}})
+	spec.Describe("DELETE", "/api/v1/admin/conversations/:id", openapi.Operation{Summary: "Soft-delete a conversation", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("POST", "/api/v1/admin/conversations/:id/restore", openapi.Operation{Summary: "Restore a soft-deleted conversation", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("GET", "/api/v1/admin/conversations/:id/messages", openapi.Operation{Summary: "List conversation messages", Tags: []string{"admin"}, Query: append([]string{"limit", "offset"}, incl...), Response: []models.Message{}})
+	spec.Describe("DELETE", "/api/v1/admin/messages/:id", openapi.Operation{Summary: "Soft-delete a message", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("POST", "/api/v1/admin/messages/:id/restore", openapi.Operation{Summary: "Restore a soft-deleted message", Tags: []string{"admin"}, Response: ok})
+	spec.Describe("GET", "/api/v1/admin/reports", openapi.Operation{Summary: "List message reports", Description: "status is pending (default), resolved or dismissed; newest first.", Tags: []string{"admin"}, Query: append([]string{"status"}, page...), Response: pagination.Page[models.MessageReport]{}})
+	spec.Describe("PATCH", "/api/v1/admin/reports/:id", openapi.Operation{Summary: "Resolve or dismiss a pending report", Tags: []string{"admin"}, Request: models.ResolveReportRequest{}, Response: models.MessageReport{}})
+	spec.Describe("GET", "/api/v1/admin/chat-stats", openapi.Operation{Summary: "Chat throughput by channel", Description: "Messages and automod actions per second and unique chatters over the last 1 and 5 minutes, for channels active within 5 minutes, busiest first. Requires Redis.", Tags: []string{"admin"}, Response: chatStatsResponse{}})
+	spec.Describe("GET", "/api/v1/admin/follow-bot-reports", openapi.Operation{Summary: "List removed follow-bot bursts", Description: "Follows by new accounts from one network that the follow-bot sweep removed, with the IPs and accounts involved; newest first.", Tags: []string{"admin"}, Query: page, Response: pagination.Page[models.FollowBotReport]{}})
+	spec.Describe("GET", "/api/v1/admin/announcements", openapi.Operation{Summary: "List announcements", Description: "The latest 100, scheduled ones included, by publish_at.", Tags: []string{"admin"}, Response: announcementsResponse{}})
+	spec.Describe("POST", "/api/v1/admin/announcements", openapi.Operation{Summary: "Broadcast an announcement", Description: "Sent as a system.announcement WebSocket event to everyone or, with audience streamers, to channel owners, and listed in-app until expires_at. Goes out at once unless publish_at is in the future.", Tags: []string{"admin"}, Request: models.CreateAnnouncementRequest{}, Response: models.Announcement{}, Status: 201})
+	spec.Describe("DELETE", "/api/v1/admin/announcements/:id", openapi.Operation{Summary: "Delete an announcement", Description: "Cancels a scheduled announcement or takes a sent one off the in-app list.", Tags: []string{"admin"}, Status: 204})
+	spec.Describe("GET", "/api/v1/admin/jobs", openapi.Operation{Summary: "Background job status", Description: "Schedules, last runs and errors as seen by the serving instance; only the leader runs jobs.", Tags: []string{"admin"}, Response: handlers.JobsStatusResponse{}})
+}
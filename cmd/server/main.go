@@ -1,40 +1,90 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/tullo/backend/config"
+	"github.com/tullo/backend/internal/apierror"
 	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/authz"
 	"github.com/tullo/backend/internal/cache"
 	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/graph"
 	"github.com/tullo/backend/internal/handlers"
+	"github.com/tullo/backend/internal/jobs"
+	"github.com/tullo/backend/internal/mail"
+	"github.com/tullo/backend/internal/metrics"
 	"github.com/tullo/backend/internal/middleware"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/moderation"
 	"github.com/tullo/backend/internal/moderator"
+	"github.com/tullo/backend/internal/openapi"
+	"github.com/tullo/backend/internal/preview"
+	"github.com/tullo/backend/internal/ratelimit"
 	"github.com/tullo/backend/internal/repository"
+	"github.com/tullo/backend/internal/rpc"
+	"github.com/tullo/backend/internal/secrets"
+	"github.com/tullo/backend/internal/translate"
 	"github.com/tullo/backend/internal/websocket"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 func main() {
-	// Load configuration
-	cfg, err := config.Load()
+	// Load configuration: -set flags, then env, then -config file and -profile
+	opts := config.BindFlags(flag.CommandLine)
+	flag.Parse()
+	cfg, err := config.LoadWithOptions(*opts)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Start the in-process Postgres for local development. It runs as a
+	// separate process, so stop it on Ctrl-C rather than leaving it behind.
+	if cfg.Database.Embedded {
+		log.Printf("Starting embedded Postgres in %s (the first run downloads it)", cfg.Database.EmbeddedDir)
+		stopDB, err := database.StartEmbedded(cfg.GetEmbeddedDB())
+		if err != nil {
+			log.Fatalf("Failed to start embedded database: %v", err)
+		}
+		go func() {
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+			<-sig
+			log.Println("Stopping embedded Postgres")
+			if err := stopDB(); err != nil {
+				log.Printf("Failed to stop embedded database: %v", err)
+			}
+			os.Exit(0)
+		}()
+	}
+
 	// Connect to database
 	db, err := database.NewPostgresDB(cfg.GetDSN())
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
+	db.SetSlowQueryThreshold(time.Duration(cfg.Database.SlowQueryMs) * time.Millisecond)
 
 	// Run migrations
 	log.Println("Running database migrations...")
-	if err := database.RunMigrations(db.DB); err != nil {
+	if err := database.RunMigrations(db); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 	log.Println("Migrations completed successfully")
+	if err := db.PrepareStatements(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
 
 	// Connect to Redis
 	redis, err := cache.NewRedisClient(cfg.GetRedisAddr(), cfg.Redis.Password, cfg.Redis.DB)
@@ -48,30 +98,269 @@ func main() {
 
 	// Initialize services
 	jwtService := auth.NewJWTService(cfg.JWT.Secret, cfg.JWT.ExpiryHours)
+	jwtService.SetRefreshExpiry(time.Duration(cfg.JWT.RefreshExpiryHours) * time.Hour)
+	jwtService.SetGuestExpiry(time.Duration(cfg.JWT.GuestExpiryMinutes) * time.Minute)
+
+	// Pick up rotated credentials from the secrets store
+	if len(cfg.Secrets.Loaded) > 0 && cfg.Secrets.RefreshSec > 0 {
+		provider, err := secrets.NewProvider(cfg.Secrets.ProviderConfig())
+		if err != nil {
+			log.Fatalf("Failed to create secrets provider: %v", err)
+		}
+		watcher := secrets.NewWatcher(provider, cfg.Secrets.Loaded)
+		watcher.OnChange(secrets.JWTSecret, jwtService.Rotate)
+		watcher.OnChange(secrets.DBPassword, db.SetPassword)
+		if redis != nil {
+			watcher.OnChange(secrets.RedisPassword, redis.SetPassword)
+		}
+		go watcher.Run(time.Duration(cfg.Secrets.RefreshSec) * time.Second)
+	}
+
+	mailSender, err := mail.NewSender(mail.Config{
+		Provider: cfg.Mail.Provider,
+		From:     cfg.Mail.From,
+		SMTP: mail.SMTPConfig{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+	mailer, err := mail.NewMailer(mailSender, mail.Links{AppURL: cfg.Mail.AppURL, APIURL: cfg.Mail.APIURL}, cfg.Mail.QueueSize)
+	if err != nil {
+		log.Fatalf("Failed to load mail templates: %v", err)
+	}
+	go mailer.Run()
 
 	// Initialize repositories
 	modRepo := repository.NewModerationRepository(db)
 	userRepo := repository.NewUserRepository(db)
 	convRepo := repository.NewConversationRepository(db)
 	msgRepo := repository.NewMessageRepository(db)
+	emailRepo := repository.NewEmailRepository(db)
+	refreshRepo := repository.NewRefreshTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	authEventRepo := repository.NewAuthEventRepository(db)
+	chRepo := repository.NewChannelRepository(db)
+
+	// Who may manage, moderate and post, for the REST, WebSocket and gRPC APIs
+	policy := authz.NewPolicy(convRepo, chRepo)
+	// Mutes and bans in channel chats and group conversations
+	moderationService := moderation.NewService(convRepo, modRepo, redis)
+
+	// ETags for conditional GETs of profiles and channel metadata
+	etags := middleware.NewETagCache(redis, time.Duration(cfg.Server.ETagTTLSec)*time.Second)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userRepo, jwtService)
-	convHandler := handlers.NewConversationHandler(convRepo, userRepo, msgRepo)
-	msgHandler := handlers.NewMessageHandler(msgRepo, convRepo, redis)
+	lockout := middleware.NewLoginLockout(redis, middleware.LoginLockoutConfig{
+		EmailAttempts: cfg.Lockout.EmailAttempts,
+		IPAttempts:    cfg.Lockout.IPAttempts,
+		Window:        time.Duration(cfg.Lockout.WindowMinutes) * time.Minute,
+		Base:          time.Duration(cfg.Lockout.BaseSec) * time.Second,
+		Max:           time.Duration(cfg.Lockout.MaxMinutes) * time.Minute,
+	})
+	lockout.Cleanup()
+	passwords := auth.NewPasswordHasher(cfg.Password.Algorithm, auth.Argon2Params{
+		Memory:      uint32(cfg.Password.Argon2MemoryKiB),
+		Iterations:  uint32(cfg.Password.Argon2Iterations),
+		Parallelism: uint8(cfg.Password.Argon2Parallelism),
+	})
+	authHandler := handlers.NewAuthHandler(userRepo, emailRepo, refreshRepo, jwtService, mailer, etags, lockout, passwords, authEventRepo)
+	// Social login offers the providers that have credentials configured
+	oauth := auth.NewOAuth(cfg.JWT.Secret)
+	if cfg.OAuth.GoogleClientID != "" {
+		oauth.Register(auth.NewGoogleProvider(cfg.OAuth.GoogleClientID, cfg.OAuth.GoogleClientSecret))
+	}
+	if cfg.OAuth.GitHubClientID != "" {
+		oauth.Register(auth.NewGitHubProvider(cfg.OAuth.GitHubClientID, cfg.OAuth.GitHubClientSecret))
+	}
+	identityRepo := repository.NewIdentityRepository(db)
+	oauthHandler := handlers.NewOAuthHandler(authHandler, identityRepo, oauth, cfg.Mail.APIURL, cfg.Mail.AppURL)
+
+	// Enterprise SSO: tokens from the configured OIDC issuer are accepted by
+	// the API and can be exchanged for Tullo sessions
+	var ssoHandler *handlers.SSOHandler
+	var externalTokens middleware.ExternalTokens
+	if cfg.OIDC.Issuer != "" {
+		verifier := auth.NewOIDCVerifier(cfg.OIDC.Issuer, cfg.OIDC.Audience, cfg.OIDC.JWKSURL, time.Duration(cfg.OIDC.JWKSCacheMinutes)*time.Minute, cfg.OIDC.TrustEmail)
+		ssoHandler = handlers.NewSSOHandler(authHandler, identityRepo, verifier)
+		externalTokens = ssoHandler
+		log.Printf("SSO enabled for issuer %s", verifier.Issuer())
+	}
+	emailHandler := handlers.NewEmailHandler(emailRepo)
+	convHandler := handlers.NewConversationHandler(convRepo, userRepo, msgRepo, policy, moderationService)
+	// Delivered messages carry a token that lets viewers report them later
+	reportSigner := auth.NewReportSigner(cfg.JWT.Secret)
+	sendPolicies := make(map[string]ratelimit.Policy, len(cfg.SendLimits))
+	for kind, p := range cfg.SendLimits {
+		sendPolicies[kind] = ratelimit.Policy{Rate: p.RatePerSec, Burst: p.Burst}
+	}
+	sendLimiter := middleware.NewSendLimiter(redis, sendPolicies)
+	sendLimiter.Cleanup()
+	// Link previews are fetched off the request path; a nil service skips them
+	var previews *preview.Service
+	if lp := cfg.LinkPreview; lp.Enabled {
+		timeout := time.Duration(lp.TimeoutSec) * time.Second
+		previews = preview.NewService(preview.NewFetcher(timeout, int64(lp.MaxKiB)<<10, false), msgRepo, redis, timeout, lp.QueueSize)
+		previews.Start(lp.WorkerCount)
+	}
+	msgHandler := handlers.NewMessageHandler(msgRepo, convRepo, redis, reportSigner, sendLimiter, policy, previews)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, authEventRepo)
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, authEventRepo, redis)
+	// Deleted accounts' messages stay, attributed to a placeholder user
+	var anonymizeTo uuid.UUID
+	if cfg.Purge.DeletedAccountMessages == "anonymize" {
+		deletedUser, err := userRepo.EnsureSystemUser("deleted-user@tullo.local", "Deleted user")
+		if err != nil {
+			log.Fatalf("Failed to ensure the deleted user placeholder: %v", err)
+		}
+		anonymizeTo = deletedUser.ID
+	}
+	accountHandler := handlers.NewAccountHandler(userRepo, sessionRepo, redis, etags, anonymizeTo)
+	reportHandler := handlers.NewReportHandler(msgRepo, convRepo, chRepo, repository.NewReportRepository(db), reportSigner, policy)
 
 	// Channel & stream repositories and handlers
-	chRepo := repository.NewChannelRepository(db)
 	streamRepo := repository.NewStreamRepository(db)
-	channelHandler := handlers.NewChannelHandler(chRepo, streamRepo, convRepo, userRepo, modRepo)
-	// configure local fallback rate/burst using env via config (burst default 10)
-	channelChatHandler := handlers.NewChannelChatHandler(chRepo, convRepo, msgRepo, redis, float64(cfg.API.RateLimitMessagesPerSec), 10)
+	watchRepo := repository.NewWatchHistoryRepository(db)
+	prefsRepo := repository.NewContentPreferenceRepository(db)
+	historyHandler := handlers.NewHistoryHandler(watchRepo, prefsRepo)
+	// Players beat about every 30 seconds; faster repeats per device are not counted
+	heartbeatDedup := middleware.NewHeartbeatDeduper(redis, 20*time.Second)
+	heartbeatDedup.Cleanup()
+	heartbeatHandler := handlers.NewHeartbeatHandler(streamRepo, watchRepo, repository.NewChannelPointsRepository(db), redis, heartbeatDedup,
+		cfg.Points.Amount, time.Duration(cfg.Points.IntervalMinutes)*time.Minute)
+	contentHandler := handlers.NewContentHandler(prefsRepo)
+	keyHandler := handlers.NewKeyHandler(repository.NewDeviceKeyRepository(db), convRepo)
+	// Follows by new accounts are limited per IP and network to slow down follow-botting
+	var asns *middleware.ASNTable
+	if cfg.FollowGuard.ASNFile != "" {
+		if asns, err = middleware.LoadASNTable(cfg.FollowGuard.ASNFile); err != nil {
+			log.Fatalf("Failed to load FOLLOW_GUARD_ASN_FILE: %v", err)
+		}
+	}
+	followGuard := middleware.NewFollowGuard(redis, middleware.FollowGuardConfig{
+		NewAccountAge: time.Duration(cfg.FollowGuard.NewAccountHours) * time.Hour,
+		Window:        time.Duration(cfg.FollowGuard.WindowMinutes) * time.Minute,
+		PerIP:         cfg.FollowGuard.PerIP,
+		PerNetwork:    cfg.FollowGuard.PerNetwork,
+	}, asns)
+	followGuard.Cleanup()
+	channelHandler := handlers.NewChannelHandler(chRepo, streamRepo, watchRepo, prefsRepo, convRepo, userRepo, modRepo, emailRepo, mailer, etags, redis, policy, moderationService, followGuard, cfg.API.FollowAlertsAggregateAt,
+		cfg.Channels.MaxPerUser, time.Duration(cfg.Channels.CooldownMinutes)*time.Minute)
+	channelChatHandler := handlers.NewChannelChatHandler(chRepo, msgRepo, redis, reportSigner, sendLimiter, policy, previews)
+	cmdRepo := repository.NewCommandRepository(db)
+	botScoreRepo := repository.NewBotScoreRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	commandHandler := handlers.NewCommandHandler(chRepo, cmdRepo, policy)
+	assetRepo := repository.NewAssetRepository(db)
+	badgeHandler := handlers.NewBadgeHandler(chRepo, repository.NewBadgeRepository(db), assetRepo, policy, cfg.Mail.APIURL)
+	analyticsEventRepo := repository.NewAnalyticsEventRepository(db)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsEventRepo)
+	dashboardHandler := handlers.NewDashboardHandler(chRepo, repository.NewDashboardRepository(db), redis)
+	// ADMIN_USER_IDS bootstraps the first admins; further roles are granted
+	// through the admin API. config.Load has checked that they are UUIDs.
+	for _, s := range cfg.Admin.UserIDs {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			log.Fatalf("Failed to load config: ADMIN_USER_IDS: %q is not a UUID", s)
+		}
+		changed, err := userRepo.SetRole(id, models.RoleAdmin)
+		if err != nil {
+			log.Printf("Warning: failed to grant admin to %s: %v", s, err)
+		} else if changed {
+			log.Printf("Granted admin to %s", s)
+		}
+	}
+	followBotRepo := repository.NewFollowBotRepository(db)
+	adminHandler := handlers.NewAdminHandler(userRepo, chRepo, convRepo, msgRepo, followBotRepo, etags, redis)
+	graphHandler := graph.Handler(graph.NewResolver(userRepo, convRepo, msgRepo, chRepo, streamRepo, prefsRepo))
+
+	// Recurring jobs; with Redis only the instance holding the leader lock runs them
+	scheduler := jobs.NewScheduler(redis, time.Duration(cfg.Jobs.LeaderLockSec)*time.Second)
+	jobsHandler := handlers.NewJobsHandler(scheduler)
+
+	// Permanently remove soft-deleted rows past the retention window
+	purgeJob := jobs.NewPurgeJob(userRepo, chRepo, convRepo, msgRepo, time.Duration(cfg.Purge.SoftDeleteRetentionDays)*24*time.Hour)
+	scheduler.Add("purge", jobs.Every(time.Duration(cfg.Purge.IntervalMinutes)*time.Minute), purgeJob.RunOnce)
+
+	// Delete or archive messages past their conversation's retention
+	retentionJob := jobs.NewRetentionJob(msgRepo, cfg.Purge.RetentionBatchSize)
+	scheduler.Add("retention", jobs.Every(time.Duration(cfg.Purge.RetentionIntervalMinutes)*time.Minute), retentionJob.RunOnce)
+
+	// Remove attachments past ATTACHMENT_RETENTION_DAYS. Nothing stores
+	// files yet; the storage backend will delete them in onExpired.
+	if cfg.Attachments.RetentionDays > 0 {
+		expiryJob := jobs.NewAttachmentExpiryJob(attachmentRepo, time.Duration(cfg.Attachments.RetentionDays)*24*time.Hour, cfg.Purge.RetentionBatchSize, nil)
+		scheduler.Add("attachment_expiry", jobs.Every(time.Duration(cfg.Attachments.IntervalMinutes)*time.Minute), expiryJob.RunOnce)
+	}
+
+	// Move old messages to cold storage (messages_archive)
+	if cfg.Archive.AfterMonths > 0 {
+		archiveJob := jobs.NewArchiveJob(msgRepo, cfg.Archive.AfterMonths, cfg.Archive.BatchSize)
+		scheduler.Add("archive", jobs.Every(time.Duration(cfg.Archive.IntervalMinutes)*time.Minute), archiveJob.RunOnce)
+	}
+
+	// Lift timed mutes and bans and notify clients when they lapse
+	moderationJob := jobs.NewModerationCleanupJob(convRepo, redis)
+	scheduler.Add("moderation_cleanup", jobs.Every(time.Duration(cfg.Jobs.ModerationSweepSec)*time.Second), moderationJob.RunOnce)
+	staleStreamJob := jobs.NewStaleStreamJob(streamRepo, time.Duration(cfg.Jobs.StreamStaleMinutes)*time.Minute, func(slug string) {
+		etags.Invalidate(middleware.ChannelETagKey(slug))
+	})
+	scheduler.Add("stale_streams", jobs.Every(5*time.Minute), staleStreamJob.RunOnce)
+
+	// Remove bursts of follows by new accounts from one network and report them to admins
+	if cfg.FollowGuard.SweepThreshold > 0 {
+		followBotJob := jobs.NewFollowBotSweepJob(followBotRepo, time.Duration(cfg.FollowGuard.SweepLookbackHours)*time.Hour, cfg.FollowGuard.SweepThreshold, func(slug string) {
+			etags.Invalidate(middleware.ChannelETagKey(slug))
+		})
+		scheduler.Add("follow_bot_sweep", jobs.Every(time.Duration(cfg.FollowGuard.SweepMinutes)*time.Minute), followBotJob.RunOnce)
+	}
+
+	// Personal data exports, assembled in the background
+	exportRepo := repository.NewExportRepository(db)
+	exportHandler := handlers.NewExportHandler(exportRepo, []byte(cfg.JWT.Secret), cfg.Mail.APIURL, time.Duration(cfg.Export.LinkTTLMinutes)*time.Minute)
+	exportJob := jobs.NewDataExportJob(exportRepo, time.Duration(cfg.Export.RetentionHours)*time.Hour)
+	scheduler.Add("data_export", jobs.Every(30*time.Second), exportJob.RunOnce)
+	announcementRepo := repository.NewAnnouncementRepository(db)
+	scheduler.Add("announcements", jobs.Every(15*time.Second), jobs.NewAnnouncementJob(announcementRepo, redis).RunOnce)
+
+	// Drop refresh token families that can no longer be used
+	scheduler.Add("refresh_token_cleanup", jobs.Every(time.Hour), jobs.NewRefreshTokenCleanupJob(refreshRepo).RunOnce)
+	scheduler.Add("auth_event_cleanup", jobs.Every(time.Hour), jobs.NewAuthEventCleanupJob(authEventRepo, time.Duration(cfg.Jobs.AuthEventRetentionDays)*24*time.Hour).RunOnce)
+
+	rollupSchedule, err := jobs.ParseCron(cfg.Jobs.AnalyticsRollupCron)
+	if err != nil {
+		log.Fatalf("Invalid ANALYTICS_ROLLUP_CRON: %v", err)
+	}
+	scheduler.Add("analytics_rollup", rollupSchedule, jobs.NewAnalyticsRollupJob(repository.NewAnalyticsRepository(db)).RunOnce)
+	scheduler.Add("analytics_event_cleanup", jobs.Every(time.Hour), jobs.NewAnalyticsEventCleanupJob(analyticsEventRepo, time.Duration(cfg.Jobs.AnalyticsEventRetentionDays)*24*time.Hour).RunOnce)
+
+	if redis != nil {
+		typingTTL := time.Duration(cfg.Jobs.TypingTTLSec) * time.Second
+		scheduler.Add("typing_sweep", jobs.Every(typingTTL), jobs.NewTypingSweepJob(redis, typingTTL).RunOnce)
+		// Per-channel chat throughput for /metrics
+		scheduler.Add("chat_stats", jobs.Every(15*time.Second), jobs.NewChatStatsJob(redis, chRepo).RunOnce)
+		// Follows of big channels, announced in aggregate
+		scheduler.Add("follow_alerts", jobs.Every(time.Duration(cfg.Jobs.FollowAlertsSec)*time.Second), jobs.NewFollowAlertsJob(redis, chRepo).RunOnce)
+	}
 
 	// Initialize WebSocket hub (only if Redis is available)
 	var hub *websocket.Hub
 	var wsHandler *websocket.Handler
 	if redis != nil {
-		hub = websocket.NewHub(redis, convRepo)
+		hub = websocket.NewHub(redis, convRepo, reportSigner, time.Duration(cfg.API.ChatViewersIntervalSec)*time.Second, cfg.API.WSFanoutWorkers, cfg.API.WSFanoutQueue)
+		// GET /channels/:slug reports chat viewers, so a changed count
+		// invalidates the channel's cached ETag
+		hub.OnStreamerLookup(chRepo.FilterOwners)
+		hub.OnChatViewersChanged(func(channelID uuid.UUID) {
+			if channels, err := chRepo.GetByIDs([]uuid.UUID{channelID}); err == nil && len(channels) == 1 {
+				etags.Invalidate(middleware.ChannelETagKey(channels[0].Slug))
+			}
+		})
 		go hub.Run()
 		// Ensure TulloBot system user exists
 		botUser, err := userRepo.EnsureSystemUser("tullo-bot@tullo.local", "TulloBot")
@@ -80,63 +369,269 @@ func main() {
 		}
 
 		// Start moderation bot
-		bot := moderator.NewBot(redis, convRepo, msgRepo, modRepo, userRepo, botUser.ID)
+		bot := moderator.NewBot(redis, convRepo, msgRepo, modRepo, userRepo, cmdRepo, botUser.ID)
+		bot.DetectBots(botScoreRepo, moderator.BotDetection{
+			MinMessages: cfg.Bots.MinMessages,
+			RestrictAt:  cfg.Bots.RestrictAt,
+			MuteFor:     time.Duration(cfg.Bots.MuteMinutes) * time.Minute,
+		})
 		go bot.Run()
-		wsHandler = websocket.NewHandler(hub, jwtService, msgRepo, convRepo, redis, cfg.CORS.AllowedOrigins)
+		wsHandler = websocket.NewHandler(hub, jwtService, msgRepo, convRepo, chRepo, sessionRepo, redis, sendLimiter, ratelimit.Policy{Rate: cfg.WSFrames.RatePerSec, Burst: cfg.WSFrames.Burst}, policy, previews, cfg.CORS.AllowedOrigins, cfg.API.WSQueryToken, time.Duration(cfg.API.WSResumeWindowSec)*time.Second)
+	}
+
+	// Stream overlays read channel alerts from the hub
+	var overlayFeed handlers.OverlayFeed
+	if hub != nil {
+		overlayFeed = hub
+	}
+	announcementHandler := handlers.NewAnnouncementHandler(announcementRepo, redis)
+	emoteHandler := handlers.NewEmoteHandler(chRepo, repository.NewEmoteRepository(db), assetRepo, policy, cfg.Mail.APIURL)
+	botScoreHandler := handlers.NewBotScoreHandler(chRepo, botScoreRepo, policy)
+	translator, err := translate.NewProvider(translate.Config{
+		Provider: cfg.Translation.Provider,
+		APIKey:   cfg.Translation.APIKey,
+		Timeout:  time.Duration(cfg.Translation.TimeoutSec) * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure translation: %v", err)
+	}
+	storageHandler := handlers.NewStorageHandler(chRepo, attachmentRepo, policy, int64(cfg.Attachments.QuotaMiB)<<20, time.Duration(cfg.Attachments.RetentionDays)*24*time.Hour)
+	translationHandler := handlers.NewTranslationHandler(msgRepo, repository.NewTranslationRepository(db), policy, translator, cfg.Translation.Provider)
+	linkHandler := handlers.NewLinkHandler(chRepo, repository.NewLinkRepository(db), policy, cfg.Mail.AppURL, cfg.Mail.APIURL)
+	overlayHandler := handlers.NewOverlayHandler(chRepo, repository.NewOverlayTokenRepository(db), policy, overlayFeed, cfg.Mail.APIURL)
+
+	// Email unread mentions to users who are offline
+	if cfg.Mail.DigestIntervalMinutes > 0 {
+		var isOnline func(uuid.UUID) bool
+		if hub != nil {
+			isOnline = hub.IsUserOnline
+		}
+		digestJob := jobs.NewMentionDigestJob(emailRepo, mailer, isOnline, 7*24*time.Hour)
+		scheduler.Add("mention_digest", jobs.Every(time.Duration(cfg.Mail.DigestIntervalMinutes)*time.Minute), digestJob.RunOnce)
+	}
+	scheduler.Start()
+
+	// Internal gRPC API for backend services
+	if cfg.GRPC.Port != "" {
+		lis, err := net.Listen("tcp", ":"+cfg.GRPC.Port)
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC: %v", err)
+		}
+		grpcServer := rpc.NewGRPCServer(rpc.NewServer(convRepo, msgRepo, chRepo, streamRepo, redis, policy, previews), cfg.GRPC.AuthToken)
+		go func() {
+			log.Printf("Starting internal gRPC server on %s", lis.Addr())
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("gRPC server failed: %v", err)
+			}
+		}()
 	}
 
 	// Initialize rate limiter
-	rateLimiter := middleware.NewRateLimiter(cfg.API.RateLimitMessagesPerSec)
+	policies := make(map[string]ratelimit.Policy, len(cfg.RateLimits))
+	for name, p := range cfg.RateLimits {
+		policies[name] = ratelimit.Policy{Rate: p.RatePerSec, Burst: p.Burst}
+	}
+	rateLimiter := middleware.NewRateLimiter(redis, policies)
 	rateLimiter.Cleanup()
 
+	// IP limiter for endpoints reachable before authentication
+	ipPolicies := make(map[string]ratelimit.Policy, len(cfg.IPLimit.Policies))
+	for name, p := range cfg.IPLimit.Policies {
+		ipPolicies[name] = ratelimit.Policy{Rate: p.RatePerSec, Burst: p.Burst}
+	}
+	ipLimiter := middleware.NewIPLimiter(redis, middleware.IPLimiterConfig{
+		Policies:    ipPolicies,
+		BlockAfter:  cfg.IPLimit.BlockAfter,
+		BlockWindow: time.Duration(cfg.IPLimit.BlockWindowSec) * time.Second,
+		BlockFor:    time.Duration(cfg.IPLimit.BlockMinutes) * time.Minute,
+	})
+	ipLimiter.Cleanup()
+
 	// Setup Gin router
 	if cfg.Server.Env == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	router := gin.Default()
+	router.NoRoute(func(c *gin.Context) {
+		apierror.Write(c, http.StatusNotFound, apierror.NotFound, "Route not found", nil)
+	})
+	apierror.UseJSONFieldNames()
+	// Only believe X-Forwarded-For from configured proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Middleware
-	router.Use(middleware.CORSMiddleware(cfg.CORS.AllowedOrigins))
+	router.Use(middleware.CORSMiddleware(middleware.CORSOptions{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAgeSec:        cfg.CORS.MaxAgeSec,
+	}))
+	if cfg.Server.CompressMinBytes > 0 {
+		// The WebSocket connection negotiates its own compression
+		router.Use(middleware.Compress(cfg.Server.CompressMinBytes, "/ws", "/overlay/events"))
+	}
+	if cfg.TLS.Enabled() && cfg.TLS.HSTSMaxAgeSec > 0 {
+		router.Use(middleware.HSTS(cfg.TLS.HSTSMaxAgeSec, cfg.TLS.HSTSIncludeSubdomains))
+	}
+	router.Use(middleware.BodyLimit(cfg.Server.MaxBodyBytes))
+	jsonBody := middleware.JSONBody(cfg.Server.MaxJSONDepth)
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Health checks
+	healthHandler := handlers.NewHealthHandler(db, redis)
+	healthLimit := ipLimiter.Limit(middleware.IPScopeHealth)
+	router.GET("/health", healthLimit, healthHandler.Live)
+	router.GET("/health/live", healthLimit, healthHandler.Live)
+	router.GET("/health/ready", healthLimit, healthHandler.Ready)
+	if cfg.Metrics.Token != "" {
+		router.GET("/metrics", middleware.BearerToken(cfg.Metrics.Token), gin.WrapH(metrics.Default.Handler()))
+	}
+
+	// API documentation, generated from the registered routes
+	spec := openapi.New("Tullo API", "1.0.0")
+	spec.SetAPIKeyHeader(cfg.API.KeyHeader)
+	describeAPI(spec)
+	router.GET("/openapi.json", spec.Handler(router.Routes))
+	router.GET("/docs", openapi.DocsHandler("/openapi.json"))
 
 	// Public routes
 	authRoutes := router.Group("/auth")
+	authRoutes.Use(ipLimiter.Limit(middleware.IPScopeAuth), jsonBody)
 	{
-		authRoutes.POST("/register", authHandler.Register)
-		authRoutes.POST("/login", authHandler.Login)
+		authRoutes.POST("/register", rateLimiter.Limit(middleware.PolicyAuth), authHandler.Register)
+		authRoutes.POST("/login", rateLimiter.Limit(middleware.PolicyAuth), authHandler.Login)
+		authRoutes.POST("/refresh", rateLimiter.Limit(middleware.PolicyAuth), authHandler.Refresh)
+		if cfg.JWT.GuestExpiryMinutes > 0 {
+			authRoutes.POST("/guest", authHandler.Guest)
+		}
+		authRoutes.POST("/verify-email", authHandler.VerifyEmail)
+		authRoutes.POST("/password/forgot", rateLimiter.Limit(middleware.PolicyAuth), authHandler.ForgotPassword)
+		authRoutes.POST("/password/reset", rateLimiter.Limit(middleware.PolicyAuth), authHandler.ResetPassword)
+		authRoutes.GET("/oauth/:provider", oauthHandler.Start)
+		authRoutes.GET("/oauth/:provider/callback", rateLimiter.Limit(middleware.PolicyAuth), oauthHandler.Callback)
+		if ssoHandler != nil {
+			authRoutes.POST("/oidc/exchange", rateLimiter.Limit(middleware.PolicyAuth), ssoHandler.Exchange)
+		}
 	}
 
+	// Unsubscribe links from notification emails
+	unsubscribeLimit := ipLimiter.Limit(middleware.IPScopeAuth)
+	router.GET("/email/unsubscribe", unsubscribeLimit, emailHandler.Unsubscribe)
+	router.POST("/email/unsubscribe", unsubscribeLimit, emailHandler.Unsubscribe)
+
+	// Signed download links for data exports
+	router.GET("/exports/:id/download", ipLimiter.Limit(middleware.IPScopeAuth), exportHandler.Download)
+
+	// Channel alerts for stream overlays, authenticated by overlay token
+	router.GET("/overlay/events", ipLimiter.Limit(middleware.IPScopeWS), overlayHandler.Events)
+
+	// Tracked short links of channel promos
+	linkLimit := ipLimiter.Limit(middleware.IPScopeLinks)
+	router.GET("/l/:code", linkLimit, linkHandler.Redirect)
+	router.HEAD("/l/:code", linkLimit, linkHandler.Redirect)
+
+	// Uploaded images by content hash; they share the short links' budget
+	router.GET("/assets/:hash", linkLimit, handlers.NewAssetHandler(assetRepo).GetAsset)
+
 	// WebSocket endpoint (only if Redis is available)
 	if wsHandler != nil {
-		router.GET("/ws", wsHandler.HandleWebSocket)
+		router.GET("/ws", ipLimiter.Limit(middleware.IPScopeWS), wsHandler.HandleWebSocket)
 	}
 
 	// Protected routes
+	meETag := etags.Handle(func(c *gin.Context) string {
+		userID, _ := c.Get("user_id")
+		return middleware.UserETagKey(userID.(uuid.UUID))
+	})
+	// GET /channels/:slug includes the caller's follow and role; the handlers
+	// changing those invalidate the channel's ETag too
+	channelETag := etags.Handle(func(c *gin.Context) string {
+		return middleware.ChannelETagKey(c.Param("slug"))
+	})
+
+	moderate := middleware.RequireScope(models.ScopeModerate)
+
 	api := router.Group("/api/v1")
-	api.Use(middleware.AuthMiddleware(jwtService))
+	// API keys act as their owner, limited to their scopes; POST /graphql only reads
+	api.Use(middleware.AuthMiddleware(jwtService, sessionRepo, apiKeyRepo, cfg.API.KeyHeader, externalTokens), middleware.KeyScopes("/api/v1/graphql"), middleware.GuestRoutes("/api/v1/channels/:slug", "/api/v1/channels/:slug/chat", "/api/v1/channels/:slug/emotes", "POST /api/v1/streams/:id/heartbeat"), jsonBody)
 	{
 		// User routes
-		api.GET("/me", authHandler.GetMe)
+		api.GET("/me", meETag, authHandler.GetMe)
+		api.PATCH("/me", authHandler.UpdateMe)
+		api.PUT("/me/username", authHandler.SetUsername)
+		api.DELETE("/me", middleware.SessionOnly(), rateLimiter.Limit(middleware.PolicyAuth), accountHandler.DeleteAccount)
+		api.POST("/me/verify-email", rateLimiter.Limit(middleware.PolicyAuth), authHandler.ResendVerification)
+		api.GET("/me/email-preferences", emailHandler.GetPreferences)
+		api.PATCH("/me/email-preferences", emailHandler.UpdatePreferences)
+		api.GET("/me/content-preferences", contentHandler.GetPreferences)
+		api.PATCH("/me/content-preferences", contentHandler.UpdatePreferences)
+		api.GET("/me/privacy", convHandler.GetPrivacy)
+		api.PATCH("/me/privacy", convHandler.UpdatePrivacy)
+		api.GET("/me/dnd", convHandler.GetDoNotDisturb)
+		api.PUT("/me/dnd", convHandler.SetDoNotDisturb)
+		api.DELETE("/me/dnd", convHandler.ClearDoNotDisturb)
+		api.GET("/me/message-requests", convHandler.ListMessageRequests)
+		api.POST("/message-requests/:id/accept", convHandler.AcceptMessageRequest)
+		api.POST("/message-requests/:id/decline", convHandler.DeclineMessageRequest)
+		api.POST("/me/read-all", msgHandler.MarkAllAsRead)
+		api.GET("/me/dashboard", dashboardHandler.GetDashboard)
+		api.GET("/me/history", historyHandler.ListHistory)
+		api.POST("/me/export", exportHandler.RequestExport)
+		api.GET("/me/exports/:id", exportHandler.GetExport)
+		api.GET("/me/sessions", middleware.SessionOnly(), sessionHandler.ListSessions)
+		api.DELETE("/me/sessions/:id", middleware.SessionOnly(), sessionHandler.RevokeSession)
+		api.GET("/me/security-events", middleware.SessionOnly(), sessionHandler.ListSecurityEvents)
+		api.GET("/announcements", announcementHandler.ListActive)
+		api.GET("/me/device-keys", keyHandler.ListKeys)
+		api.PUT("/me/device-keys/:device_id", keyHandler.PublishKey)
+		api.DELETE("/me/device-keys/:device_id", keyHandler.DeleteKey)
+
+		// API keys are managed from a login session only
+		keys := api.Group("/keys", middleware.SessionOnly())
+		keys.GET("", apiKeyHandler.ListKeys)
+		keys.POST("", apiKeyHandler.CreateKey)
+		keys.GET("/:id", apiKeyHandler.GetKey)
+		keys.PATCH("/:id", apiKeyHandler.UpdateKey)
+		keys.DELETE("/:id", apiKeyHandler.RevokeKey)
 
 		// Conversation routes
 		api.GET("/conversations", convHandler.GetConversations)
 		api.POST("/conversations", convHandler.CreateConversation)
+		api.GET("/conversations/unread", convHandler.GetUnreadCounts)
 		api.GET("/conversations/:id", convHandler.GetConversation)
+		api.PATCH("/conversations/:id", convHandler.UpdateConversation)
+		api.GET("/conversations/:id/draft", convHandler.GetDraft)
+		api.PUT("/conversations/:id/draft", convHandler.SaveDraft)
+		api.PUT("/conversations/:id/read", msgHandler.MarkConversationRead)
+		api.GET("/conversations/:id/notifications", convHandler.GetNotificationSettings)
+		api.PUT("/conversations/:id/notifications", convHandler.UpdateNotificationSettings)
+		api.GET("/conversations/:id/keys", keyHandler.ConversationKeys)
+		api.GET("/conversations/:id/storage", storageHandler.GetConversationStorage)
+		api.GET("/conversations/:id/reports", moderate, reportHandler.ListConversationReports)
+		api.PATCH("/conversations/:id/reports/:report_id", moderate, reportHandler.ResolveConversationReport)
 		api.POST("/conversations/:id/members", convHandler.AddMembers)
 		api.DELETE("/conversations/:id/members/:user_id", convHandler.RemoveMember)
 		// Moderation endpoints
-		api.POST("/conversations/:id/moderation", convHandler.AddModeration)
-		api.DELETE("/conversations/:id/moderation/:user_id", convHandler.RemoveModeration)
+		api.POST("/conversations/:id/mutes", moderate, convHandler.MuteUser)
+		api.DELETE("/conversations/:id/mutes/:user_id", moderate, convHandler.UnmuteUser)
+		api.POST("/conversations/:id/bans", moderate, convHandler.BanUser)
+		api.DELETE("/conversations/:id/bans/:user_id", moderate, convHandler.UnbanUser)
+		// Deprecated: the action is a body field or query parameter
+		api.POST("/conversations/:id/moderation", moderate, convHandler.AddModeration)
+		api.DELETE("/conversations/:id/moderation/:user_id", moderate, convHandler.RemoveModeration)
 
 		// Message routes
 		api.GET("/messages", msgHandler.GetMessages)
-		api.POST("/messages", middleware.RateLimitMiddleware(rateLimiter), msgHandler.SendMessage)
+		api.POST("/messages", rateLimiter.Limit(middleware.PolicyMessageSend), msgHandler.SendMessage)
 		api.PUT("/messages/:id/read", msgHandler.MarkMessageAsRead)
+		api.DELETE("/messages/:id", msgHandler.DeleteMessage)
+		api.POST("/messages/:id/restore", msgHandler.RestoreMessage)
+		api.POST("/messages/:id/report", reportHandler.ReportMessage)
+		api.POST("/messages/:id/translate", rateLimiter.Limit(middleware.PolicyTranslate), translationHandler.TranslateMessage)
 
 		// WebSocket info (only if Redis is available)
 		if wsHandler != nil {
@@ -144,29 +639,138 @@ func main() {
 		}
 
 		// Channel routes
-		api.POST("/channels", channelHandler.CreateChannel)
-		api.GET("/channels/:slug", channelHandler.GetChannel)
+		api.GET("/channels", channelHandler.ListChannels)
+		api.POST("/channels", rateLimiter.Limit(middleware.PolicyChannelCreate), channelHandler.CreateChannel)
+		api.GET("/channels/:slug", channelETag, channelHandler.GetChannel)
+		api.PATCH("/channels/:slug", channelHandler.UpdateChannel)
 		api.POST("/channels/:slug/start", channelHandler.StartStream)
 		api.POST("/channels/:slug/end", channelHandler.EndStream)
 		api.GET("/streams", channelHandler.GetActiveStreams)
-		api.POST("/channels/:slug/follow", channelHandler.FollowChannel)
-		api.DELETE("/channels/:slug/unfollow", channelHandler.UnfollowChannel)
+		api.PUT("/streams/:id/progress", historyHandler.RecordProgress)
+		api.POST("/streams/:id/heartbeat", heartbeatHandler.Heartbeat)
+		api.POST("/channels/:slug/follow", rateLimiter.Limit(middleware.PolicyFollow), channelHandler.FollowChannel)
+		api.DELETE("/channels/:slug/unfollow", rateLimiter.Limit(middleware.PolicyFollow), channelHandler.UnfollowChannel)
+		api.GET("/channels/:slug/followers", channelHandler.ListFollowers)
+		api.GET("/channels/:slug/overlay-token", overlayHandler.GetToken)
+		api.POST("/channels/:slug/overlay-token", overlayHandler.CreateToken)
+		api.DELETE("/channels/:slug/overlay-token", overlayHandler.RevokeToken)
+		api.GET("/channels/:slug/emotes", emoteHandler.ListEmotes)
+		api.PUT("/channels/:slug/emotes/:name", emoteHandler.PutEmote)
+		api.DELETE("/channels/:slug/emotes/:name", emoteHandler.DeleteEmote)
+		api.GET("/channels/:slug/links", linkHandler.ListLinks)
+		api.POST("/channels/:slug/links", linkHandler.CreateLink)
+		api.GET("/channels/:slug/links/:code", linkHandler.GetLinkStats)
+		api.DELETE("/channels/:slug/links/:code", linkHandler.DeleteLink)
+		api.GET("/channels/:slug/moderation/logs", moderate, channelHandler.ListModerationLogs)
+		api.GET("/channels/:slug/bot-scores", moderate, botScoreHandler.ListBotScores)
+		api.GET("/channels/:slug/storage", storageHandler.GetChannelStorage)
+		api.GET("/channels/:slug/reports", moderate, reportHandler.ListChannelReports)
+		api.PATCH("/channels/:slug/reports/:report_id", moderate, reportHandler.ResolveChannelReport)
+		api.GET("/channels/:slug/auto-messages", channelHandler.GetAutoMessages)
+		api.PUT("/channels/:slug/auto-messages", channelHandler.UpdateAutoMessages)
+		api.GET("/channels/:slug/commands", commandHandler.ListCommands)
+		api.POST("/channels/:slug/commands", commandHandler.CreateCommand)
+		api.PATCH("/channels/:slug/commands/:name", commandHandler.UpdateCommand)
+		api.DELETE("/channels/:slug/commands/:name", commandHandler.DeleteCommand)
+		api.GET("/channels/:slug/badges", badgeHandler.ListBadges)
+		api.PUT("/channels/:slug/badges/:role", badgeHandler.PutBadge)
+		api.DELETE("/channels/:slug/badges/:role", badgeHandler.DeleteBadge)
 		// channel-level moderator management
-		api.POST("/channels/:slug/mods", channelHandler.AssignModerator)
-		api.DELETE("/channels/:slug/mods/:user_id", channelHandler.RemoveModerator)
+		api.POST("/channels/:slug/mods", moderate, channelHandler.AssignModerator)
+		api.DELETE("/channels/:slug/mods/:user_id", moderate, channelHandler.RemoveModerator)
+		api.POST("/channels/:slug/vips", moderate, channelHandler.AssignVIP)
+		api.DELETE("/channels/:slug/vips/:user_id", moderate, channelHandler.RemoveVIP)
 		// ban/unban
-		api.POST("/channels/:slug/ban/:user_id", channelHandler.BanUser)
-		api.DELETE("/channels/:slug/unban/:user_id", channelHandler.UnbanUser)
+		api.POST("/channels/:slug/ban/:user_id", moderate, channelHandler.BanUser)
+		api.DELETE("/channels/:slug/unban/:user_id", moderate, channelHandler.UnbanUser)
 
 		// Channel chat routes
 		api.GET("/channels/:slug/chat", channelChatHandler.GetChat)
-		api.POST("/channels/:slug/chat", middleware.RateLimitMiddleware(rateLimiter), channelChatHandler.PostChat)
+		api.POST("/channels/:slug/chat", rateLimiter.Limit(middleware.PolicyMessageSend), channelChatHandler.PostChat)
+
+		// Client events for channel analytics
+		api.POST("/analytics/events", rateLimiter.Limit(middleware.PolicyAnalytics), analyticsHandler.IngestEvents)
+
+		// GraphQL read API
+		api.POST("/graphql", graphHandler)
+	}
+
+	// Admin routes
+	admin := api.Group("/admin")
+	admin.Use(middleware.RequireRole(models.RoleAdmin), moderate)
+	{
+		admin.GET("/users/:id", adminHandler.GetUser)
+		admin.DELETE("/users/:id", adminHandler.DeleteUser)
+		admin.POST("/users/:id/restore", adminHandler.RestoreUser)
+		admin.PUT("/users/:id/role", adminHandler.SetUserRole)
+		admin.GET("/channels/:slug", adminHandler.GetChannel)
+		admin.DELETE("/channels/:slug", adminHandler.DeleteChannel)
+		admin.POST("/channels/:slug/restore", adminHandler.RestoreChannel)
+		admin.GET("/conversations/:id", adminHandler.GetConversation)
+		admin.DELETE("/conversations/:id", adminHandler.DeleteConversation)
+		admin.POST("/conversations/:id/restore", adminHandler.RestoreConversation)
+		admin.GET("/conversations/:id/messages", adminHandler.GetConversationMessages)
+		admin.DELETE("/messages/:id", adminHandler.DeleteMessage)
+		admin.POST("/messages/:id/restore", adminHandler.RestoreMessage)
+		admin.GET("/reports", reportHandler.ListReports)
+		admin.PATCH("/reports/:id", reportHandler.ResolveReport)
+		admin.GET("/follow-bot-reports", adminHandler.ListFollowBotReports)
+		admin.GET("/jobs", jobsHandler.Status)
+		admin.GET("/announcements", announcementHandler.ListAnnouncements)
+		admin.POST("/announcements", announcementHandler.CreateAnnouncement)
+		admin.DELETE("/announcements/:id", announcementHandler.DeleteAnnouncement)
+		if redis != nil {
+			admin.GET("/chat-stats", handlers.NewChatStatsHandler(redis, chRepo).ListChatStats)
+		}
+	}
+
+	for _, route := range spec.Stale(router.Routes()) {
+		log.Printf("Warning: OpenAPI description for unregistered route %s", route)
 	}
 
 	// Start server
 	addr := ":" + cfg.Server.Port
-	log.Printf("Starting Tullo server on %s (env: %s)", addr, cfg.Server.Env)
-	if err := router.Run(addr); err != nil {
+	log.Printf("Starting Tullo server on %s (env: %s, tls: %t)", addr, cfg.Server.Env, cfg.TLS.Enabled())
+	if err := serve(addr, router, cfg.TLS); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// serve runs the HTTP server on addr, terminating TLS itself when configured.
+// HTTP/2 is negotiated automatically over TLS.
+func serve(addr string, handler http.Handler, tlsCfg config.TLSConfig) error {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	if !tlsCfg.Enabled() {
+		return srv.ListenAndServe()
+	}
+
+	redirect := middleware.HTTPSRedirect(strings.TrimPrefix(addr, ":"))
+	if len(tlsCfg.AutocertHosts) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsCfg.AutocertHosts...),
+			Cache:      autocert.DirCache(tlsCfg.AutocertCacheDir),
+			Email:      tlsCfg.AutocertEmail,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		// HTTP-01 challenges arrive on the redirect listener; everything else is redirected
+		redirect = m.HTTPHandler(redirect)
+	}
+
+	if tlsCfg.RedirectPort != "" {
+		go func() {
+			log.Printf("Redirecting HTTP on :%s to HTTPS", tlsCfg.RedirectPort)
+			redirectSrv := &http.Server{
+				Addr:              ":" + tlsCfg.RedirectPort,
+				Handler:           redirect,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			if err := redirectSrv.ListenAndServe(); err != nil {
+				log.Fatalf("HTTP redirect server failed: %v", err)
+			}
+		}()
+	}
+
+	// With autocert the certificate comes from srv.TLSConfig and both paths are empty
+	return srv.ListenAndServeTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+}
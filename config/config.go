@@ -1,12 +1,16 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/secrets"
 )
 
 type Config struct {
@@ -16,11 +20,49 @@ type Config struct {
 	JWT      JWTConfig
 	API      APIConfig
 	CORS     CORSConfig
+	Admin    AdminConfig
+	Purge    PurgeConfig
+	Archive  ArchiveConfig
+	// RateLimits holds named per-route policies (auth, message_send, channel_create, follow, analytics, translate)
+	RateLimits map[string]RateLimitPolicy
+	// SendLimits holds per (user, conversation) send policies by conversation
+	// kind (direct, group, channel)
+	SendLimits  map[string]RateLimitPolicy
+	IPLimit     IPLimitConfig
+	WSFrames    RateLimitPolicy
+	Lockout     LoginLockoutConfig
+	FollowGuard FollowGuardConfig
+	LinkPreview LinkPreviewConfig
+	Points      ChannelPointsConfig
+	Channels    ChannelLimitConfig
+	Bots        BotDetectionConfig
+	Translation TranslationConfig
+	Attachments AttachmentConfig
+	Password    PasswordConfig
+	Mail        MailConfig
+	GRPC        GRPCConfig
+	Metrics     MetricsConfig
+	TLS         TLSConfig
+	Secrets     SecretsConfig
+	Jobs        JobsConfig
+	Export      ExportConfig
+	OAuth       OAuthConfig
+	OIDC        OIDCConfig
 }
 
 type ServerConfig struct {
 	Port string
 	Env  string
+	// TrustedProxies lists proxy IPs/CIDRs whose X-Forwarded-For is believed
+	// when determining the client IP; empty trusts none
+	TrustedProxies []string
+	// MaxBodyBytes caps request bodies; MaxJSONDepth caps object/array nesting in JSON bodies
+	MaxBodyBytes int64
+	MaxJSONDepth int
+	// ETagTTLSec bounds how long a cached ETag is trusted without an invalidation
+	ETagTTLSec int
+	// CompressMinBytes is the smallest response body that is gzip/deflate encoded (0 disables compression)
+	CompressMinBytes int
 }
 
 type DatabaseConfig struct {
@@ -30,6 +72,13 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	// SlowQueryMs logs queries slower than this many milliseconds (0 disables)
+	SlowQueryMs int
+	// Embedded runs Postgres in-process from EmbeddedDir instead of
+	// connecting to a provisioned server (development only; needs a binary
+	// built with -tags embedpg)
+	Embedded    bool
+	EmbeddedDir string
 }
 
 type RedisConfig struct {
@@ -42,82 +91,618 @@ type RedisConfig struct {
 type JWTConfig struct {
 	Secret      string
 	ExpiryHours int
+	// RefreshExpiryHours is how long a refresh token stays usable; each
+	// refresh issues a new one with a fresh lifetime
+	RefreshExpiryHours int
+	// GuestExpiryMinutes is how long a guest token from POST /auth/guest
+	// stays usable (0 disables guest tokens)
+	GuestExpiryMinutes int
 }
 
 type APIConfig struct {
+	// KeyHeader carries API keys, an alternative to the bearer token
 	KeyHeader               string
 	RateLimitMessagesPerSec int
+	// ChatViewersIntervalSec is how often WebSocket clients with a channel
+	// chat open get its chat viewer count (0 disables)
+	ChatViewersIntervalSec int
+	// WSFanoutWorkers and WSFanoutQueue size the pool delivering
+	// conversation events to WebSocket clients: the number of workers and
+	// how many events each queues before the Redis subscriber waits
+	WSFanoutWorkers int
+	WSFanoutQueue   int
+	// FollowAlertsAggregateAt is the follower count from which a channel's
+	// owner gets follows summed up every Jobs.FollowAlertsSec instead of one
+	// channel.followed event per follower (0 never aggregates)
+	FollowAlertsAggregateAt int
+	// WSQueryToken accepts WebSocket tokens in the ?token= query parameter.
+	// Deprecated: tokens in URLs end up in logs; clients should send them in
+	// the Authorization header or a tullo.auth.<token> subprotocol.
+	WSQueryToken bool
+	// WSResumeWindowSec is how long after a WebSocket connection closes a
+	// reconnect can restore its subscriptions with its resume token (0
+	// disables)
+	WSResumeWindowSec int
 }
 
+// CORSConfig drives the CORS middleware and the WebSocket origin check.
+// AllowedOrigins accepts exact origins, "*" and wildcard subdomains such as
+// "*.example.com" or "https://*.example.com".
 type CORSConfig struct {
-	AllowedOrigins []string
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAgeSec        int
 }
 
-// Load loads configuration from environment variables
+// RateLimitPolicy is a token bucket refilled at RatePerSec up to Burst tokens
+type RateLimitPolicy struct {
+	RatePerSec float64
+	Burst      int
+}
+
+// IPLimitConfig configures per-IP limits for unauthenticated endpoints
+type IPLimitConfig struct {
+	// Policies holds the auth, ws, health and links scopes
+	Policies map[string]RateLimitPolicy
+	// BlockAfter violations within BlockWindowSec block the IP for BlockMinutes (0 disables blocking)
+	BlockAfter     int
+	BlockWindowSec int
+	BlockMinutes   int
+}
+
+// PasswordConfig selects how new passwords are hashed. Hashes of the other
+// algorithm keep working and are replaced on the user's next login.
+type PasswordConfig struct {
+	// Algorithm is "bcrypt" or "argon2id"
+	Algorithm string
+	// Argon2 cost parameters; memory in KiB
+	Argon2MemoryKiB   int
+	Argon2Iterations  int
+	Argon2Parallelism int
+}
+
+// LoginLockoutConfig configures lockouts after repeated failed logins. Past
+// the attempt limit each failure doubles the lockout, from BaseSec up to
+// MaxMinutes.
+type LoginLockoutConfig struct {
+	// EmailAttempts and IPAttempts are the failures allowed per email address
+	// and per client IP (0 disables that lockout)
+	EmailAttempts int
+	IPAttempts    int
+	// WindowMinutes is how long failures are remembered after the last one
+	WindowMinutes int
+	BaseSec       int
+	MaxMinutes    int
+}
+
+// FollowGuardConfig configures follow-bot protection. Follows by accounts
+// younger than NewAccountHours are limited per channel to PerIP from one
+// client IP and PerNetwork from one network within WindowMinutes (0
+// disables a limit). Networks are autonomous systems when ASNFile maps the
+// IP, else /24 or /48 prefixes. Every SweepMinutes, follows by new accounts
+// from one network that reached SweepThreshold within SweepLookbackHours
+// are removed and reported to admins (0 disables the sweep).
+type FollowGuardConfig struct {
+	NewAccountHours    int
+	WindowMinutes      int
+	PerIP              int
+	PerNetwork         int
+	ASNFile            string
+	SweepThreshold     int
+	SweepLookbackHours int
+	SweepMinutes       int
+}
+
+// LinkPreviewConfig configures link previews: WorkerCount workers fetch the
+// first link of new messages from a queue of QueueSize, giving up on a page
+// after TimeoutSec and reading at most MaxKiB of it
+type LinkPreviewConfig struct {
+	Enabled     bool
+	WorkerCount int
+	QueueSize   int
+	TimeoutSec  int
+	MaxKiB      int
+}
+
+// ChannelPointsConfig sets how viewers earn channel points: Amount points
+// for every IntervalMinutes of a live stream their player sent heartbeats
+// for (0 disables points)
+type ChannelPointsConfig struct {
+	Amount          int
+	IntervalMinutes int
+}
+
+// ChannelLimitConfig stops scripted accounts from squatting channel slugs:
+// a user may own at most MaxPerUser channels and create one every
+// CooldownMinutes (0 disables either). Platform admins are exempt.
+type ChannelLimitConfig struct {
+	MaxPerUser      int
+	CooldownMinutes int
+}
+
+// BotDetectionConfig configures the moderation bot's bot scores: chatters
+// are scored once they sent MinMessages recent messages, and muted for
+// MuteMinutes when their score reaches RestrictAt (0 only scores them)
+type BotDetectionConfig struct {
+	MinMessages int
+	RestrictAt  float64
+	MuteMinutes int
+}
+
+// TranslationConfig selects the provider behind message translation
+type TranslationConfig struct {
+	// Provider is "deepl", "google" or empty, which turns translation off
+	Provider   string
+	APIKey     string
+	TimeoutSec int
+}
+
+// AttachmentConfig limits the storage taken by files sent in conversations:
+// each may store QuotaMiB (0 for no quota), and attachments are removed
+// RetentionDays after upload (0 keeps them), checked every IntervalMinutes
+type AttachmentConfig struct {
+	QuotaMiB        int
+	RetentionDays   int
+	IntervalMinutes int
+}
+
+type AdminConfig struct {
+	UserIDs []string
+}
+
+type PurgeConfig struct {
+	SoftDeleteRetentionDays int
+	IntervalMinutes         int
+	// DeletedAccountMessages is what happens to the messages of a user who
+	// deletes their account: "anonymize" or "delete"
+	DeletedAccountMessages string
+	// RetentionIntervalMinutes is how often messages past their
+	// conversation's retention are removed, RetentionBatchSize at a time
+	RetentionIntervalMinutes int
+	RetentionBatchSize       int
+}
+
+type ArchiveConfig struct {
+	// AfterMonths moves messages older than this many months to messages_archive (0 disables)
+	AfterMonths     int
+	IntervalMinutes int
+	BatchSize       int
+}
+
+// JobsConfig tunes the recurring background jobs
+type JobsConfig struct {
+	// LeaderLockSec is how long the Redis leader lock lasts without renewal
+	LeaderLockSec int
+	// ModerationSweepSec is how often expired mutes and bans are lifted,
+	// bounding how late the unmute event can arrive
+	ModerationSweepSec int
+	// StreamStaleMinutes ends live streams not updated for this long
+	StreamStaleMinutes int
+	// TypingTTLSec clears typing indicators older than this
+	TypingTTLSec int
+	// AnalyticsRollupCron is a five-field cron schedule (UTC)
+	AnalyticsRollupCron string
+	// AuthEventRetentionDays deletes security log entries older than this
+	AuthEventRetentionDays int
+	// AnalyticsEventRetentionDays deletes raw client analytics events older
+	// than this
+	AnalyticsEventRetentionDays int
+	// FollowAlertsSec is how often aggregated follow alerts are sent
+	FollowAlertsSec int
+}
+
+// ExportConfig controls per-user data exports
+type ExportConfig struct {
+	// RetentionHours is how long a finished archive stays downloadable
+	RetentionHours int
+	// LinkTTLMinutes is how long each signed download link is valid
+	LinkTTLMinutes int
+}
+
+// OAuthConfig holds the OAuth client credentials for social login. A
+// provider is offered only when both its ID and secret are set.
+type OAuthConfig struct {
+	GoogleClientID     string
+	GoogleClientSecret string
+	GitHubClientID     string
+	GitHubClientSecret string
+}
+
+// OIDCConfig configures an external OpenID Connect issuer (enterprise SSO)
+// whose tokens are accepted alongside Tullo's own. SSO is off when Issuer is
+// empty.
+type OIDCConfig struct {
+	Issuer   string
+	Audience string
+	// JWKSURL overrides the key set discovered from the issuer
+	JWKSURL          string
+	JWKSCacheMinutes int
+	// TrustEmail treats emails as verified when tokens omit email_verified
+	TrustEmail bool
+}
+
+// MailConfig selects the mail provider and the URLs used in email links
+type MailConfig struct {
+	// Provider is "log" (development, prints emails) or "smtp"
+	Provider     string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// AppURL is the web app's public URL; APIURL is this server's public URL
+	AppURL string
+	APIURL string
+	// DigestIntervalMinutes is how often offline mention digests are sent (0 disables)
+	DigestIntervalMinutes int
+	QueueSize             int
+}
+
+// TLSConfig lets the server terminate TLS itself. Either CertFile/KeyFile or
+// AutocertHosts enables it; with neither the server speaks plain HTTP.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// AutocertHosts are the only hostnames Let's Encrypt certificates are
+	// requested for; certificates are cached in AutocertCacheDir
+	AutocertHosts    []string
+	AutocertCacheDir string
+	AutocertEmail    string
+	// HSTSMaxAgeSec is sent as Strict-Transport-Security on TLS responses (0 disables)
+	HSTSMaxAgeSec         int
+	HSTSIncludeSubdomains bool
+	// RedirectPort serves a plain HTTP listener that redirects to HTTPS (and
+	// answers ACME HTTP-01 challenges with autocert); empty disables it
+	RedirectPort string
+}
+
+// Enabled reports whether the server should serve HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || len(t.AutocertHosts) > 0
+}
+
+// SecretsConfig selects an external store for JWT_SECRET, DB_PASSWORD and
+// REDIS_PASSWORD. Values set explicitly in the environment or with -set
+// flags take precedence over the store.
+type SecretsConfig struct {
+	// Provider is file, vault or aws; empty disables the store
+	Provider    string
+	Dir         string
+	VaultAddr   string
+	VaultToken  string
+	VaultMount  string
+	VaultPath   string
+	AWSSecretID string
+	AWSRegion   string
+	// RefreshSec is how often the store is polled for rotated values (0 disables)
+	RefreshSec int
+	// Loaded holds the values taken from the store at startup, by secret
+	// name; only these are watched for rotation
+	Loaded map[string]string
+}
+
+// ProviderConfig converts the settings for secrets.NewProvider
+func (s SecretsConfig) ProviderConfig() secrets.Config {
+	return secrets.Config{
+		Provider: s.Provider,
+		Dir:      s.Dir,
+		Vault:    secrets.VaultConfig{Addr: s.VaultAddr, Token: s.VaultToken, Mount: s.VaultMount, Path: s.VaultPath},
+		AWS:      secrets.AWSConfig{SecretID: s.AWSSecretID, Region: s.AWSRegion},
+	}
+}
+
+// secretKeys maps secret names to the settings they provide
+var secretKeys = map[string]string{
+	secrets.JWTSecret:     "JWT_SECRET",
+	secrets.DBPassword:    "DB_PASSWORD",
+	secrets.RedisPassword: "REDIS_PASSWORD",
+}
+
+// GRPCConfig configures the internal gRPC API
+type GRPCConfig struct {
+	// Port to listen on; empty disables the gRPC server
+	Port string
+	// AuthToken is the bearer token internal callers must present
+	AuthToken string
+}
+
+// MetricsConfig configures the Prometheus endpoint
+type MetricsConfig struct {
+	// Token is the bearer token scrapers must present at /metrics; empty
+	// disables the endpoint
+	Token string
+}
+
+// Load loads configuration from environment variables, plus the file and
+// profile named by CONFIG_FILE and CONFIG_PROFILE when set
 func Load() (*Config, error) {
+	return LoadWithOptions(Options{})
+}
+
+// LoadWithOptions loads configuration from command-line overrides, the
+// environment, a config file and a profile, in that order of precedence, and
+// validates the result. Every invalid setting is reported, not just the first.
+func LoadWithOptions(opts Options) (*Config, error) {
 	// Load .env file if it exists (ignore error in production)
 	// Try current directory first, then parent directories
 	_ = godotenv.Load()
 	_ = godotenv.Load("../../.env")
 	_ = godotenv.Load("../.env")
 
-	redisDB, err := strconv.Atoi(getEnv("REDIS_DB", "0"))
-	if err != nil {
-		redisDB = 0
-	}
-
-	jwtExpiry, err := strconv.Atoi(getEnv("JWT_EXPIRY_HOURS", "168"))
+	src, err := newSource(opts)
 	if err != nil {
-		jwtExpiry = 168
+		return nil, err
 	}
 
-	rateLimit, err := strconv.Atoi(getEnv("RATE_LIMIT_MESSAGES_PER_SECOND", "10"))
+	secretsCfg, err := src.loadSecrets()
 	if err != nil {
-		rateLimit = 10
+		return nil, err
 	}
 
-	origins := strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000"), ",")
+	rateLimit := src.getInt("RATE_LIMIT_MESSAGES_PER_SECOND", 10)
 
 	cfg := &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
-			Env:  getEnv("ENV", "development"),
+			Port:             src.get("PORT", "8080"),
+			Env:              src.get("ENV", "development"),
+			TrustedProxies:   splitList(src.get("TRUSTED_PROXIES", "")),
+			MaxBodyBytes:     src.getInt64("MAX_REQUEST_BODY_BYTES", 1048576),
+			MaxJSONDepth:     src.getInt("MAX_JSON_DEPTH", 32),
+			ETagTTLSec:       src.getInt("ETAG_CACHE_TTL_SECONDS", 300),
+			CompressMinBytes: src.getInt("COMPRESSION_MIN_BYTES", 1024),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "thismaybejpegmafia"),
-			DBName:   getEnv("DB_NAME", "tullo_db"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Host:        src.get("DB_HOST", "localhost"),
+			Port:        src.get("DB_PORT", "5432"),
+			User:        src.get("DB_USER", "postgres"),
+			Password:    src.get("DB_PASSWORD", "thismaybejpegmafia"),
+			DBName:      src.get("DB_NAME", "tullo_db"),
+			SSLMode:     src.get("DB_SSLMODE", "disable"),
+			SlowQueryMs: src.getInt("DB_SLOW_QUERY_MS", 200),
+			Embedded:    src.getBool("DB_EMBEDDED", false),
+			EmbeddedDir: src.get("DB_EMBEDDED_DIR", ".tullo/postgres"),
 		},
 		Redis: RedisConfig{
-			Host:     getEnv("REDIS_HOST", "localhost"),
-			Port:     getEnv("REDIS_PORT", "6379"),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       redisDB,
+			Host:     src.get("REDIS_HOST", "localhost"),
+			Port:     src.get("REDIS_PORT", "6379"),
+			Password: src.get("REDIS_PASSWORD", ""),
+			DB:       src.getInt("REDIS_DB", 0),
 		},
 		JWT: JWTConfig{
-			Secret:      getEnv("JWT_SECRET", "change-this-secret-key"),
-			ExpiryHours: jwtExpiry,
+			Secret:             src.get("JWT_SECRET", "change-this-secret-key"),
+			ExpiryHours:        src.getInt("JWT_EXPIRY_HOURS", 168),
+			RefreshExpiryHours: src.getInt("JWT_REFRESH_EXPIRY_HOURS", 720),
+			GuestExpiryMinutes: src.getInt("JWT_GUEST_EXPIRY_MINUTES", 60),
 		},
 		API: APIConfig{
-			KeyHeader:               getEnv("API_KEY_HEADER", "X-API-Key"),
+			KeyHeader:               src.get("API_KEY_HEADER", "X-API-Key"),
 			RateLimitMessagesPerSec: rateLimit,
+			ChatViewersIntervalSec:  src.getInt("CHAT_VIEWERS_INTERVAL_SECONDS", 10),
+			WSFanoutWorkers:         src.getInt("WS_FANOUT_WORKERS", 8),
+			WSFanoutQueue:           src.getInt("WS_FANOUT_QUEUE", 256),
+			FollowAlertsAggregateAt: src.getInt("FOLLOW_ALERTS_AGGREGATE_AT", 1000),
+			WSQueryToken:            src.getBool("WS_QUERY_TOKEN", true),
+			WSResumeWindowSec:       src.getInt("WS_RESUME_WINDOW_SECONDS", 120),
 		},
 		CORS: CORSConfig{
-			AllowedOrigins: origins,
+			AllowedOrigins:   splitList(src.get("CORS_ALLOWED_ORIGINS", "http://localhost:3000")),
+			AllowedMethods:   splitList(src.get("CORS_ALLOWED_METHODS", "GET, POST, PUT, PATCH, DELETE, OPTIONS")),
+			AllowedHeaders:   splitList(src.get("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, Accept, X-API-Key, X-Requested-With, If-None-Match, Cache-Control")),
+			ExposedHeaders:   splitList(src.get("CORS_EXPOSED_HEADERS", "ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")),
+			AllowCredentials: src.getBool("CORS_ALLOW_CREDENTIALS", true),
+			MaxAgeSec:        src.getInt("CORS_MAX_AGE_SECONDS", 600),
+		},
+		Admin: AdminConfig{
+			UserIDs: splitList(src.get("ADMIN_USER_IDS", "")),
+		},
+		Purge: PurgeConfig{
+			SoftDeleteRetentionDays: src.getInt("SOFT_DELETE_RETENTION_DAYS", 30),
+			IntervalMinutes:         src.getInt("PURGE_INTERVAL_MINUTES", 60),
+			DeletedAccountMessages:  src.get("DELETED_ACCOUNT_MESSAGES", "anonymize"),
+			// Message retention set per conversation and channel chat
+			RetentionIntervalMinutes: src.getInt("MESSAGE_RETENTION_INTERVAL_MINUTES", 60),
+			RetentionBatchSize:       src.getInt("MESSAGE_RETENTION_BATCH_SIZE", 1000),
+		},
+		Archive: ArchiveConfig{
+			AfterMonths:     src.getInt("MESSAGE_ARCHIVE_AFTER_MONTHS", 0),
+			IntervalMinutes: src.getInt("MESSAGE_ARCHIVE_INTERVAL_MINUTES", 360),
+			BatchSize:       src.getInt("MESSAGE_ARCHIVE_BATCH_SIZE", 1000),
+		},
+		RateLimits: map[string]RateLimitPolicy{
+			// message_send defaults to the legacy RATE_LIMIT_MESSAGES_PER_SECOND
+			"message_send":   src.rateLimitPolicy("MESSAGE_SEND", float64(rateLimit), rateLimit*2),
+			"auth":           src.rateLimitPolicy("AUTH", 0.2, 5),
+			"channel_create": src.rateLimitPolicy("CHANNEL_CREATE", 0.01, 3),
+			"follow":         src.rateLimitPolicy("FOLLOW", 1, 10),
+			"analytics":      src.rateLimitPolicy("ANALYTICS", 1, 10),
+			"translate":      src.rateLimitPolicy("TRANSLATE", 0.2, 10),
+		},
+		SendLimits: map[string]RateLimitPolicy{
+			"direct": src.rateLimitPolicy("SEND_DIRECT", 2, 10),
+			"group":  src.rateLimitPolicy("SEND_GROUP", 1, 5),
+			// channel defaults to the legacy RATE_LIMIT_MESSAGES_PER_SECOND
+			"channel": src.rateLimitPolicy("SEND_CHANNEL", float64(rateLimit), 10),
+		},
+		IPLimit: IPLimitConfig{
+			Policies: map[string]RateLimitPolicy{
+				"auth":   src.rateLimitPolicy("IP_AUTH", 1, 10),
+				"ws":     src.rateLimitPolicy("IP_WS", 1, 10),
+				"health": src.rateLimitPolicy("IP_HEALTH", 10, 20),
+				"links":  src.rateLimitPolicy("IP_LINKS", 2, 20),
+			},
+			BlockAfter:     src.getInt("IP_BLOCK_AFTER_VIOLATIONS", 20),
+			BlockWindowSec: src.getInt("IP_BLOCK_WINDOW_SECONDS", 60),
+			BlockMinutes:   src.getInt("IP_BLOCK_MINUTES", 15),
+		},
+		WSFrames: src.rateLimitPolicy("WS_FRAMES", 1, 20),
+		Lockout: LoginLockoutConfig{
+			EmailAttempts: src.getInt("LOGIN_LOCKOUT_EMAIL_ATTEMPTS", 5),
+			IPAttempts:    src.getInt("LOGIN_LOCKOUT_IP_ATTEMPTS", 20),
+			WindowMinutes: src.getInt("LOGIN_LOCKOUT_WINDOW_MINUTES", 60),
+			BaseSec:       src.getInt("LOGIN_LOCKOUT_BASE_SECONDS", 30),
+			MaxMinutes:    src.getInt("LOGIN_LOCKOUT_MAX_MINUTES", 60),
+		},
+		FollowGuard: FollowGuardConfig{
+			NewAccountHours:    src.getInt("FOLLOW_GUARD_NEW_ACCOUNT_HOURS", 72),
+			WindowMinutes:      src.getInt("FOLLOW_GUARD_WINDOW_MINUTES", 60),
+			PerIP:              src.getInt("FOLLOW_GUARD_PER_IP", 3),
+			PerNetwork:         src.getInt("FOLLOW_GUARD_PER_NETWORK", 10),
+			ASNFile:            src.get("FOLLOW_GUARD_ASN_FILE", ""),
+			SweepThreshold:     src.getInt("FOLLOW_GUARD_SWEEP_THRESHOLD", 20),
+			SweepLookbackHours: src.getInt("FOLLOW_GUARD_SWEEP_LOOKBACK_HOURS", 24),
+			SweepMinutes:       src.getInt("FOLLOW_GUARD_SWEEP_MINUTES", 15),
+		},
+		LinkPreview: LinkPreviewConfig{
+			Enabled:     src.getBool("LINK_PREVIEWS_ENABLED", true),
+			WorkerCount: src.getInt("LINK_PREVIEW_WORKERS", 4),
+			QueueSize:   src.getInt("LINK_PREVIEW_QUEUE", 256),
+			TimeoutSec:  src.getInt("LINK_PREVIEW_TIMEOUT_SECONDS", 5),
+			MaxKiB:      src.getInt("LINK_PREVIEW_MAX_KIB", 512),
+		},
+		Points: ChannelPointsConfig{
+			Amount:          src.getInt("CHANNEL_POINTS_AMOUNT", 10),
+			IntervalMinutes: src.getInt("CHANNEL_POINTS_INTERVAL_MINUTES", 5),
+		},
+		Channels: ChannelLimitConfig{
+			MaxPerUser:      src.getInt("CHANNELS_PER_USER", 3),
+			CooldownMinutes: src.getInt("CHANNEL_CREATE_COOLDOWN_MINUTES", 10),
+		},
+		Bots: BotDetectionConfig{
+			MinMessages: src.getInt("BOT_DETECTION_MIN_MESSAGES", 5),
+			RestrictAt:  src.getFloat("BOT_DETECTION_RESTRICT_AT", 0),
+			MuteMinutes: src.getInt("BOT_DETECTION_MUTE_MINUTES", 10),
+		},
+		Translation: TranslationConfig{
+			Provider:   src.get("TRANSLATION_PROVIDER", ""),
+			APIKey:     src.get("TRANSLATION_API_KEY", ""),
+			TimeoutSec: src.getInt("TRANSLATION_TIMEOUT_SECONDS", 10),
 		},
+		Attachments: AttachmentConfig{
+			QuotaMiB:        src.getInt("ATTACHMENT_QUOTA_MIB", 1024),
+			RetentionDays:   src.getInt("ATTACHMENT_RETENTION_DAYS", 90),
+			IntervalMinutes: src.getInt("ATTACHMENT_EXPIRY_INTERVAL_MINUTES", 60),
+		},
+		Password: PasswordConfig{
+			Algorithm:         src.get("PASSWORD_HASH", "bcrypt"),
+			Argon2MemoryKiB:   src.getInt("ARGON2_MEMORY_KIB", 19456),
+			Argon2Iterations:  src.getInt("ARGON2_ITERATIONS", 2),
+			Argon2Parallelism: src.getInt("ARGON2_PARALLELISM", 1),
+		},
+		Mail: MailConfig{
+			Provider:              src.get("MAIL_PROVIDER", "log"),
+			From:                  src.get("MAIL_FROM", "Tullo <no-reply@tullo.local>"),
+			SMTPHost:              src.get("SMTP_HOST", ""),
+			SMTPPort:              src.getInt("SMTP_PORT", 587),
+			SMTPUsername:          src.get("SMTP_USERNAME", ""),
+			SMTPPassword:          src.get("SMTP_PASSWORD", ""),
+			AppURL:                strings.TrimRight(src.get("APP_BASE_URL", "http://localhost:3000"), "/"),
+			APIURL:                strings.TrimRight(src.get("API_BASE_URL", "http://localhost:8080"), "/"),
+			DigestIntervalMinutes: src.getInt("MENTION_DIGEST_INTERVAL_MINUTES", 60),
+			QueueSize:             src.getInt("MAIL_QUEUE_SIZE", 1000),
+		},
+		GRPC: GRPCConfig{
+			Port:      src.get("GRPC_PORT", ""),
+			AuthToken: src.get("GRPC_AUTH_TOKEN", ""),
+		},
+		Metrics: MetricsConfig{
+			Token: src.get("METRICS_TOKEN", ""),
+		},
+		TLS: TLSConfig{
+			CertFile:              src.get("TLS_CERT_FILE", ""),
+			KeyFile:               src.get("TLS_KEY_FILE", ""),
+			AutocertHosts:         splitList(src.get("TLS_AUTOCERT_HOSTS", "")),
+			AutocertCacheDir:      src.get("TLS_AUTOCERT_CACHE_DIR", "certs"),
+			AutocertEmail:         src.get("TLS_AUTOCERT_EMAIL", ""),
+			HSTSMaxAgeSec:         src.getInt("HSTS_MAX_AGE_SECONDS", 31536000),
+			HSTSIncludeSubdomains: src.getBool("HSTS_INCLUDE_SUBDOMAINS", false),
+			RedirectPort:          src.get("HTTP_REDIRECT_PORT", ""),
+		},
+		Secrets: secretsCfg,
+		Jobs: JobsConfig{
+			LeaderLockSec:               src.getInt("JOBS_LEADER_LOCK_SECONDS", 30),
+			ModerationSweepSec:          src.getInt("MODERATION_SWEEP_SECONDS", 15),
+			StreamStaleMinutes:          src.getInt("STREAM_STALE_MINUTES", 720),
+			TypingTTLSec:                src.getInt("TYPING_TTL_SECONDS", 10),
+			AnalyticsRollupCron:         src.get("ANALYTICS_ROLLUP_CRON", "5 * * * *"),
+			AuthEventRetentionDays:      src.getInt("AUTH_EVENT_RETENTION_DAYS", 90),
+			AnalyticsEventRetentionDays: src.getInt("ANALYTICS_EVENT_RETENTION_DAYS", 30),
+			FollowAlertsSec:             src.getInt("FOLLOW_ALERTS_INTERVAL_SECONDS", 10),
+		},
+		Export: ExportConfig{
+			RetentionHours: src.getInt("EXPORT_RETENTION_HOURS", 72),
+			LinkTTLMinutes: src.getInt("EXPORT_LINK_TTL_MINUTES", 15),
+		},
+		OAuth: OAuthConfig{
+			GoogleClientID:     src.get("OAUTH_GOOGLE_CLIENT_ID", ""),
+			GoogleClientSecret: src.get("OAUTH_GOOGLE_CLIENT_SECRET", ""),
+			GitHubClientID:     src.get("OAUTH_GITHUB_CLIENT_ID", ""),
+			GitHubClientSecret: src.get("OAUTH_GITHUB_CLIENT_SECRET", ""),
+		},
+		OIDC: OIDCConfig{
+			Issuer:           src.get("OIDC_ISSUER", ""),
+			Audience:         src.get("OIDC_AUDIENCE", ""),
+			JWKSURL:          src.get("OIDC_JWKS_URL", ""),
+			JWKSCacheMinutes: src.getInt("OIDC_JWKS_CACHE_MINUTES", 60),
+			TrustEmail:       src.getBool("OIDC_TRUST_EMAIL", false),
+		},
+	}
+
+	errs := append(src.errs, src.unknown()...)
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
 	}
+	return cfg, nil
+}
 
-	// Validate required fields
-	if cfg.JWT.Secret == "change-this-secret-key" && cfg.Server.Env == "production" {
-		return nil, fmt.Errorf("JWT_SECRET must be set in production")
+// loadSecrets reads the SECRETS_* settings and, when a provider is
+// configured, fetches the secrets it holds into the source
+func (s *source) loadSecrets() (SecretsConfig, error) {
+	cfg := SecretsConfig{
+		Provider:    s.get("SECRETS_PROVIDER", ""),
+		Dir:         s.get("SECRETS_DIR", "/run/secrets"),
+		VaultAddr:   s.get("VAULT_ADDR", ""),
+		VaultToken:  s.get("VAULT_TOKEN", ""),
+		VaultMount:  s.get("VAULT_MOUNT", "secret"),
+		VaultPath:   s.get("VAULT_SECRET_PATH", ""),
+		AWSSecretID: s.get("SECRETS_AWS_SECRET_ID", ""),
+		AWSRegion:   s.get("SECRETS_AWS_REGION", ""),
+		RefreshSec:  s.getInt("SECRETS_REFRESH_SECONDS", 300),
+		Loaded:      map[string]string{},
 	}
 
+	provider, err := secrets.NewProvider(cfg.ProviderConfig())
+	if err != nil || provider == nil {
+		return cfg, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	values, err := secrets.Load(ctx, provider, secrets.Names)
+	if err != nil {
+		return cfg, err
+	}
+	for name, v := range values {
+		key := secretKeys[name]
+		if s.explicit(key) {
+			continue
+		}
+		s.secrets[key] = v
+		cfg.Loaded[name] = v
+	}
 	return cfg, nil
 }
 
+// rateLimitPolicy reads RATE_LIMIT_<NAME>_RPS and RATE_LIMIT_<NAME>_BURST
+func (s *source) rateLimitPolicy(name string, defRate float64, defBurst int) RateLimitPolicy {
+	return RateLimitPolicy{
+		RatePerSec: s.getFloat("RATE_LIMIT_"+name+"_RPS", defRate),
+		Burst:      s.getInt("RATE_LIMIT_"+name+"_BURST", defBurst),
+	}
+}
+
 // GetDSN returns the database connection string
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf(
@@ -131,14 +716,31 @@ func (c *Config) GetDSN() string {
 	)
 }
 
+// GetEmbeddedDB returns the settings for the embedded Postgres server used
+// when Database.Embedded is set; they match the DSN so the pool connects to it
+func (c *Config) GetEmbeddedDB() database.EmbeddedOptions {
+	port, _ := strconv.ParseUint(c.Database.Port, 10, 32)
+	return database.EmbeddedOptions{
+		Dir:      c.Database.EmbeddedDir,
+		Port:     uint32(port),
+		User:     c.Database.User,
+		Password: c.Database.Password,
+		Database: c.Database.DBName,
+	}
+}
+
 // GetRedisAddr returns the Redis address
 func (c *Config) GetRedisAddr() string {
 	return fmt.Sprintf("%s:%s", c.Redis.Host, c.Redis.Port)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// splitList splits a comma-separated value, dropping blanks
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
 	}
-	return defaultValue
+	return out
 }
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSourcePrecedence(t *testing.T) {
+	path := writeFile(t, "tullo.yaml", `
+port: 9000
+db:
+  host: db.internal
+  name: from-file
+cors:
+  allowed_origins: [https://a.example.com, https://b.example.com]
+profiles:
+  staging:
+    db:
+      name: from-profile
+`)
+	t.Setenv("DB_HOST", "db.env")
+	t.Setenv("DB_NAME", "")
+
+	src, err := newSource(Options{File: path, Profile: "staging", Overrides: map[string]string{"port": "9090"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"PORT":                 "9090",                                        // flag beats file
+		"DB_HOST":              "db.env",                                      // env beats file
+		"DB_NAME":              "from-profile",                                // file profile beats file base
+		"DB_SSLMODE":           "require",                                     // built-in staging profile
+		"ENV":                  "staging",                                     // built-in staging profile
+		"CORS_ALLOWED_ORIGINS": "https://a.example.com,https://b.example.com", // lists are joined
+		"REDIS_HOST":           "fallback",                                    // unset everywhere
+	}
+	for key, want := range tests {
+		if got := src.get(key, "fallback"); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if errs := src.unknown(); len(errs) != 0 {
+		t.Errorf("unexpected unknown keys: %v", errs)
+	}
+}
+
+func TestSourceTOMLAndUnknownKeys(t *testing.T) {
+	path := writeFile(t, "tullo.toml", `
+port = 8081
+prot = 1
+
+[rate_limit.auth]
+rps = 0.5
+`)
+	src, err := newSource(Options{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.get("PORT", ""); got != "8081" {
+		t.Errorf("PORT = %q", got)
+	}
+	if got := src.getFloat("RATE_LIMIT_AUTH_RPS", 1); got != 0.5 {
+		t.Errorf("RATE_LIMIT_AUTH_RPS = %v", got)
+	}
+	errs := src.unknown()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "PROT") {
+		t.Errorf("unknown() = %v, want PROT reported", errs)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	if _, err := newSource(Options{Profile: "qa"}); err == nil {
+		t.Error("unknown profile should fail")
+	}
+	if _, err := newSource(Options{File: writeFile(t, "tullo.json", "{}")}); err == nil {
+		t.Error("unsupported file type should fail")
+	}
+
+	src, err := newSource(Options{Overrides: map[string]string{"JWT_EXPIRY_HOURS": "a week"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.getInt("JWT_EXPIRY_HOURS", 168); got != 168 || len(src.errs) != 1 {
+		t.Errorf("getInt = %d with %d errors, want default and one error", got, len(src.errs))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		src, err := newSource(Options{Overrides: map[string]string{
+			"ENV": "development", "DB_HOST": "localhost", "DB_PORT": "5432", "DB_NAME": "tullo",
+			"DB_USER": "postgres", "DB_PASSWORD": "secret", "DB_SSLMODE": "disable",
+			"CORS_ALLOWED_ORIGINS": "http://localhost:3000,*.tullo.tv", "MAIL_PROVIDER": "log",
+			"APP_BASE_URL": "http://localhost:3000", "API_BASE_URL": "http://localhost:8080",
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := &Config{
+			Server:      ServerConfig{Port: "8080", Env: src.get("ENV", ""), MaxBodyBytes: 1, MaxJSONDepth: 1, ETagTTLSec: 1},
+			Database:    DatabaseConfig{Host: src.get("DB_HOST", ""), Port: src.get("DB_PORT", ""), User: src.get("DB_USER", ""), Password: src.get("DB_PASSWORD", ""), DBName: src.get("DB_NAME", ""), SSLMode: src.get("DB_SSLMODE", "")},
+			Redis:       RedisConfig{Host: "localhost", Port: "6379"},
+			JWT:         JWTConfig{Secret: "change-this-secret-key", ExpiryHours: 1, RefreshExpiryHours: 720},
+			API:         APIConfig{RateLimitMessagesPerSec: 10, WSFanoutWorkers: 8, WSFanoutQueue: 256},
+			CORS:        CORSConfig{AllowedOrigins: splitList(src.get("CORS_ALLOWED_ORIGINS", "")), AllowCredentials: true},
+			Purge:       PurgeConfig{IntervalMinutes: 60, DeletedAccountMessages: "anonymize", RetentionIntervalMinutes: 60, RetentionBatchSize: 10},
+			Archive:     ArchiveConfig{IntervalMinutes: 60, BatchSize: 10},
+			RateLimits:  map[string]RateLimitPolicy{"auth": {RatePerSec: 0.2, Burst: 5}},
+			SendLimits:  map[string]RateLimitPolicy{"group": {RatePerSec: 1, Burst: 5}},
+			IPLimit:     IPLimitConfig{BlockWindowSec: 60, BlockMinutes: 15},
+			WSFrames:    RateLimitPolicy{RatePerSec: 1, Burst: 20},
+			Lockout:     LoginLockoutConfig{EmailAttempts: 5, WindowMinutes: 60, BaseSec: 30, MaxMinutes: 60},
+			FollowGuard: FollowGuardConfig{NewAccountHours: 72, WindowMinutes: 60, PerIP: 3, PerNetwork: 10, SweepThreshold: 20, SweepLookbackHours: 24, SweepMinutes: 15},
+			LinkPreview: LinkPreviewConfig{Enabled: true, WorkerCount: 4, QueueSize: 256, TimeoutSec: 5, MaxKiB: 512},
+			Points:      ChannelPointsConfig{Amount: 10, IntervalMinutes: 5},
+			Channels:    ChannelLimitConfig{MaxPerUser: 3, CooldownMinutes: 10},
+			Bots:        BotDetectionConfig{MinMessages: 5, MuteMinutes: 10},
+			Translation: TranslationConfig{TimeoutSec: 10},
+			Attachments: AttachmentConfig{QuotaMiB: 1024, RetentionDays: 90, IntervalMinutes: 60},
+			Password:    PasswordConfig{Algorithm: "bcrypt", Argon2MemoryKiB: 19456, Argon2Iterations: 2, Argon2Parallelism: 1},
+			Mail:        MailConfig{Provider: src.get("MAIL_PROVIDER", ""), SMTPPort: 587, QueueSize: 1, AppURL: src.get("APP_BASE_URL", ""), APIURL: src.get("API_BASE_URL", "")},
+			Export:      ExportConfig{RetentionHours: 72, LinkTTLMinutes: 15},
+			Jobs:        JobsConfig{LeaderLockSec: 30, ModerationSweepSec: 15, StreamStaleMinutes: 60, TypingTTLSec: 10, AnalyticsRollupCron: "5 * * * *", AuthEventRetentionDays: 90, AnalyticsEventRetentionDays: 30, FollowAlertsSec: 10},
+		}
+		return cfg
+	}
+
+	if errs := valid().validate(); len(errs) != 0 {
+		t.Fatalf("valid config rejected: %v", errs)
+	}
+
+	tests := map[string]func(c *Config){
+		"bad port":                           func(c *Config) { c.Server.Port = "http" },
+		"bad sslmode":                        func(c *Config) { c.Database.SSLMode = "on" },
+		"space in db name":                   func(c *Config) { c.Database.DBName = "tullo db" },
+		"empty origins":                      func(c *Config) { c.CORS.AllowedOrigins = nil },
+		"origin with path":                   func(c *Config) { c.CORS.AllowedOrigins = []string{"https://tullo.tv/app"} },
+		"wildcard credentials":               func(c *Config) { c.CORS.AllowedOrigins = []string{"*"} },
+		"zero rate":                          func(c *Config) { c.RateLimits["auth"] = RateLimitPolicy{RatePerSec: 0, Burst: 5} },
+		"zero burst":                         func(c *Config) { c.RateLimits["auth"] = RateLimitPolicy{RatePerSec: 1, Burst: 0} },
+		"zero send burst":                    func(c *Config) { c.SendLimits["group"] = RateLimitPolicy{RatePerSec: 1, Burst: 0} },
+		"zero ws frame rate":                 func(c *Config) { c.WSFrames.RatePerSec = 0 },
+		"prod default secret":                func(c *Config) { c.Server.Env = "production" },
+		"smtp without host":                  func(c *Config) { c.Mail.Provider = "smtp" },
+		"half tls pair":                      func(c *Config) { c.TLS.CertFile = "cert.pem" },
+		"bad admin id":                       func(c *Config) { c.Admin.UserIDs = []string{"root"} },
+		"bad message deletion":               func(c *Config) { c.Purge.DeletedAccountMessages = "keep" },
+		"lockout max below base":             func(c *Config) { c.Lockout.MaxMinutes = 0 },
+		"oidc without audience":              func(c *Config) { c.OIDC = OIDCConfig{Issuer: "https://sso.corp.example", JWKSCacheMinutes: 60} },
+		"unknown password hash":              func(c *Config) { c.Password.Algorithm = "md5" },
+		"no auth event retention":            func(c *Config) { c.Jobs.AuthEventRetentionDays = 0 },
+		"no analytics event retention":       func(c *Config) { c.Jobs.AnalyticsEventRetentionDays = 0 },
+		"no follow alerts interval":          func(c *Config) { c.Jobs.FollowAlertsSec = 0 },
+		"negative follow alerts aggregation": func(c *Config) { c.API.FollowAlertsAggregateAt = -1 },
+		"negative guest expiry":              func(c *Config) { c.JWT.GuestExpiryMinutes = -1 },
+		"no fanout workers":                  func(c *Config) { c.API.WSFanoutWorkers = 0 },
+		"no follow guard window":             func(c *Config) { c.FollowGuard.WindowMinutes = 0 },
+		"no link preview workers":            func(c *Config) { c.LinkPreview.WorkerCount = 0 },
+		"no channel points interval":         func(c *Config) { c.Points.IntervalMinutes = 0 },
+		"negative channels per user":         func(c *Config) { c.Channels.MaxPerUser = -1 },
+		"bot restriction above one":          func(c *Config) { c.Bots.RestrictAt = 1.5 },
+		"no retention batch size":            func(c *Config) { c.Purge.RetentionBatchSize = 0 },
+		"negative attachment quota":          func(c *Config) { c.Attachments.QuotaMiB = -1 },
+		"translation without api key":        func(c *Config) { c.Translation.Provider = "deepl" },
+	}
+	for name, mutate := range tests {
+		cfg := valid()
+		mutate(cfg)
+		if errs := cfg.validate(); len(errs) == 0 {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
+
+func TestLoadSecretsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, v := range map[string]string{"jwt_secret": "file-jwt", "db_password": "file-db"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(v+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("DB_PASSWORD", "env-db")
+
+	src, err := newSource(Options{Overrides: map[string]string{"SECRETS_PROVIDER": "file", "SECRETS_DIR": dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := src.loadSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := src.get("JWT_SECRET", ""); got != "file-jwt" {
+		t.Errorf("JWT_SECRET = %q, want the secret file", got)
+	}
+	if got := src.get("DB_PASSWORD", ""); got != "env-db" {
+		t.Errorf("DB_PASSWORD = %q, want the explicit env value", got)
+	}
+	if _, ok := cfg.Loaded["db_password"]; ok || cfg.Loaded["jwt_secret"] != "file-jwt" {
+		t.Errorf("Loaded = %v, want only jwt_secret", cfg.Loaded)
+	}
+}
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Options selects where configuration is read from in addition to the
+// environment. Empty fields fall back to CONFIG_FILE and CONFIG_PROFILE.
+type Options struct {
+	// File is a .yaml, .yml or .toml file
+	File string
+	// Profile names a built-in profile (dev, staging, prod) or an entry of
+	// the file's profiles section
+	Profile string
+	// Overrides are KEY=value settings from the command line; they take
+	// precedence over everything else
+	Overrides map[string]string
+}
+
+// BindFlags registers -config, -profile and the repeatable -set KEY=value on
+// fs. The returned Options are filled in when fs is parsed.
+func BindFlags(fs *flag.FlagSet) *Options {
+	opts := &Options{Overrides: map[string]string{}}
+	fs.StringVar(&opts.File, "config", "", "configuration file (.yaml, .yml or .toml)")
+	fs.StringVar(&opts.Profile, "profile", "", "configuration profile (dev, staging, prod or one defined in the file)")
+	fs.Func("set", "override a setting, e.g. -set PORT=9090 (repeatable)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("expected KEY=value")
+		}
+		opts.Overrides[normalizeKey(key)] = value
+		return nil
+	})
+	return opts
+}
+
+// profiles are the built-in defaults for each named profile
+var profiles = map[string]map[string]string{
+	"dev": {
+		"ENV": "development",
+	},
+	"staging": {
+		"ENV":        "staging",
+		"DB_SSLMODE": "require",
+	},
+	"prod": {
+		"ENV":        "production",
+		"DB_SSLMODE": "require",
+	},
+}
+
+// source resolves settings by key. Highest precedence first: command-line
+// overrides, environment variables, the secrets store, the selected profile
+// section of the config file, the rest of the config file, built-in profile
+// defaults and finally the default passed by the caller. Malformed values
+// are collected in errs rather than silently replaced by the default.
+type source struct {
+	overrides map[string]string
+	secrets   map[string]string
+	file      map[string]string
+	profile   map[string]string
+	fileName  string
+	seen      map[string]bool
+	errs      []error
+}
+
+func newSource(opts Options) (*source, error) {
+	s := &source{
+		overrides: map[string]string{},
+		secrets:   map[string]string{},
+		file:      map[string]string{},
+		profile:   map[string]string{},
+		seen:      map[string]bool{},
+	}
+	for k, v := range opts.Overrides {
+		s.overrides[normalizeKey(k)] = v
+	}
+
+	file := opts.File
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	name := opts.Profile
+	if name == "" {
+		name = os.Getenv("CONFIG_PROFILE")
+	}
+
+	var fileProfiles map[string]map[string]string
+	if file != "" {
+		base, named, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		s.file, fileProfiles, s.fileName = base, named, file
+	}
+
+	if name != "" {
+		builtin, isBuiltin := profiles[name]
+		section, inFile := fileProfiles[name]
+		if !isBuiltin && !inFile {
+			return nil, fmt.Errorf("unknown config profile %q", name)
+		}
+		for k, v := range builtin {
+			s.profile[k] = v
+		}
+		for k, v := range section {
+			s.file[k] = v
+		}
+	}
+	return s, nil
+}
+
+func (s *source) lookup(key string) (string, bool) {
+	s.seen[key] = true
+	if v, ok := s.overrides[key]; ok {
+		return v, true
+	}
+	if v := os.Getenv(key); v != "" {
+		return v, true
+	}
+	if v, ok := s.secrets[key]; ok {
+		return v, true
+	}
+	if v, ok := s.file[key]; ok {
+		return v, true
+	}
+	v, ok := s.profile[key]
+	return v, ok
+}
+
+// explicit reports whether key is set by a flag or environment variable
+func (s *source) explicit(key string) bool {
+	_, ok := s.overrides[key]
+	return ok || os.Getenv(key) != ""
+}
+
+func (s *source) get(key, def string) string {
+	if v, ok := s.lookup(key); ok {
+		return v
+	}
+	return def
+}
+
+func (s *source) getInt(key string, def int) int {
+	v, ok := s.lookup(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %q is not an integer", key, v))
+		return def
+	}
+	return n
+}
+
+func (s *source) getInt64(key string, def int64) int64 {
+	v, ok := s.lookup(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %q is not an integer", key, v))
+		return def
+	}
+	return n
+}
+
+func (s *source) getFloat(key string, def float64) float64 {
+	v, ok := s.lookup(key)
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %q is not a number", key, v))
+		return def
+	}
+	return f
+}
+
+func (s *source) getBool(key string, def bool) bool {
+	v, ok := s.lookup(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+		return def
+	}
+	return b
+}
+
+// unknown reports file and command-line keys that no setting read, which
+// are almost always typos
+func (s *source) unknown() []error {
+	var errs []error
+	report := func(keys map[string]string, where string) {
+		names := make([]string, 0, len(keys))
+		for k := range keys {
+			if !s.seen[k] {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			errs = append(errs, fmt.Errorf("unknown setting %s in %s", k, where))
+		}
+	}
+	report(s.file, s.fileName)
+	report(s.overrides, "-set flags")
+	return errs
+}
+
+// readFile parses a YAML or TOML config file. Keys are the environment
+// variable names, case-insensitive; nested tables are joined with
+// underscores, so {db: {host: x}} sets DB_HOST, and lists become
+// comma-separated values. A top-level "profiles" table holds named sections
+// applied on top of the file when that profile is selected.
+func readFile(path string) (map[string]string, map[string]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, nil, fmt.Errorf("unsupported config file type %q (want .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	named := map[string]map[string]string{}
+	for k, v := range raw {
+		if strings.ToLower(k) != "profiles" {
+			continue
+		}
+		delete(raw, k)
+		sections, ok := v.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("config file %s: profiles must be a table", path)
+		}
+		for name, section := range sections {
+			table, ok := section.(map[string]any)
+			if !ok {
+				return nil, nil, fmt.Errorf("config file %s: profile %q must be a table", path, name)
+			}
+			named[name] = map[string]string{}
+			flatten("", table, named[name])
+		}
+	}
+
+	base := map[string]string{}
+	flatten("", raw, base)
+	return base, named, nil
+}
+
+func flatten(prefix string, in map[string]any, out map[string]string) {
+	for k, v := range in {
+		key := normalizeKey(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(key, v, out)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func normalizeKey(k string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(k), "-", "_"))
+}
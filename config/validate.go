@@ -0,0 +1,231 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tullo/backend/internal/database"
+)
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+var envs = map[string]bool{"development": true, "staging": true, "production": true, "test": true}
+
+// validate checks the loaded settings for values the server could not run
+// with, returning one error per problem
+func (c *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	port := func(key, v string, optional bool) {
+		if v == "" && optional {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		check(err == nil && n > 0 && n <= 65535, "%s: %q is not a valid port", key, v)
+	}
+
+	check(envs[c.Server.Env], "ENV: %q must be development, staging, production or test", c.Server.Env)
+	port("PORT", c.Server.Port, false)
+	check(c.Server.MaxBodyBytes > 0, "MAX_REQUEST_BODY_BYTES must be positive")
+	check(c.Server.MaxJSONDepth > 0, "MAX_JSON_DEPTH must be positive")
+	check(c.Server.ETagTTLSec > 0, "ETAG_CACHE_TTL_SECONDS must be positive")
+	check(c.Server.CompressMinBytes >= 0, "COMPRESSION_MIN_BYTES cannot be negative")
+
+	check(c.Database.Host != "", "DB_HOST is required")
+	check(c.Database.User != "", "DB_USER is required")
+	check(c.Database.DBName != "", "DB_NAME is required")
+	port("DB_PORT", c.Database.Port, false)
+	check(sslModes[c.Database.SSLMode], "DB_SSLMODE: %q is not a valid sslmode", c.Database.SSLMode)
+	check(c.Database.SlowQueryMs >= 0, "DB_SLOW_QUERY_MS cannot be negative")
+	if c.Database.Embedded {
+		check(database.EmbeddedAvailable, "DB_EMBEDDED needs a binary built with -tags embedpg")
+		check(c.Server.Env != "production", "DB_EMBEDDED cannot be used in production")
+		check(c.Database.Host == "localhost" || c.Database.Host == "127.0.0.1", "DB_EMBEDDED requires DB_HOST to be localhost")
+		check(c.Database.SSLMode == "disable" || c.Database.SSLMode == "prefer", "DB_EMBEDDED requires DB_SSLMODE disable or prefer")
+		check(c.Database.EmbeddedDir != "", "DB_EMBEDDED_DIR is required when DB_EMBEDDED is true")
+	}
+	// GetDSN does not quote values, so a space or quote silently shifts the
+	// remaining settings; parse it back and compare. The parse error itself
+	// is not reported because it would include the password.
+	if pc, err := pgconn.ParseConfig(c.GetDSN()); err != nil || pc.Host != c.Database.Host ||
+		pc.User != c.Database.User || pc.Database != c.Database.DBName ||
+		(c.Database.Password != "" && pc.Password != c.Database.Password) {
+		errs = append(errs, fmt.Errorf("database settings do not form a valid DSN (check for spaces or quotes in DB_* values)"))
+	}
+
+	check(c.Redis.Host != "", "REDIS_HOST is required")
+	port("REDIS_PORT", c.Redis.Port, false)
+	check(c.Redis.DB >= 0, "REDIS_DB cannot be negative")
+
+	if c.JWT.Secret == "change-this-secret-key" && c.Server.Env == "production" {
+		errs = append(errs, fmt.Errorf("JWT_SECRET must be set in production"))
+	}
+	check(c.JWT.ExpiryHours > 0, "JWT_EXPIRY_HOURS must be positive")
+	check(c.JWT.RefreshExpiryHours > c.JWT.ExpiryHours, "JWT_REFRESH_EXPIRY_HOURS must be longer than JWT_EXPIRY_HOURS")
+	check(c.JWT.GuestExpiryMinutes >= 0, "JWT_GUEST_EXPIRY_MINUTES cannot be negative")
+	check(c.API.RateLimitMessagesPerSec > 0, "RATE_LIMIT_MESSAGES_PER_SECOND must be positive")
+	check(c.API.ChatViewersIntervalSec >= 0, "CHAT_VIEWERS_INTERVAL_SECONDS cannot be negative")
+	check(c.API.WSFanoutWorkers > 0, "WS_FANOUT_WORKERS must be positive")
+	check(c.API.WSFanoutQueue > 0, "WS_FANOUT_QUEUE must be positive")
+	check(c.API.FollowAlertsAggregateAt >= 0, "FOLLOW_ALERTS_AGGREGATE_AT cannot be negative")
+	check(c.API.WSResumeWindowSec >= 0, "WS_RESUME_WINDOW_SECONDS cannot be negative")
+
+	check(len(c.CORS.AllowedOrigins) > 0, "CORS_ALLOWED_ORIGINS cannot be empty")
+	for _, o := range c.CORS.AllowedOrigins {
+		check(validOrigin(o), "CORS_ALLOWED_ORIGINS: %q is not an origin, * or *.domain pattern", o)
+		if o == "*" && c.CORS.AllowCredentials {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS cannot contain * when CORS_ALLOW_CREDENTIALS is true"))
+		}
+	}
+	check(c.CORS.MaxAgeSec >= 0, "CORS_MAX_AGE_SECONDS cannot be negative")
+
+	for _, id := range c.Admin.UserIDs {
+		_, err := uuid.Parse(id)
+		check(err == nil, "ADMIN_USER_IDS: %q is not a UUID", id)
+	}
+
+	check(c.Purge.SoftDeleteRetentionDays >= 0, "SOFT_DELETE_RETENTION_DAYS cannot be negative")
+	check(c.Purge.IntervalMinutes > 0, "PURGE_INTERVAL_MINUTES must be positive")
+	check(c.Purge.DeletedAccountMessages == "anonymize" || c.Purge.DeletedAccountMessages == "delete", "DELETED_ACCOUNT_MESSAGES: %q must be anonymize or delete", c.Purge.DeletedAccountMessages)
+	check(c.Purge.RetentionIntervalMinutes > 0, "MESSAGE_RETENTION_INTERVAL_MINUTES must be positive")
+	check(c.Purge.RetentionBatchSize > 0, "MESSAGE_RETENTION_BATCH_SIZE must be positive")
+	check(c.Archive.AfterMonths >= 0, "MESSAGE_ARCHIVE_AFTER_MONTHS cannot be negative")
+	check(c.Archive.IntervalMinutes > 0, "MESSAGE_ARCHIVE_INTERVAL_MINUTES must be positive")
+	check(c.Archive.BatchSize > 0, "MESSAGE_ARCHIVE_BATCH_SIZE must be positive")
+	check(c.Jobs.LeaderLockSec >= 3, "JOBS_LEADER_LOCK_SECONDS must be at least 3")
+	check(c.Jobs.ModerationSweepSec > 0, "MODERATION_SWEEP_SECONDS must be positive")
+	check(c.Jobs.StreamStaleMinutes > 0, "STREAM_STALE_MINUTES must be positive")
+	check(c.Jobs.TypingTTLSec > 0, "TYPING_TTL_SECONDS must be positive")
+	check(c.Jobs.AuthEventRetentionDays > 0, "AUTH_EVENT_RETENTION_DAYS must be positive")
+	check(c.Jobs.AnalyticsEventRetentionDays > 0, "ANALYTICS_EVENT_RETENTION_DAYS must be positive")
+	check(c.Jobs.FollowAlertsSec > 0, "FOLLOW_ALERTS_INTERVAL_SECONDS must be positive")
+	check(c.Export.RetentionHours > 0, "EXPORT_RETENTION_HOURS must be positive")
+	check(c.Export.LinkTTLMinutes > 0, "EXPORT_LINK_TTL_MINUTES must be positive")
+	check(len(strings.Fields(c.Jobs.AnalyticsRollupCron)) == 5, "ANALYTICS_ROLLUP_CRON: %q must have five fields", c.Jobs.AnalyticsRollupCron)
+
+	errs = append(errs, validatePolicies("RATE_LIMIT_", c.RateLimits)...)
+	errs = append(errs, validatePolicies("RATE_LIMIT_SEND_", c.SendLimits)...)
+	errs = append(errs, validatePolicies("RATE_LIMIT_IP_", c.IPLimit.Policies)...)
+	errs = append(errs, validatePolicies("RATE_LIMIT_", map[string]RateLimitPolicy{"ws_frames": c.WSFrames})...)
+	check(c.IPLimit.BlockAfter >= 0, "IP_BLOCK_AFTER_VIOLATIONS cannot be negative")
+	check(c.IPLimit.BlockWindowSec > 0, "IP_BLOCK_WINDOW_SECONDS must be positive")
+	check(c.IPLimit.BlockMinutes > 0, "IP_BLOCK_MINUTES must be positive")
+	check(c.Lockout.EmailAttempts >= 0, "LOGIN_LOCKOUT_EMAIL_ATTEMPTS cannot be negative")
+	check(c.Lockout.IPAttempts >= 0, "LOGIN_LOCKOUT_IP_ATTEMPTS cannot be negative")
+	check(c.Lockout.WindowMinutes > 0, "LOGIN_LOCKOUT_WINDOW_MINUTES must be positive")
+	check(c.Lockout.BaseSec > 0, "LOGIN_LOCKOUT_BASE_SECONDS must be positive")
+	check(c.Lockout.MaxMinutes*60 >= c.Lockout.BaseSec, "LOGIN_LOCKOUT_MAX_MINUTES cannot be shorter than LOGIN_LOCKOUT_BASE_SECONDS")
+	check(c.FollowGuard.NewAccountHours >= 0, "FOLLOW_GUARD_NEW_ACCOUNT_HOURS cannot be negative")
+	check(c.FollowGuard.WindowMinutes > 0, "FOLLOW_GUARD_WINDOW_MINUTES must be positive")
+	check(c.FollowGuard.PerIP >= 0, "FOLLOW_GUARD_PER_IP cannot be negative")
+	check(c.FollowGuard.PerNetwork >= 0, "FOLLOW_GUARD_PER_NETWORK cannot be negative")
+	check(c.FollowGuard.SweepThreshold >= 0, "FOLLOW_GUARD_SWEEP_THRESHOLD cannot be negative")
+	check(c.FollowGuard.SweepLookbackHours > 0, "FOLLOW_GUARD_SWEEP_LOOKBACK_HOURS must be positive")
+	check(c.FollowGuard.SweepMinutes > 0, "FOLLOW_GUARD_SWEEP_MINUTES must be positive")
+	if c.LinkPreview.Enabled {
+		check(c.LinkPreview.WorkerCount > 0, "LINK_PREVIEW_WORKERS must be positive")
+		check(c.LinkPreview.QueueSize > 0, "LINK_PREVIEW_QUEUE must be positive")
+		check(c.LinkPreview.TimeoutSec > 0, "LINK_PREVIEW_TIMEOUT_SECONDS must be positive")
+		check(c.LinkPreview.MaxKiB > 0, "LINK_PREVIEW_MAX_KIB must be positive")
+	}
+	check(c.Points.Amount >= 0, "CHANNEL_POINTS_AMOUNT cannot be negative")
+	check(c.Points.IntervalMinutes > 0, "CHANNEL_POINTS_INTERVAL_MINUTES must be positive")
+	check(c.Channels.MaxPerUser >= 0, "CHANNELS_PER_USER cannot be negative")
+	check(c.Channels.CooldownMinutes >= 0, "CHANNEL_CREATE_COOLDOWN_MINUTES cannot be negative")
+	check(c.Bots.MinMessages >= 2, "BOT_DETECTION_MIN_MESSAGES must be at least 2")
+	check(c.Bots.RestrictAt >= 0 && c.Bots.RestrictAt <= 1, "BOT_DETECTION_RESTRICT_AT must be between 0 and 1")
+	check(c.Bots.MuteMinutes > 0, "BOT_DETECTION_MUTE_MINUTES must be positive")
+	check(c.Translation.Provider == "" || c.Translation.Provider == "deepl" || c.Translation.Provider == "google", "TRANSLATION_PROVIDER: %q must be deepl or google", c.Translation.Provider)
+	check(c.Translation.Provider == "" || c.Translation.APIKey != "", "TRANSLATION_API_KEY is required when TRANSLATION_PROVIDER is set")
+	check(c.Translation.TimeoutSec > 0, "TRANSLATION_TIMEOUT_SECONDS must be positive")
+	check(c.Attachments.QuotaMiB >= 0, "ATTACHMENT_QUOTA_MIB cannot be negative")
+	check(c.Attachments.RetentionDays >= 0, "ATTACHMENT_RETENTION_DAYS cannot be negative")
+	check(c.Attachments.IntervalMinutes > 0, "ATTACHMENT_EXPIRY_INTERVAL_MINUTES must be positive")
+	check(c.Password.Algorithm == "bcrypt" || c.Password.Algorithm == "argon2id", "PASSWORD_HASH: %q must be bcrypt or argon2id", c.Password.Algorithm)
+	check(c.Password.Argon2Parallelism >= 1 && c.Password.Argon2Parallelism <= 255, "ARGON2_PARALLELISM must be between 1 and 255")
+	check(c.Password.Argon2Iterations >= 1, "ARGON2_ITERATIONS must be positive")
+	check(c.Password.Argon2MemoryKiB >= 8*c.Password.Argon2Parallelism, "ARGON2_MEMORY_KIB must be at least 8 times ARGON2_PARALLELISM")
+
+	check(c.Mail.Provider == "log" || c.Mail.Provider == "smtp", "MAIL_PROVIDER: %q must be log or smtp", c.Mail.Provider)
+	check(c.Mail.Provider != "smtp" || c.Mail.SMTPHost != "", "SMTP_HOST is required when MAIL_PROVIDER is smtp")
+	port("SMTP_PORT", strconv.Itoa(c.Mail.SMTPPort), false)
+	check(c.Mail.DigestIntervalMinutes >= 0, "MENTION_DIGEST_INTERVAL_MINUTES cannot be negative")
+	check(c.Mail.QueueSize > 0, "MAIL_QUEUE_SIZE must be positive")
+	check(httpURL(c.Mail.AppURL), "APP_BASE_URL: %q is not an http(s) URL", c.Mail.AppURL)
+	check(httpURL(c.Mail.APIURL), "API_BASE_URL: %q is not an http(s) URL", c.Mail.APIURL)
+	check((c.OAuth.GoogleClientID == "") == (c.OAuth.GoogleClientSecret == ""), "OAUTH_GOOGLE_CLIENT_ID and OAUTH_GOOGLE_CLIENT_SECRET must be set together")
+	check((c.OAuth.GitHubClientID == "") == (c.OAuth.GitHubClientSecret == ""), "OAUTH_GITHUB_CLIENT_ID and OAUTH_GITHUB_CLIENT_SECRET must be set together")
+	if c.OIDC.Issuer != "" {
+		check(httpURL(c.OIDC.Issuer), "OIDC_ISSUER: %q is not an http(s) URL", c.OIDC.Issuer)
+		check(c.OIDC.Audience != "", "OIDC_AUDIENCE is required when OIDC_ISSUER is set")
+		check(c.OIDC.JWKSURL == "" || httpURL(c.OIDC.JWKSURL), "OIDC_JWKS_URL: %q is not an http(s) URL", c.OIDC.JWKSURL)
+		check(c.OIDC.JWKSCacheMinutes > 0, "OIDC_JWKS_CACHE_MINUTES must be positive")
+	}
+
+	port("GRPC_PORT", c.GRPC.Port, true)
+	if c.GRPC.Port != "" && c.GRPC.AuthToken == "" {
+		errs = append(errs, fmt.Errorf("GRPC_AUTH_TOKEN must be set when GRPC_PORT is"))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if c.TLS.CertFile != "" && len(c.TLS.AutocertHosts) > 0 {
+		errs = append(errs, fmt.Errorf("TLS_CERT_FILE and TLS_AUTOCERT_HOSTS are mutually exclusive"))
+	}
+	check(c.TLS.HSTSMaxAgeSec >= 0, "HSTS_MAX_AGE_SECONDS cannot be negative")
+	port("HTTP_REDIRECT_PORT", c.TLS.RedirectPort, true)
+
+	return errs
+}
+
+func validatePolicies(prefix string, policies map[string]RateLimitPolicy) []error {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		p := policies[name]
+		key := prefix + strings.ToUpper(name)
+		if p.RatePerSec <= 0 {
+			errs = append(errs, fmt.Errorf("%s_RPS must be positive", key))
+		}
+		if p.Burst < 1 {
+			errs = append(errs, fmt.Errorf("%s_BURST must be at least 1", key))
+		}
+	}
+	return errs
+}
+
+// validOrigin accepts "*", "*.domain", "scheme://*.domain" and
+// "scheme://host[:port]"
+func validOrigin(o string) bool {
+	if o == "*" {
+		return true
+	}
+	if strings.HasPrefix(o, "*.") {
+		return len(o) > 2
+	}
+	u, err := url.Parse(strings.Replace(o, "://*.", "://", 1))
+	return err == nil && u.Scheme != "" && u.Host != "" && (u.Path == "" || u.Path == "/")
+}
+
+func httpURL(v string) bool {
+	u, err := url.Parse(v)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,185 @@
+// Package apierror defines the JSON error envelope shared by every HTTP
+// endpoint and the catalog of machine-readable error codes:
+//
+//	{"error": {"code": "CHANNEL_NOT_FOUND", "message": "Channel not found"}}
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/tullo/backend/internal/i18n"
+)
+
+// Code is a stable, machine-readable error identifier. Clients should branch
+// on the code, never on the message.
+type Code string
+
+const (
+	// Generic codes, chosen by HTTP status when nothing more specific applies
+	BadRequest   Code = "BAD_REQUEST"
+	Unauthorized Code = "UNAUTHORIZED"
+	Forbidden    Code = "FORBIDDEN"
+	NotFound     Code = "NOT_FOUND"
+	Conflict     Code = "CONFLICT"
+	Internal     Code = "INTERNAL"
+	Unavailable  Code = "UNAVAILABLE"
+
+	PayloadTooLarge      Code = "PAYLOAD_TOO_LARGE"
+	UnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE"
+
+	ValidationFailed     Code = "VALIDATION_FAILED"
+	InvalidCredentials   Code = "INVALID_CREDENTIALS"
+	InvalidToken         Code = "INVALID_TOKEN"
+	RefreshTokenReused   Code = "REFRESH_TOKEN_REUSED"
+	NotMember            Code = "NOT_MEMBER"
+	UserNotFound         Code = "USER_NOT_FOUND"
+	ChannelNotFound      Code = "CHANNEL_NOT_FOUND"
+	ConversationNotFound Code = "CONVERSATION_NOT_FOUND"
+	MessageNotFound      Code = "MESSAGE_NOT_FOUND"
+	StreamNotFound       Code = "STREAM_NOT_FOUND"
+	VersionConflict      Code = "VERSION_CONFLICT"
+	AlreadyReported      Code = "ALREADY_REPORTED"
+	InsufficientScope    Code = "INSUFFICIENT_SCOPE"
+	RateLimited          Code = "RATE_LIMITED"
+	IPBlocked            Code = "IP_BLOCKED"
+	TooManyAttempts      Code = "TOO_MANY_ATTEMPTS"
+	Banned               Code = "BANNED"
+	Muted                Code = "MUTED"
+	UsernameTaken        Code = "USERNAME_TAKEN"
+	DMNotAllowed         Code = "DM_NOT_ALLOWED"
+	FollowThrottled      Code = "FOLLOW_THROTTLED"
+	ChannelLimitReached  Code = "CHANNEL_LIMIT_REACHED"
+	ChannelCooldown      Code = "CHANNEL_COOLDOWN"
+	MessageTooLong       Code = "MESSAGE_TOO_LONG"
+	TooManyEmotes        Code = "TOO_MANY_EMOTES"
+)
+
+// Envelope is the body of every error response
+type Envelope struct {
+	Error Detail `json:"error"`
+}
+
+// Detail carries the code, a human-readable message and optional structured details
+type Detail struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// FieldError describes one failed validation rule on a request field
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// DefaultCode returns the generic code for an HTTP status
+func DefaultCode(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return BadRequest
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusRequestEntityTooLarge:
+		return PayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return UnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return BadRequest
+}
+
+// Write sends an error envelope
+func Write(c *gin.Context, status int, code Code, message string, details any) {
+	c.JSON(status, Envelope{Error: Detail{Code: code, Message: localize(c, code, message), Details: details}})
+}
+
+// Abort sends an error envelope and stops the handler chain (for middleware)
+func Abort(c *gin.Context, status int, code Code, message string) {
+	c.AbortWithStatusJSON(status, Envelope{Error: Detail{Code: code, Message: localize(c, code, message)}})
+}
+
+// localize replaces message with the catalog translation for code when the
+// request's Accept-Language prefers a language other than English. Call
+// sites keep writing English; their more specific wording is what English
+// clients see.
+func localize(c *gin.Context, code Code, message string) string {
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	if c.Request == nil {
+		return message
+	}
+	msg, lang := i18n.Default.Translate(c.GetHeader("Accept-Language"), string(code), message)
+	c.Header("Content-Language", lang)
+	return msg
+}
+
+// Validation translates a binding error into a message and per-field details.
+// Malformed JSON yields no details; validator failures yield one FieldError
+// per failed rule.
+func Validation(err error) (string, []FieldError) {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		fields := make([]FieldError, 0, len(verrs))
+		names := make([]string, 0, len(verrs))
+		for _, fe := range verrs {
+			fields = append(fields, FieldError{Field: fe.Field(), Rule: fe.Tag(), Param: fe.Param()})
+			names = append(names, fe.Field())
+		}
+		return "invalid fields: " + strings.Join(names, ", "), fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("field %s must be %s", typeErr.Field, typeErr.Type), []FieldError{{Field: typeErr.Field, Rule: "type", Param: typeErr.Type.String()}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return "malformed JSON body", nil
+	}
+
+	return err.Error(), nil
+}
+
+// UseJSONFieldNames makes validator report request fields by their json (or
+// form) tag, e.g. "display_name" rather than "DisplayName". Call once at startup.
+func UseJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(fieldName)
+}
+
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
@@ -0,0 +1,129 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/i18n"
+)
+
+type signup struct {
+	Email       string `json:"email" binding:"required,email"`
+	DisplayName string `json:"display_name" binding:"required"`
+	Age         int    `json:"age"`
+}
+
+func bind(t *testing.T, body string) error {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	var req signup
+	return c.ShouldBindJSON(&req)
+}
+
+func TestValidationReportsJSONFieldNames(t *testing.T) {
+	UseJSONFieldNames()
+
+	msg, details := Validation(bind(t, `{"email":"nope"}`))
+	if len(details) != 2 {
+		t.Fatalf("details = %+v", details)
+	}
+	if details[0] != (FieldError{Field: "email", Rule: "email"}) {
+		t.Errorf("details[0] = %+v", details[0])
+	}
+	if details[1] != (FieldError{Field: "display_name", Rule: "required"}) {
+		t.Errorf("details[1] = %+v", details[1])
+	}
+	if msg != "invalid fields: email, display_name" {
+		t.Errorf("message = %q", msg)
+	}
+}
+
+func TestValidationTypeAndSyntaxErrors(t *testing.T) {
+	_, details := Validation(bind(t, `{"email":"a@b.c","display_name":"x","age":"old"}`))
+	if len(details) != 1 || details[0].Field != "age" || details[0].Rule != "type" {
+		t.Errorf("type error details = %+v", details)
+	}
+
+	msg, details := Validation(bind(t, `{"email":`))
+	if details != nil || msg == "" {
+		t.Errorf("syntax error: msg=%q details=%+v", msg, details)
+	}
+}
+
+func TestWriteEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	Write(c, http.StatusNotFound, ChannelNotFound, "Channel not found", nil)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d", w.Code)
+	}
+	var env Envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Error.Code != ChannelNotFound || env.Error.Message != "Channel not found" {
+		t.Errorf("envelope = %+v", env)
+	}
+	if strings.Contains(w.Body.String(), "details") {
+		t.Errorf("empty details should be omitted: %s", w.Body.String())
+	}
+}
+
+func TestDefaultCode(t *testing.T) {
+	cases := map[int]Code{
+		400: BadRequest, 401: Unauthorized, 403: Forbidden, 404: NotFound,
+		409: Conflict, 429: RateLimited, 500: Internal, 502: Internal, 503: Unavailable,
+	}
+	for status, want := range cases {
+		if got := DefaultCode(status); got != want {
+			t.Errorf("DefaultCode(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestWriteLocalizesMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Accept-Language", "de-DE, en;q=0.5")
+	Write(c, http.StatusNotFound, ChannelNotFound, "Channel not found", nil)
+
+	var env Envelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Error.Code != ChannelNotFound || env.Error.Message != "Kanal nicht gefunden" {
+		t.Errorf("envelope = %+v", env)
+	}
+	if got := w.Header().Get("Content-Language"); got != "de" {
+		t.Errorf("Content-Language = %q", got)
+	}
+}
+
+func TestEveryCodeIsTranslated(t *testing.T) {
+	codes := []Code{
+		BadRequest, Unauthorized, Forbidden, NotFound, Conflict, Internal, Unavailable,
+		PayloadTooLarge, UnsupportedMediaType, ValidationFailed, InvalidCredentials,
+		InvalidToken, NotMember, UserNotFound, ChannelNotFound, ConversationNotFound,
+		MessageNotFound, StreamNotFound, VersionConflict, RateLimited, IPBlocked, Banned, Muted,
+		UsernameTaken, DMNotAllowed, FollowThrottled, ChannelLimitReached, ChannelCooldown,
+		MessageTooLong, TooManyEmotes,
+	}
+	for _, lang := range i18n.Default.Languages() {
+		for _, code := range codes {
+			if _, got := i18n.Default.Translate(lang, string(code), ""); got != lang {
+				t.Errorf("%s has no translation for %s", lang, code)
+			}
+		}
+	}
+}
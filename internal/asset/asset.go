@@ -0,0 +1,54 @@
+// Package asset checks the images channels upload for chat, their badges
+// and emotes, and addresses them by content. An asset's URL is derived from its
+// SHA-256, so what it serves never changes and browsers and CDNs may cache
+// it for good.
+package asset
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/tullo/backend/internal/models"
+)
+
+// Scales are the image scales an asset may come in, smallest first
+var Scales = []string{models.ImageScale1x, models.ImageScale2x, models.ImageScale4x}
+
+// MaxImageBytes is the largest image accepted at any scale
+const MaxImageBytes = 128 << 10
+
+var (
+	// ErrUnsupportedImage is returned by New for content that is not a PNG,
+	// GIF or WebP image
+	ErrUnsupportedImage = errors.New("images must be PNG, GIF or WebP")
+	// ErrTooLarge is returned by New for images over MaxImageBytes
+	ErrTooLarge = errors.New("images must be at most 128 KiB")
+)
+
+// HashPattern is what the hash in an asset URL looks like
+var HashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+var imageTypes = map[string]bool{"image/png": true, "image/gif": true, "image/webp": true}
+
+// New checks that data is an image we serve and addresses it by its
+// SHA-256. The content type is sniffed from data rather than taken from the
+// uploader, since the asset is served from our origin.
+func New(data []byte) (*models.Asset, error) {
+	if len(data) > MaxImageBytes {
+		return nil, ErrTooLarge
+	}
+	ct := http.DetectContentType(data)
+	if !imageTypes[ct] {
+		return nil, ErrUnsupportedImage
+	}
+	sum := sha256.Sum256(data)
+	return &models.Asset{Hash: hex.EncodeToString(sum[:]), ContentType: ct, Data: data}, nil
+}
+
+// Path is where the asset with hash is served
+func Path(hash string) string {
+	return "/assets/" + hash
+}
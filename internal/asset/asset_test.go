@@ -0,0 +1,27 @@
+package asset
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nrest of the image")
+	a, err := New(png)
+	if err != nil || a.ContentType != "image/png" || !HashPattern.MatchString(a.Hash) {
+		t.Fatalf("New(png) = %+v, %v", a, err)
+	}
+	if b, _ := New(png); b.Hash != a.Hash {
+		t.Error("the same content should get the same hash")
+	}
+	if _, err := New([]byte("<svg onload=alert(1)></svg>")); err != ErrUnsupportedImage {
+		t.Errorf("New(svg) err = %v, want ErrUnsupportedImage", err)
+	}
+	big := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, MaxImageBytes)...)
+	if _, err := New(big); err != ErrTooLarge {
+		t.Errorf("New(big) err = %v, want ErrTooLarge", err)
+	}
+	if got := Path(a.Hash); got != "/assets/"+a.Hash {
+		t.Errorf("Path = %q", got)
+	}
+}
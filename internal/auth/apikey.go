@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Prefixes of API keys and channel overlay tokens, so leaked ones are easy
+// to search for
+const (
+	APIKeyPrefix       = "tlk_"
+	OverlayTokenPrefix = "tlo_"
+)
+
+// GenerateAPIKey returns a new API key and its hint, the part shown in key
+// listings
+func GenerateAPIKey() (key, hint string, err error) {
+	return generateSecret(APIKeyPrefix)
+}
+
+// GenerateOverlayToken returns a new channel overlay token and its hint. It
+// is stored hashed with HashAPIKey.
+func GenerateOverlayToken() (token, hint string, err error) {
+	return generateSecret(OverlayTokenPrefix)
+}
+
+func generateSecret(prefix string) (secret, hint string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret = prefix + base64.RawURLEncoding.EncodeToString(raw)
+	return secret, secret[:len(prefix)+6], nil
+}
+
+// HashAPIKey returns the digest stored for key, or for an overlay token.
+// They are random enough that a plain hash is safe, and lookups by hash
+// stay cheap.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LooksLikeAPIKey reports whether s has the shape of a key from GenerateAPIKey
+func LooksLikeAPIKey(s string) bool {
+	return strings.HasPrefix(s, APIKeyPrefix) && len(s) == len(APIKeyPrefix)+43
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, hint, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !LooksLikeAPIKey(key) {
+		t.Errorf("LooksLikeAPIKey(%q) = false", key)
+	}
+	if len(hint) != 10 || key[:10] != hint {
+		t.Errorf("hint %q is not the start of %q", hint, key)
+	}
+
+	other, _, _ := GenerateAPIKey()
+	if other == key || HashAPIKey(other) == HashAPIKey(key) {
+		t.Error("Expected distinct keys and hashes")
+	}
+	if HashAPIKey(key) != HashAPIKey(key) {
+		t.Error("Expected hash to be stable")
+	}
+	if LooksLikeAPIKey("eyJhbGciOi") || LooksLikeAPIKey(APIKeyPrefix+"short") {
+		t.Error("Expected non-keys to be rejected")
+	}
+}
+
+func TestGenerateOverlayToken(t *testing.T) {
+	token, hint, err := GenerateOverlayToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, OverlayTokenPrefix) || len(token) != len(OverlayTokenPrefix)+43 {
+		t.Errorf("token %q has the wrong shape", token)
+	}
+	if hint != token[:10] {
+		t.Errorf("hint %q is not the start of %q", hint, token)
+	}
+	if LooksLikeAPIKey(token) {
+		t.Error("Expected overlay tokens not to pass for API keys")
+	}
+}
@@ -1,7 +1,13 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,26 +17,108 @@ import (
 type Claims struct {
 	UserID uuid.UUID `json:"user_id"`
 	Email  string    `json:"email"`
+	// SessionID is the login the token was issued for, so it stops working
+	// when the session is signed out; nil for tokens issued without one
+	SessionID uuid.UUID `json:"sid"`
+	// Role is the user's platform role when the token was issued; a role
+	// change signs out the user's sessions, so it is never stale for long
+	Role string `json:"role,omitempty"`
+	// Guest marks a token from GenerateGuestToken, whose UserID belongs to
+	// no account
+	Guest bool `json:"guest,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type JWTService struct {
-	secret      []byte
-	expiryHours int
+	mu     sync.RWMutex
+	secret []byte
+	// previous still validates tokens signed before the last rotation until
+	// previousUntil, when the last of them has expired
+	previous      []byte
+	previousUntil time.Time
+	expiryHours   int
+	refreshExpiry time.Duration
+	guestExpiry   time.Duration
 }
 
+// DefaultRefreshExpiry is how long a refresh token stays usable unless
+// SetRefreshExpiry says otherwise
+const DefaultRefreshExpiry = 30 * 24 * time.Hour
+
+// DefaultGuestExpiry is how long a guest token stays usable unless
+// SetGuestExpiry says otherwise
+const DefaultGuestExpiry = time.Hour
+
 func NewJWTService(secret string, expiryHours int) *JWTService {
 	return &JWTService{
-		secret:      []byte(secret),
-		expiryHours: expiryHours,
+		secret:        []byte(secret),
+		expiryHours:   expiryHours,
+		refreshExpiry: DefaultRefreshExpiry,
+		guestExpiry:   DefaultGuestExpiry,
 	}
 }
 
+// SetRefreshExpiry changes the lifetime of refresh tokens issued from now on
+func (s *JWTService) SetRefreshExpiry(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshExpiry = d
+}
+
+// SetGuestExpiry changes the lifetime of guest tokens issued from now on
+func (s *JWTService) SetGuestExpiry(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.guestExpiry = d
+}
+
+// GuestExpiresIn is the lifetime of guest tokens
+func (s *JWTService) GuestExpiresIn() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.guestExpiry
+}
+
+// ExpiresIn is the lifetime of access tokens
+func (s *JWTService) ExpiresIn() time.Duration {
+	return time.Duration(s.expiryHours) * time.Hour
+}
+
+// GenerateRefreshToken returns a new opaque refresh token and when it
+// expires. Refresh tokens are not JWTs: they are only meaningful to the
+// server, which stores their hash (see HashRefreshToken) and rotates them on
+// every use.
+func (s *JWTService) GenerateRefreshToken() (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	s.mu.RLock()
+	expiry := s.refreshExpiry
+	s.mu.RUnlock()
+
+	return base64.RawURLEncoding.EncodeToString(raw), time.Now().Add(expiry), nil
+}
+
+// HashRefreshToken is the form a refresh token is stored and looked up in
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // GenerateToken generates a new JWT token for a user
 func (s *JWTService) GenerateToken(userID uuid.UUID, email string) (string, error) {
+	return s.GenerateSessionToken(userID, email, "", uuid.Nil)
+}
+
+// GenerateSessionToken generates a JWT token for a user's login session
+func (s *JWTService) GenerateSessionToken(userID uuid.UUID, email, role string, sessionID uuid.UUID) (string, error) {
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		Role:      role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(s.expiryHours) * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -38,19 +126,63 @@ func (s *JWTService) GenerateToken(userID uuid.UUID, email string) (string, erro
 		},
 	}
 
+	s.mu.RLock()
+	secret := s.secret
+	s.mu.RUnlock()
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secret)
+	return token.SignedString(secret)
+}
+
+// GenerateGuestToken issues a token for an anonymous viewer under a new
+// guest ID. Guests may only read channel chats; the middleware and the
+// WebSocket turn them away from everything else.
+func (s *JWTService) GenerateGuestToken() (string, uuid.UUID, error) {
+	guestID := uuid.New()
+	claims := &Claims{
+		UserID: guestID,
+		Guest:  true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.GuestExpiresIn())),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	s.mu.RLock()
+	secret := s.secret
+	s.mu.RUnlock()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	return token, guestID, nil
+}
+
+// Rotate signs new tokens with secret. Tokens signed with the old secret stay
+// valid until they expire.
+func (s *JWTService) Rotate(secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.previous = s.secret
+	s.previousUntil = time.Now().Add(time.Duration(s.expiryHours) * time.Hour)
+	s.secret = []byte(secret)
 }
 
 // ValidateToken validates a JWT token and returns the claims
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secret, nil
-	})
+	s.mu.RLock()
+	secret, previous := s.secret, s.previous
+	if time.Now().After(s.previousUntil) {
+		previous = nil
+	}
+	s.mu.RUnlock()
 
+	token, err := parseToken(tokenString, secret)
+	if err != nil && previous != nil && errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		token, err = parseToken(tokenString, previous)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -61,3 +193,12 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, fmt.Errorf("invalid token")
 }
+
+func parseToken(tokenString string, secret []byte) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret, nil
+	})
+}
@@ -45,6 +45,57 @@ func TestJWTService_ValidateToken(t *testing.T) {
 	}
 }
 
+func TestJWTService_SessionToken(t *testing.T) {
+	service := NewJWTService("test-secret-key", 24)
+
+	userID, sessionID := uuid.New(), uuid.New()
+	token, err := service.GenerateSessionToken(userID, "test@example.com", "admin", sessionID)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	claims, err := service.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if claims.SessionID != sessionID {
+		t.Errorf("Expected session %s, got %s", sessionID, claims.SessionID)
+	}
+	if claims.Role != "admin" {
+		t.Errorf("Expected role admin, got %q", claims.Role)
+	}
+
+	token, _ = service.GenerateToken(userID, "test@example.com")
+	if claims, err := service.ValidateToken(token); err != nil || claims.SessionID != uuid.Nil {
+		t.Errorf("Expected no session, got %v, %v", claims, err)
+	}
+}
+
+func TestJWTService_GuestToken(t *testing.T) {
+	service := NewJWTService("test-secret-key", 24)
+	service.SetGuestExpiry(10 * time.Minute)
+
+	token, guestID, err := service.GenerateGuestToken()
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	claims, err := service.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !claims.Guest || claims.UserID != guestID || claims.Email != "" {
+		t.Errorf("claims = %+v, want guest %s", claims, guestID)
+	}
+	if ttl := time.Until(claims.ExpiresAt.Time); ttl > 10*time.Minute || ttl < 9*time.Minute {
+		t.Errorf("guest token expires in %s, want 10m", ttl)
+	}
+
+	token, _ = service.GenerateToken(uuid.New(), "test@example.com")
+	if claims, _ := service.ValidateToken(token); claims.Guest {
+		t.Error("user token marked as guest")
+	}
+}
+
 func TestJWTService_ValidateToken_Invalid(t *testing.T) {
 	secret := "test-secret-key"
 	expiryHours := 24
@@ -77,3 +128,54 @@ func TestJWTService_ValidateToken_Expired(t *testing.T) {
 		t.Fatal("Expected error for expired token")
 	}
 }
+
+func TestJWTService_Rotate(t *testing.T) {
+	service := NewJWTService("old-secret", 24)
+	userID := uuid.New()
+
+	oldToken, err := service.GenerateToken(userID, "test@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	service.Rotate("new-secret")
+
+	newToken, err := service.GenerateToken(userID, "test@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if _, err := NewJWTService("new-secret", 24).ValidateToken(newToken); err != nil {
+		t.Fatalf("Expected new token to be signed with the new secret: %v", err)
+	}
+
+	// Tokens issued before the rotation stay valid until they expire
+	if _, err := service.ValidateToken(oldToken); err != nil {
+		t.Fatalf("Expected token signed with the previous secret to validate, got %v", err)
+	}
+
+	// ...but not after a second rotation drops the original secret
+	service.Rotate("newer-secret")
+	if _, err := service.ValidateToken(oldToken); err == nil {
+		t.Fatal("Expected error for token signed with a retired secret")
+	}
+}
+
+func TestJWTService_GenerateRefreshToken(t *testing.T) {
+	service := NewJWTService("test-secret-key", 1)
+	service.SetRefreshExpiry(48 * time.Hour)
+
+	a, expiresAt, err := service.GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	b, _, _ := service.GenerateRefreshToken()
+	if a == "" || a == b {
+		t.Errorf("Expected distinct non-empty tokens, got %q and %q", a, b)
+	}
+	if d := time.Until(expiresAt); d < 47*time.Hour || d > 48*time.Hour {
+		t.Errorf("Expected expiry in 48h, got %v", d)
+	}
+	if HashRefreshToken(a) == HashRefreshToken(b) || HashRefreshToken(a) != HashRefreshToken(a) {
+		t.Error("Expected hashes to be stable and distinct")
+	}
+}
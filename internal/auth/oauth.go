@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuthIdentity is the account a user signed in with at an OAuth provider
+type OAuthIdentity struct {
+	Provider string
+	// Subject is the provider's stable ID for the account
+	Subject string
+	Email   string
+	// EmailVerified reports whether the provider vouches for Email
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// OAuthProvider runs the authorization code flow with one identity provider
+type OAuthProvider interface {
+	// Name is the provider's name in URLs, e.g. "github"
+	Name() string
+	// AuthCodeURL is where the user is sent to sign in
+	AuthCodeURL(state, redirectURL string) string
+	// Exchange trades the code from the callback for the user's identity
+	Exchange(ctx context.Context, code, redirectURL string) (*OAuthIdentity, error)
+}
+
+// ErrInvalidOAuthState is returned for a callback that does not belong to a
+// sign-in started by this server and the same browser, or that expired
+var ErrInvalidOAuthState = errors.New("invalid oauth state")
+
+// oauthStateTTL bounds how long a user may take to sign in at the provider
+const oauthStateTTL = 10 * time.Minute
+
+// OAuth holds the configured providers and signs the state parameter that
+// ties a callback to the browser that started the sign-in
+type OAuth struct {
+	providers map[string]OAuthProvider
+	stateKey  []byte
+}
+
+// NewOAuth returns an OAuth with no providers; the state key is derived from
+// secret
+func NewOAuth(secret string) *OAuth {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("oauth-state"))
+	return &OAuth{providers: map[string]OAuthProvider{}, stateKey: mac.Sum(nil)}
+}
+
+// Register offers p for sign-in
+func (o *OAuth) Register(p OAuthProvider) {
+	o.providers[p.Name()] = p
+}
+
+// Provider returns the provider called name, if configured
+func (o *OAuth) Provider(name string) (OAuthProvider, bool) {
+	p, ok := o.providers[name]
+	return p, ok
+}
+
+// NewState returns a state parameter for provider and the nonce to keep in
+// the browser (as a cookie) until the callback
+func (o *OAuth) NewState(provider string) (state, nonce string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+	nonce = base64.RawURLEncoding.EncodeToString(b)
+	payload := fmt.Sprintf("%s.%s.%d", provider, nonce, time.Now().Add(oauthStateTTL).Unix())
+	return payload + "." + o.signState(payload), nonce, nil
+}
+
+// VerifyState checks that state was issued by NewState for provider and
+// nonce and has not expired
+func (o *OAuth) VerifyState(state, provider, nonce string) error {
+	i := strings.LastIndex(state, ".")
+	if i < 0 || !hmac.Equal([]byte(state[i+1:]), []byte(o.signState(state[:i]))) {
+		return ErrInvalidOAuthState
+	}
+	parts := strings.Split(state[:i], ".")
+	if len(parts) != 3 || parts[0] != provider || nonce == "" || !hmac.Equal([]byte(parts[1]), []byte(nonce)) {
+		return ErrInvalidOAuthState
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidOAuthState
+	}
+	return nil
+}
+
+func (o *OAuth) signState(payload string) string {
+	mac := hmac.New(sha256.New, o.stateKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// oauthClient is the client the providers talk to their APIs with
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+// exchangeCode redeems an authorization code at tokenURL for an access token
+func exchangeCode(ctx context.Context, tokenURL, clientID, clientSecret, code, redirectURL string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := doJSON(req, &tok); err != nil {
+		return "", fmt.Errorf("failed to exchange oauth code: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("failed to exchange oauth code: %s", tok.Error)
+	}
+	return tok.AccessToken, nil
+}
+
+// getJSON fetches an API resource with an access token
+func getJSON(ctx context.Context, apiURL, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	return doJSON(req, v)
+}
+
+func doJSON(req *http.Request, v any) error {
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOAuthState(t *testing.T) {
+	o := NewOAuth("secret")
+	state, nonce, err := o.NewState("github")
+	if err != nil {
+		t.Fatalf("NewState: %v", err)
+	}
+	if err := o.VerifyState(state, "github", nonce); err != nil {
+		t.Errorf("own state rejected: %v", err)
+	}
+	if err := o.VerifyState(state, "google", nonce); err == nil {
+		t.Error("state accepted for another provider")
+	}
+	if err := o.VerifyState(state, "github", "other"); err == nil {
+		t.Error("state accepted without its nonce")
+	}
+	if err := o.VerifyState(state, "github", ""); err == nil {
+		t.Error("state accepted without a cookie")
+	}
+	if err := o.VerifyState(state+"x", "github", nonce); err == nil {
+		t.Error("tampered state accepted")
+	}
+	if err := NewOAuth("other").VerifyState(state, "github", nonce); err == nil {
+		t.Error("state accepted by another secret")
+	}
+}
+
+func TestGitHubProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.FormValue("code") != "abc" {
+				json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "tok"})
+		case "/user":
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"id":42,"login":"octo","name":"","avatar_url":"https://a/42"}`))
+		case "/user/emails":
+			w.Write([]byte(`[{"email":"old@x.io","primary":false,"verified":true},{"email":"octo@x.io","primary":true,"verified":true}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGitHubProvider("id", "secret")
+	p.TokenURL, p.APIURL = srv.URL+"/token", srv.URL
+
+	if u := p.AuthCodeURL("st", "https://api/cb"); !strings.Contains(u, "state=st") || !strings.Contains(u, "client_id=id") {
+		t.Errorf("AuthCodeURL = %s", u)
+	}
+	id, err := p.Exchange(context.Background(), "abc", "https://api/cb")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if id.Subject != "42" || id.Email != "octo@x.io" || !id.EmailVerified || id.Name != "octo" {
+		t.Errorf("identity = %+v", id)
+	}
+	if _, err := p.Exchange(context.Background(), "wrong", "https://api/cb"); err == nil {
+		t.Error("bad code accepted")
+	}
+}
+
+func TestGoogleProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "tok"})
+		case "/userinfo":
+			w.Write([]byte(`{"sub":"1077","email":"ann@x.io","email_verified":true,"name":"Ann"}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGoogleProvider("id", "secret")
+	p.TokenURL, p.UserInfoURL = srv.URL+"/token", srv.URL+"/userinfo"
+
+	id, err := p.Exchange(context.Background(), "abc", "https://api/cb")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if id.Provider != "google" || id.Subject != "1077" || id.Email != "ann@x.io" || !id.EmailVerified {
+		t.Errorf("identity = %+v", id)
+	}
+}
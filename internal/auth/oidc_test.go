@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOIDCVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+		case "/keys":
+			fetches.Add(1)
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	sign := func(kid string, claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	claims := func(mutate func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   srv.URL,
+			"aud":   "tullo",
+			"sub":   "emp-42",
+			"email": "ada@corp.example",
+			"name":  "Ada",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		if mutate != nil {
+			mutate(c)
+		}
+		return c
+	}
+
+	v := NewOIDCVerifier(srv.URL+"/", "tullo", "", time.Hour, true)
+	ctx := context.Background()
+
+	id, err := v.Verify(ctx, sign("k1", claims(nil)))
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if id.Provider != OIDCProvider || id.Subject != "emp-42" || id.Email != "ada@corp.example" || !id.EmailVerified {
+		t.Errorf("identity = %+v", id)
+	}
+
+	unverified, err := v.Verify(ctx, sign("k1", claims(func(c jwt.MapClaims) { c["email_verified"] = false })))
+	if err != nil || unverified.EmailVerified {
+		t.Errorf("email_verified=false should win over trusting emails: %+v, %v", unverified, err)
+	}
+
+	bad := map[string]string{
+		"wrong audience": sign("k1", claims(func(c jwt.MapClaims) { c["aud"] = "other" })),
+		"wrong issuer":   sign("k1", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" })),
+		"expired":        sign("k1", claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })),
+		"no expiry":      sign("k1", claims(func(c jwt.MapClaims) { delete(c, "exp") })),
+		"no subject":     sign("k1", claims(func(c jwt.MapClaims) { delete(c, "sub") })),
+		"unknown key":    sign("k2", claims(nil)),
+	}
+	for name, token := range bad {
+		if _, err := v.Verify(ctx, token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("secret"))
+	if _, err := v.Verify(ctx, hmacToken); err == nil {
+		t.Error("HMAC token accepted")
+	}
+
+	// An unknown key refetches the JWKS at most once per jwksRefetchInterval
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
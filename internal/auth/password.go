@@ -1,11 +1,69 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Password hashing algorithms
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+// ErrPasswordMismatch is returned by CheckPassword for a wrong password
+var ErrPasswordMismatch = errors.New("password does not match")
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Argon2Params are the Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm. Hashes
+// of the other algorithm keep verifying with CheckPassword, and NeedsRehash
+// reports them so they can be replaced after a successful login.
+type PasswordHasher struct {
+	algorithm string
+	argon2    Argon2Params
+}
+
+func NewPasswordHasher(algorithm string, argon2 Argon2Params) *PasswordHasher {
+	return &PasswordHasher{algorithm: algorithm, argon2: argon2}
+}
+
+// Hash hashes password with the configured algorithm
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.algorithm == PasswordArgon2id {
+		return hashArgon2id(password, h.argon2)
+	}
+	return HashPassword(password)
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or other
+// cost parameters than Hash would use
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	if h.algorithm == PasswordArgon2id {
+		params, _, _, err := decodeArgon2id(hash)
+		return err != nil || params != h.argon2
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != bcrypt.DefaultCost
+}
+
 // HashPassword hashes a password using bcrypt
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -15,8 +73,59 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), nil
 }
 
-// CheckPassword compares a hash with a password
+// CheckPassword compares a bcrypt or Argon2id hash with a password
 // signature: CheckPassword(hash, password)
 func CheckPassword(hash, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// hashArgon2id encodes the hash in the PHC string format used by the
+// reference implementation: $argon2id$v=19$m=...,t=...,p=...$salt$key
+func hashArgon2id(password string, p Argon2Params) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordArgon2id {
+		return p, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2 key")
+	}
+	return p, salt, key, nil
 }
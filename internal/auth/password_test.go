@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -62,3 +63,37 @@ func TestHashPassword_EmptyString(t *testing.T) {
 		t.Fatal("Expected hash to be generated even for empty password")
 	}
 }
+
+func TestPasswordHasher_Argon2id(t *testing.T) {
+	params := Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+	hasher := NewPasswordHasher(PasswordArgon2id, params)
+
+	hash, err := hasher.Hash("mySecurePassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+	if err := CheckPassword(hash, "mySecurePassword123"); err != nil {
+		t.Errorf("Expected password to match, got error: %v", err)
+	}
+	if err := CheckPassword(hash, "wrongPassword"); err == nil {
+		t.Error("Expected error for wrong password")
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Error("Fresh hash should not need a rehash")
+	}
+
+	bcryptHash, _ := HashPassword("mySecurePassword123")
+	if !hasher.NeedsRehash(bcryptHash) {
+		t.Error("bcrypt hash should need a rehash to argon2id")
+	}
+	stronger := NewPasswordHasher(PasswordArgon2id, Argon2Params{Memory: 128, Iterations: 1, Parallelism: 1})
+	if !stronger.NeedsRehash(hash) {
+		t.Error("Hash with older parameters should need a rehash")
+	}
+	if !NewPasswordHasher(PasswordBcrypt, params).NeedsRehash(hash) {
+		t.Error("argon2id hash should need a rehash back to bcrypt")
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReportSigner(t *testing.T) {
+	signer := NewReportSigner("test-secret-key")
+	id := uuid.New()
+
+	token := signer.Token(id)
+	if token == "" {
+		t.Fatal("Expected token to be generated")
+	}
+	if !signer.Valid(id, token) {
+		t.Error("Expected token to be valid for its message")
+	}
+	if signer.Valid(uuid.New(), token) {
+		t.Error("Expected token to be invalid for another message")
+	}
+	if signer.Valid(id, "") {
+		t.Error("Expected empty token to be invalid")
+	}
+	if NewReportSigner("other-secret").Valid(id, token) {
+		t.Error("Expected token to be invalid under another secret")
+	}
+}
@@ -0,0 +1,192 @@
+// Package authz decides who may manage, moderate and post in channels and
+// conversations. The REST handlers, the WebSocket and the gRPC API all ask
+// the same Policy, so a rule changes in one place.
+package authz
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// Conversation member roles
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleVIP       = models.ChannelRoleVIP
+	RoleMember    = "member"
+)
+
+// Reasons CanPost, CanChat and CanViewChat refuse a user
+var (
+	ErrNotMember = errors.New("not a member of this conversation")
+	ErrBanned    = errors.New("banned from this chat")
+	ErrMuted     = errors.New("muted in this chat")
+)
+
+// Policy answers the checks from the channel and conversation repositories
+type Policy struct {
+	convRepo *repository.ConversationRepository
+	chRepo   *repository.ChannelRepository
+}
+
+func NewPolicy(convRepo *repository.ConversationRepository, chRepo *repository.ChannelRepository) *Policy {
+	return &Policy{convRepo: convRepo, chRepo: chRepo}
+}
+
+// IsModeratorRole reports whether a conversation role may moderate
+func IsModeratorRole(role string) bool {
+	return role == RoleAdmin || role == RoleModerator
+}
+
+// CanManage reports whether userID may change ch itself: its settings,
+// streams, moderators and VIPs. Only the owner may.
+func (p *Policy) CanManage(ch *models.Channel, userID uuid.UUID) bool {
+	return ch.OwnerID == userID
+}
+
+// CanModerate reports whether userID may moderate ch's chat: the owner, and
+// admins and moderators of the chat conversation
+func (p *Policy) CanModerate(ch *models.Channel, userID uuid.UUID) (bool, error) {
+	if p.CanManage(ch, userID) {
+		return true, nil
+	}
+	convID, err := p.chRepo.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		return false, err
+	}
+	return p.CanModerateConversation(convID, userID)
+}
+
+// CanManageConversation reports whether userID may change a conversation's
+// settings: its admins
+func (p *Policy) CanManageConversation(conversationID, userID uuid.UUID) (bool, error) {
+	role, err := p.convRepo.GetMemberRole(conversationID, userID)
+	if err != nil {
+		return false, err
+	}
+	return role == RoleAdmin, nil
+}
+
+// CanModerateConversation reports whether userID may mute and ban members of
+// a conversation: its admins and moderators
+func (p *Policy) CanModerateConversation(conversationID, userID uuid.UUID) (bool, error) {
+	role, err := p.convRepo.GetMemberRole(conversationID, userID)
+	if err != nil {
+		return false, err
+	}
+	return IsModeratorRole(role), nil
+}
+
+// CanDeleteMessage reports whether userID may delete msg: its sender, and
+// in a channel chat whoever may moderate the channel, elsewhere the
+// conversation's admins
+func (p *Policy) CanDeleteMessage(msg *models.Message, userID uuid.UUID) (bool, error) {
+	if msg.SenderID == userID {
+		return true, nil
+	}
+	return p.canRemoveMessages(msg.ConversationID, userID)
+}
+
+// CanRestoreMessage reports whether userID may undo the deletion of msg:
+// whoever may delete others' messages there, and its sender if they deleted
+// it themselves, so senders cannot undo a moderator
+func (p *Policy) CanRestoreMessage(msg *models.Message, userID uuid.UUID) (bool, error) {
+	if msg.SenderID == userID && msg.DeletedBy != nil && *msg.DeletedBy == userID {
+		return true, nil
+	}
+	return p.canRemoveMessages(msg.ConversationID, userID)
+}
+
+// CanReviewReports reports whether userID may work through the reports
+// against a conversation's messages: whoever may delete them
+func (p *Policy) CanReviewReports(conversationID, userID uuid.UUID) (bool, error) {
+	return p.canRemoveMessages(conversationID, userID)
+}
+
+// canRemoveMessages reports whether userID may delete anyone's messages in a
+// conversation: in a channel chat whoever may moderate the channel,
+// elsewhere the conversation's admins
+func (p *Policy) canRemoveMessages(conversationID, userID uuid.UUID) (bool, error) {
+	channels, err := p.chRepo.GetByConversationIDs([]uuid.UUID{conversationID})
+	if err != nil {
+		return false, err
+	}
+	if ch, ok := channels[conversationID]; ok {
+		return p.CanModerate(&ch, userID)
+	}
+	return p.CanManageConversation(conversationID, userID)
+}
+
+// CanPost checks that userID may send to a conversation they are a member
+// of and returns its kind (models.ConversationDirect, Group or Channel) for
+// send limits. It fails with ErrNotMember, ErrBanned or ErrMuted.
+func (p *Policy) CanPost(conversationID, userID uuid.UUID) (string, error) {
+	kind, err := p.convRepo.MemberKind(conversationID, userID)
+	if err != nil {
+		return "", err
+	}
+	if kind == "" {
+		return "", ErrNotMember
+	}
+	if err := p.CanChat(conversationID, userID); err != nil {
+		return "", err
+	}
+	return kind, nil
+}
+
+// CanChat checks that userID may post in a channel chat, which is open to
+// everyone who is neither banned nor muted. It fails with ErrBanned or
+// ErrMuted.
+func (p *Policy) CanChat(conversationID, userID uuid.UUID) error {
+	muted, banned, err := p.convRepo.IsUserMutedOrBanned(conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check moderation: %w", err)
+	}
+	if banned {
+		return ErrBanned
+	}
+	if muted {
+		return ErrMuted
+	}
+	return nil
+}
+
+// CanViewChat checks that userID may read a channel chat and follow it live,
+// which everyone may who is not banned from it. It fails with ErrBanned. The
+// chat's REST endpoint and the WebSocket chat.join both ask, so who gets to
+// see a chat, members-only chats of private channels too, is decided here.
+func (p *Policy) CanViewChat(conversationID, userID uuid.UUID) error {
+	_, banned, err := p.convRepo.IsUserMutedOrBanned(conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check moderation: %w", err)
+	}
+	if banned {
+		return ErrBanned
+	}
+	return nil
+}
+
+// CanRead reports whether userID may read a conversation's messages: its
+// members, and in a channel chat everyone, unless banned from it
+func (p *Policy) CanRead(conversationID, userID uuid.UUID) (bool, error) {
+	switch err := p.CanViewChat(conversationID, userID); {
+	case errors.Is(err, ErrBanned):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	isMember, err := p.convRepo.IsMember(conversationID, userID)
+	if err != nil || isMember {
+		return isMember, err
+	}
+	channels, err := p.chRepo.GetByConversationIDs([]uuid.UUID{conversationID})
+	if err != nil {
+		return false, err
+	}
+	_, ok := channels[conversationID]
+	return ok, nil
+}
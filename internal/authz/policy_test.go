@@ -0,0 +1,124 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+func TestMain(m *testing.M) { dbtest.Main(m) }
+
+func TestPolicy(t *testing.T) {
+	db := dbtest.Open(t)
+	users := repository.NewUserRepository(db)
+	channels := repository.NewChannelRepository(db)
+	convs := repository.NewConversationRepository(db)
+	p := NewPolicy(convs, channels)
+
+	now := time.Now()
+	newUser := func(name string) uuid.UUID {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u.ID
+	}
+	owner, mod, vip, muted, banned, stranger := newUser("owner"), newUser("mod"), newUser("vip"), newUser("muted"), newUser("banned"), newUser("stranger")
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner, Slug: "policy", Title: "Policy", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, role := range map[uuid.UUID]string{mod: RoleModerator, vip: RoleVIP, muted: RoleMember, banned: RoleMember} {
+		if err := convs.UpdateMemberRole(convID, id, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := convs.AddModeration(convID, muted, "mute", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.AddModeration(convID, banned, "ban", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user     uuid.UUID
+		manage   bool
+		moderate bool
+		post     error
+	}{
+		{owner, true, true, ErrNotMember},
+		{mod, false, true, nil},
+		{vip, false, false, nil},
+		{muted, false, false, ErrMuted},
+		{banned, false, false, ErrBanned},
+		{stranger, false, false, ErrNotMember},
+	}
+	for i, tt := range tests {
+		if got := p.CanManage(ch, tt.user); got != tt.manage {
+			t.Errorf("%d: CanManage = %v, want %v", i, got, tt.manage)
+		}
+		if got, err := p.CanModerate(ch, tt.user); err != nil || got != tt.moderate {
+			t.Errorf("%d: CanModerate = %v, %v, want %v", i, got, err, tt.moderate)
+		}
+		kind, err := p.CanPost(convID, tt.user)
+		if !errors.Is(err, tt.post) {
+			t.Errorf("%d: CanPost error = %v, want %v", i, err, tt.post)
+		}
+		if err == nil && kind != models.ConversationChannel {
+			t.Errorf("%d: CanPost kind = %q", i, kind)
+		}
+	}
+
+	// Channel chats are open to non-members who are neither muted nor banned
+	if err := p.CanChat(convID, stranger); err != nil {
+		t.Errorf("CanChat(stranger) = %v", err)
+	}
+
+	// Muted users still read along; banned ones don't
+	for user, want := range map[uuid.UUID]error{stranger: nil, muted: nil, banned: ErrBanned} {
+		if err := p.CanViewChat(convID, user); !errors.Is(err, want) {
+			t.Errorf("CanViewChat(%s) = %v, want %v", user, err, want)
+		}
+	}
+	for user, want := range map[uuid.UUID]bool{stranger: true, muted: true, banned: false} {
+		if got, err := p.CanRead(convID, user); err != nil || got != want {
+			t.Errorf("CanRead(%s) = %v, %v, want %v", user, got, err, want)
+		}
+	}
+
+	// Senders may restore what they deleted themselves, not what a
+	// moderator removed; moderators may restore anything
+	own := &models.Message{ConversationID: convID, SenderID: vip, DeletedBy: &vip}
+	removed := &models.Message{ConversationID: convID, SenderID: vip, DeletedBy: &mod}
+	for _, tt := range []struct {
+		msg  *models.Message
+		user uuid.UUID
+		want bool
+	}{
+		{own, vip, true},
+		{removed, vip, false},
+		{removed, mod, true},
+		{own, stranger, false},
+	} {
+		if got, err := p.CanRestoreMessage(tt.msg, tt.user); err != nil || got != tt.want {
+			t.Errorf("CanRestoreMessage(deleted by %s, %s) = %v, %v, want %v", *tt.msg.DeletedBy, tt.user, got, err, tt.want)
+		}
+	}
+
+	// The channel's report queue is for its moderators
+	for user, want := range map[uuid.UUID]bool{owner: true, mod: true, vip: false, stranger: false} {
+		if got, err := p.CanReviewReports(convID, user); err != nil || got != want {
+			t.Errorf("CanReviewReports(%s) = %v, %v, want %v", user, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package botscore rates how much a user's recent chat messages look like
+// they come from a bot. Three signals go into a score from 0 (human) to 1
+// (bot): messages with little variety in their characters, messages sent at
+// clockwork intervals, and the same message posted to several chats.
+package botscore
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Weights of the signals in Score.Score; they add up to 1
+const (
+	weightDuplicates = 0.45
+	weightRegularity = 0.35
+	weightEntropy    = 0.2
+)
+
+const (
+	// minRunes is the length from which a message counts for the entropy
+	// and duplicate signals; "lol" and "gg" say nothing about the sender
+	minRunes = 8
+	// lowEntropy is the bits per character below which a message looks
+	// generated, such as "aaaaaaaa" or "!!!!!!!!"; chat in any language
+	// has 3 to 4.5
+	lowEntropy = 3.0
+	// minIntervals is the number of gaps between messages needed to judge
+	// their timing
+	minIntervals = 3
+	// humanVariation is the coefficient of variation of the gaps from which
+	// sending counts as irregular, as people's is
+	humanVariation = 0.5
+)
+
+// Sample is one message a user sent
+type Sample struct {
+	ConversationID uuid.UUID
+	Body           string
+	At             time.Time
+}
+
+// Score is the result of Rate
+type Score struct {
+	// Score is the overall suspicion, from 0 to 1
+	Score float64
+	// Entropy is the mean bits per character of the messages long enough to
+	// tell, 0 if there were none
+	Entropy float64
+	// Regularity is how evenly spaced the messages were, from 0 (as people
+	// type) to 1 (on a timer)
+	Regularity float64
+	// Duplicates is the share of messages also posted to another chat
+	Duplicates float64
+	// Messages is the number of samples rated
+	Messages int
+}
+
+// Rate scores a user's recent messages
+func Rate(samples []Sample) Score {
+	s := Score{Messages: len(samples)}
+	if len(samples) == 0 {
+		return s
+	}
+
+	var bits, lowness float64
+	long := 0
+	chats := map[string]map[uuid.UUID]struct{}{}
+	for _, m := range samples {
+		if utf8.RuneCountInString(m.Body) < minRunes {
+			continue
+		}
+		long++
+		h := Entropy(m.Body)
+		bits += h
+		lowness += clamp((lowEntropy - h) / lowEntropy)
+
+		key := normalize(m.Body)
+		if chats[key] == nil {
+			chats[key] = map[uuid.UUID]struct{}{}
+		}
+		chats[key][m.ConversationID] = struct{}{}
+	}
+	if long > 0 {
+		s.Entropy = bits / float64(long)
+		lowness /= float64(long)
+
+		dup := 0
+		for _, m := range samples {
+			if utf8.RuneCountInString(m.Body) >= minRunes && len(chats[normalize(m.Body)]) > 1 {
+				dup++
+			}
+		}
+		s.Duplicates = float64(dup) / float64(len(samples))
+	}
+
+	s.Regularity = regularity(samples)
+	s.Score = weightDuplicates*s.Duplicates + weightRegularity*s.Regularity + weightEntropy*lowness
+	return s
+}
+
+// Entropy is the Shannon entropy of s in bits per character
+func Entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// regularity rates the gaps between messages: 1 when they are all the same
+// length, falling to 0 at humanVariation
+func regularity(samples []Sample) float64 {
+	if len(samples) < minIntervals+1 {
+		return 0
+	}
+	at := make([]time.Time, len(samples))
+	for i, m := range samples {
+		at[i] = m.At
+	}
+	sort.Slice(at, func(i, j int) bool { return at[i].Before(at[j]) })
+
+	gaps := make([]float64, len(at)-1)
+	var mean float64
+	for i := range gaps {
+		gaps[i] = at[i+1].Sub(at[i]).Seconds()
+		mean += gaps[i]
+	}
+	mean /= float64(len(gaps))
+	if mean <= 0 {
+		return 0
+	}
+	var variance float64
+	for _, g := range gaps {
+		variance += (g - mean) * (g - mean)
+	}
+	cv := math.Sqrt(variance/float64(len(gaps))) / mean
+	return clamp(1 - cv/humanVariation)
+}
+
+// normalize makes messages differing in case and spacing only equal
+func normalize(body string) string {
+	return strings.Join(strings.Fields(strings.ToLower(body)), " ")
+}
+
+func clamp(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
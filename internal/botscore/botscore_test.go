@@ -0,0 +1,72 @@
+package botscore
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"", 0},
+		{"aaaaaaaa", 0},
+		{"abababab", 1},
+		{"abcdabcd", 2},
+	}
+	for _, tt := range tests {
+		if got := Entropy(tt.s); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Entropy(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestRate(t *testing.T) {
+	start := time.Date(2025, 10, 25, 12, 0, 0, 0, time.UTC)
+	chatA, chatB, chatC := uuid.New(), uuid.New(), uuid.New()
+
+	// Someone chatting: varied text, irregular gaps, one chat
+	human := []Sample{
+		{chatA, "anyone else hear that sound at the start?", start},
+		{chatA, "lol", start.Add(4 * time.Second)},
+		{chatA, "that boss fight was brutal", start.Add(50 * time.Second)},
+		{chatA, "gg", start.Add(62 * time.Second)},
+		{chatA, "when is the next stream scheduled?", start.Add(3 * time.Minute)},
+	}
+	// A spam bot: the same link every 30 seconds in three chats
+	var bot []Sample
+	for i, chat := range []uuid.UUID{chatA, chatB, chatC, chatA, chatB, chatC} {
+		bot = append(bot, Sample{chat, "Get followers at cheap-follows.example", start.Add(time.Duration(i) * 30 * time.Second)})
+	}
+
+	h := Rate(human)
+	if h.Score > 0.2 || h.Duplicates != 0 {
+		t.Errorf("human rated %+v, want a low score without duplicates", h)
+	}
+	b := Rate(bot)
+	if b.Score < 0.75 || b.Duplicates != 1 || b.Regularity != 1 {
+		t.Errorf("bot rated %+v, want a high score with all duplicates and full regularity", b)
+	}
+	if b.Messages != 6 {
+		t.Errorf("bot Messages = %d, want 6", b.Messages)
+	}
+
+	// Repeating a message in the same chat is not a cross-chat duplicate,
+	// and short messages never are
+	same := []Sample{{chatA, "same text here", start}, {chatA, "Same  text here", start.Add(time.Second)}, {chatA, "hi", start}, {chatB, "hi", start}}
+	if s := Rate(same); s.Duplicates != 0 {
+		t.Errorf("Duplicates = %v for one chat and short messages, want 0", s.Duplicates)
+	}
+
+	// Low entropy counts for messages long enough to tell
+	if s := Rate([]Sample{{chatA, "aaaaaaaaaaaa", start}}); math.Abs(s.Score-weightEntropy) > 1e-9 {
+		t.Errorf("Score = %v for a single repeated character, want %v", s.Score, weightEntropy)
+	}
+	if s := Rate(nil); s != (Score{}) {
+		t.Errorf("Rate(nil) = %+v", s)
+	}
+}
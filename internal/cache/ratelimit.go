@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"math"
+	"time"
+)
+
+// LimitResult describes a token-bucket decision and the caller's remaining quota
+type LimitResult struct {
+	Allowed bool
+	// Limit is the bucket capacity (burst)
+	Limit int
+	// Remaining is the number of whole tokens left after this request
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed (zero if allowed)
+	RetryAfter time.Duration
+}
+
+// NewLimitResult derives quota fields from the tokens left in a bucket that
+// refills at rate tokens per second up to burst
+func NewLimitResult(allowed bool, tokens, rate float64, burst int) LimitResult {
+	if tokens < 0 {
+		tokens = 0
+	}
+	res := LimitResult{
+		Allowed:   allowed,
+		Limit:     burst,
+		Remaining: int(math.Floor(tokens)),
+	}
+	if rate > 0 {
+		res.Reset = secondsToDuration((float64(burst) - tokens) / rate)
+		if !allowed {
+			res.RetryAfter = secondsToDuration((1 - tokens) / rate)
+		}
+	}
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// minBucketTTL keeps fast buckets in Redis for at least a minute
+const minBucketTTL = time.Minute
+
+// bucketTTL is how long a bucket refilling at rate tokens per second up to
+// burst must outlive its last use. It takes that long to refill from empty,
+// so expiring it any sooner would hand back a full bucket early.
+func bucketTTL(rate float64, burst int) time.Duration {
+	if rate <= 0 {
+		return minBucketTTL
+	}
+	ttl := time.Duration(math.Ceil(float64(burst)/rate)) * time.Second
+	if ttl < minBucketTTL {
+		return minBucketTTL
+	}
+	return ttl
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTTLOutlivesRefill(t *testing.T) {
+	tests := map[string]struct {
+		rate  float64
+		burst int
+	}{
+		"channel create": {0.01, 3},
+		"auth":           {0.2, 5},
+		"fast":           {10, 20},
+		"fraction":       {0.3, 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ttl := bucketTTL(tt.rate, tt.burst)
+			// a drained bucket left idle must still be there, and so still
+			// drained, until it would have refilled on its own
+			drained := NewLimitResult(false, 0, tt.rate, tt.burst)
+			if ttl < drained.Reset {
+				t.Errorf("ttl %v expires the bucket %v before it refills", ttl, drained.Reset-ttl)
+			}
+			if ttl < time.Minute {
+				t.Errorf("ttl %v, want at least a minute", ttl)
+			}
+		})
+	}
+
+	if got := bucketTTL(0.01, 3); got != 300*time.Second {
+		t.Errorf("bucketTTL(0.01, 3) = %v, want 5m0s", got)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,16 +15,22 @@ import (
 )
 
 type RedisClient struct {
-	client *redis.Client
-	ctx    context.Context
+	client   *redis.Client
+	ctx      context.Context
+	password atomic.Pointer[string]
 }
 
 // NewRedisClient creates a new Redis client
 func NewRedisClient(addr, password string, db int) (*RedisClient, error) {
+	r := &RedisClient{}
+	r.password.Store(&password)
 	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
+		Addr: addr,
+		DB:   db,
+		// Read on every new connection so SetPassword takes effect without a restart
+		CredentialsProvider: func() (string, string) {
+			return "", *r.password.Load()
+		},
 	})
 
 	ctx := context.Background()
@@ -31,10 +40,20 @@ func NewRedisClient(addr, password string, db int) (*RedisClient, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &RedisClient{
-		client: client,
-		ctx:    ctx,
-	}, nil
+	r.client = client
+	r.ctx = ctx
+	return r, nil
+}
+
+// SetPassword makes new connections authenticate with password; open
+// connections stay authenticated
+func (r *RedisClient) SetPassword(password string) {
+	r.password.Store(&password)
+}
+
+// Ping checks that Redis is reachable
+func (r *RedisClient) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
 }
 
 // Close closes the Redis connection
@@ -103,16 +122,57 @@ func (r *RedisClient) GetUserPresence(userID uuid.UUID) (*models.UserPresence, e
 
 // Typing Indicators
 
+// typingSeenKey is a sorted set of "<conversation>:<user>" scored by when the
+// user last started typing, so SweepTyping can find entries whose stop event
+// never arrived (e.g. the client disconnected)
+const typingSeenKey = "typing_seen"
+
 // SetTyping sets a user as typing in a conversation
 func (r *RedisClient) SetTyping(conversationID, userID uuid.UUID) error {
 	key := fmt.Sprintf("typing:%s", conversationID.String())
-	return r.client.SAdd(r.ctx, key, userID.String()).Err()
+	pipe := r.client.TxPipeline()
+	pipe.SAdd(r.ctx, key, userID.String())
+	pipe.ZAdd(r.ctx, typingSeenKey, redis.Z{Score: float64(time.Now().Unix()), Member: conversationID.String() + ":" + userID.String()})
+	_, err := pipe.Exec(r.ctx)
+	return err
 }
 
 // RemoveTyping removes a user from typing in a conversation
 func (r *RedisClient) RemoveTyping(conversationID, userID uuid.UUID) error {
 	key := fmt.Sprintf("typing:%s", conversationID.String())
-	return r.client.SRem(r.ctx, key, userID.String()).Err()
+	pipe := r.client.TxPipeline()
+	pipe.SRem(r.ctx, key, userID.String())
+	pipe.ZRem(r.ctx, typingSeenKey, conversationID.String()+":"+userID.String())
+	_, err := pipe.Exec(r.ctx)
+	return err
+}
+
+// SweepTyping removes users who started typing before cutoff and never
+// stopped, returning how many were removed
+func (r *RedisClient) SweepTyping(cutoff time.Time) (int, error) {
+	stale, err := r.client.ZRangeByScore(r.ctx, typingSeenKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	pipe := r.client.TxPipeline()
+	for _, entry := range stale {
+		conv, user, ok := strings.Cut(entry, ":")
+		if ok {
+			pipe.SRem(r.ctx, "typing:"+conv, user)
+		}
+		pipe.ZRem(r.ctx, typingSeenKey, entry)
+	}
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return 0, err
+	}
+	return len(stale), nil
 }
 
 // GetTypingUsers gets all users typing in a conversation
@@ -135,6 +195,293 @@ func (r *RedisClient) GetTypingUsers(conversationID uuid.UUID) ([]uuid.UUID, err
 	return userIDs, nil
 }
 
+// Channel Viewers
+
+// ViewerWindow is how recently a user must have loaded a channel's chat, or
+// their player sent a heartbeat, to count as watching it
+const ViewerWindow = 2 * time.Minute
+
+// TouchViewer records that userID is watching channelID now. Each channel's
+// viewers are a sorted set scored by when they were last seen.
+func (r *RedisClient) TouchViewer(channelID, userID uuid.UUID) error {
+	key := fmt.Sprintf("viewers:%s", channelID.String())
+	now := time.Now()
+	pipe := r.client.TxPipeline()
+	pipe.ZAdd(r.ctx, key, redis.Z{Score: float64(now.Unix()), Member: userID.String()})
+	pipe.ZRemRangeByScore(r.ctx, key, "-inf", strconv.FormatInt(now.Add(-ViewerWindow).Unix(), 10))
+	pipe.Expire(r.ctx, key, ViewerWindow)
+	_, err := pipe.Exec(r.ctx)
+	return err
+}
+
+// CountViewers returns how many users watched each channel within
+// ViewerWindow, in one round trip. Channels without viewers are absent.
+func (r *RedisClient) CountViewers(channelIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return counts, nil
+	}
+
+	min := strconv.FormatInt(time.Now().Add(-ViewerWindow).Unix(), 10)
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(channelIDs))
+	for i, id := range channelIDs {
+		cmds[i] = pipe.ZCount(r.ctx, fmt.Sprintf("viewers:%s", id.String()), min, "+inf")
+	}
+	if _, err := pipe.Exec(r.ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		if n := cmd.Val(); n > 0 {
+			counts[channelIDs[i]] = int(n)
+		}
+	}
+	return counts, nil
+}
+
+// Chat Viewers
+
+// chatViewersKey maps channel ID to how many distinct users have the
+// channel's chat open over WebSocket. Per-channel hashes under
+// "chat_viewers:<channel>" count each user's open connections, so a user with
+// several tabs is one viewer.
+const chatViewersKey = "chat_viewers"
+
+// joinChatScript counts a new connection of ARGV[1] to channel ARGV[2] and
+// returns the channel's viewers
+var joinChatScript = redis.NewScript(`
+if redis.call("HINCRBY", KEYS[1], ARGV[1], 1) == 1 then
+	return redis.call("HINCRBY", KEYS[2], ARGV[2], 1)
+end
+return tonumber(redis.call("HGET", KEYS[2], ARGV[2]) or "0")
+`)
+
+// leaveChatScript is the inverse of joinChatScript. Counts never go below
+// zero, so a leave without a matching join is harmless.
+var leaveChatScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return tonumber(redis.call("HGET", KEYS[2], ARGV[2]) or "0")
+end
+if redis.call("HINCRBY", KEYS[1], ARGV[1], -1) > 0 then
+	return tonumber(redis.call("HGET", KEYS[2], ARGV[2]) or "0")
+end
+redis.call("HDEL", KEYS[1], ARGV[1])
+local n = redis.call("HINCRBY", KEYS[2], ARGV[2], -1)
+if n <= 0 then
+	redis.call("HDEL", KEYS[2], ARGV[2])
+	return 0
+end
+return n
+`)
+
+// JoinChat records that userID opened channelID's chat and returns the
+// channel's chat viewers
+func (r *RedisClient) JoinChat(channelID, userID uuid.UUID) (int, error) {
+	keys := []string{"chat_viewers:" + channelID.String(), chatViewersKey}
+	return joinChatScript.Run(r.ctx, r.client, keys, userID.String(), channelID.String()).Int()
+}
+
+// LeaveChat records that one of userID's connections left channelID's chat
+// and returns the channel's chat viewers
+func (r *RedisClient) LeaveChat(channelID, userID uuid.UUID) (int, error) {
+	keys := []string{"chat_viewers:" + channelID.String(), chatViewersKey}
+	return leaveChatScript.Run(r.ctx, r.client, keys, userID.String(), channelID.String()).Int()
+}
+
+// ChatViewers returns the chat viewers of each channel. Channels nobody is
+// watching are absent.
+func (r *RedisClient) ChatViewers(channelIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return counts, nil
+	}
+	fields := make([]string, len(channelIDs))
+	for i, id := range channelIDs {
+		fields[i] = id.String()
+	}
+	vals, err := r.client.HMGet(r.ctx, chatViewersKey, fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			counts[channelIDs[i]] = n
+		}
+	}
+	return counts, nil
+}
+
+// Chat Stats
+
+// ChatStatsWindows are the rolling windows chat throughput is reported over
+var ChatStatsWindows = []time.Duration{time.Minute, 5 * time.Minute}
+
+// Chat activity is counted per conversation in chatStatsBucket wide buckets:
+// a hash "chat_stats:<conversation>:<bucket>" with the fields "messages" and
+// "automod", and a HyperLogLog of the senders under the same key plus
+// ":chatters". Buckets outlive the longest window by one bucket. The sorted
+// set chatStatsActiveKey scores conversations by their last activity.
+const (
+	chatStatsBucket    = 10 * time.Second
+	chatStatsRetention = 5*time.Minute + chatStatsBucket
+	chatStatsActiveKey = "chat_stats:active"
+)
+
+func chatStatsKey(conversationID uuid.UUID, bucket int64) string {
+	return fmt.Sprintf("chat_stats:%s:%d", conversationID.String(), bucket)
+}
+
+func chatStatsBucketOf(t time.Time) int64 {
+	return t.Unix() / int64(chatStatsBucket/time.Second)
+}
+
+// RecordChatMessage counts a message sent by senderID in a conversation
+func (r *RedisClient) RecordChatMessage(conversationID, senderID uuid.UUID) error {
+	now := time.Now()
+	key := chatStatsKey(conversationID, chatStatsBucketOf(now))
+	pipe := r.client.Pipeline()
+	pipe.HIncrBy(r.ctx, key, "messages", 1)
+	pipe.Expire(r.ctx, key, chatStatsRetention)
+	pipe.PFAdd(r.ctx, key+":chatters", senderID.String())
+	pipe.Expire(r.ctx, key+":chatters", chatStatsRetention)
+	pipe.ZAdd(r.ctx, chatStatsActiveKey, redis.Z{Score: float64(now.Unix()), Member: conversationID.String()})
+	_, err := pipe.Exec(r.ctx)
+	return err
+}
+
+// RecordAutomodAction counts a message the moderation bot acted on
+func (r *RedisClient) RecordAutomodAction(conversationID uuid.UUID) error {
+	now := time.Now()
+	key := chatStatsKey(conversationID, chatStatsBucketOf(now))
+	pipe := r.client.Pipeline()
+	pipe.HIncrBy(r.ctx, key, "automod", 1)
+	pipe.Expire(r.ctx, key, chatStatsRetention)
+	pipe.ZAdd(r.ctx, chatStatsActiveKey, redis.Z{Score: float64(now.Unix()), Member: conversationID.String()})
+	_, err := pipe.Exec(r.ctx)
+	return err
+}
+
+// followDeltasKey counts follows per channel not yet announced in aggregate
+const followDeltasKey = "follow_deltas"
+
+// AddFollowDelta counts a follow of channelID for the next aggregated
+// channel.followed event
+func (r *RedisClient) AddFollowDelta(channelID uuid.UUID) error {
+	return r.client.HIncrBy(r.ctx, followDeltasKey, channelID.String(), 1).Err()
+}
+
+// TakeFollowDeltas returns and resets the follows counted by AddFollowDelta
+// since the last call
+func (r *RedisClient) TakeFollowDeltas() (map[uuid.UUID]int, error) {
+	pipe := r.client.TxPipeline()
+	all := pipe.HGetAll(r.ctx, followDeltasKey)
+	pipe.Del(r.ctx, followDeltasKey)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return nil, err
+	}
+	deltas := make(map[uuid.UUID]int, len(all.Val()))
+	for field, v := range all.Val() {
+		id, err := uuid.Parse(field)
+		if err != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			deltas[id] = n
+		}
+	}
+	return deltas, nil
+}
+
+// ActiveChats returns the conversations with activity within the longest of
+// ChatStatsWindows, dropping the ones that went quiet
+func (r *RedisClient) ActiveChats() ([]uuid.UUID, error) {
+	cutoff := time.Now().Add(-ChatStatsWindows[len(ChatStatsWindows)-1]).Unix()
+	pipe := r.client.TxPipeline()
+	pipe.ZRemRangeByScore(r.ctx, chatStatsActiveKey, "-inf", "("+strconv.FormatInt(cutoff, 10))
+	members := pipe.ZRange(r.ctx, chatStatsActiveKey, 0, -1)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(members.Val()))
+	for _, m := range members.Val() {
+		if id, err := uuid.Parse(m); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// ChatStats returns the throughput of each conversation over each of
+// ChatStatsWindows, in one round trip. Windows end with the current,
+// partly filled bucket.
+func (r *RedisClient) ChatStats(conversationIDs []uuid.UUID) (map[uuid.UUID][]models.ChatThroughput, error) {
+	stats := make(map[uuid.UUID][]models.ChatThroughput, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return stats, nil
+	}
+
+	current := chatStatsBucketOf(time.Now())
+	longest := int(ChatStatsWindows[len(ChatStatsWindows)-1] / chatStatsBucket)
+	pipe := r.client.Pipeline()
+	counts := make([][]*redis.SliceCmd, len(conversationIDs))
+	chatters := make([][]*redis.IntCmd, len(conversationIDs))
+	for i, id := range conversationIDs {
+		// counts[i][j] is the bucket j buckets before the current one
+		counts[i] = make([]*redis.SliceCmd, longest)
+		for j := range counts[i] {
+			counts[i][j] = pipe.HMGet(r.ctx, chatStatsKey(id, current-int64(j)), "messages", "automod")
+		}
+		chatters[i] = make([]*redis.IntCmd, len(ChatStatsWindows))
+		for w, window := range ChatStatsWindows {
+			keys := make([]string, int(window/chatStatsBucket))
+			for j := range keys {
+				keys[j] = chatStatsKey(id, current-int64(j)) + ":chatters"
+			}
+			chatters[i][w] = pipe.PFCount(r.ctx, keys...)
+		}
+	}
+	if _, err := pipe.Exec(r.ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, id := range conversationIDs {
+		windows := make([]models.ChatThroughput, len(ChatStatsWindows))
+		for w, window := range ChatStatsWindows {
+			var messages, automod int64
+			for _, cmd := range counts[i][:int(window/chatStatsBucket)] {
+				vals := cmd.Val()
+				if len(vals) != 2 {
+					continue
+				}
+				messages += parseCount(vals[0])
+				automod += parseCount(vals[1])
+			}
+			windows[w] = models.ChatThroughput{
+				WindowSeconds:        int(window / time.Second),
+				MessagesPerSec:       float64(messages) / window.Seconds(),
+				AutomodActionsPerSec: float64(automod) / window.Seconds(),
+				UniqueChatters:       int(chatters[i][w].Val()),
+			}
+		}
+		stats[id] = windows
+	}
+	return stats, nil
+}
+
+// parseCount reads a hash field returned by HMGET; missing fields count as 0
+func parseCount(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
 // Pub/Sub
 
 // PublishMessage publishes a message to the messages channel
@@ -187,16 +534,17 @@ func (r *RedisClient) GetClient() *redis.Client {
 	return r.client
 }
 
-// AllowAction implements a Redis-backed token-bucket limiter per key (user+action).
-// Returns true if the action is allowed, false if rate-limited.
-func (r *RedisClient) AllowAction(userID uuid.UUID, action string, rate int, burst int) (bool, error) {
-	key := fmt.Sprintf("rl:%s:%s", action, userID.String())
+// AllowKey runs the token-bucket limiter for an arbitrary key, refilling at
+// rate tokens per second up to burst. The key expires once an idle bucket
+// would have refilled anyway (see bucketTTL).
+func (r *RedisClient) AllowKey(key string, rate float64, burst int) (LimitResult, error) {
 	// Lua script: manage tokens and last timestamp
 	script := `
 local key = KEYS[1]
 local rate = tonumber(ARGV[1])
 local burst = tonumber(ARGV[2])
 local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
 local vals = redis.call('HMGET', key, 'tokens', 'last')
 local tokens = tonumber(vals[1])
 local last = tonumber(vals[2])
@@ -207,27 +555,128 @@ local new_tokens = math.min(burst, tokens + (delta * rate / 1000))
 if new_tokens >= 1 then
 	new_tokens = new_tokens - 1
 	redis.call('HMSET', key, 'tokens', new_tokens, 'last', now)
-	redis.call('PEXPIRE', key, 60000)
-	return 1
+	redis.call('PEXPIRE', key, ttl)
+	return {1, tostring(new_tokens)}
 else
 	redis.call('HMSET', key, 'tokens', new_tokens, 'last', now)
-	redis.call('PEXPIRE', key, 60000)
-	return 0
+	redis.call('PEXPIRE', key, ttl)
+	return {0, tostring(new_tokens)}
 end
 `
 
 	now := time.Now().UnixNano() / int64(time.Millisecond)
-	res, err := r.client.Eval(r.ctx, script, []string{key}, rate, burst, now).Result()
+	ttl := bucketTTL(rate, burst).Milliseconds()
+	res, err := r.client.Eval(r.ctx, script, []string{key}, rate, burst, now, ttl).Slice()
+	if err != nil {
+		return LimitResult{}, err
+	}
+	// Eval returns {allowed (0/1), tokens left as a string}; Lua numbers would be truncated
+	if len(res) != 2 {
+		return LimitResult{}, fmt.Errorf("unexpected result from rate limiter: %v", res)
+	}
+	allowed, ok := res[0].(int64)
+	tokensStr, ok2 := res[1].(string)
+	if !ok || !ok2 {
+		return LimitResult{}, fmt.Errorf("unexpected result from rate limiter: %T %T", res[0], res[1])
+	}
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
 	if err != nil {
-		return false, err
+		return LimitResult{}, fmt.Errorf("unexpected token count from rate limiter: %w", err)
 	}
-	// Eval returns int64 (1 or 0)
-	switch v := res.(type) {
-	case int64:
-		return v == 1, nil
-	case int:
-		return v == 1, nil
-	default:
-		return false, fmt.Errorf("unexpected result from rate limiter: %T %v", res, res)
+	return NewLimitResult(allowed == 1, tokens, rate, burst), nil
+}
+
+// IncrWindow increments a counter that expires window after its first increment
+func (r *RedisClient) IncrWindow(key string, window time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(r.ctx, key)
+	pipe.ExpireNX(r.ctx, key, window)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// IncrExpire increments a counter that expires ttl after its latest increment
+func (r *RedisClient) IncrExpire(key string, ttl time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(r.ctx, key)
+	pipe.Expire(r.ctx, key, ttl)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// SetFlag sets key for ttl; used for temporary blocks
+func (r *RedisClient) SetFlag(key string, ttl time.Duration) error {
+	return r.client.Set(r.ctx, key, 1, ttl).Err()
+}
+
+// SetFlagNX sets key for ttl unless it is already set, and reports whether it did
+func (r *RedisClient) SetFlagNX(key string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(r.ctx, key, 1, ttl).Result()
+}
+
+// FlagTTL returns the remaining lifetime of a flag set with SetFlag, or 0 if it is not set
+func (r *RedisClient) FlagTTL(key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(r.ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// GetString returns the value stored at key, or "" if it is not set
+func (r *RedisClient) GetString(key string) (string, error) {
+	val, err := r.client.Get(r.ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
 	}
+	return val, err
+}
+
+// SetString stores value at key for ttl
+func (r *RedisClient) SetString(key, value string, ttl time.Duration) error {
+	return r.client.Set(r.ctx, key, value, ttl).Err()
+}
+
+// Delete removes keys
+func (r *RedisClient) Delete(keys ...string) error {
+	return r.client.Del(r.ctx, keys...).Err()
+}
+
+// renewLockScript extends a lock's TTL only if it is still held by the caller
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes a lock only if it is still held by the caller
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock takes key for owner if nobody holds it, expiring after ttl
+func (r *RedisClient) AcquireLock(key, owner string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(r.ctx, key, owner, ttl).Result()
+}
+
+// RenewLock extends key by ttl if owner still holds it; false means the lock was lost
+func (r *RedisClient) RenewLock(key, owner string, ttl time.Duration) (bool, error) {
+	n, err := renewLockScript.Run(r.ctx, r.client, []string{key}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// ReleaseLock removes key if owner holds it
+func (r *RedisClient) ReleaseLock(key, owner string) error {
+	return releaseLockScript.Run(r.ctx, r.client, []string{key}, owner).Err()
 }
@@ -0,0 +1,158 @@
+// Package dbtest gives integration tests a migrated Postgres database without
+// a provisioned server. It uses TEST_DATABASE_URL when set; otherwise, in
+// binaries built with -tags embedpg, it starts an embedded Postgres shared by
+// the test binary. With neither, tests that need a database are skipped.
+//
+// Packages using it call Main from TestMain so the embedded server is stopped
+// afterwards. Every Open empties the application tables, so tests in one
+// package must not use the database in parallel; run `go test -p 1` when
+// several packages share TEST_DATABASE_URL.
+package dbtest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+)
+
+var (
+	once    sync.Once
+	shared  *database.DB
+	skip    string
+	initErr error
+	// cleanup stops the embedded server and removes its directory
+	cleanup func()
+)
+
+// Main runs the package's tests and then shuts down the embedded server, if
+// one was started:
+//
+//	func TestMain(m *testing.M) { dbtest.Main(m) }
+func Main(m *testing.M) {
+	code := m.Run()
+	if shared != nil {
+		shared.Close()
+	}
+	if cleanup != nil {
+		cleanup()
+	}
+	os.Exit(code)
+}
+
+// Open returns the shared test database with all migrations applied and no
+// application rows
+func Open(t testing.TB) *database.DB {
+	t.Helper()
+	once.Do(setup)
+	if skip != "" {
+		t.Skip(skip)
+	}
+	if initErr != nil {
+		t.Fatalf("test database: %v", initErr)
+	}
+	if err := truncate(shared); err != nil {
+		t.Fatalf("test database: %v", err)
+	}
+	return shared
+}
+
+func setup() {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		if !database.EmbeddedAvailable {
+			skip = "no test database: set TEST_DATABASE_URL or run with -tags embedpg"
+			return
+		}
+		dsn, initErr = startEmbedded()
+		if initErr != nil {
+			return
+		}
+	}
+
+	shared, initErr = database.NewPostgresDB(dsn)
+	if initErr != nil {
+		return
+	}
+	if initErr = database.RunMigrations(shared); initErr != nil {
+		return
+	}
+	initErr = shared.PrepareStatements()
+}
+
+// startEmbedded runs a throwaway server in a temporary directory; only the
+// download is kept across runs
+func startEmbedded() (string, error) {
+	dir, err := os.MkdirTemp("", "tullo-dbtest-")
+	if err != nil {
+		return "", err
+	}
+	cacheDir := ""
+	if userCache, err := os.UserCacheDir(); err == nil {
+		cacheDir = filepath.Join(userCache, "tullo", "embedded-postgres")
+	}
+	port, err := freePort()
+	if err != nil {
+		return "", err
+	}
+
+	opts := database.EmbeddedOptions{
+		Dir:      dir,
+		CacheDir: cacheDir,
+		Port:     port,
+		User:     "postgres",
+		Password: "postgres",
+		Database: "tullo_test",
+	}
+	stop, err := database.StartEmbedded(opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	cleanup = func() {
+		_ = stop()
+		os.RemoveAll(dir)
+	}
+	return fmt.Sprintf("host=localhost port=%d user=%s password=%s dbname=%s sslmode=disable",
+		opts.Port, opts.User, opts.Password, opts.Database), nil
+}
+
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer l.Close()
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+// truncate empties every table except the migration bookkeeping
+func truncate(db *database.DB) error {
+	rows, err := db.Query(`SELECT tablename FROM pg_tables WHERE schemaname = 'public' AND tablename <> 'schema_migrations'`)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables = append(tables, pgx.Identifier{name}.Sanitize())
+	}
+	rows.Close()
+	if len(tables) == 0 {
+		return nil
+	}
+	if _, err := db.Exec(`TRUNCATE ` + strings.Join(tables, ", ") + ` CASCADE`); err != nil {
+		return fmt.Errorf("failed to empty tables: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"errors"
+	"io"
+)
+
+// EmbeddedOptions configures a Postgres server run by the application itself
+// for local development and tests
+type EmbeddedOptions struct {
+	// Dir holds the downloaded binaries, the data directory and the server
+	// log; the data survives restarts
+	Dir string
+	// CacheDir keeps the downloaded Postgres archive; defaults to Dir/cache
+	CacheDir string
+	Port     uint32
+	User     string
+	Password string
+	Database string
+	// Logger receives the server's output; nil discards it
+	Logger io.Writer
+}
+
+// ErrEmbeddedUnavailable is returned by StartEmbedded in binaries built
+// without the embedpg tag
+var ErrEmbeddedUnavailable = errors.New("embedded Postgres is not compiled in; rebuild with -tags embedpg")
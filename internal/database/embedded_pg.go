@@ -0,0 +1,107 @@
+//go:build embedpg
+
+package database
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// EmbeddedAvailable reports whether StartEmbedded can run a server
+const EmbeddedAvailable = true
+
+// StartEmbedded downloads (once, into opts.Dir) and starts a Postgres 15
+// server, creating the database on first use. The returned stop function
+// shuts it down. If another live process already started it, that server is
+// shared and stop does nothing; if a process exited without stopping it, the
+// next StartEmbedded stops the leftover first.
+func StartEmbedded(opts EmbeddedOptions) (func() error, error) {
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve embedded Postgres directory: %w", err)
+	}
+	runtime := filepath.Join(dir, "runtime")
+	data := filepath.Join(dir, "data")
+	ownerFile := filepath.Join(dir, "owner.pid")
+
+	// Another live process (e.g. the server while running migrate or seed)
+	// already runs it: share that server rather than stopping it
+	if pid, ok := readOwner(ownerFile); ok && processAlive(pid) {
+		return func() error { return nil }, nil
+	}
+	stopLeftover(runtime, data)
+
+	cache := opts.CacheDir
+	if cache == "" {
+		cache = filepath.Join(dir, "cache")
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = io.Discard
+	}
+	pg := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V15).
+		Port(opts.Port).
+		Username(opts.User).
+		Password(opts.Password).
+		Database(opts.Database).
+		CachePath(cache).
+		RuntimePath(runtime).
+		DataPath(data).
+		StartTimeout(60 * time.Second).
+		Logger(logger))
+
+	if err := pg.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start embedded Postgres: %w", err)
+	}
+	if err := os.WriteFile(ownerFile, []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+		_ = pg.Stop()
+		return nil, fmt.Errorf("failed to write %s: %w", ownerFile, err)
+	}
+	return func() error {
+		os.Remove(ownerFile)
+		return pg.Stop()
+	}, nil
+}
+
+func readOwner(path string) (int, bool) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	return pid, err == nil
+}
+
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// stopLeftover stops a server left running by a process that exited without
+// stopping it, which would otherwise hold the port
+func stopLeftover(runtime, data string) {
+	if _, err := os.Stat(filepath.Join(data, "postmaster.pid")); err != nil {
+		return
+	}
+	pgCtl := filepath.Join(runtime, "bin", "pg_ctl")
+	if _, err := os.Stat(pgCtl); err != nil {
+		return
+	}
+	_ = exec.Command(pgCtl, "stop", "-D", data, "-m", "fast", "-w").Run()
+}
@@ -0,0 +1,11 @@
+//go:build !embedpg
+
+package database
+
+// EmbeddedAvailable reports whether StartEmbedded can run a server
+const EmbeddedAvailable = false
+
+// StartEmbedded always fails; build with -tags embedpg to enable it
+func StartEmbedded(opts EmbeddedOptions) (func() error, error) {
+	return nil, ErrEmbeddedUnavailable
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tullo/backend/internal/metrics"
+)
+
+var (
+	queryDuration = metrics.Default.NewHistogramVec(
+		"tullo_db_query_duration_seconds",
+		"Duration of database queries by query name.",
+		nil,
+		"query",
+	)
+	queryErrors = metrics.Default.NewCounterVec(
+		"tullo_db_query_errors_total",
+		"Database queries that returned an error, by query name.",
+		"query",
+	)
+	queryRows = metrics.Default.NewCounterVec(
+		"tullo_db_query_rows_total",
+		"Rows returned or affected by database queries, by query name.",
+		"query",
+	)
+)
+
+// SetSlowQueryThreshold sets the duration above which queries are logged; zero disables logging
+func (db *DB) SetSlowQueryThreshold(d time.Duration) {
+	db.slowThreshold = d
+}
+
+// Query runs a query returning rows; metrics are recorded when the rows are closed
+func (db *DB) Query(query string, args ...any) (pgx.Rows, error) {
+	name := callerName()
+	start := time.Now()
+	rows, err := db.Pool.Query(context.Background(), query, args...)
+	if err != nil {
+		db.observe(name, query, start, err, -1)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, db: db, name: name, query: query, start: start}, nil
+}
+
+// QueryRow runs a query returning at most one row; metrics are recorded on Scan
+func (db *DB) QueryRow(query string, args ...any) pgx.Row {
+	return &instrumentedRow{
+		row:   db.Pool.QueryRow(context.Background(), query, args...),
+		db:    db,
+		name:  callerName(),
+		query: query,
+		start: time.Now(),
+	}
+}
+
+// Exec runs a statement that returns no rows
+func (db *DB) Exec(query string, args ...any) (pgconn.CommandTag, error) {
+	name := callerName()
+	start := time.Now()
+	tag, err := db.Pool.Exec(context.Background(), query, args...)
+	var affected int64 = -1
+	if err == nil {
+		affected = tag.RowsAffected()
+	}
+	db.observe(name, query, start, err, affected)
+	return tag, err
+}
+
+// SendBatch sends a batch of queries in a single round trip
+func (db *DB) SendBatch(b *pgx.Batch) pgx.BatchResults {
+	return db.Pool.SendBatch(context.Background(), b)
+}
+
+type instrumentedRow struct {
+	row   pgx.Row
+	db    *DB
+	name  string
+	query string
+	start time.Time
+}
+
+func (r *instrumentedRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	var rows int64 = 1
+	recordErr := err
+	if errors.Is(err, pgx.ErrNoRows) {
+		rows, recordErr = 0, nil
+	} else if err != nil {
+		rows = -1
+	}
+	r.db.observe(r.name, r.query, r.start, recordErr, rows)
+	return err
+}
+
+type instrumentedRows struct {
+	pgx.Rows
+	db     *DB
+	name   string
+	query  string
+	start  time.Time
+	count  int64
+	closed bool
+}
+
+func (r *instrumentedRows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+	r.finish()
+	return false
+}
+
+func (r *instrumentedRows) Close() {
+	r.Rows.Close()
+	r.finish()
+}
+
+func (r *instrumentedRows) finish() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.db.observe(r.name, r.query, r.start, r.Rows.Err(), r.count)
+}
+
+func (db *DB) observe(name, query string, start time.Time, err error, rows int64) {
+	elapsed := time.Since(start)
+	queryDuration.Observe(elapsed.Seconds(), name)
+	if err != nil {
+		queryErrors.Inc(name)
+	}
+	if rows >= 0 {
+		queryRows.Add(float64(rows), name)
+	}
+	if db.slowThreshold > 0 && elapsed >= db.slowThreshold {
+		log.Printf("Slow query %s took %s (rows=%d, err=%v): %s", name, elapsed, rows, err, compactSQL(statementSQL(query)))
+	}
+}
+
+// callerName returns the repository method that issued the query, e.g.
+// "UserRepository.GetByEmail", which is used as the query label.
+func callerName() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+	return name
+}
+
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
@@ -1,7 +1,7 @@
 package database
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"sort"
 )
@@ -227,7 +227,7 @@ var Migrations = []Migration{
 		`,
 	},
 	{
-		Version: 11,
+		Version: 14,
 		Up: `
 			CREATE TABLE IF NOT EXISTS channel_follows (
 				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -244,50 +244,852 @@ var Migrations = []Migration{
 			DROP TABLE IF EXISTS channel_follows;
 		`,
 	},
+	{
+		Version: 12,
+		Up: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+			ALTER TABLE channels ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+
+			CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+			CREATE INDEX IF NOT EXISTS idx_channels_deleted_at ON channels(deleted_at) WHERE deleted_at IS NOT NULL;
+			CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at ON conversations(deleted_at) WHERE deleted_at IS NOT NULL;
+			CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages(deleted_at) WHERE deleted_at IS NOT NULL;
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_users_deleted_at;
+			DROP INDEX IF EXISTS idx_channels_deleted_at;
+			DROP INDEX IF EXISTS idx_conversations_deleted_at;
+			DROP INDEX IF EXISTS idx_messages_deleted_at;
+			ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+			ALTER TABLE channels DROP COLUMN IF EXISTS deleted_at;
+			ALTER TABLE conversations DROP COLUMN IF EXISTS deleted_at;
+			ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
+		`,
+	},
+	{
+		Version: 13,
+		Up: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+			ALTER TABLE channels ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+		`,
+		Down: `
+			ALTER TABLE users DROP COLUMN IF EXISTS version;
+			ALTER TABLE channels DROP COLUMN IF EXISTS version;
+			ALTER TABLE conversations DROP COLUMN IF EXISTS version;
+		`,
+	},
+	{
+		Version: 15,
+		Up: `
+			CREATE TABLE IF NOT EXISTS messages_archive (
+				id UUID PRIMARY KEY,
+				conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+				sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				body TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				deleted_at TIMESTAMP NULL,
+				archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_messages_archive_conversation ON messages_archive(conversation_id, created_at DESC, id DESC);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS messages_archive;
+		`,
+	},
+	{
+		Version: 16,
+		Up: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP NULL;
+
+			CREATE TABLE IF NOT EXISTS email_tokens (
+				token_hash VARCHAR(64) PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				purpose VARCHAR(20) NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_email_tokens_user ON email_tokens(user_id, purpose);
+
+			CREATE TABLE IF NOT EXISTS email_preferences (
+				user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				mention_digest BOOLEAN NOT NULL DEFAULT true,
+				channel_live BOOLEAN NOT NULL DEFAULT true,
+				unsubscribe_token UUID NOT NULL UNIQUE DEFAULT uuid_generate_v4(),
+				last_digest_at TIMESTAMP NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS email_preferences;
+			DROP TABLE IF EXISTS email_tokens;
+			ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+		`,
+	},
+	{
+		Version: 17,
+		Up: `
+			CREATE TABLE IF NOT EXISTS analytics_daily (
+				day DATE NOT NULL,
+				metric VARCHAR(50) NOT NULL,
+				value BIGINT NOT NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (day, metric)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_messages_created_at;
+			DROP TABLE IF EXISTS analytics_daily;
+		`,
+	},
+	{
+		Version: 18,
+		Up: `
+			CREATE INDEX IF NOT EXISTS idx_conversation_moderations_expires ON conversation_moderations(expires_at) WHERE expires_at IS NOT NULL;
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_conversation_moderations_expires;
+		`,
+	},
+	{
+		Version: 19,
+		Up: `
+			CREATE TABLE IF NOT EXISTS data_exports (
+				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				archive BYTEA NULL,
+				size_bytes BIGINT NULL,
+				error TEXT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				started_at TIMESTAMP NULL,
+				completed_at TIMESTAMP NULL,
+				expires_at TIMESTAMP NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports(user_id, created_at DESC);
+			CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports(status, created_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS data_exports;
+		`,
+	},
+	{
+		Version: 20,
+		Up: `
+			CREATE TABLE IF NOT EXISTS refresh_token_families (
+				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				revoked_at TIMESTAMP NULL,
+				revoked_reason VARCHAR(20) NULL
+			);
+
+			CREATE TABLE IF NOT EXISTS refresh_tokens (
+				token_hash VARCHAR(64) PRIMARY KEY,
+				family_id UUID NOT NULL REFERENCES refresh_token_families(id) ON DELETE CASCADE,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_refresh_token_families_user ON refresh_token_families(user_id);
+			CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id, expires_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS refresh_tokens;
+			DROP TABLE IF EXISTS refresh_token_families;
+		`,
+	},
+	{
+		Version: 21,
+		Up: `
+			CREATE TABLE IF NOT EXISTS message_reports (
+				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+				message_id UUID NOT NULL,
+				conversation_id UUID NOT NULL,
+				reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				sender_id UUID NOT NULL,
+				reason VARCHAR(20) NOT NULL,
+				details TEXT NOT NULL DEFAULT '',
+				body_snapshot TEXT NOT NULL,
+				message_created_at TIMESTAMP NOT NULL,
+				message_deleted_at TIMESTAMP NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				resolved_at TIMESTAMP NULL,
+				resolved_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+				UNIQUE(message_id, reporter_id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_message_reports_status ON message_reports(status, created_at DESC, id DESC);
+			CREATE INDEX IF NOT EXISTS idx_message_reports_conversation ON message_reports(conversation_id) WHERE status = 'pending';
+		`,
+		Down: `
+			DROP TABLE IF EXISTS message_reports;
+		`,
+	},
+	{
+		Version: 22,
+		Up: `
+			ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS last_read_message_id UUID NULL;
+			ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS last_read_at TIMESTAMP NULL;
+		`,
+		Down: `
+			ALTER TABLE conversation_members DROP COLUMN IF EXISTS last_read_at;
+			ALTER TABLE conversation_members DROP COLUMN IF EXISTS last_read_message_id;
+		`,
+	},
+	{
+		Version: 23,
+		Up: `
+			CREATE TABLE IF NOT EXISTS channel_auto_messages (
+				channel_id UUID PRIMARY KEY REFERENCES channels(id) ON DELETE CASCADE,
+				welcome_message TEXT NOT NULL DEFAULT '',
+				announcement TEXT NOT NULL DEFAULT '',
+				announcement_interval_min INT NOT NULL DEFAULT 15,
+				announcement_min_messages INT NOT NULL DEFAULT 0,
+				last_announced_at TIMESTAMP NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+
+			CREATE TABLE IF NOT EXISTS channel_welcomes (
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (channel_id, user_id)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS channel_welcomes;
+			DROP TABLE IF EXISTS channel_auto_messages;
+		`,
+	},
+	{
+		Version: 24,
+		Up: `
+			CREATE TABLE IF NOT EXISTS user_identities (
+				id UUID PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				provider VARCHAR(32) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				email VARCHAR(255) NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				UNIQUE (provider, subject),
+				UNIQUE (user_id, provider)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS user_identities;
+		`,
+	},
+	{
+		Version: 25,
+		Up: `
+			CREATE TABLE IF NOT EXISTS api_keys (
+				id UUID PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name VARCHAR(100) NOT NULL,
+				hint VARCHAR(16) NOT NULL,
+				key_hash CHAR(64) NOT NULL UNIQUE,
+				scopes TEXT[] NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				last_used_at TIMESTAMP NULL,
+				expires_at TIMESTAMP NULL,
+				revoked_at TIMESTAMP NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id) WHERE revoked_at IS NULL;
+		`,
+		Down: `
+			DROP TABLE IF EXISTS api_keys;
+		`,
+	},
+	{
+		Version: 26,
+		Up: `
+			CREATE TABLE IF NOT EXISTS channel_commands (
+				id UUID PRIMARY KEY,
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				name VARCHAR(32) NOT NULL,
+				response TEXT NOT NULL,
+				permission VARCHAR(16) NOT NULL DEFAULT 'everyone',
+				cooldown_sec INT NOT NULL DEFAULT 5,
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				uses BIGINT NOT NULL DEFAULT 0,
+				last_used_at TIMESTAMP NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				UNIQUE (channel_id, name)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS channel_commands;
+		`,
+	},
+	{
+		Version: 27,
+		Up: `
+			CREATE TABLE IF NOT EXISTS sessions (
+				id UUID PRIMARY KEY REFERENCES refresh_token_families(id) ON DELETE CASCADE,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				user_agent VARCHAR(255) NOT NULL DEFAULT '',
+				ip VARCHAR(45) NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				last_seen_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+
+			INSERT INTO sessions (id, user_id, created_at, last_seen_at)
+			SELECT id, user_id, created_at, created_at FROM refresh_token_families
+			ON CONFLICT (id) DO NOTHING;
+		`,
+		Down: `
+			DROP TABLE IF EXISTS sessions;
+		`,
+	},
+	{
+		Version: 28,
+		Up: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user'
+				CHECK (role IN ('user', 'staff', 'admin'));
+		`,
+		Down: `
+			ALTER TABLE users DROP COLUMN IF EXISTS role;
+		`,
+	},
+	{
+		Version: 29,
+		Up: `
+			ALTER TABLE channels ADD COLUMN IF NOT EXISTS chat_rules TEXT;
+		`,
+		Down: `
+			ALTER TABLE channels DROP COLUMN IF EXISTS chat_rules;
+		`,
+	},
+	{
+		Version: 30,
+		Up: `
+			CREATE TABLE IF NOT EXISTS auth_events (
+				id UUID PRIMARY KEY,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				event VARCHAR(32) NOT NULL,
+				ip VARCHAR(45) NOT NULL DEFAULT '',
+				user_agent VARCHAR(255) NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_auth_events_user ON auth_events(user_id, created_at DESC, id DESC);
+			CREATE INDEX IF NOT EXISTS idx_auth_events_created ON auth_events(created_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS auth_events;
+		`,
+	},
+	{
+		Version: 31,
+		Up: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS username VARCHAR(20);
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users(username);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_users_username;
+			ALTER TABLE users DROP COLUMN IF EXISTS username;
+		`,
+	},
+	{
+		Version: 32,
+		Up: `
+			ALTER TABLE channels ADD COLUMN IF NOT EXISTS follow_alerts BOOLEAN NOT NULL DEFAULT TRUE;
+		`,
+		Down: `
+			ALTER TABLE channels DROP COLUMN IF EXISTS follow_alerts;
+		`,
+	},
+	{
+		Version: 33,
+		Up: `
+			CREATE TABLE IF NOT EXISTS overlay_tokens (
+				channel_id UUID PRIMARY KEY REFERENCES channels(id) ON DELETE CASCADE,
+				token_hash VARCHAR(64) NOT NULL UNIQUE,
+				hint VARCHAR(16) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				last_used_at TIMESTAMP
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS overlay_tokens;
+		`,
+	},
+	{
+		Version: 34,
+		Up: `
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+			ALTER TABLE messages_archive ADD COLUMN IF NOT EXISTS deleted_by UUID;
+		`,
+		Down: `
+			ALTER TABLE messages_archive DROP COLUMN IF EXISTS deleted_by;
+			ALTER TABLE messages DROP COLUMN IF EXISTS deleted_by;
+		`,
+	},
+	{
+		Version: 35,
+		Up: `
+			CREATE TABLE IF NOT EXISTS watch_history (
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				stream_id UUID NOT NULL REFERENCES streams(id) ON DELETE CASCADE,
+				position_seconds INT NOT NULL DEFAULT 0,
+				watched_seconds INT NOT NULL DEFAULT 0,
+				first_watched_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				last_watched_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (user_id, stream_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_watch_history_user_recent ON watch_history(user_id, last_watched_at DESC, stream_id DESC);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS watch_history;
+		`,
+	},
+	{
+		Version: 36,
+		Up: `
+			ALTER TABLE streams ADD COLUMN IF NOT EXISTS mature BOOLEAN NOT NULL DEFAULT FALSE;
+			ALTER TABLE streams ADD COLUMN IF NOT EXISTS content_tags TEXT[] NOT NULL DEFAULT '{}';
+			CREATE TABLE IF NOT EXISTS content_preferences (
+				user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				show_mature BOOLEAN NOT NULL DEFAULT FALSE,
+				hidden_tags TEXT[] NOT NULL DEFAULT '{}',
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS content_preferences;
+			ALTER TABLE streams DROP COLUMN IF EXISTS content_tags;
+			ALTER TABLE streams DROP COLUMN IF EXISTS mature;
+		`,
+	},
+	{
+		Version: 37,
+		Up: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS dm_policy VARCHAR(20) NOT NULL DEFAULT 'everyone';
+			CREATE TABLE IF NOT EXISTS message_requests (
+				conversation_id UUID PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+				sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				UNIQUE(sender_id, recipient_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_message_requests_recipient ON message_requests(recipient_id, created_at DESC);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS message_requests;
+			ALTER TABLE users DROP COLUMN IF EXISTS dm_policy;
+		`,
+	},
+	{
+		Version: 38,
+		Up: `
+			CREATE TABLE IF NOT EXISTS analytics_events (
+				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+				type VARCHAR(50) NOT NULL,
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				stream_id UUID NULL REFERENCES streams(id) ON DELETE SET NULL,
+				user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+				properties JSONB NOT NULL DEFAULT '{}',
+				occurred_at TIMESTAMP NOT NULL,
+				received_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_analytics_events_channel ON analytics_events(channel_id, occurred_at);
+			CREATE INDEX IF NOT EXISTS idx_analytics_events_occurred ON analytics_events(occurred_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS analytics_events;
+		`,
+	},
+	{
+		Version: 39,
+		Up: `
+			CREATE TABLE IF NOT EXISTS channel_links (
+				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				code VARCHAR(16) NOT NULL UNIQUE,
+				target_url TEXT NULL,
+				label VARCHAR(100) NULL,
+				clicks BIGINT NOT NULL DEFAULT 0,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				last_clicked_at TIMESTAMP NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_channel_links_channel ON channel_links(channel_id, created_at DESC, id DESC);
+			CREATE TABLE IF NOT EXISTS channel_link_clicks (
+				link_id UUID NOT NULL REFERENCES channel_links(id) ON DELETE CASCADE,
+				day DATE NOT NULL,
+				clicks BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (link_id, day)
+			);
+			CREATE INDEX IF NOT EXISTS idx_channel_link_clicks_day ON channel_link_clicks(day);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS channel_link_clicks;
+			DROP TABLE IF EXISTS channel_links;
+		`,
+	},
+	{
+		Version: 40,
+		Up: `
+			ALTER TABLE channel_follows ADD COLUMN IF NOT EXISTS ip VARCHAR(45) NULL;
+			ALTER TABLE channel_follows ADD COLUMN IF NOT EXISTS network VARCHAR(64) NULL;
+			ALTER TABLE channel_follows ADD COLUMN IF NOT EXISTS new_account BOOLEAN NOT NULL DEFAULT FALSE;
+			CREATE INDEX IF NOT EXISTS idx_channel_follows_new_accounts ON channel_follows(created_at) WHERE new_account;
+			CREATE TABLE IF NOT EXISTS follow_bot_reports (
+				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				network VARCHAR(64) NOT NULL,
+				ips TEXT[] NOT NULL DEFAULT '{}',
+				user_ids UUID[] NOT NULL DEFAULT '{}',
+				removed INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_follow_bot_reports_created ON follow_bot_reports(created_at DESC, id DESC);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS follow_bot_reports;
+			DROP INDEX IF EXISTS idx_channel_follows_new_accounts;
+			ALTER TABLE channel_follows DROP COLUMN IF EXISTS new_account;
+			ALTER TABLE channel_follows DROP COLUMN IF EXISTS network;
+			ALTER TABLE channel_follows DROP COLUMN IF EXISTS ip;
+		`,
+	},
+	{
+		Version: 41,
+		Up: `
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS preview JSONB NULL;
+			ALTER TABLE messages_archive ADD COLUMN IF NOT EXISTS preview JSONB NULL;
+		`,
+		Down: `
+			ALTER TABLE messages_archive DROP COLUMN IF EXISTS preview;
+			ALTER TABLE messages DROP COLUMN IF EXISTS preview;
+		`,
+	},
+	{
+		Version: 42,
+		Up: `
+			CREATE TABLE IF NOT EXISTS channel_points (
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				balance BIGINT NOT NULL DEFAULT 0,
+				pending_seconds INTEGER NOT NULL DEFAULT 0,
+				last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (channel_id, user_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_channel_points_user ON channel_points(user_id);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS channel_points;
+		`,
+	},
+	{
+		Version: 43,
+		Up: `
+			CREATE TABLE IF NOT EXISTS assets (
+				hash CHAR(64) PRIMARY KEY,
+				content_type VARCHAR(50) NOT NULL,
+				data BYTEA NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+
+			CREATE TABLE IF NOT EXISTS channel_badges (
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'moderator', 'vip')),
+				images JSONB NOT NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (channel_id, role)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS channel_badges;
+			DROP TABLE IF EXISTS assets;
+		`,
+	},
+	{
+		Version: 44,
+		Up: `
+			ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS draft TEXT NULL;
+			ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS draft_updated_at TIMESTAMP NULL;
+		`,
+		Down: `
+			ALTER TABLE conversation_members DROP COLUMN IF EXISTS draft_updated_at;
+			ALTER TABLE conversation_members DROP COLUMN IF EXISTS draft;
+		`,
+	},
+	{
+		Version: 45,
+		Up: `
+			CREATE TABLE IF NOT EXISTS device_keys (
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				device_id VARCHAR(64) NOT NULL,
+				algorithm VARCHAR(16) NOT NULL,
+				public_key TEXT NOT NULL,
+				signature TEXT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (user_id, device_id)
+			);
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'text';
+			ALTER TABLE messages_archive ADD COLUMN IF NOT EXISTS kind VARCHAR(16) NOT NULL DEFAULT 'text';
+		`,
+		Down: `
+			ALTER TABLE messages_archive DROP COLUMN IF EXISTS kind;
+			ALTER TABLE messages DROP COLUMN IF EXISTS kind;
+			DROP TABLE IF EXISTS device_keys;
+		`,
+	},
+	{
+		Version: 46,
+		Up: `
+			CREATE TABLE IF NOT EXISTS announcements (
+				id UUID PRIMARY KEY,
+				title VARCHAR(200) NOT NULL,
+				body TEXT NOT NULL,
+				audience VARCHAR(16) NOT NULL DEFAULT 'all',
+				publish_at TIMESTAMP NOT NULL,
+				published_at TIMESTAMP NULL,
+				expires_at TIMESTAMP NULL,
+				created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_announcements_due ON announcements(publish_at) WHERE published_at IS NULL;
+		`,
+		Down: `
+			DROP TABLE IF EXISTS announcements;
+		`,
+	},
+	{
+		Version: 47,
+		Up: `
+			ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS notifications_muted BOOLEAN NOT NULL DEFAULT false;
+			ALTER TABLE conversation_members ADD COLUMN IF NOT EXISTS notifications_muted_until TIMESTAMP NULL;
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS dnd_until TIMESTAMP NULL;
+		`,
+		Down: `
+			ALTER TABLE users DROP COLUMN IF EXISTS dnd_until;
+			ALTER TABLE conversation_members DROP COLUMN IF EXISTS notifications_muted_until;
+			ALTER TABLE conversation_members DROP COLUMN IF EXISTS notifications_muted;
+		`,
+	},
+	{
+		Version: 48,
+		Up: `
+			CREATE INDEX IF NOT EXISTS idx_moderation_logs_message ON moderation_logs(message_id) WHERE message_id IS NOT NULL;
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_moderation_logs_message;
+		`,
+	},
+	{
+		Version: 49,
+		Up: `
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS formatting BOOLEAN NOT NULL DEFAULT true;
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS html TEXT NULL;
+			ALTER TABLE messages_archive ADD COLUMN IF NOT EXISTS html TEXT NULL;
+		`,
+		Down: `
+			ALTER TABLE messages_archive DROP COLUMN IF EXISTS html;
+			ALTER TABLE messages DROP COLUMN IF EXISTS html;
+			ALTER TABLE conversations DROP COLUMN IF EXISTS formatting;
+		`,
+	},
+	{
+		Version: 50,
+		Up: `
+			CREATE TABLE IF NOT EXISTS channel_emotes (
+				channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+				name VARCHAR(32) NOT NULL,
+				image_url TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (channel_id, name)
+			);
+			CREATE INDEX IF NOT EXISTS idx_channels_conversation ON channels(conversation_id) WHERE conversation_id IS NOT NULL;
+			ALTER TABLE messages ADD COLUMN IF NOT EXISTS tokens JSONB NULL;
+			ALTER TABLE messages_archive ADD COLUMN IF NOT EXISTS tokens JSONB NULL;
+		`,
+		Down: `
+			ALTER TABLE messages_archive DROP COLUMN IF EXISTS tokens;
+			ALTER TABLE messages DROP COLUMN IF EXISTS tokens;
+			DROP INDEX IF EXISTS idx_channels_conversation;
+			DROP TABLE IF EXISTS channel_emotes;
+		`,
+	},
+	{
+		Version: 51,
+		Up: `
+			CREATE TABLE IF NOT EXISTS bot_scores (
+				conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+				user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				score REAL NOT NULL,
+				entropy REAL NOT NULL,
+				regularity REAL NOT NULL,
+				duplicates REAL NOT NULL,
+				messages INTEGER NOT NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (conversation_id, user_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_bot_scores_score ON bot_scores(conversation_id, score DESC);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS bot_scores;
+		`,
+	},
+	{
+		Version: 52,
+		Up: `
+			CREATE TABLE IF NOT EXISTS message_translations (
+				message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+				language VARCHAR(16) NOT NULL,
+				text TEXT NOT NULL,
+				source_language VARCHAR(16) NULL,
+				provider VARCHAR(16) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (message_id, language)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS message_translations;
+		`,
+	},
+	{
+		Version: 53,
+		Up: `
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS retention_days INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS retention_action VARCHAR(10) NOT NULL DEFAULT 'delete';
+			CREATE INDEX IF NOT EXISTS idx_conversations_retention ON conversations(id) WHERE retention_days > 0;
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_conversations_retention;
+			ALTER TABLE conversations DROP COLUMN IF EXISTS retention_action;
+			ALTER TABLE conversations DROP COLUMN IF EXISTS retention_days;
+		`,
+	},
+	{
+		Version: 54,
+		Up: `
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS max_message_length INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE conversations ADD COLUMN IF NOT EXISTS max_emotes INTEGER NOT NULL DEFAULT 0;
+		`,
+		Down: `
+			ALTER TABLE conversations DROP COLUMN IF EXISTS max_emotes;
+			ALTER TABLE conversations DROP COLUMN IF EXISTS max_message_length;
+		`,
+	},
+	{
+		Version: 55,
+		Up: `
+			CREATE TABLE IF NOT EXISTS attachments (
+				id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+				conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+				message_id UUID NULL,
+				uploader_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+				storage_key TEXT NOT NULL,
+				content_type VARCHAR(100) NOT NULL,
+				size_bytes BIGINT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX IF NOT EXISTS idx_attachments_conversation ON attachments(conversation_id);
+			CREATE INDEX IF NOT EXISTS idx_attachments_created_at ON attachments(created_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS attachments;
+		`,
+	},
+	{
+		// Deleted accounts keep their email, so only live accounts need it
+		// unique; otherwise nobody could sign up again with it
+		Version: 56,
+		Up: `
+			ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_live ON users(email) WHERE deleted_at IS NULL;
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_users_email_live;
+			ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+		`,
+	},
+	{
+		// Emotes get images at each scale like badges; those added by URL
+		// have it as their only, 1x image
+		Version: 57,
+		Up: `
+			ALTER TABLE channel_emotes ADD COLUMN IF NOT EXISTS images JSONB NULL;
+			UPDATE channel_emotes SET images = jsonb_build_object('1x', image_url) WHERE images IS NULL;
+			ALTER TABLE channel_emotes ALTER COLUMN images SET NOT NULL;
+		`,
+		Down: `
+			ALTER TABLE channel_emotes DROP COLUMN IF EXISTS images;
+		`,
+	},
+}
+
+// MigrationStatus compares the registered migrations with those recorded in schema_migrations
+type MigrationStatus struct {
+	// Applied lists applied versions in ascending order
+	Applied []int
+	// Pending lists registered migrations that have not been applied, in ascending order
+	Pending []Migration
+	// Gaps lists pending versions lower than the highest applied version, i.e.
+	// migrations that were skipped or registered out of order
+	Gaps []int
+	// Unknown lists applied versions that are not in the registry
+	Unknown []int
+	// Duplicates lists versions registered more than once
+	Duplicates []int
 }
 
 // RunMigrations runs all pending migrations
-func RunMigrations(db *sql.DB) error {
+func RunMigrations(db *DB) error {
+	ctx := context.Background()
+
 	// Ensure migrations table exists
 	if err := ensureMigrationsTable(db); err != nil {
 		return err
 	}
 
-	// Get current version
-	currentVersion, err := getCurrentVersion(db)
+	status, err := Status(db)
 	if err != nil {
 		return err
 	}
+	if len(status.Duplicates) > 0 {
+		return fmt.Errorf("duplicate migration versions registered: %v", status.Duplicates)
+	}
 
 	// Run pending migrations in ascending order by version
-	sorted := make([]Migration, len(Migrations))
-	copy(sorted, Migrations)
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
-
-	// Run pending migrations
-	for _, migration := range sorted {
-		if migration.Version <= currentVersion {
-			continue
-		}
-
+	for _, migration := range status.Pending {
 		fmt.Printf("Running migration %d...\n", migration.Version)
 
-		tx, err := db.Begin()
+		tx, err := db.Pool.Begin(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to begin transaction: %w", err)
 		}
 
-		if _, err := tx.Exec(migration.Up); err != nil {
-			tx.Rollback()
+		if _, err := tx.Exec(ctx, migration.Up); err != nil {
+			tx.Rollback(ctx)
 			return fmt.Errorf("failed to run migration %d: %w", migration.Version, err)
 		}
 
-		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", migration.Version); err != nil {
-			tx.Rollback()
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", migration.Version); err != nil {
+			tx.Rollback(ctx)
 			return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
 		}
 
-		if err := tx.Commit(); err != nil {
+		if err := tx.Commit(ctx); err != nil {
 			return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
 		}
 
@@ -297,8 +1099,74 @@ func RunMigrations(db *sql.DB) error {
 	return nil
 }
 
-func ensureMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec(`
+// Status reports applied, pending and inconsistent migrations
+func Status(db *DB) (*MigrationStatus, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := getAppliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	return computeStatus(Migrations, applied), nil
+}
+
+// PendingMigrations returns the registered migrations that have not been applied
+func PendingMigrations(db *DB) ([]Migration, error) {
+	status, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+	return status.Pending, nil
+}
+
+// CurrentVersion returns the highest applied migration version
+func CurrentVersion(db *DB) (int, error) {
+	return getCurrentVersion(db)
+}
+
+func computeStatus(registered []Migration, applied []int) *MigrationStatus {
+	status := &MigrationStatus{Applied: append([]int(nil), applied...)}
+	sort.Ints(status.Applied)
+
+	appliedSet := make(map[int]bool, len(applied))
+	maxApplied := 0
+	for _, v := range status.Applied {
+		appliedSet[v] = true
+		if v > maxApplied {
+			maxApplied = v
+		}
+	}
+
+	seen := make(map[int]bool, len(registered))
+	for _, m := range registered {
+		if seen[m.Version] {
+			status.Duplicates = append(status.Duplicates, m.Version)
+			continue
+		}
+		seen[m.Version] = true
+		if appliedSet[m.Version] {
+			continue
+		}
+		status.Pending = append(status.Pending, m)
+		if m.Version < maxApplied {
+			status.Gaps = append(status.Gaps, m.Version)
+		}
+	}
+	for _, v := range status.Applied {
+		if !seen[v] {
+			status.Unknown = append(status.Unknown, v)
+		}
+	}
+
+	sort.Slice(status.Pending, func(i, j int) bool { return status.Pending[i].Version < status.Pending[j].Version })
+	sort.Ints(status.Gaps)
+	sort.Ints(status.Duplicates)
+	return status
+}
+
+func ensureMigrationsTable(db *DB) error {
+	_, err := db.Pool.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version INT PRIMARY KEY,
 			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
@@ -307,11 +1175,29 @@ func ensureMigrationsTable(db *sql.DB) error {
 	return err
 }
 
-func getCurrentVersion(db *sql.DB) (int, error) {
+func getCurrentVersion(db *DB) (int, error) {
 	var version int
-	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	err := db.Pool.QueryRow(context.Background(), "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
 	if err != nil {
 		return 0, err
 	}
 	return version, nil
 }
+
+func getAppliedVersions(db *DB) ([]int, error) {
+	rows, err := db.Pool.Query(context.Background(), "SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []int{}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("failed to scan migration version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
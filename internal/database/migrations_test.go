@@ -0,0 +1,37 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeStatus(t *testing.T) {
+	registered := []Migration{{Version: 3}, {Version: 1}, {Version: 2}, {Version: 5}, {Version: 4}, {Version: 4}}
+	applied := []int{1, 3, 9}
+
+	status := computeStatus(registered, applied)
+
+	var pending []int
+	for _, m := range status.Pending {
+		pending = append(pending, m.Version)
+	}
+	if want := []int{2, 4, 5}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("pending = %v, want %v", pending, want)
+	}
+	if want := []int{2, 4, 5}; !reflect.DeepEqual(status.Gaps, want) {
+		t.Errorf("gaps = %v, want %v", status.Gaps, want)
+	}
+	if want := []int{9}; !reflect.DeepEqual(status.Unknown, want) {
+		t.Errorf("unknown = %v, want %v", status.Unknown, want)
+	}
+	if want := []int{4}; !reflect.DeepEqual(status.Duplicates, want) {
+		t.Errorf("duplicates = %v, want %v", status.Duplicates, want)
+	}
+}
+
+func TestRegisteredMigrationsAreUnique(t *testing.T) {
+	status := computeStatus(Migrations, nil)
+	if len(status.Duplicates) > 0 {
+		t.Fatalf("duplicate migration versions: %v", status.Duplicates)
+	}
+}
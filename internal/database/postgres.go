@@ -1,38 +1,100 @@
 package database
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DB struct {
-	*sql.DB
+	Pool          *pgxpool.Pool
+	slowThreshold time.Duration
+	// password overrides the DSN password for new connections once rotated
+	password atomic.Pointer[string]
 }
 
-// NewPostgresDB creates a new PostgreSQL database connection
+// NewPostgresDB creates a new PostgreSQL connection pool. Its connections
+// don't prepare the registered statements, which may use columns that
+// migrations have yet to add; see PrepareStatements.
 func NewPostgresDB(dsn string) (*DB, error) {
-	db, err := sql.Open("postgres", dsn)
+	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	cfg.MaxConns = 25
+	cfg.MinConns = 5
+	cfg.MaxConnLifetime = 5 * time.Minute
+
+	db := &DB{}
+	cfg.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
+		if p := db.password.Load(); p != nil {
+			cc.Password = *p
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
 
 	// Test the connection
-	if err := db.Ping(); err != nil {
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &DB{db}, nil
+	db.Pool = pool
+	return db, nil
+}
+
+// PrepareStatements replaces the pool with one that prepares the registered
+// statements on every connection. Call it once migrations have run and
+// before the pool is shared.
+func (db *DB) PrepareStatements() error {
+	cfg := db.Pool.Config()
+	cfg.AfterConnect = prepareStatements
+
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	db.Pool.Close()
+	db.Pool = pool
+	return nil
+}
+
+// SetPassword makes new connections authenticate with password. Open
+// connections are unaffected and are replaced as they reach MaxConnLifetime.
+func (db *DB) SetPassword(password string) {
+	db.password.Store(&password)
+}
+
+// Ping checks that the database is reachable
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Pool.Ping(ctx)
+}
+
+// Begin starts a transaction
+func (db *DB) Begin() (pgx.Tx, error) {
+	return db.Pool.Begin(context.Background())
 }
 
-// Close closes the database connection
+// Close closes the database connection pool
 func (db *DB) Close() error {
-	return db.DB.Close()
+	db.Pool.Close()
+	return nil
 }
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Named statements prepared on every pooled connection. pgx also caches
+// statements on first use, but that cache is a bounded LRU per connection;
+// preparing the per-send hot path up front means it is never re-parsed and
+// never pays the describe round trip on a fresh connection.
+var (
+	stmtMu     sync.RWMutex
+	statements = map[string]string{}
+)
+
+// Prepare registers sql under name and returns name, so callers can write
+//
+//	var stmtFoo = database.Prepare("foo", `SELECT ...`)
+//
+// and pass stmtFoo wherever SQL is expected. Statements must be registered
+// before DB.PrepareStatements.
+func Prepare(name, sql string) string {
+	stmtMu.Lock()
+	defer stmtMu.Unlock()
+	if existing, ok := statements[name]; ok && existing != sql {
+		panic(fmt.Sprintf("database: statement %q registered twice with different SQL", name))
+	}
+	statements[name] = sql
+	return name
+}
+
+// statementSQL returns the SQL behind a prepared statement name, or query itself
+func statementSQL(query string) string {
+	stmtMu.RLock()
+	defer stmtMu.RUnlock()
+	if sql, ok := statements[query]; ok {
+		return sql
+	}
+	return query
+}
+
+// prepareStatements is installed by DB.PrepareStatements as the pool's
+// AfterConnect hook
+func prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	stmtMu.RLock()
+	defer stmtMu.RUnlock()
+	for name, sql := range statements {
+		if _, err := conn.Prepare(ctx, name, sql); err != nil {
+			return fmt.Errorf("failed to prepare statement %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package database
+
+import "testing"
+
+func TestPrepareRegistersStatement(t *testing.T) {
+	name := Prepare("test_prepare_registers", "SELECT 1")
+	if name != "test_prepare_registers" {
+		t.Fatalf("Prepare returned %q", name)
+	}
+	if got := statementSQL(name); got != "SELECT 1" {
+		t.Errorf("statementSQL(%q) = %q, want SELECT 1", name, got)
+	}
+	if got := statementSQL("SELECT 2"); got != "SELECT 2" {
+		t.Errorf("unregistered SQL should pass through, got %q", got)
+	}
+	// re-registering identical SQL is allowed
+	Prepare("test_prepare_registers", "SELECT 1")
+}
+
+func TestPrepareRejectsConflictingSQL(t *testing.T) {
+	Prepare("test_prepare_conflict", "SELECT 1")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on conflicting registration")
+		}
+	}()
+	Prepare("test_prepare_conflict", "SELECT 2")
+}
@@ -0,0 +1,66 @@
+// Package emote finds ":name:" shortcodes of channel emotes in chat messages
+package emote
+
+import (
+	"regexp"
+
+	"github.com/tullo/backend/internal/models"
+)
+
+// NamePattern is what an emote name may look like
+var NamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{2,32}$`)
+
+var shortcode = regexp.MustCompile(`:([A-Za-z0-9_]{2,32}):`)
+
+// Names returns the distinct names of the shortcodes in body, in order of
+// appearance, so the caller can look up only those emotes
+func Names(body string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range shortcode.FindAllStringSubmatch(body, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Tokenize splits body into text and emote tokens, given the images of the
+// emotes by name. Shortcodes of unknown emotes stay text. It returns nil if
+// body uses no emote.
+func Tokenize(body string, images map[string]models.ImageVariants) []models.MessageToken {
+	var tokens []models.MessageToken
+	found := false
+	start := 0
+	for _, loc := range shortcode.FindAllStringSubmatchIndex(body, -1) {
+		variants, ok := images[body[loc[2]:loc[3]]]
+		if !ok {
+			continue
+		}
+		if loc[0] > start {
+			tokens = append(tokens, models.MessageToken{Type: models.TokenText, Text: body[start:loc[0]]})
+		}
+		tokens = append(tokens, models.MessageToken{Type: models.TokenEmote, Text: body[loc[0]:loc[1]], ImageURL: variants[models.ImageScale1x], Images: variants})
+		found = true
+		start = loc[1]
+	}
+	if !found {
+		return nil
+	}
+	if start < len(body) {
+		tokens = append(tokens, models.MessageToken{Type: models.TokenText, Text: body[start:]})
+	}
+	return tokens
+}
+
+// Count returns the number of emotes among tokens
+func Count(tokens []models.MessageToken) int {
+	n := 0
+	for _, t := range tokens {
+		if t.Type == models.TokenEmote {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+package emote
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestNames(t *testing.T) {
+	got := Names(":pog: hello :kappa::pog: :x:")
+	want := []string{"pog", "kappa"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Names = %v, want %v", got, want)
+	}
+	if got := Names("no emotes"); got != nil {
+		t.Errorf("Names without shortcodes = %v, want nil", got)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	images := map[string]models.ImageVariants{"pog": {models.ImageScale1x: "https://cdn.example.com/pog.png", models.ImageScale2x: "https://cdn.example.com/pog@2x.png"}}
+	text := func(s string) models.MessageToken { return models.MessageToken{Type: models.TokenText, Text: s} }
+	pog := models.MessageToken{Type: models.TokenEmote, Text: ":pog:", ImageURL: "https://cdn.example.com/pog.png", Images: images["pog"]}
+
+	tests := []struct {
+		body string
+		want []models.MessageToken
+	}{
+		{"hello", nil},
+		{":unknown: only", nil},
+		{":pog:", []models.MessageToken{pog}},
+		{"gg :pog: :unknown: wp", []models.MessageToken{text("gg "), pog, text(" :unknown: wp")}},
+		{":pog::pog:", []models.MessageToken{pog, pog}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.body, images); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %+v, want %+v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	images := map[string]models.ImageVariants{"pog": {models.ImageScale1x: "https://cdn.example.com/pog.png"}}
+	if got := Count(Tokenize("gg :pog: :unknown: :pog::pog:", images)); got != 3 {
+		t.Errorf("Count = %d, want 3", got)
+	}
+	if got := Count(nil); got != 0 {
+		t.Errorf("Count(nil) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+func TestByKey(t *testing.T) {
+	a, b, missing := uuid.New(), uuid.New(), uuid.New()
+	found := map[uuid.UUID]int{a: 1, b: 2}
+
+	got, errs := byKey([]uuid.UUID{b, missing, a}, found, nil)
+	if errs != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if want := []int{2, 0, 1}; got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("byKey = %v, want %v", got, want)
+	}
+
+	if _, errs := byKey[int]([]uuid.UUID{a, b}, nil, errors.New("db down")); len(errs) != 1 {
+		t.Errorf("expected a single error for the whole batch, got %v", errs)
+	}
+}
+
+func TestPageArgs(t *testing.T) {
+	ptr := func(n int) *int { return &n }
+	tests := []struct {
+		first *int
+		want  int
+	}{
+		{nil, pagination.DefaultLimit},
+		{ptr(0), pagination.DefaultLimit},
+		{ptr(10), 10},
+		{ptr(1000), pagination.MaxLimit},
+	}
+	for _, tt := range tests {
+		limit, cursor, err := pageArgs(tt.first, nil)
+		if err != nil || cursor != nil || limit != tt.want {
+			t.Errorf("pageArgs(%v) = %d, %v, %v; want %d", tt.first, limit, cursor, err, tt.want)
+		}
+	}
+
+	bad := "not-a-cursor"
+	if _, _, err := pageArgs(nil, &bad); err == nil {
+		t.Error("expected an error for an invalid cursor")
+	}
+}
+
+// newTestClient serves the schema as userID with users already in the
+// loader cache, so no repository is touched
+func newTestClient(userID uuid.UUID, users ...*models.User) *client.Client {
+	r := &Resolver{}
+	loaders := newLoaders(r, userID)
+	for _, u := range users {
+		loaders.User.Prime(u.ID, u)
+	}
+
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: r}))
+	srv.AddTransport(transport.POST{})
+	return client.New(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		srv.ServeHTTP(w, req.WithContext(withRequest(req.Context(), userID, loaders)))
+	}))
+}
+
+func TestEmailOnlyVisibleToSelf(t *testing.T) {
+	me := &models.User{ID: uuid.New(), Email: "me@example.com", DisplayName: "Me"}
+	other := &models.User{ID: uuid.New(), Email: "other@example.com", DisplayName: "Other"}
+	c := newTestClient(me.ID, me, other)
+
+	var resp struct {
+		Me   struct{ Email *string }
+		User struct {
+			DisplayName string
+			Email       *string
+		}
+	}
+	c.MustPost(`query($id: UUID!) { me { email } user(id: $id) { displayName email } }`, &resp, client.Var("id", other.ID.String()))
+
+	if resp.Me.Email == nil || *resp.Me.Email != me.Email {
+		t.Errorf("me.email = %v, want %q", resp.Me.Email, me.Email)
+	}
+	if resp.User.DisplayName != other.DisplayName {
+		t.Errorf("user.displayName = %q, want %q", resp.User.DisplayName, other.DisplayName)
+	}
+	if resp.User.Email != nil {
+		t.Errorf("another user's email was exposed: %q", *resp.User.Email)
+	}
+}
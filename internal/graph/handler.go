@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/pagination"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// maxComplexity caps how many fields one query may resolve, so a deeply
+// nested query can't fan out into thousands of lookups
+const maxComplexity = 500
+
+// Handler serves GraphQL queries over POST for the user set by AuthMiddleware
+func Handler(r *Resolver) gin.HandlerFunc {
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: r}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.FixedComplexityLimit(maxComplexity))
+
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		uid := userID.(uuid.UUID)
+
+		ctx := withRequest(c.Request.Context(), uid, newLoaders(r, uid))
+		srv.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+	}
+}
+
+// apiError is a resolver error carrying the same code the REST API would
+// return, under extensions.code
+func apiError(code apierror.Code, message string) error {
+	return &gqlerror.Error{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
+
+// pageArgs applies the REST paging rules to first/after: first defaults to
+// pagination.DefaultLimit and is clamped to pagination.MaxLimit
+func pageArgs(first *int, after *string) (int, *pagination.Cursor, error) {
+	limit := pagination.DefaultLimit
+	if first != nil && *first > 0 {
+		limit = min(*first, pagination.MaxLimit)
+	}
+
+	var cursor *pagination.Cursor
+	if after != nil {
+		c, err := pagination.Decode(*after)
+		if err != nil {
+			return 0, nil, apiError(apierror.ValidationFailed, err.Error())
+		}
+		cursor = c
+	}
+	return limit, cursor, nil
+}
+
+func nextCursor[T any](page pagination.Page[T]) *string {
+	if page.NextCursor == "" {
+		return nil
+	}
+	return &page.NextCursor
+}
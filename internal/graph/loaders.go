@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+	"github.com/vikstrous/dataloadgen"
+)
+
+// loaderWait is how long a loader collects keys before it queries. Sibling
+// fields resolve concurrently, so a short window is enough to batch them.
+const loaderWait = 2 * time.Millisecond
+
+// Loaders batch the lookups behind nested fields. They cache per request, so
+// a new set is created for every query.
+type Loaders struct {
+	User          *dataloadgen.Loader[uuid.UUID, *models.User]
+	Members       *dataloadgen.Loader[uuid.UUID, []*models.User]
+	LastMessage   *dataloadgen.Loader[uuid.UUID, *models.Message]
+	UnreadCount   *dataloadgen.Loader[uuid.UUID, int]
+	Channel       *dataloadgen.Loader[uuid.UUID, *models.Channel]
+	FollowerCount *dataloadgen.Loader[uuid.UUID, int]
+	LatestStream  *dataloadgen.Loader[uuid.UUID, *models.Stream]
+	// Preferences only ever loads the caller's content preferences, once
+	Preferences *dataloadgen.Loader[uuid.UUID, models.ContentPreferences]
+}
+
+// newLoaders creates the loaders for one request made by userID, whose
+// unread counts the UnreadCount loader returns
+func newLoaders(r *Resolver, userID uuid.UUID) *Loaders {
+	wait := dataloadgen.WithWait(loaderWait)
+	return &Loaders{
+		User: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([]*models.User, []error) {
+			users, err := r.userRepo.GetByIDs(ids)
+			return byKey(ids, indexByID(users, func(u models.User) uuid.UUID { return u.ID }), err)
+		}, wait),
+		Members: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([][]*models.User, []error) {
+			members, err := r.convRepo.GetMembersByConversationIDs(ids)
+			found := make(map[uuid.UUID][]*models.User, len(members))
+			for id, users := range members {
+				found[id] = pointers(users)
+			}
+			return byKey(ids, found, err)
+		}, wait),
+		LastMessage: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([]*models.Message, []error) {
+			messages, err := r.msgRepo.GetLastMessages(ids)
+			found := make(map[uuid.UUID]*models.Message, len(messages))
+			for id := range messages {
+				msg := messages[id]
+				found[id] = &msg
+			}
+			return byKey(ids, found, err)
+		}, wait),
+		UnreadCount: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([]int, []error) {
+			counts, err := r.msgRepo.GetUnreadCounts(ids, userID)
+			return byKey(ids, counts, err)
+		}, wait),
+		Channel: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([]*models.Channel, []error) {
+			channels, err := r.channelRepo.GetByIDs(ids)
+			return byKey(ids, indexByID(channels, func(ch models.Channel) uuid.UUID { return ch.ID }), err)
+		}, wait),
+		FollowerCount: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([]int, []error) {
+			counts, err := r.channelRepo.CountFollowersByChannelIDs(ids)
+			return byKey(ids, counts, err)
+		}, wait),
+		LatestStream: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([]*models.Stream, []error) {
+			streams, err := r.streamRepo.GetLatestByChannels(ids)
+			found := make(map[uuid.UUID]*models.Stream, len(streams))
+			for id := range streams {
+				st := streams[id]
+				found[id] = &st
+			}
+			return byKey(ids, found, err)
+		}, wait),
+		Preferences: dataloadgen.NewLoader(func(_ context.Context, ids []uuid.UUID) ([]models.ContentPreferences, []error) {
+			found := make(map[uuid.UUID]models.ContentPreferences, len(ids))
+			for _, id := range ids {
+				prefs, err := r.prefsRepo.Get(id)
+				if err != nil {
+					return byKey(ids, found, err)
+				}
+				found[id] = prefs
+			}
+			return byKey(ids, found, nil)
+		}, wait),
+	}
+}
+
+// byKey orders fetched values to match keys, leaving the zero value for keys
+// that weren't found. A fetch error fails every key.
+func byKey[V any](keys []uuid.UUID, found map[uuid.UUID]V, err error) ([]V, []error) {
+	if err != nil {
+		log.Printf("GraphQL batch load failed: %v", err)
+		return nil, []error{apiError(apierror.Internal, "Failed to load data")}
+	}
+	out := make([]V, len(keys))
+	for i, k := range keys {
+		out[i] = found[k]
+	}
+	return out, nil
+}
+
+func indexByID[T any](items []T, id func(T) uuid.UUID) map[uuid.UUID]*T {
+	out := make(map[uuid.UUID]*T, len(items))
+	for i := range items {
+		out[id(items[i])] = &items[i]
+	}
+	return out
+}
+
+func pointers[T any](items []T) []*T {
+	out := make([]*T, len(items))
+	for i := range items {
+		out[i] = &items[i]
+	}
+	return out
+}
+
+type requestKey struct{}
+
+// request is the per-query state the resolvers read from the context
+type request struct {
+	userID  uuid.UUID
+	loaders *Loaders
+}
+
+func withRequest(ctx context.Context, userID uuid.UUID, loaders *Loaders) context.Context {
+	return context.WithValue(ctx, requestKey{}, &request{userID: userID, loaders: loaders})
+}
+
+func requestFrom(ctx context.Context) *request {
+	return ctx.Value(requestKey{}).(*request)
+}
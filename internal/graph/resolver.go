@@ -0,0 +1,32 @@
+// Package graph serves the GraphQL read API described in schema.graphqls.
+// Nested fields go through per-request dataloaders, so a page of
+// conversations with members, last messages and unread counts costs a fixed
+// number of queries however many conversations it holds.
+package graph
+
+//go:generate go run github.com/99designs/gqlgen@v0.17.40 generate --config gqlgen.yml
+
+import (
+	"github.com/tullo/backend/internal/repository"
+)
+
+// Resolver holds the repositories the resolvers read from
+type Resolver struct {
+	userRepo    *repository.UserRepository
+	convRepo    *repository.ConversationRepository
+	msgRepo     *repository.MessageRepository
+	channelRepo *repository.ChannelRepository
+	streamRepo  *repository.StreamRepository
+	prefsRepo   *repository.ContentPreferenceRepository
+}
+
+func NewResolver(userRepo *repository.UserRepository, convRepo *repository.ConversationRepository, msgRepo *repository.MessageRepository, chRepo *repository.ChannelRepository, streamRepo *repository.StreamRepository, prefsRepo *repository.ContentPreferenceRepository) *Resolver {
+	return &Resolver{
+		userRepo:    userRepo,
+		convRepo:    convRepo,
+		msgRepo:     msgRepo,
+		channelRepo: chRepo,
+		streamRepo:  streamRepo,
+		prefsRepo:   prefsRepo,
+	}
+}
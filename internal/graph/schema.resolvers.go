@@ -0,0 +1,247 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.40
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// Owner is the resolver for the owner field.
+func (r *channelResolver) Owner(ctx context.Context, obj *models.Channel) (*models.User, error) {
+	return requestFrom(ctx).loaders.User.Load(ctx, obj.OwnerID)
+}
+
+// FollowerCount is the resolver for the followerCount field.
+func (r *channelResolver) FollowerCount(ctx context.Context, obj *models.Channel) (int, error) {
+	return requestFrom(ctx).loaders.FollowerCount.Load(ctx, obj.ID)
+}
+
+// Stream is the resolver for the stream field.
+func (r *channelResolver) Stream(ctx context.Context, obj *models.Channel) (*models.Stream, error) {
+	req := requestFrom(ctx)
+	stream, err := req.loaders.LatestStream.Load(ctx, obj.ID)
+	if err != nil || stream == nil || !stream.Mature || obj.OwnerID == req.userID {
+		return stream, err
+	}
+	// As in the REST API, mature streams play only for viewers who opted in
+	prefs, err := req.loaders.Preferences.Load(ctx, req.userID)
+	if err != nil {
+		return nil, err
+	}
+	if !prefs.CanPlay(true) {
+		gated := *stream
+		gated.HLSURL = nil
+		return &gated, nil
+	}
+	return stream, nil
+}
+
+// Members is the resolver for the members field.
+func (r *conversationResolver) Members(ctx context.Context, obj *models.Conversation) ([]*models.User, error) {
+	members, err := requestFrom(ctx).loaders.Members.Load(ctx, obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Later sender/owner lookups of the same users are served from cache
+	for _, m := range members {
+		requestFrom(ctx).loaders.User.Prime(m.ID, m)
+	}
+	return members, nil
+}
+
+// LastMessage is the resolver for the lastMessage field.
+func (r *conversationResolver) LastMessage(ctx context.Context, obj *models.Conversation) (*models.Message, error) {
+	return requestFrom(ctx).loaders.LastMessage.Load(ctx, obj.ID)
+}
+
+// UnreadCount is the resolver for the unreadCount field.
+func (r *conversationResolver) UnreadCount(ctx context.Context, obj *models.Conversation) (int, error) {
+	return requestFrom(ctx).loaders.UnreadCount.Load(ctx, obj.ID)
+}
+
+// Sender is the resolver for the sender field.
+func (r *messageResolver) Sender(ctx context.Context, obj *models.Message) (*models.User, error) {
+	return requestFrom(ctx).loaders.User.Load(ctx, obj.SenderID)
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*models.User, error) {
+	user, err := requestFrom(ctx).loaders.User.Load(ctx, requestFrom(ctx).userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, apiError(apierror.UserNotFound, "User not found")
+	}
+	return user, nil
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return requestFrom(ctx).loaders.User.Load(ctx, id)
+}
+
+// Conversations is the resolver for the conversations field.
+func (r *queryResolver) Conversations(ctx context.Context, first *int, after *string) (*ConversationConnection, error) {
+	limit, cursor, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := r.convRepo.ListByUserID(requestFrom(ctx).userID, limit, cursor)
+	if err != nil {
+		return nil, apiError(apierror.Internal, "Failed to get conversations")
+	}
+	page := pagination.NewPage(conversations, limit, func(conv models.Conversation) pagination.Cursor {
+		return pagination.Cursor{Time: conv.UpdatedAt, ID: conv.ID}
+	})
+
+	return &ConversationConnection{Items: pointers(page.Items), NextCursor: nextCursor(page), HasMore: page.HasMore}, nil
+}
+
+// Conversation is the resolver for the conversation field.
+func (r *queryResolver) Conversation(ctx context.Context, id uuid.UUID) (*models.Conversation, error) {
+	isMember, err := r.convRepo.IsMember(id, requestFrom(ctx).userID)
+	if err != nil || !isMember {
+		return nil, apiError(apierror.NotMember, "Not a member of this conversation")
+	}
+
+	conversation, err := r.convRepo.GetByID(id)
+	if err != nil {
+		return nil, apiError(apierror.ConversationNotFound, "Conversation not found")
+	}
+	return conversation, nil
+}
+
+// Messages is the resolver for the messages field.
+func (r *queryResolver) Messages(ctx context.Context, conversationID uuid.UUID, first *int, after *string) (*MessageConnection, error) {
+	limit, cursor, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	isMember, err := r.convRepo.IsMember(conversationID, requestFrom(ctx).userID)
+	if err != nil || !isMember {
+		return nil, apiError(apierror.NotMember, "Not a member of this conversation")
+	}
+
+	messages, err := r.msgRepo.ListByConversation(conversationID, limit, cursor)
+	if err != nil {
+		return nil, apiError(apierror.Internal, "Failed to get messages")
+	}
+	page := pagination.NewPage(messages, limit, func(msg models.Message) pagination.Cursor {
+		return pagination.Cursor{Time: msg.CreatedAt, ID: msg.ID}
+	})
+
+	// The page query already joined the senders
+	for _, msg := range page.Items {
+		if msg.Sender != nil {
+			requestFrom(ctx).loaders.User.Prime(msg.SenderID, msg.Sender)
+		}
+	}
+
+	return &MessageConnection{Items: pointers(page.Items), NextCursor: nextCursor(page), HasMore: page.HasMore}, nil
+}
+
+// Channels is the resolver for the channels field.
+func (r *queryResolver) Channels(ctx context.Context, first *int, after *string) (*ChannelConnection, error) {
+	limit, cursor, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := r.channelRepo.List(limit, cursor)
+	if err != nil {
+		return nil, apiError(apierror.Internal, "Failed to list channels")
+	}
+	page := pagination.NewPage(channels, limit, func(ch models.Channel) pagination.Cursor {
+		return pagination.Cursor{Time: ch.CreatedAt, ID: ch.ID}
+	})
+
+	return &ChannelConnection{Items: pointers(page.Items), NextCursor: nextCursor(page), HasMore: page.HasMore}, nil
+}
+
+// Channel is the resolver for the channel field.
+func (r *queryResolver) Channel(ctx context.Context, slug string) (*models.Channel, error) {
+	ch, err := r.channelRepo.GetBySlug(slug)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apiError(apierror.Internal, "Failed to get channel")
+	}
+	return ch, nil
+}
+
+// LiveStreams is the resolver for the liveStreams field.
+func (r *queryResolver) LiveStreams(ctx context.Context, first *int) ([]*models.Stream, error) {
+	limit, _, err := pageArgs(first, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	streams, err := r.streamRepo.GetActiveStreams(limit)
+	if err != nil {
+		return nil, apiError(apierror.Internal, "Failed to get active streams")
+	}
+	req := requestFrom(ctx)
+	prefs, err := req.loaders.Preferences.Load(ctx, req.userID)
+	if err != nil {
+		return nil, err
+	}
+	visible := streams[:0]
+	for _, s := range streams {
+		if !prefs.Hides(s.Mature, s.ContentTags) {
+			visible = append(visible, s)
+		}
+	}
+	return pointers(visible), nil
+}
+
+// Channel is the resolver for the channel field.
+func (r *streamResolver) Channel(ctx context.Context, obj *models.Stream) (*models.Channel, error) {
+	return requestFrom(ctx).loaders.Channel.Load(ctx, obj.ChannelID)
+}
+
+// Email is the resolver for the email field.
+func (r *userResolver) Email(ctx context.Context, obj *models.User) (*string, error) {
+	// Other users' addresses are private, as in the REST API
+	if obj.ID != requestFrom(ctx).userID {
+		return nil, nil
+	}
+	return &obj.Email, nil
+}
+
+// Channel returns ChannelResolver implementation.
+func (r *Resolver) Channel() ChannelResolver { return &channelResolver{r} }
+
+// Conversation returns ConversationResolver implementation.
+func (r *Resolver) Conversation() ConversationResolver { return &conversationResolver{r} }
+
+// Message returns MessageResolver implementation.
+func (r *Resolver) Message() MessageResolver { return &messageResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// Stream returns StreamResolver implementation.
+func (r *Resolver) Stream() StreamResolver { return &streamResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type channelResolver struct{ *Resolver }
+type conversationResolver struct{ *Resolver }
+type messageResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type streamResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/middleware"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type AccountHandler struct {
+	userRepo    *repository.UserRepository
+	sessionRepo *repository.SessionRepository
+	redis       *cache.RedisClient
+	etags       *middleware.ETagCache
+	// anonymizeTo receives the messages of deleted accounts; uuid.Nil
+	// deletes them instead
+	anonymizeTo uuid.UUID
+}
+
+func NewAccountHandler(userRepo *repository.UserRepository, sessionRepo *repository.SessionRepository, redis *cache.RedisClient, etags *middleware.ETagCache, anonymizeTo uuid.UUID) *AccountHandler {
+	return &AccountHandler{userRepo: userRepo, sessionRepo: sessionRepo, redis: redis, etags: etags, anonymizeTo: anonymizeTo}
+}
+
+// DeleteAccount soft-deletes the current user after confirming their
+// password (see UserRepository.DeleteAccount for what is cleaned up). Their
+// sessions are signed out and their WebSocket connections closed.
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ValidationError(c, err)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(uid)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return
+	}
+	if user.PasswordHash != "" {
+		if err := auth.CheckPassword(user.PasswordHash, req.Password); err != nil {
+			ErrorCode(c, http.StatusUnauthorized, apierror.InvalidCredentials, "Invalid password")
+			return
+		}
+	}
+
+	sessions, err := h.sessionRepo.ListByUser(uid)
+	if err != nil {
+		log.Printf("Failed to list sessions of deleted account %s: %v", uid, err)
+	}
+	if err := h.userRepo.DeleteAccount(uid, h.anonymizeTo); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+	h.etags.Invalidate(middleware.UserETagKey(uid))
+
+	if h.redis != nil {
+		for _, s := range sessions {
+			h.redis.PublishMessage(models.WSMessage{
+				Event:   models.EventSessionRevoked,
+				Payload: models.WSSessionRevokedPayload{UserID: uid, SessionID: s.ID},
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/middleware"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// AdminHandler exposes platform-admin operations such as inspecting and
+// restoring soft-deleted records.
+type AdminHandler struct {
+	userRepo    *repository.UserRepository
+	channelRepo *repository.ChannelRepository
+	convRepo    *repository.ConversationRepository
+	msgRepo     *repository.MessageRepository
+	botRepo     *repository.FollowBotRepository
+	etags       *middleware.ETagCache
+	redis       *cache.RedisClient
+}
+
+func NewAdminHandler(userRepo *repository.UserRepository, chRepo *repository.ChannelRepository, convRepo *repository.ConversationRepository, msgRepo *repository.MessageRepository, botRepo *repository.FollowBotRepository, etags *middleware.ETagCache, redis *cache.RedisClient) *AdminHandler {
+	return &AdminHandler{userRepo: userRepo, channelRepo: chRepo, convRepo: convRepo, msgRepo: msgRepo, botRepo: botRepo, etags: etags, redis: redis}
+}
+
+func includeDeleted(c *gin.Context) bool {
+	v, _ := strconv.ParseBool(c.Query("include_deleted"))
+	return v
+}
+
+// GetUser returns a user; ?include_deleted=true also returns soft-deleted users
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	get := h.userRepo.GetByID
+	if includeDeleted(c) {
+		get = h.userRepo.GetByIDIncludeDeleted
+	}
+	user, err := get(id)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser soft-deletes a user
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if err := h.userRepo.Delete(id); err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return
+	}
+	h.etags.Invalidate(middleware.UserETagKey(id))
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
+}
+
+// RestoreUser restores a soft-deleted user
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	err = h.userRepo.Restore(id)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "Another account has this user's email now")
+		return
+	}
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "Deleted user not found")
+		return
+	}
+	h.etags.Invalidate(middleware.UserETagKey(id))
+	c.JSON(http.StatusOK, gin.H{"message": "user restored"})
+}
+
+// SetUserRole changes a user's platform role. A changed role signs the user
+// out everywhere so no token keeps the old role.
+func (h *AdminHandler) SetUserRole(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var req models.SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	changed, err := h.userRepo.SetRole(id, req.Role)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return
+	}
+	if changed {
+		h.etags.Invalidate(middleware.UserETagKey(id))
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "role": req.Role, "changed": changed})
+}
+
+// GetChannel returns a channel; ?include_deleted=true also returns soft-deleted channels
+func (h *AdminHandler) GetChannel(c *gin.Context) {
+	get := h.channelRepo.GetBySlug
+	if includeDeleted(c) {
+		get = h.channelRepo.GetBySlugIncludeDeleted
+	}
+	ch, err := get(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	c.JSON(http.StatusOK, ch)
+}
+
+// DeleteChannel soft-deletes a channel
+func (h *AdminHandler) DeleteChannel(c *gin.Context) {
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	if err := h.channelRepo.Delete(ch.ID); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to delete channel")
+		return
+	}
+	h.etags.Invalidate(middleware.ChannelETagKey(ch.Slug))
+	c.JSON(http.StatusOK, gin.H{"message": "channel deleted"})
+}
+
+// RestoreChannel restores a soft-deleted channel
+func (h *AdminHandler) RestoreChannel(c *gin.Context) {
+	ch, err := h.channelRepo.GetBySlugIncludeDeleted(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	if err := h.channelRepo.Restore(ch.ID); err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Deleted channel not found")
+		return
+	}
+	h.etags.Invalidate(middleware.ChannelETagKey(ch.Slug))
+	c.JSON(http.StatusOK, gin.H{"message": "channel restored"})
+}
+
+// GetConversation returns a conversation; ?include_deleted=true also returns soft-deleted conversations
+func (h *AdminHandler) GetConversation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid conversation id")
+		return
+	}
+
+	get := h.convRepo.GetByID
+	if includeDeleted(c) {
+		get = h.convRepo.GetByIDIncludeDeleted
+	}
+	conv, err := get(id)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ConversationNotFound, "Conversation not found")
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// DeleteConversation soft-deletes a conversation
+func (h *AdminHandler) DeleteConversation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid conversation id")
+		return
+	}
+	if err := h.convRepo.Delete(id); err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ConversationNotFound, "Conversation not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "conversation deleted"})
+}
+
+// RestoreConversation restores a soft-deleted conversation
+func (h *AdminHandler) RestoreConversation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid conversation id")
+		return
+	}
+	if err := h.convRepo.Restore(id); err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ConversationNotFound, "Deleted conversation not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "conversation restored"})
+}
+
+// GetConversationMessages lists messages in a conversation; ?include_deleted=true also returns soft-deleted messages
+func (h *AdminHandler) GetConversationMessages(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid conversation id")
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	list := h.msgRepo.GetByConversationID
+	if includeDeleted(c) {
+		list = h.msgRepo.GetByConversationIDIncludeDeleted
+	}
+	messages, err := list(id, limit, offset)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+	c.JSON(http.StatusOK, messages)
+}
+
+// DeleteMessage soft-deletes a message
+func (h *AdminHandler) DeleteMessage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid message id")
+		return
+	}
+	msg, err := h.msgRepo.GetByID(id)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+	deletedAt, err := h.msgRepo.Delete(id, uid)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+	publishMessageDeleted(h.redis, msg, uid, deletedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "message deleted"})
+}
+
+// RestoreMessage restores a soft-deleted message
+func (h *AdminHandler) RestoreMessage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid message id")
+		return
+	}
+	if err := h.msgRepo.Restore(id); err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Deleted message not found")
+		return
+	}
+	if msg, err := h.msgRepo.GetByID(id); err == nil {
+		publishMessageRestored(h.redis, msg)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "message restored"})
+}
+
+// ListFollowBotReports returns a page of the follow bursts removed by the
+// follow-bot sweep, newest first
+func (h *AdminHandler) ListFollowBotReports(c *gin.Context) {
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	reports, err := h.botRepo.List(limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to list follow bot reports")
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(reports, limit, func(r models.FollowBotReport) pagination.Cursor {
+		return pagination.Cursor{Time: r.CreatedAt, ID: r.ID}
+	}))
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// AnalyticsHandler ingests the events clients report for channel analytics
+type AnalyticsHandler struct {
+	eventRepo *repository.AnalyticsEventRepository
+}
+
+func NewAnalyticsHandler(eventRepo *repository.AnalyticsEventRepository) *AnalyticsHandler {
+	return &AnalyticsHandler{eventRepo: eventRepo}
+}
+
+// IngestEvents stores a batch of client events. A batch with any event that
+// fails its schema is rejected as a whole, listing every failing field;
+// events for unknown channels or streams are dropped and counted.
+func (h *AnalyticsHandler) IngestEvents(c *gin.Context) {
+	var req models.IngestAnalyticsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	now := time.Now()
+	events := make([]models.AnalyticsEvent, 0, len(req.Events))
+	var fields []apierror.FieldError
+	for i := range req.Events {
+		e, err := req.Events[i].Validate(now)
+		var fe *models.AnalyticsFieldError
+		if errors.As(err, &fe) {
+			fields = append(fields, apierror.FieldError{Field: fmt.Sprintf("events[%d].%s", i, fe.Field), Rule: fe.Rule, Param: fe.Param})
+			continue
+		}
+		e.UserID = &uid
+		events = append(events, *e)
+	}
+	if len(fields) > 0 {
+		names := make([]string, len(fields))
+		for i, f := range fields {
+			names[i] = f.Field
+		}
+		apierror.Write(c, http.StatusBadRequest, apierror.ValidationFailed, "invalid fields: "+strings.Join(names, ", "), fields)
+		return
+	}
+
+	accepted, err := h.eventRepo.Insert(events)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to store analytics events")
+		return
+	}
+	c.JSON(http.StatusAccepted, models.IngestAnalyticsResponse{Accepted: accepted, Dropped: len(events) - accepted})
+}
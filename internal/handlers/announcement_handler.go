@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// AnnouncementHandler lets admins broadcast platform-wide announcements and
+// users read the ones addressed to them
+type AnnouncementHandler struct {
+	repo  *repository.AnnouncementRepository
+	redis *cache.RedisClient
+}
+
+func NewAnnouncementHandler(repo *repository.AnnouncementRepository, redis *cache.RedisClient) *AnnouncementHandler {
+	return &AnnouncementHandler{repo: repo, redis: redis}
+}
+
+// CreateAnnouncement stores an announcement and sends it right away, unless
+// publish_at is in the future; the announcements job sends those (admin only)
+func (h *AnnouncementHandler) CreateAnnouncement(c *gin.Context) {
+	var req models.CreateAnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	now := time.Now()
+	a := &models.Announcement{
+		ID:        uuid.New(),
+		Title:     req.Title,
+		Body:      req.Body,
+		Audience:  req.Audience,
+		PublishAt: now,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if a.Audience == "" {
+		a.Audience = models.AudienceAll
+	}
+	if req.PublishAt != nil && req.PublishAt.After(now) {
+		a.PublishAt = *req.PublishAt
+	}
+	if a.ExpiresAt != nil && !a.ExpiresAt.After(a.PublishAt) {
+		ErrorResponse(c, http.StatusBadRequest, "expires_at must be after publish_at")
+		return
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		uid := userID.(uuid.UUID)
+		a.CreatedBy = &uid
+	}
+
+	publishNow := a.PublishAt.Equal(now)
+	if err := h.repo.Create(a, publishNow); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create announcement")
+		return
+	}
+	if publishNow && h.redis != nil {
+		// Users are not told which admin wrote it
+		sent := *a
+		sent.CreatedBy = nil
+		if err := h.redis.PublishMessage(models.WSMessage{Event: models.EventAnnouncement, Payload: sent}); err != nil {
+			log.Printf("Failed to publish announcement %s: %v", a.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+// ListAnnouncements returns the latest announcements, scheduled ones
+// included (admin only)
+func (h *AnnouncementHandler) ListAnnouncements(c *gin.Context) {
+	announcements, err := h.repo.List(100)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get announcements")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"announcements": announcements})
+}
+
+// DeleteAnnouncement removes an announcement from the in-app list, or
+// cancels it before it goes out (admin only)
+func (h *AnnouncementHandler) DeleteAnnouncement(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid announcement ID")
+		return
+	}
+	deleted, err := h.repo.Delete(id)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete announcement")
+		return
+	}
+	if !deleted {
+		ErrorResponse(c, http.StatusNotFound, "Announcement not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListActive returns the current announcements for the current user, for
+// showing in-app to those who missed the event
+func (h *AnnouncementHandler) ListActive(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	announcements, err := h.repo.ListActive(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get announcements")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"announcements": announcements})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type APIKeyHandler struct {
+	keyRepo    *repository.APIKeyRepository
+	authEvents *repository.AuthEventRepository
+}
+
+func NewAPIKeyHandler(keyRepo *repository.APIKeyRepository, authEvents *repository.AuthEventRepository) *APIKeyHandler {
+	return &APIKeyHandler{keyRepo: keyRepo, authEvents: authEvents}
+}
+
+// CreateKey issues an API key for the current user. The key itself is only
+// returned here; afterwards it is identified by its hint.
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	secret, hint, err := auth.GenerateAPIKey()
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate API key")
+		return
+	}
+	key := &models.APIKey{ID: uuid.New(), UserID: uid, Name: req.Name, Hint: hint, Scopes: uniqueScopes(req.Scopes)}
+	if req.ExpiresInDays != nil {
+		expires := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		key.ExpiresAt = &expires
+	}
+	if err := h.keyRepo.Create(key, auth.HashAPIKey(secret)); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{APIKey: *key, Key: secret})
+}
+
+// ListKeys returns the current user's keys that are not revoked
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	keys, err := h.keyRepo.ListByUser(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// GetKey returns one of the current user's keys
+func (h *APIKeyHandler) GetKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	key, err := h.keyRepo.Get(id, uid)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// UpdateKey renames a key or changes its scopes; the change applies to the
+// key's next request
+func (h *APIKeyHandler) UpdateKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	var req models.UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	var scopes []string
+	if req.Scopes != nil {
+		scopes = uniqueScopes(req.Scopes)
+	}
+	key, err := h.keyRepo.Update(id, uid, req.Name, scopes)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// RevokeKey disables a key immediately and for good
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = h.keyRepo.Revoke(id, uid)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	auditAuth(c, h.authEvents, auditAPIKeyRevoked, uid, "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// uniqueScopes drops repeated scopes, keeping the first occurrence
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/asset"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// AssetHandler serves uploaded images by their content hash
+type AssetHandler struct {
+	assetRepo *repository.AssetRepository
+}
+
+func NewAssetHandler(assetRepo *repository.AssetRepository) *AssetHandler {
+	return &AssetHandler{assetRepo: assetRepo}
+}
+
+// GetAsset serves an image by its content hash. The content behind a hash
+// never changes, so browsers and CDNs may keep it for good.
+func (h *AssetHandler) GetAsset(c *gin.Context) {
+	hash := c.Param("hash")
+	if !asset.HashPattern.MatchString(hash) {
+		ErrorResponse(c, http.StatusNotFound, "Asset not found")
+		return
+	}
+	etag := `"` + hash + `"`
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	a, err := h.assetRepo.Get(hash)
+	if errors.Is(err, repository.ErrAssetNotFound) {
+		c.Header("Cache-Control", "no-store")
+		ErrorResponse(c, http.StatusNotFound, "Asset not found")
+		return
+	}
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get asset")
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, a.ContentType, a.Data)
+}
+
+// checkImages checks that an upload of images by scale has the 1x image and
+// no unknown scale, writing the error response when not
+func checkImages(c *gin.Context, images map[string][]byte) bool {
+	if len(images[models.ImageScale1x]) == 0 {
+		ErrorResponse(c, http.StatusBadRequest, "The 1x image is required")
+		return false
+	}
+	for scale := range images {
+		if !slices.Contains(asset.Scales, scale) {
+			ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Unknown image scale %q; use 1x, 2x or 4x", scale))
+			return false
+		}
+	}
+	return true
+}
+
+// storeImages saves checked images as assets and returns their URLs under
+// apiURL, writing the error response when one cannot be used or saved
+func storeImages(c *gin.Context, assetRepo *repository.AssetRepository, apiURL string, images map[string][]byte) (models.ImageVariants, bool) {
+	variants := models.ImageVariants{}
+	for _, scale := range asset.Scales {
+		if len(images[scale]) == 0 {
+			continue
+		}
+		a, err := asset.New(images[scale])
+		if err != nil {
+			ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Could not use the %s image: %v", scale, err))
+			return nil, false
+		}
+		if err := assetRepo.Save(a); err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to save image")
+			return nil, false
+		}
+		variants[scale] = apiURL + asset.Path(a.Hash)
+	}
+	return variants, true
+}
@@ -1,25 +1,88 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
 	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/mail"
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/middleware"
 	"github.com/tullo/backend/internal/models"
 	"github.com/tullo/backend/internal/repository"
 )
 
+// Lifetimes of emailed verification and password reset links
+const (
+	verifyTokenTTL = 48 * time.Hour
+	resetTokenTTL  = time.Hour
+)
+
+// Auth audit events, see auditAuth
+const (
+	auditRegistered     = "registered"
+	auditLoginSucceeded = "login_succeeded"
+	auditLoginFailed    = "login_failed"
+	auditLoginLocked    = "login_locked"
+	auditLoginRejected  = "login_rejected"
+	auditRefreshReused  = "refresh_token_reused"
+	auditPasswordReset  = "password_reset"
+	auditSessionRevoked = "session_revoked"
+	auditAPIKeyRevoked  = "api_key_revoked"
+)
+
+var authEvents = metrics.Default.NewCounterVec(
+	"tullo_auth_events_total",
+	"Authentication audit events, by event.",
+	"event",
+)
+
+// auditAuth records an authentication event in the audit log and counts it.
+// userID is uuid.Nil when the account is unknown; events of known accounts
+// are also stored in their security log, GET /me/security-events.
+func auditAuth(c *gin.Context, events *repository.AuthEventRepository, event string, userID uuid.UUID, email string) {
+	authEvents.Inc(event)
+	log.Printf("auth audit: event=%s user=%s email=%q ip=%s", event, userID, email, c.ClientIP())
+	if userID == uuid.Nil {
+		return
+	}
+	device := requestDevice(c)
+	e := &models.AuthEvent{UserID: userID, Event: event, IP: device.IP, UserAgent: device.UserAgent}
+	if err := events.Create(e); err != nil {
+		log.Printf("Failed to store auth event %s for %s: %v", event, userID, err)
+	}
+}
+
 type AuthHandler struct {
-	userRepo   *repository.UserRepository
-	jwtService *auth.JWTService
+	userRepo    *repository.UserRepository
+	emailRepo   *repository.EmailRepository
+	refreshRepo *repository.RefreshTokenRepository
+	jwtService  *auth.JWTService
+	mailer      *mail.Mailer
+	etags       *middleware.ETagCache
+	lockout     *middleware.LoginLockout
+	passwords   *auth.PasswordHasher
+	authEvents  *repository.AuthEventRepository
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository, jwtService *auth.JWTService) *AuthHandler {
+func NewAuthHandler(userRepo *repository.UserRepository, emailRepo *repository.EmailRepository, refreshRepo *repository.RefreshTokenRepository, jwtService *auth.JWTService, mailer *mail.Mailer, etags *middleware.ETagCache, lockout *middleware.LoginLockout, passwords *auth.PasswordHasher, authEvents *repository.AuthEventRepository) *AuthHandler {
 	return &AuthHandler{
-		userRepo:   userRepo,
-		jwtService: jwtService,
+		userRepo:    userRepo,
+		emailRepo:   emailRepo,
+		refreshRepo: refreshRepo,
+		jwtService:  jwtService,
+		mailer:      mailer,
+		etags:       etags,
+		lockout:     lockout,
+		passwords:   passwords,
+		authEvents:  authEvents,
 	}
 }
 
@@ -27,12 +90,12 @@ func NewAuthHandler(userRepo *repository.UserRepository, jwtService *auth.JWTSer
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req models.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		ValidationError(c, err)
 		return
 	}
 
 	// Hash password
-	hashedPassword, err := auth.HashPassword(req.Password)
+	hashedPassword, err := h.passwords.Hash(req.Password)
 	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to hash password")
 		return
@@ -49,55 +112,146 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		UpdatedAt:    time.Now(),
 	}
 
-	if err := h.userRepo.Create(user); err != nil {
+	err = h.userRepo.Create(user)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "An account with this email already exists")
+		return
+	}
+	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
 
-	// Generate token
-	token, err := h.jwtService.GenerateToken(user.ID, user.Email)
+	auditAuth(c, h.authEvents, auditRegistered, user.ID, user.Email)
+
+	// Registration succeeds even if the email can't be sent; the user can ask for another
+	if err := h.sendVerification(user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.ID, err)
+	}
+
+	resp, err := h.login(c, user)
 	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.LoginResponse{
-		Token: token,
-		User:  *user,
-	})
+	c.JSON(http.StatusCreated, resp)
 }
 
 // Login handles user login
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		ValidationError(c, err)
+		return
+	}
+
+	// Locked out emails and IPs are turned away before the password is
+	// checked, with the same answer whether or not the account exists
+	if wait := h.lockout.Locked(req.Email, c.ClientIP()); wait > 0 {
+		auditAuth(c, h.authEvents, auditLoginRejected, uuid.Nil, req.Email)
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		ErrorCode(c, http.StatusTooManyRequests, apierror.TooManyAttempts, "Too many login attempts; try again later")
 		return
 	}
 
 	// Get user by email
 	user, err := h.userRepo.GetByEmail(req.Email)
 	if err != nil {
-		ErrorResponse(c, http.StatusUnauthorized, "Invalid credentials")
+		h.loginFailed(c, uuid.Nil, req.Email)
 		return
 	}
 
 	// Check password
 	if err := auth.CheckPassword(user.PasswordHash, req.Password); err != nil {
-		ErrorResponse(c, http.StatusUnauthorized, "Invalid credentials")
+		h.loginFailed(c, user.ID, req.Email)
+		return
+	}
+	h.lockout.Reset(req.Email)
+	h.rehashPassword(user, req.Password)
+
+	resp, err := h.login(c, user)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// rehashPassword moves a hash made with another algorithm or older cost
+// parameters to the configured ones, now that the password is known. A
+// failure only delays the migration to the next login.
+func (h *AuthHandler) rehashPassword(user *models.User, password string) {
+	if !h.passwords.NeedsRehash(user.PasswordHash) {
+		return
+	}
+	hash, err := h.passwords.Hash(password)
+	if err == nil {
+		err = h.userRepo.RehashPassword(user.ID, user.PasswordHash, hash)
+	}
+	if err != nil {
+		log.Printf("Failed to rehash password for %s: %v", user.ID, err)
+		return
+	}
+	user.PasswordHash = hash
+}
+
+// loginFailed counts a failed password login towards the lockouts
+func (h *AuthHandler) loginFailed(c *gin.Context, userID uuid.UUID, email string) {
+	auditAuth(c, h.authEvents, auditLoginFailed, userID, email)
+	if wait := h.lockout.Fail(email, c.ClientIP()); wait > 0 {
+		auditAuth(c, h.authEvents, auditLoginLocked, userID, email)
+	}
+	ErrorCode(c, http.StatusUnauthorized, apierror.InvalidCredentials, "Invalid credentials")
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token works once; presenting a used one again revokes
+// every token descended from the same login.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	refreshToken, expiresAt, err := h.jwtService.GenerateRefreshToken()
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	uid, sessionID, err := h.refreshRepo.Rotate(auth.HashRefreshToken(req.RefreshToken), auth.HashRefreshToken(refreshToken), expiresAt, requestDevice(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			auditAuth(c, h.authEvents, auditRefreshReused, uid, "")
+			ErrorCode(c, http.StatusUnauthorized, apierror.RefreshTokenReused, "Refresh token has already been used")
+		case errors.Is(err, repository.ErrRefreshTokenInvalid):
+			ErrorCode(c, http.StatusUnauthorized, apierror.InvalidToken, "Invalid or expired refresh token")
+		default:
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to refresh token")
+		}
+		return
+	}
+
+	user, err := h.userRepo.GetByID(uid)
+	if err != nil {
+		ErrorCode(c, http.StatusUnauthorized, apierror.InvalidToken, "Invalid or expired refresh token")
 		return
 	}
 
-	// Generate token
-	token, err := h.jwtService.GenerateToken(user.ID, user.Email)
+	token, err := h.jwtService.GenerateSessionToken(user.ID, user.Email, user.Role, sessionID)
 	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	c.JSON(http.StatusOK, models.LoginResponse{
-		Token: token,
-		User:  *user,
+	c.JSON(http.StatusOK, models.RefreshResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.jwtService.ExpiresIn().Seconds()),
 	})
 }
 
@@ -108,9 +262,257 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 
 	user, err := h.userRepo.GetByID(uid)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "User not found")
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
 		return
 	}
 
 	c.JSON(http.StatusOK, user)
 }
+
+// UpdateMe updates the current user's profile with optimistic locking
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	user, err := h.userRepo.GetByID(uid)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return
+	}
+
+	if req.DisplayName != nil {
+		user.DisplayName = *req.DisplayName
+	}
+	if req.AvatarURL != nil {
+		user.AvatarURL = req.AvatarURL
+	}
+	if err := user.Validate(); err != nil {
+		ErrorCode(c, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+	user.Version = req.Version
+
+	if err := h.userRepo.Update(user); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			ErrorCode(c, http.StatusConflict, apierror.VersionConflict, "user was modified by another request")
+			return
+		}
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
+	h.etags.Invalidate(middleware.UserETagKey(uid))
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Guest issues a short-lived token that lets a signed-out viewer read
+// channel chats over REST and the WebSocket, but not post
+func (h *AuthHandler) Guest(c *gin.Context) {
+	token, guestID, err := h.jwtService.GenerateGuestToken()
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GuestTokenResponse{
+		Token:     token,
+		GuestID:   guestID,
+		ExpiresIn: int(h.jwtService.GuestExpiresIn().Seconds()),
+	})
+}
+
+// SetUsername sets or changes the current user's username, their handle in
+// @mentions and channel chats
+func (h *AuthHandler) SetUsername(c *gin.Context) {
+	var req models.SetUsernameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	username, err := models.NormalizeUsername(req.Username)
+	if err != nil {
+		ErrorCode(c, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	user, err := h.userRepo.GetByID(uid)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return
+	}
+
+	if err := h.userRepo.SetUsername(user, username); err != nil {
+		if errors.Is(err, repository.ErrUsernameTaken) {
+			ErrorCode(c, http.StatusConflict, apierror.UsernameTaken, "Username is taken")
+			return
+		}
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to set username")
+		return
+	}
+	h.etags.Invalidate(middleware.UserETagKey(uid))
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ResendVerification emails a new verification link to the current user
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	user, err := h.userRepo.GetByID(uid)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		ErrorResponse(c, http.StatusConflict, "Email already verified")
+		return
+	}
+
+	if err := h.sendVerification(user); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+// VerifyEmail confirms an address using the token from a verification email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	uid, err := h.emailRepo.ConsumeToken(req.Token, repository.TokenVerifyEmail)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidToken) {
+			ErrorCode(c, http.StatusBadRequest, apierror.InvalidToken, "Invalid or expired token")
+			return
+		}
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+	h.etags.Invalidate(middleware.UserETagKey(uid))
+
+	if err := h.userRepo.MarkEmailVerified(uid); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the address belongs to an account.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	if user, err := h.userRepo.GetByEmail(req.Email); err == nil {
+		token, err := h.emailRepo.CreateToken(user.ID, repository.TokenPasswordReset, resetTokenTTL)
+		if err == nil {
+			err = h.mailer.SendPasswordReset(user, token, resetTokenTTL)
+		}
+		if err != nil {
+			log.Printf("Failed to send password reset email to %s: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using the token from a reset email
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	uid, err := h.emailRepo.ConsumeToken(req.Token, repository.TokenPasswordReset)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidToken) {
+			ErrorCode(c, http.StatusBadRequest, apierror.InvalidToken, "Invalid or expired token")
+			return
+		}
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	hashedPassword, err := h.passwords.Hash(req.Password)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+	if err := h.userRepo.UpdatePassword(uid, hashedPassword); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	// The link proved control of the mailbox, so the address counts as verified
+	if err := h.userRepo.MarkEmailVerified(uid); err != nil {
+		log.Printf("Failed to mark email verified for %s: %v", uid, err)
+	}
+	// Whoever knew the old password may hold refresh tokens; sign them out
+	if err := h.refreshRepo.RevokeAll(uid, repository.RevokedPasswordReset); err != nil {
+		log.Printf("Failed to revoke refresh tokens for %s: %v", uid, err)
+	}
+	h.etags.Invalidate(middleware.UserETagKey(uid))
+	auditAuth(c, h.authEvents, auditPasswordReset, uid, "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+}
+
+// login starts a session on the requesting device: a new refresh token
+// family and an access token bound to it
+func (h *AuthHandler) login(c *gin.Context, user *models.User) (*models.LoginResponse, error) {
+	refreshToken, expiresAt, err := h.jwtService.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	sessionID, err := h.refreshRepo.Create(user.ID, auth.HashRefreshToken(refreshToken), expiresAt, requestDevice(c))
+	if err != nil {
+		return nil, err
+	}
+	token, err := h.jwtService.GenerateSessionToken(user.ID, user.Email, user.Role, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	auditAuth(c, h.authEvents, auditLoginSucceeded, user.ID, user.Email)
+	return &models.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.jwtService.ExpiresIn().Seconds()),
+		User:         *user,
+	}, nil
+}
+
+// requestDevice describes the client making the request for its session
+func requestDevice(c *gin.Context) models.Device {
+	ua := c.Request.UserAgent()
+	if len(ua) > 255 {
+		ua = strings.ToValidUTF8(ua[:255], "")
+	}
+	return models.Device{UserAgent: ua, IP: c.ClientIP()}
+}
+
+func (h *AuthHandler) sendVerification(user *models.User) error {
+	token, err := h.emailRepo.CreateToken(user.ID, repository.TokenVerifyEmail, verifyTokenTTL)
+	if err != nil {
+		return err
+	}
+	return h.mailer.SendVerification(user, token, verifyTokenTTL)
+}
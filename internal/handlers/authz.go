@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+)
+
+// permitted reports the outcome of an authz.Policy check. When the check
+// failed or denied the caller it writes a 500 or a 403 with denied and
+// returns false.
+func permitted(c *gin.Context, ok bool, err error, denied string) bool {
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to check permissions")
+		return false
+	}
+	if !ok {
+		ErrorResponse(c, http.StatusForbidden, denied)
+		return false
+	}
+	return true
+}
+
+// postDenied writes the response for an authz.Policy CanPost or CanChat error
+func postDenied(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, authz.ErrNotMember):
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
+	case errors.Is(err, authz.ErrBanned):
+		ErrorCode(c, http.StatusForbidden, apierror.Banned, "You are banned from this chat")
+	case errors.Is(err, authz.ErrMuted):
+		ErrorCode(c, http.StatusForbidden, apierror.Muted, "You are muted in this chat")
+	default:
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to check permissions")
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// badgeRoles are the roles a channel may give a chat badge
+var badgeRoles = map[string]bool{
+	models.ChannelRoleOwner:     true,
+	models.ChannelRoleModerator: true,
+	models.ChannelRoleVIP:       true,
+}
+
+// BadgeHandler manages the channels' chat badges. Their images are stored
+// as assets and served from apiURL under their content hash; channel chat
+// messages carry the sender's badge with its images.
+type BadgeHandler struct {
+	channelRepo *repository.ChannelRepository
+	badgeRepo   *repository.BadgeRepository
+	assetRepo   *repository.AssetRepository
+	policy      *authz.Policy
+	apiURL      string
+}
+
+func NewBadgeHandler(chRepo *repository.ChannelRepository, badgeRepo *repository.BadgeRepository, assetRepo *repository.AssetRepository, policy *authz.Policy, apiURL string) *BadgeHandler {
+	return &BadgeHandler{channelRepo: chRepo, badgeRepo: badgeRepo, assetRepo: assetRepo, policy: policy, apiURL: apiURL}
+}
+
+// ownedChannel loads the channel in the path and checks that the caller
+// owns it, writing the error response when not
+func (h *BadgeHandler) ownedChannel(c *gin.Context) (*models.Channel, bool) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return nil, false
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only the owner can manage badges") {
+		return nil, false
+	}
+	return ch, true
+}
+
+// ListBadges returns the channel's badges
+func (h *BadgeHandler) ListBadges(c *gin.Context) {
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	badges, err := h.badgeRepo.ListByChannel(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list badges")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"badges": badges})
+}
+
+// PutBadge sets or replaces the badge of a role (owner only)
+func (h *BadgeHandler) PutBadge(c *gin.Context) {
+	role := c.Param("role")
+	if !badgeRoles[role] {
+		ErrorResponse(c, http.StatusBadRequest, "Badges are for the owner, moderator and vip roles")
+		return
+	}
+	var req models.PutBadgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	if !checkImages(c, req.Images) {
+		return
+	}
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	images, ok := storeImages(c, h.assetRepo, h.apiURL, req.Images)
+	if !ok {
+		return
+	}
+
+	b := &models.ChannelBadge{ChannelID: ch.ID, Role: role, Images: images}
+	if err := h.badgeRepo.Put(b); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to save badge")
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// DeleteBadge removes the badge of a role (owner only)
+func (h *BadgeHandler) DeleteBadge(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	deleted, err := h.badgeRepo.Delete(ch.ID, c.Param("role"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete badge")
+		return
+	}
+	if !deleted {
+		ErrorResponse(c, http.StatusNotFound, "Badge not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// BotScoreHandler shows a channel's moderators which chatters the
+// moderation bot takes for bots
+type BotScoreHandler struct {
+	channelRepo *repository.ChannelRepository
+	scores      *repository.BotScoreRepository
+	policy      *authz.Policy
+}
+
+func NewBotScoreHandler(chRepo *repository.ChannelRepository, scores *repository.BotScoreRepository, policy *authz.Policy) *BotScoreHandler {
+	return &BotScoreHandler{channelRepo: chRepo, scores: scores, policy: policy}
+}
+
+// ListBotScores returns the chatters' bot scores, most suspicious first
+// (owner and moderators only)
+func (h *BotScoreHandler) ListBotScores(c *gin.Context) {
+	var req models.ListBotScoresRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "Only moderators can see bot scores") {
+		return
+	}
+
+	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get conversation")
+		return
+	}
+	scores, err := h.scores.ListByConversation(convID, req.MinScore, req.Limit)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list bot scores")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scores": scores})
+}
@@ -1,101 +1,41 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
-	"strconv"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/authz"
 	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/middleware"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/preview"
 	"github.com/tullo/backend/internal/repository"
 )
 
 type ChannelChatHandler struct {
 	channelRepo *repository.ChannelRepository
-	convRepo    *repository.ConversationRepository
 	msgRepo     *repository.MessageRepository
 	redis       *cache.RedisClient
-	// in-memory limiter fallback (token-bucket per user)
-	buckets   map[uuid.UUID]*tokenBucket
-	bucketsMu sync.Mutex
-	// bucket params (configurable)
-	localRate  float64 // tokens per second
-	localBurst float64 // capacity
+	reports     *auth.ReportSigner
+	sends       *middleware.SendLimiter
+	policy      *authz.Policy
+	previews    *preview.Service
 }
 
-func NewChannelChatHandler(chRepo *repository.ChannelRepository, convRepo *repository.ConversationRepository, msgRepo *repository.MessageRepository, redis *cache.RedisClient, localRate float64, localBurst float64) *ChannelChatHandler {
-	h := &ChannelChatHandler{
+func NewChannelChatHandler(chRepo *repository.ChannelRepository, msgRepo *repository.MessageRepository, redis *cache.RedisClient, reports *auth.ReportSigner, sends *middleware.SendLimiter, policy *authz.Policy, previews *preview.Service) *ChannelChatHandler {
+	return &ChannelChatHandler{
 		channelRepo: chRepo,
-		convRepo:    convRepo,
 		msgRepo:     msgRepo,
 		redis:       redis,
-		buckets:     make(map[uuid.UUID]*tokenBucket),
-		localRate:   localRate,
-		localBurst:  localBurst,
-	}
-
-	// start a background cleanup/refill goroutine
-	go h.runRefillLoop()
-
-	return h
-}
-
-// tokenBucket is a simple in-memory token bucket
-type tokenBucket struct {
-	mu         sync.Mutex
-	tokens     float64
-	lastRefill time.Time
-	rate       float64
-	capacity   float64
-}
-
-func (b *tokenBucket) allow() bool {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	now := time.Now()
-	elapsed := now.Sub(b.lastRefill).Seconds()
-	if elapsed > 0 {
-		b.tokens += elapsed * b.rate
-		if b.tokens > b.capacity {
-			b.tokens = b.capacity
-		}
-		b.lastRefill = now
-	}
-
-	if b.tokens >= 1 {
-		b.tokens -= 1
-		return true
-	}
-	return false
-}
-
-func (h *ChannelChatHandler) runRefillLoop() {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-	for range ticker.C {
-		h.bucketsMu.Lock()
-		now := time.Now()
-		// refill each bucket; also remove stale buckets
-		for uid, b := range h.buckets {
-			b.mu.Lock()
-			elapsed := now.Sub(b.lastRefill).Seconds()
-			if elapsed > 0 {
-				b.tokens += elapsed * b.rate
-				if b.tokens > b.capacity {
-					b.tokens = b.capacity
-				}
-				b.lastRefill = now
-			}
-			// remove bucket if unused for > 10 minutes to prevent leaks
-			if now.Sub(b.lastRefill) > 10*time.Minute && b.tokens == b.capacity {
-				delete(h.buckets, uid)
-			}
-			b.mu.Unlock()
-		}
-		h.bucketsMu.Unlock()
+		reports:     reports,
+		sends:       sends,
+		policy:      policy,
+		previews:    previews,
 	}
 }
 
@@ -104,7 +44,7 @@ func (h *ChannelChatHandler) GetChat(c *gin.Context) {
 	slug := c.Param("slug")
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 
@@ -115,51 +55,43 @@ func (h *ChannelChatHandler) GetChat(c *gin.Context) {
 		return
 	}
 
-	// parse query params
-	limit := 50
-	if l := c.Query("limit"); l != "" {
-		if li, err := strconv.Atoi(l); err == nil {
-			limit = li
-		}
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(uuid.UUID)
+	if err := h.policy.CanViewChat(convID, uid); err != nil {
+		postDenied(c, err)
+		return
 	}
 
-	// support opaque cursor via message IDs: before_id / after_id
-	var beforePtr *time.Time
-	var afterPtr *time.Time
-	if bs := c.Query("before_id"); bs != "" {
-		if id, err := uuid.Parse(bs); err == nil {
-			if m, err := h.msgRepo.GetByID(id); err == nil {
-				beforePtr = &m.CreatedAt
-			} else {
-				ErrorResponse(c, http.StatusBadRequest, "invalid before_id")
-				return
-			}
-		} else {
-			ErrorResponse(c, http.StatusBadRequest, "invalid before_id")
-			return
+	// Loading the chat counts as watching the channel for the owner's dashboard
+	if h.redis != nil && uid != uuid.Nil {
+		if err := h.redis.TouchViewer(ch.ID, uid); err != nil {
+			log.Printf("Failed to record viewer for channel %s: %v", ch.Slug, err)
 		}
 	}
-	if as := c.Query("after_id"); as != "" {
-		if id, err := uuid.Parse(as); err == nil {
-			if m, err := h.msgRepo.GetByID(id); err == nil {
-				afterPtr = &m.CreatedAt
-			} else {
-				ErrorResponse(c, http.StatusBadRequest, "invalid after_id")
-				return
-			}
-		} else {
-			ErrorResponse(c, http.StatusBadRequest, "invalid after_id")
+
+	// Moderators can review deleted messages, including what automod removed
+	withDeleted := c.Query("include_deleted") == "true"
+	if withDeleted {
+		allowed, err := h.policy.CanModerate(ch, uid)
+		if !permitted(c, allowed, err, "Only moderators can see deleted messages") {
 			return
 		}
 	}
 
-	messages, err := h.msgRepo.GetByConversationIDCursor(convID, limit, beforePtr, afterPtr)
-	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to get messages")
-		return
-	}
+	listMessages(c, h.msgRepo, convID, withDeleted, func(messages []models.Message) []models.Message {
+		return chatSenders(withReportTokens(h.reports, messages))
+	})
+}
 
-	c.JSON(http.StatusOK, messages)
+// chatSenders hides the senders' email addresses from a public channel chat,
+// which shows their usernames and display names instead
+func chatSenders(messages []models.Message) []models.Message {
+	for i := range messages {
+		if s := messages[i].Sender; s != nil {
+			s.Email = ""
+		}
+	}
+	return messages
 }
 
 // Post chat message to channel
@@ -167,7 +99,7 @@ func (h *ChannelChatHandler) PostChat(c *gin.Context) {
 	slug := c.Param("slug")
 	var req models.SendMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		ValidationError(c, err)
 		return
 	}
 
@@ -176,7 +108,7 @@ func (h *ChannelChatHandler) PostChat(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 
@@ -186,52 +118,13 @@ func (h *ChannelChatHandler) PostChat(c *gin.Context) {
 		return
 	}
 
-	// Moderation check: ensure user isn't muted/banned
-	muted, banned, err := h.convRepo.IsUserMutedOrBanned(convID, uid)
-	if err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to check moderation")
-		return
-	}
-	if banned {
-		ErrorResponse(c, http.StatusForbidden, "banned")
-		return
-	}
-	if muted {
-		ErrorResponse(c, http.StatusForbidden, "muted")
+	if err := h.policy.CanChat(convID, uid); err != nil {
+		postDenied(c, err)
 		return
 	}
 
-	// Rate limit: try Redis first
-	allowed := true
-	if h.redis != nil {
-		ok, err := h.redis.AllowAction(uid, "channel_chat", int(h.localRate), int(h.localBurst))
-		if err != nil {
-			// fallback to local limiter if Redis errors
-			allowed = false
-		} else {
-			allowed = ok
-		}
-	}
-
-	if h.redis == nil || !allowed {
-		// use in-memory token bucket fallback
-		h.bucketsMu.Lock()
-		b, ok := h.buckets[uid]
-		if !ok {
-			b = &tokenBucket{
-				tokens:     h.localBurst,
-				lastRefill: time.Now(),
-				rate:       h.localRate,
-				capacity:   h.localBurst,
-			}
-			h.buckets[uid] = b
-		}
-		h.bucketsMu.Unlock()
-
-		if !b.allow() {
-			ErrorResponse(c, http.StatusTooManyRequests, "rate_limited")
-			return
-		}
+	if !limitSend(c, h.sends, models.ConversationChannel, convID, uid) {
+		return
 	}
 
 	// create message
@@ -245,14 +138,17 @@ func (h *ChannelChatHandler) PostChat(c *gin.Context) {
 	}
 
 	if err := h.msgRepo.Create(message); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to send message")
+		sendFailed(c, err)
 		return
 	}
+	message.ReportToken = h.reports.Token(message.ID)
 
 	// publish via Redis (if available) for real-time broadcast
 	if h.redis != nil {
 		h.redis.PublishMessage(models.WSMessage{Event: models.EventMessageNew, Payload: message})
+		h.redis.RecordChatMessage(convID, uid)
 	}
+	h.previews.Enqueue(message)
 
 	c.JSON(http.StatusCreated, message)
 }
@@ -1,32 +1,61 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/mail"
+	"github.com/tullo/backend/internal/middleware"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/moderation"
+	"github.com/tullo/backend/internal/notify"
+	"github.com/tullo/backend/internal/pagination"
 	"github.com/tullo/backend/internal/repository"
 )
 
 type ChannelHandler struct {
 	channelRepo *repository.ChannelRepository
 	streamRepo  *repository.StreamRepository
+	watchRepo   *repository.WatchHistoryRepository
+	prefsRepo   *repository.ContentPreferenceRepository
 	convRepo    *repository.ConversationRepository
 	userRepo    *repository.UserRepository
 	modRepo     *repository.ModerationRepository
+	emailRepo   *repository.EmailRepository
+	mailer      *mail.Mailer
+	etags       *middleware.ETagCache
+	redis       *cache.RedisClient
+	policy      *authz.Policy
+	moderation  *moderation.Service
+	followGuard *middleware.FollowGuard
+	// followAlertsAggregateAt is the follower count from which follows are
+	// announced in aggregate by the follow_alerts job (0 never)
+	followAlertsAggregateAt int
+	// maxChannels and createCooldown limit channel creation per user (0 off)
+	maxChannels    int
+	createCooldown time.Duration
 }
 
-func NewChannelHandler(chRepo *repository.ChannelRepository, sRepo *repository.StreamRepository, convRepo *repository.ConversationRepository, userRepo *repository.UserRepository, modRepo *repository.ModerationRepository) *ChannelHandler {
-	return &ChannelHandler{channelRepo: chRepo, streamRepo: sRepo, convRepo: convRepo, userRepo: userRepo, modRepo: modRepo}
+func NewChannelHandler(chRepo *repository.ChannelRepository, sRepo *repository.StreamRepository, watchRepo *repository.WatchHistoryRepository, prefsRepo *repository.ContentPreferenceRepository, convRepo *repository.ConversationRepository, userRepo *repository.UserRepository, modRepo *repository.ModerationRepository, emailRepo *repository.EmailRepository, mailer *mail.Mailer, etags *middleware.ETagCache, redis *cache.RedisClient, policy *authz.Policy, moderation *moderation.Service, followGuard *middleware.FollowGuard, followAlertsAggregateAt int, maxChannels int, createCooldown time.Duration) *ChannelHandler {
+	return &ChannelHandler{channelRepo: chRepo, streamRepo: sRepo, watchRepo: watchRepo, prefsRepo: prefsRepo, convRepo: convRepo, userRepo: userRepo, modRepo: modRepo, emailRepo: emailRepo, mailer: mailer, etags: etags, redis: redis, policy: policy, moderation: moderation, followGuard: followGuard, followAlertsAggregateAt: followAlertsAggregateAt, maxChannels: maxChannels, createCooldown: createCooldown}
 }
 
-// Create channel
+// Create channel. Users may own maxChannels channels and create one every
+// createCooldown; platform admins are exempt.
 func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 	var req models.CreateChannelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		ValidationError(c, err)
 		return
 	}
 
@@ -45,7 +74,22 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := h.channelRepo.Create(ch); err != nil {
+	var err error
+	if models.HasRole(c.GetString("role"), models.RoleAdmin) {
+		err = h.channelRepo.Create(ch)
+	} else {
+		err = h.channelRepo.CreateLimited(ch, h.maxChannels, h.createCooldown)
+	}
+	var cooldown *repository.ChannelCooldownError
+	switch {
+	case errors.Is(err, repository.ErrChannelLimit):
+		ErrorCode(c, http.StatusForbidden, apierror.ChannelLimitReached, fmt.Sprintf("You can own at most %d channels", h.maxChannels))
+		return
+	case errors.As(err, &cooldown):
+		c.Header("Retry-After", strconv.Itoa(int(cooldown.RetryAfter.Seconds())+1))
+		ErrorCode(c, http.StatusTooManyRequests, apierror.ChannelCooldown, "You created a channel recently; try again later")
+		return
+	case err != nil:
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to create channel")
 		return
 	}
@@ -62,7 +106,7 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 		ID:             uuid.New(),
 		ConversationID: convID,
 		UserID:         uid,
-		Role:           "moderator",
+		Role:           authz.RoleModerator,
 		JoinedAt:       time.Now(),
 	}
 	if err := h.convRepo.AddMember(member); err != nil {
@@ -78,7 +122,7 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 				ID:             uuid.New(),
 				ConversationID: convID,
 				UserID:         bot.ID,
-				Role:           "moderator",
+				Role:           authz.RoleModerator,
 				JoinedAt:       time.Now(),
 			}
 			_ = h.convRepo.AddMember(botMember)
@@ -88,21 +132,181 @@ func (h *ChannelHandler) CreateChannel(c *gin.Context) {
 	c.JSON(http.StatusCreated, ch)
 }
 
+// ListChannels returns a page of channels, newest first
+func (h *ChannelHandler) ListChannels(c *gin.Context) {
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	channels, err := h.channelRepo.List(limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to list channels")
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(channels, limit, func(ch models.Channel) pagination.Cursor {
+		return pagination.Cursor{Time: ch.CreatedAt, ID: ch.ID}
+	}))
+}
+
 // Get channel by slug
 func (h *ChannelHandler) GetChannel(c *gin.Context) {
 	slug := c.Param("slug")
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	stats, err := h.channelRepo.CallerStats(ch.ID, uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to load channel")
 		return
 	}
 
+	page := models.ChannelPage{
+		Channel:   *ch,
+		Followers: stats.Followers,
+		Following: stats.Following,
+		Role:      channelRole(ch, uid, stats),
+	}
+	if !h.policy.CanManage(ch, uid) {
+		page.Channel.FollowAlerts = nil
+	}
+
 	// attach latest stream info if any
-	stream, _ := h.streamRepo.GetByChannel(ch.ID)
-	c.JSON(http.StatusOK, gin.H{"channel": ch, "stream": stream})
+	if stream, err := h.streamRepo.GetByChannel(ch.ID); err == nil {
+		if !h.policy.CanManage(ch, uid) {
+			stream.IngestURL, stream.StreamKey = nil, nil
+			if !viewerPreferences(h.prefsRepo, uid).CanPlay(stream.Mature) {
+				stream.HLSURL = nil
+			}
+		}
+		page.Stream = stream
+		page.Live = stream.Status == "live"
+	}
+
+	// Viewers and users with the chat open over WebSocket, whether or not a
+	// stream is live; reported as zero without Redis
+	if h.redis != nil {
+		ids := []uuid.UUID{ch.ID}
+		if counts, err := h.redis.CountViewers(ids); err == nil {
+			page.Viewers = counts[ch.ID]
+		}
+		if counts, err := h.redis.ChatViewers(ids); err == nil {
+			page.ChatViewers = counts[ch.ID]
+		}
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// channelRole is the caller's role on the channel page
+func channelRole(ch *models.Channel, uid uuid.UUID, stats *models.ChannelCallerStats) string {
+	switch {
+	case ch.OwnerID == uid:
+		return models.ChannelRoleOwner
+	case stats.Banned:
+		return models.ChannelRoleBanned
+	case authz.IsModeratorRole(stats.MemberRole):
+		return models.ChannelRoleModerator
+	case stats.MemberRole == authz.RoleVIP:
+		return models.ChannelRoleVIP
+	default:
+		return models.ChannelRoleViewer
+	}
+}
+
+// UpdateChannel updates channel metadata with optimistic locking. Only owner can update.
+func (h *ChannelHandler) UpdateChannel(c *gin.Context) {
+	slug := c.Param("slug")
+	var req models.UpdateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(slug)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can update channel") {
+		return
+	}
+
+	if req.Title != nil {
+		ch.Title = *req.Title
+	}
+	if req.Description != nil {
+		ch.Description = req.Description
+	}
+	if req.Language != nil {
+		ch.Language = req.Language
+	}
+	if req.Tags != nil {
+		ch.Tags = *req.Tags
+	}
+	if req.ChatRules != nil {
+		ch.ChatRules = req.ChatRules
+		if *req.ChatRules == "" {
+			ch.ChatRules = nil
+		}
+	}
+	if req.FollowAlerts != nil {
+		ch.FollowAlerts = req.FollowAlerts
+	}
+	ch.Version = req.Version
+
+	if err := h.channelRepo.Update(ch); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			ErrorCode(c, http.StatusConflict, apierror.VersionConflict, "channel was modified by another request")
+			return
+		}
+		ErrorResponse(c, http.StatusInternalServerError, "failed to update channel")
+		return
+	}
+	if req.ChatFormatting != nil {
+		if err := h.channelRepo.SetChatFormatting(ch.ID, *req.ChatFormatting); err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "failed to update channel")
+			return
+		}
+		ch.ChatFormatting = req.ChatFormatting
+	}
+	if req.ChatRetentionDays != nil || req.ChatRetentionAction != nil {
+		if err := h.channelRepo.SetChatRetention(ch.ID, req.ChatRetentionDays, req.ChatRetentionAction); err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "failed to update channel")
+			return
+		}
+		if req.ChatRetentionDays != nil {
+			ch.ChatRetentionDays = req.ChatRetentionDays
+		}
+		if req.ChatRetentionAction != nil {
+			ch.ChatRetentionAction = req.ChatRetentionAction
+		}
+	}
+	if req.ChatMaxLength != nil || req.ChatMaxEmotes != nil {
+		if err := h.channelRepo.SetChatLimits(ch.ID, req.ChatMaxLength, req.ChatMaxEmotes); err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "failed to update channel")
+			return
+		}
+		if req.ChatMaxLength != nil {
+			ch.ChatMaxLength = req.ChatMaxLength
+		}
+		if req.ChatMaxEmotes != nil {
+			ch.ChatMaxEmotes = req.ChatMaxEmotes
+		}
+	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
+
+	c.JSON(http.StatusOK, ch)
 }
 
-// StartStream starts a new stream for the channel. Only owner can start.
+// StartStream starts a new stream for the channel, optionally marked mature
+// and tagged. Only owner can start.
 func (h *ChannelHandler) StartStream(c *gin.Context) {
 	slug := c.Param("slug")
 	userID, _ := c.Get("user_id")
@@ -110,34 +314,64 @@ func (h *ChannelHandler) StartStream(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
-	if ch.OwnerID != uid {
-		ErrorResponse(c, http.StatusForbidden, "only owner can start stream")
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can start stream") {
 		return
 	}
+	var req models.StartStreamRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			ValidationError(c, err)
+			return
+		}
+	}
 
 	now := time.Now()
 	key := uuid.New().String()
 	s := &models.Stream{
-		ID:        uuid.New(),
-		ChannelID: ch.ID,
-		Status:    "live",
-		StreamKey: &key,
-		StartedAt: &now,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          uuid.New(),
+		ChannelID:   ch.ID,
+		Status:      "live",
+		StreamKey:   &key,
+		Mature:      req.Mature,
+		ContentTags: models.NormalizeContentTags(req.ContentTags),
+		StartedAt:   &now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
 	if err := h.streamRepo.Create(s); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to start stream")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
+
+	go h.notifyLive(ch)
 
 	c.JSON(http.StatusCreated, s)
 }
 
+// notifyLive emails the channel's followers that it went live
+func (h *ChannelHandler) notifyLive(ch *models.Channel) {
+	recipients, err := h.emailRepo.ListLiveRecipients(ch.ID)
+	if err != nil {
+		log.Printf("Failed to list followers to notify for %s: %v", ch.Slug, err)
+		return
+	}
+	for _, r := range recipients {
+		// ListLiveRecipients only returns followers who want these emails
+		decision := notify.Decide(notify.KindChannelLive, notify.Email, notify.Recipient{Wants: true, DoNotDisturb: r.DoNotDisturb})
+		if decision.Outcome != notify.Deliver {
+			continue
+		}
+		if err := h.mailer.SendChannelLive(r, ch); err != nil {
+			log.Printf("Failed to email %s that %s went live: %v", r.UserID, ch.Slug, err)
+		}
+	}
+}
+
 // EndStream ends the active stream. Owner or moderator can end.
 func (h *ChannelHandler) EndStream(c *gin.Context) {
 	slug := c.Param("slug")
@@ -146,28 +380,18 @@ func (h *ChannelHandler) EndStream(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 
-	// allow owner or moderator
-	if ch.OwnerID != uid {
-		// check moderator role via conversation
-		convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
-		if err != nil {
-			ErrorResponse(c, http.StatusInternalServerError, "failed to check permissions")
-			return
-		}
-		role, err := h.convRepo.GetMemberRole(convID, uid)
-		if err != nil || (role != "moderator" && role != "admin") {
-			ErrorResponse(c, http.StatusForbidden, "only owner/moderator can end stream")
-			return
-		}
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "only owner/moderator can end stream") {
+		return
 	}
 
 	stream, err := h.streamRepo.GetByChannel(ch.ID)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "no active stream found")
+		ErrorCode(c, http.StatusNotFound, apierror.StreamNotFound, "no active stream found")
 		return
 	}
 	now := time.Now()
@@ -175,21 +399,71 @@ func (h *ChannelHandler) EndStream(c *gin.Context) {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to end stream")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
 
 	c.JSON(http.StatusOK, gin.H{"message": "stream ended"})
 }
 
-// GetActiveStreams returns currently live streams for the explore page
+// GetActiveStreams returns currently live streams for the explore page, each
+// with its channel, owner, followers and viewers. Viewers come from Redis;
+// without it, or if it fails, they are reported as zero. With
+// ?sort=recommended, channels the caller watched most lately come first.
 func (h *ChannelHandler) GetActiveStreams(c *gin.Context) {
+	order := c.DefaultQuery("sort", "recent")
+	if order != "recent" && order != "recommended" {
+		ErrorResponse(c, http.StatusBadRequest, "sort must be recent or recommended")
+		return
+	}
+
 	limit := 50
-	streams, err := h.streamRepo.GetActiveStreams(limit)
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+	streams, err := h.streamRepo.GetActiveStreamsWithChannels(limit, viewerPreferences(h.prefsRepo, uid))
 	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to get active streams")
 		return
 	}
+
+	if h.redis != nil && len(streams) > 0 {
+		ids := make([]uuid.UUID, len(streams))
+		for i, s := range streams {
+			ids[i] = s.ChannelID
+		}
+		viewers, err := h.redis.CountViewers(ids)
+		if err != nil {
+			log.Printf("Failed to count viewers: %v", err)
+		}
+		for i := range streams {
+			streams[i].Viewers = viewers[streams[i].ChannelID]
+		}
+	}
+	if order == "recommended" {
+		h.recommend(uid, streams)
+	}
 	c.JSON(http.StatusOK, streams)
 }
 
+// recommendWindow is how far back watch history counts for recommendations
+const recommendWindow = 30 * 24 * time.Hour
+
+// recommend orders streams by how long the user watched each channel within
+// recommendWindow, keeping the newest first among equals. On error the order
+// is left as is.
+func (h *ChannelHandler) recommend(userID uuid.UUID, streams []models.StreamWithChannel) {
+	ids := make([]uuid.UUID, len(streams))
+	for i, s := range streams {
+		ids[i] = s.ChannelID
+	}
+	watched, err := h.watchRepo.WatchTimeByChannels(userID, ids, time.Now().Add(-recommendWindow))
+	if err != nil {
+		log.Printf("Failed to load watch time for recommendations: %v", err)
+		return
+	}
+	sort.SliceStable(streams, func(i, j int) bool {
+		return watched[streams[i].ChannelID] > watched[streams[j].ChannelID]
+	})
+}
+
 // FollowChannel: authenticated user follows a channel
 func (h *ChannelHandler) FollowChannel(c *gin.Context) {
 	slug := c.Param("slug")
@@ -198,16 +472,91 @@ func (h *ChannelHandler) FollowChannel(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	origin, ok := h.followOrigin(c, ch, uid)
+	if !ok {
 		return
 	}
-	if err := h.channelRepo.AddFollower(ch.ID, uid); err != nil {
+	added, err := h.channelRepo.AddFollower(ch.ID, uid, origin)
+	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to follow channel")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
+	if added {
+		h.announceFollow(ch, uid)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "followed"})
 }
 
+// followOrigin records where a follow comes from and, for new accounts,
+// applies the follow guard. When the guard rejects the follow it writes a 429
+// response and returns ok=false.
+func (h *ChannelHandler) followOrigin(c *gin.Context, ch *models.Channel, uid uuid.UUID) (models.FollowOrigin, bool) {
+	if h.followGuard == nil {
+		return models.FollowOrigin{}, true
+	}
+	ip := c.ClientIP()
+	origin := models.FollowOrigin{IP: ip, Network: h.followGuard.Network(ip)}
+	u, err := h.userRepo.GetByID(uid)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+		return origin, false
+	}
+	if !h.followGuard.IsNewAccount(u.CreatedAt) {
+		return origin, true
+	}
+	origin.NewAccount = true
+	if ok, retry := h.followGuard.Allow(ch.ID, ip, origin.Network); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+		ErrorCode(c, http.StatusTooManyRequests, apierror.FollowThrottled, "Too many new accounts followed this channel from your network; try again later")
+		return origin, false
+	}
+	return origin, true
+}
+
+// announceFollow sends the channel's owner a channel.followed event naming
+// the new follower, or counts the follow for the next aggregated event once
+// the channel has followAlertsAggregateAt followers. Failures are logged
+// only; the follow itself succeeded.
+func (h *ChannelHandler) announceFollow(ch *models.Channel, followerID uuid.UUID) {
+	if h.redis == nil || (ch.FollowAlerts != nil && !*ch.FollowAlerts) || followerID == ch.OwnerID {
+		return
+	}
+	followers, err := h.channelRepo.CountFollowers(ch.ID)
+	if err != nil {
+		log.Printf("Failed to count followers of channel %s: %v", ch.ID, err)
+		return
+	}
+	if h.followAlertsAggregateAt > 0 && followers >= h.followAlertsAggregateAt {
+		if err := h.redis.AddFollowDelta(ch.ID); err != nil {
+			log.Printf("Failed to count follow of channel %s: %v", ch.ID, err)
+		}
+		return
+	}
+
+	u, err := h.userRepo.GetByID(followerID)
+	if err != nil {
+		log.Printf("Failed to load follower %s: %v", followerID, err)
+		return
+	}
+	payload := models.WSChannelFollowedPayload{
+		ChannelID:   ch.ID,
+		OwnerID:     ch.OwnerID,
+		Count:       1,
+		Followers:   followers,
+		UserID:      &u.ID,
+		DisplayName: u.DisplayName,
+		Username:    u.Username,
+		AvatarURL:   u.AvatarURL,
+	}
+	if err := h.redis.PublishMessage(models.WSMessage{Event: models.EventChannelFollowed, Payload: payload}); err != nil {
+		log.Printf("Failed to publish follow of channel %s: %v", ch.ID, err)
+	}
+}
+
 // UnfollowChannel: authenticated user unfollows a channel
 func (h *ChannelHandler) UnfollowChannel(c *gin.Context) {
 	slug := c.Param("slug")
@@ -216,24 +565,44 @@ func (h *ChannelHandler) UnfollowChannel(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 	if err := h.channelRepo.RemoveFollower(ch.ID, uid); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to unfollow channel")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
 	c.JSON(http.StatusOK, gin.H{"message": "unfollowed"})
 }
 
+// ListFollowers returns a page of a channel's followers, most recent first
+func (h *ChannelHandler) ListFollowers(c *gin.Context) {
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	followers, err := h.channelRepo.ListFollowers(ch.ID, limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to list followers")
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(followers, limit, func(f models.Follower) pagination.Cursor {
+		return pagination.Cursor{Time: f.FollowedAt, ID: f.ID}
+	}))
+}
+
 // AssignModerator: owner assigns a moderator role to a user for channel
 func (h *ChannelHandler) AssignModerator(c *gin.Context) {
 	slug := c.Param("slug")
-	var body struct {
-		UserID uuid.UUID `json:"user_id"`
-	}
+	var body models.AssignModeratorRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		ValidationError(c, err)
 		return
 	}
 	userID, _ := c.Get("user_id")
@@ -241,11 +610,10 @@ func (h *ChannelHandler) AssignModerator(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
-	if ch.OwnerID != uid {
-		ErrorResponse(c, http.StatusForbidden, "only owner can assign moderators")
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can assign moderators") {
 		return
 	}
 
@@ -254,10 +622,11 @@ func (h *ChannelHandler) AssignModerator(c *gin.Context) {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to get conversation")
 		return
 	}
-	if err := h.convRepo.UpdateMemberRole(convID, body.UserID, "moderator"); err != nil {
+	if err := h.convRepo.UpdateMemberRole(convID, body.UserID, authz.RoleModerator); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to assign moderator")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
 	c.JSON(http.StatusOK, gin.H{"message": "moderator assigned"})
 }
 
@@ -275,11 +644,10 @@ func (h *ChannelHandler) RemoveModerator(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
-	if ch.OwnerID != uid {
-		ErrorResponse(c, http.StatusForbidden, "only owner can remove moderators")
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can remove moderators") {
 		return
 	}
 
@@ -288,13 +656,89 @@ func (h *ChannelHandler) RemoveModerator(c *gin.Context) {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to get conversation")
 		return
 	}
-	if err := h.convRepo.UpdateMemberRole(convID, targetID, "member"); err != nil {
+	if err := h.convRepo.UpdateMemberRole(convID, targetID, authz.RoleMember); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to remove moderator")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
 	c.JSON(http.StatusOK, gin.H{"message": "moderator removed"})
 }
 
+// AssignVIP: owner marks a user as a VIP of the channel. Moderators keep
+// their role.
+func (h *ChannelHandler) AssignVIP(c *gin.Context) {
+	slug := c.Param("slug")
+	var body models.AssignVIPRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(slug)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can assign VIPs") {
+		return
+	}
+
+	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to get conversation")
+		return
+	}
+	if role, _ := h.convRepo.GetMemberRole(convID, body.UserID); authz.IsModeratorRole(role) {
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "user is a moderator")
+		return
+	}
+	if err := h.convRepo.UpdateMemberRole(convID, body.UserID, authz.RoleVIP); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to assign VIP")
+		return
+	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
+	c.JSON(http.StatusOK, gin.H{"message": "VIP assigned"})
+}
+
+// RemoveVIP: owner removes a user's VIP role (demote to member)
+func (h *ChannelHandler) RemoveVIP(c *gin.Context) {
+	slug := c.Param("slug")
+	targetID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(slug)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can remove VIPs") {
+		return
+	}
+
+	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to get conversation")
+		return
+	}
+	if role, _ := h.convRepo.GetMemberRole(convID, targetID); role != authz.RoleVIP {
+		ErrorCode(c, http.StatusNotFound, apierror.NotFound, "user is not a VIP")
+		return
+	}
+	if err := h.convRepo.UpdateMemberRole(convID, targetID, authz.RoleMember); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to remove VIP")
+		return
+	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
+	c.JSON(http.StatusOK, gin.H{"message": "VIP removed"})
+}
+
 // BanUser bans a user from the channel (owner/mod)
 func (h *ChannelHandler) BanUser(c *gin.Context) {
 	slug := c.Param("slug")
@@ -305,10 +749,7 @@ func (h *ChannelHandler) BanUser(c *gin.Context) {
 		return
 	}
 
-	var body struct {
-		DurationMin int    `json:"duration_min"`
-		Reason      string `json:"reason"`
-	}
+	var body models.BanUserRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
 		// allow empty body
 	}
@@ -318,23 +759,13 @@ func (h *ChannelHandler) BanUser(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 
 	// check owner or moderator
-	allowed := false
-	if ch.OwnerID == uid {
-		allowed = true
-	} else {
-		convID, _ := h.channelRepo.GetOrCreateConversation(ch.ID)
-		role, _ := h.convRepo.GetMemberRole(convID, uid)
-		if role == "moderator" || role == "admin" {
-			allowed = true
-		}
-	}
-	if !allowed {
-		ErrorResponse(c, http.StatusForbidden, "access denied")
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "access denied") {
 		return
 	}
 
@@ -344,15 +775,11 @@ func (h *ChannelHandler) BanUser(c *gin.Context) {
 		return
 	}
 
-	var expires *time.Time
-	if body.DurationMin > 0 {
-		t := time.Now().Add(time.Duration(body.DurationMin) * time.Minute)
-		expires = &t
-	}
-	if err := h.convRepo.AddModeration(convID, targetID, "ban", expires, body.Reason); err != nil {
+	if _, err := h.moderation.Restrict(convID, uid, targetID, moderation.ActionBan, time.Duration(body.DurationMin)*time.Minute, body.Reason); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to ban user")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
 	c.JSON(http.StatusOK, gin.H{"message": "user banned"})
 }
 
@@ -371,23 +798,13 @@ func (h *ChannelHandler) UnbanUser(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 
 	// check owner or moderator
-	allowed := false
-	if ch.OwnerID == uid {
-		allowed = true
-	} else {
-		convID, _ := h.channelRepo.GetOrCreateConversation(ch.ID)
-		role, _ := h.convRepo.GetMemberRole(convID, uid)
-		if role == "moderator" || role == "admin" {
-			allowed = true
-		}
-	}
-	if !allowed {
-		ErrorResponse(c, http.StatusForbidden, "access denied")
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "access denied") {
 		return
 	}
 
@@ -396,10 +813,11 @@ func (h *ChannelHandler) UnbanUser(c *gin.Context) {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to get conversation")
 		return
 	}
-	if err := h.convRepo.RemoveModeration(convID, targetID, "ban"); err != nil {
+	if _, err := h.moderation.Lift(convID, uid, targetID, moderation.ActionBan); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "failed to unban user")
 		return
 	}
+	h.etags.Invalidate(middleware.ChannelETagKey(slug))
 	c.JSON(http.StatusOK, gin.H{"message": "user unbanned"})
 }
 
@@ -407,11 +825,9 @@ func (h *ChannelHandler) UnbanUser(c *gin.Context) {
 // AddBannedWord: owner/mod can add a custom banned word for the channel
 func (h *ChannelHandler) AddBannedWord(c *gin.Context) {
 	slug := c.Param("slug")
-	var body struct {
-		Word string `json:"word"`
-	}
+	var body models.BannedWordRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
-		ErrorResponse(c, http.StatusBadRequest, err.Error())
+		ValidationError(c, err)
 		return
 	}
 	userID, _ := c.Get("user_id")
@@ -419,23 +835,13 @@ func (h *ChannelHandler) AddBannedWord(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 
 	// only owner or moderator can add
-	allowed := false
-	if ch.OwnerID == uid {
-		allowed = true
-	} else {
-		convID, _ := h.channelRepo.GetOrCreateConversation(ch.ID)
-		role, _ := h.convRepo.GetMemberRole(convID, uid)
-		if role == "moderator" || role == "admin" {
-			allowed = true
-		}
-	}
-	if !allowed {
-		ErrorResponse(c, http.StatusForbidden, "access denied")
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "access denied") {
 		return
 	}
 
@@ -460,13 +866,11 @@ func (h *ChannelHandler) RemoveBannedWord(c *gin.Context) {
 
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 
-	// only owner can remove
-	if ch.OwnerID != uid {
-		ErrorResponse(c, http.StatusForbidden, "only owner can remove banned words")
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can remove banned words") {
 		return
 	}
 	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
@@ -486,7 +890,7 @@ func (h *ChannelHandler) ListBannedWords(c *gin.Context) {
 	slug := c.Param("slug")
 	ch, err := h.channelRepo.GetBySlug(slug)
 	if err != nil {
-		ErrorResponse(c, http.StatusNotFound, "Channel not found")
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
 		return
 	}
 	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
@@ -501,3 +905,100 @@ func (h *ChannelHandler) ListBannedWords(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, words)
 }
+
+// GetAutoMessages returns the channel's bot welcome and announcement (owner)
+func (h *ChannelHandler) GetAutoMessages(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	auto, err := h.modRepo.GetAutoMessages(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to get auto messages")
+		return
+	}
+	c.JSON(http.StatusOK, auto)
+}
+
+// UpdateAutoMessages replaces the channel's bot welcome and announcement
+// (owner). Empty texts turn them off.
+func (h *ChannelHandler) UpdateAutoMessages(c *gin.Context) {
+	var req models.UpdateAutoMessagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+
+	auto := &models.ChannelAutoMessages{
+		ChannelID:               ch.ID,
+		WelcomeMessage:          req.WelcomeMessage,
+		Announcement:            req.Announcement,
+		AnnouncementIntervalMin: req.AnnouncementIntervalMin,
+		AnnouncementMinMessages: req.AnnouncementMinMessages,
+	}
+	if auto.AnnouncementIntervalMin == 0 {
+		auto.AnnouncementIntervalMin = models.DefaultAnnouncementInterval
+	}
+	if err := h.modRepo.SaveAutoMessages(auto); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to save auto messages")
+		return
+	}
+	c.JSON(http.StatusOK, auto)
+}
+
+// ownedChannel loads the :slug channel, writing an error response unless the
+// caller owns it
+func (h *ChannelHandler) ownedChannel(c *gin.Context) (*models.Channel, bool) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return nil, false
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only owner can manage auto messages") {
+		return nil, false
+	}
+	return ch, true
+}
+
+// ListModerationLogs returns a page of the channel's moderation log (owner/mod)
+func (h *ChannelHandler) ListModerationLogs(c *gin.Context) {
+	slug := c.Param("slug")
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(slug)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "access denied") {
+		return
+	}
+
+	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to get conversation")
+		return
+	}
+
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	logs, err := h.modRepo.GetLogsByConversation(convID, limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to list moderation logs")
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(logs, limit, func(l models.ModerationLog) pagination.Cursor {
+		return pagination.Cursor{Time: l.CreatedAt, ID: l.ID}
+	}))
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/jobs"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type ChatStatsHandler struct {
+	redis       *cache.RedisClient
+	channelRepo *repository.ChannelRepository
+}
+
+func NewChatStatsHandler(redis *cache.RedisClient, chRepo *repository.ChannelRepository) *ChatStatsHandler {
+	return &ChatStatsHandler{redis: redis, channelRepo: chRepo}
+}
+
+// ListChatStats returns the message rate, automod rate and unique chatters of
+// every channel chat active within the last five minutes, busiest first
+func (h *ChatStatsHandler) ListChatStats(c *gin.Context) {
+	stats, err := jobs.CollectChatStats(h.redis, h.channelRepo)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to load chat stats")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": stats})
+}
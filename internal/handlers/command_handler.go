@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// CommandHandler manages the channels' custom chat commands, which the
+// moderation bot answers
+type CommandHandler struct {
+	channelRepo *repository.ChannelRepository
+	cmdRepo     *repository.CommandRepository
+	policy      *authz.Policy
+}
+
+func NewCommandHandler(channelRepo *repository.ChannelRepository, cmdRepo *repository.CommandRepository, policy *authz.Policy) *CommandHandler {
+	return &CommandHandler{channelRepo: channelRepo, cmdRepo: cmdRepo, policy: policy}
+}
+
+// ListCommands returns the channel's commands, so viewers can see what the
+// bot answers
+func (h *CommandHandler) ListCommands(c *gin.Context) {
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+
+	cmds, err := h.cmdRepo.ListByChannel(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to list commands")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"commands": cmds})
+}
+
+// CreateCommand adds a command to the channel (owner/mod)
+func (h *CommandHandler) CreateCommand(c *gin.Context) {
+	var req models.CreateCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	ch, ok := h.moderatedChannel(c)
+	if !ok {
+		return
+	}
+
+	cmd := &models.ChannelCommand{
+		ID:          uuid.New(),
+		ChannelID:   ch.ID,
+		Name:        req.Name,
+		Response:    req.Response,
+		Permission:  req.Permission,
+		CooldownSec: models.DefaultCommandCooldown,
+		Enabled:     true,
+	}
+	if cmd.Permission == "" {
+		cmd.Permission = models.CommandEveryone
+	}
+	if req.CooldownSec != nil {
+		cmd.CooldownSec = *req.CooldownSec
+	}
+
+	err := h.cmdRepo.Create(cmd)
+	if errors.Is(err, repository.ErrCommandExists) {
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "command already exists")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to create command")
+		return
+	}
+	c.JSON(http.StatusCreated, cmd)
+}
+
+// UpdateCommand changes a command's response, permission, cooldown or
+// enabled state (owner/mod)
+func (h *CommandHandler) UpdateCommand(c *gin.Context) {
+	var req models.UpdateCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	ch, ok := h.moderatedChannel(c)
+	if !ok {
+		return
+	}
+
+	cmd, err := h.cmdRepo.Update(ch.ID, c.Param("name"), &req)
+	if errors.Is(err, repository.ErrCommandNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "command not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to update command")
+		return
+	}
+	c.JSON(http.StatusOK, cmd)
+}
+
+// DeleteCommand removes a command (owner/mod)
+func (h *CommandHandler) DeleteCommand(c *gin.Context) {
+	ch, ok := h.moderatedChannel(c)
+	if !ok {
+		return
+	}
+
+	err := h.cmdRepo.Delete(ch.ID, c.Param("name"))
+	if errors.Is(err, repository.ErrCommandNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "command not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "failed to delete command")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "command deleted"})
+}
+
+// moderatedChannel loads the :slug channel, writing an error response unless
+// the caller owns or moderates it
+func (h *CommandHandler) moderatedChannel(c *gin.Context) (*models.Channel, bool) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return nil, false
+	}
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "only owner or moderators can manage commands") {
+		return nil, false
+	}
+	return ch, true
+}
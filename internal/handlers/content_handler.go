@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// ContentHandler manages viewers' content preferences: mature content and
+// hidden content tags
+type ContentHandler struct {
+	prefsRepo *repository.ContentPreferenceRepository
+}
+
+func NewContentHandler(prefsRepo *repository.ContentPreferenceRepository) *ContentHandler {
+	return &ContentHandler{prefsRepo: prefsRepo}
+}
+
+// GetPreferences returns the current user's content preferences
+func (h *ContentHandler) GetPreferences(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	prefs, err := h.prefsRepo.Get(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get content preferences")
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdatePreferences changes the current user's content preferences. Setting
+// show_mature acknowledges 18+ content.
+func (h *ContentHandler) UpdatePreferences(c *gin.Context) {
+	var req models.UpdateContentPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	prefs, err := h.prefsRepo.Update(uid, req)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update content preferences")
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// viewerPreferences loads a viewer's content preferences for filtering
+// streams. On error it logs and returns the defaults, which hide mature
+// content, so a failure never hands out what the viewer did not ask for.
+func viewerPreferences(repo *repository.ContentPreferenceRepository, userID uuid.UUID) models.ContentPreferences {
+	prefs, err := repo.Get(userID)
+	if err != nil {
+		log.Printf("Failed to load content preferences of %s: %v", userID, err)
+		return models.ContentPreferences{}
+	}
+	return prefs
+}
@@ -1,30 +1,42 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/moderation"
+	"github.com/tullo/backend/internal/pagination"
 	"github.com/tullo/backend/internal/repository"
 )
 
 type ConversationHandler struct {
-	convRepo *repository.ConversationRepository
-	userRepo *repository.UserRepository
-	msgRepo  *repository.MessageRepository
+	convRepo   *repository.ConversationRepository
+	userRepo   *repository.UserRepository
+	msgRepo    *repository.MessageRepository
+	policy     *authz.Policy
+	moderation *moderation.Service
 }
 
 func NewConversationHandler(
 	convRepo *repository.ConversationRepository,
 	userRepo *repository.UserRepository,
 	msgRepo *repository.MessageRepository,
+	policy *authz.Policy,
+	moderation *moderation.Service,
 ) *ConversationHandler {
 	return &ConversationHandler{
-		convRepo: convRepo,
-		userRepo: userRepo,
-		msgRepo:  msgRepo,
+		convRepo:   convRepo,
+		userRepo:   userRepo,
+		msgRepo:    msgRepo,
+		policy:     policy,
+		moderation: moderation,
 	}
 }
 
@@ -32,7 +44,7 @@ func NewConversationHandler(
 func (h *ConversationHandler) CreateConversation(c *gin.Context) {
 	var req models.CreateConversationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ValidationError(c, err)
 		return
 	}
 
@@ -42,8 +54,17 @@ func (h *ConversationHandler) CreateConversation(c *gin.Context) {
 	// For 1:1 conversations, check if it already exists
 	if !req.IsGroup && len(req.Members) == 1 {
 		conv, err := h.convRepo.GetOrCreateDirectConversation(uid, req.Members[0])
+		var notAllowed *repository.DMNotAllowedError
+		if errors.As(err, &notAllowed) {
+			ErrorCode(c, http.StatusForbidden, apierror.DMNotAllowed, "This user does not accept direct messages")
+			return
+		}
+		if errors.Is(err, repository.ErrUserNotFound) {
+			ErrorCode(c, http.StatusNotFound, apierror.UserNotFound, "User not found")
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to create conversation")
 			return
 		}
 
@@ -64,34 +85,29 @@ func (h *ConversationHandler) CreateConversation(c *gin.Context) {
 		UpdatedAt: time.Now(),
 	}
 
-	if err := h.convRepo.Create(conversation); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
-		return
-	}
-
-	// Add creator as admin
-	creatorMember := &models.ConversationMember{
+	// Add creator as admin, then the other members, in the same transaction
+	newMembers := []models.ConversationMember{{
 		ID:             uuid.New(),
 		ConversationID: conversation.ID,
 		UserID:         uid,
-		Role:           "admin",
+		Role:           authz.RoleAdmin,
 		JoinedAt:       time.Now(),
-	}
-	h.convRepo.AddMember(creatorMember)
-
-	// Add other members
+	}}
 	for _, memberID := range req.Members {
 		if memberID == uid {
 			continue
 		}
-		member := &models.ConversationMember{
+		newMembers = append(newMembers, models.ConversationMember{
 			ID:             uuid.New(),
 			ConversationID: conversation.ID,
 			UserID:         memberID,
-			Role:           "member",
+			Role:           authz.RoleMember,
 			JoinedAt:       time.Now(),
-		}
-		h.convRepo.AddMember(member)
+		})
+	}
+	if _, err := h.convRepo.CreateWithMembers(conversation, newMembers); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create conversation")
+		return
 	}
 
 	// Load members
@@ -106,11 +122,20 @@ func (h *ConversationHandler) GetConversations(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
 
-	conversations, err := h.convRepo.GetByUserID(uid)
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	conversations, err := h.convRepo.ListByUserID(uid, limit, cursor)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversations"})
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get conversations")
 		return
 	}
+	page := pagination.NewPage(conversations, limit, func(conv models.Conversation) pagination.Cursor {
+		return pagination.Cursor{Time: conv.UpdatedAt, ID: conv.ID}
+	})
+	conversations = page.Items
 
 	// Load members and last message for each conversation
 	for i := range conversations {
@@ -124,14 +149,32 @@ func (h *ConversationHandler) GetConversations(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, conversations)
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUnreadCounts returns the unread count of every conversation of the
+// current user in one query, for rendering badges
+func (h *ConversationHandler) GetUnreadCounts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	counts, err := h.msgRepo.ListUnreadCounts(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get unread counts")
+		return
+	}
+	resp := models.UnreadCountsResponse{Conversations: counts}
+	for _, uc := range counts {
+		resp.Total += uc.Unread
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // GetConversation returns a specific conversation
 func (h *ConversationHandler) GetConversation(c *gin.Context) {
 	conversationID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
 		return
 	}
 
@@ -141,19 +184,136 @@ func (h *ConversationHandler) GetConversation(c *gin.Context) {
 	// Check if user is a member
 	isMember, err := h.convRepo.IsMember(conversationID, uid)
 	if err != nil || !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
 		return
 	}
 
 	conversation, err := h.convRepo.GetByID(conversationID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		ErrorCode(c, http.StatusNotFound, apierror.ConversationNotFound, "Conversation not found")
 		return
 	}
 
 	// Load members
 	members, _ := h.convRepo.GetMembers(conversation.ID)
 	conversation.Members = members
+	conversation.LastReadMessageID, _ = h.convRepo.GetReadMarker(conversation.ID, uid)
+	if draft, err := h.convRepo.GetDraft(conversation.ID, uid); err == nil && draft.Body != "" {
+		conversation.Draft = draft
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// GetDraft returns the caller's unsent message in a conversation
+func (h *ConversationHandler) GetDraft(c *gin.Context) {
+	conversationID, uid, ok := h.member(c)
+	if !ok {
+		return
+	}
+	draft, err := h.convRepo.GetDraft(conversationID, uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get draft")
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
+
+// SaveDraft stores the caller's unsent message in a conversation so their
+// other devices pick it up; an empty body discards it
+func (h *ConversationHandler) SaveDraft(c *gin.Context) {
+	conversationID, uid, ok := h.member(c)
+	if !ok {
+		return
+	}
+	var req models.SaveDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	draft, err := h.convRepo.SaveDraft(conversationID, uid, req.Body)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to save draft")
+		return
+	}
+	c.JSON(http.StatusOK, draft)
+}
+
+// member parses the conversation ID and checks that the caller is a member,
+// answering the request if not
+func (h *ConversationHandler) member(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	isMember, err := h.convRepo.IsMember(conversationID, uid)
+	if err != nil || !isMember {
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return conversationID, uid, true
+}
+
+// UpdateConversation renames a group conversation, turns its formatting on
+// or off or sets its message retention, with optimistic locking (admin only)
+func (h *ConversationHandler) UpdateConversation(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	var req models.UpdateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	allowed, err := h.policy.CanManageConversation(conversationID, uid)
+	if !permitted(c, allowed, err, "Access denied") {
+		return
+	}
+
+	conversation, err := h.convRepo.GetByID(conversationID)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ConversationNotFound, "Conversation not found")
+		return
+	}
+	if req.Name != nil && !conversation.IsGroup {
+		ErrorResponse(c, http.StatusBadRequest, "Cannot rename 1:1 conversation")
+		return
+	}
+
+	if req.Name != nil {
+		conversation.Name = req.Name
+	}
+	if req.Formatting != nil {
+		conversation.Formatting = req.Formatting
+	}
+	if req.RetentionDays != nil {
+		conversation.RetentionDays = req.RetentionDays
+	}
+	if req.RetentionAction != nil {
+		conversation.RetentionAction = req.RetentionAction
+	}
+	conversation.Version = req.Version
+
+	if err := h.convRepo.Update(conversation); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			ErrorCode(c, http.StatusConflict, apierror.VersionConflict, "Conversation was modified by another request")
+			return
+		}
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update conversation")
+		return
+	}
 
 	c.JSON(http.StatusOK, conversation)
 }
@@ -162,13 +322,13 @@ func (h *ConversationHandler) GetConversation(c *gin.Context) {
 func (h *ConversationHandler) AddMembers(c *gin.Context) {
 	conversationID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
 		return
 	}
 
 	var req models.AddMembersRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ValidationError(c, err)
 		return
 	}
 
@@ -178,48 +338,62 @@ func (h *ConversationHandler) AddMembers(c *gin.Context) {
 	// Check if user is a member
 	isMember, err := h.convRepo.IsMember(conversationID, uid)
 	if err != nil || !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
 		return
 	}
 
 	// Check if it's a group conversation
 	conversation, err := h.convRepo.GetByID(conversationID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		ErrorCode(c, http.StatusNotFound, apierror.ConversationNotFound, "Conversation not found")
 		return
 	}
 
 	if !conversation.IsGroup {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot add members to 1:1 conversation"})
+		ErrorResponse(c, http.StatusBadRequest, "Cannot add members to 1:1 conversation")
 		return
 	}
 
 	// Add members
+	members := make([]models.ConversationMember, 0, len(req.Members))
 	for _, memberID := range req.Members {
-		member := &models.ConversationMember{
+		members = append(members, models.ConversationMember{
 			ID:             uuid.New(),
 			ConversationID: conversationID,
 			UserID:         memberID,
-			Role:           "member",
+			Role:           authz.RoleMember,
 			JoinedAt:       time.Now(),
-		}
-		h.convRepo.AddMember(member)
+		})
+	}
+	var added []models.ConversationMember
+	err = h.convRepo.WithTx(func(tx pgx.Tx) error {
+		added, err = h.convRepo.AddMembers(tx, members)
+		return err
+	})
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to add members")
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Members added successfully"})
+	addedIDs := make([]uuid.UUID, 0, len(added))
+	for _, m := range added {
+		addedIDs = append(addedIDs, m.UserID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Members added successfully", "added": addedIDs})
 }
 
 // RemoveMember removes a member from a conversation
 func (h *ConversationHandler) RemoveMember(c *gin.Context) {
 	conversationID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
 		return
 	}
 
 	memberID, err := uuid.Parse(c.Param("user_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		ErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
@@ -229,94 +403,323 @@ func (h *ConversationHandler) RemoveMember(c *gin.Context) {
 	// Check if user is a member
 	isMember, err := h.convRepo.IsMember(conversationID, uid)
 	if err != nil || !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
 		return
 	}
 
 	// Remove member
 	if err := h.convRepo.RemoveMember(conversationID, memberID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to remove member")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
 }
 
-// AddModeration mutes or bans a user in a conversation (admin/moderator only)
+// MuteUser mutes a user in a group conversation (admin/moderator only)
+func (h *ConversationHandler) MuteUser(c *gin.Context) {
+	var req models.RestrictUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	h.restrict(c, moderation.ActionMute, req)
+}
+
+// BanUser bans a user from a group conversation (admin/moderator only)
+func (h *ConversationHandler) BanUser(c *gin.Context) {
+	var req models.RestrictUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	h.restrict(c, moderation.ActionBan, req)
+}
+
+// UnmuteUser lifts a mute (admin/moderator only)
+func (h *ConversationHandler) UnmuteUser(c *gin.Context) {
+	h.lift(c, moderation.ActionMute)
+}
+
+// UnbanUser lifts a ban (admin/moderator only)
+func (h *ConversationHandler) UnbanUser(c *gin.Context) {
+	h.lift(c, moderation.ActionBan)
+}
+
+// AddModeration mutes or bans a user in a conversation (admin/moderator
+// only). Deprecated in favor of MuteUser and BanUser.
 func (h *ConversationHandler) AddModeration(c *gin.Context) {
+	var req models.AddModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	h.restrict(c, req.Action, models.RestrictUserRequest{UserID: req.UserID, DurationMin: req.DurationMin, Reason: req.Reason})
+}
+
+// RemoveModeration removes a moderation entry (admin/moderator only).
+// Deprecated in favor of UnmuteUser and UnbanUser.
+func (h *ConversationHandler) RemoveModeration(c *gin.Context) {
+	action := c.DefaultQuery("action", moderation.ActionMute)
+	if action != moderation.ActionMute && action != moderation.ActionBan {
+		ErrorCode(c, http.StatusBadRequest, apierror.ValidationFailed, "action must be mute or ban")
+		return
+	}
+	h.lift(c, action)
+}
+
+// moderatedGroup checks that the caller may moderate the :id conversation
+// and that it is a group, writing an error response otherwise
+func (h *ConversationHandler) moderatedGroup(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
 	conversationID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	allowed, err := h.policy.CanModerateConversation(conversationID, uid)
+	if !permitted(c, allowed, err, "Access denied") {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	conversation, err := h.convRepo.GetByID(conversationID)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ConversationNotFound, "Conversation not found")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !conversation.IsGroup {
+		ErrorResponse(c, http.StatusBadRequest, "Cannot moderate a 1:1 conversation")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return conversationID, uid, true
+}
+
+func (h *ConversationHandler) restrict(c *gin.Context, action string, req models.RestrictUserRequest) {
+	conversationID, uid, ok := h.moderatedGroup(c)
+	if !ok {
 		return
 	}
 
-	var req struct {
-		UserID      uuid.UUID `json:"user_id"`
-		Action      string    `json:"action"` // "mute" or "ban"
-		DurationMin int       `json:"duration_min"`
-		Reason      string    `json:"reason"`
+	expires, err := h.moderation.Restrict(conversationID, uid, req.UserID, action, time.Duration(req.DurationMin)*time.Minute, req.Reason)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to add moderation")
+		return
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	c.JSON(http.StatusOK, models.RestrictionResponse{UserID: req.UserID, Action: action, ExpiresAt: expires})
+}
+
+func (h *ConversationHandler) lift(c *gin.Context, action string) {
+	memberID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	conversationID, uid, ok := h.moderatedGroup(c)
+	if !ok {
+		return
+	}
+
+	removed, err := h.moderation.Lift(conversationID, uid, memberID, action)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to remove moderation")
+		return
+	}
+	if !removed {
+		message := "User is not muted"
+		if action == moderation.ActionBan {
+			message = "User is not banned"
+		}
+		ErrorCode(c, http.StatusNotFound, apierror.NotFound, message)
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"message": "moderation removed"})
+}
+
+// GetPrivacy returns the current user's privacy settings
+func (h *ConversationHandler) GetPrivacy(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
 
-	// Check requester role
-	role, err := h.convRepo.GetMemberRole(conversationID, uid)
-	if err != nil || (role != "admin" && role != "moderator") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	policy, err := h.userRepo.GetDMPolicy(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get privacy settings")
 		return
 	}
+	c.JSON(http.StatusOK, models.PrivacySettings{DMPolicy: policy})
+}
 
-	var expires *time.Time
-	if req.DurationMin > 0 {
-		t := time.Now().Add(time.Duration(req.DurationMin) * time.Minute)
-		expires = &t
+// UpdatePrivacy changes who may start a direct conversation with the current
+// user. Existing conversations are not affected.
+func (h *ConversationHandler) UpdatePrivacy(c *gin.Context) {
+	var req models.UpdatePrivacySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
 	}
 
-	if err := h.convRepo.AddModeration(conversationID, req.UserID, req.Action, expires, req.Reason); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add moderation"})
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	if err := h.userRepo.SetDMPolicy(uid, req.DMPolicy); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update privacy settings")
 		return
 	}
+	c.JSON(http.StatusOK, models.PrivacySettings{DMPolicy: req.DMPolicy})
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "moderation added"})
+// GetNotificationSettings returns the caller's notification settings for a conversation
+func (h *ConversationHandler) GetNotificationSettings(c *gin.Context) {
+	conversationID, uid, ok := h.member(c)
+	if !ok {
+		return
+	}
+	settings, err := h.convRepo.GetNotificationSettings(conversationID, uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get notification settings")
+		return
+	}
+	c.JSON(http.StatusOK, settings)
 }
 
-// RemoveModeration removes a moderation entry (admin/moderator only)
-func (h *ConversationHandler) RemoveModeration(c *gin.Context) {
-	conversationID, err := uuid.Parse(c.Param("id"))
+// UpdateNotificationSettings mutes or unmutes a conversation's notifications
+// for the caller. Messages still arrive; only notifications about them stop.
+func (h *ConversationHandler) UpdateNotificationSettings(c *gin.Context) {
+	conversationID, uid, ok := h.member(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateNotificationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	var until *time.Time
+	if req.Minutes > 0 {
+		t := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		until = &t
+	}
+	settings, err := h.convRepo.SetNotificationSettings(conversationID, uid, *req.Muted, until)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update notification settings")
 		return
 	}
+	c.JSON(http.StatusOK, settings)
+}
 
-	memberID, err := uuid.Parse(c.Param("user_id"))
+// GetDoNotDisturb returns the current user's do not disturb state
+func (h *ConversationHandler) GetDoNotDisturb(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	until, err := h.userRepo.GetDoNotDisturb(uid)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get do not disturb")
 		return
 	}
+	c.JSON(http.StatusOK, models.DoNotDisturb{Enabled: until != nil, Until: until})
+}
 
-	action := c.Query("action") // expect "mute" or "ban"
-	if action == "" {
-		action = "mute"
+// SetDoNotDisturb holds back the current user's email and push notifications
+// for the given number of minutes
+func (h *ConversationHandler) SetDoNotDisturb(c *gin.Context) {
+	var req models.SetDoNotDisturbRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
 	}
 
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
 
-	role, err := h.convRepo.GetMemberRole(conversationID, uid)
-	if err != nil || (role != "admin" && role != "moderator") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	until := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	if err := h.userRepo.SetDoNotDisturb(uid, &until); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to set do not disturb")
 		return
 	}
+	c.JSON(http.StatusOK, models.DoNotDisturb{Enabled: true, Until: &until})
+}
+
+// ClearDoNotDisturb turns the current user's do not disturb off
+func (h *ConversationHandler) ClearDoNotDisturb(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
 
-	if err := h.convRepo.RemoveModeration(conversationID, memberID, action); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove moderation"})
+	if err := h.userRepo.SetDoNotDisturb(uid, nil); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to clear do not disturb")
 		return
 	}
+	c.Status(http.StatusNoContent)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "moderation removed"})
+// ListMessageRequests returns a page of the direct conversations others
+// requested with the current user, newest first, with their last message
+func (h *ConversationHandler) ListMessageRequests(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	requests, err := h.convRepo.ListMessageRequests(uid, limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list message requests")
+		return
+	}
+	page := pagination.NewPage(requests, limit, func(mr models.MessageRequest) pagination.Cursor {
+		return pagination.Cursor{Time: mr.CreatedAt, ID: mr.ConversationID}
+	})
+
+	ids := make([]uuid.UUID, len(page.Items))
+	for i, mr := range page.Items {
+		ids[i] = mr.ConversationID
+	}
+	if last, err := h.msgRepo.GetLastMessages(ids); err == nil {
+		for i := range page.Items {
+			if m, ok := last[page.Items[i].ConversationID]; ok {
+				page.Items[i].LastMessage = &m
+			}
+		}
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// AcceptMessageRequest makes the current user a member of a conversation
+// requested with them
+func (h *ConversationHandler) AcceptMessageRequest(c *gin.Context) {
+	h.answerMessageRequest(c, h.convRepo.AcceptMessageRequest)
+}
+
+// DeclineMessageRequest deletes a conversation requested with the current
+// user
+func (h *ConversationHandler) DeclineMessageRequest(c *gin.Context) {
+	h.answerMessageRequest(c, h.convRepo.DeclineMessageRequest)
+}
+
+func (h *ConversationHandler) answerMessageRequest(c *gin.Context, answer func(conversationID, recipientID uuid.UUID) error) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	err = answer(conversationID, uid)
+	if errors.Is(err, repository.ErrMessageRequestNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Message request not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to answer message request")
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// dashboardRecentFollowers is how many of each channel's newest followers the
+// dashboard lists
+const dashboardRecentFollowers = 5
+
+type DashboardHandler struct {
+	channelRepo   *repository.ChannelRepository
+	dashboardRepo *repository.DashboardRepository
+	redis         *cache.RedisClient
+}
+
+func NewDashboardHandler(chRepo *repository.ChannelRepository, dashboardRepo *repository.DashboardRepository, redis *cache.RedisClient) *DashboardHandler {
+	return &DashboardHandler{channelRepo: chRepo, dashboardRepo: dashboardRepo, redis: redis}
+}
+
+// GetDashboard returns the caller's channels with live status, viewers,
+// followers, unread chat mentions and moderation counts. Viewers come from
+// Redis; without it, or if it fails, they are reported as zero.
+func (h *DashboardHandler) GetDashboard(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	channels, err := h.channelRepo.ListByOwner(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to load dashboard")
+		return
+	}
+	ids := make([]uuid.UUID, len(channels))
+	for i, ch := range channels {
+		ids[i] = ch.ID
+	}
+
+	stats, err := h.dashboardRepo.Stats(uid, ids, dashboardRecentFollowers)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to load dashboard")
+		return
+	}
+
+	viewers := map[uuid.UUID]int{}
+	if h.redis != nil {
+		if viewers, err = h.redis.CountViewers(ids); err != nil {
+			log.Printf("Failed to count viewers: %v", err)
+			viewers = map[uuid.UUID]int{}
+		}
+	}
+
+	resp := models.Dashboard{Channels: make([]models.DashboardChannel, len(channels)), GeneratedAt: time.Now()}
+	for i, ch := range channels {
+		dc := models.DashboardChannel{
+			Channel:         ch,
+			Viewers:         viewers[ch.ID],
+			Followers:       stats.Followers[ch.ID],
+			RecentFollowers: stats.RecentFollowers[ch.ID],
+			UnreadMentions:  stats.UnreadMentions[ch.ID],
+			Moderation:      stats.Moderation[ch.ID],
+		}
+		if s, ok := stats.Streams[ch.ID]; ok {
+			dc.Stream = &s
+			dc.Live = s.Status == "live"
+		}
+		if dc.RecentFollowers == nil {
+			dc.RecentFollowers = []models.Follower{}
+		}
+		resp.UnreadMentions += dc.UnreadMentions
+		resp.Channels[i] = dc
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type EmailHandler struct {
+	emailRepo *repository.EmailRepository
+}
+
+func NewEmailHandler(emailRepo *repository.EmailRepository) *EmailHandler {
+	return &EmailHandler{emailRepo: emailRepo}
+}
+
+// GetPreferences returns the current user's email preferences
+func (h *EmailHandler) GetPreferences(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	prefs, err := h.emailRepo.GetPreferences(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get email preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdatePreferences changes which notification emails the current user receives
+func (h *EmailHandler) UpdatePreferences(c *gin.Context) {
+	var req models.UpdateEmailPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	prefs, err := h.emailRepo.UpdatePreferences(uid, req)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update email preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; max-width: 480px; margin: 48px auto;">
+{{if .Done}}<p>You've been unsubscribed{{if ne .List "all"}} from {{.Label}}{{end}}.</p>
+{{else}}<p>Stop receiving {{.Label}} from Tullo?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>{{end}}
+</body>
+</html>`))
+
+// Unsubscribe serves the unsubscribe link from notification emails. GET shows
+// a confirmation page (so link scanners can't unsubscribe anyone); POST, from
+// that page or a mail client's one-click List-Unsubscribe-Post, applies it.
+func (h *EmailHandler) Unsubscribe(c *gin.Context) {
+	token, err := uuid.Parse(c.Query("token"))
+	if err != nil {
+		ErrorCode(c, http.StatusBadRequest, apierror.InvalidToken, "Invalid unsubscribe link")
+		return
+	}
+
+	list := c.DefaultQuery("list", models.EmailListAll)
+	labels := map[string]string{
+		models.EmailListMentions: "mention digest emails",
+		models.EmailListLive:     "\"channel went live\" emails",
+		models.EmailListAll:      "notification emails",
+	}
+	label, ok := labels[list]
+	if !ok {
+		ErrorResponse(c, http.StatusBadRequest, "unknown email list")
+		return
+	}
+
+	done := c.Request.Method == http.MethodPost
+	if done {
+		if err := h.emailRepo.Unsubscribe(token, list); err != nil {
+			if errors.Is(err, repository.ErrInvalidToken) {
+				ErrorCode(c, http.StatusNotFound, apierror.InvalidToken, "Invalid unsubscribe link")
+				return
+			}
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to unsubscribe")
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	unsubscribePage.Execute(c.Writer, map[string]any{"Done": done, "List": list, "Label": label})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/emote"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// maxEmotes is how many custom emotes a channel may have
+const maxEmotes = 50
+
+// EmoteHandler manages the channels' custom emotes. Chat messages that use
+// them as ":name:" carry tokens with their images. Uploaded images are
+// stored as assets and served from apiURL under their content hash.
+type EmoteHandler struct {
+	channelRepo *repository.ChannelRepository
+	emoteRepo   *repository.EmoteRepository
+	assetRepo   *repository.AssetRepository
+	policy      *authz.Policy
+	apiURL      string
+}
+
+func NewEmoteHandler(chRepo *repository.ChannelRepository, emoteRepo *repository.EmoteRepository, assetRepo *repository.AssetRepository, policy *authz.Policy, apiURL string) *EmoteHandler {
+	return &EmoteHandler{channelRepo: chRepo, emoteRepo: emoteRepo, assetRepo: assetRepo, policy: policy, apiURL: apiURL}
+}
+
+// ownedChannel loads the channel in the path and checks that the caller
+// owns it, writing the error response when not
+func (h *EmoteHandler) ownedChannel(c *gin.Context) (*models.Channel, bool) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return nil, false
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only the owner can manage emotes") {
+		return nil, false
+	}
+	return ch, true
+}
+
+// ListEmotes returns the channel's emotes
+func (h *EmoteHandler) ListEmotes(c *gin.Context) {
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	emotes, err := h.emoteRepo.ListByChannel(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list emotes")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"emotes": emotes})
+}
+
+// PutEmote adds an emote or replaces its images (owner only)
+func (h *EmoteHandler) PutEmote(c *gin.Context) {
+	name := c.Param("name")
+	if !emote.NamePattern.MatchString(name) {
+		ErrorResponse(c, http.StatusBadRequest, "Emote names are 2 to 32 letters, digits or underscores")
+		return
+	}
+	var req models.PutEmoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	if (req.ImageURL == "") == (req.Images == nil) {
+		ErrorResponse(c, http.StatusBadRequest, "Give either image_url or images")
+		return
+	}
+	if req.Images != nil && !checkImages(c, req.Images) {
+		return
+	}
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+
+	e := &models.Emote{ChannelID: ch.ID, Name: name, ImageURL: req.ImageURL}
+	if req.Images != nil {
+		if e.Images, ok = storeImages(c, h.assetRepo, h.apiURL, req.Images); !ok {
+			return
+		}
+	}
+	err := h.emoteRepo.Upsert(e, maxEmotes)
+	if errors.Is(err, repository.ErrTooManyEmotes) {
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "The channel has too many emotes; delete one first")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to save emote")
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
+
+// DeleteEmote removes an emote (owner only)
+func (h *EmoteHandler) DeleteEmote(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	deleted, err := h.emoteRepo.Delete(ch.ID, c.Param("name"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete emote")
+		return
+	}
+	if !deleted {
+		ErrorResponse(c, http.StatusNotFound, "Emote not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
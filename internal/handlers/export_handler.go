@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type ExportHandler struct {
+	exportRepo *repository.ExportRepository
+	// signingKey authenticates download links, so they work without a
+	// bearer token (e.g. opened in a browser)
+	signingKey []byte
+	apiURL     string
+	linkTTL    time.Duration
+}
+
+func NewExportHandler(exportRepo *repository.ExportRepository, signingKey []byte, apiURL string, linkTTL time.Duration) *ExportHandler {
+	return &ExportHandler{exportRepo: exportRepo, signingKey: signingKey, apiURL: apiURL, linkTTL: linkTTL}
+}
+
+// RequestExport queues a copy of the current user's data. The archive is
+// assembled in the background; poll GetExport until it is ready.
+func (h *ExportHandler) RequestExport(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	export, err := h.exportRepo.Create(uid)
+	if errors.Is(err, repository.ErrExportInProgress) {
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "An export is already in progress")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to request export")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetExport reports an export's status. Once ready it includes a download
+// link valid for a few minutes; poll again for a fresh one.
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	export, err := h.exportRepo.GetForUser(id, uid)
+	if errors.Is(err, repository.ErrExportNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get export")
+		return
+	}
+
+	if export.Status == models.ExportReady && export.ExpiresAt != nil && export.ExpiresAt.After(time.Now()) {
+		expires := time.Now().Add(h.linkTTL)
+		if expires.After(*export.ExpiresAt) {
+			expires = *export.ExpiresAt
+		}
+		export.DownloadURL = fmt.Sprintf("%s/exports/%s/download?expires=%d&sig=%s",
+			h.apiURL, export.ID, expires.Unix(), signExportLink(h.signingKey, export.ID, expires.Unix()))
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// Download serves an export archive to the holder of a valid signed link
+func (h *ExportHandler) Download(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires ||
+		!hmac.Equal([]byte(c.Query("sig")), []byte(signExportLink(h.signingKey, id, expires))) {
+		ErrorCode(c, http.StatusForbidden, apierror.InvalidToken, "Download link is invalid or has expired")
+		return
+	}
+
+	archive, err := h.exportRepo.GetArchive(id)
+	if errors.Is(err, repository.ErrExportNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Export not found or expired")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get export")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="tullo-export-%s.zip"`, id))
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// signExportLink authenticates a download link for export id until expires
+func signExportLink(key []byte, id uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "export:%s:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
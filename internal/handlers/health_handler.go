@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/database"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	db    *database.DB
+	redis *cache.RedisClient
+}
+
+func NewHealthHandler(db *database.DB, redis *cache.RedisClient) *HealthHandler {
+	return &HealthHandler{db: db, redis: redis}
+}
+
+// Live reports that the process is up and serving requests
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports whether dependencies are reachable so orchestrators only route
+// traffic to instances that can actually serve it. The endpoint is public, so
+// it gives only a status per dependency; the reasons go to the server log.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	ready := true
+	checks := gin.H{}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	if err := h.db.Ping(ctx); err != nil {
+		ready = false
+		log.Printf("Readiness: postgres is down: %v", err)
+		checks["postgres"] = gin.H{"status": "down"}
+	} else {
+		checks["postgres"] = gin.H{"status": "up"}
+	}
+
+	// Redis is optional: the server runs in a degraded mode without it
+	if h.redis == nil {
+		checks["redis"] = gin.H{"status": "disabled"}
+	} else if err := h.redis.Ping(ctx); err != nil {
+		ready = false
+		log.Printf("Readiness: redis is down: %v", err)
+		checks["redis"] = gin.H{"status": "down"}
+	} else {
+		checks["redis"] = gin.H{"status": "up"}
+	}
+
+	pending, err := database.PendingMigrations(h.db)
+	switch {
+	case err != nil:
+		ready = false
+		log.Printf("Readiness: cannot check migrations: %v", err)
+		checks["migrations"] = gin.H{"status": "unknown"}
+	case len(pending) > 0:
+		ready = false
+		log.Printf("Readiness: %d migrations pending", len(pending))
+		checks["migrations"] = gin.H{"status": "pending"}
+	default:
+		checks["migrations"] = gin.H{"status": "up_to_date"}
+	}
+
+	status := http.StatusOK
+	overall := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		overall = "not_ready"
+	}
+	c.JSON(status, gin.H{"status": overall, "checks": checks})
+}
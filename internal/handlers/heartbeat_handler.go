@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/middleware"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+var streamHeartbeats = metrics.Default.NewCounterVec(
+	"tullo_stream_heartbeats_total",
+	"Player heartbeats, by result (counted, duplicate).",
+	"result",
+)
+
+// HeartbeatHandler takes the heartbeats players send while a stream plays.
+// A counted heartbeat makes the viewer count as watching the channel, adds
+// to a signed-in viewer's watch time and, while the stream is live, earns
+// them channel points.
+type HeartbeatHandler struct {
+	streamRepo *repository.StreamRepository
+	watchRepo  *repository.WatchHistoryRepository
+	pointsRepo *repository.ChannelPointsRepository
+	redis      *cache.RedisClient
+	dedup      *middleware.HeartbeatDeduper
+	// pointsAmount points are earned per pointsInterval watched (0 earns none)
+	pointsAmount   int
+	pointsInterval time.Duration
+}
+
+func NewHeartbeatHandler(
+	streamRepo *repository.StreamRepository,
+	watchRepo *repository.WatchHistoryRepository,
+	pointsRepo *repository.ChannelPointsRepository,
+	redis *cache.RedisClient,
+	dedup *middleware.HeartbeatDeduper,
+	pointsAmount int,
+	pointsInterval time.Duration,
+) *HeartbeatHandler {
+	return &HeartbeatHandler{
+		streamRepo:     streamRepo,
+		watchRepo:      watchRepo,
+		pointsRepo:     pointsRepo,
+		redis:          redis,
+		dedup:          dedup,
+		pointsAmount:   pointsAmount,
+		pointsInterval: pointsInterval,
+	}
+}
+
+// Heartbeat records that the caller's player is playing a stream. Signed-in
+// users and guests may call it; heartbeats repeated within the dedup
+// interval from the same viewer and device are acknowledged but not counted.
+func (h *HeartbeatHandler) Heartbeat(c *gin.Context) {
+	streamID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid stream ID")
+		return
+	}
+	var req models.HeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	stream, err := h.streamRepo.GetByID(streamID)
+	if errors.Is(err, repository.ErrStreamNotFound) {
+		ErrorCode(c, http.StatusNotFound, apierror.StreamNotFound, "Stream not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get stream")
+		return
+	}
+
+	if !h.dedup.First(streamID, uid, req.DeviceID) {
+		streamHeartbeats.Inc("duplicate")
+		c.JSON(http.StatusOK, models.HeartbeatResponse{})
+		return
+	}
+	streamHeartbeats.Inc("counted")
+	resp := models.HeartbeatResponse{Counted: true}
+
+	live := stream.Status == "live"
+	if live && h.redis != nil {
+		// Guest IDs count too; they are as unique as user IDs
+		if err := h.redis.TouchViewer(stream.ChannelID, uid); err != nil {
+			log.Printf("Failed to record viewer for stream %s: %v", streamID, err)
+		}
+	}
+	if middleware.IsGuest(c) {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	entry, err := h.watchRepo.Record(uid, streamID, *req.PositionSeconds, watchMaxGap)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to record heartbeat")
+		return
+	}
+	resp.WatchedSeconds = &entry.WatchedSeconds
+
+	if live && h.pointsAmount > 0 {
+		balance, err := h.pointsRepo.Earn(stream.ChannelID, uid, h.pointsInterval, watchMaxGap, h.pointsAmount)
+		if err != nil {
+			log.Printf("Failed to earn channel points for stream %s: %v", streamID, err)
+		} else {
+			resp.Points = &balance
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// watchMaxGap is the most watch time one heartbeat can add. Players send a
+// heartbeat about every 30 seconds; a longer gap means playback stopped.
+const watchMaxGap = time.Minute
+
+// HistoryHandler records what users watch and lists it back to them
+type HistoryHandler struct {
+	watchRepo *repository.WatchHistoryRepository
+	prefsRepo *repository.ContentPreferenceRepository
+}
+
+func NewHistoryHandler(watchRepo *repository.WatchHistoryRepository, prefsRepo *repository.ContentPreferenceRepository) *HistoryHandler {
+	return &HistoryHandler{watchRepo: watchRepo, prefsRepo: prefsRepo}
+}
+
+// RecordProgress is the player heartbeat: it adds the stream to the user's
+// history and saves the resume position
+func (h *HistoryHandler) RecordProgress(c *gin.Context) {
+	streamID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid stream ID")
+		return
+	}
+	var req models.WatchProgressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	entry, err := h.watchRepo.Record(uid, streamID, *req.PositionSeconds, watchMaxGap)
+	if errors.Is(err, repository.ErrStreamNotFound) {
+		ErrorCode(c, http.StatusNotFound, apierror.StreamNotFound, "Stream not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to record progress")
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// ListHistory returns a page of the streams the user watched, most recent
+// first, with their resume positions. Mature streams come without a URL
+// once the user stops showing mature content.
+func (h *HistoryHandler) ListHistory(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	entries, err := h.watchRepo.ListByUser(uid, limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list watch history")
+		return
+	}
+	prefs := viewerPreferences(h.prefsRepo, uid)
+	for i := range entries {
+		if !prefs.CanPlay(entries[i].Mature) {
+			entries[i].HLSURL = nil
+		}
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(entries, limit, func(e models.WatchHistoryEntry) pagination.Cursor {
+		return pagination.Cursor{Time: e.LastWatchedAt, ID: e.StreamID}
+	}))
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/jobs"
+)
+
+// JobsStatusResponse describes the background jobs as seen by the instance
+// serving the request
+type JobsStatusResponse struct {
+	Instance string        `json:"instance"`
+	Leader   bool          `json:"leader"`
+	Jobs     []jobs.Status `json:"jobs"`
+}
+
+type JobsHandler struct {
+	scheduler *jobs.Scheduler
+}
+
+func NewJobsHandler(scheduler *jobs.Scheduler) *JobsHandler {
+	return &JobsHandler{scheduler: scheduler}
+}
+
+// Status lists each recurring job with its schedule and last outcome. Only
+// the leader runs jobs, so run counts on other instances stay at zero.
+func (h *JobsHandler) Status(c *gin.Context) {
+	c.JSON(http.StatusOK, JobsStatusResponse{
+		Instance: h.scheduler.Instance(),
+		Leader:   h.scheduler.Leader(),
+		Jobs:     h.scheduler.Statuses(),
+	})
+}
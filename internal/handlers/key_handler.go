@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// maxDevices is how many devices a user may publish keys for
+const maxDevices = 20
+
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// KeyHandler is the registry of device public keys for end-to-end encrypted
+// direct messages. Clients publish a key per device and fetch the keys of a
+// conversation's members to encrypt to.
+type KeyHandler struct {
+	keyRepo  *repository.DeviceKeyRepository
+	convRepo *repository.ConversationRepository
+}
+
+func NewKeyHandler(keyRepo *repository.DeviceKeyRepository, convRepo *repository.ConversationRepository) *KeyHandler {
+	return &KeyHandler{keyRepo: keyRepo, convRepo: convRepo}
+}
+
+// ListKeys returns the current user's device keys
+func (h *KeyHandler) ListKeys(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	keys, err := h.keyRepo.ListByUser(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get device keys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// PublishKey publishes or rotates the public key of one of the current
+// user's devices
+func (h *KeyHandler) PublishKey(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	if !deviceIDPattern.MatchString(deviceID) {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid device ID")
+		return
+	}
+	var req models.PublishDeviceKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	key := &models.DeviceKey{
+		UserID:    userID.(uuid.UUID),
+		DeviceID:  deviceID,
+		Algorithm: req.Algorithm,
+		PublicKey: req.PublicKey,
+		Signature: req.Signature,
+	}
+	err := h.keyRepo.Upsert(key, maxDevices)
+	if errors.Is(err, repository.ErrTooManyDevices) {
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "Too many devices; delete an old device key first")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to publish device key")
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// DeleteKey removes one of the current user's device keys, e.g. when the
+// device is signed out
+func (h *KeyHandler) DeleteKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	deleted, err := h.keyRepo.Delete(uid, c.Param("device_id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete device key")
+		return
+	}
+	if !deleted {
+		ErrorResponse(c, http.StatusNotFound, "Device key not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ConversationKeys returns the key bundle of a conversation the current user
+// is a member of: every member with their device keys
+func (h *KeyHandler) ConversationKeys(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	isMember, err := h.convRepo.IsMember(conversationID, uid)
+	if err != nil || !isMember {
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
+		return
+	}
+
+	members, err := h.keyRepo.ListByConversation(conversationID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get conversation keys")
+		return
+	}
+	c.JSON(http.StatusOK, models.ConversationKeyBundle{ConversationID: conversationID, Members: members})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// Click statistics cover linkStatsDays days unless ?days= asks for up to
+// linkStatsMaxDays
+const (
+	linkStatsDays    = 30
+	linkStatsMaxDays = 90
+)
+
+// LinkHandler manages the channels' tracked short links and redirects
+// their clicks
+type LinkHandler struct {
+	channelRepo *repository.ChannelRepository
+	linkRepo    *repository.LinkRepository
+	policy      *authz.Policy
+	// appURL is where channel pages are, apiURL where short links are served
+	appURL string
+	apiURL string
+}
+
+func NewLinkHandler(chRepo *repository.ChannelRepository, linkRepo *repository.LinkRepository, policy *authz.Policy, appURL, apiURL string) *LinkHandler {
+	return &LinkHandler{channelRepo: chRepo, linkRepo: linkRepo, policy: policy, appURL: appURL, apiURL: apiURL}
+}
+
+// ownedChannel loads the channel in the path and checks that the caller
+// owns it, writing the error response when not
+func (h *LinkHandler) ownedChannel(c *gin.Context) (*models.Channel, bool) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return nil, false
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only the owner can manage links") {
+		return nil, false
+	}
+	return ch, true
+}
+
+func (h *LinkHandler) withShortURL(l *models.ChannelLink) {
+	l.ShortURL = h.apiURL + "/l/" + l.Code
+}
+
+func linkCursor(l models.ChannelLink) pagination.Cursor {
+	return pagination.Cursor{Time: l.CreatedAt, ID: l.ID}
+}
+
+// ListLinks returns a page of the channel's links with their click totals
+func (h *LinkHandler) ListLinks(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	links, err := h.linkRepo.ListByChannel(ch.ID, limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list links")
+		return
+	}
+	for i := range links {
+		h.withShortURL(&links[i])
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(links, limit, linkCursor))
+}
+
+// CreateLink gives the channel a new short link to its page or target_url
+func (h *LinkHandler) CreateLink(c *gin.Context) {
+	var req models.CreateChannelLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+
+	link := &models.ChannelLink{
+		ID:        uuid.New(),
+		ChannelID: ch.ID,
+		TargetURL: req.TargetURL,
+		Label:     req.Label,
+		CreatedAt: time.Now(),
+	}
+	if err := h.linkRepo.Create(link); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create link")
+		return
+	}
+	h.withShortURL(link)
+	c.JSON(http.StatusCreated, link)
+}
+
+// GetLinkStats returns a link with its clicks per day over the last ?days=
+// days, today included
+func (h *LinkHandler) GetLinkStats(c *gin.Context) {
+	days := linkStatsDays
+	if s := c.Query("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > linkStatsMaxDays {
+			ErrorResponse(c, http.StatusBadRequest, "days must be between 1 and 90")
+			return
+		}
+		days = n
+	}
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+
+	link, err := h.linkRepo.Get(ch.ID, c.Param("code"))
+	if errors.Is(err, repository.ErrLinkNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Link not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get link")
+		return
+	}
+	clicks, err := h.linkRepo.ClicksByDay(link.ID, time.Now().UTC().AddDate(0, 0, 1-days))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get link clicks")
+		return
+	}
+	h.withShortURL(link)
+	c.JSON(http.StatusOK, models.ChannelLinkStats{ChannelLink: *link, Days: clicks})
+}
+
+// DeleteLink removes a link; its short URL stops working
+func (h *LinkHandler) DeleteLink(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	err := h.linkRepo.Delete(ch.ID, c.Param("code"))
+	if errors.Is(err, repository.ErrLinkNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Link not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete link")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Redirect counts a click on the short link and sends the browser on. HEAD
+// requests, as sent by link previews, are redirected without counting.
+func (h *LinkHandler) Redirect(c *gin.Context) {
+	var (
+		target *string
+		slug   string
+		err    error
+	)
+	if c.Request.Method == http.MethodHead {
+		target, slug, err = h.linkRepo.Resolve(c.Param("code"))
+	} else {
+		target, slug, err = h.linkRepo.Click(c.Param("code"))
+	}
+	if errors.Is(err, repository.ErrLinkNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Link not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to follow link")
+		return
+	}
+
+	// Every click must reach the server to be counted
+	c.Header("Cache-Control", "no-store")
+	if target != nil {
+		c.Redirect(http.StatusFound, *target)
+		return
+	}
+	c.Redirect(http.StatusFound, h.appURL+"/channels/"+url.PathEscape(slug))
+}
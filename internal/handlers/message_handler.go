@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/authz"
 	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/middleware"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+	"github.com/tullo/backend/internal/preview"
 	"github.com/tullo/backend/internal/repository"
 )
 
@@ -15,67 +23,180 @@ type MessageHandler struct {
 	msgRepo  *repository.MessageRepository
 	convRepo *repository.ConversationRepository
 	redis    *cache.RedisClient
+	reports  *auth.ReportSigner
+	sends    *middleware.SendLimiter
+	policy   *authz.Policy
+	previews *preview.Service
 }
 
 func NewMessageHandler(
 	msgRepo *repository.MessageRepository,
 	convRepo *repository.ConversationRepository,
 	redis *cache.RedisClient,
+	reports *auth.ReportSigner,
+	sends *middleware.SendLimiter,
+	policy *authz.Policy,
+	previews *preview.Service,
 ) *MessageHandler {
 	return &MessageHandler{
 		msgRepo:  msgRepo,
 		convRepo: convRepo,
 		redis:    redis,
+		reports:  reports,
+		sends:    sends,
+		policy:   policy,
+		previews: previews,
 	}
 }
 
+// limitSend applies the per-conversation send limit and answers 429 once it
+// is used up; it reports whether the message may be sent
+func limitSend(c *gin.Context, sends *middleware.SendLimiter, kind string, conversationID, userID uuid.UUID) bool {
+	res := sends.Allow(kind, conversationID, userID)
+	if res.Limit > 0 {
+		middleware.WriteRateLimitHeaders(c, res)
+	}
+	if !res.Allowed {
+		ErrorCode(c, http.StatusTooManyRequests, apierror.RateLimited, "Sending too fast in this conversation")
+		return false
+	}
+	return true
+}
+
+// sendFailed answers a message that could not be created, telling senders
+// over a chat's limits what the limit is
+func sendFailed(c *gin.Context, err error) {
+	var limit *repository.ChatLimitError
+	if errors.As(err, &limit) {
+		code, msg := limit.Reason()
+		ErrorCode(c, http.StatusBadRequest, code, msg)
+		return
+	}
+	ErrorResponse(c, http.StatusInternalServerError, "Failed to send message")
+}
+
 // GetMessages returns messages for a conversation
 func (h *MessageHandler) GetMessages(c *gin.Context) {
 	var req models.GetMessagesRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ValidationError(c, err)
 		return
 	}
 
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
 
-	// Check if user is a member
+	// Check if user is a member, or was sent the conversation as a message
+	// request and is reading it before answering
 	isMember, err := h.convRepo.IsMember(req.ConversationID, uid)
+	if err == nil && !isMember {
+		isMember, err = h.convRepo.IsRequestRecipient(req.ConversationID, uid)
+	}
 	if err != nil || !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
+		return
+	}
+
+	listMessages(c, h.msgRepo, req.ConversationID, false, func(messages []models.Message) []models.Message {
+		return withReportTokens(h.reports, messages)
+	})
+}
+
+func messageCursor(m models.Message) pagination.Cursor {
+	return pagination.Cursor{Time: m.CreatedAt, ID: m.ID}
+}
+
+// listMessages answers with a page of the conversation's messages, newest
+// first, passed through show. Besides limit and cursor it takes before_id,
+// shorthand for a cursor at that message, and after_id, which returns the
+// messages after that one oldest first, for catching up after a reconnect;
+// its next_cursor goes back along with the same after_id. withDeleted lists
+// deleted messages in full, for moderators; it pages backwards only.
+func listMessages(c *gin.Context, msgRepo *repository.MessageRepository, conversationID uuid.UUID, withDeleted bool, show func([]models.Message) []models.Message) {
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	if withDeleted && c.Query("after_id") != "" {
+		ErrorResponse(c, http.StatusBadRequest, "after_id cannot be combined with include_deleted")
+		return
+	}
+
+	if c.Query("after_id") != "" {
+		m, ok := anchorMessage(c, msgRepo, conversationID, "after_id")
+		if !ok {
+			return
+		}
+		if cursor == nil {
+			cursor = &pagination.Cursor{Time: m.CreatedAt, ID: m.ID}
+		}
+		messages, err := msgRepo.ListAfter(conversationID, limit, *cursor)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get messages")
+			return
+		}
+		c.JSON(http.StatusOK, pagination.NewPage(show(messages), limit, messageCursor))
 		return
 	}
 
-	// Set defaults
-	if req.Limit == 0 {
-		req.Limit = 50
+	if c.Query("before_id") != "" {
+		m, ok := anchorMessage(c, msgRepo, conversationID, "before_id")
+		if !ok {
+			return
+		}
+		cursor = &pagination.Cursor{Time: m.CreatedAt, ID: m.ID}
 	}
 
-	messages, err := h.msgRepo.GetByConversationID(req.ConversationID, req.Limit, req.Offset)
+	list := msgRepo.ListByConversation
+	if withDeleted {
+		list = msgRepo.ListWithDeleted
+	}
+	messages, err := list(conversationID, limit, cursor)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get messages"})
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get messages")
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, pagination.NewPage(show(messages), limit, messageCursor))
+}
+
+// anchorMessage loads the message named by the query parameter param, which
+// must be in the conversation, answering the request if it isn't
+func anchorMessage(c *gin.Context, msgRepo *repository.MessageRepository, conversationID uuid.UUID, param string) (*models.Message, bool) {
+	id, err := uuid.Parse(c.Query(param))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid "+param)
+		return nil, false
+	}
+	m, err := msgRepo.GetByID(id)
+	if err != nil || m.ConversationID != conversationID {
+		ErrorResponse(c, http.StatusBadRequest, "invalid "+param)
+		return nil, false
+	}
+	return m, true
 }
 
 // SendMessage sends a new message (REST endpoint)
 func (h *MessageHandler) SendMessage(c *gin.Context) {
 	var req models.SendMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ValidationError(c, err)
 		return
 	}
 
 	userID, _ := c.Get("user_id")
 	uid := userID.(uuid.UUID)
 
-	// Check if user is a member
-	isMember, err := h.convRepo.IsMember(req.ConversationID, uid)
-	if err != nil || !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	kind, err := h.policy.CanPost(req.ConversationID, uid)
+	if err != nil {
+		postDenied(c, err)
+		return
+	}
+	if req.Kind == models.MessageEncrypted && kind != models.ConversationDirect {
+		ErrorResponse(c, http.StatusBadRequest, "Encrypted messages are only allowed in direct conversations")
+		return
+	}
+	if !limitSend(c, h.sends, kind, req.ConversationID, uid) {
 		return
 	}
 
@@ -85,20 +206,24 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 		ConversationID: req.ConversationID,
 		SenderID:       uid,
 		Body:           req.Body,
+		Kind:           req.Kind,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
 
 	if err := h.msgRepo.Create(message); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		sendFailed(c, err)
 		return
 	}
+	message.ReportToken = h.reports.Token(message.ID)
 
 	// Publish to Redis for WebSocket broadcast
 	h.redis.PublishMessage(models.WSMessage{
 		Event:   models.EventMessageNew,
 		Payload: message,
 	})
+	h.redis.RecordChatMessage(message.ConversationID, uid)
+	h.previews.Enqueue(message)
 
 	c.JSON(http.StatusCreated, message)
 }
@@ -107,7 +232,7 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 func (h *MessageHandler) MarkMessageAsRead(c *gin.Context) {
 	messageID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		ErrorResponse(c, http.StatusBadRequest, "Invalid message ID")
 		return
 	}
 
@@ -117,22 +242,236 @@ func (h *MessageHandler) MarkMessageAsRead(c *gin.Context) {
 	// Get message to verify conversation membership
 	message, err := h.msgRepo.GetByID(messageID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
 		return
 	}
 
 	// Check if user is a member
 	isMember, err := h.convRepo.IsMember(message.ConversationID, uid)
 	if err != nil || !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
 		return
 	}
 
-	// Mark as read
-	if err := h.msgRepo.MarkAsRead(messageID, uid); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark message as read"})
+	// Mark as read, along with everything before it
+	marker, err := h.msgRepo.AdvanceReadMarker(messageID, uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to mark message as read")
 		return
 	}
+	if marker != nil && h.redis != nil {
+		h.publishReadMarker(marker)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Message marked as read"})
 }
+
+// DeleteMessage deletes a message for everyone. The sender may delete their
+// own messages; moderators of a channel chat and admins of other
+// conversations anyone's. The message stays behind as a tombstone.
+func (h *MessageHandler) DeleteMessage(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	message, err := h.msgRepo.GetByID(messageID)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+	allowed, err := h.policy.CanDeleteMessage(message, uid)
+	if !permitted(c, allowed, err, "Only the sender or a moderator can delete this message") {
+		return
+	}
+
+	deletedAt, err := h.msgRepo.Delete(messageID, uid)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete message")
+		return
+	}
+	publishMessageDeleted(h.redis, message, uid, deletedAt)
+
+	c.Status(http.StatusNoContent)
+}
+
+// publishMessageDeleted tells msg's conversation that deletedBy deleted it
+func publishMessageDeleted(redis *cache.RedisClient, msg *models.Message, deletedBy uuid.UUID, deletedAt time.Time) {
+	if redis == nil {
+		return
+	}
+	payload := models.WSMessageDeletedPayload{MessageID: msg.ID, ConversationID: msg.ConversationID, DeletedBy: deletedBy, DeletedAt: deletedAt}
+	if err := redis.PublishMessage(models.WSMessage{Event: models.EventMessageDeleted, Payload: payload}); err != nil {
+		log.Printf("Failed to publish deletion of message %s: %v", msg.ID, err)
+	}
+}
+
+// RestoreMessage undoes the deletion of a message, e.g. one the moderation
+// bot removed by mistake. Moderators and admins may restore any message of
+// their conversation, senders those they deleted themselves.
+func (h *MessageHandler) RestoreMessage(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	message, err := h.msgRepo.GetByIDIncludeDeleted(messageID)
+	if err != nil || message.DeletedAt == nil {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Deleted message not found")
+		return
+	}
+	allowed, err := h.policy.CanRestoreMessage(message, uid)
+	if !permitted(c, allowed, err, "Only a moderator can restore this message") {
+		return
+	}
+
+	if err := h.msgRepo.Restore(messageID); errors.Is(err, repository.ErrMessageNotFound) {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Deleted message not found")
+		return
+	} else if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to restore message")
+		return
+	}
+	restored, err := h.msgRepo.GetByID(messageID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to restore message")
+		return
+	}
+	restored.ReportToken = h.reports.Token(restored.ID)
+	publishMessageRestored(h.redis, restored)
+
+	c.JSON(http.StatusOK, restored)
+}
+
+// publishMessageRestored gives msg's conversation back a deleted message
+func publishMessageRestored(redis *cache.RedisClient, msg *models.Message) {
+	if redis == nil {
+		return
+	}
+	if err := redis.PublishMessage(models.WSMessage{Event: models.EventMessageRestored, Payload: msg}); err != nil {
+		log.Printf("Failed to publish restoration of message %s: %v", msg.ID, err)
+	}
+}
+
+// publishReadMarker syncs a moved read marker to all of the reader's sessions
+func (h *MessageHandler) publishReadMarker(marker *models.ReadMarker) {
+	unread, err := h.msgRepo.GetUnreadCount(marker.ConversationID, marker.UserID)
+	if err != nil {
+		log.Printf("Failed to count unread messages for read marker: %v", err)
+		return
+	}
+	h.redis.PublishMessage(models.WSMessage{
+		Event:   models.EventReadMarker,
+		Payload: models.WSReadMarkerPayload{ReadMarker: *marker, UnreadCount: unread},
+	})
+}
+
+// MarkConversationRead moves the current user's read marker in a
+// conversation to a message, or the newest one, without a read receipt per
+// message, and syncs it to their sessions with one conversation.read event.
+// Unread counts follow the marker.
+func (h *MessageHandler) MarkConversationRead(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	var req models.ReadConversationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			ValidationError(c, err)
+			return
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	isMember, err := h.convRepo.IsMember(conversationID, uid)
+	if err != nil || !isMember {
+		ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
+		return
+	}
+
+	marker, err := h.msgRepo.MoveReadMarker(conversationID, uid, req.MessageID)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to mark conversation as read")
+		return
+	}
+
+	resp := models.ReadConversationResponse{ConversationID: conversationID}
+	if resp.UnreadCount, err = h.msgRepo.GetUnreadCount(conversationID, uid); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to count unread messages")
+		return
+	}
+	if marker != nil {
+		resp.LastReadMessageID = &marker.LastReadMessageID
+		if h.redis != nil {
+			h.redis.PublishMessage(models.WSMessage{
+				Event:   models.EventReadMarker,
+				Payload: models.WSReadMarkerPayload{ReadMarker: *marker, UnreadCount: resp.UnreadCount},
+			})
+		}
+	} else if resp.LastReadMessageID, err = h.convRepo.GetReadMarker(conversationID, uid); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get read marker")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// MarkAllAsRead clears unread state across the user's conversations (or the
+// listed ones) in one statement and tells the user's sessions with a single
+// message.read_all event
+func (h *MessageHandler) MarkAllAsRead(c *gin.Context) {
+	var req models.MarkAllReadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			ValidationError(c, err)
+			return
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	counts, err := h.msgRepo.MarkAllAsRead(uid, req.ConversationIDs)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to mark messages as read")
+		return
+	}
+
+	resp := models.MarkAllReadResponse{Conversations: counts, ReadAt: time.Now()}
+	for _, rc := range counts {
+		resp.Marked += rc.Marked
+	}
+
+	if resp.Marked > 0 && h.redis != nil {
+		h.redis.PublishMessage(models.WSMessage{
+			Event: models.EventMessageReadAll,
+			Payload: models.WSReadAllPayload{
+				UserID:        uid,
+				Conversations: counts,
+				ReadAt:        resp.ReadAt,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// oauthStateCookie keeps the state nonce in the browser between the redirect
+// to the provider and the callback
+const oauthStateCookie = "oauth_state"
+
+type OAuthHandler struct {
+	auth         *AuthHandler
+	identityRepo *repository.IdentityRepository
+	oauth        *auth.OAuth
+	// apiURL is where providers send the user back; appURL receives the
+	// outcome in its URL fragment
+	apiURL string
+	appURL string
+}
+
+func NewOAuthHandler(authHandler *AuthHandler, identityRepo *repository.IdentityRepository, oauth *auth.OAuth, apiURL, appURL string) *OAuthHandler {
+	return &OAuthHandler{
+		auth:         authHandler,
+		identityRepo: identityRepo,
+		oauth:        oauth,
+		apiURL:       strings.TrimSuffix(apiURL, "/"),
+		appURL:       strings.TrimSuffix(appURL, "/"),
+	}
+}
+
+// Start redirects the browser to the provider's sign-in page
+func (h *OAuthHandler) Start(c *gin.Context) {
+	provider, ok := h.oauth.Provider(c.Param("provider"))
+	if !ok {
+		ErrorResponse(c, http.StatusNotFound, "Unknown OAuth provider")
+		return
+	}
+
+	state, nonce, err := h.oauth.NewState(provider.Name())
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+	h.setStateCookie(c, nonce, 600)
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, h.callbackURL(provider)))
+}
+
+// Callback finishes the sign-in and redirects to the app with a token pair
+// (or an error) in the URL fragment. The provider account signs in the user
+// it is linked to; an unlinked account is linked to the user with the same
+// verified email, or gets a new user.
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	provider, ok := h.oauth.Provider(c.Param("provider"))
+	if !ok {
+		ErrorResponse(c, http.StatusNotFound, "Unknown OAuth provider")
+		return
+	}
+
+	nonce, _ := c.Cookie(oauthStateCookie)
+	h.setStateCookie(c, "", -1)
+	if err := h.oauth.VerifyState(c.Query("state"), provider.Name(), nonce); err != nil {
+		h.finish(c, url.Values{"error": {"invalid_state"}})
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		// e.g. access_denied when the user cancels at the provider
+		h.finish(c, url.Values{"error": {e}})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), h.callbackURL(provider))
+	if err != nil {
+		log.Printf("OAuth exchange with %s failed: %v", provider.Name(), err)
+		h.finish(c, url.Values{"error": {"exchange_failed"}})
+		return
+	}
+
+	user, code := resolveIdentityUser(h.auth.userRepo, h.identityRepo, identity)
+	if code != "" {
+		h.finish(c, url.Values{"error": {code}})
+		return
+	}
+
+	resp, err := h.auth.login(c, user)
+	if err != nil {
+		h.finish(c, url.Values{"error": {"server_error"}})
+		return
+	}
+	h.finish(c, url.Values{
+		"token":         {resp.Token},
+		"refresh_token": {resp.RefreshToken},
+		"expires_in":    {strconv.Itoa(resp.ExpiresIn)},
+	})
+}
+
+// resolveIdentityUser finds the user linked to identity, links it to the
+// verified account with the same email, or creates a new user; on failure it
+// returns an error code for the client. Used by social login and SSO.
+func resolveIdentityUser(userRepo *repository.UserRepository, identityRepo *repository.IdentityRepository, identity *auth.OAuthIdentity) (*models.User, string) {
+	user, err := identityRepo.GetUser(identity.Provider, identity.Subject)
+	if err == nil {
+		return user, ""
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		log.Printf("Failed to look up %s identity: %v", identity.Provider, err)
+		return nil, "server_error"
+	}
+
+	// Unlinked accounts are matched by email, so only trust addresses the
+	// provider has verified
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, "email_unverified"
+	}
+	link := &models.UserIdentity{Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email}
+
+	if existing, err := userRepo.GetByEmail(identity.Email); err == nil {
+		// Someone could register with another person's address and wait for
+		// them to sign in with a provider; only link to accounts whose owner
+		// proved they control the address
+		if existing.EmailVerifiedAt == nil {
+			return nil, "account_exists"
+		}
+		link.UserID = existing.ID
+		if err := identityRepo.Link(link); err != nil {
+			if errors.Is(err, repository.ErrIdentityConflict) {
+				return nil, "account_conflict"
+			}
+			log.Printf("Failed to link %s identity to %s: %v", identity.Provider, existing.ID, err)
+			return nil, "server_error"
+		}
+		return existing, ""
+	}
+
+	now := time.Now()
+	user = &models.User{
+		ID:              uuid.New(),
+		Email:           identity.Email,
+		DisplayName:     oauthDisplayName(identity),
+		EmailVerifiedAt: &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if identity.AvatarURL != "" {
+		user.AvatarURL = &identity.AvatarURL
+	}
+	if err := identityRepo.CreateUser(user, link); err != nil {
+		if errors.Is(err, repository.ErrIdentityConflict) {
+			return nil, "account_conflict"
+		}
+		log.Printf("Failed to create user for %s identity: %v", identity.Provider, err)
+		return nil, "server_error"
+	}
+	return user, ""
+}
+
+func (h *OAuthHandler) callbackURL(provider auth.OAuthProvider) string {
+	return h.apiURL + "/auth/oauth/" + provider.Name() + "/callback"
+}
+
+func (h *OAuthHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, value, maxAge, "/auth/oauth", "", strings.HasPrefix(h.apiURL, "https://"), true)
+}
+
+// finish sends the browser to the app; the fragment keeps tokens out of
+// server logs and Referer headers
+func (h *OAuthHandler) finish(c *gin.Context, fragment url.Values) {
+	c.Redirect(http.StatusFound, h.appURL+"/oauth/callback#"+fragment.Encode())
+}
+
+// oauthDisplayName picks a display name within the 2-100 character limit
+func oauthDisplayName(identity *auth.OAuthIdentity) string {
+	name := strings.TrimSpace(identity.Name)
+	if utf8.RuneCountInString(name) < 2 {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if utf8.RuneCountInString(name) < 2 {
+		name = "user"
+	}
+	if len(name) > 100 {
+		runes := []rune(name)
+		for len(string(runes)) > 100 {
+			runes = runes[:len(runes)-1]
+		}
+		name = string(runes)
+	}
+	return name
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// overlayHeartbeat is how often an idle overlay feed gets a comment line, so
+// proxies keep it open, and its token is checked for revocation
+const overlayHeartbeat = 25 * time.Second
+
+// OverlayFeed delivers a channel's alerts to overlay streams; the WebSocket
+// hub implements it
+type OverlayFeed interface {
+	SubscribeOverlay(channelID uuid.UUID) (<-chan models.WSMessage, func())
+}
+
+// OverlayHandler manages channel overlay tokens and serves the alert stream
+// that overlays read with them
+type OverlayHandler struct {
+	channelRepo *repository.ChannelRepository
+	tokenRepo   *repository.OverlayTokenRepository
+	policy      *authz.Policy
+	// feed is nil without Redis; the event stream is then unavailable
+	feed   OverlayFeed
+	apiURL string
+}
+
+func NewOverlayHandler(chRepo *repository.ChannelRepository, tokenRepo *repository.OverlayTokenRepository, policy *authz.Policy, feed OverlayFeed, apiURL string) *OverlayHandler {
+	return &OverlayHandler{channelRepo: chRepo, tokenRepo: tokenRepo, policy: policy, feed: feed, apiURL: apiURL}
+}
+
+// ownedChannel loads the channel in the path and checks that the caller
+// owns it, writing the error response when not
+func (h *OverlayHandler) ownedChannel(c *gin.Context) (*models.Channel, bool) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return nil, false
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "only the owner can manage overlay tokens") {
+		return nil, false
+	}
+	return ch, true
+}
+
+// CreateToken gives the channel a new overlay token, revoking the old one.
+// The token is only ever returned here.
+func (h *OverlayHandler) CreateToken(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+
+	token, hint, err := auth.GenerateOverlayToken()
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate overlay token")
+		return
+	}
+	t, err := h.tokenRepo.Set(ch.ID, hint, auth.HashAPIKey(token))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create overlay token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreateOverlayTokenResponse{
+		OverlayToken: *t,
+		Token:        token,
+		EventsURL:    h.apiURL + "/overlay/events?token=" + url.QueryEscape(token),
+	})
+}
+
+// GetToken describes the channel's overlay token without revealing it
+func (h *OverlayHandler) GetToken(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	t, err := h.tokenRepo.Get(ch.ID)
+	if errors.Is(err, repository.ErrOverlayTokenNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Overlay token not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get overlay token")
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// RevokeToken deletes the channel's overlay token; overlays using it are
+// disconnected within overlayHeartbeat
+func (h *OverlayHandler) RevokeToken(c *gin.Context) {
+	ch, ok := h.ownedChannel(c)
+	if !ok {
+		return
+	}
+	err := h.tokenRepo.Revoke(ch.ID)
+	if errors.Is(err, repository.ErrOverlayTokenNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Overlay token not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke overlay token")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Events streams the alerts of the channel owning ?token= as server-sent
+// events, named after the WebSocket event and carrying its payload
+func (h *OverlayHandler) Events(c *gin.Context) {
+	if h.feed == nil {
+		ErrorResponse(c, http.StatusServiceUnavailable, "Overlay events are unavailable")
+		return
+	}
+	tokenHash := auth.HashAPIKey(c.Query("token"))
+	channelID, err := h.tokenRepo.Authenticate(tokenHash)
+	if errors.Is(err, repository.ErrOverlayTokenNotFound) {
+		ErrorCode(c, http.StatusUnauthorized, apierror.InvalidToken, "Invalid overlay token")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to check overlay token")
+		return
+	}
+
+	events, stop := h.feed.SubscribeOverlay(channelID)
+	defer stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Keep nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	// Overlays are loaded from anywhere, often a local file; the token in
+	// the URL is the only credential, so any origin may read the stream
+	if c.Writer.Header().Get("Access-Control-Allow-Origin") == "" {
+		c.Header("Access-Control-Allow-Origin", "*")
+	}
+	c.Status(http.StatusOK)
+
+	heartbeat := time.NewTicker(overlayHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case msg := <-events:
+			c.SSEvent(msg.Event, msg.Payload)
+			return true
+		case <-heartbeat.C:
+			if id, err := h.tokenRepo.Authenticate(tokenHash); err != nil || id != channelID {
+				return false
+			}
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// pageParams reads the shared limit/cursor query parameters. On an invalid
+// cursor it writes a 400 response and returns ok=false.
+func pageParams(c *gin.Context) (limit int, cursor *pagination.Cursor, ok bool) {
+	limit = pagination.ParseLimit(c.Query("limit"))
+	cursor, err := pagination.Decode(c.Query("cursor"))
+	if err != nil {
+		ErrorCode(c, http.StatusBadRequest, apierror.ValidationFailed, err.Error())
+		return 0, nil, false
+	}
+	return limit, cursor, true
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type ReportHandler struct {
+	msgRepo     *repository.MessageRepository
+	convRepo    *repository.ConversationRepository
+	channelRepo *repository.ChannelRepository
+	reportRepo  *repository.ReportRepository
+	reports     *auth.ReportSigner
+	policy      *authz.Policy
+}
+
+func NewReportHandler(msgRepo *repository.MessageRepository, convRepo *repository.ConversationRepository, chRepo *repository.ChannelRepository, reportRepo *repository.ReportRepository, reports *auth.ReportSigner, policy *authz.Policy) *ReportHandler {
+	return &ReportHandler{msgRepo: msgRepo, convRepo: convRepo, channelRepo: chRepo, reportRepo: reportRepo, reports: reports, policy: policy}
+}
+
+// withReportTokens sets the report token on each message about to be
+// delivered to a client
+func withReportTokens(reports *auth.ReportSigner, messages []models.Message) []models.Message {
+	for i := range messages {
+		messages[i].ReportToken = reports.Token(messages[i].ID)
+	}
+	return messages
+}
+
+// ReportMessage files a report against a message for the moderators. The
+// report_token delivered with the message lets viewers report it even after
+// it was deleted; without one the caller must be a member of the
+// conversation and the message must still be visible.
+func (h *ReportHandler) ReportMessage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	var req models.ReportMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	message, err := h.msgRepo.GetByIDIncludeDeleted(id)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+
+	if req.ReportToken != "" {
+		if !h.reports.Valid(message.ID, req.ReportToken) {
+			ErrorCode(c, http.StatusForbidden, apierror.InvalidToken, "Invalid report token")
+			return
+		}
+	} else {
+		if message.DeletedAt != nil {
+			ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+			return
+		}
+		isMember, err := h.convRepo.IsMember(message.ConversationID, uid)
+		if err != nil || !isMember {
+			ErrorCode(c, http.StatusForbidden, apierror.NotMember, "Not a member of this conversation")
+			return
+		}
+	}
+
+	if message.SenderID == uid {
+		ErrorResponse(c, http.StatusBadRequest, "You cannot report your own message")
+		return
+	}
+
+	report, err := h.reportRepo.Create(message, uid, req.Reason, req.Details)
+	if errors.Is(err, repository.ErrAlreadyReported) {
+		ErrorCode(c, http.StatusConflict, apierror.AlreadyReported, "Message already reported")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to report message")
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// ListReports returns the report queue, newest first. status selects
+// pending (default), resolved or dismissed reports.
+func (h *ReportHandler) ListReports(c *gin.Context) {
+	h.listReports(c, nil)
+}
+
+// ListChannelReports returns the reports against a channel's chat messages,
+// like ListReports (owner and moderators only)
+func (h *ReportHandler) ListChannelReports(c *gin.Context) {
+	if convID, ok := h.channelQueue(c); ok {
+		h.listReports(c, &convID)
+	}
+}
+
+// ListConversationReports returns the reports against a conversation's
+// messages, like ListReports (whoever may delete them)
+func (h *ReportHandler) ListConversationReports(c *gin.Context) {
+	if convID, ok := h.conversationQueue(c); ok {
+		h.listReports(c, &convID)
+	}
+}
+
+// ResolveReport closes a pending report as resolved or dismissed. Acting on
+// the message itself (e.g. deleting it) is a separate admin call.
+func (h *ReportHandler) ResolveReport(c *gin.Context) {
+	h.resolveReport(c, "id", nil)
+}
+
+// ResolveChannelReport closes a pending report from a channel's queue, like
+// ResolveReport
+func (h *ReportHandler) ResolveChannelReport(c *gin.Context) {
+	if convID, ok := h.channelQueue(c); ok {
+		h.resolveReport(c, "report_id", &convID)
+	}
+}
+
+// ResolveConversationReport closes a pending report from a conversation's
+// queue, like ResolveReport
+func (h *ReportHandler) ResolveConversationReport(c *gin.Context) {
+	if convID, ok := h.conversationQueue(c); ok {
+		h.resolveReport(c, "report_id", &convID)
+	}
+}
+
+// channelQueue returns the chat conversation of the :slug channel if the
+// caller may moderate it
+func (h *ReportHandler) channelQueue(c *gin.Context) (uuid.UUID, bool) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return uuid.Nil, false
+	}
+	allowed, err := h.policy.CanModerate(ch, uid)
+	if !permitted(c, allowed, err, "Only moderators can see the channel's reports") {
+		return uuid.Nil, false
+	}
+	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get conversation")
+		return uuid.Nil, false
+	}
+	return convID, true
+}
+
+// conversationQueue returns the :id conversation if the caller may review
+// its reports
+func (h *ReportHandler) conversationQueue(c *gin.Context) (uuid.UUID, bool) {
+	convID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return uuid.Nil, false
+	}
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	allowed, err := h.policy.CanReviewReports(convID, uid)
+	if !permitted(c, allowed, err, "Only moderators can see the conversation's reports") {
+		return uuid.Nil, false
+	}
+	return convID, true
+}
+
+// listReports lists the reports against one conversation's messages, or all
+// with a nil conversationID
+func (h *ReportHandler) listReports(c *gin.Context, conversationID *uuid.UUID) {
+	status := c.DefaultQuery("status", models.ReportPending)
+	switch status {
+	case models.ReportPending, models.ReportResolved, models.ReportDismissed:
+	default:
+		ErrorResponse(c, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	var reports []models.MessageReport
+	var err error
+	if conversationID != nil {
+		reports, err = h.reportRepo.ListByConversation(*conversationID, status, limit, cursor)
+	} else {
+		reports, err = h.reportRepo.List(status, limit, cursor)
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list reports")
+		return
+	}
+
+	c.JSON(http.StatusOK, pagination.NewPage(reports, limit, reportCursor))
+}
+
+func reportCursor(r models.MessageReport) pagination.Cursor {
+	return pagination.Cursor{Time: r.CreatedAt, ID: r.ID}
+}
+
+// resolveReport closes the report named by the param route parameter; with a
+// conversationID, only reports against that conversation's messages
+func (h *ReportHandler) resolveReport(c *gin.Context, param string, conversationID *uuid.UUID) {
+	id, err := uuid.Parse(c.Param(param))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "invalid report id")
+		return
+	}
+
+	var req models.ResolveReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	var report *models.MessageReport
+	if conversationID != nil {
+		report, err = h.reportRepo.ResolveInConversation(id, *conversationID, req.Status, uid)
+	} else {
+		report, err = h.reportRepo.Resolve(id, req.Status, uid)
+	}
+	if errors.Is(err, repository.ErrReportNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Pending report not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
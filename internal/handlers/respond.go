@@ -1,10 +1,28 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
 )
 
-// ErrorResponse sends a standardized error response and logs at caller if needed
+// ErrorResponse sends the standard error envelope with the generic code for status
 func ErrorResponse(c *gin.Context, status int, message string) {
-	c.JSON(status, gin.H{"error": message})
+	apierror.Write(c, status, apierror.DefaultCode(status), message, nil)
+}
+
+// ErrorCode sends the standard error envelope with a specific code from the catalog
+func ErrorCode(c *gin.Context, status int, code apierror.Code, message string) {
+	apierror.Write(c, status, code, message, nil)
+}
+
+// ValidationError reports a request binding failure as VALIDATION_FAILED with per-field details
+func ValidationError(c *gin.Context, err error) {
+	message, details := apierror.Validation(err)
+	if len(details) == 0 {
+		apierror.Write(c, http.StatusBadRequest, apierror.ValidationFailed, message, nil)
+		return
+	}
+	apierror.Write(c, http.StatusBadRequest, apierror.ValidationFailed, message, details)
 }
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type SessionHandler struct {
+	sessionRepo *repository.SessionRepository
+	authEvents  *repository.AuthEventRepository
+	redis       *cache.RedisClient
+}
+
+func NewSessionHandler(sessionRepo *repository.SessionRepository, authEvents *repository.AuthEventRepository, redis *cache.RedisClient) *SessionHandler {
+	return &SessionHandler{sessionRepo: sessionRepo, authEvents: authEvents, redis: redis}
+}
+
+// ListSessions returns the devices the current user is signed in on; the
+// one making the request is marked current
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	sessions, err := h.sessionRepo.ListByUser(uid)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+	if current, ok := c.Get("session_id"); ok {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == current.(uuid.UUID)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs out one of the current user's sessions. Its refresh
+// token stops working, its access tokens are rejected from the next request
+// and its WebSocket connections are closed.
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	err = h.sessionRepo.Revoke(id, uid)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		ErrorResponse(c, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	auditAuth(c, h.authEvents, auditSessionRevoked, uid, "")
+
+	if h.redis != nil {
+		h.redis.PublishMessage(models.WSMessage{
+			Event:   models.EventSessionRevoked,
+			Payload: models.WSSessionRevokedPayload{UserID: uid, SessionID: id},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// ListSecurityEvents returns a page of the current user's security log:
+// registrations, sign-ins, failed sign-ins, password changes and revoked
+// sessions and API keys, newest first
+func (h *SessionHandler) ListSecurityEvents(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	limit, cursor, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	events, err := h.authEvents.ListByUser(uid, limit, cursor)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to list security events")
+		return
+	}
+	c.JSON(http.StatusOK, pagination.NewPage(events, limit, func(e models.AuthEvent) pagination.Cursor {
+		return pagination.Cursor{Time: e.CreatedAt, ID: e.ID}
+	}))
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+type SSOHandler struct {
+	auth         *AuthHandler
+	identityRepo *repository.IdentityRepository
+	verifier     *auth.OIDCVerifier
+}
+
+func NewSSOHandler(authHandler *AuthHandler, identityRepo *repository.IdentityRepository, verifier *auth.OIDCVerifier) *SSOHandler {
+	return &SSOHandler{auth: authHandler, identityRepo: identityRepo, verifier: verifier}
+}
+
+// Authenticate resolves the user an SSO token was issued for, provisioning
+// them on first sign-in. It lets middleware.AuthMiddleware accept the
+// issuer's tokens directly.
+func (h *SSOHandler) Authenticate(ctx context.Context, token string) (*models.User, error) {
+	identity, err := h.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	user, code := resolveIdentityUser(h.auth.userRepo, h.identityRepo, identity)
+	if code != "" {
+		return nil, fmt.Errorf("failed to resolve sso user: %s", code)
+	}
+	return user, nil
+}
+
+// Exchange trades an SSO token for a Tullo token pair, for clients that need
+// a session of their own, such as for the WebSocket or to refresh without
+// going back to the identity provider
+func (h *SSOHandler) Exchange(c *gin.Context) {
+	var req models.SSOExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+
+	identity, err := h.verifier.Verify(c.Request.Context(), req.Token)
+	if err != nil {
+		log.Printf("SSO token rejected: %v", err)
+		ErrorCode(c, http.StatusUnauthorized, apierror.InvalidToken, "Invalid or expired SSO token")
+		return
+	}
+
+	user, code := resolveIdentityUser(h.auth.userRepo, h.identityRepo, identity)
+	switch code {
+	case "":
+	case "email_unverified":
+		ErrorCode(c, http.StatusForbidden, apierror.Forbidden, "The identity provider has not verified this email address")
+		return
+	case "account_exists", "account_conflict":
+		ErrorCode(c, http.StatusConflict, apierror.Conflict, "An account with this email address already exists")
+		return
+	default:
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to sign in")
+		return
+	}
+
+	resp, err := h.auth.login(c, user)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to sign in")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
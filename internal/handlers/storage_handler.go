@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// StorageHandler shows channel owners and conversation admins how much of
+// their attachment quota they use
+type StorageHandler struct {
+	channelRepo *repository.ChannelRepository
+	attachments *repository.AttachmentRepository
+	policy      *authz.Policy
+	// quotaBytes is the per-conversation quota, 0 for none; retention is how
+	// long attachments are kept, 0 for ever
+	quotaBytes int64
+	retention  time.Duration
+}
+
+func NewStorageHandler(chRepo *repository.ChannelRepository, attachments *repository.AttachmentRepository, policy *authz.Policy, quotaBytes int64, retention time.Duration) *StorageHandler {
+	return &StorageHandler{channelRepo: chRepo, attachments: attachments, policy: policy, quotaBytes: quotaBytes, retention: retention}
+}
+
+// GetChannelStorage returns the attachment storage used by a channel's chat
+// (owner only)
+func (h *StorageHandler) GetChannelStorage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	ch, err := h.channelRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.ChannelNotFound, "Channel not found")
+		return
+	}
+	if !permitted(c, h.policy.CanManage(ch, uid), nil, "Only the owner can see the channel's storage") {
+		return
+	}
+	convID, err := h.channelRepo.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get conversation")
+		return
+	}
+	h.usage(c, convID)
+}
+
+// GetConversationStorage returns the attachment storage used by a
+// conversation (admins only)
+func (h *StorageHandler) GetConversationStorage(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	allowed, err := h.policy.CanManageConversation(conversationID, uid)
+	if !permitted(c, allowed, err, "Only admins can see the conversation's storage") {
+		return
+	}
+	h.usage(c, conversationID)
+}
+
+func (h *StorageHandler) usage(c *gin.Context, conversationID uuid.UUID) {
+	usage, err := h.attachments.Usage(conversationID, h.retention)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get storage usage")
+		return
+	}
+	usage.QuotaBytes = h.quotaBytes
+	c.JSON(http.StatusOK, usage)
+}
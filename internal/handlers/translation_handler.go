@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+	"github.com/tullo/backend/internal/translate"
+)
+
+// TranslationHandler translates messages on request. Translations are kept,
+// so every reader after the first gets them without asking the provider.
+type TranslationHandler struct {
+	msgRepo      *repository.MessageRepository
+	translations *repository.TranslationRepository
+	policy       *authz.Policy
+	// provider is nil when translation is off; providerName is recorded
+	// with each translation
+	provider     translate.Provider
+	providerName string
+}
+
+func NewTranslationHandler(msgRepo *repository.MessageRepository, translations *repository.TranslationRepository, policy *authz.Policy, provider translate.Provider, providerName string) *TranslationHandler {
+	return &TranslationHandler{msgRepo: msgRepo, translations: translations, policy: policy, provider: provider, providerName: providerName}
+}
+
+// TranslateMessage returns a message's body in the requested language, for
+// anyone who may read the message
+func (h *TranslationHandler) TranslateMessage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+	var req models.TranslateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ValidationError(c, err)
+		return
+	}
+	language, ok := translate.NormalizeLanguage(req.Language)
+	if !ok {
+		ErrorCode(c, http.StatusBadRequest, apierror.ValidationFailed, "language must be a language tag such as de or pt-BR")
+		return
+	}
+	if h.provider == nil {
+		ErrorResponse(c, http.StatusServiceUnavailable, "Translation is not enabled")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+
+	message, err := h.msgRepo.GetByID(id)
+	if err != nil {
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+	allowed, err := h.policy.CanRead(message.ConversationID, uid)
+	if err != nil || !allowed {
+		// Messages one cannot read don't exist as far as they know
+		ErrorCode(c, http.StatusNotFound, apierror.MessageNotFound, "Message not found")
+		return
+	}
+	if message.Kind == models.MessageEncrypted {
+		ErrorResponse(c, http.StatusBadRequest, "Encrypted messages cannot be translated")
+		return
+	}
+
+	cached, err := h.translations.Get(message.ID, language)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to translate message")
+		return
+	}
+	if cached != nil {
+		c.JSON(http.StatusOK, cached)
+		return
+	}
+
+	res, err := h.provider.Translate(c.Request.Context(), message.Body, language)
+	if errors.Is(err, translate.ErrUnsupportedLanguage) {
+		ErrorCode(c, http.StatusBadRequest, apierror.ValidationFailed, "Messages cannot be translated into "+language)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to translate message %s: %v", message.ID, err)
+		ErrorResponse(c, http.StatusServiceUnavailable, "Translation is unavailable right now")
+		return
+	}
+
+	t := &models.MessageTranslation{MessageID: message.ID, Language: language, Text: res.Text, Provider: h.providerName}
+	if res.Source != "" {
+		t.SourceLanguage = &res.Source
+	}
+	if err := h.translations.Save(t); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to translate message")
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
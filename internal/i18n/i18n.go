@@ -0,0 +1,106 @@
+// Package i18n translates the human-readable part of API errors. Messages
+// are keyed by error code (see package apierror) and stored per language in
+// locales/<lang>.json; the machine-readable code itself is never translated.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Fallback is the language of the messages written in code
+const Fallback = "en"
+
+// Catalog holds the translated messages of each supported language
+type Catalog struct {
+	messages map[string]map[string]string
+}
+
+// Default is loaded from the embedded locales at startup
+var Default = mustLoad()
+
+func mustLoad() *Catalog {
+	c, err := load()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func load() (*Catalog, error) {
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read locales: %w", err)
+	}
+	c := &Catalog{messages: map[string]map[string]string{}}
+	for _, f := range files {
+		raw, err := localeFS.ReadFile("locales/" + f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read locale %s: %w", f.Name(), err)
+		}
+		msgs := map[string]string{}
+		if err := json.Unmarshal(raw, &msgs); err != nil {
+			return nil, fmt.Errorf("failed to parse locale %s: %w", f.Name(), err)
+		}
+		c.messages[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = msgs
+	}
+	return c, nil
+}
+
+// Languages lists the languages with translations, sorted
+func (c *Catalog) Languages() []string {
+	langs := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Translate returns the message for code in the best language the
+// Accept-Language header allows, and that language. Without a usable
+// translation it returns fallback, the English message from the call site.
+func (c *Catalog) Translate(acceptLanguage, code, fallback string) (string, string) {
+	lang := c.Negotiate(acceptLanguage)
+	if lang == Fallback {
+		return fallback, Fallback
+	}
+	if msg, ok := c.messages[lang][code]; ok {
+		return msg, lang
+	}
+	return fallback, Fallback
+}
+
+// Negotiate picks the supported language the client prefers most. Region
+// subtags are ignored ("de-AT" matches "de"); English is used when nothing
+// else matches.
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	best, bestQ := Fallback, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q <= bestQ {
+			continue
+		}
+		if _, ok := c.messages[lang]; ok || lang == Fallback {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
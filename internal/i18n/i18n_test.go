@@ -0,0 +1,67 @@
+package i18n
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                         "en",
+		"de":                       "de",
+		"de-AT":                    "de",
+		"FR-ca, en;q=0.5":          "fr",
+		"en, de;q=0.9":             "en",
+		"ja, es;q=0.8, de;q=0.9":   "de",
+		"ja":                       "en",
+		"de;q=0":                   "en",
+		"*":                        "en",
+		"es;q=bogus, fr;q=0.1":     "fr",
+		"en-GB;q=0.2, es-MX;q=0.3": "es",
+	}
+	for header, want := range cases {
+		if got := Default.Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	msg, lang := Default.Translate("de", "CHANNEL_NOT_FOUND", "Channel not found")
+	if msg != "Kanal nicht gefunden" || lang != "de" {
+		t.Errorf("de: %q, %q", msg, lang)
+	}
+	msg, lang = Default.Translate("en", "CHANNEL_NOT_FOUND", "Channel not found")
+	if msg != "Channel not found" || lang != "en" {
+		t.Errorf("en: %q, %q", msg, lang)
+	}
+	msg, lang = Default.Translate("fr", "NO_SUCH_CODE", "Something")
+	if msg != "Something" || lang != "en" {
+		t.Errorf("unknown code: %q, %q", msg, lang)
+	}
+}
+
+func TestLocalesHaveSameCodes(t *testing.T) {
+	keys := func(lang string) []string {
+		var k []string
+		for code := range Default.messages[lang] {
+			k = append(k, code)
+		}
+		sort.Strings(k)
+		return k
+	}
+	want := keys("de")
+	for _, lang := range Default.Languages() {
+		got := keys(lang)
+		if len(got) != len(want) {
+			t.Errorf("%s has %d messages, de has %d", lang, len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: code %s does not match de's %s", lang, got[i], want[i])
+				break
+			}
+		}
+	}
+}
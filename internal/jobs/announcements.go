@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// AnnouncementJob sends scheduled announcements once their publish time
+// has come. Without Redis they are only listed in-app.
+type AnnouncementJob struct {
+	repo  *repository.AnnouncementRepository
+	redis *cache.RedisClient
+}
+
+func NewAnnouncementJob(repo *repository.AnnouncementRepository, redis *cache.RedisClient) *AnnouncementJob {
+	return &AnnouncementJob{repo: repo, redis: redis}
+}
+
+func (j *AnnouncementJob) RunOnce() error {
+	due, err := j.repo.ClaimDue()
+	if err != nil || j.redis == nil {
+		return err
+	}
+	for _, a := range due {
+		if err := j.redis.PublishMessage(models.WSMessage{Event: models.EventAnnouncement, Payload: a}); err != nil {
+			log.Printf("Failed to publish announcement %s: %v", a.ID, err)
+		}
+	}
+	return nil
+}
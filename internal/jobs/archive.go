@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tullo/backend/internal/repository"
+)
+
+// ArchiveJob moves messages older than the configured age from the live
+// messages table into messages_archive. History reads fall through to the
+// archive (see MessageRepository.ListByConversation).
+type ArchiveJob struct {
+	msgRepo   *repository.MessageRepository
+	months    int
+	batchSize int
+}
+
+// NewArchiveJob creates an archive job for messages older than months
+func NewArchiveJob(msgRepo *repository.MessageRepository, months, batchSize int) *ArchiveJob {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &ArchiveJob{
+		msgRepo:   msgRepo,
+		months:    months,
+		batchSize: batchSize,
+	}
+}
+
+// RunOnce archives in batches until nothing older than the cutoff remains, so
+// a large backlog doesn't hold one long transaction.
+func (j *ArchiveJob) RunOnce() error {
+	cutoff := time.Now().AddDate(0, -j.months, 0)
+
+	var total int64
+	for {
+		n, err := j.msgRepo.ArchiveBefore(cutoff, j.batchSize)
+		if err != nil {
+			return fmt.Errorf("archived %d messages before failing: %w", total, err)
+		}
+		total += n
+		if n < int64(j.batchSize) {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Archived %d messages older than %s", total, cutoff.Format("2006-01-02"))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+var (
+	attachmentsExpired = metrics.Default.NewCounterVec(
+		"tullo_attachments_expired_total",
+		"Attachments removed for being older than ATTACHMENT_RETENTION_DAYS.",
+	)
+	attachmentBytesExpired = metrics.Default.NewCounterVec(
+		"tullo_attachment_bytes_expired_total",
+		"Storage freed by expired attachments, in bytes.",
+	)
+)
+
+// AttachmentExpiryJob removes attachments older than the retention, so
+// conversations don't fill their storage quota for good. onExpired gets each
+// batch of removed attachments to delete their files from storage.
+type AttachmentExpiryJob struct {
+	repo      *repository.AttachmentRepository
+	retention time.Duration
+	batchSize int
+	onExpired func([]models.Attachment)
+}
+
+func NewAttachmentExpiryJob(repo *repository.AttachmentRepository, retention time.Duration, batchSize int, onExpired func([]models.Attachment)) *AttachmentExpiryJob {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &AttachmentExpiryJob{repo: repo, retention: retention, batchSize: batchSize, onExpired: onExpired}
+}
+
+// RunOnce expires attachments in batches until none past the retention remain
+func (j *AttachmentExpiryJob) RunOnce() error {
+	cutoff := time.Now().Add(-j.retention)
+	var total int
+	var freed int64
+	for {
+		expired, err := j.repo.ExpireBefore(cutoff, j.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, a := range expired {
+			freed += a.SizeBytes
+			attachmentBytesExpired.Add(float64(a.SizeBytes))
+		}
+		attachmentsExpired.Add(float64(len(expired)))
+		total += len(expired)
+		if len(expired) > 0 && j.onExpired != nil {
+			j.onExpired(expired)
+		}
+		if len(expired) < j.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Expired %d attachments (%d bytes)", total, freed)
+	}
+	return nil
+}
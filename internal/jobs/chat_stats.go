@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"sort"
+
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// Chat throughput over the shortest of cache.ChatStatsWindows, by channel
+// slug. They are cluster-wide figures, exported only by the job leader.
+var (
+	chatMessagesRate = metrics.Default.NewGaugeVec(
+		"tullo_chat_messages_per_second",
+		"Chat messages per second over the last minute, by channel.",
+		"channel",
+	)
+	chatAutomodRate = metrics.Default.NewGaugeVec(
+		"tullo_chat_automod_actions_per_second",
+		"Chat messages acted on by the moderation bot per second over the last minute, by channel.",
+		"channel",
+	)
+	chatChatters = metrics.Default.NewGaugeVec(
+		"tullo_chat_unique_chatters",
+		"Distinct users who sent chat messages in the last minute, by channel.",
+		"channel",
+	)
+)
+
+// CollectChatStats returns the throughput of every channel chat with recent
+// activity, busiest (by messages per second over the shortest window) first
+func CollectChatStats(redis *cache.RedisClient, chRepo *repository.ChannelRepository) ([]models.ChannelChatStats, error) {
+	convIDs, err := redis.ActiveChats()
+	if err != nil {
+		return nil, err
+	}
+	channels, err := chRepo.GetByConversationIDs(convIDs)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := redis.ChatStats(convIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]models.ChannelChatStats, 0, len(channels))
+	for convID, ch := range channels {
+		out = append(out, models.ChannelChatStats{ChannelID: ch.ID, Slug: ch.Slug, Windows: stats[convID]})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Windows[0].MessagesPerSec, out[j].Windows[0].MessagesPerSec
+		if a != b {
+			return a > b
+		}
+		return out[i].Slug < out[j].Slug
+	})
+	return out, nil
+}
+
+// ChatStatsJob exports the channels' chat throughput as metrics. Channels
+// that went quiet are dropped from the metrics.
+type ChatStatsJob struct {
+	redis    *cache.RedisClient
+	chRepo   *repository.ChannelRepository
+	exported map[string]bool
+}
+
+func NewChatStatsJob(redis *cache.RedisClient, chRepo *repository.ChannelRepository) *ChatStatsJob {
+	return &ChatStatsJob{redis: redis, chRepo: chRepo, exported: make(map[string]bool)}
+}
+
+func (j *ChatStatsJob) RunOnce() error {
+	stats, err := CollectChatStats(j.redis, j.chRepo)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(stats))
+	for _, s := range stats {
+		w := s.Windows[0]
+		chatMessagesRate.Set(w.MessagesPerSec, s.Slug)
+		chatAutomodRate.Set(w.AutomodActionsPerSec, s.Slug)
+		chatChatters.Set(float64(w.UniqueChatters), s.Slug)
+		seen[s.Slug] = true
+	}
+	for slug := range j.exported {
+		if !seen[slug] {
+			chatMessagesRate.Delete(slug)
+			chatAutomodRate.Delete(slug)
+			chatChatters.Delete(slug)
+		}
+	}
+	j.exported = seen
+	return nil
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// exportReadme is included in every data export archive
+const exportReadme = `This archive contains the data Tullo stores about your account.
+
+Each .json file holds one JSON array:
+
+  profile.json            your account details
+  email_preferences.json  which notification emails you receive
+  messages.json           every message you sent, including archived and deleted ones
+  memberships.json        conversations you are a member of
+  channels.json           channels you own
+  follows.json            channels you follow
+  moderation.json         mutes and bans applied to you
+  moderation_log.json     moderation actions taken on you or by you
+`
+
+// DataExportJob assembles queued per-user data exports into zip archives
+type DataExportJob struct {
+	exportRepo *repository.ExportRepository
+	// ttl is how long a finished archive stays downloadable
+	ttl time.Duration
+}
+
+func NewDataExportJob(exportRepo *repository.ExportRepository, ttl time.Duration) *DataExportJob {
+	return &DataExportJob{exportRepo: exportRepo, ttl: ttl}
+}
+
+// RunOnce deletes expired archives, then builds every queued export. A
+// failure to build one export is recorded on it and does not fail the run.
+func (j *DataExportJob) RunOnce() error {
+	if n, err := j.exportRepo.DeleteExpired(time.Now(), j.ttl); err != nil {
+		return err
+	} else if n > 0 {
+		log.Printf("Deleted %d expired data exports", n)
+	}
+
+	for {
+		export, err := j.exportRepo.ClaimNext()
+		if err != nil {
+			return err
+		}
+		if export == nil {
+			return nil
+		}
+
+		archive, err := j.build(export.UserID)
+		if err != nil {
+			log.Printf("Data export %s failed: %v", export.ID, err)
+			if err := j.exportRepo.Fail(export.ID, "failed to assemble export"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := j.exportRepo.Complete(export.ID, archive, time.Now().Add(j.ttl)); err != nil {
+			return err
+		}
+		log.Printf("Data export %s ready (%d bytes)", export.ID, len(archive))
+	}
+}
+
+func (j *DataExportJob) build(userID uuid.UUID) ([]byte, error) {
+	data, err := j.exportRepo.CollectUserData(userID)
+	if err != nil {
+		return nil, err
+	}
+	return buildExportArchive(data, time.Now())
+}
+
+// buildExportArchive writes one indented <section>.json per section plus a
+// README.txt into a zip archive
+func buildExportArchive(sections map[string]json.RawMessage, created time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	add := func(name string, content []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: created})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	}
+
+	if err := add("README.txt", []byte(exportReadme)); err != nil {
+		return nil, fmt.Errorf("failed to write export archive: %w", err)
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, sections[name], "", "  "); err != nil {
+			return nil, fmt.Errorf("export section %s is not valid JSON: %w", name, err)
+		}
+		pretty.WriteByte('\n')
+		if err := add(name+".json", pretty.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to write export archive: %w", err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write export archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
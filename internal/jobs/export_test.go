@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBuildExportArchive(t *testing.T) {
+	sections := map[string]json.RawMessage{
+		"profile":  json.RawMessage(`[{"id":"u1","email":"a@example.com"}]`),
+		"messages": json.RawMessage(`[]`),
+	}
+	archive, err := buildExportArchive(sections, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	if len(files) != 3 || files["README.txt"] == "" {
+		t.Fatalf("archive files = %v", files)
+	}
+	var profile []map[string]string
+	if err := json.Unmarshal([]byte(files["profile.json"]), &profile); err != nil || profile[0]["email"] != "a@example.com" {
+		t.Errorf("profile.json = %q (%v)", files["profile.json"], err)
+	}
+	if files["messages.json"] != "[]\n" {
+		t.Errorf("messages.json = %q", files["messages.json"])
+	}
+}
+
+func TestBuildExportArchiveRejectsInvalidJSON(t *testing.T) {
+	if _, err := buildExportArchive(map[string]json.RawMessage{"profile": json.RawMessage(`{`)}, time.Now()); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// FollowAlertsJob sends the owners of big channels one channel.followed
+// event per run with the number of follows since the last one, instead of an
+// event per follower. Follows are counted in Redis by every instance.
+type FollowAlertsJob struct {
+	redis  *cache.RedisClient
+	chRepo *repository.ChannelRepository
+}
+
+func NewFollowAlertsJob(redis *cache.RedisClient, chRepo *repository.ChannelRepository) *FollowAlertsJob {
+	return &FollowAlertsJob{redis: redis, chRepo: chRepo}
+}
+
+func (j *FollowAlertsJob) RunOnce() error {
+	deltas, err := j.redis.TakeFollowDeltas()
+	if err != nil || len(deltas) == 0 {
+		return err
+	}
+	ids := make([]uuid.UUID, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	channels, err := j.chRepo.GetByIDs(ids)
+	if err != nil {
+		return err
+	}
+	followers, err := j.chRepo.CountFollowersByChannelIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range channels {
+		payload := models.WSChannelFollowedPayload{
+			ChannelID: ch.ID,
+			OwnerID:   ch.OwnerID,
+			Count:     deltas[ch.ID],
+			Followers: followers[ch.ID],
+		}
+		if err := j.redis.PublishMessage(models.WSMessage{Event: models.EventChannelFollowed, Payload: payload}); err != nil {
+			log.Printf("Failed to publish follows of channel %s: %v", ch.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/repository"
+)
+
+var botFollowsRemoved = metrics.Default.NewCounterVec(
+	"tullo_bot_follows_removed_total",
+	"Follows removed by the follow-bot sweep.",
+)
+
+// FollowBotSweepJob removes follow-botting that got past the follow guard,
+// e.g. spread across instances or slower than its window: when at least
+// threshold new accounts from one network followed a channel within
+// lookback, those follows are deleted and an admin report is filed, so they
+// never count towards trending and recommendations.
+type FollowBotSweepJob struct {
+	repo      *repository.FollowBotRepository
+	lookback  time.Duration
+	threshold int
+	// onRemoved is called with the slug of each channel that lost follows
+	onRemoved func(slug string)
+}
+
+func NewFollowBotSweepJob(repo *repository.FollowBotRepository, lookback time.Duration, threshold int, onRemoved func(slug string)) *FollowBotSweepJob {
+	return &FollowBotSweepJob{repo: repo, lookback: lookback, threshold: threshold, onRemoved: onRemoved}
+}
+
+func (j *FollowBotSweepJob) RunOnce() error {
+	reports, err := j.repo.RemoveBursts(time.Now().Add(-j.lookback), j.threshold)
+	if err != nil {
+		return err
+	}
+	for _, rp := range reports {
+		botFollowsRemoved.Add(float64(rp.Removed))
+		log.Printf("Removed %d bot follows of channel %s from %s", rp.Removed, rp.ChannelSlug, rp.Network)
+		if j.onRemoved != nil {
+			j.onRemoved(rp.ChannelSlug)
+		}
+	}
+	return nil
+}
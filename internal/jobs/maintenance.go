@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// ModerationCleanupJob deletes expired conversation mutes and bans and tells
+// the conversation so clients re-enable input for the affected user. Expired
+// rows are already ignored at read time; this keeps the table from growing
+// forever.
+type ModerationCleanupJob struct {
+	convRepo *repository.ConversationRepository
+	redis    *cache.RedisClient
+}
+
+// NewModerationCleanupJob creates the job; without Redis no events are sent
+func NewModerationCleanupJob(convRepo *repository.ConversationRepository, redis *cache.RedisClient) *ModerationCleanupJob {
+	return &ModerationCleanupJob{convRepo: convRepo, redis: redis}
+}
+
+func (j *ModerationCleanupJob) RunOnce() error {
+	expired, err := j.convRepo.DeleteExpiredModerations(time.Now())
+	if err != nil {
+		return err
+	}
+	if len(expired) > 0 {
+		log.Printf("Deleted %d expired conversation moderations", len(expired))
+	}
+	if j.redis == nil {
+		return nil
+	}
+	for _, m := range expired {
+		event := models.EventUserUnmuted
+		if m.Action == "ban" {
+			event = models.EventUserUnbanned
+		}
+		if err := j.redis.PublishMessage(models.WSMessage{Event: event, Payload: m}); err != nil {
+			log.Printf("Failed to publish %s for user %s: %v", event, m.UserID, err)
+		}
+	}
+	return nil
+}
+
+// StaleStreamJob ends streams left live without a status update for longer
+// than maxIdle, e.g. when the broadcaster's client crashed without ending them
+type StaleStreamJob struct {
+	streamRepo *repository.StreamRepository
+	maxIdle    time.Duration
+	// onEnded is called with the slug of each channel whose stream was ended
+	onEnded func(slug string)
+}
+
+func NewStaleStreamJob(streamRepo *repository.StreamRepository, maxIdle time.Duration, onEnded func(slug string)) *StaleStreamJob {
+	return &StaleStreamJob{streamRepo: streamRepo, maxIdle: maxIdle, onEnded: onEnded}
+}
+
+func (j *StaleStreamJob) RunOnce() error {
+	slugs, err := j.streamRepo.EndStaleStreams(time.Now().Add(-j.maxIdle))
+	if err != nil {
+		return err
+	}
+	for _, slug := range slugs {
+		log.Printf("Ended stale stream on channel %s", slug)
+		if j.onEnded != nil {
+			j.onEnded(slug)
+		}
+	}
+	return nil
+}
+
+// TypingSweepJob clears typing indicators whose stop event never arrived
+type TypingSweepJob struct {
+	redis *cache.RedisClient
+	ttl   time.Duration
+}
+
+func NewTypingSweepJob(redis *cache.RedisClient, ttl time.Duration) *TypingSweepJob {
+	return &TypingSweepJob{redis: redis, ttl: ttl}
+}
+
+func (j *TypingSweepJob) RunOnce() error {
+	_, err := j.redis.SweepTyping(time.Now().Add(-j.ttl))
+	return err
+}
+
+// AnalyticsRollupJob recomputes the analytics_daily rollups for yesterday
+// and today, so late writes to yesterday are still counted
+type AnalyticsRollupJob struct {
+	analyticsRepo *repository.AnalyticsRepository
+}
+
+func NewAnalyticsRollupJob(analyticsRepo *repository.AnalyticsRepository) *AnalyticsRollupJob {
+	return &AnalyticsRollupJob{analyticsRepo: analyticsRepo}
+}
+
+func (j *AnalyticsRollupJob) RunOnce() error {
+	now := time.Now().UTC()
+	if err := j.analyticsRepo.RollupDay(now.AddDate(0, 0, -1)); err != nil {
+		return err
+	}
+	return j.analyticsRepo.RollupDay(now)
+}
+
+// AuthEventCleanupJob deletes security log entries older than retention
+type AuthEventCleanupJob struct {
+	authEvents *repository.AuthEventRepository
+	retention  time.Duration
+}
+
+func NewAuthEventCleanupJob(authEvents *repository.AuthEventRepository, retention time.Duration) *AuthEventCleanupJob {
+	return &AuthEventCleanupJob{authEvents: authEvents, retention: retention}
+}
+
+func (j *AuthEventCleanupJob) RunOnce() error {
+	n, err := j.authEvents.DeleteBefore(time.Now().Add(-j.retention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Deleted %d old auth events", n)
+	}
+	return nil
+}
+
+// AnalyticsEventCleanupJob deletes raw client analytics events older than
+// retention
+type AnalyticsEventCleanupJob struct {
+	events    *repository.AnalyticsEventRepository
+	retention time.Duration
+}
+
+func NewAnalyticsEventCleanupJob(events *repository.AnalyticsEventRepository, retention time.Duration) *AnalyticsEventCleanupJob {
+	return &AnalyticsEventCleanupJob{events: events, retention: retention}
+}
+
+func (j *AnalyticsEventCleanupJob) RunOnce() error {
+	n, err := j.events.DeleteBefore(time.Now().Add(-j.retention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Deleted %d old analytics events", n)
+	}
+	return nil
+}
+
+// RefreshTokenCleanupJob deletes refresh token families that are revoked or
+// whose newest token has expired
+type RefreshTokenCleanupJob struct {
+	refreshRepo *repository.RefreshTokenRepository
+}
+
+func NewRefreshTokenCleanupJob(refreshRepo *repository.RefreshTokenRepository) *RefreshTokenCleanupJob {
+	return &RefreshTokenCleanupJob{refreshRepo: refreshRepo}
+}
+
+func (j *RefreshTokenCleanupJob) RunOnce() error {
+	n, err := j.refreshRepo.DeleteExpired()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Deleted %d expired refresh token families", n)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/mail"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/notify"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// mentionsPerDigest caps how many mentions one digest email lists
+const mentionsPerDigest = 20
+
+// MentionDigestJob emails users a digest of unread messages that mention
+// them. notify.Decide picks the mentions: those from muted conversations are
+// skipped for good, while users who are online or in do not disturb keep
+// theirs pending until a run finds them offline (or they read them).
+type MentionDigestJob struct {
+	emailRepo *repository.EmailRepository
+	mailer    *mail.Mailer
+	isOnline  func(uuid.UUID) bool
+	lookback  time.Duration
+}
+
+// NewMentionDigestJob creates a digest job. isOnline may be nil, in which case
+// every user is treated as offline. Mentions older than lookback are never sent.
+func NewMentionDigestJob(emailRepo *repository.EmailRepository, mailer *mail.Mailer, isOnline func(uuid.UUID) bool, lookback time.Duration) *MentionDigestJob {
+	return &MentionDigestJob{
+		emailRepo: emailRepo,
+		mailer:    mailer,
+		isOnline:  isOnline,
+		lookback:  lookback,
+	}
+}
+
+// RunOnce sends one digest per user with mentions to deliver
+func (j *MentionDigestJob) RunOnce() error {
+	digests, err := j.emailRepo.PendingMentions(time.Now().Add(-j.lookback), mentionsPerDigest)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, d := range digests {
+		online := j.isOnline != nil && j.isOnline(d.Recipient.UserID)
+		// upTo is how far the digest watermark may move: past mentions that
+		// are sent or dropped, but not past one that is deferred
+		var deliver []models.Mention
+		var upTo time.Time
+	mentions:
+		for _, m := range d.Mentions {
+			decision := notify.Decide(notify.KindMention, notify.Email, notify.Recipient{
+				Wants:             true, // PendingMentions only returns users who want digests
+				ConversationMuted: m.ConversationMuted,
+				DoNotDisturb:      d.Recipient.DoNotDisturb,
+				Online:            online,
+			})
+			switch decision.Outcome {
+			case notify.Defer:
+				break mentions
+			case notify.Deliver:
+				deliver = append(deliver, m)
+			}
+			upTo = m.CreatedAt
+		}
+		if upTo.IsZero() {
+			continue
+		}
+		if len(deliver) > 0 {
+			if err := j.mailer.SendMentionDigest(d.Recipient, deliver); err != nil {
+				log.Printf("Mention digest for %s failed: %v", d.Recipient.UserID, err)
+				continue
+			}
+		}
+		// Mentions beyond the cap are picked up by the next run
+		if err := j.emailRepo.MarkDigestSent(d.Recipient.UserID, upTo); err != nil {
+			log.Printf("Mention digest for %s failed: %v", d.Recipient.UserID, err)
+			continue
+		}
+		if len(deliver) > 0 {
+			sent++
+		}
+	}
+	if sent > 0 {
+		log.Printf("Sent %d mention digests", sent)
+	}
+	return nil
+}
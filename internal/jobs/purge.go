@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tullo/backend/internal/repository"
+)
+
+// PurgeJob permanently removes soft-deleted rows once they are older than the
+// configured retention window.
+type PurgeJob struct {
+	userRepo    *repository.UserRepository
+	channelRepo *repository.ChannelRepository
+	convRepo    *repository.ConversationRepository
+	msgRepo     *repository.MessageRepository
+	retention   time.Duration
+}
+
+// NewPurgeJob creates a purge job with the given retention window
+func NewPurgeJob(userRepo *repository.UserRepository, chRepo *repository.ChannelRepository, convRepo *repository.ConversationRepository, msgRepo *repository.MessageRepository, retention time.Duration) *PurgeJob {
+	return &PurgeJob{
+		userRepo:    userRepo,
+		channelRepo: chRepo,
+		convRepo:    convRepo,
+		msgRepo:     msgRepo,
+		retention:   retention,
+	}
+}
+
+// RunOnce purges everything soft-deleted before now minus the retention window.
+// Messages go first so that cascades from parents don't hide the per-table counts.
+func (j *PurgeJob) RunOnce() error {
+	cutoff := time.Now().Add(-j.retention)
+
+	purgers := []struct {
+		name  string
+		purge func(time.Time) (int64, error)
+	}{
+		{"messages", j.msgRepo.PurgeDeleted},
+		{"conversations", j.convRepo.PurgeDeleted},
+		{"channels", j.channelRepo.PurgeDeleted},
+		{"users", j.userRepo.PurgeDeleted},
+	}
+
+	var errs []error
+	for _, p := range purgers {
+		n, err := p.purge(cutoff)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("purge of %s: %w", p.name, err))
+			continue
+		}
+		if n > 0 {
+			log.Printf("Purged %d soft-deleted %s", n, p.name)
+		}
+	}
+	return errors.Join(errs...)
+}
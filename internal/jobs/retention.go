@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+var retentionMessages = metrics.Default.NewCounterVec(
+	"tullo_retention_messages_total",
+	"Messages removed for being older than their conversation's retention, by action (delete or archive).",
+	"action",
+)
+
+// RetentionJob enforces the message retention of conversations and channel
+// chats: messages older than retention_days are deleted, or moved to
+// messages_archive when the retention action is archive
+type RetentionJob struct {
+	msgRepo   *repository.MessageRepository
+	batchSize int
+}
+
+func NewRetentionJob(msgRepo *repository.MessageRepository, batchSize int) *RetentionJob {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &RetentionJob{msgRepo: msgRepo, batchSize: batchSize}
+}
+
+// RunOnce works in batches until no expired messages remain, like ArchiveJob
+func (j *RetentionJob) RunOnce() error {
+	now := time.Now()
+	steps := []struct {
+		action string
+		remove func(time.Time, int) (int64, error)
+	}{
+		{models.RetentionDelete, j.msgRepo.DeleteExpired},
+		{models.RetentionArchive, j.msgRepo.ArchiveExpired},
+	}
+	for _, s := range steps {
+		var total int64
+		for {
+			n, err := s.remove(now, j.batchSize)
+			total += n
+			retentionMessages.Add(float64(n), s.action)
+			if err != nil {
+				return fmt.Errorf("retention %s of %d messages failed: %w", s.action, total, err)
+			}
+			if n < int64(j.batchSize) {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("Removed %d messages past their retention (%s)", total, s.action)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	from := time.Date(2024, 1, 31, 10, 17, 30, 0, time.UTC) // a Wednesday
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2024, 1, 31, 11, 5, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"0 0 * * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 1,15 * *", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 0", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either matching is enough
+		{"0 0 15 * 5", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		s, err := ParseCron(tc.spec)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tc.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: Next = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestParseCronNeverMatches(t *testing.T) {
+	s, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next = %v, want zero time", got)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestEvery(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := Every(90 * time.Second).Next(from); !got.Equal(from.Add(90 * time.Second)) {
+		t.Errorf("Next = %v", got)
+	}
+}
+
+func TestRunOnceRecordsStatus(t *testing.T) {
+	s := NewScheduler(nil, 30*time.Second)
+	if !s.Leader() {
+		t.Fatal("scheduler without Redis should be the leader")
+	}
+	fail := true
+	s.Add("flaky", Every(time.Hour), func() error {
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	s.Add("panics", Every(time.Hour), func() error { panic("oops") })
+
+	for _, j := range s.jobs {
+		s.runOnce(j)
+	}
+	fail = false
+	s.runOnce(s.jobs[0])
+
+	st := s.Statuses()
+	if st[0].Name != "flaky" || st[0].Runs != 2 || st[0].Failures != 1 || st[0].LastError != "" || st[0].LastSuccess == nil {
+		t.Errorf("flaky status = %+v", st[0])
+	}
+	if st[1].Name != "panics" || st[1].Failures != 1 || st[1].LastError != "panic: oops" {
+		t.Errorf("panics status = %+v", st[1])
+	}
+}
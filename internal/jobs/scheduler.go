@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+)
+
+// leaderKey is the Redis lock held by the instance that runs jobs
+const leaderKey = "jobs:leader"
+
+var (
+	jobRuns = metrics.Default.NewCounterVec(
+		"tullo_job_runs_total",
+		"Scheduled job runs, by job and result (success, failure).",
+		"job", "result",
+	)
+	jobDuration = metrics.Default.NewHistogramVec(
+		"tullo_job_duration_seconds",
+		"Duration of scheduled job runs, by job.",
+		[]float64{0.01, 0.1, 0.5, 1, 5, 15, 60, 300, 900},
+		"job",
+	)
+	jobLastSuccess = metrics.Default.NewGaugeVec(
+		"tullo_job_last_success_timestamp_seconds",
+		"Unix time of the last successful run, by job.",
+		"job",
+	)
+	jobsLeader = metrics.Default.NewGaugeVec(
+		"tullo_jobs_leader",
+		"1 if this instance holds the job leader lock.",
+	)
+)
+
+// Func is the body of a job; a returned error marks the run as failed
+type Func func() error
+
+// Status is the state of one job as seen by this instance
+type Status struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	Runs           int64      `json:"runs"`
+	Failures       int64      `json:"failures"`
+	LastStart      *time.Time `json:"last_start,omitempty"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastSuccess    *time.Time `json:"last_success,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRun        time.Time  `json:"next_run"`
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	run      Func
+	status   Status
+}
+
+// Scheduler runs recurring jobs. With several server instances only the one
+// holding the Redis leader lock runs them; without Redis every instance
+// considers itself the leader.
+type Scheduler struct {
+	redis    *cache.RedisClient
+	instance string
+	lockTTL  time.Duration
+	leader   atomic.Bool
+
+	mu   sync.Mutex
+	jobs []*job
+}
+
+// NewScheduler creates a scheduler whose leader lock expires after lockTTL
+// unless renewed, bounding how long jobs pause when the leader dies
+func NewScheduler(redis *cache.RedisClient, lockTTL time.Duration) *Scheduler {
+	host, _ := os.Hostname()
+	s := &Scheduler{
+		redis:    redis,
+		instance: fmt.Sprintf("%s-%s", host, uuid.NewString()[:8]),
+		lockTTL:  lockTTL,
+	}
+	if redis == nil {
+		s.leader.Store(true)
+	}
+	return s
+}
+
+// Add registers a job. Jobs must be added before Start.
+func (s *Scheduler) Add(name string, schedule Schedule, run Func) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{
+		name:     name,
+		schedule: schedule,
+		run:      run,
+		status:   Status{Name: name, Schedule: schedule.String()},
+	})
+}
+
+// Start begins leader election and runs each job on its schedule until the
+// process exits
+func (s *Scheduler) Start() {
+	if s.redis != nil {
+		go s.elect()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		go s.loop(j)
+	}
+}
+
+// Instance identifies this process in the leader lock
+func (s *Scheduler) Instance() string {
+	return s.instance
+}
+
+// Leader reports whether this instance currently runs jobs
+func (s *Scheduler) Leader() bool {
+	return s.leader.Load()
+}
+
+// Statuses returns every job's status, sorted by name
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j.status)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
+
+// elect keeps trying to take the leader lock and renews it while held. A
+// Redis error drops leadership so two instances never run jobs at once.
+func (s *Scheduler) elect() {
+	ticker := time.NewTicker(s.lockTTL / 3)
+	defer ticker.Stop()
+	for {
+		var held bool
+		var err error
+		if s.leader.Load() {
+			held, err = s.redis.RenewLock(leaderKey, s.instance, s.lockTTL)
+		} else {
+			held, err = s.redis.AcquireLock(leaderKey, s.instance, s.lockTTL)
+		}
+		if err != nil {
+			log.Printf("Job leader election failed: %v", err)
+			held = false
+		}
+		if held != s.leader.Load() {
+			if held {
+				log.Printf("Instance %s is now the job leader", s.instance)
+			} else {
+				log.Printf("Instance %s lost the job leader lock", s.instance)
+			}
+		}
+		s.leader.Store(held)
+		if held {
+			jobsLeader.Set(1)
+		} else {
+			jobsLeader.Set(0)
+		}
+		<-ticker.C
+	}
+}
+
+func (s *Scheduler) loop(j *job) {
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("Job %s has no future run time; stopping it", j.name)
+			return
+		}
+		s.mu.Lock()
+		j.status.NextRun = next
+		s.mu.Unlock()
+
+		time.Sleep(time.Until(next))
+		if s.Leader() {
+			s.runOnce(j)
+		}
+	}
+}
+
+// runOnce runs j and records the outcome; runs of the same job never overlap
+// because each job has a single loop
+func (s *Scheduler) runOnce(j *job) {
+	start := time.Now()
+	s.mu.Lock()
+	j.status.Running = true
+	j.status.LastStart = &start
+	s.mu.Unlock()
+
+	err := safeRun(j.run)
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastDurationMs = elapsed.Milliseconds()
+	jobDuration.Observe(elapsed.Seconds(), j.name)
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+		jobRuns.Inc(j.name, "failure")
+		log.Printf("Job %s failed: %v", j.name, err)
+		return
+	}
+	j.status.LastError = ""
+	j.status.LastSuccess = &start
+	jobRuns.Inc(j.name, "success")
+	jobLastSuccess.Set(float64(start.Unix()), j.name)
+}
+
+func safeRun(run Func) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
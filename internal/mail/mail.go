@@ -0,0 +1,59 @@
+// Package mail sends transactional and notification email. Delivery goes
+// through a pluggable Sender (SMTP in production, the log sender in
+// development) and bodies are rendered from the embedded templates.
+package mail
+
+import (
+	"fmt"
+	"log"
+)
+
+// Message is a rendered email ready to send
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are extra headers such as List-Unsubscribe
+	Headers map[string]string
+}
+
+// Sender delivers a message through a mail provider
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Provider names accepted by NewSender
+const (
+	ProviderLog  = "log"
+	ProviderSMTP = "smtp"
+)
+
+// Config selects and configures the provider
+type Config struct {
+	Provider string
+	From     string
+	SMTP     SMTPConfig
+}
+
+// NewSender returns the Sender for cfg.Provider
+func NewSender(cfg Config) (Sender, error) {
+	switch cfg.Provider {
+	case "", ProviderLog:
+		return LogSender{}, nil
+	case ProviderSMTP:
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("SMTP host is required for the smtp mail provider")
+		}
+		return NewSMTPSender(cfg.SMTP, cfg.From), nil
+	}
+	return nil, fmt.Errorf("unknown mail provider %q", cfg.Provider)
+}
+
+// LogSender writes messages to the log instead of sending them (development)
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,154 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+)
+
+type captureSender struct{ sent []Message }
+
+func (s *captureSender) Send(msg Message) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func newTestMailer(t *testing.T) (*Mailer, *captureSender) {
+	t.Helper()
+	sender := &captureSender{}
+	m, err := NewMailer(sender, Links{AppURL: "https://app.test", APIURL: "https://api.test"}, 10)
+	if err != nil {
+		t.Fatalf("NewMailer: %v", err)
+	}
+	return m, sender
+}
+
+func next(t *testing.T, m *Mailer) Message {
+	t.Helper()
+	select {
+	case q := <-m.queue:
+		return q.msg
+	default:
+		t.Fatal("nothing queued")
+		return Message{}
+	}
+}
+
+func TestVerificationEmail(t *testing.T) {
+	m, _ := newTestMailer(t)
+	user := &models.User{Email: "a@example.com", DisplayName: "Ann"}
+	if err := m.SendVerification(user, "tok+en", 48*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := next(t, m)
+	if msg.To != "a@example.com" || msg.Subject != "Confirm your Tullo email address" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	link := "https://app.test/verify-email?token=tok%2Ben"
+	if !strings.Contains(msg.Text, link) || !strings.Contains(msg.Text, "48 hours") {
+		t.Fatalf("text body missing link or expiry:\n%s", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, link) {
+		t.Fatalf("html body missing link:\n%s", msg.HTML)
+	}
+	if strings.Contains(msg.HTML, "Unsubscribe") || msg.Headers != nil {
+		t.Fatal("transactional email should not carry unsubscribe links")
+	}
+}
+
+func TestNotificationEmailsCarryUnsubscribe(t *testing.T) {
+	m, _ := newTestMailer(t)
+	token := uuid.New()
+	r := models.EmailRecipient{Email: "b@example.com", DisplayName: "Bo", UnsubscribeToken: token}
+	if err := m.SendChannelLive(r, &models.Channel{Slug: "jazz", Title: "<Jazz & Co>"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := next(t, m)
+	want := "https://api.test/email/unsubscribe?list=live&token=" + token.String()
+	if msg.Headers["List-Unsubscribe"] != "<"+want+">" || msg.Headers["List-Unsubscribe-Post"] == "" {
+		t.Fatalf("missing one-click unsubscribe headers: %v", msg.Headers)
+	}
+	if !strings.Contains(msg.Text, want) || msg.Subject != "<Jazz & Co> is live on Tullo" {
+		t.Fatalf("unexpected text or subject: %q\n%s", msg.Subject, msg.Text)
+	}
+	if !strings.Contains(msg.HTML, "&lt;Jazz &amp; Co&gt;") {
+		t.Fatalf("html body should escape the channel title:\n%s", msg.HTML)
+	}
+}
+
+func TestMentionDigest(t *testing.T) {
+	m, _ := newTestMailer(t)
+	mentions := []models.Mention{
+		{SenderName: "Cy", ConversationName: "general", Body: "hey @Bo", CreatedAt: time.Now()},
+		{SenderName: "Di", Body: "@bo look", CreatedAt: time.Now()},
+	}
+	if err := m.SendMentionDigest(models.EmailRecipient{Email: "b@example.com", DisplayName: "Bo"}, mentions); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := next(t, m)
+	if msg.Subject != "2 new mentions on Tullo" {
+		t.Fatalf("unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "Cy in general") || !strings.Contains(msg.Text, "@bo look") {
+		t.Fatalf("digest text missing mentions:\n%s", msg.Text)
+	}
+}
+
+func TestTransactionalEmailDroppedWhenQueueFull(t *testing.T) {
+	sender := &captureSender{}
+	m, err := NewMailer(sender, Links{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Email: "a@example.com", DisplayName: "Ann"}
+	if err := m.SendPasswordReset(user, "t", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SendPasswordReset(user, "t", time.Hour); err == nil {
+		t.Fatal("expected an error when the queue is full")
+	}
+}
+
+func TestBuildMIME(t *testing.T) {
+	body, err := buildMIME("Tullo <no-reply@tullo.test>", Message{
+		To:      "a@example.com",
+		Subject: "Héllo\r\nBcc: evil@example.com",
+		Text:    "plain",
+		HTML:    "<p>html</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://x>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(body)
+	head, _, _ := strings.Cut(s, "\r\n\r\n")
+	if strings.Contains(head, "\r\nBcc:") {
+		t.Fatal("subject must not inject headers")
+	}
+	for _, want := range []string{"From: Tullo <no-reply@tullo.test>", "List-Unsubscribe: <https://x>", "@tullo.test>", "multipart/alternative"} {
+		if !strings.Contains(head, want) {
+			t.Fatalf("headers missing %q:\n%s", want, head)
+		}
+	}
+	if !strings.Contains(s, "text/plain") || !strings.Contains(s, "<p>html</p>") {
+		t.Fatal("body should contain both parts")
+	}
+}
+
+func TestNewSender(t *testing.T) {
+	if _, err := NewSender(Config{Provider: ProviderSMTP}); err == nil {
+		t.Fatal("smtp provider without a host should fail")
+	}
+	if _, err := NewSender(Config{Provider: "carrier-pigeon"}); err == nil {
+		t.Fatal("unknown provider should fail")
+	}
+	if s, err := NewSender(Config{}); err != nil || s == nil {
+		t.Fatalf("default provider should be the log sender: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/models"
+)
+
+var mailSent = metrics.Default.NewCounterVec(
+	"tullo_mail_sent_total",
+	"Emails handed to the mail provider, by template and result (sent, failed, dropped).",
+	"template", "result",
+)
+
+// Links are the base URLs used to build links in emails: AppURL for pages
+// of the web app, APIURL for the backend's unsubscribe endpoint
+type Links struct {
+	AppURL string
+	APIURL string
+}
+
+// Mailer renders templated emails and delivers them from a background queue
+// so request handlers never wait on the mail provider
+type Mailer struct {
+	sender Sender
+	tmpl   *templateSet
+	links  Links
+	queue  chan queued
+}
+
+type queued struct {
+	template string
+	msg      Message
+}
+
+// templateData is passed to every template; fields unused by a template stay empty
+type templateData struct {
+	DisplayName    string
+	ActionURL      string
+	ExpiresIn      string
+	UnsubscribeURL string
+	PreferencesURL string
+	ChannelTitle   string
+	Mentions       []models.Mention
+}
+
+func NewMailer(sender Sender, links Links, queueSize int) (*Mailer, error) {
+	tmpl, err := loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	return &Mailer{
+		sender: sender,
+		tmpl:   tmpl,
+		links:  links,
+		queue:  make(chan queued, queueSize),
+	}, nil
+}
+
+// Run delivers queued messages until the process exits
+func (m *Mailer) Run() {
+	for q := range m.queue {
+		if err := m.sender.Send(q.msg); err != nil {
+			mailSent.Inc(q.template, "failed")
+			log.Printf("Failed to send %s email to %s: %v", q.template, q.msg.To, err)
+			continue
+		}
+		mailSent.Inc(q.template, "sent")
+	}
+}
+
+// SendVerification emails a link that confirms the user's address
+func (m *Mailer) SendVerification(user *models.User, token string, ttl time.Duration) error {
+	return m.enqueue(TemplateVerifyEmail, user.Email, templateData{
+		DisplayName: user.DisplayName,
+		ActionURL:   m.links.AppURL + "/verify-email?token=" + url.QueryEscape(token),
+		ExpiresIn:   humanDuration(ttl),
+	}, nil)
+}
+
+// SendPasswordReset emails a link for choosing a new password
+func (m *Mailer) SendPasswordReset(user *models.User, token string, ttl time.Duration) error {
+	return m.enqueue(TemplatePasswordReset, user.Email, templateData{
+		DisplayName: user.DisplayName,
+		ActionURL:   m.links.AppURL + "/reset-password?token=" + url.QueryEscape(token),
+		ExpiresIn:   humanDuration(ttl),
+	}, nil)
+}
+
+// SendMentionDigest emails the mentions a user missed while offline. It blocks
+// while the queue is full.
+func (m *Mailer) SendMentionDigest(r models.EmailRecipient, mentions []models.Mention) error {
+	data := templateData{
+		DisplayName: r.DisplayName,
+		ActionURL:   m.links.AppURL + "/",
+		Mentions:    mentions,
+	}
+	return m.enqueue(TemplateMentionDigest, r.Email, data, &r)
+}
+
+// SendChannelLive tells a follower that a channel went live. It blocks while
+// the queue is full.
+func (m *Mailer) SendChannelLive(r models.EmailRecipient, ch *models.Channel) error {
+	data := templateData{
+		DisplayName:  r.DisplayName,
+		ActionURL:    m.links.AppURL + "/channels/" + url.PathEscape(ch.Slug),
+		ChannelTitle: ch.Title,
+	}
+	return m.enqueue(TemplateChannelLive, r.Email, data, &r)
+}
+
+// enqueue renders the template and queues it. Notification emails (those with
+// a recipient) carry an unsubscribe link and one-click List-Unsubscribe
+// headers; they are sent in bulk from background goroutines, so they wait for
+// room in the queue. Transactional emails are queued from request handlers and
+// are dropped rather than block when the queue is full.
+func (m *Mailer) enqueue(template, to string, data templateData, r *models.EmailRecipient) error {
+	var headers map[string]string
+	if r != nil {
+		unsubscribe := m.unsubscribeURL(r.UnsubscribeToken.String(), listFor(template))
+		data.UnsubscribeURL = unsubscribe
+		data.PreferencesURL = m.links.AppURL + "/settings/notifications"
+		headers = map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribe + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+
+	subject, text, html, err := m.tmpl.render(template, data)
+	if err != nil {
+		return err
+	}
+
+	q := queued{template: template, msg: Message{To: to, Subject: subject, Text: text, HTML: html, Headers: headers}}
+	if r != nil {
+		m.queue <- q
+		return nil
+	}
+
+	select {
+	case m.queue <- q:
+		return nil
+	default:
+		mailSent.Inc(template, "dropped")
+		return fmt.Errorf("mail queue full, dropped %s email", template)
+	}
+}
+
+// unsubscribeURL is the backend endpoint that removes a user from an email list
+func (m *Mailer) unsubscribeURL(token, list string) string {
+	return m.links.APIURL + "/email/unsubscribe?" + url.Values{"token": {token}, "list": {list}}.Encode()
+}
+
+func listFor(template string) string {
+	switch template {
+	case TemplateMentionDigest:
+		return models.EmailListMentions
+	case TemplateChannelLive:
+		return models.EmailListLive
+	}
+	return models.EmailListAll
+}
+
+// humanDuration renders 24h as "24 hours" and 30m as "30 minutes"
+func humanDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if h := int(d / time.Hour); h != 1 {
+			return fmt.Sprintf("%d hours", h)
+		}
+		return "1 hour"
+	}
+	if m := int(d / time.Minute); m != 1 {
+		return fmt.Sprintf("%d minutes", m)
+	}
+	return "1 minute"
+}
@@ -0,0 +1,121 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPConfig holds the SMTP relay settings. STARTTLS is used whenever the
+// server offers it; credentials are only sent over an encrypted connection.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// SMTPSender delivers mail through an SMTP relay
+type SMTPSender struct {
+	cfg  SMTPConfig
+	from string
+}
+
+func NewSMTPSender(cfg SMTPConfig, from string) *SMTPSender {
+	return &SMTPSender{cfg: cfg, from: from}
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	body, err := buildMIME(s.from, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
+	if err := smtp.SendMail(addr, auth, envelopeAddress(s.from), []string{msg.To}, body); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// buildMIME renders msg as a multipart/alternative message with text and HTML parts
+func buildMIME(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%s@%s>", uuid.New(), domainOf(envelopeAddress(from))),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var head bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&head, "%s: %s\r\n", k, headers[k])
+	}
+	head.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.body == "" {
+			continue
+		}
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build mail: %w", err)
+		}
+		if _, err := w.Write([]byte(part.body)); err != nil {
+			return nil, fmt.Errorf("failed to build mail: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build mail: %w", err)
+	}
+
+	return append(head.Bytes(), buf.Bytes()...), nil
+}
+
+// envelopeAddress extracts "a@b" from "Name <a@b>"
+func envelopeAddress(from string) string {
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+func domainOf(addr string) string {
+	if _, domain, ok := strings.Cut(addr, "@"); ok {
+		return domain
+	}
+	return "localhost"
+}
@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Template names
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+	TemplateMentionDigest = "mention_digest"
+	TemplateChannelLive   = "channel_live"
+)
+
+// Each template is a pair of files: <name>.txt defines "subject" and "text",
+// <name>.html defines "content", which is wrapped in layout.html.
+type templateSet struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+func loadTemplates() (*templateSet, error) {
+	set := &templateSet{
+		text: map[string]*texttemplate.Template{},
+		html: map[string]*htmltemplate.Template{},
+	}
+	for _, name := range []string{TemplateVerifyEmail, TemplatePasswordReset, TemplateMentionDigest, TemplateChannelLive} {
+		t, err := texttemplate.ParseFS(templateFS, "templates/"+name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s text template: %w", name, err)
+		}
+		h, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s html template: %w", name, err)
+		}
+		set.text[name] = t
+		set.html[name] = h
+	}
+	return set, nil
+}
+
+// render executes the named template, returning subject, text and HTML bodies
+func (s *templateSet) render(name string, data any) (string, string, string, error) {
+	t, ok := s.text[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown mail template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := t.ExecuteTemplate(&text, "text", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	if err := s.html[name].ExecuteTemplate(&html, "layout", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render %s html: %w", name, err)
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(text.String()) + "\n", html.String(), nil
+}
@@ -0,0 +1,98 @@
+// Package markdown renders the Markdown subset chat messages support to
+// HTML: **bold**, *italic* or _italic_, ~~strikethrough~~, `code`, fenced
+// code blocks, [links](https://example.com), bare http(s) URLs and line
+// breaks. Everything else, raw HTML included, is escaped, so the output can
+// be inserted into a page as is.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	fence     = regexp.MustCompile("(?s)```(?:[A-Za-z0-9_+-]*\n)?(.*?)```")
+	code      = regexp.MustCompile("`([^`\n]+)`")
+	link      = regexp.MustCompile(`\[([^\[\]\n]+)\]\(([^()\s]+)\)`)
+	bareURL   = regexp.MustCompile(`https?://[^\s<>"'\x00]+`)
+	bold      = regexp.MustCompile(`\*\*([^*\s\n](?:[^*\n]*[^*\s])?)\*\*`)
+	italic    = regexp.MustCompile(`\*([^*\s\n](?:[^*\n]*[^*\s])?)\*`)
+	underline = regexp.MustCompile(`(^|[^A-Za-z0-9_])_([^_\s](?:[^_\n]*[^_\s])?)_($|[^A-Za-z0-9_])`)
+	strike    = regexp.MustCompile(`~~([^~\s](?:[^~\n]*[^~\s])?)~~`)
+	held      = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// Render returns body as sanitized HTML
+func Render(body string) string {
+	r := &renderer{}
+	s := strings.ReplaceAll(body, "\x00", "")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	// Code first: nothing inside it is formatted
+	s = fence.ReplaceAllStringFunc(s, func(m string) string {
+		content := fence.FindStringSubmatch(m)[1]
+		return r.hold("<pre><code>" + html.EscapeString(strings.TrimSuffix(content, "\n")) + "</code></pre>")
+	})
+	s = code.ReplaceAllStringFunc(s, func(m string) string {
+		return r.hold("<code>" + html.EscapeString(code.FindStringSubmatch(m)[1]) + "</code>")
+	})
+
+	// Links are held before emphasis so URLs keep their underscores and stars
+	s = link.ReplaceAllStringFunc(s, func(m string) string {
+		parts := link.FindStringSubmatch(m)
+		href, ok := safeURL(parts[2])
+		if !ok {
+			return m
+		}
+		// A URL as link text stays text: links don't nest
+		text := bareURL.ReplaceAllStringFunc(parts[1], func(u string) string {
+			return r.hold(html.EscapeString(u))
+		})
+		open := r.hold(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+		return open + text + r.hold("</a>")
+	})
+	s = bareURL.ReplaceAllStringFunc(s, func(m string) string {
+		trimmed := strings.TrimRight(m, ".,:;!?)")
+		href, ok := safeURL(trimmed)
+		if !ok {
+			return m
+		}
+		a := `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">` + html.EscapeString(trimmed) + "</a>"
+		return r.hold(a) + m[len(trimmed):]
+	})
+
+	s = html.EscapeString(s)
+	s = bold.ReplaceAllString(s, "<strong>$1</strong>")
+	s = italic.ReplaceAllString(s, "<em>$1</em>")
+	s = underline.ReplaceAllString(s, "$1<em>$2</em>$3")
+	s = strike.ReplaceAllString(s, "<del>$1</del>")
+	s = strings.ReplaceAll(s, "\n", "<br>")
+
+	return held.ReplaceAllStringFunc(s, func(m string) string {
+		i, _ := strconv.Atoi(held.FindStringSubmatch(m)[1])
+		return r.held[i]
+	})
+}
+
+// renderer keeps finished HTML out of the way of later steps: hold swaps it
+// for a placeholder that Render puts back at the end
+type renderer struct {
+	held []string
+}
+
+func (r *renderer) hold(s string) string {
+	r.held = append(r.held, s)
+	return "\x00" + strconv.Itoa(len(r.held)-1) + "\x00"
+}
+
+// safeURL accepts absolute http and https URLs only, so links can't run script
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
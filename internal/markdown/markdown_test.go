@@ -0,0 +1,32 @@
+package markdown
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	const a = `" rel="nofollow noopener noreferrer" target="_blank">`
+	tests := map[string]string{
+		"hello":                            "hello",
+		"**bold** and *italic*":            "<strong>bold</strong> and <em>italic</em>",
+		"_italic_ but snake_case_name":     "<em>italic</em> but snake_case_name",
+		"~~gone~~":                         "<del>gone</del>",
+		"2 * 3 * 4":                        "2 * 3 * 4",
+		"line one\nline two":               "line one<br>line two",
+		"`**not bold**`":                   "<code>**not bold**</code>",
+		"```go\nx := <-ch\n```":            "<pre><code>x := &lt;-ch</code></pre>",
+		"<script>alert(1)</script>":        "&lt;script&gt;alert(1)&lt;/script&gt;",
+		"<b onclick=x>hi</b>":              "&lt;b onclick=x&gt;hi&lt;/b&gt;",
+		"[docs](https://a.dev/x_y_z)":      `<a href="https://a.dev/x_y_z` + a + `docs</a>`,
+		"[**docs**](https://a.dev)":        `<a href="https://a.dev` + a + `<strong>docs</strong></a>`,
+		"[x](javascript:alert(1))":         "[x](javascript:alert(1))",
+		`[x](https://a.dev/"onmouseover=)`: `<a href="https://a.dev/%22onmouseover=` + a + `x</a>`,
+		"see https://a.dev/a_b.":           `see <a href="https://a.dev/a_b` + a + `https://a.dev/a_b</a>.`,
+		"[https://a.dev](https://b.dev)":   `<a href="https://b.dev` + a + `https://a.dev</a>`,
+		"a & b":                            "a &amp; b",
+		"nul\x00byte":                      "nulbyte",
+	}
+	for in, want := range tests {
+		if got := Render(in); got != want {
+			t.Errorf("Render(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to HTTP and DB calls
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Registry holds metric families and renders them in the Prometheus text format
+type Registry struct {
+	mu         sync.RWMutex
+	counters   []*CounterVec
+	histograms []*HistogramVec
+	gauges     []*GaugeVec
+}
+
+// Default is the process-wide registry exposed on /metrics
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels
+type CounterVec struct {
+	name       string
+	help       string
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]float64
+}
+
+// GaugeVec is a value that can go up and down, partitioned by labels
+type GaugeVec struct {
+	name       string
+	help       string
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]float64
+}
+
+// HistogramVec tracks observations in cumulative buckets, partitioned by labels
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewCounterVec registers a new counter family
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labelNames: labelNames, values: make(map[string]float64)}
+	r.mu.Lock()
+	r.counters = append(r.counters, c)
+	r.mu.Unlock()
+	return c
+}
+
+// NewGaugeVec registers a new gauge family
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{name: name, help: help, labelNames: labelNames, values: make(map[string]float64)}
+	r.mu.Lock()
+	r.gauges = append(r.gauges, g)
+	r.mu.Unlock()
+	return g
+}
+
+// NewHistogramVec registers a new histogram family; nil buckets uses DefaultBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{name: name, help: help, labelNames: labelNames, buckets: buckets, series: make(map[string]*histogram)}
+	r.mu.Lock()
+	r.histograms = append(r.histograms, h)
+	r.mu.Unlock()
+	return h
+}
+
+// Add increments the counter for the given label values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Inc increments the counter by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Set sets the gauge for the given label values
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Add adjusts the gauge by v (which may be negative)
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Delete removes the series for the given label values, e.g. once the thing
+// it describes is gone
+func (g *GaugeVec) Delete(labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	delete(g.values, key)
+	g.mu.Unlock()
+}
+
+// Observe records a single observation for the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// WritePrometheus renders all metrics in the Prometheus text exposition format
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		c.mu.Lock()
+		for _, key := range sortedKeys(c.values) {
+			fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labelNames, key, ""), c.values[key])
+		}
+		c.mu.Unlock()
+	}
+
+	for _, g := range r.gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		g.mu.Lock()
+		for _, key := range sortedKeys(g.values) {
+			fmt.Fprintf(w, "%s%s %g\n", g.name, formatLabels(g.labelNames, key, ""), g.values[key])
+		}
+		g.mu.Unlock()
+	}
+
+	for _, h := range r.histograms {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+		h.mu.Lock()
+		keys := make([]string, 0, len(h.series))
+		for k := range h.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := h.series[key]
+			for i, b := range h.buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, key, fmt.Sprintf("%g", b)), s.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, key, "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %g\n", h.name, formatLabels(h.labelNames, key, ""), s.sum)
+			fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labelNames, key, ""), s.count)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Handler serves the registry over HTTP
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.WritePrometheus(w)
+	})
+}
+
+const labelSep = "\xff"
+
+func labelKey(values []string) string {
+	return strings.Join(values, labelSep)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(names []string, key string, le string) string {
+	var pairs []string
+	if len(names) > 0 {
+		values := strings.Split(key, labelSep)
+		for i, n := range names {
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			pairs = append(pairs, fmt.Sprintf("%s=%q", n, v))
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A counter", "kind")
+	h := r.NewHistogramVec("test_seconds", "A histogram", []float64{0.1, 1}, "op")
+
+	c.Inc("a")
+	c.Add(2, "a")
+	h.Observe(0.05, "read")
+	h.Observe(0.5, "read")
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		`test_total{kind="a"} 3`,
+		`test_seconds_bucket{op="read",le="0.1"} 1`,
+		`test_seconds_bucket{op="read",le="1"} 2`,
+		`test_seconds_bucket{op="read",le="+Inf"} 2`,
+		`test_seconds_count{op="read"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGaugeVecDelete(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("test_gauge", "A gauge", "channel")
+	g.Set(2, "busy")
+	g.Set(1, "quiet")
+	g.Delete("quiet")
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	out := buf.String()
+
+	if !strings.Contains(out, `test_gauge{channel="busy"} 2`) {
+		t.Errorf("output missing busy series:\n%s", out)
+	}
+	if strings.Contains(out, `channel="quiet"`) {
+		t.Errorf("deleted series still written:\n%s", out)
+	}
+}
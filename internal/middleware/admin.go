@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/models"
+)
+
+// RequireRole restricts a route group to users whose platform role grants at
+// least min, see models.HasRole. Must run after AuthMiddleware so user_id
+// and role are present in the context.
+func RequireRole(min string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("user_id"); !exists {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized")
+			return
+		}
+
+		if !models.HasRole(c.GetString("role"), min) {
+			apierror.Abort(c, http.StatusForbidden, apierror.Forbidden, "Requires the "+min+" role")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := auth.NewJWTService("test-secret", 1)
+	userID := uuid.New()
+
+	adminKey, _, _ := auth.GenerateAPIKey()
+	userKey, _, _ := auth.GenerateAPIKey()
+	keys := fakeKeyStore{
+		auth.HashAPIKey(adminKey): {UserID: userID, OwnerRole: models.RoleAdmin},
+		auth.HashAPIKey(userKey):  {UserID: userID, OwnerRole: models.RoleUser},
+	}
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtService, nil, keys, "X-API-Key", nil))
+	r.GET("/staff", RequireRole(models.RoleStaff), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/admin", RequireRole(models.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	token := func(role string) string {
+		t, _ := jwtService.GenerateSessionToken(userID, "u@example.com", role, uuid.Nil)
+		return "Bearer " + t
+	}
+
+	tests := []struct {
+		name, path, header, value string
+		want                      int
+	}{
+		{"admin token", "/admin", "Authorization", token(models.RoleAdmin), http.StatusOK},
+		{"admin token staff route", "/staff", "Authorization", token(models.RoleAdmin), http.StatusOK},
+		{"staff token", "/staff", "Authorization", token(models.RoleStaff), http.StatusOK},
+		{"staff token admin route", "/admin", "Authorization", token(models.RoleStaff), http.StatusForbidden},
+		{"token without role", "/staff", "Authorization", token(""), http.StatusForbidden},
+		{"admin key", "/admin", "X-API-Key", adminKey, http.StatusOK},
+		{"user key", "/admin", "X-API-Key", userKey, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
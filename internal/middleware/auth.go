@@ -1,43 +1,209 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
 	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/models"
 )
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
+// APIKeyStore resolves API keys by hash (see auth.HashAPIKey)
+type APIKeyStore interface {
+	Authenticate(keyHash string) (*models.APIKey, error)
+}
+
+// SessionStore reports whether a login session is still signed in
+type SessionStore interface {
+	Active(sessionID uuid.UUID) (bool, error)
+}
+
+// ExternalTokens resolves bearer tokens issued by an external identity
+// provider, such as a corporate SSO
+type ExternalTokens interface {
+	Authenticate(ctx context.Context, token string) (*models.User, error)
+}
+
+// AuthMiddleware validates JWT tokens. When sessions is set, tokens bound to
+// a session stop working once it is signed out; the session ID is stored in
+// the context as "session_id". When keys is set, an API key in the keyHeader
+// header (or as the bearer token) is accepted instead; the key is stored in
+// the context as "api_key" for KeyScopes and RequireScope. The user's
+// platform role is stored as "role" for RequireRole. Guest tokens set
+// "guest" (see GuestRoutes). When external is set, bearer tokens that are not
+// Tullo's own are passed to it.
+func AuthMiddleware(jwtService *auth.JWTService, sessions SessionStore, keys APIKeyStore, keyHeader string, external ExternalTokens) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if keys != nil {
+			key := c.GetHeader(keyHeader)
+			if key == "" {
+				if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && auth.LooksLikeAPIKey(bearer) {
+					key = bearer
+				}
+			}
+			if key != "" {
+				apiKey, err := keys.Authenticate(auth.HashAPIKey(key))
+				if err != nil {
+					apierror.Abort(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid, expired or revoked API key")
+					return
+				}
+				c.Set("user_id", apiKey.UserID)
+				c.Set("role", apiKey.OwnerRole)
+				c.Set("api_key", apiKey)
+				c.Next()
+				return
+			}
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.Unauthorized, "Authorization header required")
 			return
 		}
 
 		// Extract token from "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid authorization header format")
 			return
 		}
 
 		token := parts[1]
 		claims, err := jwtService.ValidateToken(token)
+		if err != nil && external != nil {
+			user, extErr := external.Authenticate(c.Request.Context(), token)
+			if extErr == nil {
+				c.Set("user_id", user.ID)
+				c.Set("email", user.Email)
+				c.Set("role", user.Role)
+				c.Next()
+				return
+			}
+		}
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid or expired token")
 			return
 		}
 
+		if sessions != nil && claims.SessionID != uuid.Nil {
+			active, err := sessions.Active(claims.SessionID)
+			if err != nil {
+				apierror.Abort(c, http.StatusInternalServerError, apierror.Internal, "Failed to check session")
+				return
+			}
+			if !active {
+				apierror.Abort(c, http.StatusUnauthorized, apierror.Unauthorized, "Session has been signed out")
+				return
+			}
+			c.Set("session_id", claims.SessionID)
+		}
+
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
+		c.Set("role", claims.Role)
+		if claims.Guest {
+			c.Set("guest", true)
+		}
+
+		c.Next()
+	}
+}
+
+// requestAPIKey returns the API key the request was authenticated with, or
+// nil for a JWT session
+func requestAPIKey(c *gin.Context) *models.APIKey {
+	v, _ := c.Get("api_key")
+	key, _ := v.(*models.APIKey)
+	return key
+}
+
+// KeyScopes requires the read scope for GET and HEAD requests made with an
+// API key and the write scope for everything else. readPaths lists route
+// paths (as registered) that only read despite another method, such as a
+// POST query endpoint. JWT sessions are not restricted.
+func KeyScopes(readPaths ...string) gin.HandlerFunc {
+	reads := make(map[string]struct{}, len(readPaths))
+	for _, p := range readPaths {
+		reads[p] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		key := requestAPIKey(c)
+		if key == nil {
+			c.Next()
+			return
+		}
+
+		scope := models.ScopeWrite
+		if _, ok := reads[c.FullPath()]; ok || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			scope = models.ScopeRead
+		}
+		if !key.HasScope(scope) {
+			abortScope(c, scope)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope additionally requires scope for requests made with an API key
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := requestAPIKey(c); key != nil && !key.HasScope(scope) {
+			abortScope(c, scope)
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionOnly rejects API keys, for routes a key must not reach such as
+// managing keys
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if requestAPIKey(c) != nil {
+			apierror.Abort(c, http.StatusForbidden, apierror.Forbidden, "Not available with an API key")
+			return
+		}
+		c.Next()
+	}
+}
+
+// IsGuest reports whether the request was made with a guest token
+func IsGuest(c *gin.Context) bool {
+	return c.GetBool("guest")
+}
+
+// GuestRoutes limits guest tokens to GET and HEAD requests on paths, route
+// paths as registered. A path prefixed with a method, such as
+// "POST /streams/:id/heartbeat", allows that method only. Other callers are
+// not restricted.
+func GuestRoutes(paths ...string) gin.HandlerFunc {
+	allowed := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		allowed[p] = struct{}{}
+	}
 
+	return func(c *gin.Context) {
+		if !IsGuest(c) {
+			c.Next()
+			return
+		}
+		_, ok := allowed[c.FullPath()]
+		ok = ok && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead)
+		if _, exact := allowed[c.Request.Method+" "+c.FullPath()]; !ok && !exact {
+			apierror.Abort(c, http.StatusForbidden, apierror.Forbidden, "Sign up or log in to do this")
+			return
+		}
 		c.Next()
 	}
 }
+
+func abortScope(c *gin.Context, scope string) {
+	apierror.Abort(c, http.StatusForbidden, apierror.InsufficientScope, "API key lacks the "+scope+" scope")
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/models"
+)
+
+type fakeKeyStore map[string]*models.APIKey
+
+func (s fakeKeyStore) Authenticate(keyHash string) (*models.APIKey, error) {
+	if k, ok := s[keyHash]; ok {
+		return k, nil
+	}
+	return nil, errors.New("not found")
+}
+
+type fakeSessionStore map[uuid.UUID]bool
+
+func (s fakeSessionStore) Active(sessionID uuid.UUID) (bool, error) {
+	return s[sessionID], nil
+}
+
+type fakeExternalTokens map[string]*models.User
+
+func (e fakeExternalTokens) Authenticate(ctx context.Context, token string) (*models.User, error) {
+	if u, ok := e[token]; ok {
+		return u, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestAuthMiddlewareExternalTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := auth.NewJWTService("test-secret", 1)
+	ssoUser := &models.User{ID: uuid.New(), Email: "ada@corp.example", Role: models.RoleStaff}
+	external := fakeExternalTokens{"sso-token": ssoUser}
+	own, _ := jwtService.GenerateToken(uuid.New(), "u@example.com")
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtService, nil, nil, "", external))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "%v %v", c.MustGet("email"), c.MustGet("role"))
+	})
+
+	tests := []struct {
+		name, token string
+		want        int
+		body        string
+	}{
+		{"own token", own, http.StatusOK, "u@example.com "},
+		{"sso token", "sso-token", http.StatusOK, "ada@corp.example staff"},
+		{"unknown token", "nope", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want || (tt.body != "" && w.Body.String() != tt.body) {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.want, tt.body)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := auth.NewJWTService("test-secret", 1)
+	userID, live, signedOut := uuid.New(), uuid.New(), uuid.New()
+	sessions := fakeSessionStore{live: true}
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtService, sessions, nil, "", nil))
+	r.GET("/", func(c *gin.Context) {
+		sid, _ := c.Get("session_id")
+		c.String(http.StatusOK, "%v", sid)
+	})
+
+	tests := []struct {
+		name      string
+		sessionID uuid.UUID
+		want      int
+	}{
+		{"live session", live, http.StatusOK},
+		{"signed out session", signedOut, http.StatusUnauthorized},
+		{"token without session", uuid.Nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _ := jwtService.GenerateSessionToken(userID, "u@example.com", "", tt.sessionID)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := auth.NewJWTService("test-secret", 1)
+	userID := uuid.New()
+	session, _ := jwtService.GenerateToken(userID, "u@example.com")
+
+	readKey, _, _ := auth.GenerateAPIKey()
+	writeKey, _, _ := auth.GenerateAPIKey()
+	modKey, _, _ := auth.GenerateAPIKey()
+	store := fakeKeyStore{
+		auth.HashAPIKey(readKey):  {UserID: userID, Scopes: []string{models.ScopeRead}},
+		auth.HashAPIKey(writeKey): {UserID: userID, Scopes: []string{models.ScopeRead, models.ScopeWrite}},
+		auth.HashAPIKey(modKey):   {UserID: userID, Scopes: []string{models.ScopeWrite, models.ScopeModerate}},
+	}
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtService, nil, store, "X-API-Key", nil), KeyScopes("/query"))
+	ok := func(c *gin.Context) {
+		if c.MustGet("user_id").(uuid.UUID) != userID {
+			c.Status(http.StatusTeapot)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	r.GET("/items", ok)
+	r.POST("/items", ok)
+	r.POST("/query", ok)
+	r.POST("/ban", RequireScope(models.ScopeModerate), ok)
+	r.POST("/keys", SessionOnly(), ok)
+
+	tests := []struct {
+		name, method, path, header, value string
+		want                              int
+	}{
+		{"session get", "GET", "/items", "Authorization", "Bearer " + session, http.StatusOK},
+		{"session moderate", "POST", "/ban", "Authorization", "Bearer " + session, http.StatusOK},
+		{"session manages keys", "POST", "/keys", "Authorization", "Bearer " + session, http.StatusOK},
+		{"read key get", "GET", "/items", "X-API-Key", readKey, http.StatusOK},
+		{"read key as bearer", "GET", "/items", "Authorization", "Bearer " + readKey, http.StatusOK},
+		{"read key post", "POST", "/items", "X-API-Key", readKey, http.StatusForbidden},
+		{"read key read-only post", "POST", "/query", "X-API-Key", readKey, http.StatusOK},
+		{"write key post", "POST", "/items", "X-API-Key", writeKey, http.StatusOK},
+		{"write key moderate", "POST", "/ban", "X-API-Key", writeKey, http.StatusForbidden},
+		{"moderate key", "POST", "/ban", "X-API-Key", modKey, http.StatusOK},
+		{"moderate key without read", "GET", "/items", "X-API-Key", modKey, http.StatusForbidden},
+		{"key manages keys", "POST", "/keys", "X-API-Key", writeKey, http.StatusForbidden},
+		{"unknown key", "GET", "/items", "X-API-Key", "tlk_nope", http.StatusUnauthorized},
+		{"no credentials", "GET", "/items", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGuestRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := auth.NewJWTService("test-secret", 1)
+	guest, _, _ := jwtService.GenerateGuestToken()
+	user, _ := jwtService.GenerateToken(uuid.New(), "u@example.com")
+
+	r := gin.New()
+	r.Use(AuthMiddleware(jwtService, nil, nil, "X-API-Key", nil), GuestRoutes("/channels/:slug/chat", "POST /streams/:id/heartbeat"))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/channels/:slug/chat", ok)
+	r.POST("/channels/:slug/chat", ok)
+	r.GET("/me", ok)
+	r.GET("/streams/:id/heartbeat", ok)
+	r.POST("/streams/:id/heartbeat", ok)
+
+	tests := []struct {
+		name, method, path, token string
+		want                      int
+	}{
+		{"guest reads chat", "GET", "/channels/live/chat", guest, http.StatusOK},
+		{"guest posts", "POST", "/channels/live/chat", guest, http.StatusForbidden},
+		{"guest elsewhere", "GET", "/me", guest, http.StatusForbidden},
+		{"guest sends heartbeat", "POST", "/streams/s1/heartbeat", guest, http.StatusOK},
+		{"guest on other method", "GET", "/streams/s1/heartbeat", guest, http.StatusForbidden},
+		{"user posts", "POST", "/channels/live/chat", user, http.StatusOK},
+		{"user elsewhere", "GET", "/me", user, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+)
+
+// BearerToken restricts a route to callers whose Authorization header is
+// "Bearer <token>", for machine endpoints such as /metrics that share one
+// static token rather than a user login. An empty token rejects everyone.
+func BearerToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid or missing token")
+			return
+		}
+		c.Next()
+	}
+}
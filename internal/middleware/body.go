@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+)
+
+// BodyLimit caps request bodies at maxBytes. Requests that declare a larger
+// Content-Length are rejected up front; bodies without a length (chunked) are
+// cut off at the limit while being read.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			abortTooLarge(c, maxBytes)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// JSONBody checks request bodies before handlers bind them: a body must be
+// sent as application/json, fit within the BodyLimit installed ahead of this
+// middleware, and nest objects and arrays at most maxDepth levels deep.
+// Requests without a body pass through.
+func JSONBody(maxDepth int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength == 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			apierror.Abort(c, http.StatusUnsupportedMediaType, apierror.UnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortTooLarge(c, tooLarge.Limit)
+				return
+			}
+			apierror.Abort(c, http.StatusBadRequest, apierror.BadRequest, "Failed to read request body")
+			return
+		}
+		if exceedsDepth(body, maxDepth) {
+			apierror.Abort(c, http.StatusBadRequest, apierror.ValidationFailed, fmt.Sprintf("JSON body is nested more than %d levels deep", maxDepth))
+			return
+		}
+
+		// Handlers bind from the buffered copy
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+func abortTooLarge(c *gin.Context, maxBytes int64) {
+	apierror.Abort(c, http.StatusRequestEntityTooLarge, apierror.PayloadTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytes))
+}
+
+// exceedsDepth reports whether objects and arrays in b nest deeper than limit.
+// It only tracks brackets outside strings; malformed JSON is left for binding
+// to reject.
+func exceedsDepth(b []byte, limit int) bool {
+	depth := 0
+	inString, escaped := false, false
+	for _, ch := range b {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+		switch ch {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > limit {
+				return true
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func bodyRouter(maxBytes int64, maxDepth int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(BodyLimit(maxBytes), JSONBody(maxDepth))
+	r.POST("/", func(c *gin.Context) {
+		b, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(b))
+	})
+	return r
+}
+
+func TestJSONBody(t *testing.T) {
+	r := bodyRouter(64, 3)
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		chunked     bool
+		want        int
+	}{
+		{"valid", `{"body":"hi"}`, "application/json", false, http.StatusOK},
+		{"charset param", `{"body":"hi"}`, "application/json; charset=utf-8", false, http.StatusOK},
+		{"empty body", ``, "", false, http.StatusOK},
+		{"wrong content type", `{"body":"hi"}`, "text/plain", false, http.StatusUnsupportedMediaType},
+		{"missing content type", `{"body":"hi"}`, "", false, http.StatusUnsupportedMediaType},
+		{"too large", `{"body":"` + strings.Repeat("x", 100) + `"}`, "application/json", false, http.StatusRequestEntityTooLarge},
+		{"too large chunked", `{"body":"` + strings.Repeat("x", 100) + `"}`, "application/json", true, http.StatusRequestEntityTooLarge},
+		{"at depth limit", `{"a":{"b":[1]}}`, "application/json", false, http.StatusOK},
+		{"too deep", `{"a":{"b":[[1]]}}`, "application/json", false, http.StatusBadRequest},
+		{"brackets in strings", `{"a":"[[[[{{{{"}`, "application/json", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+			if w.Code == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("handler read %q, want %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
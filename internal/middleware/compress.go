@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	zlibWriters = sync.Pool{New: func() any { return zlib.NewWriter(io.Discard) }}
+)
+
+// Compress gzip- or deflate-encodes responses for clients that accept it.
+// Bodies smaller than minSize are sent as is, since compression would barely
+// shrink them, as are responses that aren't text or JSON. WebSocket upgrades
+// and the listed paths are never touched.
+func Compress(minSize int, excludePaths ...string) gin.HandlerFunc {
+	excluded := make(map[string]bool, len(excludePaths))
+	for _, p := range excludePaths {
+		excluded[p] = true
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || excluded[c.Request.URL.Path] || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		c.Header("Vary", "Accept-Encoding")
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: minSize}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// honouring q-values and preferring gzip on a tie. It returns "" when neither
+// is acceptable.
+func negotiateEncoding(header string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range []string{"gzip", "deflate"} {
+		w, ok := q[enc]
+		if !ok {
+			w, ok = q["*"]
+		}
+		if ok && w > bestQ {
+			best, bestQ = enc, w
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the first minSize bytes of a response to decide
+// whether it is worth compressing, then streams the rest through the encoder
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what is buffered so far; an undecided response goes out uncompressed
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if gz, ok := w.enc.(interface{ Flush() error }); ok {
+		gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide starts the response, compressed if large is set and the content
+// type and status allow it, and writes out the buffered bytes
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	h := w.Header()
+	if large && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) && bodyAllowed(w.Status()) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == "gzip" {
+			gz := gzipWriters.Get().(*gzip.Writer)
+			gz.Reset(w.ResponseWriter)
+			w.enc = gz
+		} else {
+			zw := zlibWriters.Get().(*zlib.Writer)
+			zw.Reset(w.ResponseWriter)
+			w.enc = zw
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish writes out a response that stayed under minSize and closes the encoder
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	switch enc := w.enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	case *zlib.Writer:
+		zlibWriters.Put(enc)
+	}
+	w.enc = nil
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/javascript" ||
+		mediaType == "application/xml"
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
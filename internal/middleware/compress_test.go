@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"deflate":                 "deflate",
+		"gzip, deflate, br":       "gzip",
+		"deflate;q=1, gzip;q=0.5": "deflate",
+		"gzip;q=0, deflate;q=0.1": "deflate",
+		"gzip;q=0":                "",
+		"*":                       "gzip",
+		"identity":                "",
+		"GZIP;q=0.8, *;q=0.1":     "gzip",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := `{"items":"` + strings.Repeat("hello ", 200) + `"}`
+	r := gin.New()
+	r.Use(Compress(256, "/ws"))
+	r.GET("/large", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(large)) })
+	r.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/binary", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	r.GET("/ws", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(large)) })
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/large", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large JSON not gzipped: %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != large {
+		t.Fatalf("gzip body does not round-trip")
+	}
+
+	w = get("/large", "deflate")
+	if w.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("large JSON not deflated: %v", w.Header())
+	}
+	dr, err := zlib.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(dr); string(b) != large {
+		t.Fatalf("deflate body does not round-trip")
+	}
+
+	for _, tc := range []struct{ path, accept string }{
+		{"/large", ""},
+		{"/small", "gzip"},
+		{"/binary", "gzip"},
+		{"/ws", "gzip"},
+	} {
+		w := get(tc.path, tc.accept)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.Len() == 0 {
+			t.Errorf("%s (Accept-Encoding %q) should be sent uncompressed, got %v", tc.path, tc.accept, w.Header())
+		}
+	}
+}
@@ -1,36 +1,84 @@
 package middleware
 
 import (
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/origin"
 )
 
-// CORSMiddleware handles CORS
-func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
+// CORSOptions configures CORSMiddleware
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAgeSec        int
+}
+
+// CORSMiddleware handles CORS. Origins are matched with the same rules as the
+// WebSocket upgrader (see package origin). Preflight requests from allowed
+// origins are answered with 204 without reaching the handlers; preflights
+// from other origins get 403. The allowed origin is always echoed rather
+// than "*" so responses stay cacheable per origin via Vary: Origin.
+func CORSMiddleware(opts CORSOptions) gin.HandlerFunc {
+	origins := origin.NewMatcher(opts.AllowedOrigins)
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+	maxAge := ""
+	if opts.MaxAgeSec > 0 {
+		maxAge = strconv.Itoa(opts.MaxAgeSec)
+	}
+
 	return func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
-		
-		// Check if origin is allowed
-		allowed := false
-		for _, allowedOrigin := range allowedOrigins {
-			if origin == allowedOrigin || allowedOrigin == "*" {
-				allowed = true
-				break
-			}
+		reqOrigin := c.Request.Header.Get("Origin")
+		if reqOrigin == "" {
+			c.Next()
+			return
 		}
 
-		if allowed {
-			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		h := c.Writer.Header()
+		h.Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != ""
+
+		if !origins.Allowed(reqOrigin) {
+			if preflight {
+				apierror.Abort(c, http.StatusForbidden, apierror.Forbidden, "Origin not allowed")
+				return
+			}
+			c.Next()
+			return
 		}
 
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		h.Set("Access-Control-Allow-Origin", reqOrigin)
+		if opts.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if methods != "" {
+				h.Set("Access-Control-Allow-Methods", methods)
+			}
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if maxAge != "" {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
+		if exposed != "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+		}
 		c.Next()
 	}
 }
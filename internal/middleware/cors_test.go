@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func corsRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORSMiddleware(CORSOptions{
+		AllowedOrigins:   []string{"http://localhost:3000", "https://*.tullo.tv"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAgeSec:        600,
+	}))
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	return r
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := corsRouter()
+	tests := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{"exact origin", "http://localhost:3000", http.StatusNoContent},
+		{"wildcard subdomain", "https://studio.tullo.tv", http.StatusNoContent},
+		{"wildcard wrong scheme", "http://studio.tullo.tv", http.StatusForbidden},
+		{"suffix without dot", "https://eviltullo.tv", http.StatusForbidden},
+		{"unknown origin", "https://example.com", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no OPTIONS route exists; the middleware answers from the 404 chain
+			req := httptest.NewRequest(http.MethodOptions, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusNoContent {
+				if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Access-Control-Allow-Origin = %q for rejected origin", got)
+				}
+				return
+			}
+			h := w.Header()
+			if h.Get("Access-Control-Allow-Origin") != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q", h.Get("Access-Control-Allow-Origin"))
+			}
+			if h.Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("missing Access-Control-Allow-Credentials")
+			}
+			if h.Get("Access-Control-Allow-Methods") != "GET, POST" {
+				t.Errorf("Access-Control-Allow-Methods = %q", h.Get("Access-Control-Allow-Methods"))
+			}
+			if h.Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" {
+				t.Errorf("Access-Control-Allow-Headers = %q", h.Get("Access-Control-Allow-Headers"))
+			}
+			if h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Access-Control-Max-Age = %q", h.Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	r := corsRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Errorf("Access-Control-Allow-Origin = %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("Access-Control-Expose-Headers = %q", w.Header().Get("Access-Control-Expose-Headers"))
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Errorf("Vary = %q, want Origin", w.Header().Get("Vary"))
+	}
+
+	// disallowed origins still reach the handler but get no CORS headers
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("status = %d, Access-Control-Allow-Origin = %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+)
+
+// ChannelETagKey and UserETagKey name cached resources; handlers that change
+// a resource invalidate it with the same key
+func ChannelETagKey(slug string) string { return "channel:" + slug }
+
+func UserETagKey(id uuid.UUID) string { return "user:" + id.String() }
+
+// ETagCache adds ETags to GET responses and remembers the current ETag of
+// each resource, so a conditional GET from a polling client is answered with
+// 304 Not Modified before the handler runs. Handlers call Invalidate when a
+// resource changes; entries also expire after ttl as a backstop. Entries live
+// in Redis so invalidation reaches every instance; without Redis an
+// in-process map is used instead.
+type ETagCache struct {
+	redis *cache.RedisClient
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	local map[string]localETag
+}
+
+type localETag struct {
+	etag    string
+	expires time.Time
+}
+
+func NewETagCache(redis *cache.RedisClient, ttl time.Duration) *ETagCache {
+	return &ETagCache{
+		redis: redis,
+		ttl:   ttl,
+		local: make(map[string]localETag),
+	}
+}
+
+// Handle serves conditional GETs for the resource keyOf names. A cached ETag
+// matching If-None-Match short-circuits with 304; otherwise the handler runs
+// and a 200 response is tagged with a hash of its body, which is cached for
+// the next request.
+func (e *ETagCache) Handle(keyOf func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyOf(c)
+		ifNoneMatch := c.GetHeader("If-None-Match")
+
+		if ifNoneMatch != "" {
+			if etag := e.get(key); etag != "" && etagMatches(ifNoneMatch, etag) {
+				writeNotModified(c, etag)
+				c.Abort()
+				return
+			}
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.status != http.StatusOK {
+			c.Writer.WriteHeader(w.status)
+			c.Writer.Write(w.buf.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(w.buf.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		e.set(key, etag)
+
+		if ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+			writeNotModified(c, etag)
+			return
+		}
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		c.Writer.WriteHeader(http.StatusOK)
+		c.Writer.Write(w.buf.Bytes())
+	}
+}
+
+// Invalidate drops the cached ETags of changed resources. It is safe to call
+// on a nil cache.
+func (e *ETagCache) Invalidate(keys ...string) {
+	if e == nil || len(keys) == 0 {
+		return
+	}
+	if e.redis != nil {
+		redisKeys := make([]string, len(keys))
+		for i, k := range keys {
+			redisKeys[i] = "etag:" + k
+		}
+		if err := e.redis.Delete(redisKeys...); err != nil {
+			log.Printf("Failed to invalidate ETags %v: %v", keys, err)
+		}
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, k := range keys {
+		delete(e.local, k)
+	}
+}
+
+func (e *ETagCache) get(key string) string {
+	if e.redis != nil {
+		etag, err := e.redis.GetString("etag:" + key)
+		if err != nil {
+			// Fall through to the handler; it re-tags the response
+			return ""
+		}
+		return etag
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	entry, ok := e.local[key]
+	if !ok || time.Now().After(entry.expires) {
+		delete(e.local, key)
+		return ""
+	}
+	return entry.etag
+}
+
+func (e *ETagCache) set(key, etag string) {
+	if e.redis != nil {
+		if err := e.redis.SetString("etag:"+key, etag, e.ttl); err != nil {
+			log.Printf("Failed to cache ETag for %s: %v", key, err)
+		}
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.local[key] = localETag{etag: etag, expires: time.Now().Add(e.ttl)}
+}
+
+func writeNotModified(c *gin.Context, etag string) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Status(http.StatusNotModified)
+	c.Writer.WriteHeaderNow()
+}
+
+// etagMatches applies If-None-Match's weak comparison: any listed tag equal
+// to etag, ignoring W/ prefixes, or "*"
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds the handler's response so it can be hashed before
+// anything is sent
+type bufferedWriter struct {
+	gin.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) WriteHeader(code int) { w.status = code }
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) { return w.buf.Write(b) }
+
+func (w *bufferedWriter) WriteString(s string) (int, error) { return w.buf.WriteString(s) }
+
+func (w *bufferedWriter) Status() int { return w.status }
+
+func (w *bufferedWriter) Written() bool { return w.buf.Len() > 0 }
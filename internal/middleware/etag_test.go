@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETagCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := NewETagCache(nil, time.Minute)
+	body, calls := "v1", 0
+	r := gin.New()
+	r.GET("/channels/:slug", e.Handle(func(c *gin.Context) string { return ChannelETagKey(c.Param("slug")) }), func(c *gin.Context) {
+		calls++
+		if c.Param("slug") == "missing" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.String(http.StatusOK, body)
+	})
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/channels/a", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "v1" || etag == "" {
+		t.Fatalf("first GET: %d %q etag=%q", w.Code, w.Body.String(), etag)
+	}
+
+	w = get("/channels/a", etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || calls != 1 {
+		t.Fatalf("cached conditional GET: %d %q after %d handler calls", w.Code, w.Body.String(), calls)
+	}
+	if w = get("/channels/a", `W/"other", `+etag); w.Code != http.StatusNotModified {
+		t.Fatalf("ETag in a list should match, got %d", w.Code)
+	}
+
+	body = "v2"
+	e.Invalidate(ChannelETagKey("a"))
+	w = get("/channels/a", etag)
+	if w.Code != http.StatusOK || w.Body.String() != "v2" || w.Header().Get("ETag") == etag {
+		t.Fatalf("after invalidation: %d %q etag=%q", w.Code, w.Body.String(), w.Header().Get("ETag"))
+	}
+
+	if w = get("/channels/missing", ""); w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Fatalf("errors pass through untagged, got %d etag=%q", w.Code, w.Header().Get("ETag"))
+	}
+}
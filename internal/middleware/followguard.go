@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+)
+
+var followsThrottled = metrics.Default.NewCounterVec(
+	"tullo_follows_throttled_total",
+	"Follows by new accounts rejected by the follow guard, by what hit its limit (ip or network).",
+	"kind",
+)
+
+// FollowGuardConfig configures FollowGuard. Within Window, a channel accepts
+// at most PerIP follows by new accounts from one client IP and PerNetwork
+// from one network. Accounts younger than NewAccountAge are new. A limit of
+// 0 disables that kind.
+type FollowGuardConfig struct {
+	NewAccountAge time.Duration
+	Window        time.Duration
+	PerIP         int
+	PerNetwork    int
+}
+
+// FollowGuard slows down follow-botting: many fresh accounts following one
+// channel from a handful of IPs. Established accounts are never counted.
+// State lives in Redis so limits hold across instances; without Redis (or
+// when it errors) it is kept in process.
+type FollowGuard struct {
+	redis *cache.RedisClient
+	cfg   FollowGuardConfig
+	asns  *ASNTable
+
+	mu    sync.Mutex
+	local map[string]*followWindow
+}
+
+type followWindow struct {
+	count int
+	start time.Time
+}
+
+// NewFollowGuard creates a guard; asns may be nil, in which case networks
+// are approximated by address prefix (see Network)
+func NewFollowGuard(redis *cache.RedisClient, cfg FollowGuardConfig, asns *ASNTable) *FollowGuard {
+	return &FollowGuard{redis: redis, cfg: cfg, asns: asns, local: make(map[string]*followWindow)}
+}
+
+// IsNewAccount reports whether an account created at createdAt is young
+// enough to be counted
+func (g *FollowGuard) IsNewAccount(createdAt time.Time) bool {
+	return g.cfg.NewAccountAge > 0 && time.Since(createdAt) < g.cfg.NewAccountAge
+}
+
+// Network returns the network ip belongs to: its autonomous system ("AS64500")
+// when the ASN table knows it, otherwise its /24 (IPv4) or /48 (IPv6) prefix.
+// Unparseable addresses are returned unchanged.
+func (g *FollowGuard) Network(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if asn, ok := g.asns.Lookup(addr); ok {
+		return fmt.Sprintf("AS%d", asn)
+	}
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
+
+// Allow counts a follow of channelID by a new account from ip and network.
+// Once the IP or the network is over its limit it returns false and how
+// long until the window resets.
+func (g *FollowGuard) Allow(channelID uuid.UUID, ip, network string) (bool, time.Duration) {
+	if d := g.count("ip", "followip:"+channelID.String()+":"+ip, g.cfg.PerIP); d > 0 {
+		return false, d
+	}
+	if d := g.count("network", "follownet:"+channelID.String()+":"+network, g.cfg.PerNetwork); d > 0 {
+		return false, d
+	}
+	return true, 0
+}
+
+// count increments key's window and returns the time left in it once limit
+// is exceeded, or 0 while it is not
+func (g *FollowGuard) count(kind, key string, limit int) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+
+	if g.redis != nil {
+		n, err := g.redis.IncrWindow(key, g.cfg.Window)
+		if err == nil {
+			if n <= int64(limit) {
+				return 0
+			}
+			followsThrottled.Inc(kind)
+			if ttl, err := g.redis.FlagTTL(key); err == nil && ttl > 0 {
+				return ttl
+			}
+			return g.cfg.Window
+		}
+		log.Printf("Follow guard: Redis error, using local state: %v", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	w, ok := g.local[key]
+	if !ok || now.Sub(w.start) >= g.cfg.Window {
+		w = &followWindow{start: now}
+		g.local[key] = w
+	}
+	w.count++
+	if w.count <= limit {
+		return 0
+	}
+	followsThrottled.Inc(kind)
+	return w.start.Add(g.cfg.Window).Sub(now)
+}
+
+// Cleanup periodically drops expired local windows
+func (g *FollowGuard) Cleanup() {
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			g.mu.Lock()
+			now := time.Now()
+			for key, w := range g.local {
+				if now.Sub(w.start) >= g.cfg.Window {
+					delete(g.local, key)
+				}
+			}
+			g.mu.Unlock()
+		}
+	}()
+}
+
+// ASNTable maps address prefixes to autonomous system numbers
+type ASNTable struct {
+	// prefixes are sorted longest first so the first match is the most specific
+	prefixes []asnPrefix
+}
+
+type asnPrefix struct {
+	prefix netip.Prefix
+	asn    uint32
+}
+
+// LoadASNTable reads a table of "<cidr> <asn>" lines, such as an export of
+// a routing table. Blank lines and lines starting with # are skipped; the
+// ASN may be written with or without an "AS" prefix.
+func LoadASNTable(path string) (*ASNTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &ASNTable{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.ReplaceAll(text, ",", " "))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"<cidr> <asn>\"", path, line)
+		}
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		var asn uint32
+		if _, err := fmt.Sscanf(strings.TrimPrefix(strings.ToUpper(fields[1]), "AS"), "%d", &asn); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid ASN %q", path, line, fields[1])
+		}
+		t.prefixes = append(t.prefixes, asnPrefix{prefix: prefix.Masked(), asn: asn})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(t.prefixes, func(i, j int) bool {
+		return t.prefixes[i].prefix.Bits() > t.prefixes[j].prefix.Bits()
+	})
+	return t, nil
+}
+
+// Lookup returns the ASN announcing the most specific prefix containing addr
+func (t *ASNTable) Lookup(addr netip.Addr) (uint32, bool) {
+	if t == nil {
+		return 0, false
+	}
+	for _, p := range t.prefixes {
+		if p.prefix.Contains(addr) {
+			return p.asn, true
+		}
+	}
+	return 0, false
+}
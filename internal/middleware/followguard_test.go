@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFollowGuard(t *testing.T) {
+	g := NewFollowGuard(nil, FollowGuardConfig{
+		NewAccountAge: 24 * time.Hour,
+		Window:        time.Hour,
+		PerIP:         2,
+		PerNetwork:    3,
+	}, nil)
+	ch := uuid.New()
+
+	if !g.IsNewAccount(time.Now().Add(-time.Hour)) || g.IsNewAccount(time.Now().Add(-48*time.Hour)) {
+		t.Fatal("IsNewAccount should only count accounts younger than NewAccountAge")
+	}
+
+	net := g.Network("192.0.2.10")
+	for i := 0; i < 2; i++ {
+		if ok, _ := g.Allow(ch, "192.0.2.10", net); !ok {
+			t.Fatalf("follow %d from the IP throttled", i+1)
+		}
+	}
+	if ok, d := g.Allow(ch, "192.0.2.10", net); ok || d <= 0 || d > time.Hour {
+		t.Fatalf("third follow from the IP = %t, %s; want throttled within the window", ok, d)
+	}
+
+	// A second IP in the same /24 shares the network limit
+	if ok, _ := g.Allow(ch, "192.0.2.11", net); !ok {
+		t.Fatal("first follow from a second IP throttled")
+	}
+	if ok, _ := g.Allow(ch, "192.0.2.12", net); ok {
+		t.Fatal("network over its limit was allowed")
+	}
+
+	// Other channels are counted separately
+	if ok, _ := g.Allow(uuid.New(), "192.0.2.10", net); !ok {
+		t.Fatal("follow of another channel throttled")
+	}
+}
+
+func TestFollowGuardNetwork(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.txt")
+	table := "# cidr asn\n198.51.100.0/24 AS64500\n198.51.100.128/25,64501\n\n2001:db8::/32 64502\n"
+	if err := os.WriteFile(path, []byte(table), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	asns, err := LoadASNTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewFollowGuard(nil, FollowGuardConfig{}, asns)
+
+	tests := map[string]string{
+		"198.51.100.7":          "AS64500",
+		"198.51.100.200":        "AS64501",
+		"::ffff:198.51.100.7":   "AS64500",
+		"2001:db8:1::1":         "AS64502",
+		"203.0.113.9":           "203.0.113.0/24",
+		"2001:db9:aaaa:bbbb::1": "2001:db9:aaaa::/48",
+		"not-an-ip":             "not-an-ip",
+	}
+	for ip, want := range tests {
+		if got := g.Network(ip); got != want {
+			t.Errorf("Network(%q) = %q, want %q", ip, got, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("198.51.100.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadASNTable(path); err == nil {
+		t.Error("LoadASNTable accepted a line without an ASN")
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+)
+
+// HeartbeatDeduper lets one player heartbeat per viewer, device and stream
+// through within an interval, so a player that retries, or one open in
+// several tabs of a device, counts once. State lives in Redis so it holds
+// across instances; without Redis (or when it errors) it is kept in process.
+type HeartbeatDeduper struct {
+	redis    *cache.RedisClient
+	interval time.Duration
+
+	mu    sync.Mutex
+	local map[string]time.Time
+}
+
+func NewHeartbeatDeduper(redis *cache.RedisClient, interval time.Duration) *HeartbeatDeduper {
+	return &HeartbeatDeduper{redis: redis, interval: interval, local: make(map[string]time.Time)}
+}
+
+// First reports whether this is viewerID's first heartbeat for streamID from
+// device within the interval
+func (d *HeartbeatDeduper) First(streamID, viewerID uuid.UUID, device string) bool {
+	key := "heartbeat:" + streamID.String() + ":" + viewerID.String() + ":" + device
+	if d.redis != nil {
+		ok, err := d.redis.SetFlagNX(key, d.interval)
+		if err == nil {
+			return ok
+		}
+		log.Printf("Heartbeat deduper: Redis error, using local state: %v", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if until, ok := d.local[key]; ok && now.Before(until) {
+		return false
+	}
+	d.local[key] = now.Add(d.interval)
+	return true
+}
+
+// Cleanup periodically drops expired local entries
+func (d *HeartbeatDeduper) Cleanup() {
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			d.mu.Lock()
+			now := time.Now()
+			for key, until := range d.local {
+				if !now.Before(until) {
+					delete(d.local, key)
+				}
+			}
+			d.mu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHeartbeatDeduper(t *testing.T) {
+	d := NewHeartbeatDeduper(nil, 50*time.Millisecond)
+	stream, viewer := uuid.New(), uuid.New()
+
+	if !d.First(stream, viewer, "tv") {
+		t.Fatal("first heartbeat deduplicated")
+	}
+	if d.First(stream, viewer, "tv") {
+		t.Fatal("repeated heartbeat counted")
+	}
+	if !d.First(stream, viewer, "phone") || !d.First(stream, uuid.New(), "tv") || !d.First(uuid.New(), viewer, "tv") {
+		t.Fatal("heartbeat of another device, viewer or stream deduplicated")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !d.First(stream, viewer, "tv") {
+		t.Fatal("heartbeat after the interval deduplicated")
+	}
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/ratelimit"
+)
+
+// IP limiter scopes used by the router
+const (
+	IPScopeAuth   = "auth"
+	IPScopeWS     = "ws"
+	IPScopeHealth = "health"
+	IPScopeLinks  = "links"
+)
+
+var (
+	ipLimited = metrics.Default.NewCounterVec(
+		"tullo_ip_rate_limited_total",
+		"Requests rejected by the IP rate limiter, by scope.",
+		"scope",
+	)
+	ipBlocks = metrics.Default.NewCounterVec(
+		"tullo_ip_blocks_total",
+		"Temporary IP blocks issued after repeated rate limit violations, by scope.",
+		"scope",
+	)
+	ipBlockedRequests = metrics.Default.NewCounterVec(
+		"tullo_ip_blocked_requests_total",
+		"Requests rejected because the client IP is temporarily blocked, by scope.",
+		"scope",
+	)
+)
+
+// IPLimiterConfig configures the IP limiter. An IP that is rate limited
+// BlockAfter times within BlockWindow is blocked from every scope for BlockFor.
+type IPLimiterConfig struct {
+	Policies    map[string]ratelimit.Policy
+	BlockAfter  int
+	BlockWindow time.Duration
+	BlockFor    time.Duration
+}
+
+// IPLimiter rate limits unauthenticated traffic by client IP. State lives in
+// Redis so limits hold across instances; without Redis (or when it errors) an
+// in-process limiter is used instead. The client IP comes from gin's
+// ClientIP, so X-Forwarded-For is only honoured from trusted proxies
+// (see gin.Engine.SetTrustedProxies).
+type IPLimiter struct {
+	redis   *cache.RedisClient
+	cfg     IPLimiterConfig
+	buckets *ratelimit.Buckets
+
+	mu         sync.Mutex
+	violations map[string][]time.Time
+	blocked    map[string]time.Time
+}
+
+func NewIPLimiter(redis *cache.RedisClient, cfg IPLimiterConfig) *IPLimiter {
+	return &IPLimiter{
+		redis:      redis,
+		cfg:        cfg,
+		buckets:    ratelimit.New(redis, "iprl:"),
+		violations: make(map[string][]time.Time),
+		blocked:    make(map[string]time.Time),
+	}
+}
+
+// Limit applies the scope's policy to each request's client IP
+func (l *IPLimiter) Limit(scope string) gin.HandlerFunc {
+	p, ok := l.cfg.Policies[scope]
+	if !ok || p.Rate <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+
+		if remaining := l.blockedFor(ip); remaining > 0 {
+			ipBlockedRequests.Inc(scope)
+			c.Header("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+			apierror.Abort(c, http.StatusTooManyRequests, apierror.IPBlocked, "Too many requests from this IP; try again later")
+			return
+		}
+
+		res := l.buckets.Allow(scope+":"+ip, p)
+		WriteRateLimitHeaders(c, res)
+		if res.Allowed {
+			c.Next()
+			return
+		}
+
+		ipLimited.Inc(scope)
+		if l.recordViolation(scope, ip) {
+			ipBlocks.Inc(scope)
+			log.Printf("Blocking IP %s for %s after repeated %s rate limit violations", ip, l.cfg.BlockFor, scope)
+		}
+		apierror.Abort(c, http.StatusTooManyRequests, apierror.RateLimited, "Rate limit exceeded")
+	}
+}
+
+// recordViolation counts a rejection and blocks the IP once BlockAfter is
+// reached. Returns true when a new block was issued.
+func (l *IPLimiter) recordViolation(scope, ip string) bool {
+	if l.cfg.BlockAfter <= 0 || l.cfg.BlockFor <= 0 {
+		return false
+	}
+
+	if l.redis != nil {
+		n, err := l.redis.IncrWindow("ipviol:"+scope+":"+ip, l.cfg.BlockWindow)
+		if err == nil {
+			if n != int64(l.cfg.BlockAfter) {
+				return false
+			}
+			if err := l.redis.SetFlag("ipblock:"+ip, l.cfg.BlockFor); err == nil {
+				return true
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	key := scope + ":" + ip
+	recent := l.violations[key][:0]
+	for _, t := range l.violations[key] {
+		if now.Sub(t) < l.cfg.BlockWindow {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	l.violations[key] = recent
+	if len(recent) < l.cfg.BlockAfter {
+		return false
+	}
+	delete(l.violations, key)
+	l.blocked[ip] = now.Add(l.cfg.BlockFor)
+	return true
+}
+
+func (l *IPLimiter) blockedFor(ip string) time.Duration {
+	if l.redis != nil {
+		if ttl, err := l.redis.FlagTTL("ipblock:" + ip); err == nil && ttl > 0 {
+			return ttl
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until, ok := l.blocked[ip]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(until); remaining > 0 {
+		return remaining
+	}
+	delete(l.blocked, ip)
+	return 0
+}
+
+// Cleanup periodically drops expired local state
+func (l *IPLimiter) Cleanup() {
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			l.mu.Lock()
+			now := time.Now()
+			for ip, until := range l.blocked {
+				if now.After(until) {
+					delete(l.blocked, ip)
+				}
+			}
+			for key, times := range l.violations {
+				if len(times) == 0 || now.Sub(times[len(times)-1]) > l.cfg.BlockWindow {
+					delete(l.violations, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}()
+	l.buckets.Cleanup()
+}
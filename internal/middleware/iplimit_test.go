@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/ratelimit"
+)
+
+func ipRouter(l *IPLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetTrustedProxies([]string{"10.0.0.1"})
+	r.GET("/", l.Limit(IPScopeAuth), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func hitFrom(r *gin.Engine, remote, forwarded string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remote + ":1234"
+	if forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIPLimiterBlocksAfterRepeatedViolations(t *testing.T) {
+	l := NewIPLimiter(nil, IPLimiterConfig{
+		Policies:    map[string]ratelimit.Policy{IPScopeAuth: {Rate: 0.001, Burst: 1}},
+		BlockAfter:  2,
+		BlockWindow: time.Minute,
+		BlockFor:    time.Minute,
+	})
+	r := ipRouter(l)
+
+	if w := hitFrom(r, "192.0.2.1", ""); w.Code != http.StatusOK {
+		t.Fatalf("first request: %d", w.Code)
+	}
+	for i := 0; i < 2; i++ {
+		if w := hitFrom(r, "192.0.2.1", ""); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("violation %d: %d", i, w.Code)
+		}
+	}
+	w := hitFrom(r, "192.0.2.1", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("blocked IP should get 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+
+	if w := hitFrom(r, "192.0.2.2", ""); w.Code != http.StatusOK {
+		t.Fatalf("other IPs are unaffected, got %d", w.Code)
+	}
+}
+
+func TestIPLimiterHonoursOnlyTrustedProxies(t *testing.T) {
+	l := NewIPLimiter(nil, IPLimiterConfig{
+		Policies: map[string]ratelimit.Policy{IPScopeAuth: {Rate: 0.001, Burst: 1}},
+	})
+	r := ipRouter(l)
+
+	// an untrusted client cannot dodge the limit by rotating X-Forwarded-For
+	hitFrom(r, "192.0.2.9", "198.51.100.1")
+	if w := hitFrom(r, "192.0.2.9", "198.51.100.2"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For should be ignored, got %d", w.Code)
+	}
+
+	// behind the trusted proxy, each forwarded client gets its own bucket
+	if w := hitFrom(r, "10.0.0.1", "198.51.100.3"); w.Code != http.StatusOK {
+		t.Fatalf("first forwarded client: %d", w.Code)
+	}
+	if w := hitFrom(r, "10.0.0.1", "198.51.100.4"); w.Code != http.StatusOK {
+		t.Fatalf("second forwarded client: %d", w.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+)
+
+var loginLockouts = metrics.Default.NewCounterVec(
+	"tullo_login_lockouts_total",
+	"Lockouts issued after repeated failed logins, by what was locked (email or ip).",
+	"kind",
+)
+
+// LoginLockoutConfig configures LoginLockout. Once an email address or
+// client IP reaches its attempt limit, each further failed login locks it
+// for Base, doubled for every failure past the limit, up to Max. Failures
+// are forgotten Window after the last one. A limit of 0 disables that kind.
+type LoginLockoutConfig struct {
+	EmailAttempts int
+	IPAttempts    int
+	Window        time.Duration
+	Base          time.Duration
+	Max           time.Duration
+}
+
+// lockoutFor returns how long the failures-th failure locks a key whose
+// attempt limit is limit, or 0 while it is below the limit
+func (cfg LoginLockoutConfig) lockoutFor(failures, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+	d := cfg.Base
+	for i := limit; i < failures && d < cfg.Max; i++ {
+		d *= 2
+	}
+	return min(d, cfg.Max)
+}
+
+// LoginLockout tracks failed logins per email address and per client IP and
+// locks out those that keep failing. State lives in Redis so lockouts hold
+// across instances; without Redis (or when it errors) it is kept in process.
+type LoginLockout struct {
+	redis *cache.RedisClient
+	cfg   LoginLockoutConfig
+
+	mu    sync.Mutex
+	local map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count  int
+	last   time.Time
+	locked time.Time
+}
+
+func NewLoginLockout(redis *cache.RedisClient, cfg LoginLockoutConfig) *LoginLockout {
+	return &LoginLockout{redis: redis, cfg: cfg, local: make(map[string]*loginFailures)}
+}
+
+func emailLockKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// Locked returns how much longer logins for email or from ip are locked
+// out, or 0 if neither is
+func (l *LoginLockout) Locked(email, ip string) time.Duration {
+	return max(l.lockedFor(emailLockKey(email)), l.lockedFor("ip:"+ip))
+}
+
+// Fail records a failed login for email from ip and returns the lockout it
+// issued, or 0 if it issued none
+func (l *LoginLockout) Fail(email, ip string) time.Duration {
+	return max(
+		l.fail("email", emailLockKey(email), l.cfg.EmailAttempts),
+		l.fail("ip", "ip:"+ip, l.cfg.IPAttempts),
+	)
+}
+
+// Reset forgets the failed logins for email after a successful one. The
+// client IP's failures stand, so one good account cannot clear the way to
+// guessing others.
+func (l *LoginLockout) Reset(email string) {
+	key := emailLockKey(email)
+	if l.redis != nil {
+		if err := l.redis.Delete("loginfail:"+key, "loginlock:"+key); err != nil {
+			log.Printf("Login lockout: Redis error: %v", err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.local, key)
+}
+
+func (l *LoginLockout) fail(kind, key string, limit int) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+
+	if l.redis != nil {
+		n, err := l.redis.IncrExpire("loginfail:"+key, l.cfg.Window)
+		if err == nil {
+			d := l.cfg.lockoutFor(int(n), limit)
+			if d == 0 {
+				return 0
+			}
+			if err = l.redis.SetFlag("loginlock:"+key, d); err == nil {
+				loginLockouts.Inc(kind)
+				return d
+			}
+		}
+		log.Printf("Login lockout: Redis error, using local state: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	f, ok := l.local[key]
+	if !ok || now.Sub(f.last) >= l.cfg.Window {
+		f = &loginFailures{}
+		l.local[key] = f
+	}
+	f.count++
+	f.last = now
+	d := l.cfg.lockoutFor(f.count, limit)
+	if d > 0 {
+		f.locked = now.Add(d)
+		loginLockouts.Inc(kind)
+	}
+	return d
+}
+
+func (l *LoginLockout) lockedFor(key string) time.Duration {
+	if l.redis != nil {
+		if ttl, err := l.redis.FlagTTL("loginlock:" + key); err == nil && ttl > 0 {
+			return ttl
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.local[key]; ok {
+		return max(time.Until(f.locked), 0)
+	}
+	return 0
+}
+
+// Cleanup periodically drops forgotten local failures
+func (l *LoginLockout) Cleanup() {
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			l.mu.Lock()
+			now := time.Now()
+			for key, f := range l.local {
+				if now.Sub(f.last) >= l.cfg.Window && now.After(f.locked) {
+					delete(l.local, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutForDoublesUpToMax(t *testing.T) {
+	cfg := LoginLockoutConfig{Base: 30 * time.Second, Max: 5 * time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{8, 4 * time.Minute},
+		{9, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := cfg.lockoutFor(tt.failures, 5); got != tt.want {
+			t.Errorf("lockoutFor(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+	if got := cfg.lockoutFor(100, 0); got != 0 {
+		t.Errorf("disabled limit locked for %s", got)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	l := NewLoginLockout(nil, LoginLockoutConfig{
+		EmailAttempts: 2,
+		IPAttempts:    3,
+		Window:        time.Hour,
+		Base:          time.Minute,
+		Max:           time.Hour,
+	})
+
+	if d := l.Fail("Victim@example.com", "192.0.2.1"); d != 0 {
+		t.Fatalf("first failure locked for %s", d)
+	}
+	if d := l.Fail("victim@example.com ", "192.0.2.2"); d != time.Minute {
+		t.Fatalf("second failure locked for %s, want 1m", d)
+	}
+	if d := l.Locked("VICTIM@example.com", "198.51.100.1"); d <= 0 {
+		t.Fatal("email should be locked from any IP")
+	}
+	if d := l.Locked("other@example.com", "192.0.2.1"); d != 0 {
+		t.Fatalf("other emails from the IP locked for %s", d)
+	}
+
+	// The IP keeps its failures when a login succeeds
+	l.Reset("victim@example.com")
+	if d := l.Locked("victim@example.com", "192.0.2.9"); d != 0 {
+		t.Fatalf("email still locked after reset: %s", d)
+	}
+	l.Fail("a@example.com", "192.0.2.9")
+	l.Fail("b@example.com", "192.0.2.9")
+	l.Reset("b@example.com")
+	if d := l.Fail("c@example.com", "192.0.2.9"); d != time.Minute {
+		t.Fatalf("third failure from the IP locked for %s, want 1m", d)
+	}
+	if d := l.Locked("d@example.com", "192.0.2.9"); d <= 0 {
+		t.Fatal("IP should be locked for every email")
+	}
+}
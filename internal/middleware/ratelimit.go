@@ -1,77 +1,82 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"golang.org/x/time/rate"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/ratelimit"
 )
 
+// Rate limit policy names used by the router
+const (
+	PolicyAuth          = "auth"
+	PolicyMessageSend   = "message_send"
+	PolicyChannelCreate = "channel_create"
+	PolicyFollow        = "follow"
+	PolicyAnalytics     = "analytics"
+	PolicyTranslate     = "translate"
+)
+
+// RateLimiter keeps one token bucket per (policy, caller) pair, so each named
+// policy is limited independently. Buckets live in Redis when it is
+// available (see ratelimit.Buckets).
 type RateLimiter struct {
-	limiters map[uuid.UUID]*rate.Limiter
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
+	buckets  *ratelimit.Buckets
+	policies map[string]ratelimit.Policy
 }
 
-func NewRateLimiter(rps int) *RateLimiter {
-	return &RateLimiter{
-		limiters: make(map[uuid.UUID]*rate.Limiter),
-		rate:     rate.Limit(rps),
-		burst:    rps * 2,
-	}
+func NewRateLimiter(redis *cache.RedisClient, policies map[string]ratelimit.Policy) *RateLimiter {
+	return &RateLimiter{buckets: ratelimit.New(redis, "rl:"), policies: policies}
 }
 
-func (rl *RateLimiter) getLimiter(userID uuid.UUID) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	limiter, exists := rl.limiters[userID]
-	if !exists {
-		limiter = rate.NewLimiter(rl.rate, rl.burst)
-		rl.limiters[userID] = limiter
+// WriteRateLimitHeaders emits X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (seconds until the bucket is full), plus Retry-After when
+// the request was rejected
+func WriteRateLimitHeaders(c *gin.Context, res cache.LimitResult) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
 	}
+}
 
-	return limiter
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
 
-// Cleanup removes old limiters
+// Cleanup periodically drops idle local buckets (see ratelimit.IdleTTL)
 func (rl *RateLimiter) Cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	go func() {
-		for range ticker.C {
-			rl.mu.Lock()
-			// Simple cleanup - in production, track last access time
-			if len(rl.limiters) > 10000 {
-				rl.limiters = make(map[uuid.UUID]*rate.Limiter)
-			}
-			rl.mu.Unlock()
-		}
-	}()
+	rl.buckets.Cleanup()
 }
 
-// RateLimitMiddleware limits requests per user
-func RateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
-			c.Next()
-			return
-		}
+// Limit applies the named policy. Authenticated callers are limited per user;
+// anonymous callers (e.g. /auth/login) per client IP. An unknown or zero-rate
+// policy lets every request through.
+func (rl *RateLimiter) Limit(policy string) gin.HandlerFunc {
+	p, ok := rl.policies[policy]
+	if !ok || p.Rate <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
 
-		uid, ok := userID.(uuid.UUID)
-		if !ok {
-			c.Next()
-			return
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if userID, exists := c.Get("user_id"); exists {
+			if uid, ok := userID.(uuid.UUID); ok {
+				key = "user:" + uid.String()
+			}
 		}
 
-		limiter := rl.getLimiter(uid)
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
-			c.Abort()
+		res := rl.buckets.Allow(policy+":"+key, p)
+		WriteRateLimitHeaders(c, res)
+		if !res.Allowed {
+			apierror.Abort(c, http.StatusTooManyRequests, apierror.RateLimited, "Rate limit exceeded")
 			return
 		}
 
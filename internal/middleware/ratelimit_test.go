@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/ratelimit"
+)
+
+func newLimitedRouter(rl *RateLimiter, policy string, uid uuid.UUID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if uid != uuid.Nil {
+			c.Set("user_id", uid)
+		}
+	})
+	r.GET("/", rl.Limit(policy), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func hit(r *gin.Engine) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w.Code
+}
+
+func TestPoliciesAreIndependent(t *testing.T) {
+	rl := NewRateLimiter(nil, map[string]ratelimit.Policy{
+		PolicyFollow:        {Rate: 0.001, Burst: 1},
+		PolicyChannelCreate: {Rate: 0.001, Burst: 2},
+	})
+	uid := uuid.New()
+	follow := newLimitedRouter(rl, PolicyFollow, uid)
+	create := newLimitedRouter(rl, PolicyChannelCreate, uid)
+
+	if hit(follow) != http.StatusOK || hit(follow) != http.StatusTooManyRequests {
+		t.Fatal("follow policy should allow a burst of 1")
+	}
+	if hit(create) != http.StatusOK || hit(create) != http.StatusOK || hit(create) != http.StatusTooManyRequests {
+		t.Fatal("channel_create policy should allow a burst of 2 regardless of follow")
+	}
+}
+
+func TestUsersAreLimitedSeparately(t *testing.T) {
+	rl := NewRateLimiter(nil, map[string]ratelimit.Policy{PolicyMessageSend: {Rate: 0.001, Burst: 1}})
+	a := newLimitedRouter(rl, PolicyMessageSend, uuid.New())
+	b := newLimitedRouter(rl, PolicyMessageSend, uuid.New())
+
+	if hit(a) != http.StatusOK || hit(a) != http.StatusTooManyRequests {
+		t.Fatal("user a should be limited")
+	}
+	if hit(b) != http.StatusOK {
+		t.Fatal("user b should have its own bucket")
+	}
+}
+
+func TestAnonymousCallersKeyedByIP(t *testing.T) {
+	rl := NewRateLimiter(nil, map[string]ratelimit.Policy{PolicyAuth: {Rate: 0.001, Burst: 1}})
+	r := newLimitedRouter(rl, PolicyAuth, uuid.Nil)
+	if hit(r) != http.StatusOK || hit(r) != http.StatusTooManyRequests {
+		t.Fatal("anonymous requests from one IP should share a bucket")
+	}
+}
+
+func TestUnknownPolicyAllowsAll(t *testing.T) {
+	rl := NewRateLimiter(nil, nil)
+	r := newLimitedRouter(rl, "missing", uuid.New())
+	for i := 0; i < 5; i++ {
+		if hit(r) != http.StatusOK {
+			t.Fatal("unknown policy should not limit")
+		}
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	rl := NewRateLimiter(nil, map[string]ratelimit.Policy{PolicyFollow: {Rate: 0.5, Burst: 2}})
+	r := newLimitedRouter(rl, PolicyFollow, uuid.New())
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	w := get()
+	if w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Remaining") != "1" {
+		t.Fatalf("unexpected quota headers: %v", w.Header())
+	}
+	if w.Header().Get("X-RateLimit-Reset") != "2" || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("allowed request should report reset only: %v", w.Header())
+	}
+
+	get()
+	w = get()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected 429 with no quota left, got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Retry-After") != "2" || w.Header().Get("X-RateLimit-Reset") != "4" {
+		t.Fatalf("unexpected back-off headers: %v", w.Header())
+	}
+}
+
+func TestSendLimiterPerConversationAndKind(t *testing.T) {
+	l := NewSendLimiter(nil, map[string]ratelimit.Policy{
+		models.ConversationDirect: {Rate: 0.001, Burst: 2},
+		models.ConversationGroup:  {Rate: 0.001, Burst: 1},
+	})
+	user, dm, group, other := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	for i := 0; i < 2; i++ {
+		if !l.Allow(models.ConversationDirect, dm, user).Allowed {
+			t.Fatalf("direct message %d rejected within burst", i)
+		}
+	}
+	if l.Allow(models.ConversationDirect, dm, user).Allowed {
+		t.Error("direct message over burst allowed")
+	}
+	if !l.Allow(models.ConversationGroup, group, user).Allowed {
+		t.Error("group budget should be separate from the DM's")
+	}
+	if l.Allow(models.ConversationGroup, group, user).Allowed {
+		t.Error("group message over burst allowed")
+	}
+	if !l.Allow(models.ConversationGroup, other, user).Allowed {
+		t.Error("each conversation should have its own budget")
+	}
+	for i := 0; i < 5; i++ {
+		if !l.Allow(models.ConversationChannel, other, user).Allowed {
+			t.Fatal("kinds without a policy should not be limited")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/ratelimit"
+)
+
+// SendLimiter limits how fast each user sends messages into each
+// conversation, with a separate policy per conversation kind
+// (models.ConversationDirect, Group and Channel). It is shared by the REST
+// and WebSocket send paths, and its state lives in Redis so the budget holds
+// across both and across instances; without Redis (or when it errors)
+// in-process buckets are used instead.
+type SendLimiter struct {
+	buckets  *ratelimit.Buckets
+	policies map[string]ratelimit.Policy
+}
+
+func NewSendLimiter(redis *cache.RedisClient, policies map[string]ratelimit.Policy) *SendLimiter {
+	return &SendLimiter{buckets: ratelimit.New(redis, "sendrl:"), policies: policies}
+}
+
+// Allow spends one message by userID into the conversation, whose kind
+// selects the policy. Kinds without a policy, or with a zero rate, are not
+// limited.
+func (l *SendLimiter) Allow(kind string, conversationID, userID uuid.UUID) cache.LimitResult {
+	p, ok := l.policies[kind]
+	if !ok {
+		return cache.LimitResult{Allowed: true}
+	}
+	return l.buckets.Allow(conversationID.String()+":"+userID.String(), p)
+}
+
+// Cleanup periodically drops idle local buckets (see ratelimit.IdleTTL)
+func (l *SendLimiter) Cleanup() {
+	l.buckets.Cleanup()
+}
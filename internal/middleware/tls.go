@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HSTS sets Strict-Transport-Security on responses served over TLS. It is a
+// no-op for plain HTTP requests, which browsers would ignore anyway.
+func HSTS(maxAgeSec int, includeSubdomains bool) gin.HandlerFunc {
+	value := "max-age=" + strconv.Itoa(maxAgeSec)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", value)
+		}
+		c.Next()
+	}
+}
+
+// HTTPSRedirect permanently redirects every request to the same host and
+// path over HTTPS on httpsPort (omitted from the URL when it is 443).
+func HTTPSRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		// 308 keeps the method and body for non-GET requests
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHSTS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(HSTS(600, true))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("plain HTTP got Strict-Transport-Security %q", got)
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=600; includeSubDomains" {
+		t.Errorf("Strict-Transport-Security = %q", got)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		port, method, target string
+		wantStatus           int
+		wantLocation         string
+	}{
+		{"443", http.MethodGet, "http://tullo.tv:80/api/v1/me?x=1", http.StatusMovedPermanently, "https://tullo.tv/api/v1/me?x=1"},
+		{"8443", http.MethodGet, "http://localhost:8080/health", http.StatusMovedPermanently, "https://localhost:8443/health"},
+		{"443", http.MethodPost, "http://tullo.tv/auth/login", http.StatusPermanentRedirect, "https://tullo.tv/auth/login"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		w := httptest.NewRecorder()
+		HTTPSRedirect(tt.port).ServeHTTP(w, req)
+		if w.Code != tt.wantStatus || w.Header().Get("Location") != tt.wantLocation {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.target, w.Code, w.Header().Get("Location"), tt.wantStatus, tt.wantLocation)
+		}
+	}
+}
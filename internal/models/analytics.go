@@ -0,0 +1,190 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Client analytics event types, reported by players and chat clients
+const (
+	AnalyticsPlayerStart   = "player.start"
+	AnalyticsPlayerStop    = "player.stop"
+	AnalyticsQualitySwitch = "quality.switch"
+	AnalyticsChatOpen      = "chat.open"
+)
+
+// Limits on what clients may report
+const (
+	// AnalyticsMaxAge is how far in the past an event may have occurred, so
+	// clients can flush what they queued while offline
+	AnalyticsMaxAge = 24 * time.Hour
+	// AnalyticsMaxSkew is how far ahead of the server a client clock may be
+	AnalyticsMaxSkew = 5 * time.Minute
+	// analyticsMaxString is the longest string property
+	analyticsMaxString = 100
+)
+
+// Property kinds, named after the JSON types
+const (
+	propString = "string"
+	propNumber = "number"
+	propBool   = "boolean"
+)
+
+type analyticsProperty struct {
+	kind     string
+	required bool
+}
+
+// analyticsSchemas lists the properties each event type may carry; any other
+// property is rejected
+var analyticsSchemas = map[string]map[string]analyticsProperty{
+	AnalyticsPlayerStart: {
+		"quality":          {kind: propString},
+		"position_seconds": {kind: propNumber},
+	},
+	AnalyticsPlayerStop: {
+		"watched_seconds":  {kind: propNumber, required: true},
+		"position_seconds": {kind: propNumber},
+		"reason":           {kind: propString},
+	},
+	AnalyticsQualitySwitch: {
+		"from": {kind: propString, required: true},
+		"to":   {kind: propString, required: true},
+		"auto": {kind: propBool},
+	},
+	AnalyticsChatOpen: {},
+}
+
+// AnalyticsEventInput is one event in a POST /api/v1/analytics/events batch
+type AnalyticsEventInput struct {
+	Type      string     `json:"type" binding:"required"`
+	ChannelID uuid.UUID  `json:"channel_id" binding:"required"`
+	StreamID  *uuid.UUID `json:"stream_id"`
+	// OccurredAt defaults to when the batch is received
+	OccurredAt *time.Time             `json:"occurred_at"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// IngestAnalyticsRequest is a batch of up to 100 client analytics events
+type IngestAnalyticsRequest struct {
+	Events []AnalyticsEventInput `json:"events" binding:"required,min=1,max=100,dive"`
+}
+
+// IngestAnalyticsResponse counts the events stored and those dropped because
+// their channel or stream does not exist
+type IngestAnalyticsResponse struct {
+	Accepted int `json:"accepted"`
+	Dropped  int `json:"dropped"`
+}
+
+// AnalyticsEvent is a validated client event as stored
+type AnalyticsEvent struct {
+	Type       string                 `json:"type"`
+	ChannelID  uuid.UUID              `json:"channel_id"`
+	StreamID   *uuid.UUID             `json:"stream_id,omitempty"`
+	UserID     *uuid.UUID             `json:"user_id,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	ReceivedAt time.Time              `json:"received_at"`
+}
+
+// AnalyticsFieldError is a schema rule an analytics event breaks. Field is
+// relative to the event, Rule and Param follow the validator's tags.
+type AnalyticsFieldError struct {
+	Field string
+	Rule  string
+	Param string
+}
+
+func (e *AnalyticsFieldError) Error() string {
+	if e.Param != "" {
+		return e.Field + " fails " + e.Rule + "=" + e.Param
+	}
+	return e.Field + " fails " + e.Rule
+}
+
+// Validate checks the event against its type's schema and returns it ready
+// to store, received at now
+func (in *AnalyticsEventInput) Validate(now time.Time) (*AnalyticsEvent, error) {
+	schema, ok := analyticsSchemas[in.Type]
+	if !ok {
+		return nil, &AnalyticsFieldError{Field: "type", Rule: "oneof"}
+	}
+
+	occurredAt := now
+	if in.OccurredAt != nil {
+		occurredAt = *in.OccurredAt
+		if occurredAt.Before(now.Add(-AnalyticsMaxAge)) || occurredAt.After(now.Add(AnalyticsMaxSkew)) {
+			return nil, &AnalyticsFieldError{Field: "occurred_at", Rule: "range"}
+		}
+	}
+
+	props := make(map[string]interface{}, len(in.Properties))
+	for name, value := range in.Properties {
+		p, ok := schema[name]
+		if !ok {
+			return nil, &AnalyticsFieldError{Field: "properties." + name, Rule: "unknown"}
+		}
+		if err := p.check(value); err != "" {
+			return nil, &AnalyticsFieldError{Field: "properties." + name, Rule: err, Param: p.param(err)}
+		}
+		props[name] = value
+	}
+	for name, p := range schema {
+		if _, ok := props[name]; p.required && !ok {
+			return nil, &AnalyticsFieldError{Field: "properties." + name, Rule: "required"}
+		}
+	}
+
+	return &AnalyticsEvent{
+		Type:       in.Type,
+		ChannelID:  in.ChannelID,
+		StreamID:   in.StreamID,
+		Properties: props,
+		OccurredAt: occurredAt.UTC(),
+		ReceivedAt: now.UTC(),
+	}, nil
+}
+
+// check returns the rule value breaks, if any
+func (p analyticsProperty) check(value interface{}) string {
+	switch p.kind {
+	case propString:
+		s, ok := value.(string)
+		if !ok {
+			return "type"
+		}
+		if len(s) > analyticsMaxString {
+			return "max"
+		}
+	case propNumber:
+		n, ok := value.(float64)
+		if !ok {
+			return "type"
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) || n < 0 {
+			return "min"
+		}
+	case propBool:
+		if _, ok := value.(bool); !ok {
+			return "type"
+		}
+	}
+	return ""
+}
+
+func (p analyticsProperty) param(rule string) string {
+	switch rule {
+	case "type":
+		return p.kind
+	case "max":
+		return strconv.Itoa(analyticsMaxString)
+	case "min":
+		return "0"
+	}
+	return ""
+}
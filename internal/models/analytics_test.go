@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAnalyticsEventValidate(t *testing.T) {
+	now := time.Date(2025, 10, 25, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	stale := now.Add(-25 * time.Hour)
+	ahead := now.Add(10 * time.Minute)
+
+	tests := []struct {
+		name  string
+		in    AnalyticsEventInput
+		field string
+		rule  string
+	}{
+		{"chat open", AnalyticsEventInput{Type: AnalyticsChatOpen}, "", ""},
+		{"queued while offline", AnalyticsEventInput{Type: AnalyticsChatOpen, OccurredAt: &past}, "", ""},
+		{"quality switch", AnalyticsEventInput{Type: AnalyticsQualitySwitch, Properties: map[string]interface{}{"from": "1080p", "to": "720p", "auto": true}}, "", ""},
+		{"unknown type", AnalyticsEventInput{Type: "player.pause"}, "type", "oneof"},
+		{"too old", AnalyticsEventInput{Type: AnalyticsChatOpen, OccurredAt: &stale}, "occurred_at", "range"},
+		{"from the future", AnalyticsEventInput{Type: AnalyticsChatOpen, OccurredAt: &ahead}, "occurred_at", "range"},
+		{"unknown property", AnalyticsEventInput{Type: AnalyticsChatOpen, Properties: map[string]interface{}{"tab": "chat"}}, "properties.tab", "unknown"},
+		{"missing required", AnalyticsEventInput{Type: AnalyticsQualitySwitch, Properties: map[string]interface{}{"from": "1080p"}}, "properties.to", "required"},
+		{"wrong type", AnalyticsEventInput{Type: AnalyticsPlayerStop, Properties: map[string]interface{}{"watched_seconds": "90"}}, "properties.watched_seconds", "type"},
+		{"negative number", AnalyticsEventInput{Type: AnalyticsPlayerStop, Properties: map[string]interface{}{"watched_seconds": -1.0}}, "properties.watched_seconds", "min"},
+		{"long string", AnalyticsEventInput{Type: AnalyticsPlayerStart, Properties: map[string]interface{}{"quality": strings.Repeat("p", 101)}}, "properties.quality", "max"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.in.ChannelID = uuid.New()
+			e, err := tt.in.Validate(now)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate err = %v", err)
+				}
+				if e.ChannelID != tt.in.ChannelID || e.ReceivedAt != now {
+					t.Errorf("Validate = %+v", e)
+				}
+				return
+			}
+			var fe *AnalyticsFieldError
+			if !errors.As(err, &fe) || fe.Field != tt.field || fe.Rule != tt.rule {
+				t.Errorf("Validate err = %v, want %s fails %s", err, tt.field, tt.rule)
+			}
+		})
+	}
+
+	// occurred_at defaults to when the batch arrives
+	e, err := (&AnalyticsEventInput{Type: AnalyticsChatOpen}).Validate(now)
+	if err != nil || !e.OccurredAt.Equal(now) {
+		t.Errorf("default occurred_at = %v, %v; want %v", e.OccurredAt, err, now)
+	}
+}
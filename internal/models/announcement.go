@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Announcement audiences
+const (
+	AudienceAll       = "all"
+	AudienceStreamers = "streamers"
+)
+
+// Announcement is a platform-wide notice from admins, e.g. a maintenance
+// window or a policy change. It is sent as a system.announcement event at
+// PublishAt and listed in-app until ExpiresAt. Streamers are users owning a
+// channel.
+type Announcement struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	Title       string     `json:"title" db:"title"`
+	Body        string     `json:"body" db:"body"`
+	Audience    string     `json:"audience" db:"audience"`
+	PublishAt   time.Time  `json:"publish_at" db:"publish_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty" db:"published_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateAnnouncementRequest is the body of POST /admin/announcements. Without
+// publish_at the announcement goes out at once; audience defaults to all.
+type CreateAnnouncementRequest struct {
+	Title     string     `json:"title" binding:"required,max=200"`
+	Body      string     `json:"body" binding:"required,max=5000"`
+	Audience  string     `json:"audience" binding:"omitempty,oneof=all streamers"`
+	PublishAt *time.Time `json:"publish_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API key scopes. read allows GET requests, write everything else, and
+// moderate additionally unlocks moderation and admin endpoints.
+const (
+	ScopeRead     = "read"
+	ScopeWrite    = "write"
+	ScopeModerate = "moderate"
+)
+
+// APIKey lets a bot or integration act as its owner without a login. Only a
+// hash of the key is stored; Hint is the start of the key, for telling keys
+// apart.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Hint       string     `json:"hint" db:"hint"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	// OwnerRole is the owner's platform role, set by Authenticate
+	OwnerRole string `json:"-" db:"-"`
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest is the body of POST /keys; keys without
+// expires_in_days never expire
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,oneof=read write moderate"`
+	ExpiresInDays *int     `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=3650"`
+}
+
+// CreateAPIKeyResponse carries the new key. Key is shown only here.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// UpdateAPIKeyRequest renames a key or changes its scopes
+type UpdateAPIKeyRequest struct {
+	Name   *string  `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Scopes []string `json:"scopes,omitempty" binding:"omitempty,min=1,dive,oneof=read write moderate"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// Image scales: 1x is the size shown in a line of chat, 2x and 4x are for
+// denser screens
+const (
+	ImageScale1x = "1x"
+	ImageScale2x = "2x"
+	ImageScale4x = "4x"
+)
+
+// ImageVariants maps an image scale to the URL of the image at that scale.
+// 1x is always present; clients fall back to it for missing scales.
+type ImageVariants map[string]string
+
+// Asset is a stored image, addressed by the SHA-256 of its content so its
+// URL never changes what it serves
+type Asset struct {
+	Hash        string
+	ContentType string
+	Data        []byte
+}
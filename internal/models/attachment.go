@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is a file stored for a conversation. Its size counts towards
+// the conversation's storage quota until it expires.
+type Attachment struct {
+	ID             uuid.UUID `json:"id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	// MessageID is the message the file was sent with, if any. Messages may
+	// be archived, so it is not a foreign key.
+	MessageID   *uuid.UUID `json:"message_id,omitempty"`
+	UploaderID  *uuid.UUID `json:"uploader_id,omitempty"`
+	StorageKey  string     `json:"-"`
+	ContentType string     `json:"content_type"`
+	SizeBytes   int64      `json:"size_bytes"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// StorageUsage is how much of its attachment quota a conversation uses
+type StorageUsage struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Attachments    int       `json:"attachments"`
+	UsedBytes      int64     `json:"used_bytes"`
+	// QuotaBytes is 0 when the quota is off
+	QuotaBytes int64 `json:"quota_bytes"`
+	// RetentionDays is how long attachments are kept, 0 for ever;
+	// NextExpiry is when the oldest one expires
+	RetentionDays int        `json:"retention_days"`
+	NextExpiry    *time.Time `json:"next_expiry,omitempty"`
+}
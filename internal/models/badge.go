@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChannelBadge is the image a channel shows next to the name of a chatter
+// with Role in its chat: ChannelRoleOwner, ChannelRoleModerator or
+// ChannelRoleVIP
+type ChannelBadge struct {
+	ChannelID uuid.UUID     `json:"channel_id" db:"channel_id"`
+	Role      string        `json:"role" db:"role"`
+	Images    ImageVariants `json:"images" db:"images"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// ChatBadge is the badge shown next to the sender of a channel chat message
+type ChatBadge struct {
+	Role   string        `json:"role"`
+	Images ImageVariants `json:"images"`
+}
+
+// PutBadgeRequest is the body of PUT /channels/:slug/badges/:role: the
+// image at each scale, base64 encoded. 1x is required.
+type PutBadgeRequest struct {
+	Images map[string][]byte `json:"images" binding:"required"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BotScore is how much a user's recent messages in a channel's chat look
+// like a bot's, as rated by the moderation bot (see package botscore)
+type BotScore struct {
+	UserID      uuid.UUID `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	Username    *string   `json:"username,omitempty"`
+	AvatarURL   *string   `json:"avatar_url,omitempty"`
+	// Score is the overall suspicion, from 0 (human) to 1 (bot)
+	Score float64 `json:"score"`
+	// Entropy is the mean bits per character of the user's messages
+	Entropy float64 `json:"entropy"`
+	// Regularity is how evenly spaced the messages were, from 0 to 1
+	Regularity float64 `json:"regularity"`
+	// Duplicates is the share of messages also posted to other chats
+	Duplicates float64 `json:"duplicates"`
+	// Messages is the number of recent messages rated
+	Messages  int       `json:"messages"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListBotScoresRequest is the query of GET /channels/:slug/bot-scores
+type ListBotScoresRequest struct {
+	MinScore float64 `form:"min_score" binding:"min=0,max=1"`
+	Limit    int     `form:"limit" binding:"omitempty,min=1,max=100"`
+}
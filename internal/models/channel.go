@@ -14,8 +14,67 @@ type Channel struct {
 	Description *string   `json:"description,omitempty" db:"description"`
 	Language    *string   `json:"language,omitempty" db:"language"`
 	Tags        []string  `json:"tags,omitempty" db:"tags"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	// ChatRules are pinned above the channel's chat. They are only loaded
+	// when a single channel is read by slug.
+	ChatRules *string `json:"chat_rules,omitempty" db:"chat_rules"`
+	// FollowAlerts sends the owner channel.followed events. Like ChatRules
+	// it is only loaded when a single channel is read by slug.
+	FollowAlerts *bool `json:"follow_alerts,omitempty" db:"follow_alerts"`
+	// ChatFormatting renders Markdown in new chat messages; it is loaded
+	// like ChatRules
+	ChatFormatting *bool      `json:"chat_formatting,omitempty" db:"-"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	Version        int        `json:"version" db:"version"`
+	// ChatRetentionDays and ChatRetentionAction are the chat's message
+	// retention (see Conversation.RetentionDays), loaded like ChatRules
+	ChatRetentionDays   *int    `json:"chat_retention_days,omitempty" db:"-"`
+	ChatRetentionAction *string `json:"chat_retention_action,omitempty" db:"-"`
+	// ChatMaxLength is the most characters a chat message may have and
+	// ChatMaxEmotes the most emotes, 0 for no limit beyond the global one;
+	// loaded like ChatRules
+	ChatMaxLength *int `json:"chat_max_length,omitempty" db:"-"`
+	ChatMaxEmotes *int `json:"chat_max_emotes,omitempty" db:"-"`
+}
+
+// Roles of the caller in a channel, as reported on the channel page. They
+// are checked in this order: the owner is never reported banned, and a
+// banned moderator is reported banned.
+const (
+	ChannelRoleOwner     = "owner"
+	ChannelRoleBanned    = "banned"
+	ChannelRoleModerator = "moderator"
+	ChannelRoleVIP       = "vip"
+	ChannelRoleViewer    = "viewer"
+)
+
+// ChannelPage is everything the channel page shows, returned by
+// GET /channels/:slug in one response
+type ChannelPage struct {
+	Channel Channel `json:"channel"`
+	// Stream is the channel's latest stream, live or not. The ingest URL and
+	// stream key are only included for the owner.
+	Stream *Stream `json:"stream"`
+	Live   bool    `json:"live"`
+	// Viewers counts users who loaded the chat or whose player sent a
+	// heartbeat within the last two minutes; ChatViewers those with the chat
+	// open over WebSocket
+	Viewers     int    `json:"viewers"`
+	ChatViewers int    `json:"chat_viewers"`
+	Followers   int    `json:"followers"`
+	Following   bool   `json:"following"`
+	Role        string `json:"role"`
+}
+
+// ChannelCallerStats holds a channel's follower count and the caller's
+// standing in it, loaded in one query for the channel page
+type ChannelCallerStats struct {
+	Followers int
+	Following bool
+	// MemberRole is the caller's role in the channel chat, "" if not a member
+	MemberRole string
+	Banned     bool
 }
 
 type CreateChannelRequest struct {
@@ -25,3 +84,74 @@ type CreateChannelRequest struct {
 	Language    *string  `json:"language,omitempty"`
 	Tags        []string `json:"tags,omitempty"`
 }
+
+// UpdateChannelRequest updates channel metadata; Version must match the current row version
+type UpdateChannelRequest struct {
+	Title       *string   `json:"title,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Language    *string   `json:"language,omitempty"`
+	Tags        *[]string `json:"tags,omitempty"`
+	// ChatRules replaces the pinned chat rules; an empty string removes them
+	ChatRules *string `json:"chat_rules,omitempty" binding:"omitempty,max=2000"`
+	// FollowAlerts turns channel.followed events for the owner on or off
+	FollowAlerts *bool `json:"follow_alerts,omitempty"`
+	// ChatFormatting turns Markdown formatting in the chat on or off
+	ChatFormatting *bool `json:"chat_formatting,omitempty"`
+	Version        int   `json:"version" binding:"required"`
+	// ChatRetentionDays sets how long chat messages are kept (0 for ever),
+	// and ChatRetentionAction whether older ones are deleted or archived
+	ChatRetentionDays   *int    `json:"chat_retention_days,omitempty" binding:"omitempty,min=0,max=3650"`
+	ChatRetentionAction *string `json:"chat_retention_action,omitempty" binding:"omitempty,oneof=delete archive"`
+	// ChatMaxLength and ChatMaxEmotes limit chat messages; 0 lifts a limit
+	ChatMaxLength *int `json:"chat_max_length,omitempty" binding:"omitempty,min=0,max=10000"`
+	ChatMaxEmotes *int `json:"chat_max_emotes,omitempty" binding:"omitempty,min=0,max=1000"`
+}
+
+// Follower is a user following a channel
+type Follower struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   *string   `json:"avatar_url,omitempty"`
+	FollowedAt  time.Time `json:"followed_at"`
+}
+
+// FollowOrigin records where a follow came from, for follow-bot detection.
+// The zero value is a follow by an established account from an unknown IP.
+type FollowOrigin struct {
+	IP      string
+	Network string
+	// NewAccount is set when the follower's account was new at the time
+	NewAccount bool
+}
+
+// FollowBotReport records a burst of follows of one channel by new accounts
+// from one network that the follow-bot sweep removed
+type FollowBotReport struct {
+	ID          uuid.UUID   `json:"id"`
+	ChannelID   uuid.UUID   `json:"channel_id"`
+	ChannelSlug string      `json:"channel_slug"`
+	Network     string      `json:"network"`
+	IPs         []string    `json:"ips"`
+	UserIDs     []uuid.UUID `json:"user_ids"`
+	Removed     int         `json:"removed"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type AssignModeratorRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type AssignVIPRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+}
+
+// BanUserRequest bans a user from channel chat; DurationMin 0 means permanent
+type BanUserRequest struct {
+	DurationMin int    `json:"duration_min"`
+	Reason      string `json:"reason"`
+}
+
+type BannedWordRequest struct {
+	Word string `json:"word"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "github.com/google/uuid"
+
+// ChatThroughput is a chat's activity over a rolling window
+type ChatThroughput struct {
+	WindowSeconds        int     `json:"window_seconds"`
+	MessagesPerSec       float64 `json:"messages_per_sec"`
+	AutomodActionsPerSec float64 `json:"automod_actions_per_sec"`
+	// UniqueChatters counts the distinct senders (approximately; Redis
+	// HyperLogLog)
+	UniqueChatters int `json:"unique_chatters"`
+}
+
+// ChannelChatStats is the chat throughput of a channel over each rolling
+// window, shortest first
+type ChannelChatStats struct {
+	ChannelID uuid.UUID        `json:"channel_id"`
+	Slug      string           `json:"slug"`
+	Windows   []ChatThroughput `json:"windows"`
+}
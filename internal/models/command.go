@@ -0,0 +1,83 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Who may run a chat command, from everyone up to the channel owner. Each
+// level includes those above it.
+const (
+	CommandEveryone  = "everyone"
+	CommandFollower  = "follower"
+	CommandModerator = "moderator"
+	CommandOwner     = "owner"
+)
+
+var commandLevels = map[string]int{CommandEveryone: 0, CommandFollower: 1, CommandModerator: 2, CommandOwner: 3}
+
+// DefaultCommandCooldown is the seconds between two runs of a command unless
+// the channel picks another cooldown
+const DefaultCommandCooldown = 5
+
+// ChannelCommand is a custom chat command: when a message starts with
+// "!"+Name, the moderation bot replies with Response. The response may use
+// {user} (the caller), {channel} (the channel title), {args} (the text after
+// the command) and {count} (how often the command ran, this time included).
+type ChannelCommand struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	ChannelID uuid.UUID `json:"channel_id" db:"channel_id"`
+	Name      string    `json:"name" db:"name"`
+	Response  string    `json:"response" db:"response"`
+	// Permission is the lowest level allowed to run the command
+	Permission  string     `json:"permission" db:"permission"`
+	CooldownSec int        `json:"cooldown_sec" db:"cooldown_sec"`
+	Enabled     bool       `json:"enabled" db:"enabled"`
+	Uses        int64      `json:"uses" db:"uses"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Allows reports whether a caller at level may run the command
+func (c *ChannelCommand) Allows(level string) bool {
+	return commandLevels[level] >= commandLevels[c.Permission]
+}
+
+// Render fills in the response template
+func (c *ChannelCommand) Render(user, channel, args string, count int64) string {
+	return strings.NewReplacer(
+		"{user}", user,
+		"{channel}", channel,
+		"{args}", args,
+		"{count}", strconv.FormatInt(count, 10),
+	).Replace(c.Response)
+}
+
+// CreateCommandRequest adds a command; name is the trigger without "!"
+type CreateCommandRequest struct {
+	Name        string `json:"name" binding:"required,max=32,alphanum,lowercase"`
+	Response    string `json:"response" binding:"required,max=500"`
+	Permission  string `json:"permission" binding:"omitempty,oneof=everyone follower moderator owner"`
+	CooldownSec *int   `json:"cooldown_sec,omitempty" binding:"omitempty,min=0,max=3600"`
+}
+
+// UpdateCommandRequest changes a command; omitted fields are kept
+type UpdateCommandRequest struct {
+	Response    *string `json:"response,omitempty" binding:"omitempty,min=1,max=500"`
+	Permission  *string `json:"permission,omitempty" binding:"omitempty,oneof=everyone follower moderator owner"`
+	CooldownSec *int    `json:"cooldown_sec,omitempty" binding:"omitempty,min=0,max=3600"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+}
+
+// CommandInvocation is a command found for a chat message, with what the bot
+// needs to decide whether and how to answer
+type CommandInvocation struct {
+	Command      ChannelCommand
+	ChannelTitle string
+	// CallerLevel is the sender's permission level in the channel
+	CallerLevel string
+}
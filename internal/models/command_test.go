@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestChannelCommandAllows(t *testing.T) {
+	cmd := &ChannelCommand{Permission: CommandFollower}
+	tests := []struct {
+		level string
+		want  bool
+	}{
+		{CommandEveryone, false},
+		{CommandFollower, true},
+		{CommandModerator, true},
+		{CommandOwner, true},
+	}
+	for _, tt := range tests {
+		if got := cmd.Allows(tt.level); got != tt.want {
+			t.Errorf("Allows(%q) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+
+	owner := &ChannelCommand{Permission: CommandOwner}
+	if owner.Allows(CommandModerator) {
+		t.Error("Expected moderators not to run owner commands")
+	}
+}
+
+func TestChannelCommandRender(t *testing.T) {
+	cmd := &ChannelCommand{Response: "{user}: {channel} streams {args} (asked {count} times, {unknown})"}
+	got := cmd.Render("@ann", "Speedruns", "Mon-Fri", 7)
+	want := "@ann: Speedruns streams Mon-Fri (asked 7 times, {unknown})"
+	if got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
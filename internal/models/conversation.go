@@ -7,13 +7,111 @@ import (
 )
 
 type Conversation struct {
-	ID        uuid.UUID  `json:"id" db:"id"`
-	IsGroup   bool       `json:"is_group" db:"is_group"`
-	Name      *string    `json:"name,omitempty" db:"name"`
-	CreatedAt time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
-	Members   []User     `json:"members,omitempty"`
-	LastMessage *Message `json:"last_message,omitempty"`
+	ID      uuid.UUID `json:"id" db:"id"`
+	IsGroup bool      `json:"is_group" db:"is_group"`
+	Name    *string   `json:"name,omitempty" db:"name"`
+	// Formatting renders Markdown in new messages (see Message.HTML). It is
+	// only loaded when a single conversation is read.
+	Formatting  *bool      `json:"formatting,omitempty" db:"formatting"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	Version     int        `json:"version" db:"version"`
+	Members     []User     `json:"members,omitempty"`
+	LastMessage *Message   `json:"last_message,omitempty"`
+	// LastReadMessageID is the caller's read marker, see ReadMarker
+	LastReadMessageID *uuid.UUID `json:"last_read_message_id,omitempty"`
+	// RequestPending marks a direct conversation whose recipient has not
+	// accepted the caller's message request yet
+	RequestPending bool `json:"request_pending,omitempty"`
+	// Draft is the caller's unsent message, kept across their devices
+	Draft *Draft `json:"draft,omitempty"`
+	// RetentionDays is how long messages are kept, 0 for ever; older ones
+	// are deleted or moved to the archive as RetentionAction says. Both are
+	// loaded like Formatting.
+	RetentionDays   *int    `json:"retention_days,omitempty" db:"retention_days"`
+	RetentionAction *string `json:"retention_action,omitempty" db:"retention_action"`
+}
+
+// Retention actions: what happens to messages older than a conversation's
+// retention
+const (
+	RetentionDelete  = "delete"
+	RetentionArchive = "archive"
+)
+
+// Draft is a message a member started writing in a conversation but did not
+// send. UpdatedAt is unset when there is none.
+type Draft struct {
+	Body      string     `json:"body"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// SaveDraftRequest replaces the caller's draft; an empty body discards it
+type SaveDraftRequest struct {
+	Body string `json:"body" binding:"max=10000"`
+}
+
+// Conversation kinds, which have separate send rate limits
+const (
+	ConversationDirect  = "direct"
+	ConversationGroup   = "group"
+	ConversationChannel = "channel"
+)
+
+// Who may start a direct conversation with a user. Senders outside a
+// shared_channels or followers user's network start a message request.
+const (
+	DMPolicyEveryone       = "everyone"
+	DMPolicySharedChannels = "shared_channels"
+	DMPolicyFollowers      = "followers"
+	DMPolicyNone           = "none"
+)
+
+// PrivacySettings are the current user's privacy settings
+type PrivacySettings struct {
+	DMPolicy string `json:"dm_policy"`
+}
+
+type UpdatePrivacySettingsRequest struct {
+	DMPolicy string `json:"dm_policy" binding:"required,oneof=everyone shared_channels followers none"`
+}
+
+// NotificationSettings are the current user's notification settings for
+// one conversation. A mute without MutedUntil lasts until it is lifted.
+type NotificationSettings struct {
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	Muted          bool       `json:"muted"`
+	MutedUntil     *time.Time `json:"muted_until,omitempty"`
+}
+
+// UpdateNotificationSettingsRequest mutes or unmutes a conversation's
+// notifications; Minutes limits a mute
+type UpdateNotificationSettingsRequest struct {
+	Muted   *bool `json:"muted" binding:"required"`
+	Minutes int   `json:"minutes" binding:"omitempty,min=1,max=525600"`
+}
+
+// DoNotDisturb holds back the current user's email and push notifications
+// until Until
+type DoNotDisturb struct {
+	Enabled bool       `json:"enabled"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+type SetDoNotDisturbRequest struct {
+	Minutes int `json:"minutes" binding:"required,min=1,max=10080"`
+}
+
+// MessageRequest is a direct conversation started by someone outside the
+// recipient's network. Until the recipient accepts it, only the sender is a
+// member: the recipient gets no events and does not see it among their
+// conversations.
+type MessageRequest struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Sender         User      `json:"sender"`
+	LastMessage    *Message  `json:"last_message,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 type ConversationMember struct {
@@ -30,6 +128,18 @@ type CreateConversationRequest struct {
 	Members []uuid.UUID `json:"members" binding:"required,min=1"`
 }
 
+// UpdateConversationRequest renames a group conversation or turns Markdown
+// formatting on or off; Version must match the current row version
+type UpdateConversationRequest struct {
+	Name       *string `json:"name,omitempty"`
+	Formatting *bool   `json:"formatting,omitempty"`
+	Version    int     `json:"version" binding:"required"`
+	// RetentionDays sets how long messages are kept (0 for ever), and
+	// RetentionAction whether older ones are deleted or archived
+	RetentionDays   *int    `json:"retention_days,omitempty" binding:"omitempty,min=0,max=3650"`
+	RetentionAction *string `json:"retention_action,omitempty" binding:"omitempty,oneof=delete archive"`
+}
+
 type AddMembersRequest struct {
 	Members []uuid.UUID `json:"members" binding:"required,min=1"`
 }
@@ -38,3 +148,26 @@ type ConversationWithDetails struct {
 	Conversation
 	UnreadCount int `json:"unread_count"`
 }
+
+type AddModerationRequest struct {
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	Action      string    `json:"action" binding:"required,oneof=mute ban"`
+	DurationMin int       `json:"duration_min" binding:"min=0,max=525600"`
+	Reason      string    `json:"reason" binding:"max=500"`
+}
+
+// RestrictUserRequest mutes or bans a user in a group conversation;
+// DurationMin 0 means until lifted
+type RestrictUserRequest struct {
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	DurationMin int       `json:"duration_min" binding:"min=0,max=525600"`
+	Reason      string    `json:"reason" binding:"max=500"`
+}
+
+// RestrictionResponse confirms a mute or ban; ExpiresAt is unset for one
+// that lasts until lifted
+type RestrictionResponse struct {
+	UserID    uuid.UUID  `json:"user_id"`
+	Action    string     `json:"action"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
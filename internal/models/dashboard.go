@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Dashboard is everything the creator dashboard shows about the caller's
+// channels, assembled in one response
+type Dashboard struct {
+	Channels []DashboardChannel `json:"channels"`
+	// UnreadMentions totals the channels' unread mentions of the caller
+	UnreadMentions int       `json:"unread_mentions"`
+	GeneratedAt    time.Time `json:"generated_at"`
+}
+
+type DashboardChannel struct {
+	Channel Channel `json:"channel"`
+	Live    bool    `json:"live"`
+	// Stream is the channel's latest stream, live or not
+	Stream *Stream `json:"stream,omitempty"`
+	// Viewers counts users who loaded the chat or whose player sent a
+	// heartbeat within the last two minutes
+	Viewers         int                 `json:"viewers"`
+	Followers       int                 `json:"followers"`
+	RecentFollowers []Follower          `json:"recent_followers"`
+	UnreadMentions  int                 `json:"unread_mentions"`
+	Moderation      DashboardModeration `json:"moderation"`
+}
+
+// DashboardModeration counts the bans and mutes currently in force in a
+// channel's chat and the message reports waiting for review
+type DashboardModeration struct {
+	ActiveBans     int `json:"active_bans"`
+	ActiveMutes    int `json:"active_mutes"`
+	PendingReports int `json:"pending_reports"`
+}
+
+// DashboardStats holds the per-channel figures loaded in one database batch,
+// keyed by channel ID
+type DashboardStats struct {
+	Streams         map[uuid.UUID]Stream
+	Followers       map[uuid.UUID]int
+	RecentFollowers map[uuid.UUID][]Follower
+	UnreadMentions  map[uuid.UUID]int
+	Moderation      map[uuid.UUID]DashboardModeration
+}
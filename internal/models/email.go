@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Email lists a user can unsubscribe from
+const (
+	EmailListMentions = "mentions"
+	EmailListLive     = "live"
+	EmailListAll      = "all"
+)
+
+// EmailPreferences controls which notification emails a user receives.
+// Verification and password reset emails are always sent.
+type EmailPreferences struct {
+	UserID        uuid.UUID `json:"user_id" db:"user_id"`
+	MentionDigest bool      `json:"mention_digest" db:"mention_digest"`
+	ChannelLive   bool      `json:"channel_live" db:"channel_live"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type UpdateEmailPreferencesRequest struct {
+	MentionDigest *bool `json:"mention_digest,omitempty"`
+	ChannelLive   *bool `json:"channel_live,omitempty"`
+}
+
+// EmailRecipient is a user selected to receive a notification email
+type EmailRecipient struct {
+	UserID           uuid.UUID
+	Email            string
+	DisplayName      string
+	UnsubscribeToken uuid.UUID
+	DoNotDisturb     bool
+}
+
+// Mention is a message that mentioned a user, as listed in a digest
+type Mention struct {
+	MessageID        uuid.UUID
+	ConversationID   uuid.UUID
+	ConversationName string
+	SenderName       string
+	Body             string
+	CreatedAt        time.Time
+	// ConversationMuted is whether the recipient muted the conversation's notifications
+	ConversationMuted bool
+}
+
+// MentionDigest groups the unread mentions of one recipient
+type MentionDigest struct {
+	Recipient EmailRecipient
+	Mentions  []Mention
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
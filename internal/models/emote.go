@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Emote is a channel's custom emote, written ":name:" in its chat. ImageURL
+// is its 1x image.
+type Emote struct {
+	ChannelID uuid.UUID     `json:"channel_id" db:"channel_id"`
+	Name      string        `json:"name" db:"name"`
+	ImageURL  string        `json:"image_url" db:"image_url"`
+	Images    ImageVariants `json:"images" db:"images"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// PutEmoteRequest is the body of PUT /channels/:slug/emotes/:name: either
+// the URL of an image hosted elsewhere, or the image at each scale, base64
+// encoded, with 1x required
+type PutEmoteRequest struct {
+	ImageURL string            `json:"image_url" binding:"omitempty,max=2048,url,startswith=https://"`
+	Images   map[string][]byte `json:"images"`
+}
+
+// Message token types
+const (
+	TokenText  = "text"
+	TokenEmote = "emote"
+)
+
+// MessageToken is one piece of a message body: plain text, or a channel
+// emote with its images. ImageURL is the 1x image.
+type MessageToken struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text"`
+	ImageURL string        `json:"image_url,omitempty"`
+	Images   ImageVariants `json:"images,omitempty"`
+}
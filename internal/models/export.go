@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Data export states
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is a user's request for a copy of their data. The archive itself
+// is stored separately and only downloadable while ready and unexpired.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Status      string     `json:"status" db:"status"`
+	SizeBytes   *int64     `json:"size_bytes,omitempty" db:"size_bytes"`
+	Error       *string    `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	// DownloadURL is a short-lived signed link, set while the export is ready
+	DownloadURL string `json:"download_url,omitempty" db:"-"`
+}
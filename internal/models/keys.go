@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Device key algorithms
+const (
+	KeyX25519 = "x25519"
+	KeyP256   = "p256"
+)
+
+// DeviceKey is the public key a user's device publishes so others can
+// encrypt direct messages to it. The server only stores and hands out keys;
+// it never sees private keys or plaintext.
+type DeviceKey struct {
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	DeviceID  string    `json:"device_id" db:"device_id"`
+	Algorithm string    `json:"algorithm" db:"algorithm"`
+	PublicKey string    `json:"public_key" db:"public_key"`
+	// Signature is an optional signature of PublicKey by the user's identity
+	// key, for clients to verify
+	Signature *string   `json:"signature,omitempty" db:"signature"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// PublishDeviceKeyRequest is the body of PUT /me/keys/:device_id. Keys and
+// signatures are standard base64.
+type PublishDeviceKeyRequest struct {
+	Algorithm string  `json:"algorithm" binding:"required,oneof=x25519 p256"`
+	PublicKey string  `json:"public_key" binding:"required,max=1024,base64"`
+	Signature *string `json:"signature" binding:"omitempty,max=1024,base64"`
+}
+
+// MemberKeys lists one conversation member's device keys; Keys is empty for
+// members who have not published any, who cannot receive encrypted messages
+type MemberKeys struct {
+	UserID uuid.UUID   `json:"user_id"`
+	Keys   []DeviceKey `json:"keys"`
+}
+
+// ConversationKeyBundle is the response of GET /conversations/:id/keys
+type ConversationKeyBundle struct {
+	ConversationID uuid.UUID    `json:"conversation_id"`
+	Members        []MemberKeys `json:"members"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChannelLink is a tracked short link a channel owner shares to promote the
+// channel or something else. GET /l/:code counts the click and redirects to
+// TargetURL, or to the channel's page when there is none.
+type ChannelLink struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	ChannelID     uuid.UUID  `json:"channel_id" db:"channel_id"`
+	Code          string     `json:"code" db:"code"`
+	TargetURL     *string    `json:"target_url,omitempty" db:"target_url"`
+	Label         *string    `json:"label,omitempty" db:"label"`
+	Clicks        int64      `json:"clicks" db:"clicks"`
+	ShortURL      string     `json:"short_url" db:"-"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LastClickedAt *time.Time `json:"last_clicked_at,omitempty" db:"last_clicked_at"`
+}
+
+// CreateChannelLinkRequest creates a short link; without a target_url it
+// points to the channel
+type CreateChannelLinkRequest struct {
+	TargetURL *string `json:"target_url" binding:"omitempty,http_url,max=2048"`
+	Label     *string `json:"label" binding:"omitempty,max=100"`
+}
+
+// LinkClickDay is the number of clicks on a link during one UTC day
+type LinkClickDay struct {
+	Day    string `json:"day"`
+	Clicks int64  `json:"clicks"`
+}
+
+// ChannelLinkStats is a link with its clicks per day, oldest first. Days
+// without clicks are included with zero.
+type ChannelLinkStats struct {
+	ChannelLink
+	Days []LinkClickDay `json:"days"`
+}
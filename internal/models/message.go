@@ -7,13 +7,60 @@ import (
 )
 
 type Message struct {
-	ID             uuid.UUID  `json:"id" db:"id"`
-	ConversationID uuid.UUID  `json:"conversation_id" db:"conversation_id"`
-	SenderID       uuid.UUID  `json:"sender_id" db:"sender_id"`
-	Body           string     `json:"body" db:"body"`
-	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
-	Sender         *User      `json:"sender,omitempty"`
+	ID             uuid.UUID `json:"id" db:"id"`
+	ConversationID uuid.UUID `json:"conversation_id" db:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id" db:"sender_id"`
+	Body           string    `json:"body" db:"body"`
+	// Kind is MessageText or MessageEncrypted, whose body is ciphertext
+	Kind string `json:"kind" db:"kind"`
+	// HTML is the body rendered from Markdown and sanitized, for text
+	// messages sent while the conversation had formatting on
+	HTML *string `json:"html,omitempty" db:"html"`
+	// Tokens splits the body into text and the channel's emotes; it is only
+	// set on channel chat messages that use an emote
+	Tokens    []MessageToken `json:"tokens,omitempty" db:"tokens"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty" db:"deleted_at"`
+	// DeletedBy is the sender, or the moderator or admin who removed it
+	DeletedBy *uuid.UUID `json:"deleted_by,omitempty" db:"deleted_by"`
+	// Preview describes the first link in the body; it is fetched after the
+	// message is sent and announced with message.updated
+	Preview *LinkPreview `json:"preview,omitempty" db:"preview"`
+	Sender  *User        `json:"sender,omitempty"`
+	// Badge is the sender's badge in a channel chat, if the channel has one
+	// for their role there
+	Badge *ChatBadge `json:"badge,omitempty" db:"-"`
+	// ReportToken lets whoever was shown the message report it, even after
+	// it is deleted
+	ReportToken string `json:"report_token,omitempty" db:"-"`
+	// Deletion explains a removal; only the moderators' view of deleted
+	// messages has it
+	Deletion *MessageDeletion `json:"deletion,omitempty" db:"-"`
+}
+
+// MessageDeletion is the moderation log entry behind a deleted message: the
+// action, such as automod's "delete_word", and its reason
+type MessageDeletion struct {
+	Action string  `json:"action"`
+	Reason *string `json:"reason,omitempty"`
+}
+
+// Message kinds. The server stores the body of an encrypted message as is:
+// it is ciphertext for the recipients' device keys, so it gets no link
+// preview and is not checked by automod.
+const (
+	MessageText      = "text"
+	MessageEncrypted = "encrypted"
+)
+
+// LinkPreview is the OpenGraph metadata of a link in a message
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
 }
 
 type MessageRead struct {
@@ -26,12 +73,21 @@ type MessageRead struct {
 type SendMessageRequest struct {
 	ConversationID uuid.UUID `json:"conversation_id" binding:"required"`
 	Body           string    `json:"body" binding:"required,max=10000"`
+	// Kind defaults to text; encrypted is only accepted in direct conversations
+	Kind string `json:"kind" binding:"omitempty,oneof=text encrypted"`
 }
 
 type GetMessagesRequest struct {
 	ConversationID uuid.UUID `form:"conversation_id" binding:"required"`
-	Limit          int       `form:"limit"`
-	Offset         int       `form:"offset"`
+}
+
+// ReadMarker is how far a member has read a conversation: every message up
+// to and including LastReadMessageID counts as read
+type ReadMarker struct {
+	ConversationID    uuid.UUID `json:"conversation_id"`
+	UserID            uuid.UUID `json:"user_id"`
+	LastReadMessageID uuid.UUID `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
 }
 
 type MarkReadRequest struct {
@@ -39,6 +95,53 @@ type MarkReadRequest struct {
 	ConversationID uuid.UUID `json:"conversation_id" binding:"required"`
 }
 
+// ReadConversationRequest is the optional body of PUT
+// /conversations/:id/read; without message_id the marker moves to the newest
+// message
+type ReadConversationRequest struct {
+	MessageID *uuid.UUID `json:"message_id"`
+}
+
+// ReadConversationResponse is where the reader's marker is after PUT
+// /conversations/:id/read, whether or not it moved
+type ReadConversationResponse struct {
+	ConversationID    uuid.UUID  `json:"conversation_id"`
+	LastReadMessageID *uuid.UUID `json:"last_read_message_id"`
+	UnreadCount       int        `json:"unread_count"`
+}
+
+// UnreadCount is how many messages are unread in one conversation
+type UnreadCount struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Unread         int       `json:"unread"`
+}
+
+// UnreadCountsResponse is the body of GET /conversations/unread: every
+// conversation of the user, with nothing unread included, and the total
+type UnreadCountsResponse struct {
+	Total         int           `json:"total"`
+	Conversations []UnreadCount `json:"conversations"`
+}
+
+// MarkAllReadRequest limits POST /me/read-all to some conversations; without
+// conversation_ids every conversation of the user is marked read
+type MarkAllReadRequest struct {
+	ConversationIDs []uuid.UUID `json:"conversation_ids" binding:"omitempty,max=500"`
+}
+
+// ConversationReadCount is how many messages were marked read in a conversation
+type ConversationReadCount struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Marked         int       `json:"marked"`
+}
+
+// MarkAllReadResponse summarizes a bulk mark-as-read
+type MarkAllReadResponse struct {
+	Marked        int                     `json:"marked"`
+	Conversations []ConversationReadCount `json:"conversations"`
+	ReadAt        time.Time               `json:"read_at"`
+}
+
 type TypingIndicator struct {
 	ConversationID uuid.UUID `json:"conversation_id"`
 	UserID         uuid.UUID `json:"user_id"`
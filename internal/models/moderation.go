@@ -11,7 +11,7 @@ type ModerationLog struct {
 	ID             uuid.UUID      `json:"id" db:"id"`
 	ConversationID *uuid.UUID     `json:"conversation_id,omitempty" db:"conversation_id"`
 	MessageID      *uuid.UUID     `json:"message_id,omitempty" db:"message_id"`
-	Action         string         `json:"action" db:"action"` // delete, warn, timeout, ban, mute
+	Action         string         `json:"action" db:"action"` // delete, warn, timeout, ban, mute, unban, unmute
 	ModeratorID    *uuid.UUID     `json:"moderator_id,omitempty" db:"moderator_id"`
 	TargetUserID   *uuid.UUID     `json:"target_user_id,omitempty" db:"target_user_id"`
 	Reason         *string        `json:"reason,omitempty" db:"reason"`
@@ -26,3 +26,38 @@ type BannedWord struct {
 	Word           string    `json:"word" db:"word"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
+
+// DefaultAnnouncementInterval is how often, in minutes, an announcement
+// repeats unless the owner picks another interval
+const DefaultAnnouncementInterval = 15
+
+// ChannelAutoMessages configures the messages the moderation bot posts in a
+// channel's chat: a welcome for each user's first message and an
+// announcement repeated while the channel is live. Empty texts are off.
+type ChannelAutoMessages struct {
+	ChannelID uuid.UUID `json:"channel_id" db:"channel_id"`
+	// WelcomeMessage may mention the newcomer with {user}
+	WelcomeMessage          string `json:"welcome_message" db:"welcome_message"`
+	Announcement            string `json:"announcement" db:"announcement"`
+	AnnouncementIntervalMin int    `json:"announcement_interval_min" db:"announcement_interval_min"`
+	// AnnouncementMinMessages is how many chat messages must arrive between
+	// two announcements, so the bot does not talk to an empty room
+	AnnouncementMinMessages int        `json:"announcement_min_messages" db:"announcement_min_messages"`
+	LastAnnouncedAt         *time.Time `json:"last_announced_at,omitempty" db:"last_announced_at"`
+	UpdatedAt               time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// UpdateAutoMessagesRequest replaces a channel's auto messages
+type UpdateAutoMessagesRequest struct {
+	WelcomeMessage          string `json:"welcome_message" binding:"max=500"`
+	Announcement            string `json:"announcement" binding:"max=500"`
+	AnnouncementIntervalMin int    `json:"announcement_interval_min" binding:"omitempty,min=5,max=1440"`
+	AnnouncementMinMessages int    `json:"announcement_min_messages" binding:"min=0,max=1000"`
+}
+
+// AutoMessage is a bot message due in a channel's chat
+type AutoMessage struct {
+	ChannelID      uuid.UUID
+	ConversationID uuid.UUID
+	Body           string
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OverlayToken lets a stream overlay, such as an OBS browser source, read a
+// channel's alerts from GET /overlay/events without a login. A channel has
+// at most one; only its hash is stored and Hint is the start of it.
+type OverlayToken struct {
+	ChannelID  uuid.UUID  `json:"channel_id" db:"channel_id"`
+	Hint       string     `json:"hint" db:"hint"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+// CreateOverlayTokenResponse carries the token itself, shown only once, and
+// the feed URL to paste into the overlay
+type CreateOverlayTokenResponse struct {
+	OverlayToken
+	Token     string `json:"token"`
+	EventsURL string `json:"events_url"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message report states
+const (
+	ReportPending   = "pending"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// MessageReport flags a message for moderators. It keeps a snapshot of the
+// message as it was when reported, so the report stays reviewable after the
+// message is deleted or edited.
+type MessageReport struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	MessageID        uuid.UUID  `json:"message_id" db:"message_id"`
+	ConversationID   uuid.UUID  `json:"conversation_id" db:"conversation_id"`
+	ReporterID       uuid.UUID  `json:"reporter_id" db:"reporter_id"`
+	SenderID         uuid.UUID  `json:"sender_id" db:"sender_id"`
+	Reason           string     `json:"reason" db:"reason"`
+	Details          string     `json:"details,omitempty" db:"details"`
+	BodySnapshot     string     `json:"body_snapshot" db:"body_snapshot"`
+	MessageCreatedAt time.Time  `json:"message_created_at" db:"message_created_at"`
+	MessageDeletedAt *time.Time `json:"message_deleted_at,omitempty" db:"message_deleted_at"`
+	Status           string     `json:"status" db:"status"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+	ResolvedBy       *uuid.UUID `json:"resolved_by,omitempty" db:"resolved_by"`
+}
+
+// ReportMessageRequest is the body of POST /messages/:id/report. The
+// report_token delivered with the message is required once it is deleted.
+type ReportMessageRequest struct {
+	Reason      string `json:"reason" binding:"required,oneof=spam harassment hate sexual violence other"`
+	Details     string `json:"details" binding:"max=1000"`
+	ReportToken string `json:"report_token"`
+}
+
+// ResolveReportRequest closes a report from the admin queue
+type ResolveReportRequest struct {
+	Status string `json:"status" binding:"required,oneof=resolved dismissed"`
+}
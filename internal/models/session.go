@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one login of a user, on one device. It lasts as long as its
+// refresh tokens; signing it out also stops its access tokens.
+type Session struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	IP         string    `json:"ip" db:"ip"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+	// Current marks the session the request was made with
+	Current bool `json:"current" db:"-"`
+}
+
+// Device describes where a login or token refresh came from
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// WSSessionRevokedPayload tells a user's connections that one of their
+// sessions was signed out; the session's own connections are then closed
+type WSSessionRevokedPayload struct {
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+// AuthEvent is an entry in a user's security log: a registration, sign-in,
+// failed sign-in, password change or revoked token, and where it came from
+type AuthEvent struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"-" db:"user_id"`
+	Event     string    `json:"event" db:"event"`
+	IP        string    `json:"ip" db:"ip"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
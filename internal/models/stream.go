@@ -1,20 +1,109 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Stream struct {
-	ID        uuid.UUID  `json:"id" db:"id"`
-	ChannelID uuid.UUID  `json:"channel_id" db:"channel_id"`
-	Status    string     `json:"status" db:"status"` // offline, live, ended
-	IngestURL *string    `json:"ingest_url,omitempty" db:"ingest_url"`
-	HLSURL    *string    `json:"hls_url,omitempty" db:"hls_url"`
-	StreamKey *string    `json:"stream_key,omitempty" db:"stream_key"`
-	StartedAt *time.Time `json:"started_at,omitempty" db:"started_at"`
-	EndedAt   *time.Time `json:"ended_at,omitempty" db:"ended_at"`
-	CreatedAt time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	ID        uuid.UUID `json:"id" db:"id"`
+	ChannelID uuid.UUID `json:"channel_id" db:"channel_id"`
+	Status    string    `json:"status" db:"status"` // offline, live, ended
+	IngestURL *string   `json:"ingest_url,omitempty" db:"ingest_url"`
+	HLSURL    *string   `json:"hls_url,omitempty" db:"hls_url"`
+	StreamKey *string   `json:"stream_key,omitempty" db:"stream_key"`
+	// Mature marks 18+ content: HLSURL is only given to viewers who
+	// acknowledged it in their content preferences
+	Mature bool `json:"mature" db:"mature"`
+	// ContentTags describe the content, such as "gambling"; viewers can hide
+	// tagged streams from explore
+	ContentTags []string   `json:"content_tags" db:"content_tags"`
+	StartedAt   *time.Time `json:"started_at,omitempty" db:"started_at"`
+	EndedAt     *time.Time `json:"ended_at,omitempty" db:"ended_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// StreamWithChannel is a live stream joined with its channel and owner, as
+// listed on the explore page. It leaves out the ingest URL and stream key.
+type StreamWithChannel struct {
+	ID        uuid.UUID  `json:"id"`
+	ChannelID uuid.UUID  `json:"channel_id"`
+	Status    string     `json:"status"`
+	HLSURL    *string    `json:"hls_url,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Mature    bool       `json:"mature"`
+	// ContentTags are the stream's; Tags are the channel's
+	ContentTags []string  `json:"content_tags"`
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Language    *string   `json:"language,omitempty"`
+	Tags        []string  `json:"tags"`
+	OwnerID     uuid.UUID `json:"owner_id"`
+	OwnerName   string    `json:"owner_name"`
+	// OwnerAvatarURL is the channel owner's avatar
+	OwnerAvatarURL *string `json:"owner_avatar_url,omitempty"`
+	Followers      int     `json:"followers"`
+	// Viewers counts users who loaded the chat or whose player sent a
+	// heartbeat within the last two minutes
+	Viewers int `json:"viewers"`
+}
+
+// StartStreamRequest is the optional body of POST /channels/:slug/start
+type StartStreamRequest struct {
+	Mature      bool     `json:"mature"`
+	ContentTags []string `json:"content_tags,omitempty" binding:"omitempty,max=10,dive,min=1,max=25"`
+}
+
+// ContentPreferences decide which streams a viewer sees. Mature streams are
+// left out of explore and play without a URL until ShowMature is set, which
+// is how viewers acknowledge 18+ content; streams with a HiddenTags tag are
+// left out of explore.
+type ContentPreferences struct {
+	ShowMature bool      `json:"show_mature"`
+	HiddenTags []string  `json:"hidden_tags"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type UpdateContentPreferencesRequest struct {
+	ShowMature *bool     `json:"show_mature,omitempty"`
+	HiddenTags *[]string `json:"hidden_tags,omitempty" binding:"omitempty,max=50,dive,min=1,max=25"`
+}
+
+// CanPlay reports whether the viewer may get the playback URL of a stream
+func (p ContentPreferences) CanPlay(mature bool) bool {
+	return !mature || p.ShowMature
+}
+
+// Hides reports whether explore leaves out a stream
+func (p ContentPreferences) Hides(mature bool, contentTags []string) bool {
+	if !p.CanPlay(mature) {
+		return true
+	}
+	for _, t := range contentTags {
+		for _, hidden := range p.HiddenTags {
+			if t == hidden {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeContentTags lowercases and trims tags and drops duplicates, so
+// tags match whatever case they were entered in
+func NormalizeContentTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContentPreferencesHides(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefs  ContentPreferences
+		mature bool
+		tags   []string
+		want   bool
+	}{
+		{"plain stream", ContentPreferences{}, false, nil, false},
+		{"mature without opt-in", ContentPreferences{}, true, nil, true},
+		{"mature with opt-in", ContentPreferences{ShowMature: true}, true, nil, false},
+		{"hidden tag", ContentPreferences{HiddenTags: []string{"gambling"}}, false, []string{"irl", "gambling"}, true},
+		{"other tags", ContentPreferences{HiddenTags: []string{"gambling"}}, false, []string{"irl"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.prefs.Hides(tt.mature, tt.tags); got != tt.want {
+			t.Errorf("%s: Hides() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeContentTags(t *testing.T) {
+	got := NormalizeContentTags([]string{" Gambling", "gambling", "", "IRL "})
+	if want := []string{"gambling", "irl"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeContentTags() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageTranslation is a message's body in another language. Translations
+// are made on request and kept, one per message and language.
+type MessageTranslation struct {
+	MessageID uuid.UUID `json:"message_id"`
+	// Language is the target language, a lower case tag such as "de"
+	Language string `json:"language"`
+	Text     string `json:"text"`
+	// SourceLanguage is the language the provider detected in the message
+	SourceLanguage *string   `json:"source_language,omitempty"`
+	Provider       string    `json:"provider"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TranslateMessageRequest is the body of POST /messages/:id/translate
+type TranslateMessageRequest struct {
+	Language string `json:"language" binding:"required,max=16"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -9,13 +10,47 @@ import (
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	Email        string    `json:"email" db:"email"`
-	DisplayName  string    `json:"display_name" db:"display_name"`
-	AvatarURL    *string   `json:"avatar_url,omitempty" db:"avatar_url"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID          uuid.UUID `json:"id" db:"id"`
+	Email       string    `json:"email,omitempty" db:"email"`
+	DisplayName string    `json:"display_name" db:"display_name"`
+	// Username is the unique handle used in @mentions, unset until chosen
+	Username     *string `json:"username,omitempty" db:"username"`
+	AvatarURL    *string `json:"avatar_url,omitempty" db:"avatar_url"`
+	PasswordHash string  `json:"-" db:"password_hash"`
+	// EmailVerifiedAt is set once the user confirms their address
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	// Role is the platform role: user, staff or admin
+	Role      string     `json:"role,omitempty" db:"role"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	Version   int        `json:"version" db:"version"`
+}
+
+// Platform roles, from least to most privileged. Each role may do
+// everything the ones before it may.
+const (
+	RoleUser  = "user"
+	RoleStaff = "staff"
+	RoleAdmin = "admin"
+)
+
+var roleRanks = map[string]int{RoleUser: 0, RoleStaff: 1, RoleAdmin: 2}
+
+// HasRole reports whether role grants at least min. An empty role is a
+// plain user; unknown roles grant nothing.
+func HasRole(role, min string) bool {
+	if role == "" {
+		role = RoleUser
+	}
+	r, ok := roleRanks[role]
+	m, known := roleRanks[min]
+	return ok && known && r >= m
+}
+
+// SetRoleRequest is the body of PUT /admin/users/:id/role
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user staff admin"`
 }
 
 // Validate checks basic user fields
@@ -35,6 +70,40 @@ func (u *User) Validate() error {
 	return nil
 }
 
+// Usernames are 3 to 20 lowercase letters, digits and underscores, so an
+// @mention ends at the first other character
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,20}$`)
+
+// reservedUsernames could pass for staff, the system or a group mention
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "all": true, "api": true, "channel": true,
+	"everyone": true, "help": true, "here": true, "me": true, "mod": true,
+	"moderator": true, "null": true, "root": true, "staff": true, "support": true,
+	"system": true, "tullo": true,
+}
+
+// NormalizeUsername lowercases a requested username and checks its format
+// and that it isn't reserved
+func NormalizeUsername(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !usernamePattern.MatchString(name) {
+		return "", fmt.Errorf("username must be 3 to 20 letters, digits or underscores")
+	}
+	if reservedUsernames[name] {
+		return "", fmt.Errorf("username is reserved")
+	}
+	return name, nil
+}
+
+// Mention is how chat messages @mention the user: by username, or by
+// display name until they choose one
+func (u *User) Mention() string {
+	if u.Username != nil {
+		return "@" + *u.Username
+	}
+	return "@" + u.DisplayName
+}
+
 type UserPresence struct {
 	UserID   uuid.UUID `json:"user_id"`
 	Status   string    `json:"status"` // online, offline
@@ -48,6 +117,24 @@ type CreateUserRequest struct {
 	AvatarURL   *string `json:"avatar_url,omitempty"`
 }
 
+// UpdateUserRequest updates profile fields; Version must match the current row version
+type UpdateUserRequest struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+	Version     int     `json:"version" binding:"required"`
+}
+
+// SetUsernameRequest is the body of PUT /me/username
+type SetUsernameRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// DeleteAccountRequest confirms DELETE /me; accounts without a password
+// (social login only) may omit it
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
@@ -55,5 +142,46 @@ type LoginRequest struct {
 
 type LoginResponse struct {
 	Token string `json:"token"`
-	User  User   `json:"user"`
+	// RefreshToken is exchanged at POST /auth/refresh for a new pair once
+	// Token expires; ExpiresIn is Token's lifetime in seconds
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         User   `json:"user"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// GuestTokenResponse carries a token for reading channel chats without an
+// account; GuestID identifies the viewer until it expires
+type GuestTokenResponse struct {
+	Token     string    `json:"token"`
+	GuestID   uuid.UUID `json:"guest_id"`
+	ExpiresIn int       `json:"expires_in"`
+}
+
+// SSOExchangeRequest carries an ID or access token from the configured OIDC
+// issuer
+type SSOExchangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RefreshResponse carries a new access token and the refresh token that
+// replaces the one presented, which can no longer be used
+type RefreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// UserIdentity links a user to an account at an OAuth provider
+type UserIdentity struct {
+	ID       uuid.UUID `json:"id" db:"id"`
+	UserID   uuid.UUID `json:"user_id" db:"user_id"`
+	Provider string    `json:"provider" db:"provider"`
+	// Subject is the provider's ID for the account
+	Subject   string    `json:"subject" db:"subject"`
+	Email     string    `json:"email" db:"email"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
@@ -69,3 +69,61 @@ func TestUser_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role, min string
+		want      bool
+	}{
+		{"", RoleUser, true},
+		{"", RoleStaff, false},
+		{RoleUser, RoleUser, true},
+		{RoleStaff, RoleUser, true},
+		{RoleStaff, RoleAdmin, false},
+		{RoleAdmin, RoleStaff, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"root", RoleUser, false},
+		{RoleAdmin, "root", false},
+	}
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.min); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"ada", "ada", false},
+		{" Ada_Lovelace ", "ada_lovelace", false},
+		{"r2d2", "r2d2", false},
+		{"ab", "", true},
+		{"a_very_long_username_x", "", true},
+		{"ada.l", "", true},
+		{"@ada", "", true},
+		{"ädä", "", true},
+		{"Admin", "", true},
+		{"everyone", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeUsername(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeUsername(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestUserMention(t *testing.T) {
+	u := User{DisplayName: "Ada Lovelace"}
+	if got := u.Mention(); got != "@Ada Lovelace" {
+		t.Errorf("Mention() without username = %q", got)
+	}
+	name := "ada"
+	u.Username = &name
+	if got := u.Mention(); got != "@ada" {
+		t.Errorf("Mention() = %q, want @ada", got)
+	}
+}
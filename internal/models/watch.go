@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WatchEntry is a user's progress in one stream, live or ended. Position is
+// where playback resumes; WatchedSeconds is how long the user watched in
+// total, and feeds recommendations.
+type WatchEntry struct {
+	StreamID        uuid.UUID `json:"stream_id"`
+	PositionSeconds int       `json:"position_seconds"`
+	WatchedSeconds  int       `json:"watched_seconds"`
+	FirstWatchedAt  time.Time `json:"first_watched_at"`
+	LastWatchedAt   time.Time `json:"last_watched_at"`
+}
+
+// WatchHistoryEntry is a WatchEntry with its stream and channel, as listed
+// by GET /api/v1/me/history
+type WatchHistoryEntry struct {
+	WatchEntry
+	ChannelID    uuid.UUID  `json:"channel_id"`
+	Slug         string     `json:"slug"`
+	Title        string     `json:"title"`
+	StreamStatus string     `json:"stream_status"`
+	HLSURL       *string    `json:"hls_url,omitempty"`
+	Mature       bool       `json:"mature"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+}
+
+// WatchProgressRequest is the heartbeat a player sends while a stream plays
+type WatchProgressRequest struct {
+	PositionSeconds *int `json:"position_seconds" binding:"required,min=0"`
+}
+
+// HeartbeatRequest is what a player sends about every 30 seconds while a
+// stream plays. DeviceID tells a viewer's devices apart, so each of them
+// may send a heartbeat per interval; players without one share a slot.
+type HeartbeatRequest struct {
+	DeviceID        string `json:"device_id" binding:"omitempty,max=64"`
+	PositionSeconds *int   `json:"position_seconds" binding:"required,min=0"`
+}
+
+// HeartbeatResponse answers a heartbeat. Counted is false for a repeated
+// heartbeat, which changes nothing. Watch time is only kept for signed-in
+// viewers, who also earn channel Points while the stream is live.
+type HeartbeatResponse struct {
+	Counted        bool   `json:"counted"`
+	WatchedSeconds *int   `json:"watched_seconds,omitempty"`
+	Points         *int64 `json:"points,omitempty"`
+}
@@ -1,26 +1,51 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // WebSocket event types
 const (
-	EventMessageNew     = "message.new"
-	EventMessageSend    = "message.send"
-	EventMessageRead    = "message.read"
-	EventTypingStart    = "typing.start"
-	EventTypingStop     = "typing.stop"
-	EventPresenceUpdate = "presence.update"
-	EventError          = "error"
+	EventMessageNew        = "message.new"
+	EventMessageSend       = "message.send"
+	EventMessageRead       = "message.read"
+	EventMessageReadAll    = "message.read_all"
+	EventMessageDeleted    = "message.deleted"
+	EventMessageRestored   = "message.restored"
+	EventMessageUpdated    = "message.updated"
+	EventReadMarker        = "conversation.read"
+	EventTypingStart       = "typing.start"
+	EventTypingStop        = "typing.stop"
+	EventTypingSubscribe   = "typing.subscribe"
+	EventTypingUnsubscribe = "typing.unsubscribe"
+	EventPresenceUpdate    = "presence.update"
+	EventUserUnmuted       = "chat.user_unmuted"
+	EventUserUnbanned      = "chat.user_unbanned"
+	EventUserBanned        = "chat.user_banned"
+	EventChatJoin          = "chat.join"
+	EventChatLeave         = "chat.leave"
+	EventChatViewers       = "chat.viewers"
+	EventSessionRevoked    = "session.revoked"
+	EventChannelFollowed   = "channel.followed"
+	EventAnnouncement      = "system.announcement"
+	EventReady             = "connection.ready"
+	EventError             = "error"
 )
 
 type WSMessage struct {
-	Event   string      `json:"event"`
+	Event string `json:"event"`
+	// Version is the schema version of Payload. Clients on the legacy
+	// protocol never see it; zero in a server event means the current schema.
+	Version int         `json:"v,omitempty"`
 	Payload interface{} `json:"payload"`
 }
 
 type WSMessageSendPayload struct {
 	ConversationID uuid.UUID `json:"conversation_id"`
 	Body           string    `json:"body"`
+	Kind           string    `json:"kind,omitempty"`
 }
 
 type WSMessageReadPayload struct {
@@ -36,3 +61,98 @@ type WSErrorPayload struct {
 	Message string `json:"message"`
 	Code    string `json:"code,omitempty"`
 }
+
+// WSModerationPayload announces that a mute or ban on UserID lapsed or was
+// lifted
+type WSModerationPayload struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	Action         string    `json:"action"`
+	ExpiredAt      time.Time `json:"expired_at"`
+}
+
+// WSUserBannedPayload tells the banned user's connections that the chat of
+// ChannelID was closed on them. ExpiresAt is unset for a ban until lifted.
+type WSUserBannedPayload struct {
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	ChannelID      uuid.UUID  `json:"channel_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// WSReadAllPayload tells the reader's own sessions which conversations a bulk
+// mark-as-read cleared
+type WSReadAllPayload struct {
+	UserID        uuid.UUID               `json:"user_id"`
+	Conversations []ConversationReadCount `json:"conversations"`
+	ReadAt        time.Time               `json:"read_at"`
+}
+
+// WSReadMarkerPayload tells the reader's own sessions how far they have read a
+// conversation, so badges clear on every device
+type WSReadMarkerPayload struct {
+	ReadMarker
+	// UnreadCount is what is left unread after the marker
+	UnreadCount int `json:"unread_count"`
+}
+
+// WSReadyPayload starts every connection. ResumeToken restores the
+// connection's subscriptions when passed as ?resume= on a reconnect within
+// ResumeWindow seconds of it closing.
+type WSReadyPayload struct {
+	ResumeToken  string `json:"resume_token"`
+	ResumeWindow int    `json:"resume_window"`
+	// Resumed is whether the connection picked up a closed connection's
+	// subscriptions; Chats and Typing list those that were restored
+	Resumed bool        `json:"resumed"`
+	Chats   []uuid.UUID `json:"chats,omitempty"`
+	Typing  []uuid.UUID `json:"typing,omitempty"`
+}
+
+// WSChatPayload names the channel whose chat a client opens or closes
+type WSChatPayload struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+}
+
+// WSChatViewersPayload reports how many signed-in users have a channel's chat
+// open
+type WSChatViewersPayload struct {
+	ChannelID   uuid.UUID `json:"channel_id"`
+	ChatViewers int       `json:"chat_viewers"`
+}
+
+// WSChannelFollowedPayload tells a channel's owner about new followers. It
+// names the follower, or for channels with many followers counts the new
+// follows since the last event instead.
+type WSChannelFollowedPayload struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+	OwnerID   uuid.UUID `json:"owner_id"`
+	// Count is the number of new follows the event stands for: 1 when it
+	// names the follower
+	Count int `json:"count"`
+	// Followers is the channel's follower count after them
+	Followers   int        `json:"followers"`
+	UserID      *uuid.UUID `json:"user_id,omitempty"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Username    *string    `json:"username,omitempty"`
+	AvatarURL   *string    `json:"avatar_url,omitempty"`
+}
+
+// WSMessageDeletedPayload tells a conversation that a message was deleted;
+// clients replace it with a tombstone
+type WSMessageDeletedPayload struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	// DeletedBy is the sender, or the moderator, admin or bot who removed it
+	DeletedBy uuid.UUID `json:"deleted_by"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// WSMessageUpdatedPayload tells a conversation that a message gained details
+// after it was sent, such as its link preview
+type WSMessageUpdatedPayload struct {
+	MessageID      uuid.UUID    `json:"message_id"`
+	ConversationID uuid.UUID    `json:"conversation_id"`
+	Preview        *LinkPreview `json:"preview,omitempty"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
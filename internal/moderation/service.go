@@ -0,0 +1,103 @@
+// Package moderation mutes and bans users in conversations. Channel chats and
+// group conversations go through the same Service, so both are logged and
+// announced alike.
+package moderation
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+// Restrictions a moderator can put on a user
+const (
+	ActionMute = "mute"
+	ActionBan  = "ban"
+)
+
+type Service struct {
+	convRepo *repository.ConversationRepository
+	modRepo  *repository.ModerationRepository
+	redis    *cache.RedisClient
+}
+
+// NewService creates the service; without Redis bans and lifted
+// restrictions are not announced
+func NewService(convRepo *repository.ConversationRepository, modRepo *repository.ModerationRepository, redis *cache.RedisClient) *Service {
+	return &Service{convRepo: convRepo, modRepo: modRepo, redis: redis}
+}
+
+// Restrict mutes or bans userID in a conversation for duration, or until
+// lifted when duration is zero, and records it in the moderation log.
+// Restricting a user again replaces the duration and reason. A banned user
+// is put out of the chat on every instance.
+func (s *Service) Restrict(conversationID, moderatorID, userID uuid.UUID, action string, duration time.Duration, reason string) (*time.Time, error) {
+	var expires *time.Time
+	if duration > 0 {
+		t := time.Now().Add(duration)
+		expires = &t
+	}
+	if err := s.convRepo.AddModeration(conversationID, userID, action, expires, reason); err != nil {
+		return nil, err
+	}
+
+	var meta map[string]any
+	if expires != nil {
+		meta = map[string]any{"expires_at": expires.UTC()}
+	}
+	s.log(conversationID, moderatorID, userID, action, reason, meta)
+
+	if action == ActionBan && s.redis != nil {
+		payload := models.WSUserBannedPayload{ConversationID: conversationID, UserID: userID, ExpiresAt: expires}
+		if err := s.redis.PublishMessage(models.WSMessage{Event: models.EventUserBanned, Payload: payload}); err != nil {
+			log.Printf("Failed to publish %s for user %s: %v", models.EventUserBanned, userID, err)
+		}
+	}
+	return expires, nil
+}
+
+// Lift ends a mute or ban early and announces it to the conversation like a
+// lapsed one. It reports false when the user was not restricted.
+func (s *Service) Lift(conversationID, moderatorID, userID uuid.UUID, action string) (bool, error) {
+	removed, err := s.convRepo.RemoveModeration(conversationID, userID, action)
+	if err != nil || !removed {
+		return false, err
+	}
+	s.log(conversationID, moderatorID, userID, "un"+action, "", nil)
+
+	if s.redis != nil {
+		event := models.EventUserUnmuted
+		if action == ActionBan {
+			event = models.EventUserUnbanned
+		}
+		payload := models.WSModerationPayload{ConversationID: conversationID, UserID: userID, Action: action, ExpiredAt: time.Now()}
+		if err := s.redis.PublishMessage(models.WSMessage{Event: event, Payload: payload}); err != nil {
+			log.Printf("Failed to publish %s for user %s: %v", event, userID, err)
+		}
+	}
+	return true, nil
+}
+
+// log records an action in the moderation log. A failure is logged only, as
+// the action itself took effect.
+func (s *Service) log(conversationID, moderatorID, userID uuid.UUID, action, reason string, meta map[string]any) {
+	entry := &models.ModerationLog{
+		ID:             uuid.New(),
+		ConversationID: &conversationID,
+		Action:         action,
+		ModeratorID:    &moderatorID,
+		TargetUserID:   &userID,
+		Metadata:       meta,
+		CreatedAt:      time.Now(),
+	}
+	if reason != "" {
+		entry.Reason = &reason
+	}
+	if err := s.modRepo.AddLog(entry); err != nil {
+		log.Printf("Failed to log %s of %s in %s: %v", action, userID, conversationID, err)
+	}
+}
@@ -2,29 +2,68 @@ package moderator
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/botscore"
 	"github.com/tullo/backend/internal/cache"
 	"github.com/tullo/backend/internal/models"
 	"github.com/tullo/backend/internal/repository"
 )
 
-// Bot monitors messages and enforces moderation rules
+// announceEvery is how often the bot looks for announcements that are due
+const announceEvery = time.Minute
+
+// Welcome rate per channel: a burst of newcomers (e.g. a raid) gets a few
+// welcomes, then one every welcomeEverySec seconds; the rest are skipped
+const (
+	welcomeBurst    = 5
+	welcomeEverySec = 10
+)
+
+// A user's bot score rates their last historySize messages within
+// historyWindow
+const (
+	historySize   = 20
+	historyWindow = 15 * time.Minute
+)
+
+// BotDetection configures the scores the bot keeps of how much chatters
+// look like bots (see package botscore)
+type BotDetection struct {
+	// MinMessages is how many recent messages a user needs to be scored
+	MinMessages int
+	// RestrictAt is the score from which users are muted for MuteFor; zero
+	// only scores them
+	RestrictAt float64
+	MuteFor    time.Duration
+}
+
+// Bot monitors messages and enforces moderation rules. It also posts the
+// channels' auto messages (see models.ChannelAutoMessages) and answers their
+// chat commands (see models.ChannelCommand).
 type Bot struct {
 	redis    *cache.RedisClient
 	convRepo *repository.ConversationRepository
 	msgRepo  *repository.MessageRepository
 	modRepo  *repository.ModerationRepository
 	userRepo *repository.UserRepository
+	cmdRepo  *repository.CommandRepository
 	botUser  uuid.UUID
 
-	// simple in-memory recent messages for spam detection
+	// bot detection, off while scores is nil
+	scores    *repository.BotScoreRepository
+	detection BotDetection
+
+	// simple in-memory recent messages for spam detection, and the longer
+	// history bot scores are computed from
 	recentMu sync.Mutex
-	recent   map[uuid.UUID][]recentMsg // key: userID
+	recent   map[uuid.UUID][]recentMsg       // key: userID
+	history  map[uuid.UUID][]botscore.Sample // key: userID
 }
 
 type recentMsg struct {
@@ -33,18 +72,27 @@ type recentMsg struct {
 }
 
 // NewBot creates a new moderation bot instance
-func NewBot(redis *cache.RedisClient, convRepo *repository.ConversationRepository, msgRepo *repository.MessageRepository, modRepo *repository.ModerationRepository, userRepo *repository.UserRepository, botUser uuid.UUID) *Bot {
+func NewBot(redis *cache.RedisClient, convRepo *repository.ConversationRepository, msgRepo *repository.MessageRepository, modRepo *repository.ModerationRepository, userRepo *repository.UserRepository, cmdRepo *repository.CommandRepository, botUser uuid.UUID) *Bot {
 	return &Bot{
 		redis:    redis,
 		convRepo: convRepo,
 		msgRepo:  msgRepo,
 		modRepo:  modRepo,
 		userRepo: userRepo,
+		cmdRepo:  cmdRepo,
 		botUser:  botUser,
 		recent:   make(map[uuid.UUID][]recentMsg),
+		history:  make(map[uuid.UUID][]botscore.Sample),
 	}
 }
 
+// DetectBots makes the bot score chatters in channel chats and store the
+// scores for the channels' moderators. Call it before Run.
+func (b *Bot) DetectBots(scores *repository.BotScoreRepository, d BotDetection) {
+	b.scores = scores
+	b.detection = d
+}
+
 // Run starts listening for messages and processing them
 func (b *Bot) Run() {
 	if b.redis == nil {
@@ -55,6 +103,8 @@ func (b *Bot) Run() {
 	ps := b.redis.SubscribeToMessages()
 	defer ps.Close()
 
+	go b.runAnnouncements()
+
 	ch := ps.Channel()
 	log.Println("Moderation bot started and listening to messages")
 	for msg := range ch {
@@ -77,6 +127,15 @@ func (b *Bot) Run() {
 }
 
 func (b *Bot) processMessage(m *models.Message) {
+	// The bot's own messages need neither moderation nor a welcome
+	if m.SenderID == b.botUser {
+		return
+	}
+	// Encrypted bodies are opaque to the server; there is nothing to check
+	if m.Kind == models.MessageEncrypted {
+		return
+	}
+
 	// quick checks
 	// 1. check banned words for conversation
 	bannedWords, err := b.modRepo.GetBannedWords(m.ConversationID)
@@ -85,7 +144,7 @@ func (b *Bot) processMessage(m *models.Message) {
 		for _, bw := range bannedWords {
 			if strings.Contains(lower, strings.ToLower(bw.Word)) {
 				// delete message
-				_ = b.msgRepo.Delete(m.ID)
+				b.deleteMessage(m)
 				// log action
 				logEntry := &models.ModerationLog{
 					ID:             uuid.New(),
@@ -139,12 +198,190 @@ func (b *Bot) processMessage(m *models.Message) {
 		}
 		_ = b.modRepo.AddLog(logEntry)
 		// delete offending message
-		_ = b.msgRepo.Delete(m.ID)
+		b.deleteMessage(m)
 		return
 	}
 
 	// 3. placeholder for harmful language detection (future AI integration)
 	// For now, simple profanity list can be global; omitted here.
+
+	b.score(m)
+	b.command(m)
+	b.welcome(m)
+}
+
+// score rates the sender's recent messages and records the score in the
+// chat. A sender scoring RestrictAt or more is muted.
+func (b *Bot) score(m *models.Message) {
+	if b.scores == nil {
+		return
+	}
+	at := m.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	b.recentMu.Lock()
+	samples := []botscore.Sample{}
+	for _, s := range b.history[m.SenderID] {
+		if at.Sub(s.At) <= historyWindow {
+			samples = append(samples, s)
+		}
+	}
+	samples = append(samples, botscore.Sample{ConversationID: m.ConversationID, Body: m.Body, At: at})
+	if len(samples) > historySize {
+		samples = samples[len(samples)-historySize:]
+	}
+	b.history[m.SenderID] = samples
+	b.recentMu.Unlock()
+
+	if len(samples) < b.detection.MinMessages {
+		return
+	}
+	r := botscore.Rate(samples)
+	kept, err := b.scores.Record(m.ConversationID, m.SenderID, &models.BotScore{
+		Score:      r.Score,
+		Entropy:    r.Entropy,
+		Regularity: r.Regularity,
+		Duplicates: r.Duplicates,
+		Messages:   r.Messages,
+	})
+	if err != nil {
+		log.Printf("Failed to record bot score of %s: %v", m.SenderID, err)
+		return
+	}
+	if !kept || b.detection.RestrictAt <= 0 || r.Score < b.detection.RestrictAt {
+		return
+	}
+
+	convID := m.ConversationID
+	exp := time.Now().Add(b.detection.MuteFor)
+	reason := fmt.Sprintf("bot score %.2f", r.Score)
+	if err := b.convRepo.AddModeration(convID, m.SenderID, "mute", &exp, reason); err != nil {
+		log.Printf("Failed to mute suspected bot %s: %v", m.SenderID, err)
+		return
+	}
+	_ = b.modRepo.AddLog(&models.ModerationLog{
+		ID:             uuid.New(),
+		ConversationID: &convID,
+		MessageID:      &m.ID,
+		Action:         "timeout_bot",
+		ModeratorID:    &b.botUser,
+		TargetUserID:   &m.SenderID,
+		Reason:         &reason,
+		CreatedAt:      time.Now(),
+	})
+
+	// Start over, so the messages behind this mute don't trigger another
+	b.recentMu.Lock()
+	delete(b.history, m.SenderID)
+	b.recentMu.Unlock()
+}
+
+// deleteMessage removes a message the bot acted on and tells the
+// conversation, so clients take it down
+func (b *Bot) deleteMessage(m *models.Message) {
+	if deletedAt, err := b.msgRepo.Delete(m.ID, b.botUser); err == nil {
+		b.redis.PublishMessage(models.WSMessage{
+			Event:   models.EventMessageDeleted,
+			Payload: models.WSMessageDeletedPayload{MessageID: m.ID, ConversationID: m.ConversationID, DeletedBy: b.botUser, DeletedAt: deletedAt},
+		})
+	}
+	_ = b.redis.RecordAutomodAction(m.ConversationID)
+}
+
+// command answers a message starting with one of the channel's commands,
+// e.g. "!discord", if the sender may run it and it is not cooling down
+func (b *Bot) command(m *models.Message) {
+	if !strings.HasPrefix(m.Body, "!") {
+		return
+	}
+	name, args, _ := strings.Cut(strings.TrimPrefix(m.Body, "!"), " ")
+	name = strings.ToLower(name)
+	if name == "" {
+		return
+	}
+
+	inv, err := b.cmdRepo.Find(m.ConversationID, m.SenderID, name)
+	if err != nil {
+		log.Printf("Failed to look up command !%s in %s: %v", name, m.ConversationID, err)
+		return
+	}
+	if inv == nil || !inv.Command.Allows(inv.CallerLevel) {
+		return
+	}
+	uses, err := b.cmdRepo.Claim(inv.Command.ID)
+	if err != nil {
+		log.Printf("Failed to run command !%s in %s: %v", name, m.ConversationID, err)
+		return
+	}
+	if uses == 0 {
+		return
+	}
+
+	user := "there"
+	if u, err := b.userRepo.GetByID(m.SenderID); err == nil {
+		user = u.Mention()
+	}
+	b.post(m.ConversationID, inv.Command.Render(user, inv.ChannelTitle, strings.TrimSpace(args), uses))
+}
+
+// welcome greets a user on their first message in a channel's chat, if the
+// channel has a welcome message
+func (b *Bot) welcome(m *models.Message) {
+	w, err := b.modRepo.ClaimWelcome(m.ConversationID, m.SenderID, m.ID)
+	if err != nil {
+		log.Printf("Failed to check welcome for %s: %v", m.ConversationID, err)
+		return
+	}
+	if w == nil {
+		return
+	}
+	if res, err := b.redis.AllowKey("rl:auto_welcome:"+w.ChannelID.String(), 1.0/welcomeEverySec, welcomeBurst); err == nil && !res.Allowed {
+		return
+	}
+
+	if strings.Contains(w.Body, "{user}") {
+		name := "there"
+		if u, err := b.userRepo.GetByID(m.SenderID); err == nil {
+			name = u.Mention()
+		}
+		w.Body = strings.ReplaceAll(w.Body, "{user}", name)
+	}
+	b.post(w.ConversationID, w.Body)
+}
+
+// runAnnouncements posts the channels' announcements as they fall due
+func (b *Bot) runAnnouncements() {
+	ticker := time.NewTicker(announceEvery)
+	defer ticker.Stop()
+	for range ticker.C {
+		due, err := b.modRepo.ClaimAnnouncements(b.botUser)
+		if err != nil {
+			log.Printf("Failed to claim announcements: %v", err)
+			continue
+		}
+		for _, a := range due {
+			b.post(a.ConversationID, a.Body)
+		}
+	}
+}
+
+// post sends body to a chat as the bot
+func (b *Bot) post(conversationID uuid.UUID, body string) {
+	now := time.Now()
+	m := &models.Message{
+		ID:             uuid.New(),
+		ConversationID: conversationID,
+		SenderID:       b.botUser,
+		Body:           body,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := b.msgRepo.Create(m); err != nil {
+		log.Printf("Failed to post bot message in %s: %v", conversationID, err)
+		return
+	}
+	b.redis.PublishMessage(models.WSMessage{Event: models.EventMessageNew, Payload: m})
 }
 
 func ptrString(s string) *string { return &s }
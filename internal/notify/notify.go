@@ -0,0 +1,96 @@
+// Package notify decides whether a notification reaches a user. Every
+// delivery channel (email, push, in-app) asks Decide, so conversation mutes,
+// do not disturb and notification preferences apply the same way everywhere.
+package notify
+
+// Kind is what a notification is about
+type Kind string
+
+const (
+	// KindMention is a message that mentions the user. Mentions keep: one
+	// held back now can still go out in a later digest.
+	KindMention Kind = "mention"
+	// KindChannelLive is a followed channel going live. It is only worth
+	// sending while the stream is on, so it is never held back.
+	KindChannelLive Kind = "channel_live"
+)
+
+// Channel is how a notification is delivered
+type Channel string
+
+const (
+	Email Channel = "email"
+	Push  Channel = "push"
+	// InApp notifications wait in the app until the user looks; they never
+	// interrupt, so do not disturb and being online don't hold them back.
+	InApp Channel = "in_app"
+)
+
+// Recipient is the state of the user a notification is for
+type Recipient struct {
+	// Wants is whether the user's preferences allow the kind on the channel
+	Wants bool
+	// ConversationMuted is whether the user muted notifications from the
+	// conversation the notification comes from
+	ConversationMuted bool
+	// DoNotDisturb is whether the user has do not disturb on
+	DoNotDisturb bool
+	// Online is whether the user is connected and sees mentions as they come
+	Online bool
+}
+
+// Outcome is what to do with a notification
+type Outcome int
+
+const (
+	// Deliver sends the notification now
+	Deliver Outcome = iota
+	// Defer holds the notification back; ask again later
+	Defer
+	// Drop discards the notification
+	Drop
+)
+
+// Reason explains an outcome other than Deliver
+type Reason string
+
+const (
+	ReasonPreference   Reason = "preference"
+	ReasonMuted        Reason = "conversation_muted"
+	ReasonDoNotDisturb Reason = "do_not_disturb"
+	ReasonOnline       Reason = "online"
+)
+
+// Decision is the result of Decide. Reason is empty when Outcome is Deliver.
+type Decision struct {
+	Outcome Outcome
+	Reason  Reason
+}
+
+// Decide tells whether to send a notification of kind over ch to r.
+// Preferences and conversation mutes drop it. Do not disturb holds back
+// email and push; online users get mentions in the app, so email and push
+// for those wait too. What is held back is deferred if the kind keeps and
+// dropped otherwise.
+func Decide(kind Kind, ch Channel, r Recipient) Decision {
+	switch {
+	case !r.Wants:
+		return Decision{Drop, ReasonPreference}
+	case r.ConversationMuted:
+		return Decision{Drop, ReasonMuted}
+	case ch == InApp:
+		return Decision{Deliver, ""}
+	case r.DoNotDisturb:
+		return hold(kind, ReasonDoNotDisturb)
+	case r.Online && kind == KindMention:
+		return hold(kind, ReasonOnline)
+	}
+	return Decision{Deliver, ""}
+}
+
+func hold(kind Kind, reason Reason) Decision {
+	if kind == KindMention {
+		return Decision{Defer, reason}
+	}
+	return Decision{Drop, reason}
+}
@@ -0,0 +1,34 @@
+package notify
+
+import "testing"
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Kind
+		ch   Channel
+		r    Recipient
+		want Decision
+	}{
+		{"deliver", KindMention, Email, Recipient{Wants: true}, Decision{Deliver, ""}},
+		{"preference off", KindMention, Push, Recipient{}, Decision{Drop, ReasonPreference}},
+		{"preference off in app", KindMention, InApp, Recipient{}, Decision{Drop, ReasonPreference}},
+		{"muted", KindMention, Email, Recipient{Wants: true, ConversationMuted: true}, Decision{Drop, ReasonMuted}},
+		{"muted in app", KindMention, InApp, Recipient{Wants: true, ConversationMuted: true}, Decision{Drop, ReasonMuted}},
+		{"muted beats dnd", KindMention, Push, Recipient{Wants: true, ConversationMuted: true, DoNotDisturb: true}, Decision{Drop, ReasonMuted}},
+		{"dnd defers mention email", KindMention, Email, Recipient{Wants: true, DoNotDisturb: true}, Decision{Defer, ReasonDoNotDisturb}},
+		{"dnd defers mention push", KindMention, Push, Recipient{Wants: true, DoNotDisturb: true}, Decision{Defer, ReasonDoNotDisturb}},
+		{"dnd drops live email", KindChannelLive, Email, Recipient{Wants: true, DoNotDisturb: true}, Decision{Drop, ReasonDoNotDisturb}},
+		{"dnd drops live push", KindChannelLive, Push, Recipient{Wants: true, DoNotDisturb: true}, Decision{Drop, ReasonDoNotDisturb}},
+		{"dnd keeps in app", KindChannelLive, InApp, Recipient{Wants: true, DoNotDisturb: true}, Decision{Deliver, ""}},
+		{"online defers mention email", KindMention, Email, Recipient{Wants: true, Online: true}, Decision{Defer, ReasonOnline}},
+		{"online defers mention push", KindMention, Push, Recipient{Wants: true, Online: true}, Decision{Defer, ReasonOnline}},
+		{"online mention in app", KindMention, InApp, Recipient{Wants: true, Online: true}, Decision{Deliver, ""}},
+		{"online live email", KindChannelLive, Email, Recipient{Wants: true, Online: true}, Decision{Deliver, ""}},
+	}
+	for _, tt := range tests {
+		if got := Decide(tt.kind, tt.ch, tt.r); got != tt.want {
+			t.Errorf("%s: Decide(%s, %s, %+v) = %+v, want %+v", tt.name, tt.kind, tt.ch, tt.r, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package openapi builds an OpenAPI 3 document from the router's registered
+// routes plus per-route descriptions, so the published spec can never list a
+// route that doesn't exist or miss one that does.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tullo/backend/internal/apierror"
+)
+
+// Operation describes one route. Request and Response are sample values (for
+// example models.LoginRequest{}) whose types are turned into JSON schemas.
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Query lists query parameter names
+	Query    []string
+	Request  any
+	Response any
+	// Status is the success status code, defaulting to 200
+	Status int
+	// Public marks routes that don't require a bearer token
+	Public bool
+}
+
+// Spec collects route descriptions and renders the document
+type Spec struct {
+	title   string
+	version string
+	ops     map[string]Operation
+	// apiKeyHeader, when set, is offered as an alternative to the bearer token
+	apiKeyHeader string
+}
+
+// New creates an empty spec
+func New(title, version string) *Spec {
+	return &Spec{title: title, version: version, ops: map[string]Operation{}}
+}
+
+// SetAPIKeyHeader documents API keys sent in header as an alternative to the
+// bearer token on authenticated routes
+func (s *Spec) SetAPIKeyHeader(header string) {
+	s.apiKeyHeader = header
+}
+
+// Describe attaches documentation to a route, using gin path syntax
+// (e.g. "GET", "/api/v1/channels/:slug")
+func (s *Spec) Describe(method, path string, op Operation) {
+	s.ops[method+" "+path] = op
+}
+
+// Stale returns described routes that are not among routes, sorted, so
+// descriptions left behind by a renamed or removed route can be reported
+func (s *Spec) Stale(routes gin.RoutesInfo) []string {
+	registered := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		registered[r.Method+" "+r.Path] = true
+	}
+	var stale []string
+	for key := range s.ops {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// Build renders the document for the given routes. Routes without a
+// description are still listed, with a summary derived from the handler name.
+func (s *Spec) Build(routes gin.RoutesInfo) map[string]any {
+	schemas := newSchemaSet()
+	paths := map[string]map[string]any{}
+
+	sorted := append(gin.RoutesInfo(nil), routes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+
+	for _, r := range sorted {
+		op, ok := s.ops[r.Method+" "+r.Path]
+		if !ok {
+			op = Operation{Summary: handlerSummary(r.Handler)}
+		}
+
+		path, params := convertPath(r.Path)
+		for _, q := range op.Query {
+			params = append(params, map[string]any{
+				"name": q, "in": "query", "required": false, "schema": map[string]any{"type": "string"},
+			})
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		if op.Response != nil {
+			success["content"] = jsonContent(schemas.ref(reflect.TypeOf(op.Response)))
+		}
+
+		entry := map[string]any{
+			"summary":     op.Summary,
+			"operationId": operationID(r.Method, r.Path),
+			"responses": map[string]any{
+				itoa(status): success,
+				"default": map[string]any{
+					"description": "Error",
+					"content":     jsonContent(map[string]any{"$ref": "#/components/schemas/Envelope"}),
+				},
+			},
+		}
+		if op.Description != "" {
+			entry["description"] = op.Description
+		}
+		if len(op.Tags) > 0 {
+			entry["tags"] = op.Tags
+		}
+		if len(params) > 0 {
+			entry["parameters"] = params
+		}
+		if op.Request != nil {
+			entry["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(schemas.ref(reflect.TypeOf(op.Request))),
+			}
+		}
+		if !op.Public {
+			security := []map[string][]string{{"bearerAuth": {}}}
+			if s.apiKeyHeader != "" {
+				security = append(security, map[string][]string{"apiKeyAuth": {}})
+			}
+			entry["security"] = security
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(r.Method)] = entry
+	}
+
+	schemas.ref(reflect.TypeOf(apierror.Envelope{}))
+
+	securitySchemes := map[string]any{
+		"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+	}
+	if s.apiKeyHeader != "" {
+		securitySchemes["apiKeyAuth"] = map[string]any{"type": "apiKey", "in": "header", "name": s.apiKeyHeader}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": s.title, "version": s.version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas":         schemas.defs,
+			"securitySchemes": securitySchemes,
+		},
+	}
+}
+
+// Handler serves the document built from routes() on every request, so routes
+// registered after the handler are included.
+func (s *Spec) Handler(routes func() gin.RoutesInfo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.Build(routes()))
+	}
+}
+
+// DocsHandler serves a Swagger UI page for the document at specURL
+func DocsHandler(specURL string) gin.HandlerFunc {
+	page := strings.ReplaceAll(swaggerUI, "{{SPEC_URL}}", specURL)
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	}
+}
+
+// convertPath turns "/channels/:slug/*rest" into "/channels/{slug}/{rest}"
+// and returns the matching path parameters
+func convertPath(path string) (string, []map[string]any) {
+	parts := strings.Split(path, "/")
+	var params []map[string]any
+	for i, p := range parts {
+		if p == "" || (p[0] != ':' && p[0] != '*') {
+			continue
+		}
+		name := p[1:]
+		parts[i] = "{" + name + "}"
+		params = append(params, map[string]any{
+			"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// operationID builds a stable identifier such as "get_api_v1_channels_slug"
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, p := range strings.Split(path, "/") {
+		p = strings.TrimLeft(p, ":*")
+		if p != "" {
+			id += "_" + strings.ReplaceAll(p, "-", "_")
+		}
+	}
+	return id
+}
+
+// handlerSummary turns "github.com/x/handlers.(*ChannelHandler).GetChat-fm" into "GetChat"
+func handlerSummary(handler string) string {
+	name := strings.TrimSuffix(handler, "-fm")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Tullo API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "{{SPEC_URL}}", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
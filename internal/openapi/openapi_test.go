@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+type testItem struct {
+	ID      uuid.UUID `json:"id"`
+	Name    *string   `json:"name,omitempty"`
+	Secret  string    `json:"-"`
+	Created time.Time `json:"created_at"`
+}
+
+type testRequest struct {
+	Title string `json:"title" binding:"required"`
+}
+
+func TestConvertPath(t *testing.T) {
+	path, params := convertPath("/api/v1/channels/:slug/mods/:user_id")
+	if path != "/api/v1/channels/{slug}/mods/{user_id}" {
+		t.Errorf("path = %q", path)
+	}
+	if len(params) != 2 || params[0]["name"] != "slug" || params[1]["name"] != "user_id" {
+		t.Errorf("params = %v", params)
+	}
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	s := newSchemaSet()
+	ref := s.ref(reflect.TypeOf(testItem{}))
+	if ref["$ref"] != "#/components/schemas/testItem" {
+		t.Fatalf("ref = %v", ref)
+	}
+	obj := s.defs["testItem"].(map[string]any)
+	props := obj["properties"].(map[string]any)
+	if _, ok := props["Secret"]; ok {
+		t.Error("json:\"-\" field should be skipped")
+	}
+	if props["id"].(map[string]any)["format"] != "uuid" {
+		t.Errorf("id schema = %v", props["id"])
+	}
+	if props["created_at"].(map[string]any)["format"] != "date-time" {
+		t.Errorf("created_at schema = %v", props["created_at"])
+	}
+	required := obj["required"].([]string)
+	if !reflect.DeepEqual(required, []string{"id", "created_at"}) {
+		t.Errorf("required = %v", required)
+	}
+}
+
+func TestGenericSchemaName(t *testing.T) {
+	s := newSchemaSet()
+	ref := s.ref(reflect.TypeOf(pagination.Page[testItem]{}))
+	if ref["$ref"] != "#/components/schemas/PagetestItem" {
+		t.Errorf("ref = %v", ref)
+	}
+}
+
+func TestStale(t *testing.T) {
+	spec := New("Test", "1.0")
+	spec.Describe("GET", "/a", Operation{})
+	spec.Describe("GET", "/b", Operation{})
+	stale := spec.Stale(gin.RoutesInfo{{Method: "GET", Path: "/a"}})
+	if !reflect.DeepEqual(stale, []string{"GET /b"}) {
+		t.Errorf("stale = %v", stale)
+	}
+}
+
+func TestBuildIncludesUndescribedRoutes(t *testing.T) {
+	spec := New("Test", "1.0")
+	spec.Describe("POST", "/things", Operation{Summary: "Create thing", Request: testRequest{}, Response: testItem{}, Status: 201, Public: true})
+
+	doc := spec.Build(gin.RoutesInfo{
+		{Method: "POST", Path: "/things"},
+		{Method: "GET", Path: "/things/:id", Handler: "example.com/handlers.(*ThingHandler).GetThing-fm"},
+	})
+	paths := doc["paths"].(map[string]map[string]any)
+
+	post := paths["/things"]["post"].(map[string]any)
+	if post["summary"] != "Create thing" {
+		t.Errorf("summary = %v", post["summary"])
+	}
+	if _, ok := post["security"]; ok {
+		t.Error("public route should have no security requirement")
+	}
+	if _, ok := post["responses"].(map[string]any)["201"]; !ok {
+		t.Error("expected 201 response")
+	}
+
+	get, ok := paths["/things/{id}"]["get"].(map[string]any)
+	if !ok {
+		t.Fatal("undescribed route missing from spec")
+	}
+	if get["summary"] != "GetThing" {
+		t.Errorf("derived summary = %v", get["summary"])
+	}
+	if _, ok := get["security"]; !ok {
+		t.Error("routes are authenticated by default")
+	}
+}
+
+func TestBuildAPIKeySecurity(t *testing.T) {
+	spec := New("Test", "1.0")
+	spec.SetAPIKeyHeader("X-API-Key")
+	doc := spec.Build(gin.RoutesInfo{{Method: "GET", Path: "/things"}})
+
+	get := doc["paths"].(map[string]map[string]any)["/things"]["get"].(map[string]any)
+	if security := get["security"].([]map[string][]string); len(security) != 2 {
+		t.Errorf("security = %v, want bearer or API key", security)
+	}
+	schemes := doc["components"].(map[string]any)["securitySchemes"].(map[string]any)
+	if key, ok := schemes["apiKeyAuth"].(map[string]any); !ok || key["name"] != "X-API-Key" {
+		t.Errorf("apiKeyAuth = %v", schemes["apiKeyAuth"])
+	}
+}
@@ -0,0 +1,131 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// schemaSet converts Go types to JSON schemas, collecting named structs under
+// components/schemas
+type schemaSet struct {
+	defs map[string]any
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{defs: map[string]any{}}
+}
+
+// ref returns a schema for t, registering named structs as components
+func (s *schemaSet) ref(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := schemaName(t)
+		if _, ok := s.defs[name]; !ok {
+			s.defs[name] = nil // placeholder guards against recursive types
+			s.defs[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func (s *schemaSet) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			// embedded struct: inline its fields
+			if embedded, ok := s.object(derefType(f.Type))["properties"].(map[string]any); ok {
+				for k, v := range embedded {
+					props[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.ref(f.Type)
+		if strings.Contains(f.Tag.Get("binding"), "required") || (f.Type.Kind() != reflect.Pointer && !strings.Contains(opts, "omitempty")) {
+			required = append(required, name)
+		}
+	}
+	obj := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// schemaName strips package paths, including from generic type arguments:
+// "Page[github.com/x/models.Message]" becomes "PageMessage"
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '[' || r == ']' || r == ',' }) {
+		if i := strings.LastIndex(part, "."); i >= 0 {
+			part = part[i+1:]
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
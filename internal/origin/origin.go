@@ -0,0 +1,82 @@
+// Package origin matches browser Origin headers against the configured
+// allow-list. The CORS middleware and the WebSocket upgrader share it so an
+// origin is either allowed everywhere or nowhere.
+package origin
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Matcher reports whether an origin is allowed. A pattern is "*" (any
+// origin), an exact origin such as "https://app.example.com" (scheme, host
+// and port must match), "*.example.com" (any subdomain, any scheme or port)
+// or "https://*.example.com" (any subdomain over https). A wildcard never
+// matches the bare domain; list it separately.
+type Matcher struct {
+	any       bool
+	exact     map[string]bool
+	wildcards []wildcard
+}
+
+type wildcard struct {
+	scheme string // empty matches any scheme
+	suffix string // ".example.com"
+}
+
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{exact: make(map[string]bool)}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimRight(strings.TrimSpace(p), "/"))
+		switch {
+		case p == "":
+		case p == "*":
+			m.any = true
+		case strings.HasPrefix(p, "*."):
+			m.wildcards = append(m.wildcards, wildcard{suffix: p[1:]})
+		case strings.Contains(p, "://*."):
+			scheme, host, _ := strings.Cut(p, "://*.")
+			m.wildcards = append(m.wildcards, wildcard{scheme: scheme, suffix: "." + host})
+		default:
+			m.exact[p] = true
+		}
+	}
+	return m
+}
+
+// AllowsAny reports whether the "*" pattern was configured
+func (m *Matcher) AllowsAny() bool {
+	return m.any
+}
+
+// Allowed reports whether origin matches a pattern. An empty origin never does.
+func (m *Matcher) Allowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if m.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if m.exact[origin] {
+		return true
+	}
+	if len(m.wildcards) == 0 {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := u.Hostname()
+	for _, w := range m.wildcards {
+		if w.scheme != "" && w.scheme != u.Scheme {
+			continue
+		}
+		if len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
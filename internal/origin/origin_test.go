@@ -0,0 +1,32 @@
+package origin
+
+import "testing"
+
+func TestMatcher(t *testing.T) {
+	m := NewMatcher([]string{"https://app.example.com", " http://localhost:3000/ ", "*.tullo.tv", "https://*.example.org"})
+	tests := map[string]bool{
+		"https://app.example.com":     true,
+		"HTTPS://APP.EXAMPLE.COM":     true,
+		"http://app.example.com":      false,
+		"https://app.example.com:444": false,
+		"http://localhost:3000":       true,
+		"http://localhost:5173":       false,
+		"https://live.tullo.tv":       true,
+		"http://a.b.tullo.tv:8080":    true,
+		"https://tullo.tv":            false,
+		"https://eviltullo.tv":        false,
+		"https://x.example.org":       true,
+		"http://x.example.org":        false,
+		"":                            false,
+		"null":                        false,
+	}
+	for origin, want := range tests {
+		if got := m.Allowed(origin); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	if !NewMatcher([]string{"*"}).Allowed("https://anything.example") {
+		t.Error("* should allow any origin")
+	}
+}
@@ -0,0 +1,81 @@
+// Package pagination provides opaque keyset cursors and a shared response
+// envelope so every list endpoint pages the same way.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+)
+
+// Cursor identifies the last row of a page by its sort key and ID, so the next
+// page can continue strictly after it even when timestamps collide.
+type Cursor struct {
+	Time time.Time `json:"t"`
+	ID   uuid.UUID `json:"id"`
+}
+
+// Page is the response envelope for paginated lists
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// Encode returns the opaque string form of a cursor
+func Encode(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode parses an opaque cursor; an empty string yields a nil cursor (first page)
+func Decode(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == uuid.Nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// ParseLimit parses a page size, applying DefaultLimit and clamping to MaxLimit
+func ParseLimit(s string) int {
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
+
+// NewPage builds the envelope from up to limit+1 fetched items. The extra item,
+// if present, only signals that another page exists and is dropped.
+func NewPage[T any](items []T, limit int, cursorOf func(T) Cursor) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	page := Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+		page.NextCursor = Encode(cursorOf(page.Items[limit-1]))
+	}
+	return page
+}
@@ -0,0 +1,64 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{Time: time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC), ID: uuid.New()}
+
+	got, err := Decode(Encode(c))
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !got.Time.Equal(c.Time) || got.ID != c.ID {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", got, c)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	if c, err := Decode(""); err != nil || c != nil {
+		t.Fatalf("empty cursor should decode to nil, got %v, %v", c, err)
+	}
+	for _, s := range []string{"not-base64!", "e30"} {
+		if _, err := Decode(s); err == nil {
+			t.Errorf("Decode(%q) expected error", s)
+		}
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	cursorOf := func(id uuid.UUID) Cursor { return Cursor{ID: id} }
+
+	page := NewPage(ids, 2, cursorOf)
+	if !page.HasMore || len(page.Items) != 2 {
+		t.Fatalf("expected 2 items with more, got %d has_more=%v", len(page.Items), page.HasMore)
+	}
+	next, err := Decode(page.NextCursor)
+	if err != nil || next.ID != ids[1] {
+		t.Fatalf("next cursor should point at last returned item, got %v, %v", next, err)
+	}
+
+	last := NewPage(ids[:2], 2, cursorOf)
+	if last.HasMore || last.NextCursor != "" {
+		t.Fatalf("expected final page, got %+v", last)
+	}
+
+	empty := NewPage[uuid.UUID](nil, 2, cursorOf)
+	if empty.Items == nil {
+		t.Fatal("empty page should serialize items as []")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	cases := map[string]int{"": DefaultLimit, "abc": DefaultLimit, "-1": DefaultLimit, "10": 10, "1000": MaxLimit}
+	for in, want := range cases {
+		if got := ParseLimit(in); got != want {
+			t.Errorf("ParseLimit(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package preview builds link previews for messages: it finds the first link
+// in a message body, fetches the page's OpenGraph metadata in the background
+// and stores it on the message, so clients render rich previews without each
+// of them scraping the page.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tullo/backend/internal/models"
+	"golang.org/x/net/html"
+)
+
+// ErrNoMetadata is returned for pages without a title or OpenGraph tags
+var ErrNoMetadata = errors.New("page has no preview metadata")
+
+// errPrivateAddress rejects links to loopback, private and link-local hosts,
+// so message links cannot make the server probe its own network
+var errPrivateAddress = errors.New("link resolves to a non-public address")
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// FirstURL returns the first http(s) link in body, without trailing
+// punctuation, or "" if there is none
+func FirstURL(body string) string {
+	for _, m := range urlPattern.FindAllString(body, -1) {
+		m = strings.TrimRight(m, ".,;:!?)]}'")
+		if u, err := url.Parse(m); err == nil && u.Host != "" {
+			return m
+		}
+	}
+	return ""
+}
+
+// Fetcher downloads pages and extracts their preview metadata
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewFetcher creates a fetcher that gives up on a page after timeout and
+// reads at most maxBytes of it. Unless allowPrivate is set, hosts resolving
+// to non-public addresses are refused, including after redirects.
+func NewFetcher(timeout time.Duration, maxBytes int64, allowPrivate bool) *Fetcher {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !publicIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       time.Minute,
+	}
+	return &Fetcher{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return errors.New("too many redirects")
+				}
+				return nil
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast())
+}
+
+// Fetch downloads rawURL and returns its preview. Only HTML pages are read.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "TulloBot/1.0 (link preview)")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); ct != "text/html" && ct != "application/xhtml+xml" {
+		return nil, fmt.Errorf("unsupported content type %q", ct)
+	}
+
+	p := Parse(io.LimitReader(resp.Body, f.maxBytes), resp.Request.URL)
+	if p == nil {
+		return nil, ErrNoMetadata
+	}
+	p.URL = rawURL
+	return p, nil
+}
+
+// Parse extracts a preview from an HTML page served at base: the og:* meta
+// tags, falling back to <title> and the description meta tag. It returns nil
+// when the page has no title. Relative image URLs are resolved against base.
+func Parse(r io.Reader, base *url.URL) *models.LinkPreview {
+	p := &models.LinkPreview{}
+	var title, description string
+
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return finish(p, title, description, base)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = title == ""
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				key, content := metaAttrs(z)
+				switch key {
+				case "og:title":
+					p.Title = content
+				case "og:description":
+					p.Description = content
+				case "og:image", "og:image:url":
+					if p.ImageURL == "" {
+						p.ImageURL = content
+					}
+				case "og:site_name":
+					p.SiteName = content
+				case "description":
+					description = content
+				}
+			case "body":
+				// Metadata lives in <head>; stop before reading the page itself
+				return finish(p, title, description, base)
+			}
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		}
+	}
+}
+
+func metaAttrs(z *html.Tokenizer) (key, content string) {
+	for {
+		k, v, more := z.TagAttr()
+		switch string(k) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(v)))
+			}
+		case "content":
+			content = strings.TrimSpace(string(v))
+		}
+		if !more {
+			return key, content
+		}
+	}
+}
+
+func finish(p *models.LinkPreview, title, description string, base *url.URL) *models.LinkPreview {
+	if p.Title == "" {
+		p.Title = strings.Join(strings.Fields(title), " ")
+	}
+	if p.Description == "" {
+		p.Description = description
+	}
+	if p.Title == "" {
+		return nil
+	}
+	p.Title = truncate(p.Title, 300)
+	p.Description = truncate(p.Description, 1000)
+	p.SiteName = truncate(p.SiteName, 100)
+	if p.ImageURL != "" && base != nil {
+		img, err := base.Parse(p.ImageURL)
+		if err != nil || (img.Scheme != "http" && img.Scheme != "https") {
+			p.ImageURL = ""
+		} else {
+			p.ImageURL = img.String()
+		}
+	}
+	return p
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
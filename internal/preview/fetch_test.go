@@ -0,0 +1,92 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFirstURL(t *testing.T) {
+	tests := map[string]string{
+		"no links here":                                "",
+		"see https://example.com/a?b=c.":               "https://example.com/a?b=c",
+		"(http://example.org/x) and https://other.com": "http://example.org/x",
+		"ftp://example.com and https://":               "",
+		"<https://example.com/page>!":                  "https://example.com/page",
+	}
+	for body, want := range tests {
+		if got := FirstURL(body); got != want {
+			t.Errorf("FirstURL(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://news.example.com/story/1")
+
+	og := `<html><head>
+		<title>Fallback</title>
+		<meta property="og:title" content="Big News">
+		<meta property="og:description" content=" It happened. ">
+		<meta property="og:image" content="/img/cover.png">
+		<meta property="og:site_name" content="Example News">
+	</head><body><meta property="og:title" content="ignored"></body></html>`
+	p := Parse(strings.NewReader(og), base)
+	if p == nil || p.Title != "Big News" || p.Description != "It happened." || p.SiteName != "Example News" ||
+		p.ImageURL != "https://news.example.com/img/cover.png" {
+		t.Fatalf("Parse(og) = %+v", p)
+	}
+
+	plain := `<html><head><title>
+		Plain   page </title><meta name="description" content="About it"><meta property="og:image" content="javascript:alert(1)"></head></html>`
+	p = Parse(strings.NewReader(plain), base)
+	if p == nil || p.Title != "Plain page" || p.Description != "About it" || p.ImageURL != "" {
+		t.Fatalf("Parse(plain) = %+v", p)
+	}
+
+	if p := Parse(strings.NewReader("<html><body>no head</body></html>"), base); p != nil {
+		t.Fatalf("Parse(untitled) = %+v, want nil", p)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<head><meta property="og:title" content="Hello"></head>`))
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	f := NewFetcher(time.Second, 1<<16, true)
+	p, err := f.Fetch(ctx, srv.URL+"/moved")
+	if err != nil || p.Title != "Hello" || p.URL != srv.URL+"/moved" {
+		t.Fatalf("Fetch = %+v, %v", p, err)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/image"); err == nil {
+		t.Error("Fetch accepted a non-HTML response")
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/missing"); err == nil {
+		t.Error("Fetch accepted a 404")
+	}
+
+	// The test server listens on loopback, which the default fetcher refuses
+	strict := NewFetcher(time.Second, 1<<16, false)
+	if _, err := strict.Fetch(ctx, srv.URL+"/page"); !errors.Is(err, errPrivateAddress) {
+		t.Errorf("Fetch of a loopback host err = %v, want errPrivateAddress", err)
+	}
+}
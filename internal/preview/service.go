@@ -0,0 +1,141 @@
+package preview
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/repository"
+)
+
+var previewsFetched = metrics.Default.NewCounterVec(
+	"tullo_link_previews_total",
+	"Link preview lookups, by result (fetched, cached, none, failed, dropped).",
+	"result",
+)
+
+// cacheTTL is how long a link's preview, or the lack of one, is remembered,
+// so a link pasted into a busy chat is fetched once
+const cacheTTL = time.Hour
+
+// Service fetches previews for new messages on a pool of workers, stores
+// them on the message and announces them with a message.updated event
+type Service struct {
+	fetcher *Fetcher
+	msgRepo *repository.MessageRepository
+	redis   *cache.RedisClient
+	timeout time.Duration
+	queue   chan models.Message
+}
+
+// NewService creates the service; Start runs its workers. Without Redis
+// previews are stored but neither cached nor announced.
+func NewService(fetcher *Fetcher, msgRepo *repository.MessageRepository, redis *cache.RedisClient, timeout time.Duration, queueSize int) *Service {
+	return &Service{fetcher: fetcher, msgRepo: msgRepo, redis: redis, timeout: timeout, queue: make(chan models.Message, queueSize)}
+}
+
+// Start runs workers goroutines taking messages off the queue
+func (s *Service) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for msg := range s.queue {
+				s.process(msg)
+			}
+		}()
+	}
+}
+
+// Enqueue schedules a preview for msg if its body has a link; encrypted
+// messages are never looked at. It never
+// blocks: when the queue is full the message goes without a preview. A nil
+// Service does nothing, so callers need not check whether previews are on.
+func (s *Service) Enqueue(msg *models.Message) {
+	if s == nil || msg.Kind == models.MessageEncrypted || FirstURL(msg.Body) == "" {
+		return
+	}
+	select {
+	case s.queue <- *msg:
+	default:
+		previewsFetched.Inc("dropped")
+	}
+}
+
+func (s *Service) process(msg models.Message) {
+	link := FirstURL(msg.Body)
+	p, err := s.lookup(link)
+	if err != nil {
+		if !errors.Is(err, ErrNoMetadata) {
+			log.Printf("Link preview for %s failed: %v", link, err)
+		}
+		return
+	}
+
+	updatedAt, err := s.msgRepo.SetPreview(msg.ID, p)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		// Deleted while the page loaded
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to store link preview of message %s: %v", msg.ID, err)
+		return
+	}
+	if s.redis == nil {
+		return
+	}
+	payload := models.WSMessageUpdatedPayload{MessageID: msg.ID, ConversationID: msg.ConversationID, Preview: p, UpdatedAt: updatedAt}
+	if err := s.redis.PublishMessage(models.WSMessage{Event: models.EventMessageUpdated, Payload: payload}); err != nil {
+		log.Printf("Failed to publish preview of message %s: %v", msg.ID, err)
+	}
+}
+
+// lookup returns link's preview from the cache or by fetching it.
+// ErrNoMetadata is cached too, so pages without metadata are not refetched.
+func (s *Service) lookup(link string) (*models.LinkPreview, error) {
+	key := cacheKey(link)
+	if s.redis != nil {
+		if v, err := s.redis.GetString(key); err == nil && v != "" {
+			previewsFetched.Inc("cached")
+			if v == "null" {
+				return nil, ErrNoMetadata
+			}
+			var p models.LinkPreview
+			if err := json.Unmarshal([]byte(v), &p); err == nil {
+				p.URL = link
+				return &p, nil
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	p, err := s.fetcher.Fetch(ctx, link)
+	switch {
+	case errors.Is(err, ErrNoMetadata):
+		previewsFetched.Inc("none")
+	case err != nil:
+		previewsFetched.Inc("failed")
+		return nil, err
+	default:
+		previewsFetched.Inc("fetched")
+	}
+
+	if s.redis != nil {
+		v, _ := json.Marshal(p)
+		if err := s.redis.SetString(key, string(v), cacheTTL); err != nil {
+			log.Printf("Failed to cache link preview: %v", err)
+		}
+	}
+	return p, err
+}
+
+func cacheKey(link string) string {
+	sum := sha256.Sum256([]byte(link))
+	return "preview:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+// Package ratelimit holds the token buckets behind every rate limit: per
+// route, per conversation send, per client IP and per WebSocket connection.
+// Buckets live in Redis so a budget holds across instances; without Redis,
+// or while it errors, each instance falls back to buckets of its own in
+// memory.
+package ratelimit
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tullo/backend/internal/cache"
+	"golang.org/x/time/rate"
+)
+
+// Policy is a token bucket: Rate tokens per second up to Burst. A zero Rate
+// does not limit.
+type Policy struct {
+	Rate  float64
+	Burst int
+}
+
+// Limiter spends one token from the bucket named key, creating it full from
+// p on first use
+type Limiter interface {
+	Allow(key string, p Policy) cache.LimitResult
+}
+
+// IdleTTL is how long an in-memory token bucket must go unused before
+// cleanup may drop it. It is only dropped once it has refilled, so dropping
+// it never hands out extra requests.
+const IdleTTL = 10 * time.Minute
+
+// Buckets is the Limiter used throughout: Redis first, in memory as
+// fallback. Keys are stored under prefix in Redis, so separate Buckets
+// never share a bucket.
+type Buckets struct {
+	redis  *cache.RedisClient
+	prefix string
+
+	mu    sync.Mutex
+	local localBuckets
+}
+
+// New returns Buckets keyed under prefix; a nil redis keeps them in memory
+// only, for state that is per instance anyway
+func New(redis *cache.RedisClient, prefix string) *Buckets {
+	return &Buckets{redis: redis, prefix: prefix, local: make(localBuckets)}
+}
+
+// Allow spends one token from the bucket named key under p
+func (b *Buckets) Allow(key string, p Policy) cache.LimitResult {
+	if p.Rate <= 0 {
+		return cache.LimitResult{Allowed: true}
+	}
+	if b.redis != nil {
+		res, err := b.redis.AllowKey(b.prefix+key, p.Rate, p.Burst)
+		if err == nil {
+			return res
+		}
+		log.Printf("Rate limiter %s: Redis error, using local buckets: %v", b.prefix, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return take(b.local.get(key, p, time.Now()), p)
+}
+
+// Cleanup periodically drops idle local buckets (see IdleTTL)
+func (b *Buckets) Cleanup() {
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			b.mu.Lock()
+			b.local.evictIdle(time.Now())
+			b.mu.Unlock()
+		}
+	}()
+}
+
+// localBuckets are in-memory token buckets that remember when each was last
+// used. The owner guards them with its own mutex.
+type localBuckets map[string]*localBucket
+
+type localBucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// get returns the bucket for key, creating it from p, and marks it used
+func (m localBuckets) get(key string, p Policy, now time.Time) *rate.Limiter {
+	l, ok := m[key]
+	if !ok {
+		l = &localBucket{limiter: rate.NewLimiter(rate.Limit(p.Rate), p.Burst)}
+		m[key] = l
+	}
+	l.lastUsed = now
+	return l.limiter
+}
+
+// evictIdle drops the buckets that are full and unused for IdleTTL and
+// returns how many it dropped
+func (m localBuckets) evictIdle(now time.Time) int {
+	n := 0
+	for key, l := range m {
+		if now.Sub(l.lastUsed) >= IdleTTL && l.limiter.TokensAt(now) >= float64(l.limiter.Burst()) {
+			delete(m, key)
+			n++
+		}
+	}
+	return n
+}
+
+// take spends one token from limiter and reports the remaining quota
+func take(limiter *rate.Limiter, p Policy) cache.LimitResult {
+	now := time.Now()
+	allowed := limiter.AllowN(now, 1)
+	return cache.NewLimitResult(allowed, limiter.TokensAt(now), p.Rate, p.Burst)
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketsLocalFallback(t *testing.T) {
+	b := New(nil, "test:")
+	p := Policy{Rate: 0.001, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow("a", p).Allowed {
+			t.Fatalf("request %d rejected within burst", i)
+		}
+	}
+	if res := b.Allow("a", p); res.Allowed || res.Remaining != 0 || res.RetryAfter <= 0 {
+		t.Errorf("request over burst = %+v, want rejected with a retry delay", res)
+	}
+	if !b.Allow("b", p).Allowed {
+		t.Error("each key should have its own bucket")
+	}
+	for i := 0; i < 5; i++ {
+		if !b.Allow("a", Policy{}).Allowed {
+			t.Fatal("a zero-rate policy should not limit")
+		}
+	}
+}
+
+func TestEvictIdleKeepsBudgets(t *testing.T) {
+	now := time.Now()
+	m := make(localBuckets)
+	m.get("idle", Policy{Rate: 1, Burst: 1}, now)
+	drained := m.get("drained", Policy{Rate: 0.0001, Burst: 1}, now)
+	drained.AllowN(now, 1)
+	m.get("busy", Policy{Rate: 1, Burst: 1}, now.Add(IdleTTL))
+
+	if n := m.evictIdle(now.Add(IdleTTL)); n != 1 {
+		t.Errorf("evicted %d limiters, want 1", n)
+	}
+	if _, ok := m["idle"]; ok {
+		t.Error("idle full limiter should be evicted")
+	}
+	if _, ok := m["drained"]; !ok {
+		t.Error("limiter still refilling must be kept, or its caller gets a fresh budget")
+	}
+	if _, ok := m["busy"]; !ok {
+		t.Error("recently used limiter should be kept")
+	}
+}
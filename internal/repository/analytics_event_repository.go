@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// AnalyticsEventRepository stores the raw client analytics events that
+// channel analytics are computed from
+type AnalyticsEventRepository struct {
+	db *database.DB
+}
+
+func NewAnalyticsEventRepository(db *database.DB) *AnalyticsEventRepository {
+	return &AnalyticsEventRepository{db: db}
+}
+
+// Insert stores a batch of events in one statement. Events for channels that
+// do not exist or are deleted, or for a stream of another channel, are
+// dropped; it returns how many were stored.
+func (r *AnalyticsEventRepository) Insert(events []models.AnalyticsEvent) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	types := make([]string, len(events))
+	channelIDs := make([]uuid.UUID, len(events))
+	// Streams and users are optional; "" stands for NULL
+	streamIDs := make([]string, len(events))
+	userIDs := make([]string, len(events))
+	properties := make([]string, len(events))
+	occurredAt := make([]time.Time, len(events))
+	receivedAt := make([]time.Time, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+		channelIDs[i] = e.ChannelID
+		if e.StreamID != nil {
+			streamIDs[i] = e.StreamID.String()
+		}
+		if e.UserID != nil {
+			userIDs[i] = e.UserID.String()
+		}
+		props := e.Properties
+		if props == nil {
+			props = map[string]interface{}{}
+		}
+		raw, err := json.Marshal(props)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode analytics event: %w", err)
+		}
+		properties[i] = string(raw)
+		occurredAt[i] = e.OccurredAt
+		receivedAt[i] = e.ReceivedAt
+	}
+
+	query := `
+		INSERT INTO analytics_events (type, channel_id, stream_id, user_id, properties, occurred_at, received_at)
+		SELECT e.type, e.channel_id, NULLIF(e.stream_id, '')::uuid, NULLIF(e.user_id, '')::uuid,
+			e.properties::jsonb, e.occurred_at, e.received_at
+		FROM unnest($1::text[], $2::uuid[], $3::text[], $4::text[], $5::text[], $6::timestamp[], $7::timestamp[])
+			AS e(type, channel_id, stream_id, user_id, properties, occurred_at, received_at)
+		INNER JOIN channels ch ON ch.id = e.channel_id AND ch.deleted_at IS NULL
+		WHERE e.stream_id = ''
+			OR EXISTS(SELECT 1 FROM streams s WHERE s.id = NULLIF(e.stream_id, '')::uuid AND s.channel_id = e.channel_id)
+	`
+	tag, err := r.db.Exec(query, types, channelIDs, streamIDs, userIDs, properties, occurredAt, receivedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store analytics events: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// DeleteBefore deletes events that occurred before before and returns how
+// many it deleted
+func (r *AnalyticsEventRepository) DeleteBefore(before time.Time) (int64, error) {
+	tag, err := r.db.Exec(`DELETE FROM analytics_events WHERE occurred_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete analytics events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestAnalyticsEventInsert(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	streams := NewStreamRepository(db)
+	events := NewAnalyticsEventRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "streamer@example.com", DisplayName: "Streamer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(owner); err != nil {
+		t.Fatal(err)
+	}
+	var chans []*models.Channel
+	for _, slug := range []string{"measured", "other"} {
+		ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: slug, Title: slug, CreatedAt: now, UpdatedAt: now}
+		if err := channels.Create(ch); err != nil {
+			t.Fatal(err)
+		}
+		chans = append(chans, ch)
+	}
+	s := &models.Stream{ID: uuid.New(), ChannelID: chans[0].ID, Status: "live", CreatedAt: now, UpdatedAt: now}
+	if err := streams.Create(s); err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := uuid.New()
+	batch := []models.AnalyticsEvent{
+		{Type: models.AnalyticsPlayerStart, ChannelID: chans[0].ID, StreamID: &s.ID, UserID: &owner.ID, Properties: map[string]interface{}{"quality": "720p"}, OccurredAt: now, ReceivedAt: now},
+		{Type: models.AnalyticsChatOpen, ChannelID: chans[0].ID, OccurredAt: now, ReceivedAt: now},
+		// Unknown channel, and a stream of another channel
+		{Type: models.AnalyticsChatOpen, ChannelID: unknown, OccurredAt: now, ReceivedAt: now},
+		{Type: models.AnalyticsPlayerStart, ChannelID: chans[1].ID, StreamID: &s.ID, OccurredAt: now, ReceivedAt: now},
+	}
+	n, err := events.Insert(batch)
+	if err != nil || n != 2 {
+		t.Fatalf("Insert = %d, %v; want 2 stored", n, err)
+	}
+
+	var quality string
+	if err := db.QueryRow(`SELECT properties->>'quality' FROM analytics_events WHERE stream_id = $1`, s.ID).Scan(&quality); err != nil || quality != "720p" {
+		t.Errorf("stored quality = %q, %v", quality, err)
+	}
+
+	deleted, err := events.DeleteBefore(now.Add(time.Minute))
+	if err != nil || deleted != 2 {
+		t.Errorf("DeleteBefore = %d, %v; want 2", deleted, err)
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tullo/backend/internal/database"
+)
+
+// AnalyticsRepository maintains the analytics_daily rollups
+type AnalyticsRepository struct {
+	db *database.DB
+}
+
+func NewAnalyticsRepository(db *database.DB) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// RollupDay recomputes every metric for the UTC day containing day. It is
+// idempotent, so the current day can be rolled up repeatedly as it fills in.
+func (r *AnalyticsRepository) RollupDay(day time.Time) error {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+
+	query := `
+		INSERT INTO analytics_daily (day, metric, value, updated_at)
+		SELECT $1::date, metric, value, NOW() FROM (
+			SELECT 'messages_sent' AS metric, COUNT(*) AS value FROM (
+				SELECT sender_id FROM messages WHERE created_at >= $1 AND created_at < $2
+				UNION ALL
+				SELECT sender_id FROM messages_archive WHERE created_at >= $1 AND created_at < $2
+			) m
+			UNION ALL
+			SELECT 'active_senders', COUNT(DISTINCT sender_id) FROM (
+				SELECT sender_id FROM messages WHERE created_at >= $1 AND created_at < $2
+				UNION ALL
+				SELECT sender_id FROM messages_archive WHERE created_at >= $1 AND created_at < $2
+			) m
+			UNION ALL
+			SELECT 'new_users', COUNT(*) FROM users WHERE created_at >= $1 AND created_at < $2
+			UNION ALL
+			SELECT 'conversations_created', COUNT(*) FROM conversations WHERE created_at >= $1 AND created_at < $2
+			UNION ALL
+			SELECT 'streams_started', COUNT(*) FROM streams WHERE started_at >= $1 AND started_at < $2
+			UNION ALL
+			SELECT 'channel_follows', COUNT(*) FROM channel_follows WHERE created_at >= $1 AND created_at < $2
+			UNION ALL
+			SELECT 'link_clicks', COALESCE(SUM(clicks), 0) FROM channel_link_clicks WHERE day = $1::date
+		) totals
+		ON CONFLICT (day, metric) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+	`
+	if _, err := r.db.Exec(query, start, end); err != nil {
+		return fmt.Errorf("failed to roll up analytics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+const announcementColumns = `id, title, body, audience, publish_at, published_at, expires_at, created_by, created_at`
+
+// AnnouncementRepository stores admins' platform-wide announcements
+type AnnouncementRepository struct {
+	db *database.DB
+}
+
+func NewAnnouncementRepository(db *database.DB) *AnnouncementRepository {
+	return &AnnouncementRepository{db: db}
+}
+
+// Create stores an announcement. With publishNow it is marked published
+// right away, for the caller to deliver; otherwise ClaimDue picks it up at
+// its PublishAt.
+func (r *AnnouncementRepository) Create(a *models.Announcement, publishNow bool) error {
+	query := `
+		INSERT INTO announcements (id, title, body, audience, publish_at, published_at, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $6 THEN NOW() END, $7, $8)
+		RETURNING published_at, created_at
+	`
+	err := r.db.QueryRow(query, a.ID, a.Title, a.Body, a.Audience, a.PublishAt, publishNow, a.ExpiresAt, a.CreatedBy).
+		Scan(&a.PublishedAt, &a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create announcement: %w", err)
+	}
+	return nil
+}
+
+// ClaimDue marks the announcements whose time has come as published and
+// returns them for delivery, without their author. Ones that expired before
+// going out are skipped.
+func (r *AnnouncementRepository) ClaimDue() ([]models.Announcement, error) {
+	query := `
+		UPDATE announcements SET published_at = NOW()
+		WHERE published_at IS NULL AND publish_at <= NOW()
+		AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING id, title, body, audience, publish_at, published_at, expires_at, NULL::uuid, created_at
+	`
+	return r.list(query)
+}
+
+// List returns the most recent announcements for admins, scheduled ones
+// included, latest publish_at first
+func (r *AnnouncementRepository) List(limit int) ([]models.Announcement, error) {
+	query := `SELECT ` + announcementColumns + ` FROM announcements ORDER BY publish_at DESC, id DESC LIMIT $1`
+	return r.list(query, limit)
+}
+
+// ListActive returns the published, unexpired announcements for userID's
+// audience, newest first
+func (r *AnnouncementRepository) ListActive(userID uuid.UUID) ([]models.Announcement, error) {
+	query := `
+		SELECT id, title, body, audience, publish_at, published_at, expires_at, NULL::uuid, created_at
+		FROM announcements a
+		WHERE published_at IS NOT NULL
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (audience = 'all' OR (audience = 'streamers' AND EXISTS (
+			SELECT 1 FROM channels ch WHERE ch.owner_id = $1 AND ch.deleted_at IS NULL
+		)))
+		ORDER BY published_at DESC, id DESC
+		LIMIT 50
+	`
+	return r.list(query, userID)
+}
+
+// Delete removes an announcement, cancelling it if it has not gone out yet,
+// and reports whether it existed
+func (r *AnnouncementRepository) Delete(id uuid.UUID) (bool, error) {
+	tag, err := r.db.Exec(`DELETE FROM announcements WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete announcement: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *AnnouncementRepository) list(query string, args ...interface{}) ([]models.Announcement, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list announcements: %w", err)
+	}
+	defer rows.Close()
+
+	announcements := []models.Announcement{}
+	for rows.Next() {
+		var a models.Announcement
+		if err := rows.Scan(&a.ID, &a.Title, &a.Body, &a.Audience, &a.PublishAt, &a.PublishedAt, &a.ExpiresAt, &a.CreatedBy, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan announcement: %w", err)
+		}
+		announcements = append(announcements, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list announcements: %w", err)
+	}
+	return announcements, nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestAnnouncements(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	announcements := NewAnnouncementRepository(db)
+
+	now := time.Now()
+	viewer := &models.User{ID: uuid.New(), Email: "announce-viewer@example.com", DisplayName: "Viewer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	streamer := &models.User{ID: uuid.New(), Email: "announce-streamer@example.com", DisplayName: "Streamer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	for _, u := range []*models.User{viewer, streamer} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := channels.Create(&models.Channel{ID: uuid.New(), OwnerID: streamer.ID, Slug: "announced", Title: "Announced", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(audience string, publishAt time.Time, publishNow bool) *models.Announcement {
+		t.Helper()
+		a := &models.Announcement{ID: uuid.New(), Title: "Maintenance", Body: "Soon", Audience: audience, PublishAt: publishAt}
+		if err := announcements.Create(a, publishNow); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	everyone := create(models.AudienceAll, now, true)
+	streamers := create(models.AudienceStreamers, now.Add(-time.Minute), false)
+	later := create(models.AudienceAll, now.Add(time.Hour), false)
+
+	due, err := announcements.ClaimDue()
+	if err != nil || len(due) != 1 || due[0].ID != streamers.ID || due[0].PublishedAt == nil {
+		t.Fatalf("ClaimDue = %+v, %v; want only the due streamer announcement", due, err)
+	}
+	if due, err := announcements.ClaimDue(); err != nil || len(due) != 0 {
+		t.Errorf("second ClaimDue = %+v, %v; want nothing", due, err)
+	}
+
+	ids := func(list []models.Announcement) map[uuid.UUID]bool {
+		m := map[uuid.UUID]bool{}
+		for _, a := range list {
+			m[a.ID] = true
+		}
+		return m
+	}
+	if got, err := announcements.ListActive(viewer.ID); err != nil || len(got) != 1 || !ids(got)[everyone.ID] {
+		t.Errorf("viewer's announcements = %+v, %v; want the one for everyone", got, err)
+	}
+	if got, err := announcements.ListActive(streamer.ID); err != nil || len(got) != 2 || ids(got)[later.ID] {
+		t.Errorf("streamer's announcements = %+v, %v; want both sent ones", got, err)
+	}
+	if got, err := announcements.List(10); err != nil || len(got) != 3 {
+		t.Errorf("List = %d announcements, %v; want 3", len(got), err)
+	}
+}
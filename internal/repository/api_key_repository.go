@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrAPIKeyNotFound is returned for unknown, revoked, expired or foreign keys
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// apiKeyTouchInterval limits how often last_used_at is written for a key
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyRepository stores API keys by hash; revoked keys are kept so their
+// last use stays visible in backups and exports
+type APIKeyRepository struct {
+	db *database.DB
+}
+
+func NewAPIKeyRepository(db *database.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, user_id, name, hint, scopes, created_at, last_used_at, expires_at`
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	k := &models.APIKey{}
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Hint, &k.Scopes, &k.CreatedAt, &k.LastUsedAt, &k.ExpiresAt)
+	return k, err
+}
+
+// Create stores key with the hash of its secret
+func (r *APIKeyRepository) Create(key *models.APIKey, keyHash string) error {
+	query := `
+		INSERT INTO api_keys (id, user_id, name, hint, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+	err := r.db.QueryRow(query, key.ID, key.UserID, key.Name, key.Hint, keyHash, key.Scopes, key.ExpiresAt).Scan(&key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns the user's keys that are not revoked, newest first.
+// Expired keys are included so their owner sees why an integration stopped.
+func (r *APIKeyRepository) ListByUser(userID uuid.UUID) ([]models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Get returns one of the user's keys that is not revoked
+func (r *APIKeyRepository) Get(id, userID uuid.UUID) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	k, err := scanAPIKey(r.db.QueryRow(query, id, userID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return k, nil
+}
+
+// Update renames a key and/or replaces its scopes; nil leaves a field as is
+func (r *APIKeyRepository) Update(id, userID uuid.UUID, name *string, scopes []string) (*models.APIKey, error) {
+	query := `
+		UPDATE api_keys
+		SET name = COALESCE($3, name), scopes = COALESCE($4, scopes)
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		RETURNING ` + apiKeyColumns
+	k, err := scanAPIKey(r.db.QueryRow(query, id, userID, name, scopes))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update api key: %w", err)
+	}
+	return k, nil
+}
+
+// Revoke disables a key for good
+func (r *APIKeyRepository) Revoke(id, userID uuid.UUID) error {
+	tag, err := r.db.Exec(`UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the usable key with keyHash: not revoked, not expired
+// and owned by an active user. It records the use at most once a minute.
+func (r *APIKeyRepository) Authenticate(keyHash string) (*models.APIKey, error) {
+	query := `
+		WITH k AS (
+			SELECT k.id, k.user_id, k.name, k.hint, k.scopes, k.created_at, k.last_used_at, k.expires_at, u.role
+			FROM api_keys k
+			JOIN users u ON u.id = k.user_id
+			WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+			AND (k.expires_at IS NULL OR k.expires_at > NOW())
+			AND u.deleted_at IS NULL
+		), touched AS (
+			UPDATE api_keys SET last_used_at = NOW()
+			WHERE id IN (SELECT id FROM k WHERE last_used_at IS NULL OR last_used_at < NOW() - $2 * INTERVAL '1 second')
+		)
+		SELECT ` + apiKeyColumns + `, role FROM k
+	`
+	k := &models.APIKey{}
+	err := r.db.QueryRow(query, keyHash, apiKeyTouchInterval.Seconds()).Scan(
+		&k.ID, &k.UserID, &k.Name, &k.Hint, &k.Scopes, &k.CreatedAt, &k.LastUsedAt, &k.ExpiresAt, &k.OwnerRole,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate api key: %w", err)
+	}
+	return k, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	keys := NewAPIKeyRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "bot-owner@example.com", DisplayName: "Owner", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	other := &models.User{ID: uuid.New(), Email: "other@example.com", DisplayName: "Other", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	for _, u := range []*models.User{owner, other} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := &models.APIKey{ID: uuid.New(), UserID: owner.ID, Name: "bot", Hint: "tlk_abcdef", Scopes: []string{models.ScopeRead}}
+	if err := keys.Create(key, "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+	past := now.Add(-time.Hour)
+	expired := &models.APIKey{ID: uuid.New(), UserID: owner.ID, Name: "old", Hint: "tlk_ghijkl", Scopes: []string{models.ScopeRead}, ExpiresAt: &past}
+	if err := keys.Create(expired, "hash-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := keys.Authenticate("hash-1")
+	if err != nil || got.ID != key.ID || got.UserID != owner.ID {
+		t.Fatalf("Authenticate = %+v, %v", got, err)
+	}
+	if got, _ := keys.Get(key.ID, owner.ID); got == nil || got.LastUsedAt == nil {
+		t.Errorf("last_used_at not recorded: %+v", got)
+	}
+	if _, err := keys.Authenticate("hash-2"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expired key err = %v, want ErrAPIKeyNotFound", err)
+	}
+
+	if _, err := keys.Get(key.ID, other.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("foreign Get err = %v, want ErrAPIKeyNotFound", err)
+	}
+	updated, err := keys.Update(key.ID, owner.ID, nil, []string{models.ScopeRead, models.ScopeWrite})
+	if err != nil || updated.Name != "bot" || !updated.HasScope(models.ScopeWrite) {
+		t.Fatalf("Update = %+v, %v", updated, err)
+	}
+
+	list, err := keys.ListByUser(owner.ID)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListByUser = %+v, %v", list, err)
+	}
+
+	if err := keys.Revoke(key.ID, other.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("foreign Revoke err = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := keys.Revoke(key.ID, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate("hash-1"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("revoked key err = %v, want ErrAPIKeyNotFound", err)
+	}
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrAssetNotFound is returned by Get for an unknown hash
+var ErrAssetNotFound = errors.New("asset not found")
+
+// AssetRepository stores uploaded images by the hash of their content (see
+// package asset)
+type AssetRepository struct {
+	db *database.DB
+}
+
+func NewAssetRepository(db *database.DB) *AssetRepository {
+	return &AssetRepository{db: db}
+}
+
+// Save stores an asset. Saving one that exists already does nothing. Assets
+// are never deleted: clients may still hold the URLs of replaced images.
+func (r *AssetRepository) Save(a *models.Asset) error {
+	_, err := r.db.Exec(`
+		INSERT INTO assets (hash, content_type, data)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (hash) DO NOTHING
+	`, a.Hash, a.ContentType, a.Data)
+	if err != nil {
+		return fmt.Errorf("failed to save asset: %w", err)
+	}
+	return nil
+}
+
+// Get returns the asset with hash
+func (r *AssetRepository) Get(hash string) (*models.Asset, error) {
+	a := &models.Asset{Hash: hash}
+	err := r.db.QueryRow(`SELECT content_type, data FROM assets WHERE hash = $1`, hash).Scan(&a.ContentType, &a.Data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset: %w", err)
+	}
+	return a, nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrQuotaExceeded is returned by Create when the attachment would take the
+// conversation over its storage quota
+var ErrQuotaExceeded = errors.New("attachment storage quota exceeded")
+
+// AttachmentRepository keeps track of the files stored for conversations.
+// The files themselves live in the storage backend under their StorageKey.
+type AttachmentRepository struct {
+	db *database.DB
+}
+
+func NewAttachmentRepository(db *database.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// Create records an attachment unless it would take the conversation's
+// attachments over quotaBytes (0 for no quota). Creations in the same
+// conversation are serialized, so parallel uploads cannot overshoot it.
+func (r *AttachmentRepository) Create(a *models.Attachment, quotaBytes int64) error {
+	ctx := context.Background()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM conversations WHERE id = $1 FOR UPDATE`, a.ConversationID); err != nil {
+		return fmt.Errorf("failed to lock conversation: %w", err)
+	}
+	if quotaBytes > 0 {
+		var used int64
+		err := tx.QueryRow(ctx, `SELECT COALESCE(SUM(size_bytes), 0) FROM attachments WHERE conversation_id = $1`, a.ConversationID).Scan(&used)
+		if err != nil {
+			return fmt.Errorf("failed to sum attachments: %w", err)
+		}
+		if used+a.SizeBytes > quotaBytes {
+			return ErrQuotaExceeded
+		}
+	}
+
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO attachments (id, conversation_id, message_id, uploader_id, storage_key, content_type, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`, a.ID, a.ConversationID, a.MessageID, a.UploaderID, a.StorageKey, a.ContentType, a.SizeBytes).Scan(&a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// Usage sums up a conversation's attachments. With a retention, NextExpiry
+// is when the oldest attachment expires; the caller fills in the quota.
+func (r *AttachmentRepository) Usage(conversationID uuid.UUID, retention time.Duration) (*models.StorageUsage, error) {
+	usage := &models.StorageUsage{ConversationID: conversationID, RetentionDays: int(retention / (24 * time.Hour))}
+	var oldest *time.Time
+	err := r.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(size_bytes), 0), MIN(created_at)
+		FROM attachments WHERE conversation_id = $1
+	`, conversationID).Scan(&usage.Attachments, &usage.UsedBytes, &oldest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	if oldest != nil && retention > 0 {
+		expiry := oldest.Add(retention)
+		usage.NextExpiry = &expiry
+	}
+	return usage, nil
+}
+
+// ExpireBefore removes up to batchSize attachments created before the cutoff,
+// oldest first, and returns them so their files can be deleted
+func (r *AttachmentRepository) ExpireBefore(before time.Time, batchSize int) ([]models.Attachment, error) {
+	rows, err := r.db.Query(`
+		DELETE FROM attachments
+		WHERE id IN (SELECT id FROM attachments WHERE created_at < $1 ORDER BY created_at LIMIT $2)
+		RETURNING id, conversation_id, message_id, uploader_id, storage_key, content_type, size_bytes, created_at
+	`, before, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var expired []models.Attachment
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.ConversationID, &a.MessageID, &a.UploaderID, &a.StorageKey, &a.ContentType, &a.SizeBytes, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		expired = append(expired, a)
+	}
+	return expired, rows.Err()
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestAttachments(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	attachments := NewAttachmentRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "attachments@example.com", DisplayName: "attachments", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	upload := func(size int64) error {
+		return attachments.Create(&models.Attachment{ConversationID: conv.ID, UploaderID: &u.ID, StorageKey: uuid.NewString(), ContentType: "image/png", SizeBytes: size}, 100)
+	}
+
+	if err := upload(60); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(50); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("upload over the quota = %v, want ErrQuotaExceeded", err)
+	}
+	if err := upload(40); err != nil {
+		t.Errorf("upload filling the quota = %v", err)
+	}
+
+	usage, err := attachments.Usage(conv.ID, 24*time.Hour)
+	if err != nil || usage.Attachments != 2 || usage.UsedBytes != 100 || usage.RetentionDays != 1 || usage.NextExpiry == nil {
+		t.Fatalf("Usage = %+v, %v; want 2 attachments of 100 bytes expiring", usage, err)
+	}
+
+	expired, err := attachments.ExpireBefore(time.Now().Add(time.Minute), 1)
+	if err != nil || len(expired) != 1 || expired[0].SizeBytes != 60 || expired[0].StorageKey == "" {
+		t.Fatalf("ExpireBefore = %+v, %v; want the oldest attachment", expired, err)
+	}
+	if usage, err := attachments.Usage(conv.ID, 0); err != nil || usage.UsedBytes != 40 || usage.NextExpiry != nil {
+		t.Errorf("Usage after expiry = %+v, %v", usage, err)
+	}
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// AuthEventRepository stores the users' security logs
+type AuthEventRepository struct {
+	db *database.DB
+}
+
+func NewAuthEventRepository(db *database.DB) *AuthEventRepository {
+	return &AuthEventRepository{db: db}
+}
+
+// Create records an event; its ID and time are set when missing
+func (r *AuthEventRepository) Create(e *models.AuthEvent) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	query := `
+		INSERT INTO auth_events (id, user_id, event, ip, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := r.db.Exec(query, e.ID, e.UserID, e.Event, e.IP, e.UserAgent, e.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create auth event: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns a page of the user's events, newest first
+func (r *AuthEventRepository) ListByUser(userID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.AuthEvent, error) {
+	if limit <= 0 {
+		limit = pagination.DefaultLimit
+	}
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+	query := `SELECT id, user_id, event, ip, user_agent, created_at FROM auth_events
+		WHERE user_id = $1 AND ($2::timestamp IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC LIMIT $4`
+	rows, err := r.db.Query(query, userID, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuthEvent{}
+	for rows.Next() {
+		var e models.AuthEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Event, &e.IP, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	return events, nil
+}
+
+// DeleteBefore deletes events older than before and returns how many
+func (r *AuthEventRepository) DeleteBefore(before time.Time) (int64, error) {
+	tag, err := r.db.Exec(`DELETE FROM auth_events WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete auth events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
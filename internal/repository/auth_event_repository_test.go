@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+func TestAuthEvents(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	events := NewAuthEventRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	ada, bob := newUser("ada"), newUser("bob")
+
+	record := func(u *models.User, event string, at time.Time) {
+		e := &models.AuthEvent{UserID: u.ID, Event: event, IP: "203.0.113.7", UserAgent: "curl/8.0", CreatedAt: at}
+		if err := events.Create(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(ada, "login_failed", now.Add(-100*24*time.Hour))
+	record(ada, "registered", now.Add(-3*time.Minute))
+	record(ada, "login_succeeded", now.Add(-2*time.Minute))
+	record(ada, "session_revoked", now.Add(-time.Minute))
+	record(bob, "login_failed", now)
+
+	page, err := events.ListByUser(ada.ID, 2, nil)
+	if err != nil || len(page) != 3 {
+		t.Fatalf("first page = %d events, %v; want limit+1", len(page), err)
+	}
+	if page[0].Event != "session_revoked" || page[1].Event != "login_succeeded" {
+		t.Errorf("first page = %s, %s; want newest first", page[0].Event, page[1].Event)
+	}
+	rest, err := events.ListByUser(ada.ID, 2, &pagination.Cursor{Time: page[1].CreatedAt, ID: page[1].ID})
+	if err != nil || len(rest) != 2 || rest[0].Event != "registered" {
+		t.Fatalf("second page = %+v, %v", rest, err)
+	}
+
+	n, err := events.DeleteBefore(now.Add(-90 * 24 * time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("DeleteBefore = %d, %v; want 1", n, err)
+	}
+	if all, _ := events.ListByUser(ada.ID, 10, nil); len(all) != 3 {
+		t.Errorf("after cleanup ada has %d events, want 3", len(all))
+	}
+	if all, _ := events.ListByUser(bob.ID, 10, nil); len(all) != 1 || all[0].UserID != bob.ID {
+		t.Errorf("bob's events = %+v", all)
+	}
+}
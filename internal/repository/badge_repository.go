@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// BadgeRepository stores the channels' chat badges, one per role
+type BadgeRepository struct {
+	db *database.DB
+}
+
+func NewBadgeRepository(db *database.DB) *BadgeRepository {
+	return &BadgeRepository{db: db}
+}
+
+// Put sets the badge of b.Role in b.ChannelID, replacing its images
+func (r *BadgeRepository) Put(b *models.ChannelBadge) error {
+	query := `
+		INSERT INTO channel_badges (channel_id, role, images)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (channel_id, role) DO UPDATE
+		SET images = EXCLUDED.images, updated_at = NOW()
+		RETURNING updated_at
+	`
+	if err := r.db.QueryRow(query, b.ChannelID, b.Role, b.Images).Scan(&b.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save badge: %w", err)
+	}
+	return nil
+}
+
+// ListByChannel returns a channel's badges by role
+func (r *BadgeRepository) ListByChannel(channelID uuid.UUID) ([]models.ChannelBadge, error) {
+	rows, err := r.db.Query(`SELECT channel_id, role, images, updated_at FROM channel_badges WHERE channel_id = $1 ORDER BY role`, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list badges: %w", err)
+	}
+	defer rows.Close()
+
+	badges := []models.ChannelBadge{}
+	for rows.Next() {
+		var b models.ChannelBadge
+		if err := rows.Scan(&b.ChannelID, &b.Role, &b.Images, &b.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan badge: %w", err)
+		}
+		badges = append(badges, b)
+	}
+	return badges, rows.Err()
+}
+
+// Delete removes the badge of role, reporting whether there was one
+func (r *BadgeRepository) Delete(channelID uuid.UUID, role string) (bool, error) {
+	tag, err := r.db.Exec(`DELETE FROM channel_badges WHERE channel_id = $1 AND role = $2`, channelID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete badge: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestChannelBadges(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	convs := NewConversationRepository(db)
+	msgs := NewMessageRepository(db)
+	badges := NewBadgeRepository(db)
+	assets := NewAssetRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	owner, mod, vip, viewer := newUser("owner"), newUser("mod"), newUser("vip"), newUser("viewer")
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "badges", Title: "Badges", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.UpdateMemberRole(convID, mod.ID, "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.UpdateMemberRole(convID, vip.ID, models.ChannelRoleVIP); err != nil {
+		t.Fatal(err)
+	}
+
+	png := &models.Asset{Hash: "ab" + string(bytes.Repeat([]byte("0"), 62)), ContentType: "image/png", Data: []byte("\x89PNG\r\n\x1a\n")}
+	if err := assets.Save(png); err != nil {
+		t.Fatal(err)
+	}
+	if err := assets.Save(png); err != nil {
+		t.Fatalf("saving the same asset again: %v", err)
+	}
+	if got, err := assets.Get(png.Hash); err != nil || got.ContentType != "image/png" || !bytes.Equal(got.Data, png.Data) {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+	if _, err := assets.Get("cd" + png.Hash[2:]); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Get(unknown) err = %v, want ErrAssetNotFound", err)
+	}
+
+	modImages := models.ImageVariants{models.ImageScale1x: "https://api.example.com/assets/" + png.Hash}
+	for _, b := range []*models.ChannelBadge{
+		{ChannelID: ch.ID, Role: models.ChannelRoleModerator, Images: models.ImageVariants{models.ImageScale1x: "old"}},
+		{ChannelID: ch.ID, Role: models.ChannelRoleModerator, Images: modImages},
+		{ChannelID: ch.ID, Role: models.ChannelRoleOwner, Images: models.ImageVariants{models.ImageScale1x: "owner"}},
+	} {
+		if err := badges.Put(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := badges.ListByChannel(ch.ID)
+	if err != nil || len(list) != 2 || list[0].Role != models.ChannelRoleModerator || list[0].Images[models.ImageScale1x] != modImages[models.ImageScale1x] {
+		t.Fatalf("ListByChannel = %+v, %v", list, err)
+	}
+
+	// Messages carry the sender's badge, on send and when listed; the VIP
+	// badge is not set, so VIPs and viewers wear none
+	want := map[uuid.UUID]string{owner.ID: models.ChannelRoleOwner, mod.ID: models.ChannelRoleModerator, vip.ID: "", viewer.ID: ""}
+	for i, u := range []*models.User{owner, mod, vip, viewer} {
+		m := &models.Message{ID: uuid.New(), ConversationID: convID, SenderID: u.ID, Body: "hi", CreatedAt: now.Add(time.Duration(i) * time.Second), UpdatedAt: now}
+		if err := msgs.Create(m); err != nil {
+			t.Fatal(err)
+		}
+		if role := badgeRoleOf(m); role != want[u.ID] {
+			t.Errorf("%s sent with badge %q, want %q", u.DisplayName, role, want[u.ID])
+		}
+	}
+	page, err := msgs.ListByConversation(convID, 10, nil)
+	if err != nil || len(page) != 4 {
+		t.Fatalf("ListByConversation = %d messages, %v", len(page), err)
+	}
+	for _, m := range page {
+		if role := badgeRoleOf(&m); role != want[m.SenderID] {
+			t.Errorf("%s listed with badge %q, want %q", m.Sender.DisplayName, role, want[m.SenderID])
+		}
+	}
+	if page[2].Badge == nil || page[2].Badge.Images[models.ImageScale1x] != modImages[models.ImageScale1x] {
+		t.Errorf("moderator badge = %+v, want images %v", page[2].Badge, modImages)
+	}
+
+	if deleted, err := badges.Delete(ch.ID, models.ChannelRoleOwner); err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v", deleted, err)
+	}
+	if deleted, err := badges.Delete(ch.ID, models.ChannelRoleOwner); err != nil || deleted {
+		t.Errorf("Delete again = %v, %v; want nothing deleted", deleted, err)
+	}
+	page, _ = msgs.ListByConversation(convID, 10, nil)
+	if page[3].Badge != nil {
+		t.Errorf("owner still wears %+v after the badge was removed", page[3].Badge)
+	}
+}
+
+func badgeRoleOf(m *models.Message) string {
+	if m.Badge == nil {
+		return ""
+	}
+	return m.Badge.Role
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// BotScoreRepository stores the moderation bot's suspicion scores of chatters
+type BotScoreRepository struct {
+	db *database.DB
+}
+
+func NewBotScoreRepository(db *database.DB) *BotScoreRepository {
+	return &BotScoreRepository{db: db}
+}
+
+// Record saves userID's latest score in a conversation and reports whether
+// it was kept. Only channel chats keep scores, as other conversations are
+// private to their members, and the channel's owner, moderators and VIPs
+// are never scored.
+func (r *BotScoreRepository) Record(conversationID, userID uuid.UUID, s *models.BotScore) (bool, error) {
+	query := `
+		INSERT INTO bot_scores (conversation_id, user_id, score, entropy, regularity, duplicates, messages)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE EXISTS (SELECT 1 FROM channels WHERE conversation_id = $1 AND owner_id <> $2)
+		  AND NOT EXISTS (
+			SELECT 1 FROM conversation_members
+			WHERE conversation_id = $1 AND user_id = $2 AND role IN ('admin', 'moderator', 'vip')
+		  )
+		ON CONFLICT (conversation_id, user_id) DO UPDATE
+		SET score = EXCLUDED.score, entropy = EXCLUDED.entropy, regularity = EXCLUDED.regularity,
+		    duplicates = EXCLUDED.duplicates, messages = EXCLUDED.messages, updated_at = NOW()
+	`
+	tag, err := r.db.Exec(query, conversationID, userID, s.Score, s.Entropy, s.Regularity, s.Duplicates, s.Messages)
+	if err != nil {
+		return false, fmt.Errorf("failed to record bot score: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListByConversation returns the scores of a chat's users from the most
+// suspicious, leaving out those below minScore
+func (r *BotScoreRepository) ListByConversation(conversationID uuid.UUID, minScore float64, limit int) ([]models.BotScore, error) {
+	query := `
+		SELECT s.user_id, u.display_name, u.username, u.avatar_url,
+		       s.score, s.entropy, s.regularity, s.duplicates, s.messages, s.updated_at
+		FROM bot_scores s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.conversation_id = $1 AND s.score >= $2 AND u.deleted_at IS NULL
+		ORDER BY s.score DESC, s.updated_at DESC
+		LIMIT $3
+	`
+	rows, err := r.db.Query(query, conversationID, minScore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bot scores: %w", err)
+	}
+	defer rows.Close()
+
+	scores := []models.BotScore{}
+	for rows.Next() {
+		var s models.BotScore
+		if err := rows.Scan(&s.UserID, &s.DisplayName, &s.Username, &s.AvatarURL,
+			&s.Score, &s.Entropy, &s.Regularity, &s.Duplicates, &s.Messages, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan bot score: %w", err)
+		}
+		scores = append(scores, s)
+	}
+	return scores, rows.Err()
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestBotScores(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	convs := NewConversationRepository(db)
+	scores := NewBotScoreRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	owner, human, spammer := newUser("botscore-owner"), newUser("botscore-human"), newUser("botscore-spammer")
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "botscores", Title: "Bot scores", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for user, score := range map[uuid.UUID]float64{human.ID: 0.1, spammer.ID: 0.5} {
+		if kept, err := scores.Record(convID, user, &models.BotScore{Score: score, Messages: 5}); err != nil || !kept {
+			t.Fatalf("Record = %v, %v", kept, err)
+		}
+	}
+	// A later score replaces the earlier one
+	if _, err := scores.Record(convID, spammer.ID, &models.BotScore{Score: 0.9, Duplicates: 1, Messages: 6}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := scores.ListByConversation(convID, 0.2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].UserID != spammer.ID || list[0].Score < 0.89 || list[0].Messages != 6 {
+		t.Errorf("ListByConversation = %+v, want only the spammer's latest score", list)
+	}
+
+	// The channel's staff is never scored
+	if kept, err := scores.Record(convID, owner.ID, &models.BotScore{Score: 1}); err != nil || kept {
+		t.Errorf("Record for the owner = %v, %v; want not kept", kept, err)
+	}
+
+	// Conversations other than channel chats keep no scores
+	group := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(group); err != nil {
+		t.Fatal(err)
+	}
+	if kept, err := scores.Record(group.ID, human.ID, &models.BotScore{Score: 1}); err != nil || kept {
+		t.Errorf("Record in a group = %v, %v; want not kept", kept, err)
+	}
+}
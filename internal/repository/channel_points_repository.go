@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+)
+
+// ChannelPointsRepository stores the points viewers earn by watching a
+// channel's live streams
+type ChannelPointsRepository struct {
+	db *database.DB
+}
+
+func NewChannelPointsRepository(db *database.DB) *ChannelPointsRepository {
+	return &ChannelPointsRepository{db: db}
+}
+
+// Earn records a heartbeat from userID watching channelID live and returns
+// the balance. The time since the user's previous heartbeat, up to maxGap,
+// adds to their watch time; every full interval of it earns amount points.
+// The time is kept per user, not per device, so watching on two screens
+// earns no more than one.
+func (r *ChannelPointsRepository) Earn(channelID, userID uuid.UUID, interval, maxGap time.Duration, amount int) (int64, error) {
+	query := `
+		INSERT INTO channel_points (channel_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (channel_id, user_id) DO UPDATE
+		SET balance = channel_points.balance + $5::bigint * ((channel_points.pending_seconds +
+				LEAST(GREATEST(EXTRACT(EPOCH FROM NOW() - channel_points.last_seen_at), 0), $4::int)::int) / $3::int),
+			pending_seconds = (channel_points.pending_seconds +
+				LEAST(GREATEST(EXTRACT(EPOCH FROM NOW() - channel_points.last_seen_at), 0), $4::int)::int) % $3::int,
+			last_seen_at = NOW()
+		RETURNING balance
+	`
+	var balance int64
+	err := r.db.QueryRow(query, channelID, userID, int(interval.Seconds()), int(maxGap.Seconds()), amount).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("failed to earn channel points: %w", err)
+	}
+	return balance, nil
+}
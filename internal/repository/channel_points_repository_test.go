@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestChannelPointsEarn(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	points := NewChannelPointsRepository(db)
+
+	now := time.Now()
+	viewer := &models.User{ID: uuid.New(), Email: "points@example.com", DisplayName: "Viewer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	owner := &models.User{ID: uuid.New(), Email: "points-owner@example.com", DisplayName: "Owner", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	for _, u := range []*models.User{viewer, owner} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "pointy", Title: "Pointy", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	earn := func() int64 {
+		t.Helper()
+		balance, err := points.Earn(ch.ID, viewer.ID, 5*time.Minute, time.Minute, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return balance
+	}
+	backdate := func(d time.Duration) {
+		t.Helper()
+		if _, err := db.Exec(`UPDATE channel_points SET last_seen_at = last_seen_at - $2 * INTERVAL '1 second' WHERE user_id = $1`, viewer.ID, int(d.Seconds())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if b := earn(); b != 0 {
+		t.Fatalf("first heartbeat balance = %d, want 0", b)
+	}
+	// Four heartbeats a minute apart fall short of the interval
+	for i := 0; i < 4; i++ {
+		backdate(time.Minute)
+		if b := earn(); b != 0 {
+			t.Fatalf("balance after %d minutes = %d, want 0", i+1, b)
+		}
+	}
+	backdate(time.Minute)
+	if b := earn(); b != 10 {
+		t.Fatalf("balance after 5 minutes = %d, want 10", b)
+	}
+	// A long gap counts as maxGap only
+	backdate(time.Hour)
+	if b := earn(); b != 10 {
+		t.Fatalf("balance after a gap = %d, want 10", b)
+	}
+}
@@ -1,16 +1,39 @@
 package repository
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
 
 	"github.com/tullo/backend/internal/database"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
 )
 
+// ErrChannelLimit is returned by CreateLimited when the owner already has as
+// many channels as they may have
+var ErrChannelLimit = errors.New("channel limit reached")
+
+// ChannelCooldownError is returned by CreateLimited when the owner created a
+// channel too recently; RetryAfter is how long until they may create another
+type ChannelCooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ChannelCooldownError) Error() string {
+	return fmt.Sprintf("channel creation cooling down for %s", e.RetryAfter)
+}
+
+const stmtChannelInsert = `
+	INSERT INTO channels (id, owner_id, slug, title, description, language, tags, created_at, updated_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+        RETURNING id, created_at, updated_at
+    `
+
 type ChannelRepository struct {
 	db *database.DB
 }
@@ -20,45 +43,115 @@ func NewChannelRepository(db *database.DB) *ChannelRepository {
 }
 
 func (r *ChannelRepository) Create(channel *models.Channel) error {
-	query := `
-	INSERT INTO channels (id, owner_id, slug, title, description, language, tags, created_at, updated_at)
-        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
-        RETURNING id, created_at, updated_at
-    `
-	err := r.db.QueryRow(query,
+	err := r.db.QueryRow(stmtChannelInsert,
+		channel.ID,
+		channel.OwnerID,
+		channel.Slug,
+		channel.Title,
+		channel.Description,
+		channel.Language,
+		channel.Tags,
+		channel.CreatedAt,
+		channel.UpdatedAt,
+	).Scan(&channel.ID, &channel.CreatedAt, &channel.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create channel: %w", err)
+	}
+	return nil
+}
+
+// CreateLimited creates a channel unless its owner already has maxChannels
+// channels (ErrChannelLimit) or created one, even a since deleted one, less
+// than cooldown ago (*ChannelCooldownError). Zero disables either limit.
+// Creations by the same owner are serialized, so parallel requests cannot
+// slip past the limits.
+func (r *ChannelRepository) CreateLimited(channel *models.Channel, maxChannels int, cooldown time.Duration) error {
+	ctx := context.Background()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, channel.OwnerID); err != nil {
+		return fmt.Errorf("failed to lock channel owner: %w", err)
+	}
+	var active int
+	var waitSec float64
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE deleted_at IS NULL),
+			COALESCE(EXTRACT(EPOCH FROM MAX(created_at) + make_interval(secs => $2) - NOW()), 0)::float8
+		FROM channels WHERE owner_id = $1
+	`, channel.OwnerID, cooldown.Seconds()).Scan(&active, &waitSec)
+	if err != nil {
+		return fmt.Errorf("failed to count channels: %w", err)
+	}
+	if maxChannels > 0 && active >= maxChannels {
+		return ErrChannelLimit
+	}
+	if cooldown > 0 && waitSec > 0 {
+		return &ChannelCooldownError{RetryAfter: time.Duration(waitSec * float64(time.Second))}
+	}
+
+	err = tx.QueryRow(ctx, stmtChannelInsert,
 		channel.ID,
 		channel.OwnerID,
 		channel.Slug,
 		channel.Title,
 		channel.Description,
 		channel.Language,
-		pq.Array(channel.Tags),
+		channel.Tags,
 		channel.CreatedAt,
 		channel.UpdatedAt,
 	).Scan(&channel.ID, &channel.CreatedAt, &channel.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create channel: %w", err)
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
 	return nil
 }
 
 func (r *ChannelRepository) GetBySlug(slug string) (*models.Channel, error) {
+	return r.getBySlug(slug, false)
+}
+
+// GetBySlugIncludeDeleted retrieves a channel even if it has been soft-deleted (admin use)
+func (r *ChannelRepository) GetBySlugIncludeDeleted(slug string) (*models.Channel, error) {
+	return r.getBySlug(slug, true)
+}
+
+func (r *ChannelRepository) getBySlug(slug string, includeDeleted bool) (*models.Channel, error) {
 	query := `
-	SELECT id, owner_id, slug, title, description, language, tags, created_at, updated_at
-        FROM channels WHERE slug = $1
+	SELECT ch.id, ch.owner_id, ch.slug, ch.title, ch.description, ch.language, ch.tags, ch.chat_rules, ch.follow_alerts,
+            COALESCE(cv.formatting, true), COALESCE(cv.retention_days, 0), COALESCE(cv.retention_action, 'delete'),
+            COALESCE(cv.max_message_length, 0), COALESCE(cv.max_emotes, 0), ch.created_at, ch.updated_at, ch.deleted_at, ch.version
+        FROM channels ch
+        LEFT JOIN conversations cv ON cv.id = ch.conversation_id
+        WHERE ch.slug = $1 AND ($2 OR ch.deleted_at IS NULL)
     `
 	ch := &models.Channel{}
 	var tags []string
-	err := r.db.QueryRow(query, slug).Scan(
+	err := r.db.QueryRow(query, slug, includeDeleted).Scan(
 		&ch.ID,
 		&ch.OwnerID,
 		&ch.Slug,
 		&ch.Title,
 		&ch.Description,
 		&ch.Language,
-		pq.Array(&tags),
+		&tags,
+		&ch.ChatRules,
+		&ch.FollowAlerts,
+		&ch.ChatFormatting,
+		&ch.ChatRetentionDays,
+		&ch.ChatRetentionAction,
+		&ch.ChatMaxLength,
+		&ch.ChatMaxEmotes,
 		&ch.CreatedAt,
 		&ch.UpdatedAt,
+		&ch.DeletedAt,
+		&ch.Version,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get channel: %w", err)
@@ -68,56 +161,307 @@ func (r *ChannelRepository) GetBySlug(slug string) (*models.Channel, error) {
 	return ch, nil
 }
 
+// FilterOwners returns those of userIDs who own a channel that is not
+// deleted, i.e. the streamers among them
+func (r *ChannelRepository) FilterOwners(userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	owners := []uuid.UUID{}
+	if len(userIDs) == 0 {
+		return owners, nil
+	}
+	rows, err := r.db.Query(`SELECT DISTINCT owner_id FROM channels WHERE owner_id = ANY($1) AND deleted_at IS NULL`, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter channel owners: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan channel owner: %w", err)
+		}
+		owners = append(owners, id)
+	}
+	return owners, rows.Err()
+}
+
+// GetByIDs retrieves multiple channels by their IDs
+func (r *ChannelRepository) GetByIDs(ids []uuid.UUID) ([]models.Channel, error) {
+	if len(ids) == 0 {
+		return []models.Channel{}, nil
+	}
+
+	query := `
+	SELECT id, owner_id, slug, title, description, language, tags, created_at, updated_at, version
+        FROM channels
+        WHERE id = ANY($1) AND deleted_at IS NULL
+    `
+	rows, err := r.db.Query(query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+	defer rows.Close()
+
+	out := []models.Channel{}
+	for rows.Next() {
+		var ch models.Channel
+		if err := rows.Scan(&ch.ID, &ch.OwnerID, &ch.Slug, &ch.Title, &ch.Description, &ch.Language, &ch.Tags, &ch.CreatedAt, &ch.UpdatedAt, &ch.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+// GetByConversationIDs returns the channels whose chat is one of the given
+// conversations, keyed by conversation ID. Other conversations are absent.
+func (r *ChannelRepository) GetByConversationIDs(conversationIDs []uuid.UUID) (map[uuid.UUID]models.Channel, error) {
+	out := make(map[uuid.UUID]models.Channel, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return out, nil
+	}
+
+	query := `
+		SELECT conversation_id, id, owner_id, slug, title, description, language, tags, created_at, updated_at, version
+		FROM channels
+		WHERE conversation_id = ANY($1) AND deleted_at IS NULL
+	`
+	rows, err := r.db.Query(query, conversationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var convID uuid.UUID
+		var ch models.Channel
+		if err := rows.Scan(&convID, &ch.ID, &ch.OwnerID, &ch.Slug, &ch.Title, &ch.Description, &ch.Language, &ch.Tags, &ch.CreatedAt, &ch.UpdatedAt, &ch.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+		out[convID] = ch
+	}
+	return out, rows.Err()
+}
+
+// ListByOwner returns the channels owned by ownerID, oldest first
+func (r *ChannelRepository) ListByOwner(ownerID uuid.UUID) ([]models.Channel, error) {
+	query := `
+	SELECT id, owner_id, slug, title, description, language, tags, created_at, updated_at, version
+        FROM channels
+        WHERE owner_id = $1 AND deleted_at IS NULL
+        ORDER BY created_at, id
+    `
+	rows, err := r.db.Query(query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channels: %w", err)
+	}
+	defer rows.Close()
+
+	out := []models.Channel{}
+	for rows.Next() {
+		var ch models.Channel
+		if err := rows.Scan(&ch.ID, &ch.OwnerID, &ch.Slug, &ch.Title, &ch.Description, &ch.Language, &ch.Tags, &ch.CreatedAt, &ch.UpdatedAt, &ch.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+		out = append(out, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list channels: %w", err)
+	}
+	return out, nil
+}
+
+// List returns a keyset page of channels, newest first. Up to limit+1 rows are
+// returned so callers can detect a further page.
+func (r *ChannelRepository) List(limit int, cursor *pagination.Cursor) ([]models.Channel, error) {
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+
+	query := `
+	SELECT id, owner_id, slug, title, description, language, tags, created_at, updated_at, version
+        FROM channels
+        WHERE deleted_at IS NULL
+        AND ($1::timestamp IS NULL OR (created_at, id) < ($1, $2))
+        ORDER BY created_at DESC, id DESC
+        LIMIT $3
+    `
+	rows, err := r.db.Query(query, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channels: %w", err)
+	}
+	defer rows.Close()
+
+	out := []models.Channel{}
+	for rows.Next() {
+		var ch models.Channel
+		if err := rows.Scan(&ch.ID, &ch.OwnerID, &ch.Slug, &ch.Title, &ch.Description, &ch.Language, &ch.Tags, &ch.CreatedAt, &ch.UpdatedAt, &ch.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+// Update updates a channel's metadata. ch.Version must hold the version the caller
+// read; ErrVersionConflict is returned if the row changed in the meantime.
+func (r *ChannelRepository) Update(ch *models.Channel) error {
+	query := `
+	UPDATE channels
+        SET title = $1, description = $2, language = $3, tags = $4, chat_rules = $5,
+            follow_alerts = COALESCE($6, follow_alerts), updated_at = NOW(), version = version + 1
+        WHERE id = $7 AND version = $8 AND deleted_at IS NULL
+        RETURNING follow_alerts, updated_at, version
+    `
+	err := r.db.QueryRow(query, ch.Title, ch.Description, ch.Language, ch.Tags, ch.ChatRules, ch.FollowAlerts, ch.ID, ch.Version).Scan(&ch.FollowAlerts, &ch.UpdatedAt, &ch.Version)
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM channels WHERE id = $1 AND deleted_at IS NULL)`, ch.ID).Scan(&exists); err != nil || !exists {
+			return fmt.Errorf("channel not found")
+		}
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update channel: %w", err)
+	}
+	return nil
+}
+
+// Delete soft-deletes a channel
+func (r *ChannelRepository) Delete(id uuid.UUID) error {
+	res, err := r.db.Exec(`UPDATE channels SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete channel: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("channel not found")
+	}
+	return nil
+}
+
+// Restore clears the soft-delete marker on a channel
+func (r *ChannelRepository) Restore(id uuid.UUID) error {
+	res, err := r.db.Exec(`UPDATE channels SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore channel: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("deleted channel not found")
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes channels soft-deleted before the cutoff
+func (r *ChannelRepository) PurgeDeleted(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM channels WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge channels: %w", err)
+	}
+	return res.RowsAffected(), nil
+}
+
 // GetOrCreateConversation returns the conversation id associated with a channel, creating one if missing
 func (r *ChannelRepository) GetOrCreateConversation(channelID uuid.UUID) (uuid.UUID, error) {
 	// Check if channel has conversation_id
-	var convID sql.NullString
+	var convID *uuid.UUID
 	err := r.db.QueryRow("SELECT conversation_id FROM channels WHERE id = $1", channelID).Scan(&convID)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to query channel: %w", err)
 	}
-	if convID.Valid {
-		id, err := uuid.Parse(convID.String)
-		if err == nil {
-			return id, nil
-		}
+	if convID != nil {
+		return *convID, nil
 	}
 
 	// Create conversation and set it on channel in a transaction
+	ctx := context.Background()
 	tx, err := r.db.Begin()
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to begin tx: %w", err)
 	}
-	defer tx.Rollback()
+	defer tx.Rollback(ctx)
 
 	convIDNew := uuid.New()
-	_, err = tx.Exec(`INSERT INTO conversations (id, is_group, created_at, updated_at) VALUES ($1, $2, NOW(), NOW())`, convIDNew, true)
+	_, err = tx.Exec(ctx, `INSERT INTO conversations (id, is_group, created_at, updated_at) VALUES ($1, $2, NOW(), NOW())`, convIDNew, true)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to create conversation: %w", err)
 	}
 
-	_, err = tx.Exec(`UPDATE channels SET conversation_id = $1 WHERE id = $2`, convIDNew, channelID)
+	_, err = tx.Exec(ctx, `UPDATE channels SET conversation_id = $1 WHERE id = $2`, convIDNew, channelID)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to update channel: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to commit: %w", err)
 	}
 
 	return convIDNew, nil
 }
 
-// AddFollower creates a follow record for a user on a channel
-func (r *ChannelRepository) AddFollower(channelID, userID uuid.UUID) error {
-	query := `INSERT INTO channel_follows (id, channel_id, user_id, created_at) VALUES ($1, $2, $3, NOW()) ON CONFLICT (channel_id, user_id) DO NOTHING`
-	_, err := r.db.Exec(query, uuid.New(), channelID, userID)
+// SetChatFormatting turns Markdown formatting in the channel's chat on or off
+func (r *ChannelRepository) SetChatFormatting(channelID uuid.UUID, enabled bool) error {
+	convID, err := r.GetOrCreateConversation(channelID)
 	if err != nil {
-		return fmt.Errorf("failed to add follower: %w", err)
+		return err
+	}
+	if _, err := r.db.Exec(`UPDATE conversations SET formatting = $2 WHERE id = $1`, convID, enabled); err != nil {
+		return fmt.Errorf("failed to set chat formatting: %w", err)
 	}
 	return nil
 }
 
+// SetChatRetention sets how long messages in the channel's chat are kept and
+// whether older ones are deleted or archived; nil leaves a setting as it is
+func (r *ChannelRepository) SetChatRetention(channelID uuid.UUID, days *int, action *string) error {
+	convID, err := r.GetOrCreateConversation(channelID)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE conversations
+		SET retention_days = COALESCE($2, retention_days), retention_action = COALESCE($3, retention_action)
+		WHERE id = $1
+	`
+	if _, err := r.db.Exec(query, convID, days, action); err != nil {
+		return fmt.Errorf("failed to set chat retention: %w", err)
+	}
+	return nil
+}
+
+// SetChatLimits sets the most characters and emotes a message in the
+// channel's chat may have; nil leaves a limit as it is
+func (r *ChannelRepository) SetChatLimits(channelID uuid.UUID, maxLength, maxEmotes *int) error {
+	convID, err := r.GetOrCreateConversation(channelID)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE conversations
+		SET max_message_length = COALESCE($2, max_message_length), max_emotes = COALESCE($3, max_emotes)
+		WHERE id = $1
+	`
+	if _, err := r.db.Exec(query, convID, maxLength, maxEmotes); err != nil {
+		return fmt.Errorf("failed to set chat limits: %w", err)
+	}
+	return nil
+}
+
+// AddFollower creates a follow record for a user on a channel, noting its
+// origin for follow-bot detection. It reports false when the user already
+// followed it.
+func (r *ChannelRepository) AddFollower(channelID, userID uuid.UUID, origin models.FollowOrigin) (bool, error) {
+	query := `
+	INSERT INTO channel_follows (id, channel_id, user_id, created_at, ip, network, new_account)
+        VALUES ($1, $2, $3, NOW(), NULLIF($4, ''), NULLIF($5, ''), $6)
+        ON CONFLICT (channel_id, user_id) DO NOTHING
+    `
+	tag, err := r.db.Exec(query, uuid.New(), channelID, userID, origin.IP, origin.Network, origin.NewAccount)
+	if err != nil {
+		return false, fmt.Errorf("failed to add follower: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
 // RemoveFollower removes a follow record
 func (r *ChannelRepository) RemoveFollower(channelID, userID uuid.UUID) error {
 	query := `DELETE FROM channel_follows WHERE channel_id = $1 AND user_id = $2`
@@ -139,6 +483,27 @@ func (r *ChannelRepository) IsFollower(channelID, userID uuid.UUID) (bool, error
 	return exists, nil
 }
 
+// CallerStats returns the channel's follower count and whether userID
+// follows it, their role in its chat and whether they are banned from it
+func (r *ChannelRepository) CallerStats(channelID, userID uuid.UUID) (*models.ChannelCallerStats, error) {
+	query := `
+	SELECT
+	    (SELECT COUNT(*) FROM channel_follows WHERE channel_id = c.id),
+	    EXISTS(SELECT 1 FROM channel_follows WHERE channel_id = c.id AND user_id = $2),
+	    COALESCE((SELECT role FROM conversation_members WHERE conversation_id = c.conversation_id AND user_id = $2), ''),
+	    EXISTS(SELECT 1 FROM conversation_moderations
+	           WHERE conversation_id = c.conversation_id AND user_id = $2 AND action = 'ban'
+	             AND (expires_at IS NULL OR expires_at > NOW()))
+	FROM channels c WHERE c.id = $1
+    `
+	s := &models.ChannelCallerStats{}
+	err := r.db.QueryRow(query, channelID, userID).Scan(&s.Followers, &s.Following, &s.MemberRole, &s.Banned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel stats: %w", err)
+	}
+	return s, nil
+}
+
 // CountFollowers returns number of followers for a channel
 func (r *ChannelRepository) CountFollowers(channelID uuid.UUID) (int, error) {
 	query := `SELECT COUNT(*) FROM channel_follows WHERE channel_id = $1`
@@ -149,3 +514,64 @@ func (r *ChannelRepository) CountFollowers(channelID uuid.UUID) (int, error) {
 	}
 	return cnt, nil
 }
+
+// CountFollowersByChannelIDs is CountFollowers for several channels in one
+// query, keyed by channel ID. Channels without followers are absent.
+func (r *ChannelRepository) CountFollowersByChannelIDs(channelIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return counts, nil
+	}
+
+	query := `SELECT channel_id, COUNT(*) FROM channel_follows WHERE channel_id = ANY($1) GROUP BY channel_id`
+	rows, err := r.db.Query(query, channelIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count followers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var cnt int
+		if err := rows.Scan(&id, &cnt); err != nil {
+			return nil, fmt.Errorf("failed to scan follower count: %w", err)
+		}
+		counts[id] = cnt
+	}
+	return counts, nil
+}
+
+// ListFollowers returns a keyset page of a channel's followers, most recent
+// first. Up to limit+1 rows are returned so callers can detect a further page.
+func (r *ChannelRepository) ListFollowers(channelID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.Follower, error) {
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+
+	query := `
+	SELECT cf.id, cf.created_at, u.id, u.display_name, u.avatar_url
+        FROM channel_follows cf
+        INNER JOIN users u ON u.id = cf.user_id
+        WHERE cf.channel_id = $1 AND u.deleted_at IS NULL
+        AND ($2::timestamp IS NULL OR (cf.created_at, cf.id) < ($2, $3))
+        ORDER BY cf.created_at DESC, cf.id DESC
+        LIMIT $4
+    `
+	rows, err := r.db.Query(query, channelID, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list followers: %w", err)
+	}
+	defer rows.Close()
+
+	out := []models.Follower{}
+	for rows.Next() {
+		var f models.Follower
+		if err := rows.Scan(&f.ID, &f.FollowedAt, &f.UserID, &f.DisplayName, &f.AvatarURL); err != nil {
+			return nil, fmt.Errorf("failed to scan follower: %w", err)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestCallerStats(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	convs := NewConversationRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	owner, vip, troll, stranger := newUser("owner"), newUser("vip"), newUser("troll"), newUser("stranger")
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "page", Title: "Page", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Before the chat exists nobody has a role
+	stats, err := channels.CallerStats(ch.ID, stranger.ID)
+	if err != nil || stats.Followers != 0 || stats.Following || stats.MemberRole != "" || stats.Banned {
+		t.Fatalf("stats = %+v, %v", stats, err)
+	}
+
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, err := channels.AddFollower(ch.ID, vip.ID, models.FollowOrigin{}); err != nil || !added {
+		t.Fatalf("AddFollower = %v, %v; want a new follower", added, err)
+	}
+	if added, err := channels.AddFollower(ch.ID, vip.ID, models.FollowOrigin{}); err != nil || added {
+		t.Fatalf("AddFollower again = %v, %v; want no new follower", added, err)
+	}
+	if err := convs.UpdateMemberRole(convID, vip.ID, models.ChannelRoleVIP); err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.AddModeration(convID, troll.ID, "ban", nil, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	past := now.Add(-time.Hour)
+	if err := convs.AddModeration(convID, stranger.ID, "ban", &past, "expired"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user      *models.User
+		following bool
+		role      string
+		banned    bool
+	}{
+		{vip, true, models.ChannelRoleVIP, false},
+		{troll, false, "", true},
+		{stranger, false, "", false},
+	}
+	for _, tt := range tests {
+		stats, err := channels.CallerStats(ch.ID, tt.user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Followers != 1 || stats.Following != tt.following || stats.MemberRole != tt.role || stats.Banned != tt.banned {
+			t.Errorf("%s: stats = %+v", tt.user.DisplayName, stats)
+		}
+	}
+}
+
+func TestCreateLimited(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "squatter@example.com", DisplayName: "squatter", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(owner); err != nil {
+		t.Fatal(err)
+	}
+	create := func(slug string, max int, cooldown time.Duration) error {
+		return channels.CreateLimited(&models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: slug, Title: slug, CreatedAt: now, UpdatedAt: now}, max, cooldown)
+	}
+
+	if err := create("squat-1", 2, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var cooldown *ChannelCooldownError
+	if err := create("squat-2", 2, time.Hour); !errors.As(err, &cooldown) || cooldown.RetryAfter <= 0 || cooldown.RetryAfter > time.Hour {
+		t.Fatalf("second channel within the cooldown: err = %v", err)
+	}
+	if err := create("squat-2", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := create("squat-3", 2, 0); !errors.Is(err, ErrChannelLimit) {
+		t.Fatalf("third channel: err = %v, want ErrChannelLimit", err)
+	}
+	if err := create("squat-3", 0, 0); err != nil {
+		t.Fatalf("without limits: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrCommandExists is returned when the channel already has a command by that name
+var ErrCommandExists = errors.New("command already exists")
+
+// ErrCommandNotFound is returned for unknown commands
+var ErrCommandNotFound = errors.New("command not found")
+
+// CommandRepository stores the channels' custom chat commands
+type CommandRepository struct {
+	db *database.DB
+}
+
+func NewCommandRepository(db *database.DB) *CommandRepository {
+	return &CommandRepository{db: db}
+}
+
+const commandColumns = `id, channel_id, name, response, permission, cooldown_sec, enabled, uses, last_used_at, created_at, updated_at`
+
+func scanCommand(row pgx.Row) (*models.ChannelCommand, error) {
+	c := &models.ChannelCommand{}
+	err := row.Scan(&c.ID, &c.ChannelID, &c.Name, &c.Response, &c.Permission, &c.CooldownSec, &c.Enabled, &c.Uses, &c.LastUsedAt, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
+
+// ListByChannel returns a channel's commands by name
+func (r *CommandRepository) ListByChannel(channelID uuid.UUID) ([]models.ChannelCommand, error) {
+	rows, err := r.db.Query(`SELECT `+commandColumns+` FROM channel_commands WHERE channel_id = $1 ORDER BY name`, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commands: %w", err)
+	}
+	defer rows.Close()
+
+	cmds := []models.ChannelCommand{}
+	for rows.Next() {
+		c, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		cmds = append(cmds, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list commands: %w", err)
+	}
+	return cmds, nil
+}
+
+// Create adds cmd to its channel
+func (r *CommandRepository) Create(cmd *models.ChannelCommand) error {
+	query := `
+		INSERT INTO channel_commands (id, channel_id, name, response, permission, cooldown_sec, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (channel_id, name) DO NOTHING
+		RETURNING created_at, updated_at
+	`
+	err := r.db.QueryRow(query, cmd.ID, cmd.ChannelID, cmd.Name, cmd.Response, cmd.Permission, cmd.CooldownSec, cmd.Enabled).Scan(&cmd.CreatedAt, &cmd.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrCommandExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create command: %w", err)
+	}
+	return nil
+}
+
+// Update applies the set fields of req to the channel's command
+func (r *CommandRepository) Update(channelID uuid.UUID, name string, req *models.UpdateCommandRequest) (*models.ChannelCommand, error) {
+	query := `
+		UPDATE channel_commands SET
+			response = COALESCE($3, response),
+			permission = COALESCE($4, permission),
+			cooldown_sec = COALESCE($5, cooldown_sec),
+			enabled = COALESCE($6, enabled),
+			updated_at = NOW()
+		WHERE channel_id = $1 AND name = $2
+		RETURNING ` + commandColumns
+	cmd, err := scanCommand(r.db.QueryRow(query, channelID, name, req.Response, req.Permission, req.CooldownSec, req.Enabled))
+	if err == pgx.ErrNoRows {
+		return nil, ErrCommandNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update command: %w", err)
+	}
+	return cmd, nil
+}
+
+// Delete removes the channel's command
+func (r *CommandRepository) Delete(channelID uuid.UUID, name string) error {
+	tag, err := r.db.Exec(`DELETE FROM channel_commands WHERE channel_id = $1 AND name = $2`, channelID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete command: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCommandNotFound
+	}
+	return nil
+}
+
+// Find returns the enabled command name of the channel whose chat is
+// conversationID, with userID's permission level there, or nil if there is
+// no such command
+func (r *CommandRepository) Find(conversationID, userID uuid.UUID, name string) (*models.CommandInvocation, error) {
+	query := `
+		SELECT c.id, c.channel_id, c.name, c.response, c.permission, c.cooldown_sec, c.enabled, c.uses, c.last_used_at, c.created_at, c.updated_at,
+			ch.title,
+			CASE
+				WHEN ch.owner_id = $2 THEN 'owner'
+				WHEN EXISTS (SELECT 1 FROM conversation_members cm WHERE cm.conversation_id = $1 AND cm.user_id = $2 AND cm.role IN ('moderator', 'admin')) THEN 'moderator'
+				WHEN EXISTS (SELECT 1 FROM channel_follows f WHERE f.channel_id = ch.id AND f.user_id = $2) THEN 'follower'
+				ELSE 'everyone'
+			END
+		FROM channel_commands c
+		INNER JOIN channels ch ON ch.id = c.channel_id
+		WHERE ch.conversation_id = $1 AND ch.deleted_at IS NULL AND c.name = $3 AND c.enabled
+	`
+	inv := &models.CommandInvocation{}
+	c := &inv.Command
+	err := r.db.QueryRow(query, conversationID, userID, name).Scan(&c.ID, &c.ChannelID, &c.Name, &c.Response, &c.Permission, &c.CooldownSec,
+		&c.Enabled, &c.Uses, &c.LastUsedAt, &c.CreatedAt, &c.UpdatedAt, &inv.ChannelTitle, &inv.CallerLevel)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find command: %w", err)
+	}
+	return inv, nil
+}
+
+// Claim records a run of the command unless it is cooling down, returning
+// the new use count, or 0 if the run was refused. Concurrent bots cannot
+// both answer the same cooldown window.
+func (r *CommandRepository) Claim(id uuid.UUID) (int64, error) {
+	query := `
+		UPDATE channel_commands SET uses = uses + 1, last_used_at = NOW()
+		WHERE id = $1 AND enabled
+		AND (last_used_at IS NULL OR last_used_at <= NOW() - make_interval(secs => cooldown_sec))
+		RETURNING uses
+	`
+	var uses int64
+	err := r.db.QueryRow(query, id).Scan(&uses)
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim command: %w", err)
+	}
+	return uses, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestChannelCommands(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	commands := NewCommandRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	owner, fan, viewer := newUser("owner"), newUser("fan"), newUser("viewer")
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "cmds", Title: "Commands", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := channels.AddFollower(ch.ID, fan.ID, models.FollowOrigin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &models.ChannelCommand{ID: uuid.New(), ChannelID: ch.ID, Name: "discord", Response: "join us", Permission: models.CommandEveryone, CooldownSec: 60, Enabled: true}
+	if err := commands.Create(cmd); err != nil {
+		t.Fatal(err)
+	}
+	dup := *cmd
+	dup.ID = uuid.New()
+	if err := commands.Create(&dup); !errors.Is(err, ErrCommandExists) {
+		t.Errorf("duplicate Create err = %v, want ErrCommandExists", err)
+	}
+
+	for _, tt := range []struct {
+		user  *models.User
+		level string
+	}{{owner, models.CommandOwner}, {fan, models.CommandFollower}, {viewer, models.CommandEveryone}} {
+		inv, err := commands.Find(convID, tt.user.ID, "discord")
+		if err != nil || inv == nil || inv.CallerLevel != tt.level || inv.ChannelTitle != "Commands" {
+			t.Errorf("Find for %s = %+v, %v", tt.user.DisplayName, inv, err)
+		}
+	}
+	if inv, err := commands.Find(convID, viewer.ID, "nope"); err != nil || inv != nil {
+		t.Errorf("Find unknown = %+v, %v", inv, err)
+	}
+
+	if uses, err := commands.Claim(cmd.ID); err != nil || uses != 1 {
+		t.Fatalf("first Claim = %d, %v", uses, err)
+	}
+	if uses, err := commands.Claim(cmd.ID); err != nil || uses != 0 {
+		t.Errorf("Claim during cooldown = %d, %v", uses, err)
+	}
+
+	disabled := false
+	if _, err := commands.Update(ch.ID, "discord", &models.UpdateCommandRequest{Enabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if inv, err := commands.Find(convID, viewer.ID, "discord"); err != nil || inv != nil {
+		t.Errorf("Find disabled = %+v, %v", inv, err)
+	}
+
+	if err := commands.Delete(ch.ID, "discord"); err != nil {
+		t.Fatal(err)
+	}
+	if err := commands.Delete(ch.ID, "discord"); !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("second Delete err = %v, want ErrCommandNotFound", err)
+	}
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ContentPreferenceRepository stores which streams each viewer wants to see
+type ContentPreferenceRepository struct {
+	db *database.DB
+}
+
+func NewContentPreferenceRepository(db *database.DB) *ContentPreferenceRepository {
+	return &ContentPreferenceRepository{db: db}
+}
+
+// Get returns userID's content preferences, or the defaults (no mature
+// content, no hidden tags) for users who never set any, including guests
+func (r *ContentPreferenceRepository) Get(userID uuid.UUID) (models.ContentPreferences, error) {
+	query := `SELECT show_mature, hidden_tags, updated_at FROM content_preferences WHERE user_id = $1`
+	var p models.ContentPreferences
+	err := r.db.QueryRow(query, userID).Scan(&p.ShowMature, &p.HiddenTags, &p.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return models.ContentPreferences{HiddenTags: []string{}}, nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to get content preferences: %w", err)
+	}
+	return p, nil
+}
+
+// Update changes the fields set in req and returns the result
+func (r *ContentPreferenceRepository) Update(userID uuid.UUID, req models.UpdateContentPreferencesRequest) (models.ContentPreferences, error) {
+	var hidden []string
+	if req.HiddenTags != nil {
+		hidden = models.NormalizeContentTags(*req.HiddenTags)
+	}
+	query := `
+		INSERT INTO content_preferences (user_id, show_mature, hidden_tags)
+		VALUES ($1, COALESCE($2, FALSE), COALESCE($3, '{}'::text[]))
+		ON CONFLICT (user_id) DO UPDATE
+		SET show_mature = COALESCE($2, content_preferences.show_mature),
+			hidden_tags = COALESCE($3, content_preferences.hidden_tags),
+			updated_at = NOW()
+		RETURNING show_mature, hidden_tags, updated_at
+	`
+	var p models.ContentPreferences
+	err := r.db.QueryRow(query, userID, req.ShowMature, hidden).Scan(&p.ShowMature, &p.HiddenTags, &p.UpdatedAt)
+	if err != nil {
+		return p, fmt.Errorf("failed to update content preferences: %w", err)
+	}
+	return p, nil
+}
@@ -1,14 +1,17 @@
 package repository
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
-
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/tullo/backend/internal/database"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
 )
 
 type ConversationRepository struct {
@@ -45,22 +48,36 @@ func (r *ConversationRepository) Create(conversation *models.Conversation) error
 
 // GetByID retrieves a conversation by ID
 func (r *ConversationRepository) GetByID(id uuid.UUID) (*models.Conversation, error) {
+	return r.getByID(id, false)
+}
+
+// GetByIDIncludeDeleted retrieves a conversation even if it has been soft-deleted (admin use)
+func (r *ConversationRepository) GetByIDIncludeDeleted(id uuid.UUID) (*models.Conversation, error) {
+	return r.getByID(id, true)
+}
+
+func (r *ConversationRepository) getByID(id uuid.UUID, includeDeleted bool) (*models.Conversation, error) {
 	query := `
-		SELECT id, is_group, name, created_at, updated_at
+		SELECT id, is_group, name, formatting, retention_days, retention_action, created_at, updated_at, deleted_at, version
 		FROM conversations
-		WHERE id = $1
+		WHERE id = $1 AND ($2 OR deleted_at IS NULL)
 	`
 
 	conversation := &models.Conversation{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRow(query, id, includeDeleted).Scan(
 		&conversation.ID,
 		&conversation.IsGroup,
 		&conversation.Name,
+		&conversation.Formatting,
+		&conversation.RetentionDays,
+		&conversation.RetentionAction,
 		&conversation.CreatedAt,
 		&conversation.UpdatedAt,
+		&conversation.DeletedAt,
+		&conversation.Version,
 	)
 
-	if err == sql.ErrNoRows {
+	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("conversation not found")
 	}
 	if err != nil {
@@ -70,13 +87,81 @@ func (r *ConversationRepository) GetByID(id uuid.UUID) (*models.Conversation, er
 	return conversation, nil
 }
 
+// Update updates a conversation's name and settings. conversation.Version must hold the version
+// the caller read; ErrVersionConflict is returned if the row changed in the meantime.
+func (r *ConversationRepository) Update(conversation *models.Conversation) error {
+	query := `
+		UPDATE conversations
+		SET name = $1, formatting = COALESCE($4, formatting),
+			retention_days = COALESCE($5, retention_days), retention_action = COALESCE($6, retention_action),
+			updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING formatting, retention_days, retention_action, updated_at, version
+	`
+
+	err := r.db.QueryRow(query, conversation.Name, conversation.ID, conversation.Version, conversation.Formatting, conversation.RetentionDays, conversation.RetentionAction).
+		Scan(&conversation.Formatting, &conversation.RetentionDays, &conversation.RetentionAction, &conversation.UpdatedAt, &conversation.Version)
+	if err == pgx.ErrNoRows {
+		if _, getErr := r.GetByID(conversation.ID); getErr != nil {
+			return fmt.Errorf("conversation not found")
+		}
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %w", err)
+	}
+
+	return nil
+}
+
+// Delete soft-deletes a conversation
+func (r *ConversationRepository) Delete(id uuid.UUID) error {
+	result, err := r.db.Exec(`UPDATE conversations SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+
+	rows := result.RowsAffected()
+
+	if rows == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+
+	return nil
+}
+
+// Restore clears the soft-delete marker on a conversation
+func (r *ConversationRepository) Restore(id uuid.UUID) error {
+	result, err := r.db.Exec(`UPDATE conversations SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore conversation: %w", err)
+	}
+
+	rows := result.RowsAffected()
+
+	if rows == 0 {
+		return fmt.Errorf("deleted conversation not found")
+	}
+
+	return nil
+}
+
+// PurgeDeleted permanently removes conversations soft-deleted before the cutoff
+func (r *ConversationRepository) PurgeDeleted(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM conversations WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge conversations: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
 // GetByUserID retrieves all conversations for a user
 func (r *ConversationRepository) GetByUserID(userID uuid.UUID) ([]models.Conversation, error) {
 	query := `
 		SELECT c.id, c.is_group, c.name, c.created_at, c.updated_at
 		FROM conversations c
 		INNER JOIN conversation_members cm ON c.id = cm.conversation_id
-		WHERE cm.user_id = $1
+		WHERE cm.user_id = $1 AND c.deleted_at IS NULL
 		ORDER BY c.updated_at DESC
 	`
 
@@ -105,6 +190,62 @@ func (r *ConversationRepository) GetByUserID(userID uuid.UUID) ([]models.Convers
 	return conversations, nil
 }
 
+// ListByUserID returns a keyset page of a user's conversations, most recently
+// updated first. Up to limit+1 rows are returned so callers can detect a further page.
+func (r *ConversationRepository) ListByUserID(userID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.Conversation, error) {
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+
+	query := `
+		SELECT c.id, c.is_group, c.name, c.created_at, c.updated_at, c.version, cm.last_read_message_id,
+			EXISTS (SELECT 1 FROM message_requests mr WHERE mr.conversation_id = c.id),
+			cm.draft, cm.draft_updated_at
+		FROM conversations c
+		INNER JOIN conversation_members cm ON c.id = cm.conversation_id
+		WHERE cm.user_id = $1 AND c.deleted_at IS NULL
+		AND ($2::timestamp IS NULL OR (c.updated_at, c.id) < ($2, $3))
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(query, userID, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		var conv models.Conversation
+		var draft *string
+		var draftUpdatedAt *time.Time
+		err := rows.Scan(
+			&conv.ID,
+			&conv.IsGroup,
+			&conv.Name,
+			&conv.CreatedAt,
+			&conv.UpdatedAt,
+			&conv.Version,
+			&conv.LastReadMessageID,
+			&conv.RequestPending,
+			&draft,
+			&draftUpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		if draft != nil {
+			conv.Draft = &models.Draft{Body: *draft, UpdatedAt: draftUpdatedAt}
+		}
+		conversations = append(conversations, conv)
+	}
+
+	return conversations, nil
+}
+
 // AddMember adds a member to a conversation
 func (r *ConversationRepository) AddMember(member *models.ConversationMember) error {
 	query := `
@@ -123,7 +264,7 @@ func (r *ConversationRepository) AddMember(member *models.ConversationMember) er
 		member.JoinedAt,
 	).Scan(&member.ID, &member.JoinedAt)
 
-	if err == sql.ErrNoRows {
+	if err == pgx.ErrNoRows {
 		// Member already exists
 		return nil
 	}
@@ -134,6 +275,93 @@ func (r *ConversationRepository) AddMember(member *models.ConversationMember) er
 	return nil
 }
 
+// WithTx runs fn inside a transaction, committing if it returns nil
+func (r *ConversationRepository) WithTx(fn func(tx pgx.Tx) error) error {
+	ctx := context.Background()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// AddMembers inserts members with a single multi-row insert inside tx.
+// Users that are already members are skipped; the returned slice holds only
+// the members that were actually added.
+func (r *ConversationRepository) AddMembers(tx pgx.Tx, members []models.ConversationMember) ([]models.ConversationMember, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO conversation_members (id, conversation_id, user_id, role, joined_at) VALUES `)
+	args := make([]interface{}, 0, len(members)*5)
+	for i, m := range members {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		n := i * 5
+		fmt.Fprintf(&sb, "($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+		args = append(args, m.ID, m.ConversationID, m.UserID, m.Role, m.JoinedAt)
+	}
+	sb.WriteString(` ON CONFLICT (conversation_id, user_id) DO NOTHING RETURNING id`)
+
+	rows, err := tx.Query(context.Background(), sb.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add members: %w", err)
+	}
+	defer rows.Close()
+
+	inserted := make(map[uuid.UUID]bool, len(members))
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan added member: %w", err)
+		}
+		inserted[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to add members: %w", err)
+	}
+
+	added := make([]models.ConversationMember, 0, len(inserted))
+	for _, m := range members {
+		if inserted[m.ID] {
+			added = append(added, m)
+		}
+	}
+	return added, nil
+}
+
+// CreateWithMembers creates a conversation and its initial members in one transaction
+func (r *ConversationRepository) CreateWithMembers(conversation *models.Conversation, members []models.ConversationMember) ([]models.ConversationMember, error) {
+	var added []models.ConversationMember
+	err := r.WithTx(func(tx pgx.Tx) error {
+		_, err := tx.Exec(context.Background(),
+			`INSERT INTO conversations (id, is_group, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+			conversation.ID, conversation.IsGroup, conversation.Name, conversation.CreatedAt, conversation.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create conversation: %w", err)
+		}
+		added, err = r.AddMembers(tx, members)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
 // RemoveMember removes a member from a conversation
 func (r *ConversationRepository) RemoveMember(conversationID, userID uuid.UUID) error {
 	query := `
@@ -146,10 +374,7 @@ func (r *ConversationRepository) RemoveMember(conversationID, userID uuid.UUID)
 		return fmt.Errorf("failed to remove member: %w", err)
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
-	}
+	rows := result.RowsAffected()
 
 	if rows == 0 {
 		return fmt.Errorf("member not found")
@@ -161,10 +386,10 @@ func (r *ConversationRepository) RemoveMember(conversationID, userID uuid.UUID)
 // GetMembers retrieves all members of a conversation
 func (r *ConversationRepository) GetMembers(conversationID uuid.UUID) ([]models.User, error) {
 	query := `
-		SELECT u.id, u.email, u.display_name, u.avatar_url, u.password_hash, u.created_at, u.updated_at
+		SELECT u.id, u.email, u.display_name, u.username, u.avatar_url, u.password_hash, u.created_at, u.updated_at
 		FROM users u
 		INNER JOIN conversation_members cm ON u.id = cm.user_id
-		WHERE cm.conversation_id = $1
+		WHERE cm.conversation_id = $1 AND u.deleted_at IS NULL
 	`
 
 	rows, err := r.db.Query(query, conversationID)
@@ -180,6 +405,7 @@ func (r *ConversationRepository) GetMembers(conversationID uuid.UUID) ([]models.
 			&user.ID,
 			&user.Email,
 			&user.DisplayName,
+			&user.Username,
 			&user.AvatarURL,
 			&user.PasswordHash,
 			&user.CreatedAt,
@@ -194,17 +420,62 @@ func (r *ConversationRepository) GetMembers(conversationID uuid.UUID) ([]models.
 	return members, nil
 }
 
-// IsMember checks if a user is a member of a conversation
-func (r *ConversationRepository) IsMember(conversationID, userID uuid.UUID) (bool, error) {
+// GetMembersByConversationIDs retrieves the members of several conversations in
+// one query, keyed by conversation ID
+func (r *ConversationRepository) GetMembersByConversationIDs(conversationIDs []uuid.UUID) (map[uuid.UUID][]models.User, error) {
+	members := make(map[uuid.UUID][]models.User, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return members, nil
+	}
+
 	query := `
-		SELECT EXISTS(
-			SELECT 1 FROM conversation_members
-			WHERE conversation_id = $1 AND user_id = $2
-		)
+		SELECT cm.conversation_id, u.id, u.email, u.display_name, u.username, u.avatar_url, u.created_at, u.updated_at
+		FROM conversation_members cm
+		INNER JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = ANY($1) AND u.deleted_at IS NULL
+		ORDER BY cm.joined_at
 	`
 
+	rows, err := r.db.Query(query, conversationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var convID uuid.UUID
+		var user models.User
+		err := rows.Scan(
+			&convID,
+			&user.ID,
+			&user.Email,
+			&user.DisplayName,
+			&user.Username,
+			&user.AvatarURL,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members[convID] = append(members[convID], user)
+	}
+
+	return members, nil
+}
+
+var stmtMembershipCheck = database.Prepare("membership_check", `
+	SELECT EXISTS(
+		SELECT 1 FROM conversation_members cm
+		INNER JOIN conversations c ON c.id = cm.conversation_id
+		WHERE cm.conversation_id = $1 AND cm.user_id = $2 AND c.deleted_at IS NULL
+	)
+`)
+
+// IsMember checks if a user is a member of a conversation
+func (r *ConversationRepository) IsMember(conversationID, userID uuid.UUID) (bool, error) {
 	var exists bool
-	err := r.db.QueryRow(query, conversationID, userID).Scan(&exists)
+	err := r.db.QueryRow(stmtMembershipCheck, conversationID, userID).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check membership: %w", err)
 	}
@@ -212,8 +483,137 @@ func (r *ConversationRepository) IsMember(conversationID, userID uuid.UUID) (boo
 	return exists, nil
 }
 
-// GetOrCreateDirectConversation gets or creates a 1:1 conversation between two users
-func (r *ConversationRepository) GetOrCreateDirectConversation(user1ID, user2ID uuid.UUID) (*models.Conversation, error) {
+var stmtMemberKind = database.Prepare("member_kind", `
+	SELECT c.is_group,
+		EXISTS(SELECT 1 FROM channels ch WHERE ch.conversation_id = c.id AND ch.deleted_at IS NULL)
+	FROM conversation_members cm
+	INNER JOIN conversations c ON c.id = cm.conversation_id
+	WHERE cm.conversation_id = $1 AND cm.user_id = $2 AND c.deleted_at IS NULL
+`)
+
+// MemberKind checks that a user is a member of a conversation, like
+// IsMember, and returns the conversation's kind (models.ConversationDirect,
+// Group or Channel), or "" if the user is not a member
+func (r *ConversationRepository) MemberKind(conversationID, userID uuid.UUID) (string, error) {
+	var isGroup, isChannel bool
+	err := r.db.QueryRow(stmtMemberKind, conversationID, userID).Scan(&isGroup, &isChannel)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check membership: %w", err)
+	}
+
+	switch {
+	case isChannel:
+		return models.ConversationChannel, nil
+	case isGroup:
+		return models.ConversationGroup, nil
+	default:
+		return models.ConversationDirect, nil
+	}
+}
+
+// GetReadMarker returns the ID of the last message userID has read in the
+// conversation, or nil if they have not read any
+func (r *ConversationRepository) GetReadMarker(conversationID, userID uuid.UUID) (*uuid.UUID, error) {
+	var id *uuid.UUID
+	err := r.db.QueryRow(`SELECT last_read_message_id FROM conversation_members WHERE conversation_id = $1 AND user_id = $2`, conversationID, userID).Scan(&id)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to get read marker: %w", err)
+	}
+	return id, nil
+}
+
+// GetDraft returns userID's draft in the conversation; its body is empty
+// when they have none
+func (r *ConversationRepository) GetDraft(conversationID, userID uuid.UUID) (*models.Draft, error) {
+	d := &models.Draft{}
+	var body *string
+	err := r.db.QueryRow(`SELECT draft, draft_updated_at FROM conversation_members WHERE conversation_id = $1 AND user_id = $2`,
+		conversationID, userID).Scan(&body, &d.UpdatedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to get draft: %w", err)
+	}
+	if body != nil {
+		d.Body = *body
+	}
+	return d, nil
+}
+
+// SaveDraft replaces userID's draft in the conversation; an empty body
+// discards it
+func (r *ConversationRepository) SaveDraft(conversationID, userID uuid.UUID, body string) (*models.Draft, error) {
+	query := `
+		UPDATE conversation_members
+		SET draft = NULLIF($3, ''), draft_updated_at = CASE WHEN $3 = '' THEN NULL ELSE NOW() END
+		WHERE conversation_id = $1 AND user_id = $2
+		RETURNING draft_updated_at
+	`
+	d := &models.Draft{Body: body}
+	err := r.db.QueryRow(query, conversationID, userID, body).Scan(&d.UpdatedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return d, nil
+}
+
+// GetNotificationSettings returns the user's notification settings for the
+// conversation. An expired mute reads as unmuted.
+func (r *ConversationRepository) GetNotificationSettings(conversationID, userID uuid.UUID) (*models.NotificationSettings, error) {
+	query := `
+		SELECT notifications_muted AND (notifications_muted_until IS NULL OR notifications_muted_until > NOW()),
+			CASE WHEN notifications_muted_until > NOW() THEN notifications_muted_until END
+		FROM conversation_members
+		WHERE conversation_id = $1 AND user_id = $2
+	`
+	s := &models.NotificationSettings{ConversationID: conversationID}
+	err := r.db.QueryRow(query, conversationID, userID).Scan(&s.Muted, &s.MutedUntil)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+	return s, nil
+}
+
+// SetNotificationSettings mutes the conversation's notifications for the user
+// until until (nil: until unmuted), or unmutes them
+func (r *ConversationRepository) SetNotificationSettings(conversationID, userID uuid.UUID, muted bool, until *time.Time) (*models.NotificationSettings, error) {
+	if !muted {
+		until = nil
+	}
+	query := `
+		UPDATE conversation_members SET notifications_muted = $3, notifications_muted_until = $4
+		WHERE conversation_id = $1 AND user_id = $2
+	`
+	if _, err := r.db.Exec(query, conversationID, userID, muted, until); err != nil {
+		return nil, fmt.Errorf("failed to set notification settings: %w", err)
+	}
+	return &models.NotificationSettings{ConversationID: conversationID, Muted: muted, MutedUntil: until}, nil
+}
+
+// DMNotAllowedError is returned by GetOrCreateDirectConversation when the
+// recipient takes direct messages from nobody
+type DMNotAllowedError struct {
+	RecipientID uuid.UUID
+	Policy      string
+}
+
+func (e *DMNotAllowedError) Error() string {
+	return fmt.Sprintf("user %s does not accept direct messages (%s)", e.RecipientID, e.Policy)
+}
+
+// ErrMessageRequestNotFound is returned for unknown message requests and
+// those addressed to someone else
+var ErrMessageRequestNotFound = errors.New("message request not found")
+
+// GetOrCreateDirectConversation gets or creates a 1:1 conversation from
+// senderID to recipientID, subject to the recipient's DM policy. A new
+// conversation with someone outside the recipient's network is a message
+// request: only the sender is a member, and the conversation is returned with
+// RequestPending set. If the recipient had requested to message the sender,
+// that request is accepted instead. Returns ErrUserNotFound for an unknown
+// recipient and a *DMNotAllowedError if they take no direct messages.
+func (r *ConversationRepository) GetOrCreateDirectConversation(senderID, recipientID uuid.UUID) (*models.Conversation, error) {
 	// Check if conversation already exists
 	query := `
 		SELECT c.id, c.is_group, c.name, c.created_at, c.updated_at
@@ -221,13 +621,14 @@ func (r *ConversationRepository) GetOrCreateDirectConversation(user1ID, user2ID
 		INNER JOIN conversation_members cm1 ON c.id = cm1.conversation_id
 		INNER JOIN conversation_members cm2 ON c.id = cm2.conversation_id
 		WHERE c.is_group = false
+		AND c.deleted_at IS NULL
 		AND cm1.user_id = $1
 		AND cm2.user_id = $2
 		LIMIT 1
 	`
 
 	conversation := &models.Conversation{}
-	err := r.db.QueryRow(query, user1ID, user2ID).Scan(
+	err := r.db.QueryRow(query, senderID, recipientID).Scan(
 		&conversation.ID,
 		&conversation.IsGroup,
 		&conversation.Name,
@@ -239,21 +640,55 @@ func (r *ConversationRepository) GetOrCreateDirectConversation(user1ID, user2ID
 		return conversation, nil
 	}
 
-	if err != sql.ErrNoRows {
+	if err != pgx.ErrNoRows {
 		return nil, fmt.Errorf("failed to check existing conversation: %w", err)
 	}
 
+	// A pending request in either direction
+	var requestID, requestSender uuid.UUID
+	err = r.db.QueryRow(`
+		SELECT conversation_id, sender_id FROM message_requests
+		WHERE (sender_id = $1 AND recipient_id = $2) OR (sender_id = $2 AND recipient_id = $1)
+		LIMIT 1
+	`, senderID, recipientID).Scan(&requestID, &requestSender)
+	switch {
+	case err == nil && requestSender == senderID:
+		conv, err := r.GetByID(requestID)
+		if err != nil {
+			return nil, err
+		}
+		conv.RequestPending = true
+		return conv, nil
+	case err == nil:
+		if err := r.AcceptMessageRequest(requestID, senderID); err != nil {
+			return nil, err
+		}
+		return r.GetByID(requestID)
+	case err != pgx.ErrNoRows:
+		return nil, fmt.Errorf("failed to check message requests: %w", err)
+	}
+
+	policy, inNetwork, err := r.dmAccess(senderID, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == models.DMPolicyNone && senderID != recipientID {
+		return nil, &DMNotAllowedError{RecipientID: recipientID, Policy: policy}
+	}
+	request := !inNetwork && senderID != recipientID
+
 	// Create new conversation
+	ctx := context.Background()
 	tx, err := r.db.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer tx.Rollback()
+	defer tx.Rollback(ctx)
 
 	conversation.ID = uuid.New()
 	conversation.IsGroup = false
 
-	_, err = tx.Exec(
+	_, err = tx.Exec(ctx,
 		`INSERT INTO conversations (id, is_group, created_at, updated_at) VALUES ($1, $2, NOW(), NOW())`,
 		conversation.ID,
 		conversation.IsGroup,
@@ -262,28 +697,161 @@ func (r *ConversationRepository) GetOrCreateDirectConversation(user1ID, user2ID
 		return nil, fmt.Errorf("failed to create conversation: %w", err)
 	}
 
-	// Add both members
-	_, err = tx.Exec(
-		`INSERT INTO conversation_members (id, conversation_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4, NOW())`,
-		uuid.New(), conversation.ID, user1ID, "member",
-	)
+	// Add both members, or only the sender of a request
+	now := time.Now()
+	members := []models.ConversationMember{
+		{ID: uuid.New(), ConversationID: conversation.ID, UserID: senderID, Role: "member", JoinedAt: now},
+	}
+	if request {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO message_requests (conversation_id, sender_id, recipient_id) VALUES ($1, $2, $3)`,
+			conversation.ID, senderID, recipientID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message request: %w", err)
+		}
+	} else {
+		members = append(members, models.ConversationMember{ID: uuid.New(), ConversationID: conversation.ID, UserID: recipientID, Role: "member", JoinedAt: now})
+	}
+	if _, err = r.AddMembers(tx, members); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	conv, err := r.GetByID(conversation.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add first member: %w", err)
+		return nil, err
 	}
+	conv.RequestPending = request
+	return conv, nil
+}
 
-	_, err = tx.Exec(
-		`INSERT INTO conversation_members (id, conversation_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4, NOW())`,
-		uuid.New(), conversation.ID, user2ID, "member",
-	)
+// dmAccess returns the recipient's DM policy and whether the sender is in
+// their network under it: anyone for everyone, a member of a channel chat
+// the recipient is in for shared_channels, a follower of one of the
+// recipient's channels for followers, and nobody for none
+func (r *ConversationRepository) dmAccess(senderID, recipientID uuid.UUID) (string, bool, error) {
+	query := `
+		SELECT u.dm_policy, CASE u.dm_policy
+			WHEN 'everyone' THEN TRUE
+			WHEN 'shared_channels' THEN EXISTS (
+				SELECT 1 FROM channels ch
+				JOIN conversation_members a ON a.conversation_id = ch.conversation_id AND a.user_id = $1
+				JOIN conversation_members b ON b.conversation_id = ch.conversation_id AND b.user_id = $2
+				WHERE ch.deleted_at IS NULL)
+			WHEN 'followers' THEN EXISTS (
+				SELECT 1 FROM channel_follows f
+				JOIN channels ch ON ch.id = f.channel_id AND ch.deleted_at IS NULL
+				WHERE f.user_id = $1 AND ch.owner_id = $2)
+			ELSE FALSE END
+		FROM users u WHERE u.id = $2 AND u.deleted_at IS NULL
+	`
+	var policy string
+	var inNetwork bool
+	err := r.db.QueryRow(query, senderID, recipientID).Scan(&policy, &inNetwork)
+	if err == pgx.ErrNoRows {
+		return "", false, ErrUserNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to add second member: %w", err)
+		return "", false, fmt.Errorf("failed to check DM policy: %w", err)
 	}
+	return policy, inNetwork, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+// ListMessageRequests returns a page of the requests sent to recipientID,
+// newest first, with their senders. LastMessage is not set.
+func (r *ConversationRepository) ListMessageRequests(recipientID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.MessageRequest, error) {
+	if limit <= 0 {
+		limit = pagination.DefaultLimit
+	}
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+	query := `
+		SELECT mr.conversation_id, mr.created_at, u.id, u.display_name, u.username, u.avatar_url, u.created_at, u.updated_at
+		FROM message_requests mr
+		JOIN conversations c ON c.id = mr.conversation_id AND c.deleted_at IS NULL
+		JOIN users u ON u.id = mr.sender_id AND u.deleted_at IS NULL
+		WHERE mr.recipient_id = $1 AND ($2::timestamp IS NULL OR (mr.created_at, mr.conversation_id) < ($2, $3))
+		ORDER BY mr.created_at DESC, mr.conversation_id DESC LIMIT $4
+	`
+	rows, err := r.db.Query(query, recipientID, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message requests: %w", err)
 	}
+	defer rows.Close()
 
-	return r.GetByID(conversation.ID)
+	requests := []models.MessageRequest{}
+	for rows.Next() {
+		var mr models.MessageRequest
+		if err := rows.Scan(&mr.ConversationID, &mr.CreatedAt, &mr.Sender.ID, &mr.Sender.DisplayName, &mr.Sender.Username,
+			&mr.Sender.AvatarURL, &mr.Sender.CreatedAt, &mr.Sender.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message request: %w", err)
+		}
+		requests = append(requests, mr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list message requests: %w", err)
+	}
+	return requests, nil
+}
+
+// IsRequestRecipient reports whether conversationID is a pending message
+// request to userID, who may then read it before answering
+func (r *ConversationRepository) IsRequestRecipient(conversationID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM message_requests WHERE conversation_id = $1 AND recipient_id = $2)`,
+		conversationID, userID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check message requests: %w", err)
+	}
+	return exists, nil
+}
+
+// AcceptMessageRequest makes the recipient a member of the requested
+// conversation
+func (r *ConversationRepository) AcceptMessageRequest(conversationID, recipientID uuid.UUID) error {
+	return r.WithTx(func(tx pgx.Tx) error {
+		tag, err := tx.Exec(context.Background(),
+			`DELETE FROM message_requests WHERE conversation_id = $1 AND recipient_id = $2`, conversationID, recipientID)
+		if err != nil {
+			return fmt.Errorf("failed to accept message request: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrMessageRequestNotFound
+		}
+		_, err = r.AddMembers(tx, []models.ConversationMember{
+			{ID: uuid.New(), ConversationID: conversationID, UserID: recipientID, Role: "member", JoinedAt: time.Now()},
+		})
+		return err
+	})
+}
+
+// DeclineMessageRequest deletes the requested conversation. The sender may
+// request again.
+func (r *ConversationRepository) DeclineMessageRequest(conversationID, recipientID uuid.UUID) error {
+	return r.WithTx(func(tx pgx.Tx) error {
+		ctx := context.Background()
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM message_requests WHERE conversation_id = $1 AND recipient_id = $2`, conversationID, recipientID)
+		if err != nil {
+			return fmt.Errorf("failed to decline message request: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrMessageRequestNotFound
+		}
+		if _, err := tx.Exec(ctx, `UPDATE conversations SET deleted_at = NOW() WHERE id = $1`, conversationID); err != nil {
+			return fmt.Errorf("failed to delete requested conversation: %w", err)
+		}
+		return nil
+	})
 }
 
 // GetMemberRole returns the role of a member in a conversation (e.g., 'admin','moderator','member')
@@ -293,7 +861,7 @@ func (r *ConversationRepository) GetMemberRole(conversationID, userID uuid.UUID)
 	`
 	var role string
 	err := r.db.QueryRow(query, conversationID, userID).Scan(&role)
-	if err == sql.ErrNoRows {
+	if err == pgx.ErrNoRows {
 		return "", nil
 	}
 	if err != nil {
@@ -316,23 +884,57 @@ func (r *ConversationRepository) AddModeration(conversationID, userID uuid.UUID,
 	return nil
 }
 
-// RemoveModeration removes a moderation entry
-func (r *ConversationRepository) RemoveModeration(conversationID, userID uuid.UUID, action string) error {
-	query := `DELETE FROM conversation_moderations WHERE conversation_id = $1 AND user_id = $2 AND action = $3`
-	_, err := r.db.Exec(query, conversationID, userID, action)
+// RemoveModeration removes a moderation entry and reports whether there was
+// one in force
+func (r *ConversationRepository) RemoveModeration(conversationID, userID uuid.UUID, action string) (bool, error) {
+	query := `DELETE FROM conversation_moderations WHERE conversation_id = $1 AND user_id = $2 AND action = $3
+		RETURNING expires_at IS NULL OR expires_at > NOW()`
+	var active bool
+	err := r.db.QueryRow(query, conversationID, userID, action).Scan(&active)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to remove moderation: %w", err)
+		return false, fmt.Errorf("failed to remove moderation: %w", err)
 	}
-	return nil
+	return active, nil
 }
 
+// DeleteExpiredModerations removes mutes and bans that expired before now
+// and returns them so the affected users can be notified
+func (r *ConversationRepository) DeleteExpiredModerations(now time.Time) ([]models.WSModerationPayload, error) {
+	rows, err := r.db.Query(`
+		DELETE FROM conversation_moderations
+		WHERE expires_at IS NOT NULL AND expires_at < $1
+		RETURNING conversation_id, user_id, action, expires_at
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired moderations: %w", err)
+	}
+	defer rows.Close()
+
+	var expired []models.WSModerationPayload
+	for rows.Next() {
+		var m models.WSModerationPayload
+		if err := rows.Scan(&m.ConversationID, &m.UserID, &m.Action, &m.ExpiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan expired moderation: %w", err)
+		}
+		expired = append(expired, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete expired moderations: %w", err)
+	}
+	return expired, nil
+}
+
+var stmtModerationCheck = database.Prepare("moderation_check", `
+	SELECT action, expires_at FROM conversation_moderations
+	WHERE conversation_id = $1 AND user_id = $2
+`)
+
 // IsUserMutedOrBanned checks if a user is currently muted or banned in a conversation
 func (r *ConversationRepository) IsUserMutedOrBanned(conversationID, userID uuid.UUID) (muted bool, banned bool, err error) {
-	query := `
-		SELECT action, expires_at FROM conversation_moderations
-		WHERE conversation_id = $1 AND user_id = $2
-	`
-	rows, err := r.db.Query(query, conversationID, userID)
+	rows, err := r.db.Query(stmtModerationCheck, conversationID, userID)
 	if err != nil {
 		return false, false, fmt.Errorf("failed to check moderation: %w", err)
 	}
@@ -341,11 +943,11 @@ func (r *ConversationRepository) IsUserMutedOrBanned(conversationID, userID uuid
 	now := time.Now()
 	for rows.Next() {
 		var action string
-		var expiresAt sql.NullTime
+		var expiresAt *time.Time
 		if err := rows.Scan(&action, &expiresAt); err != nil {
 			return false, false, fmt.Errorf("failed to scan moderation: %w", err)
 		}
-		if expiresAt.Valid && expiresAt.Time.Before(now) {
+		if expiresAt != nil && expiresAt.Before(now) {
 			// expired; skip
 			continue
 		}
@@ -367,7 +969,7 @@ func (r *ConversationRepository) UpdateMemberRole(conversationID, userID uuid.UU
 	if err != nil {
 		return fmt.Errorf("failed to update member role: %w", err)
 	}
-	rows, _ := res.RowsAffected()
+	rows := res.RowsAffected()
 	if rows > 0 {
 		return nil
 	}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestMemberKind(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	channels := NewChannelRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "kinds@example.com", DisplayName: "kinds", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: u.ID, Slug: "kinds", Title: "Kinds", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	channelConv, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct := &models.Conversation{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	group := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	for _, c := range []*models.Conversation{direct, group} {
+		if err := convs.Create(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []uuid.UUID{direct.ID, group.ID, channelConv} {
+		if err := convs.AddMember(&models.ConversationMember{ID: uuid.New(), ConversationID: id, UserID: u.ID, Role: "member", JoinedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		convID uuid.UUID
+		want   string
+	}{
+		{"direct", direct.ID, models.ConversationDirect},
+		{"group", group.ID, models.ConversationGroup},
+		{"channel", channelConv, models.ConversationChannel},
+		{"not a member", uuid.New(), ""},
+	}
+	for _, tt := range tests {
+		if got, err := convs.MemberKind(tt.convID, u.ID); err != nil || got != tt.want {
+			t.Errorf("%s: MemberKind = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestRemoveModeration(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "muted@example.com", DisplayName: "muted", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	group := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(group); err != nil {
+		t.Fatal(err)
+	}
+
+	past := now.Add(-time.Minute)
+	if err := convs.AddModeration(group.ID, u.ID, "mute", nil, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.AddModeration(group.ID, u.ID, "ban", &past, "lapsed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := convs.RemoveModeration(group.ID, u.ID, "mute"); err != nil || !removed {
+		t.Errorf("RemoveModeration(mute) = %v, %v; want true", removed, err)
+	}
+	if removed, err := convs.RemoveModeration(group.ID, u.ID, "mute"); err != nil || removed {
+		t.Errorf("second RemoveModeration(mute) = %v, %v; want false", removed, err)
+	}
+	// A lapsed ban is removed but was no longer in force
+	if removed, err := convs.RemoveModeration(group.ID, u.ID, "ban"); err != nil || removed {
+		t.Errorf("RemoveModeration(lapsed ban) = %v, %v; want false", removed, err)
+	}
+	if muted, banned, err := convs.IsUserMutedOrBanned(group.ID, u.ID); err != nil || muted || banned {
+		t.Errorf("IsUserMutedOrBanned = %v, %v, %v", muted, banned, err)
+	}
+}
+
+func TestDirectConversationPrivacy(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	channels := NewChannelRepository(db)
+
+	now := time.Now()
+	var alice, bob, carol models.User
+	for i, u := range []*models.User{&alice, &bob, &carol} {
+		*u = models.User{ID: uuid.New(), Email: fmt.Sprintf("dm%d@example.com", i), DisplayName: "DM user", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nobody may message Carol
+	if err := users.SetDMPolicy(carol.ID, models.DMPolicyNone); err != nil {
+		t.Fatal(err)
+	}
+	var notAllowed *DMNotAllowedError
+	if _, err := convs.GetOrCreateDirectConversation(alice.ID, carol.ID); !errors.As(err, &notAllowed) {
+		t.Fatalf("DM to none err = %v, want DMNotAllowedError", err)
+	}
+	if _, err := convs.GetOrCreateDirectConversation(alice.ID, uuid.New()); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("DM to unknown user err = %v, want ErrUserNotFound", err)
+	}
+
+	// Only followers may message Bob; Alice doesn't follow him yet, so her
+	// DM is a request until Bob accepts it
+	if err := users.SetDMPolicy(bob.ID, models.DMPolicyFollowers); err != nil {
+		t.Fatal(err)
+	}
+	requested, err := convs.GetOrCreateDirectConversation(alice.ID, bob.ID)
+	if err != nil || !requested.RequestPending {
+		t.Fatalf("DM outside network = %+v, %v; want a pending request", requested, err)
+	}
+	if member, _ := convs.IsMember(requested.ID, bob.ID); member {
+		t.Error("recipient is a member before accepting")
+	}
+	if ok, _ := convs.IsRequestRecipient(requested.ID, bob.ID); !ok {
+		t.Error("recipient cannot read the request")
+	}
+	if ok, _ := convs.IsRequestRecipient(requested.ID, alice.ID); ok {
+		t.Error("sender is the request's recipient")
+	}
+	again, err := convs.GetOrCreateDirectConversation(alice.ID, bob.ID)
+	if err != nil || again.ID != requested.ID || !again.RequestPending {
+		t.Fatalf("second DM = %+v, %v; want the same request", again, err)
+	}
+	pending, err := convs.ListMessageRequests(bob.ID, 10, nil)
+	if err != nil || len(pending) != 1 || pending[0].Sender.ID != alice.ID {
+		t.Fatalf("ListMessageRequests = %+v, %v", pending, err)
+	}
+	if err := convs.AcceptMessageRequest(requested.ID, alice.ID); !errors.Is(err, ErrMessageRequestNotFound) {
+		t.Errorf("sender accepting err = %v, want ErrMessageRequestNotFound", err)
+	}
+	if err := convs.AcceptMessageRequest(requested.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if member, _ := convs.IsMember(requested.ID, bob.ID); !member {
+		t.Error("recipient is not a member after accepting")
+	}
+	if ok, _ := convs.IsRequestRecipient(requested.ID, bob.ID); ok {
+		t.Error("request still pending after accepting")
+	}
+
+	// Followers of Bob's channel are in his network
+	ch := &models.Channel{ID: uuid.New(), OwnerID: bob.ID, Slug: "bobs", Title: "Bob's", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := channels.AddFollower(ch.ID, carol.ID, models.FollowOrigin{}); err != nil {
+		t.Fatal(err)
+	}
+	direct, err := convs.GetOrCreateDirectConversation(carol.ID, bob.ID)
+	if err != nil || direct.RequestPending {
+		t.Fatalf("DM from follower = %+v, %v; want a conversation", direct, err)
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "drafts@example.com", DisplayName: "drafts", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.AddMember(&models.ConversationMember{ID: uuid.New(), ConversationID: conv.ID, UserID: u.ID, Role: "member", JoinedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, err := convs.GetDraft(conv.ID, u.ID); err != nil || d.Body != "" || d.UpdatedAt != nil {
+		t.Fatalf("GetDraft before saving = %+v, %v", d, err)
+	}
+	if d, err := convs.SaveDraft(conv.ID, u.ID, "half a thought"); err != nil || d.UpdatedAt == nil {
+		t.Fatalf("SaveDraft = %+v, %v", d, err)
+	}
+	list, err := convs.ListByUserID(u.ID, 10, nil)
+	if err != nil || len(list) != 1 || list[0].Draft == nil || list[0].Draft.Body != "half a thought" {
+		t.Fatalf("ListByUserID = %+v, %v; want the draft", list, err)
+	}
+
+	if _, err := convs.SaveDraft(conv.ID, u.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := convs.GetDraft(conv.ID, u.ID); err != nil || d.Body != "" || d.UpdatedAt != nil {
+		t.Fatalf("GetDraft after discarding = %+v, %v", d, err)
+	}
+}
+
+func TestNotificationSettings(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "notify@example.com", DisplayName: "notify", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.AddMember(&models.ConversationMember{ID: uuid.New(), ConversationID: conv.ID, UserID: u.ID, Role: "member", JoinedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := convs.GetNotificationSettings(conv.ID, u.ID); err != nil || s.Muted {
+		t.Fatalf("GetNotificationSettings before muting = %+v, %v", s, err)
+	}
+	if _, err := convs.SetNotificationSettings(conv.ID, u.ID, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := convs.GetNotificationSettings(conv.ID, u.ID); err != nil || !s.Muted || s.MutedUntil != nil {
+		t.Fatalf("GetNotificationSettings after muting = %+v, %v", s, err)
+	}
+	past := now.Add(-time.Minute)
+	if _, err := convs.SetNotificationSettings(conv.ID, u.ID, true, &past); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := convs.GetNotificationSettings(conv.ID, u.ID); err != nil || s.Muted {
+		t.Fatalf("GetNotificationSettings after the mute expired = %+v, %v", s, err)
+	}
+
+	if until, err := users.GetDoNotDisturb(u.ID); err != nil || until != nil {
+		t.Fatalf("GetDoNotDisturb = %v, %v; want off", until, err)
+	}
+	later := now.Add(time.Hour)
+	if err := users.SetDoNotDisturb(u.ID, &later); err != nil {
+		t.Fatal(err)
+	}
+	if until, err := users.GetDoNotDisturb(u.ID); err != nil || until == nil {
+		t.Fatalf("GetDoNotDisturb = %v, %v; want on", until, err)
+	}
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// DashboardRepository loads the creator dashboard's per-channel figures
+type DashboardRepository struct {
+	db *database.DB
+}
+
+func NewDashboardRepository(db *database.DB) *DashboardRepository {
+	return &DashboardRepository{db: db}
+}
+
+const (
+	stmtDashboardStreams = `
+		SELECT DISTINCT ON (channel_id) ` + streamColumns + `
+		FROM streams WHERE channel_id = ANY($1) ORDER BY channel_id, created_at DESC
+	`
+	stmtDashboardFollowerCounts  = `SELECT channel_id, COUNT(*) FROM channel_follows WHERE channel_id = ANY($1) GROUP BY channel_id`
+	stmtDashboardRecentFollowers = `
+		SELECT ch.id, f.id, f.created_at, f.user_id, f.display_name, f.avatar_url
+		FROM unnest($1::uuid[]) AS ch(id)
+		CROSS JOIN LATERAL (
+			SELECT cf.id, cf.created_at, u.id AS user_id, u.display_name, u.avatar_url
+			FROM channel_follows cf
+			INNER JOIN users u ON u.id = cf.user_id
+			WHERE cf.channel_id = ch.id AND u.deleted_at IS NULL
+			ORDER BY cf.created_at DESC, cf.id DESC
+			LIMIT $2
+		) f
+		ORDER BY ch.id, f.created_at DESC, f.id DESC
+	`
+	// Mentions are matched as in the mention digest
+	stmtDashboardUnreadMentions = `
+		SELECT ch.id, COUNT(*)
+		FROM channels ch
+		INNER JOIN messages m ON m.conversation_id = ch.conversation_id
+		INNER JOIN users u ON u.id = $2
+		WHERE ch.id = ANY($1)
+		AND m.deleted_at IS NULL AND m.sender_id <> u.id
+		AND ` + mentions + `
+		AND NOT EXISTS (SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND mr.user_id = u.id)
+		GROUP BY ch.id
+	`
+	stmtDashboardModeration = `
+		SELECT ch.id,
+			(SELECT COUNT(*) FROM conversation_moderations cm
+			 WHERE cm.conversation_id = ch.conversation_id AND cm.action = 'ban' AND (cm.expires_at IS NULL OR cm.expires_at > NOW())),
+			(SELECT COUNT(*) FROM conversation_moderations cm
+			 WHERE cm.conversation_id = ch.conversation_id AND cm.action = 'mute' AND (cm.expires_at IS NULL OR cm.expires_at > NOW())),
+			(SELECT COUNT(*) FROM message_reports mr
+			 WHERE mr.conversation_id = ch.conversation_id AND mr.status = 'pending')
+		FROM channels ch
+		WHERE ch.id = ANY($1)
+	`
+)
+
+// Stats loads the latest stream, follower count, the recentFollowers newest
+// followers, userID's unread mentions, active bans and mutes and pending
+// message reports of each channel. The queries are sent as one batch, so the dashboard costs a single
+// round trip however many channels the user owns.
+func (r *DashboardRepository) Stats(userID uuid.UUID, channelIDs []uuid.UUID, recentFollowers int) (*models.DashboardStats, error) {
+	stats := &models.DashboardStats{
+		Streams:         map[uuid.UUID]models.Stream{},
+		Followers:       map[uuid.UUID]int{},
+		RecentFollowers: map[uuid.UUID][]models.Follower{},
+		UnreadMentions:  map[uuid.UUID]int{},
+		Moderation:      map[uuid.UUID]models.DashboardModeration{},
+	}
+	if len(channelIDs) == 0 {
+		return stats, nil
+	}
+
+	b := &pgx.Batch{}
+	b.Queue(stmtDashboardStreams, channelIDs).Query(func(rows pgx.Rows) error {
+		for rows.Next() {
+			s, err := scanStream(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan stream: %w", err)
+			}
+			stats.Streams[s.ChannelID] = *s
+		}
+		return rows.Err()
+	})
+	b.Queue(stmtDashboardFollowerCounts, channelIDs).Query(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var id uuid.UUID
+			var n int
+			if err := rows.Scan(&id, &n); err != nil {
+				return fmt.Errorf("failed to scan follower count: %w", err)
+			}
+			stats.Followers[id] = n
+		}
+		return rows.Err()
+	})
+	b.Queue(stmtDashboardRecentFollowers, channelIDs, recentFollowers).Query(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var id uuid.UUID
+			var f models.Follower
+			if err := rows.Scan(&id, &f.ID, &f.FollowedAt, &f.UserID, &f.DisplayName, &f.AvatarURL); err != nil {
+				return fmt.Errorf("failed to scan follower: %w", err)
+			}
+			stats.RecentFollowers[id] = append(stats.RecentFollowers[id], f)
+		}
+		return rows.Err()
+	})
+	b.Queue(stmtDashboardUnreadMentions, channelIDs, userID).Query(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var id uuid.UUID
+			var n int
+			if err := rows.Scan(&id, &n); err != nil {
+				return fmt.Errorf("failed to scan mention count: %w", err)
+			}
+			stats.UnreadMentions[id] = n
+		}
+		return rows.Err()
+	})
+	b.Queue(stmtDashboardModeration, channelIDs).Query(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var id uuid.UUID
+			var m models.DashboardModeration
+			if err := rows.Scan(&id, &m.ActiveBans, &m.ActiveMutes, &m.PendingReports); err != nil {
+				return fmt.Errorf("failed to scan moderation counts: %w", err)
+			}
+			stats.Moderation[id] = m
+		}
+		return rows.Err()
+	})
+
+	if err := r.db.SendBatch(b).Close(); err != nil {
+		return nil, fmt.Errorf("failed to load dashboard: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestDashboardStats(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	streams := NewStreamRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+	dashboard := NewDashboardRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	owner, fan, troll := newUser("owner"), newUser("fan"), newUser("troll")
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "owned", Title: "Owned", CreatedAt: now, UpdatedAt: now}
+	quiet := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "quiet", Title: "Quiet", CreatedAt: now.Add(time.Second), UpdatedAt: now}
+	for _, c := range []*models.Channel{ch, quiet} {
+		if err := channels.Create(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owned, err := channels.ListByOwner(owner.ID)
+	if err != nil || len(owned) != 2 || owned[0].ID != ch.ID {
+		t.Fatalf("ListByOwner = %+v, %v", owned, err)
+	}
+
+	if err := streams.Create(&models.Stream{ID: uuid.New(), ChannelID: ch.ID, Status: "live", StartedAt: &now, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*models.User{fan, troll} {
+		if _, err := channels.AddFollower(ch.ID, u.ID, models.FollowOrigin{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []*models.Message
+	for _, body := range []string{"hi @Owner", "no mention", "@owner again"} {
+		m := &models.Message{ID: uuid.New(), ConversationID: convID, SenderID: fan.ID, Body: body, CreatedAt: now, UpdatedAt: now}
+		if err := messages.Create(m); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, m)
+	}
+	if _, err := NewReportRepository(db).Create(sent[1], troll.ID, "spam", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := convs.AddModeration(convID, troll.ID, "ban", nil, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	past := now.Add(-time.Hour)
+	if err := convs.AddModeration(convID, fan.ID, "mute", &past, "expired"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := dashboard.Stats(owner.ID, []uuid.UUID{ch.ID, quiet.ID}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := stats.Streams[ch.ID]; !ok || s.Status != "live" {
+		t.Errorf("stream = %+v, %v", s, ok)
+	}
+	if _, ok := stats.Streams[quiet.ID]; ok {
+		t.Error("quiet channel has a stream")
+	}
+	if stats.Followers[ch.ID] != 2 || len(stats.RecentFollowers[ch.ID]) != 1 {
+		t.Errorf("followers = %d, recent = %+v", stats.Followers[ch.ID], stats.RecentFollowers[ch.ID])
+	}
+	if stats.UnreadMentions[ch.ID] != 2 {
+		t.Errorf("unread mentions = %d, want 2", stats.UnreadMentions[ch.ID])
+	}
+	if m := stats.Moderation[ch.ID]; m.ActiveBans != 1 || m.ActiveMutes != 0 || m.PendingReports != 1 {
+		t.Errorf("moderation = %+v, want one ban, no live mutes and one report", m)
+	}
+
+	// Once the owner has a username, only "@username" as a whole word counts
+	if err := users.SetUsername(owner, "boss"); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"gg @Boss!", "@bossy is someone else"} {
+		m := &models.Message{ID: uuid.New(), ConversationID: convID, SenderID: fan.ID, Body: body, CreatedAt: now, UpdatedAt: now}
+		if err := messages.Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err = dashboard.Stats(owner.ID, []uuid.UUID{ch.ID}, 1)
+	if err != nil || stats.UnreadMentions[ch.ID] != 1 {
+		t.Errorf("unread mentions by username = %d, %v; want 1", stats.UnreadMentions[ch.ID], err)
+	}
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrTooManyDevices is returned by Upsert when publishing a key for a new
+// device would exceed the per-user device limit
+var ErrTooManyDevices = errors.New("too many devices")
+
+// DeviceKeyRepository stores the public keys of users' devices for
+// end-to-end encrypted messages
+type DeviceKeyRepository struct {
+	db *database.DB
+}
+
+func NewDeviceKeyRepository(db *database.DB) *DeviceKeyRepository {
+	return &DeviceKeyRepository{db: db}
+}
+
+// Upsert publishes key, replacing the device's previous key. A user may have
+// at most maxDevices devices; replacing a key never counts against it.
+func (r *DeviceKeyRepository) Upsert(key *models.DeviceKey, maxDevices int) error {
+	query := `
+		INSERT INTO device_keys (user_id, device_id, algorithm, public_key, signature)
+		SELECT $1, $2, $3, $4, $5
+		WHERE EXISTS (SELECT 1 FROM device_keys WHERE user_id = $1 AND device_id = $2)
+		   OR (SELECT COUNT(*) FROM device_keys WHERE user_id = $1) < $6
+		ON CONFLICT (user_id, device_id) DO UPDATE
+		SET algorithm = EXCLUDED.algorithm,
+			public_key = EXCLUDED.public_key,
+			signature = EXCLUDED.signature,
+			updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+	err := r.db.QueryRow(query, key.UserID, key.DeviceID, key.Algorithm, key.PublicKey, key.Signature, maxDevices).
+		Scan(&key.CreatedAt, &key.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrTooManyDevices
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish device key: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns userID's device keys, oldest device first
+func (r *DeviceKeyRepository) ListByUser(userID uuid.UUID) ([]models.DeviceKey, error) {
+	query := `
+		SELECT user_id, device_id, algorithm, public_key, signature, created_at, updated_at
+		FROM device_keys
+		WHERE user_id = $1
+		ORDER BY created_at, device_id
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.DeviceKey{}
+	for rows.Next() {
+		var k models.DeviceKey
+		if err := rows.Scan(&k.UserID, &k.DeviceID, &k.Algorithm, &k.PublicKey, &k.Signature, &k.CreatedAt, &k.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan device key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Delete removes a device's key and reports whether it existed
+func (r *DeviceKeyRepository) Delete(userID uuid.UUID, deviceID string) (bool, error) {
+	tag, err := r.db.Exec(`DELETE FROM device_keys WHERE user_id = $1 AND device_id = $2`, userID, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete device key: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListByConversation returns the key bundle of a conversation: every member
+// with their device keys, members without keys included
+func (r *DeviceKeyRepository) ListByConversation(conversationID uuid.UUID) ([]models.MemberKeys, error) {
+	query := `
+		SELECT cm.user_id, k.device_id, k.algorithm, k.public_key, k.signature, k.created_at, k.updated_at
+		FROM conversation_members cm
+		LEFT JOIN device_keys k ON k.user_id = cm.user_id
+		WHERE cm.conversation_id = $1
+		ORDER BY cm.joined_at, cm.user_id, k.created_at, k.device_id
+	`
+	rows, err := r.db.Query(query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation keys: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.MemberKeys{}
+	for rows.Next() {
+		var userID uuid.UUID
+		var deviceID, algorithm, publicKey *string
+		var k models.DeviceKey
+		var createdAt, updatedAt *time.Time
+		if err := rows.Scan(&userID, &deviceID, &algorithm, &publicKey, &k.Signature, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation key: %w", err)
+		}
+		if len(members) == 0 || members[len(members)-1].UserID != userID {
+			members = append(members, models.MemberKeys{UserID: userID, Keys: []models.DeviceKey{}})
+		}
+		if deviceID == nil {
+			continue
+		}
+		k.UserID, k.DeviceID, k.Algorithm, k.PublicKey = userID, *deviceID, *algorithm, *publicKey
+		k.CreatedAt, k.UpdatedAt = *createdAt, *updatedAt
+		m := &members[len(members)-1]
+		m.Keys = append(m.Keys, k)
+	}
+	return members, rows.Err()
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestDeviceKeys(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	keys := NewDeviceKeyRepository(db)
+
+	now := time.Now()
+	alice := &models.User{ID: uuid.New(), Email: "keys-alice@example.com", DisplayName: "Alice", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	bob := &models.User{ID: uuid.New(), Email: "keys-bob@example.com", DisplayName: "Bob", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	for _, u := range []*models.User{alice, bob} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conv := &models.Conversation{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*models.User{alice, bob} {
+		if err := convs.AddMember(&models.ConversationMember{ID: uuid.New(), ConversationID: conv.ID, UserID: u.ID, Role: "member", JoinedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish := func(device, key string) error {
+		return keys.Upsert(&models.DeviceKey{UserID: alice.ID, DeviceID: device, Algorithm: models.KeyX25519, PublicKey: key}, 2)
+	}
+	if err := publish("phone", "a2V5MQ=="); err != nil {
+		t.Fatal(err)
+	}
+	if err := publish("laptop", "a2V5Mg=="); err != nil {
+		t.Fatal(err)
+	}
+	if err := publish("tablet", "a2V5Mw=="); !errors.Is(err, ErrTooManyDevices) {
+		t.Fatalf("third device: err = %v, want ErrTooManyDevices", err)
+	}
+	// Rotating a known device's key is not limited
+	if err := publish("phone", "a2V5NA=="); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	bundle, err := keys.ListByConversation(conv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[uuid.UUID][]models.DeviceKey{}
+	for _, m := range bundle {
+		got[m.UserID] = m.Keys
+	}
+	if len(got) != 2 || len(got[alice.ID]) != 2 || len(got[bob.ID]) != 0 {
+		t.Fatalf("bundle = %+v, want alice with 2 keys and bob with none", bundle)
+	}
+	for _, k := range got[alice.ID] {
+		if k.DeviceID == "phone" && k.PublicKey != "a2V5NA==" {
+			t.Errorf("phone key = %q, want the rotated key", k.PublicKey)
+		}
+	}
+
+	if ok, err := keys.Delete(alice.ID, "phone"); err != nil || !ok {
+		t.Fatalf("Delete = %v, %v; want true", ok, err)
+	}
+	if ok, _ := keys.Delete(alice.ID, "phone"); ok {
+		t.Error("second Delete reported a key")
+	}
+	if own, err := keys.ListByUser(alice.ID); err != nil || len(own) != 1 || own[0].DeviceID != "laptop" {
+		t.Errorf("ListByUser = %+v, %v; want the laptop key", own, err)
+	}
+}
@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// Email token purposes
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenPasswordReset = "password_reset"
+)
+
+// ErrInvalidToken is returned for unknown, expired or already used email tokens
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+type EmailRepository struct {
+	db *database.DB
+}
+
+func NewEmailRepository(db *database.DB) *EmailRepository {
+	return &EmailRepository{db: db}
+}
+
+// CreateToken issues a single-use token for purpose, replacing any token the
+// user already holds for it, so each user has at most one per purpose. Only a
+// hash of the token is stored.
+func (r *EmailRepository) CreateToken(userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if _, err := r.db.Exec(`DELETE FROM email_tokens WHERE user_id = $1 AND purpose = $2`, userID, purpose); err != nil {
+		return "", fmt.Errorf("failed to revoke old tokens: %w", err)
+	}
+
+	query := `INSERT INTO email_tokens (token_hash, user_id, purpose, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := r.db.Exec(query, hashToken(token), userID, purpose, time.Now().Add(ttl)); err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+	return token, nil
+}
+
+// ConsumeToken marks a valid token as used and returns its user
+func (r *EmailRepository) ConsumeToken(token, purpose string) (uuid.UUID, error) {
+	query := `
+		UPDATE email_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	var userID uuid.UUID
+	err := r.db.QueryRow(query, hashToken(token), purpose).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, ErrInvalidToken
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to consume token: %w", err)
+	}
+	return userID, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetPreferences returns the user's email preferences, creating the defaults
+// on first access
+func (r *EmailRepository) GetPreferences(userID uuid.UUID) (*models.EmailPreferences, error) {
+	if err := r.ensurePreferences([]uuid.UUID{userID}); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT user_id, mention_digest, channel_live, updated_at FROM email_preferences WHERE user_id = $1`
+
+	p := &models.EmailPreferences{}
+	err := r.db.QueryRow(query, userID).Scan(&p.UserID, &p.MentionDigest, &p.ChannelLive, &p.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email preferences: %w", err)
+	}
+	return p, nil
+}
+
+// UpdatePreferences changes the fields set in req and returns the result
+func (r *EmailRepository) UpdatePreferences(userID uuid.UUID, req models.UpdateEmailPreferencesRequest) (*models.EmailPreferences, error) {
+	if err := r.ensurePreferences([]uuid.UUID{userID}); err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE email_preferences
+		SET mention_digest = COALESCE($1, mention_digest), channel_live = COALESCE($2, channel_live), updated_at = NOW()
+		WHERE user_id = $3
+		RETURNING user_id, mention_digest, channel_live, updated_at
+	`
+
+	p := &models.EmailPreferences{}
+	err := r.db.QueryRow(query, req.MentionDigest, req.ChannelLive, userID).Scan(&p.UserID, &p.MentionDigest, &p.ChannelLive, &p.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update email preferences: %w", err)
+	}
+	return p, nil
+}
+
+// Unsubscribe turns off one list (or all of them) for the owner of an
+// unsubscribe token, as used by links in notification emails
+func (r *EmailRepository) Unsubscribe(token uuid.UUID, list string) error {
+	query := `
+		UPDATE email_preferences
+		SET mention_digest = mention_digest AND NOT ($2 IN ('mentions', 'all')),
+			channel_live = channel_live AND NOT ($2 IN ('live', 'all')),
+			updated_at = NOW()
+		WHERE unsubscribe_token = $1
+	`
+
+	result, err := r.db.Exec(query, token, list)
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// ensurePreferences inserts default preference rows for users that have none
+func (r *EmailRepository) ensurePreferences(userIDs []uuid.UUID) error {
+	query := `INSERT INTO email_preferences (user_id) SELECT unnest($1::uuid[]) ON CONFLICT (user_id) DO NOTHING`
+	if _, err := r.db.Exec(query, userIDs); err != nil {
+		return fmt.Errorf("failed to create email preferences: %w", err)
+	}
+	return nil
+}
+
+// withUnsubscribeTokens fills in each recipient's unsubscribe token
+func (r *EmailRepository) withUnsubscribeTokens(recipients []models.EmailRecipient) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(recipients))
+	for i, rc := range recipients {
+		ids[i] = rc.UserID
+	}
+	if err := r.ensurePreferences(ids); err != nil {
+		return err
+	}
+
+	rows, err := r.db.Query(`SELECT user_id, unsubscribe_token FROM email_preferences WHERE user_id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get unsubscribe tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make(map[uuid.UUID]uuid.UUID, len(ids))
+	for rows.Next() {
+		var userID, token uuid.UUID
+		if err := rows.Scan(&userID, &token); err != nil {
+			return fmt.Errorf("failed to scan unsubscribe token: %w", err)
+		}
+		tokens[userID] = token
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get unsubscribe tokens: %w", err)
+	}
+
+	for i := range recipients {
+		recipients[i].UnsubscribeToken = tokens[recipients[i].UserID]
+	}
+	return nil
+}
+
+// ListLiveRecipients returns the channel's followers who want "went live"
+// emails, with their do not disturb state. Only verified addresses are emailed.
+func (r *EmailRepository) ListLiveRecipients(channelID uuid.UUID) ([]models.EmailRecipient, error) {
+	query := `
+		SELECT u.id, u.email, u.display_name, COALESCE(u.dnd_until > NOW(), false)
+		FROM channel_follows f
+		INNER JOIN users u ON u.id = f.user_id
+		LEFT JOIN email_preferences p ON p.user_id = u.id
+		WHERE f.channel_id = $1
+		AND u.deleted_at IS NULL AND u.email_verified_at IS NOT NULL
+		AND COALESCE(p.channel_live, true)
+	`
+
+	rows, err := r.db.Query(query, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list live recipients: %w", err)
+	}
+	defer rows.Close()
+
+	recipients := []models.EmailRecipient{}
+	for rows.Next() {
+		var rc models.EmailRecipient
+		if err := rows.Scan(&rc.UserID, &rc.Email, &rc.DisplayName, &rc.DoNotDisturb); err != nil {
+			return nil, fmt.Errorf("failed to scan recipient: %w", err)
+		}
+		recipients = append(recipients, rc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list live recipients: %w", err)
+	}
+
+	if err := r.withUnsubscribeTokens(recipients); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// mentions is the SQL condition for message m mentioning user u: "@username"
+// as a whole word, or "@<display name>" anywhere for users who haven't
+// chosen a username yet. Usernames hold no regex metacharacters.
+const mentions = `(CASE WHEN u.username IS NOT NULL
+		THEN m.body ~* ('(^|[^a-z0-9_])@' || u.username || '($|[^a-z0-9_])')
+		ELSE position(lower('@' || u.display_name) IN lower(m.body)) > 0 END)`
+
+// PendingMentions returns, per user who wants mention digests, the unread
+// messages mentioning them (see mentions) since the user's last digest (but
+// never older than since), with the user's do not disturb and conversation
+// mute state. A message is read if it has a receipt or is at or before the
+// user's read pointer. At most perUser mentions are returned per user, oldest
+// first.
+func (r *EmailRepository) PendingMentions(since time.Time, perUser int) ([]models.MentionDigest, error) {
+	query := `
+		SELECT u.id, u.email, u.display_name, COALESCE(u.dnd_until > NOW(), false),
+			m.id, m.conversation_id, COALESCE(c.name, ''), s.display_name, m.body, m.created_at,
+			cm.notifications_muted AND (cm.notifications_muted_until IS NULL OR cm.notifications_muted_until > NOW())
+		FROM users u
+		LEFT JOIN email_preferences p ON p.user_id = u.id
+		INNER JOIN conversation_members cm ON cm.user_id = u.id
+		INNER JOIN conversations c ON c.id = cm.conversation_id AND c.deleted_at IS NULL
+		INNER JOIN messages m ON m.conversation_id = cm.conversation_id
+		INNER JOIN users s ON s.id = m.sender_id
+		LEFT JOIN messages lr ON lr.id = cm.last_read_message_id
+		WHERE u.deleted_at IS NULL AND u.email_verified_at IS NOT NULL
+		AND COALESCE(p.mention_digest, true)
+		AND m.created_at > GREATEST(COALESCE(p.last_digest_at, $1), $1)
+		AND m.deleted_at IS NULL AND m.sender_id <> u.id
+		AND ` + mentions + `
+		AND NOT EXISTS (SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND mr.user_id = u.id)
+		AND (lr.id IS NULL OR (m.created_at, m.id) > (lr.created_at, lr.id))
+		ORDER BY u.id, m.created_at
+	`
+
+	rows, err := r.db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending mentions: %w", err)
+	}
+	defer rows.Close()
+
+	digests := []models.MentionDigest{}
+	for rows.Next() {
+		var rc models.EmailRecipient
+		var m models.Mention
+		if err := rows.Scan(&rc.UserID, &rc.Email, &rc.DisplayName, &rc.DoNotDisturb, &m.MessageID, &m.ConversationID, &m.ConversationName, &m.SenderName, &m.Body, &m.CreatedAt, &m.ConversationMuted); err != nil {
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		if n := len(digests); n == 0 || digests[n-1].Recipient.UserID != rc.UserID {
+			digests = append(digests, models.MentionDigest{Recipient: rc})
+		}
+		d := &digests[len(digests)-1]
+		if len(d.Mentions) < perUser {
+			d.Mentions = append(d.Mentions, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending mentions: %w", err)
+	}
+
+	recipients := make([]models.EmailRecipient, len(digests))
+	for i, d := range digests {
+		recipients[i] = d.Recipient
+	}
+	if err := r.withUnsubscribeTokens(recipients); err != nil {
+		return nil, err
+	}
+	for i := range digests {
+		digests[i].Recipient = recipients[i]
+	}
+	return digests, nil
+}
+
+// MarkDigestSent records that the user's mentions up to upTo have been emailed
+func (r *EmailRepository) MarkDigestSent(userID uuid.UUID, upTo time.Time) error {
+	query := `
+		INSERT INTO email_preferences (user_id, last_digest_at) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET last_digest_at = EXCLUDED.last_digest_at
+	`
+	if _, err := r.db.Exec(query, userID, upTo); err != nil {
+		return fmt.Errorf("failed to mark digest sent: %w", err)
+	}
+	return nil
+}
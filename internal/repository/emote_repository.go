@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrTooManyEmotes is returned by Upsert when adding an emote would exceed
+// the per-channel limit
+var ErrTooManyEmotes = errors.New("too many emotes")
+
+// EmoteRepository stores the channels' custom emotes
+type EmoteRepository struct {
+	db *database.DB
+}
+
+func NewEmoteRepository(db *database.DB) *EmoteRepository {
+	return &EmoteRepository{db: db}
+}
+
+// Upsert adds an emote or replaces the images of an existing one; without
+// Images, ImageURL is its only image. A channel may have at most maxEmotes;
+// replacing never counts against it.
+func (r *EmoteRepository) Upsert(e *models.Emote, maxEmotes int) error {
+	if e.Images == nil {
+		e.Images = models.ImageVariants{models.ImageScale1x: e.ImageURL}
+	}
+	e.ImageURL = e.Images[models.ImageScale1x]
+	query := `
+		INSERT INTO channel_emotes (channel_id, name, image_url, images)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM channel_emotes WHERE channel_id = $1 AND name = $2)
+		   OR (SELECT COUNT(*) FROM channel_emotes WHERE channel_id = $1) < $5
+		ON CONFLICT (channel_id, name) DO UPDATE
+		SET image_url = EXCLUDED.image_url, images = EXCLUDED.images, updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+	err := r.db.QueryRow(query, e.ChannelID, e.Name, e.ImageURL, e.Images, maxEmotes).Scan(&e.CreatedAt, &e.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrTooManyEmotes
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save emote: %w", err)
+	}
+	return nil
+}
+
+// ListByChannel returns a channel's emotes by name
+func (r *EmoteRepository) ListByChannel(channelID uuid.UUID) ([]models.Emote, error) {
+	query := `
+		SELECT channel_id, name, image_url, images, created_at, updated_at
+		FROM channel_emotes
+		WHERE channel_id = $1
+		ORDER BY name
+	`
+	rows, err := r.db.Query(query, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emotes: %w", err)
+	}
+	defer rows.Close()
+
+	emotes := []models.Emote{}
+	for rows.Next() {
+		var e models.Emote
+		if err := rows.Scan(&e.ChannelID, &e.Name, &e.ImageURL, &e.Images, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan emote: %w", err)
+		}
+		emotes = append(emotes, e)
+	}
+	return emotes, rows.Err()
+}
+
+// Delete removes an emote and reports whether it existed. Messages already
+// sent keep their tokens.
+func (r *EmoteRepository) Delete(channelID uuid.UUID, name string) (bool, error) {
+	tag, err := r.db.Exec(`DELETE FROM channel_emotes WHERE channel_id = $1 AND name = $2`, channelID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete emote: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestEmotes(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	emotes := NewEmoteRepository(db)
+	messages := NewMessageRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "emotes@example.com", DisplayName: "emotes", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(owner); err != nil {
+		t.Fatal(err)
+	}
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "emotes", Title: "Emotes", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(name string) error {
+		return emotes.Upsert(&models.Emote{ChannelID: ch.ID, Name: name, ImageURL: "https://cdn.example.com/" + name + ".png"}, 1)
+	}
+	if err := put("pog"); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("pog"); err != nil {
+		t.Errorf("replacing an emote at the limit = %v", err)
+	}
+	if err := put("kappa"); !errors.Is(err, ErrTooManyEmotes) {
+		t.Errorf("adding an emote over the limit = %v, want ErrTooManyEmotes", err)
+	}
+	if list, err := emotes.ListByChannel(ch.ID); err != nil || len(list) != 1 || list[0].Images[models.ImageScale1x] != list[0].ImageURL {
+		t.Errorf("ListByChannel = %+v, %v; want pog with its URL as the 1x image", list, err)
+	}
+	images := models.ImageVariants{models.ImageScale1x: "https://api.example.com/assets/1", models.ImageScale2x: "https://api.example.com/assets/2"}
+	if err := emotes.Upsert(&models.Emote{ChannelID: ch.ID, Name: "pog", Images: images}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &models.Message{ID: uuid.New(), ConversationID: convID, SenderID: owner.ID, Body: "gg :pog:", CreatedAt: now, UpdatedAt: now}
+	if err := messages.Create(m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tokens) != 2 || m.Tokens[1].Type != models.TokenEmote || m.Tokens[1].ImageURL != images[models.ImageScale1x] || !maps.Equal(m.Tokens[1].Images, images) {
+		t.Fatalf("tokens = %+v, want text and emote with its images", m.Tokens)
+	}
+	got, err := messages.GetByID(m.ID)
+	if err != nil || len(got.Tokens) != 2 {
+		t.Fatalf("GetByID = %+v, %v; want the stored tokens", got, err)
+	}
+
+	if deleted, err := emotes.Delete(ch.ID, "pog"); err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v", deleted, err)
+	}
+	if list, err := emotes.ListByChannel(ch.ID); err != nil || len(list) != 0 {
+		t.Errorf("ListByChannel after delete = %+v, %v", list, err)
+	}
+}
+
+func TestChatLimits(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	emotes := NewEmoteRepository(db)
+	messages := NewMessageRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "limits@example.com", DisplayName: "limits", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(owner); err != nil {
+		t.Fatal(err)
+	}
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "limits", Title: "Limits", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	if err := emotes.Upsert(&models.Emote{ChannelID: ch.ID, Name: "pog", ImageURL: "https://cdn.example.com/pog.png"}, 10); err != nil {
+		t.Fatal(err)
+	}
+	maxLength, maxEmotes := 12, 2
+	if err := channels.SetChatLimits(ch.ID, &maxLength, &maxEmotes); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := channels.GetBySlug(ch.Slug); err != nil || *got.ChatMaxLength != 12 || *got.ChatMaxEmotes != 2 {
+		t.Fatalf("GetBySlug = %+v, %v; want the limits", got, err)
+	}
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(body string) error {
+		return messages.Create(&models.Message{ID: uuid.New(), ConversationID: convID, SenderID: owner.ID, Body: body, CreatedAt: now, UpdatedAt: now})
+	}
+	var limit *ChatLimitError
+	if err := send("much too long for it"); !errors.Is(err, ErrMessageTooLong) || !errors.As(err, &limit) || limit.Max != 12 {
+		t.Errorf("long message = %v, want ErrMessageTooLong at 12", err)
+	}
+	if err := send(":pog::pog::pog:"); !errors.Is(err, ErrTooManyChatEmotes) {
+		t.Errorf("three emotes = %v, want ErrTooManyChatEmotes", err)
+	}
+	// Shortcodes of unknown emotes are text and don't count
+	if err := send(":pog::x1:"); err != nil {
+		t.Errorf("one emote = %v", err)
+	}
+
+	// Zero lifts a limit; nil keeps it
+	zero := 0
+	if err := channels.SetChatLimits(ch.ID, &zero, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := send("no longer too long for it"); err != nil {
+		t.Errorf("long message without a length limit = %v", err)
+	}
+	if err := send(":pog::pog::pog:"); !errors.Is(err, ErrTooManyChatEmotes) {
+		t.Errorf("three emotes after lifting the length limit = %v, want ErrTooManyChatEmotes", err)
+	}
+}
+
+func TestChatLimitErrorReason(t *testing.T) {
+	tests := []struct {
+		err      *ChatLimitError
+		wantCode apierror.Code
+		wantMsg  string
+	}{
+		{&ChatLimitError{Err: ErrMessageTooLong, Max: 12}, apierror.MessageTooLong, "Messages in this chat can have at most 12 characters"},
+		{&ChatLimitError{Err: ErrTooManyChatEmotes, Max: 2}, apierror.TooManyEmotes, "Messages in this chat can have at most 2 emotes"},
+	}
+	for _, tt := range tests {
+		if code, msg := tt.err.Reason(); code != tt.wantCode || msg != tt.wantMsg {
+			t.Errorf("Reason(%v) = %s, %q; want %s, %q", tt.err, code, msg, tt.wantCode, tt.wantMsg)
+		}
+	}
+}
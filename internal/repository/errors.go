@@ -0,0 +1,7 @@
+package repository
+
+import "errors"
+
+// ErrVersionConflict is returned by optimistic-locking updates when the row was
+// modified since the caller read it.
+var ErrVersionConflict = errors.New("version conflict")
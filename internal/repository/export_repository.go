@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrExportInProgress is returned when the user already has an export that
+// has not finished
+var ErrExportInProgress = errors.New("export already in progress")
+
+// ErrExportNotFound is returned for unknown exports and those of other users
+var ErrExportNotFound = errors.New("export not found")
+
+// exportStaleAfter is how long a running export may go without finishing
+// before another worker picks it up again (e.g. after a crash)
+const exportStaleAfter = 30 * time.Minute
+
+type ExportRepository struct {
+	db *database.DB
+}
+
+func NewExportRepository(db *database.DB) *ExportRepository {
+	return &ExportRepository{db: db}
+}
+
+const exportColumns = `id, user_id, status, size_bytes, error, created_at, completed_at, expires_at`
+
+func scanExport(row pgx.Row) (*models.DataExport, error) {
+	e := &models.DataExport{}
+	err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.SizeBytes, &e.Error, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	return e, err
+}
+
+// Create queues a new export for the user unless one is already pending or
+// running
+func (r *ExportRepository) Create(userID uuid.UUID) (*models.DataExport, error) {
+	query := `
+		INSERT INTO data_exports (user_id)
+		SELECT $1
+		WHERE NOT EXISTS (
+			SELECT 1 FROM data_exports WHERE user_id = $1 AND status IN ('pending', 'running')
+		)
+		RETURNING ` + exportColumns
+
+	e, err := scanExport(r.db.QueryRow(query, userID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrExportInProgress
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+	return e, nil
+}
+
+// GetForUser returns one of the user's exports
+func (r *ExportRepository) GetForUser(id, userID uuid.UUID) (*models.DataExport, error) {
+	query := `SELECT ` + exportColumns + ` FROM data_exports WHERE id = $1 AND user_id = $2`
+	e, err := scanExport(r.db.QueryRow(query, id, userID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export: %w", err)
+	}
+	return e, nil
+}
+
+// ClaimNext marks the oldest pending export (or one stuck running) as running
+// and returns it, or nil when there is nothing to do. SKIP LOCKED lets
+// several workers claim exports concurrently.
+func (r *ExportRepository) ClaimNext() (*models.DataExport, error) {
+	query := `
+		UPDATE data_exports SET status = 'running', started_at = NOW()
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' OR (status = 'running' AND started_at < $1)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportColumns
+
+	e, err := scanExport(r.db.QueryRow(query, time.Now().Add(-exportStaleAfter)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim export: %w", err)
+	}
+	return e, nil
+}
+
+// Complete stores the finished archive, downloadable until expiresAt
+func (r *ExportRepository) Complete(id uuid.UUID, archive []byte, expiresAt time.Time) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'ready', archive = $2, size_bytes = $3, completed_at = NOW(), expires_at = $4
+		WHERE id = $1
+	`
+	if _, err := r.db.Exec(query, id, archive, len(archive), expiresAt); err != nil {
+		return fmt.Errorf("failed to complete export: %w", err)
+	}
+	return nil
+}
+
+// Fail records why an export could not be assembled
+func (r *ExportRepository) Fail(id uuid.UUID, reason string) error {
+	query := `UPDATE data_exports SET status = 'failed', error = $2, completed_at = NOW() WHERE id = $1`
+	if _, err := r.db.Exec(query, id, reason); err != nil {
+		return fmt.Errorf("failed to mark export failed: %w", err)
+	}
+	return nil
+}
+
+// GetArchive returns a ready, unexpired export's archive
+func (r *ExportRepository) GetArchive(id uuid.UUID) ([]byte, error) {
+	query := `SELECT archive FROM data_exports WHERE id = $1 AND status = 'ready' AND expires_at > NOW()`
+	var archive []byte
+	err := r.db.QueryRow(query, id).Scan(&archive)
+	if err == pgx.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export archive: %w", err)
+	}
+	return archive, nil
+}
+
+// DeleteExpired removes exports whose download window has passed, and failed
+// exports older than that window
+func (r *ExportRepository) DeleteExpired(now time.Time, failedAfter time.Duration) (int64, error) {
+	query := `
+		DELETE FROM data_exports
+		WHERE (status = 'ready' AND expires_at < $1)
+		   OR (status = 'failed' AND completed_at < $2)
+	`
+	result, err := r.db.Exec(query, now, now.Add(-failedAfter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired exports: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// exportSections are the files of a data export and the queries that fill
+// them. Each query selects rows for the user $1 as a JSON array.
+var exportSections = []struct {
+	name  string
+	query string
+}{
+	{"profile", `
+		SELECT id, email, display_name, username, avatar_url, email_verified_at, dm_policy, created_at, updated_at
+		FROM users WHERE id = $1`},
+	{"email_preferences", `
+		SELECT mention_digest, channel_live, last_digest_at, updated_at
+		FROM email_preferences WHERE user_id = $1`},
+	{"messages", `
+		SELECT id, conversation_id, body, kind, created_at, updated_at, deleted_at
+		FROM (
+			SELECT id, conversation_id, body, kind, created_at, updated_at, deleted_at FROM messages WHERE sender_id = $1
+			UNION ALL
+			SELECT id, conversation_id, body, kind, created_at, updated_at, deleted_at FROM messages_archive WHERE sender_id = $1
+		) m
+		ORDER BY created_at`},
+	{"memberships", `
+		SELECT cm.conversation_id, c.name AS conversation_name, c.is_group, cm.role, cm.joined_at, cm.draft
+		FROM conversation_members cm
+		JOIN conversations c ON c.id = cm.conversation_id
+		WHERE cm.user_id = $1
+		ORDER BY cm.joined_at`},
+	{"channels", `
+		SELECT id, slug, title, description, language, tags, created_at, updated_at, deleted_at
+		FROM channels WHERE owner_id = $1
+		ORDER BY created_at`},
+	{"emotes", `
+		SELECT ch.slug AS channel_slug, e.name, e.image_url, e.images, e.created_at, e.updated_at
+		FROM channel_emotes e
+		JOIN channels ch ON ch.id = e.channel_id
+		WHERE ch.owner_id = $1
+		ORDER BY ch.slug, e.name`},
+	{"follows", `
+		SELECT ch.slug AS channel_slug, ch.title AS channel_title, f.created_at
+		FROM channel_follows f
+		JOIN channels ch ON ch.id = f.channel_id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at`},
+	{"content_preferences", `
+		SELECT show_mature, hidden_tags, updated_at
+		FROM content_preferences WHERE user_id = $1`},
+	{"watch_history", `
+		SELECT ch.slug AS channel_slug, w.stream_id, w.position_seconds, w.watched_seconds, w.first_watched_at, w.last_watched_at
+		FROM watch_history w
+		JOIN streams s ON s.id = w.stream_id
+		JOIN channels ch ON ch.id = s.channel_id
+		WHERE w.user_id = $1
+		ORDER BY w.first_watched_at`},
+	{"channel_points", `
+		SELECT ch.slug AS channel_slug, p.balance, p.last_seen_at
+		FROM channel_points p
+		JOIN channels ch ON ch.id = p.channel_id
+		WHERE p.user_id = $1
+		ORDER BY ch.slug`},
+	{"device_keys", `
+		SELECT device_id, algorithm, public_key, created_at, updated_at
+		FROM device_keys WHERE user_id = $1
+		ORDER BY created_at`},
+	{"analytics_events", `
+		SELECT e.type, ch.slug AS channel_slug, e.stream_id, e.properties, e.occurred_at
+		FROM analytics_events e
+		JOIN channels ch ON ch.id = e.channel_id
+		WHERE e.user_id = $1
+		ORDER BY e.occurred_at`},
+	{"moderation", `
+		SELECT conversation_id, action, reason, expires_at, created_at
+		FROM conversation_moderations WHERE user_id = $1
+		ORDER BY created_at`},
+	{"bot_scores", `
+		SELECT ch.slug AS channel_slug, s.score, s.entropy, s.regularity, s.duplicates, s.messages, s.updated_at
+		FROM bot_scores s
+		JOIN channels ch ON ch.conversation_id = s.conversation_id
+		WHERE s.user_id = $1
+		ORDER BY ch.slug`},
+	{"attachments", `
+		SELECT id, conversation_id, message_id, content_type, size_bytes, created_at
+		FROM attachments WHERE uploader_id = $1
+		ORDER BY created_at`},
+	{"moderation_log", `
+		SELECT conversation_id, message_id, action, reason, created_at,
+			CASE WHEN target_user_id = $1 THEN 'target' ELSE 'moderator' END AS role
+		FROM moderation_logs
+		WHERE target_user_id = $1 OR moderator_id = $1
+		ORDER BY created_at`},
+}
+
+// CollectUserData gathers everything stored about a user for a data export,
+// keyed by section name. Each section is a JSON array.
+func (r *ExportRepository) CollectUserData(userID uuid.UUID) (map[string]json.RawMessage, error) {
+	data := make(map[string]json.RawMessage, len(exportSections))
+	for _, s := range exportSections {
+		var raw []byte
+		query := `SELECT COALESCE(json_agg(t), '[]'::json) FROM (` + s.query + `) t`
+		if err := r.db.QueryRow(query, userID).Scan(&raw); err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", s.name, err)
+		}
+		data[s.name] = raw
+	}
+	return data, nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestMain(m *testing.M) { dbtest.Main(m) }
+
+func TestExportLifecycle(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	exports := NewExportRepository(db)
+
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), Email: "export@example.com", DisplayName: "Exporter", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := exports.Create(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != models.ExportPending {
+		t.Errorf("status = %q", e.Status)
+	}
+	if _, err := exports.Create(user.ID); !errors.Is(err, ErrExportInProgress) {
+		t.Errorf("second Create err = %v, want ErrExportInProgress", err)
+	}
+
+	claimed, err := exports.ClaimNext()
+	if err != nil || claimed == nil || claimed.ID != e.ID || claimed.Status != models.ExportRunning {
+		t.Fatalf("ClaimNext = %+v, %v", claimed, err)
+	}
+	if next, err := exports.ClaimNext(); err != nil || next != nil {
+		t.Errorf("ClaimNext with nothing pending = %+v, %v", next, err)
+	}
+
+	data, err := exports.CollectUserData(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile []map[string]any
+	if err := json.Unmarshal(data["profile"], &profile); err != nil || len(profile) != 1 || profile[0]["email"] != user.Email {
+		t.Errorf("profile = %s (%v)", data["profile"], err)
+	}
+	if _, ok := profile[0]["password_hash"]; ok {
+		t.Error("profile must not include the password hash")
+	}
+	if string(data["messages"]) != "[]" {
+		t.Errorf("messages = %s", data["messages"])
+	}
+
+	if err := exports.Complete(e.ID, []byte("zip"), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if archive, err := exports.GetArchive(e.ID); err != nil || string(archive) != "zip" {
+		t.Errorf("GetArchive = %q, %v", archive, err)
+	}
+	if _, err := exports.GetForUser(e.ID, uuid.New()); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("GetForUser for another user err = %v", err)
+	}
+
+	if n, err := exports.DeleteExpired(now.Add(2*time.Hour), time.Hour); err != nil || n != 1 {
+		t.Errorf("DeleteExpired = %d, %v", n, err)
+	}
+}
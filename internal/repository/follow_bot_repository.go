@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// FollowBotRepository removes follow-bot bursts from channel_follows and
+// keeps the reports of what was removed
+type FollowBotRepository struct {
+	db *database.DB
+}
+
+func NewFollowBotRepository(db *database.DB) *FollowBotRepository {
+	return &FollowBotRepository{db: db}
+}
+
+// RemoveBursts deletes the follows by new accounts made since since from
+// every (channel, network) pair with at least threshold of them, and files
+// one report per pair, in a single statement
+func (r *FollowBotRepository) RemoveBursts(since time.Time, threshold int) ([]models.FollowBotReport, error) {
+	query := `
+		WITH bursts AS (
+			SELECT channel_id, network
+			FROM channel_follows
+			WHERE new_account AND network IS NOT NULL AND created_at >= $1
+			GROUP BY channel_id, network
+			HAVING COUNT(*) >= $2
+		), removed AS (
+			DELETE FROM channel_follows cf
+			USING bursts b
+			WHERE cf.channel_id = b.channel_id AND cf.network = b.network
+			AND cf.new_account AND cf.created_at >= $1
+			RETURNING cf.channel_id, cf.network, cf.ip, cf.user_id
+		), reports AS (
+			INSERT INTO follow_bot_reports (channel_id, network, ips, user_ids, removed)
+			SELECT channel_id, network,
+				COALESCE(array_agg(DISTINCT ip) FILTER (WHERE ip IS NOT NULL), '{}'),
+				array_agg(user_id), COUNT(*)
+			FROM removed
+			GROUP BY channel_id, network
+			RETURNING id, channel_id, network, ips, user_ids, removed, created_at
+		)
+		SELECT rp.id, rp.channel_id, c.slug, rp.network, rp.ips, rp.user_ids, rp.removed, rp.created_at
+		FROM reports rp
+		INNER JOIN channels c ON c.id = rp.channel_id
+	`
+	rows, err := r.db.Query(query, since, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove follow bursts: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.FollowBotReport{}
+	for rows.Next() {
+		var rp models.FollowBotReport
+		if err := rows.Scan(&rp.ID, &rp.ChannelID, &rp.ChannelSlug, &rp.Network, &rp.IPs, &rp.UserIDs, &rp.Removed, &rp.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan follow bot report: %w", err)
+		}
+		reports = append(reports, rp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to remove follow bursts: %w", err)
+	}
+	return reports, nil
+}
+
+// List returns a keyset page of reports, newest first. Up to limit+1 rows
+// are returned so callers can detect a further page (see pagination.NewPage).
+func (r *FollowBotRepository) List(limit int, cursor *pagination.Cursor) ([]models.FollowBotReport, error) {
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+
+	query := `
+		SELECT rp.id, rp.channel_id, c.slug, rp.network, rp.ips, rp.user_ids, rp.removed, rp.created_at
+		FROM follow_bot_reports rp
+		INNER JOIN channels c ON c.id = rp.channel_id
+		WHERE ($1::timestamp IS NULL OR (rp.created_at, rp.id) < ($1, $2))
+		ORDER BY rp.created_at DESC, rp.id DESC
+		LIMIT $3
+	`
+	rows, err := r.db.Query(query, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list follow bot reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.FollowBotReport{}
+	for rows.Next() {
+		var rp models.FollowBotReport
+		if err := rows.Scan(&rp.ID, &rp.ChannelID, &rp.ChannelSlug, &rp.Network, &rp.IPs, &rp.UserIDs, &rp.Removed, &rp.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan follow bot report: %w", err)
+		}
+		reports = append(reports, rp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list follow bot reports: %w", err)
+	}
+	return reports, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestFollowBotRemoveBursts(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	bots := NewFollowBotRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	owner := newUser("owner")
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "botted", Title: "Botted", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three new accounts from one network, one from another, and an
+	// established account from the botted network
+	for i := 0; i < 3; i++ {
+		u := newUser(fmt.Sprintf("bot%d", i))
+		origin := models.FollowOrigin{IP: fmt.Sprintf("192.0.2.%d", i%2+1), Network: "AS64500", NewAccount: true}
+		if _, err := channels.AddFollower(ch.ID, u.ID, origin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loner := newUser("loner")
+	if _, err := channels.AddFollower(ch.ID, loner.ID, models.FollowOrigin{IP: "203.0.113.5", Network: "203.0.113.0/24", NewAccount: true}); err != nil {
+		t.Fatal(err)
+	}
+	regular := newUser("regular")
+	if _, err := channels.AddFollower(ch.ID, regular.ID, models.FollowOrigin{IP: "192.0.2.1", Network: "AS64500"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := bots.RemoveBursts(now.Add(-time.Hour), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("reports = %+v, want one", reports)
+	}
+	rp := reports[0]
+	if rp.ChannelSlug != "botted" || rp.Network != "AS64500" || rp.Removed != 3 || len(rp.UserIDs) != 3 || len(rp.IPs) != 2 {
+		t.Fatalf("report = %+v", rp)
+	}
+	if n, err := channels.CountFollowers(ch.ID); err != nil || n != 2 {
+		t.Fatalf("followers left = %d, %v; want the loner and the regular", n, err)
+	}
+
+	// Nothing is left to remove on the next sweep
+	if again, err := bots.RemoveBursts(now.Add(-time.Hour), 3); err != nil || len(again) != 0 {
+		t.Fatalf("second sweep = %+v, %v", again, err)
+	}
+
+	listed, err := bots.List(10, nil)
+	if err != nil || len(listed) != 1 || listed[0].ID != rp.ID {
+		t.Fatalf("List = %+v, %v", listed, err)
+	}
+}
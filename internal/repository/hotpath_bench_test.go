@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// The hot-path benchmarks need a real database:
+//
+//	TULLO_BENCH_DSN="postgres://postgres@localhost/tullo_bench?sslmode=disable" \
+//	    go test ./internal/repository -run '^$' -bench HotPath
+//
+// Each statement is measured "unprepared" (simple protocol, parsed on every
+// call, which is what a cold or evicted statement cache costs) and "prepared"
+// (the named statement installed on every pooled connection).
+func benchDB(b *testing.B) (*database.DB, uuid.UUID, uuid.UUID) {
+	dsn := os.Getenv("TULLO_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("TULLO_BENCH_DSN not set")
+	}
+	db, err := database.NewPostgresDB(dsn)
+	if err != nil {
+		b.Fatalf("connect: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db); err != nil {
+		b.Fatalf("migrate: %v", err)
+	}
+	if err := db.PrepareStatements(); err != nil {
+		b.Fatalf("prepare: %v", err)
+	}
+
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), Email: uuid.NewString() + "@bench.local", DisplayName: "bench", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := NewUserRepository(db).Create(user); err != nil {
+		b.Fatalf("create user: %v", err)
+	}
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	convRepo := NewConversationRepository(db)
+	_, err = convRepo.CreateWithMembers(conv, []models.ConversationMember{
+		{ID: uuid.New(), ConversationID: conv.ID, UserID: user.ID, Role: "member", JoinedAt: now},
+	})
+	if err != nil {
+		b.Fatalf("create conversation: %v", err)
+	}
+	b.Cleanup(func() {
+		db.Pool.Exec(context.Background(), `DELETE FROM conversations WHERE id = $1`, conv.ID)
+		db.Pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, user.ID)
+	})
+	return db, conv.ID, user.ID
+}
+
+func BenchmarkHotPathMembershipCheck(b *testing.B) {
+	db, convID, userID := benchDB(b)
+	ctx := context.Background()
+	sql := `
+	SELECT EXISTS(
+		SELECT 1 FROM conversation_members cm
+		INNER JOIN conversations c ON c.id = cm.conversation_id
+		WHERE cm.conversation_id = $1 AND cm.user_id = $2 AND c.deleted_at IS NULL
+	)
+`
+
+	b.Run("unprepared", func(b *testing.B) {
+		var ok bool
+		for i := 0; i < b.N; i++ {
+			if err := db.Pool.QueryRow(ctx, sql, pgx.QueryExecModeSimpleProtocol, convID, userID).Scan(&ok); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("prepared", func(b *testing.B) {
+		repo := NewConversationRepository(db)
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.IsMember(convID, userID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkHotPathModerationCheck(b *testing.B) {
+	db, convID, userID := benchDB(b)
+	ctx := context.Background()
+	sql := `
+	SELECT action, expires_at FROM conversation_moderations
+	WHERE conversation_id = $1 AND user_id = $2
+`
+
+	b.Run("unprepared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rows, err := db.Pool.Query(ctx, sql, pgx.QueryExecModeSimpleProtocol, convID, userID)
+			if err != nil {
+				b.Fatal(err)
+			}
+			rows.Close()
+		}
+	})
+	b.Run("prepared", func(b *testing.B) {
+		repo := NewConversationRepository(db)
+		for i := 0; i < b.N; i++ {
+			if _, _, err := repo.IsUserMutedOrBanned(convID, userID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkHotPathMessageInsert(b *testing.B) {
+	db, convID, userID := benchDB(b)
+	ctx := context.Background()
+	sql := `
+	INSERT INTO messages (id, conversation_id, sender_id, body, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at
+`
+
+	b.Run("unprepared", func(b *testing.B) {
+		var id uuid.UUID
+		var created, updated time.Time
+		for i := 0; i < b.N; i++ {
+			now := time.Now()
+			err := db.Pool.QueryRow(ctx, sql, pgx.QueryExecModeSimpleProtocol,
+				uuid.New(), convID, userID, "bench", now, now).Scan(&id, &created, &updated)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("prepared", func(b *testing.B) {
+		repo := NewMessageRepository(db)
+		for i := 0; i < b.N; i++ {
+			now := time.Now()
+			msg := &models.Message{ID: uuid.New(), ConversationID: convID, SenderID: userID, Body: "bench", CreatedAt: now, UpdatedAt: now}
+			if err := repo.Create(msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
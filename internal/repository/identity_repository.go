@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrIdentityNotFound is returned when no user is linked to a provider account
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// ErrIdentityConflict is returned when the user already has another account
+// of the same provider linked, or the account is linked to another user
+var ErrIdentityConflict = errors.New("identity already linked")
+
+type IdentityRepository struct {
+	db *database.DB
+}
+
+func NewIdentityRepository(db *database.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// GetUser returns the active user linked to the provider account
+func (r *IdentityRepository) GetUser(provider, subject string) (*models.User, error) {
+	query := `
+		SELECT u.id, u.email, u.display_name, u.username, u.avatar_url, u.password_hash, u.email_verified_at, u.role, u.created_at, u.updated_at
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2 AND u.deleted_at IS NULL
+	`
+
+	user := &models.User{}
+	err := r.db.QueryRow(query, provider, subject).Scan(
+		&user.ID,
+		&user.Email,
+		&user.DisplayName,
+		&user.Username,
+		&user.AvatarURL,
+		&user.PasswordHash,
+		&user.EmailVerifiedAt,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	return user, nil
+}
+
+// Link attaches the provider account to an existing user
+func (r *IdentityRepository) Link(identity *models.UserIdentity) error {
+	return r.link(r.db.QueryRow, identity)
+}
+
+// CreateUser creates user together with its first identity, so a failed link
+// leaves no account behind
+func (r *IdentityRepository) CreateUser(user *models.User, identity *models.UserIdentity) error {
+	ctx := context.Background()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (id, email, display_name, avatar_url, password_hash, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`, user.ID, user.Email, user.DisplayName, user.AvatarURL, user.PasswordHash, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	identity.UserID = user.ID
+	queryRow := func(query string, args ...any) pgx.Row { return tx.QueryRow(ctx, query, args...) }
+	if err := r.link(queryRow, identity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *IdentityRepository) link(queryRow func(string, ...any) pgx.Row, identity *models.UserIdentity) error {
+	if identity.ID == uuid.Nil {
+		identity.ID = uuid.New()
+	}
+	err := queryRow(`
+		INSERT INTO user_identities (id, user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING created_at
+	`, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrIdentityConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestIdentityLinking(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	identities := NewIdentityRepository(db)
+
+	now := time.Now()
+	existing := &models.User{ID: uuid.New(), Email: "ann@example.com", DisplayName: "Ann", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := identities.GetUser("github", "42"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Fatalf("GetUser err = %v, want ErrIdentityNotFound", err)
+	}
+	if err := identities.Link(&models.UserIdentity{UserID: existing.ID, Provider: "github", Subject: "42", Email: existing.Email}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := identities.GetUser("github", "42")
+	if err != nil || u.ID != existing.ID {
+		t.Fatalf("GetUser = %+v, %v", u, err)
+	}
+
+	// One account per provider and user, and one user per account
+	if err := identities.Link(&models.UserIdentity{UserID: existing.ID, Provider: "github", Subject: "43"}); !errors.Is(err, ErrIdentityConflict) {
+		t.Errorf("second github link err = %v, want ErrIdentityConflict", err)
+	}
+
+	verified := now
+	created := &models.User{ID: uuid.New(), Email: "bob@example.com", DisplayName: "Bob", EmailVerifiedAt: &verified, CreatedAt: now, UpdatedAt: now}
+	err = identities.CreateUser(created, &models.UserIdentity{Provider: "github", Subject: "42", Email: created.Email})
+	if !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("CreateUser with a linked account err = %v, want ErrIdentityConflict", err)
+	}
+	if _, err := users.GetByEmail(created.Email); err == nil {
+		t.Error("user was created although linking failed")
+	}
+
+	if err := identities.CreateUser(created, &models.UserIdentity{Provider: "google", Subject: "1077", Email: created.Email}); err != nil {
+		t.Fatal(err)
+	}
+	u, err = identities.GetUser("google", "1077")
+	if err != nil || u.ID != created.ID || u.EmailVerifiedAt == nil {
+		t.Errorf("GetUser = %+v, %v", u, err)
+	}
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// ErrLinkNotFound is returned for unknown short links and those of deleted
+// channels
+var ErrLinkNotFound = errors.New("link not found")
+
+const (
+	linkCodeAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	linkCodeLength   = 7
+	// linkCodeAttempts is how often Create draws a new code after a collision
+	linkCodeAttempts = 3
+)
+
+// LinkRepository stores the channels' tracked short links and counts their
+// clicks per day
+type LinkRepository struct {
+	db *database.DB
+}
+
+func NewLinkRepository(db *database.DB) *LinkRepository {
+	return &LinkRepository{db: db}
+}
+
+// newLinkCode draws a random code without look-alike characters
+func newLinkCode() (string, error) {
+	code := make([]byte, linkCodeLength)
+	size := big.NewInt(int64(len(linkCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate link code: %w", err)
+		}
+		code[i] = linkCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// Create stores link under a new random code, which it sets
+func (r *LinkRepository) Create(link *models.ChannelLink) error {
+	query := `
+		INSERT INTO channel_links (id, channel_id, code, target_url, label, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for attempt := 1; ; attempt++ {
+		code, err := newLinkCode()
+		if err != nil {
+			return err
+		}
+		_, err = r.db.Exec(query, link.ID, link.ChannelID, code, link.TargetURL, link.Label, link.CreatedAt)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && attempt < linkCodeAttempts {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create link: %w", err)
+		}
+		link.Code = code
+		return nil
+	}
+}
+
+const linkColumns = `id, channel_id, code, target_url, label, clicks, created_at, last_clicked_at`
+
+func scanLink(row pgx.Row) (*models.ChannelLink, error) {
+	l := &models.ChannelLink{}
+	err := row.Scan(&l.ID, &l.ChannelID, &l.Code, &l.TargetURL, &l.Label, &l.Clicks, &l.CreatedAt, &l.LastClickedAt)
+	return l, err
+}
+
+// ListByChannel returns a page of the channel's links, newest first
+func (r *LinkRepository) ListByChannel(channelID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.ChannelLink, error) {
+	if limit <= 0 {
+		limit = pagination.DefaultLimit
+	}
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+	query := `
+		SELECT ` + linkColumns + `
+		FROM channel_links
+		WHERE channel_id = $1 AND ($2::timestamp IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC LIMIT $4
+	`
+	rows, err := r.db.Query(query, channelID, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []models.ChannelLink{}
+	for rows.Next() {
+		l, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan link: %w", err)
+		}
+		links = append(links, *l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	return links, nil
+}
+
+// Get returns the channel's link with the given code
+func (r *LinkRepository) Get(channelID uuid.UUID, code string) (*models.ChannelLink, error) {
+	query := `SELECT ` + linkColumns + ` FROM channel_links WHERE channel_id = $1 AND code = $2`
+	l, err := scanLink(r.db.QueryRow(query, channelID, code))
+	if err == pgx.ErrNoRows {
+		return nil, ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link: %w", err)
+	}
+	return l, nil
+}
+
+// ClicksByDay returns the link's clicks on each UTC day from since through
+// today, including days without clicks
+func (r *LinkRepository) ClicksByDay(linkID uuid.UUID, since time.Time) ([]models.LinkClickDay, error) {
+	query := `
+		SELECT to_char(d.day, 'YYYY-MM-DD'), COALESCE(c.clicks, 0)
+		FROM generate_series($2::date, (NOW() AT TIME ZONE 'UTC')::date, INTERVAL '1 day') AS d(day)
+		LEFT JOIN channel_link_clicks c ON c.link_id = $1 AND c.day = d.day
+		ORDER BY d.day
+	`
+	rows, err := r.db.Query(query, linkID, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link clicks: %w", err)
+	}
+	defer rows.Close()
+
+	days := []models.LinkClickDay{}
+	for rows.Next() {
+		var d models.LinkClickDay
+		if err := rows.Scan(&d.Day, &d.Clicks); err != nil {
+			return nil, fmt.Errorf("failed to scan link clicks: %w", err)
+		}
+		days = append(days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get link clicks: %w", err)
+	}
+	return days, nil
+}
+
+// Delete removes the channel's link with the given code and its clicks
+func (r *LinkRepository) Delete(channelID uuid.UUID, code string) error {
+	tag, err := r.db.Exec(`DELETE FROM channel_links WHERE channel_id = $1 AND code = $2`, channelID, code)
+	if err != nil {
+		return fmt.Errorf("failed to delete link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLinkNotFound
+	}
+	return nil
+}
+
+// Resolve returns where the link with the given code leads, like Click,
+// without counting a click
+func (r *LinkRepository) Resolve(code string) (targetURL *string, slug string, err error) {
+	query := `
+		SELECT l.target_url, ch.slug
+		FROM channel_links l
+		JOIN channels ch ON ch.id = l.channel_id AND ch.deleted_at IS NULL
+		WHERE l.code = $1
+	`
+	err = r.db.QueryRow(query, code).Scan(&targetURL, &slug)
+	if err == pgx.ErrNoRows {
+		return nil, "", ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve link: %w", err)
+	}
+	return targetURL, slug, nil
+}
+
+// Click counts a click on the link with the given code and returns where it
+// leads: its target URL, or nil for the page of the returned channel slug
+func (r *LinkRepository) Click(code string) (targetURL *string, slug string, err error) {
+	query := `
+		WITH link AS (
+			UPDATE channel_links l SET clicks = l.clicks + 1, last_clicked_at = NOW()
+			FROM channels ch
+			WHERE l.code = $1 AND ch.id = l.channel_id AND ch.deleted_at IS NULL
+			RETURNING l.id, l.target_url, ch.slug
+		), counted AS (
+			INSERT INTO channel_link_clicks (link_id, day, clicks)
+			SELECT id, (NOW() AT TIME ZONE 'UTC')::date, 1 FROM link
+			ON CONFLICT (link_id, day) DO UPDATE SET clicks = channel_link_clicks.clicks + 1
+		)
+		SELECT target_url, slug FROM link
+	`
+	err = r.db.QueryRow(query, code).Scan(&targetURL, &slug)
+	if err == pgx.ErrNoRows {
+		return nil, "", ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to follow link: %w", err)
+	}
+	return targetURL, slug, nil
+}
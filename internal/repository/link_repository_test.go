@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestChannelLinks(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	links := NewLinkRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "promoter@example.com", DisplayName: "Promoter", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(owner); err != nil {
+		t.Fatal(err)
+	}
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "promos", Title: "Promos", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	target := "https://shop.example.com/merch"
+	merch := &models.ChannelLink{ID: uuid.New(), ChannelID: ch.ID, TargetURL: &target, CreatedAt: now}
+	home := &models.ChannelLink{ID: uuid.New(), ChannelID: ch.ID, CreatedAt: now.Add(time.Second)}
+	for _, l := range []*models.ChannelLink{merch, home} {
+		if err := links.Create(l); err != nil {
+			t.Fatal(err)
+		}
+		if len(l.Code) != linkCodeLength {
+			t.Fatalf("code = %q", l.Code)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		got, slug, err := links.Click(merch.Code)
+		if err != nil || got == nil || *got != target || slug != ch.Slug {
+			t.Fatalf("Click = %v, %q, %v", got, slug, err)
+		}
+	}
+	if got, slug, err := links.Click(home.Code); err != nil || got != nil || slug != ch.Slug {
+		t.Fatalf("Click channel link = %v, %q, %v", got, slug, err)
+	}
+	if _, _, err := links.Click("nope"); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("Click unknown err = %v, want ErrLinkNotFound", err)
+	}
+
+	if got, _, err := links.Resolve(merch.Code); err != nil || got == nil || *got != target {
+		t.Fatalf("Resolve = %v, %v", got, err)
+	}
+	l, err := links.Get(ch.ID, merch.Code)
+	if err != nil || l.Clicks != 2 || l.LastClickedAt == nil {
+		t.Fatalf("Get = %+v, %v", l, err)
+	}
+	days, err := links.ClicksByDay(merch.ID, time.Now().UTC().AddDate(0, 0, -6))
+	if err != nil || len(days) != 7 || days[6].Clicks != 2 || days[0].Clicks != 0 {
+		t.Fatalf("ClicksByDay = %+v, %v", days, err)
+	}
+
+	page, err := links.ListByChannel(ch.ID, 10, nil)
+	if err != nil || len(page) != 2 || page[0].ID != home.ID {
+		t.Fatalf("ListByChannel = %+v, %v", page, err)
+	}
+
+	if err := links.Delete(ch.ID, merch.Code); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := links.Click(merch.Code); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("Click deleted err = %v, want ErrLinkNotFound", err)
+	}
+}
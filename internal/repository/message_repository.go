@@ -1,15 +1,53 @@
 package repository
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/apierror"
 	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/emote"
+	"github.com/tullo/backend/internal/markdown"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
 )
 
+// ErrMessageNotFound is returned when deleting a missing or already deleted
+// message
+var ErrMessageNotFound = errors.New("message not found")
+
+// Errors wrapped by ChatLimitError
+var (
+	ErrMessageTooLong    = errors.New("message too long for this chat")
+	ErrTooManyChatEmotes = errors.New("too many emotes in the message for this chat")
+)
+
+// ChatLimitError is returned by Create for a message over its chat's
+// limits: Err is ErrMessageTooLong or ErrTooManyChatEmotes, Max the limit
+type ChatLimitError struct {
+	Err error
+	Max int
+}
+
+func (e *ChatLimitError) Error() string {
+	return fmt.Sprintf("%v (at most %d)", e.Err, e.Max)
+}
+
+func (e *ChatLimitError) Unwrap() error { return e.Err }
+
+// Reason returns the error code and message that tell the sender what the
+// limit is, the same over REST and WebSocket
+func (e *ChatLimitError) Reason() (apierror.Code, string) {
+	if errors.Is(e.Err, ErrTooManyChatEmotes) {
+		return apierror.TooManyEmotes, fmt.Sprintf("Messages in this chat can have at most %d emotes", e.Max)
+	}
+	return apierror.MessageTooLong, fmt.Sprintf("Messages in this chat can have at most %d characters", e.Max)
+}
+
 type MessageRepository struct {
 	db *database.DB
 }
@@ -18,23 +56,79 @@ func NewMessageRepository(db *database.DB) *MessageRepository {
 	return &MessageRepository{db: db}
 }
 
-// Create creates a new message
+var stmtMessageInsert = database.Prepare("message_insert", `
+	INSERT INTO messages (id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, CASE WHEN (SELECT formatting FROM conversations WHERE id = $2) THEN $6 END, $7, $8, $9)
+	RETURNING id, html, created_at, updated_at, (
+		SELECT json_build_object('role', b.role, 'images', b.images)
+		FROM channels c
+		LEFT JOIN conversation_members cm ON cm.conversation_id = c.conversation_id AND cm.user_id = $3
+		INNER JOIN channel_badges b ON b.channel_id = c.id AND b.role = `+badgeRole("$3")+`
+		WHERE c.conversation_id = $2
+	)
+`)
+
+// badgeRole is the role whose badge the chatter user (a SQL expression)
+// wears in the chat of channel c, given their conversation_members row cm:
+// owners and moderators wear their own, admins of the chat the moderator
+// badge, everyone else none
+func badgeRole(user string) string {
+	return `CASE WHEN c.owner_id = ` + user + ` THEN 'owner' WHEN cm.role IN ('admin', 'moderator') THEN 'moderator' ELSE cm.role END`
+}
+
+var stmtChatLimits = database.Prepare("chat_limits", `
+	SELECT max_message_length, max_emotes FROM conversations WHERE id = $1
+`)
+
+// Create creates a new message; without a kind it is a text message. Text
+// messages in conversations with formatting on get their body rendered as
+// HTML (see package markdown), and in channel chats the channel's emotes are
+// picked out as Tokens. In a channel chat it also gets the sender's badge
+// there, if the channel has one for their role. Text messages over the
+// conversation's length or emote limit are refused with a *ChatLimitError.
 func (r *MessageRepository) Create(message *models.Message) error {
-	query := `
-		INSERT INTO messages (id, conversation_id, sender_id, body, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at
-	`
+	if message.Kind == "" {
+		message.Kind = models.MessageText
+	}
+	var html *string
+	var tokens any
+	if message.Kind == models.MessageText {
+		var maxLength, maxEmotes int
+		err := r.db.QueryRow(stmtChatLimits, message.ConversationID).Scan(&maxLength, &maxEmotes)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to get chat limits: %w", err)
+		}
+		if maxLength > 0 && utf8.RuneCountInString(message.Body) > maxLength {
+			return &ChatLimitError{Err: ErrMessageTooLong, Max: maxLength}
+		}
 
+		rendered := markdown.Render(message.Body)
+		html = &rendered
+		if names := emote.Names(message.Body); names != nil {
+			images, err := r.emoteImages(message.ConversationID, names)
+			if err != nil {
+				return err
+			}
+			if message.Tokens = emote.Tokenize(message.Body, images); message.Tokens != nil {
+				tokens = message.Tokens
+			}
+		}
+		if n := emote.Count(message.Tokens); maxEmotes > 0 && n > maxEmotes {
+			return &ChatLimitError{Err: ErrTooManyChatEmotes, Max: maxEmotes}
+		}
+	}
 	err := r.db.QueryRow(
-		query,
+		stmtMessageInsert,
 		message.ID,
 		message.ConversationID,
 		message.SenderID,
 		message.Body,
+		message.Kind,
+		html,
+		tokens,
 		message.CreatedAt,
 		message.UpdatedAt,
-	).Scan(&message.ID, &message.CreatedAt, &message.UpdatedAt)
+	).Scan(&message.ID, &message.HTML, &message.CreatedAt, &message.UpdatedAt, &message.Badge)
 
 	if err != nil {
 		return fmt.Errorf("failed to create message: %w", err)
@@ -43,25 +137,82 @@ func (r *MessageRepository) Create(message *models.Message) error {
 	return nil
 }
 
+// emoteImages returns the images of those of names that are emotes of the
+// channel whose chat the conversation is
+func (r *MessageRepository) emoteImages(conversationID uuid.UUID, names []string) (map[string]models.ImageVariants, error) {
+	query := `
+		SELECT e.name, e.images
+		FROM channel_emotes e
+		INNER JOIN channels c ON c.id = e.channel_id
+		WHERE c.conversation_id = $1 AND e.name = ANY($2)
+	`
+	rows, err := r.db.Query(query, conversationID, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up emotes: %w", err)
+	}
+	defer rows.Close()
+
+	images := make(map[string]models.ImageVariants)
+	for rows.Next() {
+		var name string
+		var variants models.ImageVariants
+		if err := rows.Scan(&name, &variants); err != nil {
+			return nil, fmt.Errorf("failed to scan emote: %w", err)
+		}
+		images[name] = variants
+	}
+	return images, rows.Err()
+}
+
+// SetPreview stores the link preview of a message that is not deleted and
+// returns its new updated_at
+func (r *MessageRepository) SetPreview(id uuid.UUID, preview *models.LinkPreview) (time.Time, error) {
+	query := `UPDATE messages SET preview = $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING updated_at`
+	var updatedAt time.Time
+	err := r.db.QueryRow(query, id, preview).Scan(&updatedAt)
+	if err == pgx.ErrNoRows {
+		return time.Time{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to set message preview: %w", err)
+	}
+	return updatedAt, nil
+}
+
 // GetByID retrieves a message by ID
 func (r *MessageRepository) GetByID(id uuid.UUID) (*models.Message, error) {
+	return r.getByID(id, false)
+}
+
+// GetByIDIncludeDeleted retrieves a message even if it has been soft-deleted (admin use)
+func (r *MessageRepository) GetByIDIncludeDeleted(id uuid.UUID) (*models.Message, error) {
+	return r.getByID(id, true)
+}
+
+func (r *MessageRepository) getByID(id uuid.UUID, includeDeleted bool) (*models.Message, error) {
 	query := `
-		SELECT id, conversation_id, sender_id, body, created_at, updated_at
+		SELECT id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at, deleted_at, deleted_by, preview
 		FROM messages
-		WHERE id = $1
+		WHERE id = $1 AND ($2 OR deleted_at IS NULL)
 	`
 
 	message := &models.Message{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRow(query, id, includeDeleted).Scan(
 		&message.ID,
 		&message.ConversationID,
 		&message.SenderID,
 		&message.Body,
+		&message.Kind,
+		&message.HTML,
+		&message.Tokens,
 		&message.CreatedAt,
 		&message.UpdatedAt,
+		&message.DeletedAt,
+		&message.DeletedBy,
+		&message.Preview,
 	)
 
-	if err == sql.ErrNoRows {
+	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("message not found")
 	}
 	if err != nil {
@@ -73,6 +224,15 @@ func (r *MessageRepository) GetByID(id uuid.UUID) (*models.Message, error) {
 
 // GetByConversationID retrieves messages for a conversation with pagination
 func (r *MessageRepository) GetByConversationID(conversationID uuid.UUID, limit, offset int) ([]models.Message, error) {
+	return r.getByConversationID(conversationID, limit, offset, false)
+}
+
+// GetByConversationIDIncludeDeleted retrieves messages including soft-deleted ones (admin use)
+func (r *MessageRepository) GetByConversationIDIncludeDeleted(conversationID uuid.UUID, limit, offset int) ([]models.Message, error) {
+	return r.getByConversationID(conversationID, limit, offset, true)
+}
+
+func (r *MessageRepository) getByConversationID(conversationID uuid.UUID, limit, offset int, includeDeleted bool) ([]models.Message, error) {
 	if limit <= 0 {
 		limit = 50
 	}
@@ -81,16 +241,16 @@ func (r *MessageRepository) GetByConversationID(conversationID uuid.UUID, limit,
 	}
 
 	query := `
-		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at, m.updated_at,
-		       u.id, u.email, u.display_name, u.avatar_url, u.password_hash, u.created_at, u.updated_at
+		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.kind, m.html, m.tokens, m.created_at, m.updated_at, m.deleted_at,
+		       u.id, u.email, u.display_name, u.username, u.avatar_url, u.password_hash, u.created_at, u.updated_at
 		FROM messages m
 		INNER JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1
+		WHERE m.conversation_id = $1 AND ($4 OR m.deleted_at IS NULL)
 		ORDER BY m.created_at DESC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.Query(query, conversationID, limit, offset)
+	rows, err := r.db.Query(query, conversationID, limit, offset, includeDeleted)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
@@ -106,11 +266,16 @@ func (r *MessageRepository) GetByConversationID(conversationID uuid.UUID, limit,
 			&msg.ConversationID,
 			&msg.SenderID,
 			&msg.Body,
+			&msg.Kind,
+			&msg.HTML,
+			&msg.Tokens,
 			&msg.CreatedAt,
 			&msg.UpdatedAt,
+			&msg.DeletedAt,
 			&sender.ID,
 			&sender.Email,
 			&sender.DisplayName,
+			&sender.Username,
 			&sender.AvatarURL,
 			&sender.PasswordHash,
 			&sender.CreatedAt,
@@ -127,6 +292,135 @@ func (r *MessageRepository) GetByConversationID(conversationID uuid.UUID, limit,
 	return messages, nil
 }
 
+// ListByConversation returns a keyset page of messages, newest first, starting
+// after the cursor. Up to limit+1 rows are returned so callers can detect a
+// further page (see pagination.NewPage). When the live table runs out, the page
+// is filled from messages_archive, whose rows are all older than the live ones.
+func (r *MessageRepository) ListByConversation(conversationID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.Message, error) {
+	return r.listByConversation(conversationID, limit, cursor, false)
+}
+
+// ListWithDeleted is ListByConversation for moderators: deleted messages keep
+// their body and preview, and carry the moderation log entry behind the
+// deletion, if any, as Deletion.
+func (r *MessageRepository) ListWithDeleted(conversationID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.Message, error) {
+	return r.listByConversation(conversationID, limit, cursor, true)
+}
+
+func (r *MessageRepository) listByConversation(conversationID uuid.UUID, limit int, cursor *pagination.Cursor, reveal bool) ([]models.Message, error) {
+	messages, err := r.listPage("messages", conversationID, limit+1, cursor, reveal, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > limit {
+		return messages, nil
+	}
+
+	if len(messages) > 0 {
+		last := messages[len(messages)-1]
+		cursor = &pagination.Cursor{Time: last.CreatedAt, ID: last.ID}
+	}
+	archived, err := r.listPage("messages_archive", conversationID, limit+1-len(messages), cursor, reveal, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(messages, archived...), nil
+}
+
+// ListAfter returns the messages after cursor, oldest first, otherwise like
+// ListByConversation: up to limit+1 rows, with deleted ones as tombstones.
+// It is for catching up, so it doesn't read messages_archive.
+func (r *MessageRepository) ListAfter(conversationID uuid.UUID, limit int, cursor pagination.Cursor) ([]models.Message, error) {
+	return r.listPage("messages", conversationID, limit+1, &cursor, false, true)
+}
+
+// listPage reads one keyset page from table (messages or messages_archive),
+// newest first, or with forward oldest first from after the cursor. Deleted
+// messages are included as tombstones: their body is blanked and DeletedAt
+// set, so clients can show where a message was removed. With reveal, their
+// content is kept and the latest moderation log entry for the message is
+// attached.
+func (r *MessageRepository) listPage(table string, conversationID uuid.UUID, n int, cursor *pagination.Cursor, reveal, forward bool) ([]models.Message, error) {
+	var at *time.Time
+	atID := uuid.Nil
+	if cursor != nil {
+		at, atID = &cursor.Time, cursor.ID
+	}
+	cmp, order := "<", "DESC"
+	if forward {
+		cmp, order = ">", "ASC"
+	}
+
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, CASE WHEN m.deleted_at IS NULL OR $5 THEN m.body ELSE '' END, m.kind,
+		       CASE WHEN m.deleted_at IS NULL OR $5 THEN m.html END, CASE WHEN m.deleted_at IS NULL OR $5 THEN m.tokens END, m.created_at, m.updated_at, m.deleted_at, m.deleted_by, CASE WHEN m.deleted_at IS NULL OR $5 THEN m.preview END,
+		       u.id, u.email, u.display_name, u.username, u.avatar_url, u.password_hash, u.created_at, u.updated_at,
+		       d.action, d.reason
+		FROM ` + table + ` m
+		INNER JOIN users u ON m.sender_id = u.id
+		LEFT JOIN LATERAL (
+			SELECT l.action, l.reason FROM moderation_logs l
+			WHERE $5 AND m.deleted_at IS NOT NULL AND l.message_id = m.id
+			ORDER BY l.created_at DESC
+			LIMIT 1
+		) d ON true
+		WHERE m.conversation_id = $1
+		AND ($2::timestamp IS NULL OR (m.created_at, m.id) ` + cmp + ` ($2, $3))
+		ORDER BY m.created_at ` + order + `, m.id ` + order + `
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(query, conversationID, at, atID, n, reveal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		var msg models.Message
+		var sender models.User
+		var action, reason *string
+
+		err := rows.Scan(
+			&msg.ID,
+			&msg.ConversationID,
+			&msg.SenderID,
+			&msg.Body,
+			&msg.Kind,
+			&msg.HTML,
+			&msg.Tokens,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+			&msg.DeletedAt,
+			&msg.DeletedBy,
+			&msg.Preview,
+			&sender.ID,
+			&sender.Email,
+			&sender.DisplayName,
+			&sender.Username,
+			&sender.AvatarURL,
+			&sender.PasswordHash,
+			&sender.CreatedAt,
+			&sender.UpdatedAt,
+			&action,
+			&reason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if action != nil {
+			msg.Deletion = &models.MessageDeletion{Action: *action, Reason: reason}
+		}
+
+		msg.Sender = &sender
+		messages = append(messages, msg)
+	}
+
+	return messages, r.senderBadges(conversationID, messages)
+}
+
 // GetByConversationIDCursor retrieves messages for a conversation using cursor (before/after timestamps)
 func (r *MessageRepository) GetByConversationIDCursor(conversationID uuid.UUID, limit int, before, after *time.Time) ([]models.Message, error) {
 	if limit <= 0 {
@@ -137,38 +431,38 @@ func (r *MessageRepository) GetByConversationIDCursor(conversationID uuid.UUID,
 	}
 
 	var query string
-	var rows *sql.Rows
+	var rows pgx.Rows
 	var err error
 
 	if before != nil {
 		query = `
-		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at, m.updated_at,
-			   u.id, u.email, u.display_name, u.avatar_url, u.password_hash, u.created_at, u.updated_at
+		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.kind, m.html, m.tokens, m.created_at, m.updated_at,
+			   u.id, u.email, u.display_name, u.username, u.avatar_url, u.password_hash, u.created_at, u.updated_at
 		FROM messages m
 		INNER JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1 AND m.created_at < $2
+		WHERE m.conversation_id = $1 AND m.created_at < $2 AND m.deleted_at IS NULL
 		ORDER BY m.created_at DESC
 		LIMIT $3
 		`
 		rows, err = r.db.Query(query, conversationID, *before, limit)
 	} else if after != nil {
 		query = `
-		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at, m.updated_at,
-			   u.id, u.email, u.display_name, u.avatar_url, u.password_hash, u.created_at, u.updated_at
+		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.kind, m.html, m.tokens, m.created_at, m.updated_at,
+			   u.id, u.email, u.display_name, u.username, u.avatar_url, u.password_hash, u.created_at, u.updated_at
 		FROM messages m
 		INNER JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1 AND m.created_at > $2
+		WHERE m.conversation_id = $1 AND m.created_at > $2 AND m.deleted_at IS NULL
 		ORDER BY m.created_at ASC
 		LIMIT $3
 		`
 		rows, err = r.db.Query(query, conversationID, *after, limit)
 	} else {
 		query = `
-		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at, m.updated_at,
-			   u.id, u.email, u.display_name, u.avatar_url, u.password_hash, u.created_at, u.updated_at
+		SELECT m.id, m.conversation_id, m.sender_id, m.body, m.kind, m.html, m.tokens, m.created_at, m.updated_at,
+			   u.id, u.email, u.display_name, u.username, u.avatar_url, u.password_hash, u.created_at, u.updated_at
 		FROM messages m
 		INNER JOIN users u ON m.sender_id = u.id
-		WHERE m.conversation_id = $1
+		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL
 		ORDER BY m.created_at DESC
 		LIMIT $2
 		`
@@ -190,11 +484,15 @@ func (r *MessageRepository) GetByConversationIDCursor(conversationID uuid.UUID,
 			&msg.ConversationID,
 			&msg.SenderID,
 			&msg.Body,
+			&msg.Kind,
+			&msg.HTML,
+			&msg.Tokens,
 			&msg.CreatedAt,
 			&msg.UpdatedAt,
 			&sender.ID,
 			&sender.Email,
 			&sender.DisplayName,
+			&sender.Username,
 			&sender.AvatarURL,
 			&sender.PasswordHash,
 			&sender.CreatedAt,
@@ -215,7 +513,50 @@ func (r *MessageRepository) GetByConversationIDCursor(conversationID uuid.UUID,
 		}
 	}
 
-	return messages, nil
+	return messages, r.senderBadges(conversationID, messages)
+}
+
+// senderBadges sets the Badge of those messages of a channel chat whose
+// sender wears one there (see badgeRole). Other conversations have none.
+func (r *MessageRepository) senderBadges(conversationID uuid.UUID, messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	senders := make([]uuid.UUID, 0, len(messages))
+	for _, m := range messages {
+		senders = append(senders, m.SenderID)
+	}
+
+	query := `
+		SELECT s.id, b.role, b.images
+		FROM channels c
+		CROSS JOIN unnest($2::uuid[]) AS s(id)
+		LEFT JOIN conversation_members cm ON cm.conversation_id = c.conversation_id AND cm.user_id = s.id
+		INNER JOIN channel_badges b ON b.channel_id = c.id AND b.role = ` + badgeRole("s.id") + `
+		WHERE c.conversation_id = $1
+	`
+	rows, err := r.db.Query(query, conversationID, senders)
+	if err != nil {
+		return fmt.Errorf("failed to look up badges: %w", err)
+	}
+	defer rows.Close()
+
+	badges := make(map[uuid.UUID]*models.ChatBadge)
+	for rows.Next() {
+		var id uuid.UUID
+		b := &models.ChatBadge{}
+		if err := rows.Scan(&id, &b.Role, &b.Images); err != nil {
+			return fmt.Errorf("failed to scan badge: %w", err)
+		}
+		badges[id] = b
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to look up badges: %w", err)
+	}
+	for i := range messages {
+		messages[i].Badge = badges[messages[i].SenderID]
+	}
+	return nil
 }
 
 // MarkAsRead marks a message as read by a user
@@ -234,6 +575,157 @@ func (r *MessageRepository) MarkAsRead(messageID, userID uuid.UUID) error {
 	return nil
 }
 
+// AdvanceReadMarker moves userID's read marker in the message's conversation
+// forward to messageID and marks every earlier message read along with it.
+// It returns nil when the marker already is at or past the message, so
+// out-of-order reads from several devices never move it back.
+func (r *MessageRepository) AdvanceReadMarker(messageID, userID uuid.UUID) (*models.ReadMarker, error) {
+	query := `
+		WITH target AS (
+			SELECT id, conversation_id, created_at FROM messages WHERE id = $1 AND deleted_at IS NULL
+		),
+		advanced AS (
+			UPDATE conversation_members cm
+			SET last_read_message_id = t.id, last_read_at = NOW()
+			FROM target t
+			WHERE cm.conversation_id = t.conversation_id AND cm.user_id = $2
+			AND NOT EXISTS (
+				SELECT 1 FROM messages cur
+				WHERE cur.id = cm.last_read_message_id AND (cur.created_at, cur.id) >= (t.created_at, t.id)
+			)
+			RETURNING cm.conversation_id, cm.last_read_message_id, cm.last_read_at
+		),
+		marked AS (
+			INSERT INTO message_reads (id, message_id, user_id, read_at)
+			SELECT uuid_generate_v4(), m.id, $2, NOW()
+			FROM messages m
+			JOIN target t ON m.conversation_id = t.conversation_id
+			WHERE EXISTS (SELECT 1 FROM advanced)
+			AND (m.created_at, m.id) <= (t.created_at, t.id)
+			AND (m.sender_id <> $2 OR m.id = t.id)
+			AND m.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND mr.user_id = $2)
+			ON CONFLICT (message_id, user_id) DO NOTHING
+		)
+		SELECT conversation_id, last_read_message_id, last_read_at FROM advanced
+	`
+
+	marker := &models.ReadMarker{UserID: userID}
+	err := r.db.QueryRow(query, messageID, userID).Scan(&marker.ConversationID, &marker.LastReadMessageID, &marker.ReadAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to advance read marker: %w", err)
+	}
+	return marker, nil
+}
+
+// MoveReadMarker moves userID's read marker in a conversation forward to
+// messageID, or to the newest message when messageID is nil. Unlike
+// AdvanceReadMarker it stores only the marker, not a read receipt per
+// message, so it stays cheap in busy channel chats. It returns nil when the
+// marker already is at or past the message or the conversation has no
+// messages, and ErrMessageNotFound when messageID is not in the conversation.
+func (r *MessageRepository) MoveReadMarker(conversationID, userID uuid.UUID, messageID *uuid.UUID) (*models.ReadMarker, error) {
+	query := `
+		WITH target AS (
+			SELECT id, created_at FROM messages
+			WHERE conversation_id = $1 AND deleted_at IS NULL AND ($3::uuid IS NULL OR id = $3)
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		),
+		advanced AS (
+			UPDATE conversation_members cm
+			SET last_read_message_id = t.id, last_read_at = NOW()
+			FROM target t
+			WHERE cm.conversation_id = $1 AND cm.user_id = $2
+			AND NOT EXISTS (
+				SELECT 1 FROM messages cur
+				WHERE cur.id = cm.last_read_message_id AND (cur.created_at, cur.id) >= (t.created_at, t.id)
+			)
+			RETURNING cm.last_read_message_id, cm.last_read_at
+		)
+		SELECT EXISTS (SELECT 1 FROM target), a.last_read_message_id, a.last_read_at
+		FROM (SELECT 1) one
+		LEFT JOIN advanced a ON TRUE
+	`
+
+	var found bool
+	var lastRead *uuid.UUID
+	var readAt *time.Time
+	if err := r.db.QueryRow(query, conversationID, userID, messageID).Scan(&found, &lastRead, &readAt); err != nil {
+		return nil, fmt.Errorf("failed to move read marker: %w", err)
+	}
+	if !found && messageID != nil {
+		return nil, ErrMessageNotFound
+	}
+	if lastRead == nil {
+		return nil, nil
+	}
+	return &models.ReadMarker{ConversationID: conversationID, UserID: userID, LastReadMessageID: *lastRead, ReadAt: *readAt}, nil
+}
+
+// MarkAllAsRead marks every unread message in the user's conversations as
+// read in one statement, optionally only in conversationIDs (nil means all).
+// Read markers move to each conversation's newest message. It returns how
+// many messages were marked per conversation; conversations with nothing
+// unread are absent.
+func (r *MessageRepository) MarkAllAsRead(userID uuid.UUID, conversationIDs []uuid.UUID) ([]models.ConversationReadCount, error) {
+	query := `
+		WITH markers AS (
+			UPDATE conversation_members cm
+			SET last_read_message_id = newest.id, last_read_at = NOW()
+			FROM (
+				SELECT DISTINCT ON (m.conversation_id) m.conversation_id, m.id
+				FROM messages m
+				JOIN conversation_members mine ON mine.conversation_id = m.conversation_id AND mine.user_id = $1
+				WHERE m.deleted_at IS NULL
+				AND ($2::uuid[] IS NULL OR m.conversation_id = ANY($2))
+				ORDER BY m.conversation_id, m.created_at DESC, m.id DESC
+			) newest
+			WHERE cm.conversation_id = newest.conversation_id AND cm.user_id = $1
+		),
+		marked AS (
+			INSERT INTO message_reads (id, message_id, user_id, read_at)
+			SELECT uuid_generate_v4(), m.id, $1, NOW()
+			FROM messages m
+			JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $1
+			JOIN conversations c ON c.id = m.conversation_id AND c.deleted_at IS NULL
+			WHERE m.sender_id <> $1
+			AND m.deleted_at IS NULL
+			AND ($2::uuid[] IS NULL OR m.conversation_id = ANY($2))
+			AND NOT EXISTS (SELECT 1 FROM message_reads mr WHERE mr.message_id = m.id AND mr.user_id = $1)
+			ON CONFLICT (message_id, user_id) DO NOTHING
+			RETURNING message_id
+		)
+		SELECT m.conversation_id, COUNT(*)
+		FROM marked
+		JOIN messages m ON m.id = marked.message_id
+		GROUP BY m.conversation_id
+		ORDER BY m.conversation_id
+	`
+
+	rows, err := r.db.Query(query, userID, conversationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark all as read: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []models.ConversationReadCount{}
+	for rows.Next() {
+		var rc models.ConversationReadCount
+		if err := rows.Scan(&rc.ConversationID, &rc.Marked); err != nil {
+			return nil, fmt.Errorf("failed to scan read count: %w", err)
+		}
+		counts = append(counts, rc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to mark all as read: %w", err)
+	}
+	return counts, nil
+}
+
 // GetReadReceipts retrieves read receipts for a message
 func (r *MessageRepository) GetReadReceipts(messageID uuid.UUID) ([]models.MessageRead, error) {
 	query := `
@@ -266,15 +758,19 @@ func (r *MessageRepository) GetReadReceipts(messageID uuid.UUID) ([]models.Messa
 	return receipts, nil
 }
 
-// GetUnreadCount gets the number of unread messages for a user in a conversation
+// GetUnreadCount gets the number of unread messages for a user in a
+// conversation: other members' messages after their read marker. Without a
+// marker, or when the marker's message was archived, everything is unread.
 func (r *MessageRepository) GetUnreadCount(conversationID, userID uuid.UUID) (int, error) {
 	query := `
 		SELECT COUNT(*)
 		FROM messages m
-		LEFT JOIN message_reads mr ON m.id = mr.message_id AND mr.user_id = $2
+		JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $2
+		LEFT JOIN messages lr ON lr.id = cm.last_read_message_id
 		WHERE m.conversation_id = $1
 		AND m.sender_id != $2
-		AND mr.id IS NULL
+		AND m.deleted_at IS NULL
+		AND (lr.id IS NULL OR (m.created_at, m.id) > (lr.created_at, lr.id))
 	`
 
 	var count int
@@ -286,23 +782,242 @@ func (r *MessageRepository) GetUnreadCount(conversationID, userID uuid.UUID) (in
 	return count, nil
 }
 
-// Delete deletes a message
-func (r *MessageRepository) Delete(id uuid.UUID) error {
-	query := `DELETE FROM messages WHERE id = $1`
+// GetLastMessages retrieves the newest message of each conversation in one
+// query, keyed by conversation ID. Conversations without messages are absent.
+func (r *MessageRepository) GetLastMessages(conversationIDs []uuid.UUID) (map[uuid.UUID]models.Message, error) {
+	messages := make(map[uuid.UUID]models.Message, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return messages, nil
+	}
 
-	result, err := r.db.Exec(query, id)
+	query := `
+		SELECT DISTINCT ON (conversation_id) id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at
+		FROM messages
+		WHERE conversation_id = ANY($1) AND deleted_at IS NULL
+		ORDER BY conversation_id, created_at DESC, id DESC
+	`
+
+	rows, err := r.db.Query(query, conversationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg models.Message
+		err := rows.Scan(
+			&msg.ID,
+			&msg.ConversationID,
+			&msg.SenderID,
+			&msg.Body,
+			&msg.Kind,
+			&msg.HTML,
+			&msg.Tokens,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages[msg.ConversationID] = msg
+	}
+
+	return messages, nil
+}
+
+// GetUnreadCounts is GetUnreadCount for several conversations in one query,
+// keyed by conversation ID. Conversations with nothing unread are absent.
+func (r *MessageRepository) GetUnreadCounts(conversationIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return counts, nil
+	}
+
+	query := `
+		SELECT m.conversation_id, COUNT(*)
+		FROM messages m
+		JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $2
+		LEFT JOIN messages lr ON lr.id = cm.last_read_message_id
+		WHERE m.conversation_id = ANY($1)
+		AND m.sender_id != $2
+		AND m.deleted_at IS NULL
+		AND (lr.id IS NULL OR (m.created_at, m.id) > (lr.created_at, lr.id))
+		GROUP BY m.conversation_id
+	`
+
+	rows, err := r.db.Query(query, conversationIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread counts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var convID uuid.UUID
+		var count int
+		if err := rows.Scan(&convID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan unread count: %w", err)
+		}
+		counts[convID] = count
+	}
+
+	return counts, nil
+}
+
+// ListUnreadCounts returns the unread count of each of userID's
+// conversations, zero counts included, in one aggregate query
+func (r *MessageRepository) ListUnreadCounts(userID uuid.UUID) ([]models.UnreadCount, error) {
+	query := `
+		SELECT cm.conversation_id, COUNT(m.id)
+		FROM conversation_members cm
+		JOIN conversations c ON c.id = cm.conversation_id AND c.deleted_at IS NULL
+		LEFT JOIN messages lr ON lr.id = cm.last_read_message_id
+		LEFT JOIN messages m ON m.conversation_id = cm.conversation_id
+			AND m.sender_id <> cm.user_id
+			AND m.deleted_at IS NULL
+			AND (lr.id IS NULL OR (m.created_at, m.id) > (lr.created_at, lr.id))
+		WHERE cm.user_id = $1
+		GROUP BY cm.conversation_id
+		ORDER BY cm.conversation_id
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unread counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []models.UnreadCount{}
+	for rows.Next() {
+		var uc models.UnreadCount
+		if err := rows.Scan(&uc.ConversationID, &uc.Unread); err != nil {
+			return nil, fmt.Errorf("failed to scan unread count: %w", err)
+		}
+		counts = append(counts, uc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list unread counts: %w", err)
+	}
+	return counts, nil
+}
+
+// Delete soft-deletes a message on behalf of deletedBy, so moderation actions
+// stay auditable and reversible, and returns when it was deleted. It fails
+// with ErrMessageNotFound for missing and already deleted messages.
+func (r *MessageRepository) Delete(id, deletedBy uuid.UUID) (time.Time, error) {
+	query := `UPDATE messages SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING deleted_at`
+
+	var deletedAt time.Time
+	err := r.db.QueryRow(query, id, deletedBy).Scan(&deletedAt)
+	if err == pgx.ErrNoRows {
+		return time.Time{}, ErrMessageNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
+		return time.Time{}, fmt.Errorf("failed to delete message: %w", err)
 	}
+	return deletedAt, nil
+}
+
+// Restore clears the soft-delete marker on a message; it fails with
+// ErrMessageNotFound unless the message is deleted and not purged yet
+func (r *MessageRepository) Restore(id uuid.UUID) error {
+	query := `UPDATE messages SET deleted_at = NULL, deleted_by = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
 
-	rows, err := result.RowsAffected()
+	result, err := r.db.Exec(query, id)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to restore message: %w", err)
 	}
 
+	rows := result.RowsAffected()
+
 	if rows == 0 {
-		return fmt.Errorf("message not found")
+		return ErrMessageNotFound
 	}
 
 	return nil
 }
+
+// PurgeDeleted permanently removes messages soft-deleted before the cutoff
+func (r *MessageRepository) PurgeDeleted(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM messages WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge messages: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// ArchiveBefore moves up to batchSize messages created before the cutoff into
+// messages_archive in a single statement. Read receipts for moved messages are
+// dropped with them. Returns the number of messages moved.
+func (r *MessageRepository) ArchiveBefore(before time.Time, batchSize int) (int64, error) {
+	query := `
+		WITH moved AS (
+			DELETE FROM messages
+			WHERE id IN (
+				SELECT id FROM messages WHERE created_at < $1
+				ORDER BY created_at LIMIT $2
+			)
+			RETURNING id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at, deleted_at, deleted_by, preview
+		)
+		INSERT INTO messages_archive (id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at, deleted_at, deleted_by, preview)
+		SELECT id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at, deleted_at, deleted_by, preview FROM moved
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	result, err := r.db.Exec(query, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive messages: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// expiredMessages selects up to $2 messages of table (messages or
+// messages_archive) older at $1 than the retention of their conversation,
+// when the conversation's retention action is $3
+const expiredMessages = `
+	SELECT m.id FROM %s m
+	JOIN conversations c ON c.id = m.conversation_id
+	WHERE c.retention_days > 0 AND c.retention_action = $3
+		AND m.created_at < $1::timestamp - make_interval(days => c.retention_days)
+	ORDER BY m.created_at LIMIT $2
+`
+
+// DeleteExpired permanently deletes up to batchSize messages older than the
+// retention of conversations that delete expired messages, from the live
+// table first and then from messages_archive. Returns the number deleted.
+func (r *MessageRepository) DeleteExpired(now time.Time, batchSize int) (int64, error) {
+	var total int64
+	for _, table := range []string{"messages", "messages_archive"} {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE id IN (`+expiredMessages+`)`, table, table)
+		result, err := r.db.Exec(query, now, batchSize-int(total), models.RetentionDelete)
+		if err != nil {
+			return total, fmt.Errorf("failed to delete expired messages: %w", err)
+		}
+		total += result.RowsAffected()
+		if total >= int64(batchSize) {
+			break
+		}
+	}
+	return total, nil
+}
+
+// ArchiveExpired moves up to batchSize messages older than the retention of
+// conversations that archive expired messages into messages_archive, like
+// ArchiveBefore. Returns the number moved.
+func (r *MessageRepository) ArchiveExpired(now time.Time, batchSize int) (int64, error) {
+	query := fmt.Sprintf(`
+		WITH moved AS (
+			DELETE FROM messages WHERE id IN (`+expiredMessages+`)
+			RETURNING id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at, deleted_at, deleted_by, preview
+		)
+		INSERT INTO messages_archive (id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at, deleted_at, deleted_by, preview)
+		SELECT id, conversation_id, sender_id, body, kind, html, tokens, created_at, updated_at, deleted_at, deleted_by, preview FROM moved
+		ON CONFLICT (id) DO NOTHING
+	`, "messages")
+
+	result, err := r.db.Exec(query, now, batchSize, models.RetentionArchive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive expired messages: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
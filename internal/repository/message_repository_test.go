@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+func TestReadMarker(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	alice, bob, eve := newUser("alice"), newUser("bob"), newUser("eve")
+
+	conv := &models.Conversation{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*models.User{alice, bob} {
+		if err := convs.AddMember(&models.ConversationMember{ID: uuid.New(), ConversationID: conv.ID, UserID: u.ID, Role: "member", JoinedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sent []*models.Message
+	for i := 0; i < 3; i++ {
+		m := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: bob.ID, Body: "hi", CreatedAt: now.Add(time.Duration(i) * time.Second), UpdatedAt: now}
+		if err := messages.Create(m); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, m)
+	}
+
+	marker, err := messages.AdvanceReadMarker(sent[1].ID, alice.ID)
+	if err != nil || marker == nil || marker.LastReadMessageID != sent[1].ID || marker.ConversationID != conv.ID {
+		t.Fatalf("AdvanceReadMarker = %+v, %v", marker, err)
+	}
+	if n, err := messages.GetUnreadCount(conv.ID, alice.ID); err != nil || n != 1 {
+		t.Errorf("unread after marker = %d, %v; want 1", n, err)
+	}
+
+	// An older read (e.g. from a device that lagged behind) leaves it in place
+	if marker, err := messages.AdvanceReadMarker(sent[0].ID, alice.ID); err != nil || marker != nil {
+		t.Errorf("moving the marker back = %+v, %v; want nil", marker, err)
+	}
+	if id, err := convs.GetReadMarker(conv.ID, alice.ID); err != nil || id == nil || *id != sent[1].ID {
+		t.Errorf("GetReadMarker = %v, %v", id, err)
+	}
+
+	// Non-members have no marker to move
+	if marker, err := messages.AdvanceReadMarker(sent[2].ID, eve.ID); err != nil || marker != nil {
+		t.Errorf("AdvanceReadMarker for non-member = %+v, %v; want nil", marker, err)
+	}
+
+	if _, err := messages.MarkAllAsRead(alice.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := convs.GetReadMarker(conv.ID, alice.ID); err != nil || id == nil || *id != sent[2].ID {
+		t.Errorf("GetReadMarker after MarkAllAsRead = %v, %v", id, err)
+	}
+
+	// The conversation pointer moves to the newest message without a message ID
+	latest := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: bob.ID, Body: "later", CreatedAt: now.Add(time.Minute), UpdatedAt: now}
+	if err := messages.Create(latest); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := messages.GetUnreadCount(conv.ID, alice.ID); err != nil || n != 1 {
+		t.Errorf("unread after a new message = %d, %v; want 1", n, err)
+	}
+	if marker, err := messages.MoveReadMarker(conv.ID, alice.ID, nil); err != nil || marker == nil || marker.LastReadMessageID != latest.ID {
+		t.Fatalf("MoveReadMarker = %+v, %v", marker, err)
+	}
+	if n, err := messages.GetUnreadCount(conv.ID, alice.ID); err != nil || n != 0 {
+		t.Errorf("unread after MoveReadMarker = %d, %v; want 0", n, err)
+	}
+	if marker, err := messages.MoveReadMarker(conv.ID, alice.ID, &sent[0].ID); err != nil || marker != nil {
+		t.Errorf("moving the pointer back = %+v, %v; want nil", marker, err)
+	}
+	other := uuid.New()
+	if _, err := messages.MoveReadMarker(conv.ID, alice.ID, &other); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("MoveReadMarker to a foreign message: err = %v, want ErrMessageNotFound", err)
+	}
+
+	counts, err := messages.ListUnreadCounts(bob.ID)
+	if err != nil || len(counts) != 1 || counts[0].ConversationID != conv.ID || counts[0].Unread != 0 {
+		t.Errorf("ListUnreadCounts for the sender = %+v, %v; want one conversation with 0", counts, err)
+	}
+	mine := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: alice.ID, Body: "reply", CreatedAt: now.Add(2 * time.Minute), UpdatedAt: now}
+	if err := messages.Create(mine); err != nil {
+		t.Fatal(err)
+	}
+	if counts, err := messages.ListUnreadCounts(bob.ID); err != nil || len(counts) != 1 || counts[0].Unread != 1 {
+		t.Errorf("ListUnreadCounts after a reply = %+v, %v; want 1", counts, err)
+	}
+}
+
+func TestListWithDeleted(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+	mods := NewModerationRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "deleted@example.com", DisplayName: "deleted", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	m := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: u.ID, Body: "buy followers", CreatedAt: now, UpdatedAt: now}
+	if err := messages.Create(m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := messages.Delete(m.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	word := "followers"
+	if err := mods.AddLog(&models.ModerationLog{ID: uuid.New(), ConversationID: &conv.ID, MessageID: &m.ID, Action: "delete_word", Reason: &word, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := messages.ListByConversation(conv.ID, 10, nil)
+	if err != nil || len(list) != 1 || list[0].Body != "" || list[0].Deletion != nil {
+		t.Fatalf("ListByConversation = %+v, %v; want a tombstone", list, err)
+	}
+	list, err = messages.ListWithDeleted(conv.ID, 10, nil)
+	if err != nil || len(list) != 1 || list[0].Body != m.Body || list[0].Deletion == nil || list[0].Deletion.Action != "delete_word" {
+		t.Fatalf("ListWithDeleted = %+v, %v; want the body and the log entry", list, err)
+	}
+}
+
+func TestExpiredMessages(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "retention@example.com", DisplayName: "retention", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	newConv := func(days int, action string) *models.Conversation {
+		conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+		if err := convs.Create(conv); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := convs.GetByID(conv.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored.RetentionDays, stored.RetentionAction = &days, &action
+		if err := convs.Update(stored); err != nil {
+			t.Fatal(err)
+		}
+		return stored
+	}
+	send := func(conv *models.Conversation, age time.Duration) *models.Message {
+		m := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: u.ID, Body: "hi", CreatedAt: now.Add(-age), UpdatedAt: now}
+		if err := messages.Create(m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	day := 24 * time.Hour
+	deleting, archiving, forever := newConv(7, models.RetentionDelete), newConv(7, models.RetentionArchive), newConv(0, models.RetentionDelete)
+	old, recent := send(deleting, 8*day), send(deleting, 6*day)
+	oldArchived := send(archiving, 8*day)
+	kept := send(forever, 400*day)
+
+	if n, err := messages.ArchiveExpired(now, 10); err != nil || n != 1 {
+		t.Fatalf("ArchiveExpired = %d, %v; want 1", n, err)
+	}
+	if n, err := messages.DeleteExpired(now, 10); err != nil || n != 1 {
+		t.Fatalf("DeleteExpired = %d, %v; want 1", n, err)
+	}
+	if _, err := messages.GetByID(old.ID); err == nil {
+		t.Error("message past a delete retention still exists")
+	}
+	for _, m := range []*models.Message{recent, kept} {
+		if _, err := messages.GetByID(m.ID); err != nil {
+			t.Errorf("message %s was removed: %v", m.Body, err)
+		}
+	}
+	if list, err := messages.ListByConversation(archiving.ID, 10, nil); err != nil || len(list) != 1 || list[0].ID != oldArchived.ID {
+		t.Errorf("archived conversation lists %+v, %v; want the archived message", list, err)
+	}
+
+	// Archived messages are deleted once their conversation switches to delete
+	action := models.RetentionDelete
+	archiving.RetentionAction = &action
+	if err := convs.Update(archiving); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := messages.DeleteExpired(now, 10); err != nil || n != 1 {
+		t.Errorf("DeleteExpired of the archive = %d, %v; want 1", n, err)
+	}
+}
+
+func TestListAfter(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+
+	now := time.Now().Truncate(time.Microsecond)
+	sender := &models.User{ID: uuid.New(), Email: "after@example.com", DisplayName: "after", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(sender); err != nil {
+		t.Fatal(err)
+	}
+	conv := &models.Conversation{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages sent in the same instant are told apart by ID
+	var sent []models.Message
+	for i := 0; i < 5; i++ {
+		m := models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: sender.ID, Body: "same time", CreatedAt: now, UpdatedAt: now}
+		if err := messages.Create(&m); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, m)
+	}
+	slices.SortFunc(sent, func(a, b models.Message) int { return strings.Compare(a.ID.String(), b.ID.String()) })
+
+	var got []uuid.UUID
+	cursor := pagination.Cursor{Time: sent[0].CreatedAt, ID: sent[0].ID}
+	for {
+		page, err := messages.ListAfter(conv.ID, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		more := len(page) > 2
+		if more {
+			page = page[:2]
+		}
+		for _, m := range page {
+			got = append(got, m.ID)
+		}
+		if !more {
+			break
+		}
+		last := page[len(page)-1]
+		cursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}
+	}
+
+	var want []uuid.UUID
+	for _, m := range sent[1:] {
+		want = append(want, m.ID)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paging after the first message = %v, want %v", got, want)
+	}
+}
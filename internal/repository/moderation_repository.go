@@ -1,13 +1,15 @@
 package repository
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/tullo/backend/internal/database"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
 )
 
 type ModerationRepository struct {
@@ -58,10 +60,10 @@ func (r *ModerationRepository) GetBannedWords(conversationID uuid.UUID) ([]model
 
 // AddLog records a moderation action
 func (r *ModerationRepository) AddLog(log *models.ModerationLog) error {
-	meta := sql.NullString{}
+	var meta []byte
 	if log.Metadata != nil {
 		if b, err := json.Marshal(log.Metadata); err == nil {
-			meta = sql.NullString{String: string(b), Valid: true}
+			meta = b
 		}
 	}
 
@@ -72,12 +74,21 @@ func (r *ModerationRepository) AddLog(log *models.ModerationLog) error {
 	return nil
 }
 
-func (r *ModerationRepository) GetLogsByConversation(conversationID uuid.UUID, limit int) ([]models.ModerationLog, error) {
+// GetLogsByConversation returns a keyset page of moderation logs, newest first.
+// Up to limit+1 rows are returned so callers can detect a further page.
+func (r *ModerationRepository) GetLogsByConversation(conversationID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.ModerationLog, error) {
 	if limit <= 0 {
-		limit = 50
+		limit = pagination.DefaultLimit
 	}
-	query := `SELECT id, conversation_id, message_id, action, moderator_id, target_user_id, reason, metadata, created_at FROM moderation_logs WHERE conversation_id = $1 ORDER BY created_at DESC LIMIT $2`
-	rows, err := r.db.Query(query, conversationID, limit)
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+	query := `SELECT id, conversation_id, message_id, action, moderator_id, target_user_id, reason, metadata, created_at FROM moderation_logs
+		WHERE conversation_id = $1 AND ($2::timestamp IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC LIMIT $4`
+	rows, err := r.db.Query(query, conversationID, before, beforeID, limit+1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query moderation logs: %w", err)
 	}
@@ -86,16 +97,128 @@ func (r *ModerationRepository) GetLogsByConversation(conversationID uuid.UUID, l
 	res := []models.ModerationLog{}
 	for rows.Next() {
 		var m models.ModerationLog
-		var meta sql.NullString
+		var meta []byte
 		if err := rows.Scan(&m.ID, &m.ConversationID, &m.MessageID, &m.Action, &m.ModeratorID, &m.TargetUserID, &m.Reason, &meta, &m.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan moderation log: %w", err)
 		}
-		if meta.Valid {
+		if len(meta) > 0 {
 			var mm map[string]any
-			_ = json.Unmarshal([]byte(meta.String), &mm)
+			_ = json.Unmarshal(meta, &mm)
 			m.Metadata = mm
 		}
 		res = append(res, m)
 	}
 	return res, nil
 }
+
+// GetAutoMessages returns a channel's auto messages, all off if the owner
+// never configured them
+func (r *ModerationRepository) GetAutoMessages(channelID uuid.UUID) (*models.ChannelAutoMessages, error) {
+	query := `SELECT channel_id, welcome_message, announcement, announcement_interval_min, announcement_min_messages, last_announced_at, updated_at
+		FROM channel_auto_messages WHERE channel_id = $1`
+	a := &models.ChannelAutoMessages{}
+	err := r.db.QueryRow(query, channelID).Scan(&a.ChannelID, &a.WelcomeMessage, &a.Announcement, &a.AnnouncementIntervalMin, &a.AnnouncementMinMessages, &a.LastAnnouncedAt, &a.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return &models.ChannelAutoMessages{ChannelID: channelID, AnnouncementIntervalMin: models.DefaultAnnouncementInterval}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auto messages: %w", err)
+	}
+	return a, nil
+}
+
+// SaveAutoMessages stores a channel's auto messages. A changed announcement
+// goes out on the next check rather than waiting for the interval.
+func (r *ModerationRepository) SaveAutoMessages(a *models.ChannelAutoMessages) error {
+	query := `
+		INSERT INTO channel_auto_messages (channel_id, welcome_message, announcement, announcement_interval_min, announcement_min_messages, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (channel_id) DO UPDATE SET
+			welcome_message = EXCLUDED.welcome_message,
+			announcement = EXCLUDED.announcement,
+			announcement_interval_min = EXCLUDED.announcement_interval_min,
+			announcement_min_messages = EXCLUDED.announcement_min_messages,
+			last_announced_at = CASE WHEN channel_auto_messages.announcement = EXCLUDED.announcement
+				THEN channel_auto_messages.last_announced_at END,
+			updated_at = NOW()
+		RETURNING last_announced_at, updated_at
+	`
+	err := r.db.QueryRow(query, a.ChannelID, a.WelcomeMessage, a.Announcement, a.AnnouncementIntervalMin, a.AnnouncementMinMessages).Scan(&a.LastAnnouncedAt, &a.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save auto messages: %w", err)
+	}
+	return nil
+}
+
+// ClaimWelcome returns the welcome due for messageID, userID's first message
+// in the conversation, or nil if the conversation's channel has none or
+// already welcomed them. Each user is welcomed once per channel, even with
+// several bots racing for the same message.
+func (r *ModerationRepository) ClaimWelcome(conversationID, userID, messageID uuid.UUID) (*models.AutoMessage, error) {
+	query := `
+		WITH target AS (
+			SELECT am.channel_id, am.welcome_message
+			FROM channel_auto_messages am
+			INNER JOIN channels ch ON ch.id = am.channel_id
+			WHERE ch.conversation_id = $1 AND ch.deleted_at IS NULL
+			AND ch.owner_id <> $2 AND am.welcome_message <> ''
+			AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.conversation_id = $1 AND m.sender_id = $2 AND m.id <> $3)
+		),
+		claimed AS (
+			INSERT INTO channel_welcomes (channel_id, user_id)
+			SELECT channel_id, $2 FROM target
+			ON CONFLICT (channel_id, user_id) DO NOTHING
+			RETURNING channel_id
+		)
+		SELECT t.channel_id, t.welcome_message FROM claimed c INNER JOIN target t ON t.channel_id = c.channel_id
+	`
+	m := &models.AutoMessage{ConversationID: conversationID}
+	err := r.db.QueryRow(query, conversationID, userID, messageID).Scan(&m.ChannelID, &m.Body)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim welcome: %w", err)
+	}
+	return m, nil
+}
+
+// ClaimAnnouncements returns the announcements due in live channels and marks
+// them sent, so concurrent bots never post the same one twice. An
+// announcement is due once its interval passed and at least its minimum of
+// chat messages (not counting botUser's) arrived since the last one.
+func (r *ModerationRepository) ClaimAnnouncements(botUser uuid.UUID) ([]models.AutoMessage, error) {
+	query := `
+		UPDATE channel_auto_messages am
+		SET last_announced_at = NOW()
+		FROM channels ch
+		WHERE ch.id = am.channel_id AND ch.deleted_at IS NULL AND ch.conversation_id IS NOT NULL
+		AND am.announcement <> ''
+		AND (am.last_announced_at IS NULL OR am.last_announced_at <= NOW() - make_interval(mins => am.announcement_interval_min))
+		AND EXISTS (SELECT 1 FROM streams s WHERE s.channel_id = ch.id AND s.status = 'live')
+		AND (
+			SELECT COUNT(*) FROM messages m
+			WHERE m.conversation_id = ch.conversation_id AND m.deleted_at IS NULL AND m.sender_id <> $1
+			AND (am.last_announced_at IS NULL OR m.created_at > am.last_announced_at)
+		) >= am.announcement_min_messages
+		RETURNING am.channel_id, ch.conversation_id, am.announcement
+	`
+	rows, err := r.db.Query(query, botUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim announcements: %w", err)
+	}
+	defer rows.Close()
+
+	res := []models.AutoMessage{}
+	for rows.Next() {
+		var m models.AutoMessage
+		if err := rows.Scan(&m.ChannelID, &m.ConversationID, &m.Body); err != nil {
+			return nil, fmt.Errorf("failed to scan announcement: %w", err)
+		}
+		res = append(res, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim announcements: %w", err)
+	}
+	return res, nil
+}
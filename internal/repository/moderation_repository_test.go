@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestAutoMessages(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	streams := NewStreamRepository(db)
+	messages := NewMessageRepository(db)
+	mods := NewModerationRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	owner, viewer, bot := newUser("owner"), newUser("viewer"), newUser("bot")
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "auto", Title: "Auto", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	convID, err := channels.GetOrCreateConversation(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := mods.GetAutoMessages(ch.ID); err != nil || a.WelcomeMessage != "" || a.AnnouncementIntervalMin != models.DefaultAnnouncementInterval {
+		t.Fatalf("GetAutoMessages before configuring = %+v, %v", a, err)
+	}
+	auto := &models.ChannelAutoMessages{ChannelID: ch.ID, WelcomeMessage: "hi {user}", Announcement: "follow!", AnnouncementIntervalMin: 5, AnnouncementMinMessages: 1}
+	if err := mods.SaveAutoMessages(auto); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(u *models.User) *models.Message {
+		m := &models.Message{ID: uuid.New(), ConversationID: convID, SenderID: u.ID, Body: "hello", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := messages.Create(m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	first := send(viewer)
+	w, err := mods.ClaimWelcome(convID, viewer.ID, first.ID)
+	if err != nil || w == nil || w.Body != "hi {user}" || w.ChannelID != ch.ID {
+		t.Fatalf("ClaimWelcome = %+v, %v", w, err)
+	}
+	if w, err := mods.ClaimWelcome(convID, viewer.ID, first.ID); err != nil || w != nil {
+		t.Errorf("second ClaimWelcome = %+v, %v; want nil", w, err)
+	}
+	ownerMsg := send(owner)
+	if w, err := mods.ClaimWelcome(convID, owner.ID, ownerMsg.ID); err != nil || w != nil {
+		t.Errorf("ClaimWelcome for the owner = %+v, %v; want nil", w, err)
+	}
+
+	// Not live yet
+	if due, err := mods.ClaimAnnouncements(bot.ID); err != nil || len(due) != 0 {
+		t.Fatalf("ClaimAnnouncements offline = %+v, %v", due, err)
+	}
+	if err := streams.Create(&models.Stream{ID: uuid.New(), ChannelID: ch.ID, Status: "live", StartedAt: &now, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	due, err := mods.ClaimAnnouncements(bot.ID)
+	if err != nil || len(due) != 1 || due[0].ConversationID != convID || due[0].Body != "follow!" {
+		t.Fatalf("ClaimAnnouncements live = %+v, %v", due, err)
+	}
+	if due, err := mods.ClaimAnnouncements(bot.ID); err != nil || len(due) != 0 {
+		t.Errorf("ClaimAnnouncements within the interval = %+v, %v", due, err)
+	}
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrOverlayTokenNotFound is returned for unknown and revoked overlay tokens
+var ErrOverlayTokenNotFound = errors.New("overlay token not found")
+
+// OverlayTokenRepository stores each channel's overlay token by hash
+type OverlayTokenRepository struct {
+	db *database.DB
+}
+
+func NewOverlayTokenRepository(db *database.DB) *OverlayTokenRepository {
+	return &OverlayTokenRepository{db: db}
+}
+
+// Set gives channelID a new token, replacing (and so revoking) the old one
+func (r *OverlayTokenRepository) Set(channelID uuid.UUID, hint, tokenHash string) (*models.OverlayToken, error) {
+	query := `
+		INSERT INTO overlay_tokens (channel_id, token_hash, hint) VALUES ($1, $2, $3)
+		ON CONFLICT (channel_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, hint = EXCLUDED.hint, created_at = NOW(), last_used_at = NULL
+		RETURNING channel_id, hint, created_at, last_used_at
+	`
+	t := &models.OverlayToken{}
+	err := r.db.QueryRow(query, channelID, tokenHash, hint).Scan(&t.ChannelID, &t.Hint, &t.CreatedAt, &t.LastUsedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set overlay token: %w", err)
+	}
+	return t, nil
+}
+
+// Get returns channelID's token
+func (r *OverlayTokenRepository) Get(channelID uuid.UUID) (*models.OverlayToken, error) {
+	query := `SELECT channel_id, hint, created_at, last_used_at FROM overlay_tokens WHERE channel_id = $1`
+	t := &models.OverlayToken{}
+	err := r.db.QueryRow(query, channelID).Scan(&t.ChannelID, &t.Hint, &t.CreatedAt, &t.LastUsedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrOverlayTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get overlay token: %w", err)
+	}
+	return t, nil
+}
+
+// Revoke deletes channelID's token
+func (r *OverlayTokenRepository) Revoke(channelID uuid.UUID) error {
+	tag, err := r.db.Exec(`DELETE FROM overlay_tokens WHERE channel_id = $1`, channelID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke overlay token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOverlayTokenNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the channel whose token has tokenHash, as long as the
+// channel is not deleted, and records the use
+func (r *OverlayTokenRepository) Authenticate(tokenHash string) (uuid.UUID, error) {
+	query := `
+		UPDATE overlay_tokens t SET last_used_at = NOW()
+		FROM channels c
+		WHERE t.token_hash = $1 AND c.id = t.channel_id AND c.deleted_at IS NULL
+		RETURNING t.channel_id
+	`
+	var channelID uuid.UUID
+	err := r.db.QueryRow(query, tokenHash).Scan(&channelID)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, ErrOverlayTokenNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to authenticate overlay token: %w", err)
+	}
+	return channelID, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestOverlayTokenLifecycle(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	tokens := NewOverlayTokenRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "streamer@example.com", DisplayName: "Streamer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(owner); err != nil {
+		t.Fatal(err)
+	}
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "overlay", Title: "Overlay", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tokens.Get(ch.ID); !errors.Is(err, ErrOverlayTokenNotFound) {
+		t.Fatalf("Get before Set err = %v, want ErrOverlayTokenNotFound", err)
+	}
+	if _, err := tokens.Set(ch.ID, "tlo_aaaaaa", "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := tokens.Authenticate("hash-1"); err != nil || id != ch.ID {
+		t.Fatalf("Authenticate = %s, %v", id, err)
+	}
+
+	// A new token replaces the old one
+	rotated, err := tokens.Set(ch.ID, "tlo_bbbbbb", "hash-2")
+	if err != nil || rotated.Hint != "tlo_bbbbbb" || rotated.LastUsedAt != nil {
+		t.Fatalf("Set again = %+v, %v", rotated, err)
+	}
+	if _, err := tokens.Authenticate("hash-1"); !errors.Is(err, ErrOverlayTokenNotFound) {
+		t.Errorf("replaced token err = %v, want ErrOverlayTokenNotFound", err)
+	}
+
+	if err := tokens.Revoke(ch.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Authenticate("hash-2"); !errors.Is(err, ErrOverlayTokenNotFound) {
+		t.Errorf("revoked token err = %v, want ErrOverlayTokenNotFound", err)
+	}
+	if err := tokens.Revoke(ch.ID); !errors.Is(err, ErrOverlayTokenNotFound) {
+		t.Errorf("second Revoke err = %v, want ErrOverlayTokenNotFound", err)
+	}
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown, expired or revoked refresh tokens
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented again. The whole family is revoked, since either the
+	// client or an attacker holds a stolen copy.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Reasons recorded when a refresh token family is revoked
+const (
+	RevokedReuse         = "reuse"
+	RevokedPasswordReset = "password_reset"
+	RevokedSignOut       = "sign_out"
+	RevokedAccountDelete = "account_delete"
+	RevokedRoleChange    = "role_change"
+)
+
+// RefreshTokenRepository stores refresh tokens by hash. Every login starts a
+// family; each refresh marks the presented token used and adds its successor
+// to the same family, so replaying an old token can be traced to the login
+// it came from and that login revoked.
+type RefreshTokenRepository struct {
+	db *database.DB
+}
+
+func NewRefreshTokenRepository(db *database.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+// Create starts a new family for userID holding the token with tokenHash,
+// and the session on device it belongs to. It returns the session (and
+// family) ID.
+func (r *RefreshTokenRepository) Create(userID uuid.UUID, tokenHash string, expiresAt time.Time, device models.Device) (uuid.UUID, error) {
+	query := `
+		WITH family AS (
+			INSERT INTO refresh_token_families (user_id) VALUES ($1) RETURNING id
+		), session AS (
+			INSERT INTO sessions (id, user_id, user_agent, ip)
+			SELECT id, $1, $4, $5 FROM family
+		)
+		INSERT INTO refresh_tokens (token_hash, family_id, expires_at)
+		SELECT $2, id, $3 FROM family
+		RETURNING family_id
+	`
+	var sessionID uuid.UUID
+	if err := r.db.QueryRow(query, userID, tokenHash, expiresAt, device.UserAgent, device.IP).Scan(&sessionID); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return sessionID, nil
+}
+
+// Rotate exchanges the token with oldHash for one with newHash in the same
+// family and returns the family's user and session, which is marked seen
+// from device. Presenting a token that was already rotated revokes the family
+// and returns ErrRefreshTokenReused with the user.
+func (r *RefreshTokenRepository) Rotate(oldHash, newHash string, expiresAt time.Time, device models.Device) (userID, sessionID uuid.UUID, err error) {
+	ctx := context.Background()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		familyID  uuid.UUID
+		expires   time.Time
+		usedAt    *time.Time
+		revokedAt *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT t.family_id, f.user_id, t.expires_at, t.used_at, f.revoked_at
+		FROM refresh_tokens t
+		JOIN refresh_token_families f ON f.id = t.family_id
+		WHERE t.token_hash = $1
+		FOR UPDATE OF t, f
+	`, oldHash).Scan(&familyID, &userID, &expires, &usedAt, &revokedAt)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, uuid.Nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if revokedAt != nil {
+		return uuid.Nil, uuid.Nil, ErrRefreshTokenInvalid
+	}
+	if usedAt != nil {
+		if _, err := tx.Exec(ctx, `UPDATE refresh_token_families SET revoked_at = NOW(), revoked_reason = $2 WHERE id = $1`, familyID, RevokedReuse); err != nil {
+			return uuid.Nil, uuid.Nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return uuid.Nil, uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return userID, uuid.Nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(expires) {
+		return uuid.Nil, uuid.Nil, ErrRefreshTokenInvalid
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1`, oldHash); err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO refresh_tokens (token_hash, family_id, expires_at) VALUES ($1, $2, $3)`, newHash, familyID, expiresAt); err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE sessions SET last_seen_at = NOW(), user_agent = $2, ip = $3 WHERE id = $1`, familyID, device.UserAgent, device.IP); err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, familyID, nil
+}
+
+// RevokeAll revokes every live family of userID, signing the user out of all
+// devices
+func (r *RefreshTokenRepository) RevokeAll(userID uuid.UUID, reason string) error {
+	query := `UPDATE refresh_token_families SET revoked_at = NOW(), revoked_reason = $2 WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := r.db.Exec(query, userID, reason); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes families that can no longer be used: revoked ones
+// and those whose newest token has expired. Used tokens are kept until then
+// so that replaying them is still detected.
+func (r *RefreshTokenRepository) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM refresh_token_families f
+		WHERE f.revoked_at IS NOT NULL
+		OR NOT EXISTS (SELECT 1 FROM refresh_tokens t WHERE t.family_id = f.id AND t.expires_at > NOW())
+	`
+	tag, err := r.db.Exec(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	tokens := NewRefreshTokenRepository(db)
+
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), Email: "refresh@example.com", DisplayName: "Refresher", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	expires := now.Add(time.Hour)
+	device := models.Device{UserAgent: "test", IP: "127.0.0.1"}
+	sid, err := tokens.Create(user.ID, "a", expires, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, rotatedSID, err := tokens.Rotate("a", "b", expires, device)
+	if err != nil || uid != user.ID || rotatedSID != sid {
+		t.Fatalf("Rotate(a) = %s, %s, %v", uid, rotatedSID, err)
+	}
+	if _, _, err := tokens.Rotate("unknown", "x", expires, device); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Rotate(unknown) err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	// Replaying a revokes the family, so its live successor b stops working too
+	if _, _, err := tokens.Rotate("a", "c", expires, device); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Rotate(a) again err = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := tokens.Rotate("b", "d", expires, device); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Rotate(b) after reuse err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	if _, err := tokens.Create(user.ID, "e", now.Add(-time.Minute), device); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Rotate("e", "f", expires, device); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Rotate(expired) err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	if _, err := tokens.Create(user.ID, "g", expires, device); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.RevokeAll(user.ID, RevokedPasswordReset); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Rotate("g", "h", expires, device); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Rotate(g) after RevokeAll err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	n, err := tokens.DeleteExpired()
+	if err != nil || n != 3 {
+		t.Errorf("DeleteExpired = %d, %v, want 3 families", n, err)
+	}
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// ErrAlreadyReported is returned when the reporter already reported the message
+var ErrAlreadyReported = errors.New("message already reported")
+
+// ErrReportNotFound is returned for unknown reports and those already closed
+var ErrReportNotFound = errors.New("report not found")
+
+type ReportRepository struct {
+	db *database.DB
+}
+
+func NewReportRepository(db *database.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+const reportColumns = `id, message_id, conversation_id, reporter_id, sender_id, reason, details, body_snapshot,
+	message_created_at, message_deleted_at, status, created_at, resolved_at, resolved_by`
+
+func scanReport(row pgx.Row) (*models.MessageReport, error) {
+	r := &models.MessageReport{}
+	err := row.Scan(&r.ID, &r.MessageID, &r.ConversationID, &r.ReporterID, &r.SenderID, &r.Reason, &r.Details,
+		&r.BodySnapshot, &r.MessageCreatedAt, &r.MessageDeletedAt, &r.Status, &r.CreatedAt, &r.ResolvedAt, &r.ResolvedBy)
+	return r, err
+}
+
+// Create files a report against message, snapshotting its current content
+func (r *ReportRepository) Create(message *models.Message, reporterID uuid.UUID, reason, details string) (*models.MessageReport, error) {
+	query := `
+		INSERT INTO message_reports (message_id, conversation_id, reporter_id, sender_id, reason, details,
+			body_snapshot, message_created_at, message_deleted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (message_id, reporter_id) DO NOTHING
+		RETURNING ` + reportColumns
+
+	report, err := scanReport(r.db.QueryRow(query, message.ID, message.ConversationID, reporterID, message.SenderID,
+		reason, details, message.Body, message.CreatedAt, message.DeletedAt))
+	if err == pgx.ErrNoRows {
+		return nil, ErrAlreadyReported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+	return report, nil
+}
+
+// List returns a keyset page of reports in the given status, newest first.
+// Up to limit+1 rows are returned so callers can detect a further page (see
+// pagination.NewPage).
+func (r *ReportRepository) List(status string, limit int, cursor *pagination.Cursor) ([]models.MessageReport, error) {
+	return r.list(nil, status, limit, cursor)
+}
+
+// ListByConversation is List for the reports against one conversation's
+// messages, the queue of its moderators
+func (r *ReportRepository) ListByConversation(conversationID uuid.UUID, status string, limit int, cursor *pagination.Cursor) ([]models.MessageReport, error) {
+	return r.list(&conversationID, status, limit, cursor)
+}
+
+// list backs List and ListByConversation; a nil conversationID lists all
+func (r *ReportRepository) list(conversationID *uuid.UUID, status string, limit int, cursor *pagination.Cursor) ([]models.MessageReport, error) {
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+
+	query := `
+		SELECT ` + reportColumns + `
+		FROM message_reports
+		WHERE status = $1
+		AND ($2::timestamp IS NULL OR (created_at, id) < ($2, $3))
+		AND ($5::uuid IS NULL OR conversation_id = $5)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(query, status, before, beforeID, limit+1, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.MessageReport{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan report: %w", err)
+		}
+		reports = append(reports, *report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+
+	return reports, nil
+}
+
+// Resolve closes a pending report with status (resolved or dismissed)
+func (r *ReportRepository) Resolve(id uuid.UUID, status string, resolvedBy uuid.UUID) (*models.MessageReport, error) {
+	query := `
+		UPDATE message_reports
+		SET status = $2, resolved_at = NOW(), resolved_by = $3
+		WHERE id = $1 AND status = 'pending'
+		RETURNING ` + reportColumns
+
+	report, err := scanReport(r.db.QueryRow(query, id, status, resolvedBy))
+	if err == pgx.ErrNoRows {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve report: %w", err)
+	}
+	return report, nil
+}
+
+// ResolveInConversation is Resolve for a report against one of
+// conversationID's messages; reports about other conversations are not found
+func (r *ReportRepository) ResolveInConversation(id, conversationID uuid.UUID, status string, resolvedBy uuid.UUID) (*models.MessageReport, error) {
+	query := `
+		UPDATE message_reports
+		SET status = $3, resolved_at = NOW(), resolved_by = $4
+		WHERE id = $1 AND conversation_id = $2 AND status = 'pending'
+		RETURNING ` + reportColumns
+
+	report, err := scanReport(r.db.QueryRow(query, id, conversationID, status, resolvedBy))
+	if err == pgx.ErrNoRows {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestReportLifecycle(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+	reports := NewReportRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	sender, reporter, admin := newUser("sender"), newUser("reporter"), newUser("admin")
+
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	m := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: sender.ID, Body: "buy followers", CreatedAt: now, UpdatedAt: now}
+	if err := messages.Create(m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := messages.Delete(m.ID, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reports are filed from the (deleted) message as loaded by the handler
+	deleted, err := messages.GetByIDIncludeDeleted(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := reports.Create(deleted, reporter.ID, "spam", "again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != models.ReportPending || r.BodySnapshot != "buy followers" || r.SenderID != sender.ID || r.MessageDeletedAt == nil {
+		t.Errorf("report = %+v", r)
+	}
+	if _, err := reports.Create(deleted, reporter.ID, "other", ""); !errors.Is(err, ErrAlreadyReported) {
+		t.Errorf("second Create err = %v, want ErrAlreadyReported", err)
+	}
+
+	pending, err := reports.List(models.ReportPending, 10, nil)
+	if err != nil || len(pending) != 1 || pending[0].ID != r.ID {
+		t.Fatalf("List = %+v, %v", pending, err)
+	}
+
+	// The conversation's own queue holds the report; other conversations'
+	// queues neither list nor resolve it
+	other := uuid.New()
+	if mine, err := reports.ListByConversation(conv.ID, models.ReportPending, 10, nil); err != nil || len(mine) != 1 || mine[0].ID != r.ID {
+		t.Errorf("ListByConversation = %+v, %v", mine, err)
+	}
+	if theirs, err := reports.ListByConversation(other, models.ReportPending, 10, nil); err != nil || len(theirs) != 0 {
+		t.Errorf("ListByConversation(other) = %+v, %v", theirs, err)
+	}
+	if _, err := reports.ResolveInConversation(r.ID, other, models.ReportResolved, admin.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Errorf("ResolveInConversation(other) err = %v, want ErrReportNotFound", err)
+	}
+
+	resolved, err := reports.Resolve(r.ID, models.ReportDismissed, admin.ID)
+	if err != nil || resolved.Status != models.ReportDismissed || resolved.ResolvedBy == nil || *resolved.ResolvedBy != admin.ID {
+		t.Fatalf("Resolve = %+v, %v", resolved, err)
+	}
+	if _, err := reports.Resolve(r.ID, models.ReportResolved, admin.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Errorf("Resolve closed report err = %v, want ErrReportNotFound", err)
+	}
+	if pending, err := reports.List(models.ReportPending, 10, nil); err != nil || len(pending) != 0 {
+		t.Errorf("List after resolve = %+v, %v", pending, err)
+	}
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// ErrSessionNotFound is returned for unknown, foreign and signed-out sessions
+var ErrSessionNotFound = errors.New("session not found")
+
+// sessionTouchInterval limits how often last_seen_at is written for a session
+const sessionTouchInterval = time.Minute
+
+// SessionRepository reads and signs out login sessions. Sessions are created
+// and refreshed with their refresh token family (see RefreshTokenRepository)
+// and share its ID and revocation.
+type SessionRepository struct {
+	db *database.DB
+}
+
+func NewSessionRepository(db *database.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// ListByUser returns the user's live sessions, most recently seen first
+func (r *SessionRepository) ListByUser(userID uuid.UUID) ([]models.Session, error) {
+	query := `
+		SELECT s.id, s.user_agent, s.ip, s.created_at, s.last_seen_at
+		FROM sessions s
+		JOIN refresh_token_families f ON f.id = s.id
+		WHERE s.user_id = $1 AND f.revoked_at IS NULL
+		AND EXISTS (SELECT 1 FROM refresh_tokens t WHERE t.family_id = f.id AND t.expires_at > NOW())
+		ORDER BY s.last_seen_at DESC
+	`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Revoke signs out one of the user's sessions: its refresh tokens and access
+// tokens stop working
+func (r *SessionRepository) Revoke(id, userID uuid.UUID) error {
+	query := `UPDATE refresh_token_families SET revoked_at = NOW(), revoked_reason = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	tag, err := r.db.Exec(query, id, userID, RevokedSignOut)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// Active reports whether the session may still be used, and records that it
+// was seen, at most once a minute
+func (r *SessionRepository) Active(id uuid.UUID) (bool, error) {
+	query := `
+		WITH s AS (
+			SELECT s.id, s.last_seen_at
+			FROM sessions s
+			JOIN refresh_token_families f ON f.id = s.id
+			WHERE s.id = $1 AND f.revoked_at IS NULL
+		), touched AS (
+			UPDATE sessions SET last_seen_at = NOW()
+			WHERE id IN (SELECT id FROM s WHERE last_seen_at < NOW() - $2 * INTERVAL '1 second')
+		)
+		SELECT EXISTS (SELECT 1 FROM s)
+	`
+	var active bool
+	if err := r.db.QueryRow(query, id, sessionTouchInterval.Seconds()).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return active, nil
+}
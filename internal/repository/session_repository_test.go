@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestSessions(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	tokens := NewRefreshTokenRepository(db)
+	sessions := NewSessionRepository(db)
+
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), Email: "devices@example.com", DisplayName: "Devices", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	other := &models.User{ID: uuid.New(), Email: "other-devices@example.com", DisplayName: "Other", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	for _, u := range []*models.User{user, other} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expires := now.Add(time.Hour)
+	laptop, err := tokens.Create(user.ID, "laptop", expires, models.Device{UserAgent: "Firefox", IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, err := tokens.Create(user.ID, "phone", expires, models.Device{UserAgent: "iOS", IP: "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Rotate("phone", "phone-2", expires, models.Device{UserAgent: "iOS", IP: "10.0.0.3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := sessions.ListByUser(user.ID)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListByUser = %+v, %v", list, err)
+	}
+	if list[0].ID != phone || list[0].IP != "10.0.0.3" || list[1].ID != laptop || list[1].UserAgent != "Firefox" {
+		t.Errorf("sessions = %+v", list)
+	}
+
+	if active, err := sessions.Active(laptop); err != nil || !active {
+		t.Errorf("Active(laptop) = %v, %v", active, err)
+	}
+	if err := sessions.Revoke(laptop, other.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("foreign Revoke err = %v, want ErrSessionNotFound", err)
+	}
+	if err := sessions.Revoke(laptop, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if active, err := sessions.Active(laptop); err != nil || active {
+		t.Errorf("Active(laptop) after Revoke = %v, %v", active, err)
+	}
+	if _, _, err := tokens.Rotate("laptop", "laptop-2", expires, models.Device{}); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Rotate after Revoke err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if list, _ := sessions.ListByUser(user.ID); len(list) != 1 || list[0].ID != phone {
+		t.Errorf("sessions after Revoke = %+v", list)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/tullo/backend/internal/database"
 	"github.com/tullo/backend/internal/models"
 )
@@ -17,11 +18,20 @@ func NewStreamRepository(db *database.DB) *StreamRepository {
 	return &StreamRepository{db: db}
 }
 
+// streamColumns are the columns scanStream reads, in order
+const streamColumns = `id, channel_id, status, ingest_url, hls_url, stream_key, mature, content_tags, started_at, ended_at, created_at, updated_at`
+
+func scanStream(row pgx.Row) (*models.Stream, error) {
+	s := &models.Stream{}
+	err := row.Scan(&s.ID, &s.ChannelID, &s.Status, &s.IngestURL, &s.HLSURL, &s.StreamKey, &s.Mature, &s.ContentTags, &s.StartedAt, &s.EndedAt, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
 func (r *StreamRepository) Create(s *models.Stream) error {
 	query := `
-        INSERT INTO streams (id, channel_id, status, ingest_url, hls_url, stream_key, started_at, ended_at, created_at, updated_at)
-        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-        RETURNING id, created_at, updated_at
+        INSERT INTO streams (id, channel_id, status, ingest_url, hls_url, stream_key, mature, content_tags, started_at, ended_at, created_at, updated_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,COALESCE($8, '{}'::text[]),$9,$10,$11,$12)
+        RETURNING id, content_tags, created_at, updated_at
     `
 	err := r.db.QueryRow(query,
 		s.ID,
@@ -30,11 +40,13 @@ func (r *StreamRepository) Create(s *models.Stream) error {
 		s.IngestURL,
 		s.HLSURL,
 		s.StreamKey,
+		s.Mature,
+		s.ContentTags,
 		s.StartedAt,
 		s.EndedAt,
 		s.CreatedAt,
 		s.UpdatedAt,
-	).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+	).Scan(&s.ID, &s.ContentTags, &s.CreatedAt, &s.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create stream: %w", err)
 	}
@@ -51,38 +63,63 @@ func (r *StreamRepository) UpdateStatus(id uuid.UUID, status string) error {
 }
 
 func (r *StreamRepository) GetByChannel(channelID uuid.UUID) (*models.Stream, error) {
+	query := `SELECT ` + streamColumns + ` FROM streams WHERE channel_id = $1 ORDER BY created_at DESC LIMIT 1`
+	s, err := scanStream(r.db.QueryRow(query, channelID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream: %w", err)
+	}
+	return s, nil
+}
+
+// GetByID returns a stream of a channel that was not deleted, or
+// ErrStreamNotFound
+func (r *StreamRepository) GetByID(id uuid.UUID) (*models.Stream, error) {
 	query := `
-        SELECT id, channel_id, status, ingest_url, hls_url, stream_key, started_at, ended_at, created_at, updated_at
-        FROM streams WHERE channel_id = $1 ORDER BY created_at DESC LIMIT 1
-    `
-	s := &models.Stream{}
-	err := r.db.QueryRow(query, channelID).Scan(
-		&s.ID,
-		&s.ChannelID,
-		&s.Status,
-		&s.IngestURL,
-		&s.HLSURL,
-		&s.StreamKey,
-		&s.StartedAt,
-		&s.EndedAt,
-		&s.CreatedAt,
-		&s.UpdatedAt,
-	)
+		SELECT ` + streamColumns + ` FROM streams s
+		WHERE s.id = $1 AND EXISTS (SELECT 1 FROM channels c WHERE c.id = s.channel_id AND c.deleted_at IS NULL)
+	`
+	s, err := scanStream(r.db.QueryRow(query, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrStreamNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get stream: %w", err)
 	}
 	return s, nil
 }
 
+// GetLatestByChannels is GetByChannel for several channels in one query,
+// keyed by channel ID. Channels that never streamed are absent.
+func (r *StreamRepository) GetLatestByChannels(channelIDs []uuid.UUID) (map[uuid.UUID]models.Stream, error) {
+	out := make(map[uuid.UUID]models.Stream, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return out, nil
+	}
+
+	query := `SELECT DISTINCT ON (channel_id) ` + streamColumns + `
+        FROM streams WHERE channel_id = ANY($1) ORDER BY channel_id, created_at DESC`
+	rows, err := r.db.Query(query, channelIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get streams: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanStream(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stream: %w", err)
+		}
+		out[s.ChannelID] = *s
+	}
+	return out, nil
+}
+
 // GetActiveStreams returns streams currently marked as 'live'
 func (r *StreamRepository) GetActiveStreams(limit int) ([]models.Stream, error) {
 	if limit <= 0 {
 		limit = 100
 	}
-	query := `
-        SELECT id, channel_id, status, ingest_url, hls_url, stream_key, started_at, ended_at, created_at, updated_at
-        FROM streams WHERE status = 'live' ORDER BY started_at DESC LIMIT $1
-    `
+	query := `SELECT ` + streamColumns + ` FROM streams WHERE status = 'live' ORDER BY started_at DESC LIMIT $1`
 	rows, err := r.db.Query(query, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active streams: %w", err)
@@ -91,15 +128,61 @@ func (r *StreamRepository) GetActiveStreams(limit int) ([]models.Stream, error)
 
 	var out []models.Stream
 	for rows.Next() {
-		var s models.Stream
-		if err := rows.Scan(&s.ID, &s.ChannelID, &s.Status, &s.IngestURL, &s.HLSURL, &s.StreamKey, &s.StartedAt, &s.EndedAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		s, err := scanStream(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan stream: %w", err)
 		}
-		out = append(out, s)
+		out = append(out, *s)
 	}
 	return out, nil
 }
 
+// GetActiveStreamsWithChannels is GetActiveStreams joined with each
+// stream's channel, owner and follower count, for listing streams without a
+// request per channel. Streams of deleted channels and those prefs hide are
+// left out; Viewers is not set.
+func (r *StreamRepository) GetActiveStreamsWithChannels(limit int, prefs models.ContentPreferences) ([]models.StreamWithChannel, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	query := `
+        SELECT s.id, s.channel_id, s.status, s.hls_url, s.started_at, s.mature, s.content_tags,
+               c.slug, c.title, c.language, COALESCE(c.tags, '{}'),
+               u.id, u.display_name, u.avatar_url,
+               (SELECT COUNT(*) FROM channel_follows f WHERE f.channel_id = c.id)
+        FROM streams s
+        JOIN channels c ON c.id = s.channel_id AND c.deleted_at IS NULL
+        JOIN users u ON u.id = c.owner_id
+        WHERE s.status = 'live' AND ($2 OR NOT s.mature) AND NOT (s.content_tags && $3)
+        ORDER BY s.started_at DESC LIMIT $1
+    `
+	rows, err := r.db.Query(query, limit, prefs.ShowMature, hiddenTags(prefs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active streams: %w", err)
+	}
+	defer rows.Close()
+
+	out := []models.StreamWithChannel{}
+	for rows.Next() {
+		var s models.StreamWithChannel
+		if err := rows.Scan(&s.ID, &s.ChannelID, &s.Status, &s.HLSURL, &s.StartedAt, &s.Mature, &s.ContentTags,
+			&s.Slug, &s.Title, &s.Language, &s.Tags,
+			&s.OwnerID, &s.OwnerName, &s.OwnerAvatarURL, &s.Followers); err != nil {
+			return nil, fmt.Errorf("failed to scan stream: %w", err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// hiddenTags is prefs.HiddenTags as a non-NULL array for SQL
+func hiddenTags(prefs models.ContentPreferences) []string {
+	if prefs.HiddenTags == nil {
+		return []string{}
+	}
+	return prefs.HiddenTags
+}
+
 // EndStream sets stream status to ended and records ended_at
 func (r *StreamRepository) EndStream(id uuid.UUID, endedAt time.Time) error {
 	query := `UPDATE streams SET status = 'ended', ended_at = $1, updated_at = NOW() WHERE id = $2`
@@ -109,3 +192,29 @@ func (r *StreamRepository) EndStream(id uuid.UUID, endedAt time.Time) error {
 	}
 	return nil
 }
+
+// EndStaleStreams ends live streams whose status has not been updated since
+// the cutoff and returns the slugs of their channels
+func (r *StreamRepository) EndStaleStreams(before time.Time) ([]string, error) {
+	query := `
+		UPDATE streams s SET status = 'ended', ended_at = NOW(), updated_at = NOW()
+		FROM channels c
+		WHERE c.id = s.channel_id AND s.status = 'live' AND s.updated_at < $1
+		RETURNING c.slug
+	`
+	rows, err := r.db.Query(query, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to end stale streams: %w", err)
+	}
+	defer rows.Close()
+
+	var slugs []string
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, fmt.Errorf("failed to scan stream channel: %w", err)
+		}
+		slugs = append(slugs, slug)
+	}
+	return slugs, rows.Err()
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestGetActiveStreamsWithChannels(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	streams := NewStreamRepository(db)
+
+	now := time.Now()
+	owner := &models.User{ID: uuid.New(), Email: "streamer@example.com", DisplayName: "Streamer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	fan := &models.User{ID: uuid.New(), Email: "fan@example.com", DisplayName: "Fan", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	for _, u := range []*models.User{owner, fan} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	live := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "live", Title: "Live", Tags: []string{"speedrun"}, CreatedAt: now, UpdatedAt: now}
+	ended := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "ended", Title: "Ended", CreatedAt: now, UpdatedAt: now}
+	deleted := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "deleted", Title: "Deleted", CreatedAt: now, UpdatedAt: now}
+	for _, c := range []*models.Channel{live, ended, deleted} {
+		if err := channels.Create(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := channels.AddFollower(live.ID, fan.ID, models.FollowOrigin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := streams.Create(&models.Stream{ID: uuid.New(), ChannelID: live.ID, Status: "live", StartedAt: &now, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := streams.Create(&models.Stream{ID: uuid.New(), ChannelID: ended.ID, Status: "ended", StartedAt: &now, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := streams.Create(&models.Stream{ID: uuid.New(), ChannelID: deleted.ID, Status: "live", StartedAt: &now, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.Delete(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := streams.GetActiveStreamsWithChannels(10, models.ContentPreferences{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d streams, want 1: %+v", len(got), got)
+	}
+	s := got[0]
+	if s.ChannelID != live.ID || s.Slug != "live" || s.Title != "Live" || s.OwnerID != owner.ID || s.OwnerName != "Streamer" {
+		t.Errorf("stream = %+v", s)
+	}
+	if len(s.Tags) != 1 || s.Tags[0] != "speedrun" || s.Followers != 1 {
+		t.Errorf("tags = %v, followers = %d", s.Tags, s.Followers)
+	}
+
+	// Mature and tagged streams are left out unless the viewer opted in
+	mature := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "mature", Title: "Mature", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(mature); err != nil {
+		t.Fatal(err)
+	}
+	if err := streams.Create(&models.Stream{ID: uuid.New(), ChannelID: mature.ID, Status: "live", Mature: true, ContentTags: []string{"gambling"}, StartedAt: &now, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		prefs models.ContentPreferences
+		want  int
+	}{
+		{models.ContentPreferences{}, 1},
+		{models.ContentPreferences{ShowMature: true}, 2},
+		{models.ContentPreferences{ShowMature: true, HiddenTags: []string{"gambling"}}, 1},
+	} {
+		got, err := streams.GetActiveStreamsWithChannels(10, tt.prefs)
+		if err != nil || len(got) != tt.want {
+			t.Errorf("GetActiveStreamsWithChannels(%+v) = %d streams, %v; want %d", tt.prefs, len(got), err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+)
+
+// TranslationRepository caches message translations by language
+type TranslationRepository struct {
+	db *database.DB
+}
+
+func NewTranslationRepository(db *database.DB) *TranslationRepository {
+	return &TranslationRepository{db: db}
+}
+
+// Get returns the message's translation into language, or nil if there is
+// none yet
+func (r *TranslationRepository) Get(messageID uuid.UUID, language string) (*models.MessageTranslation, error) {
+	query := `
+		SELECT message_id, language, text, source_language, provider, created_at
+		FROM message_translations
+		WHERE message_id = $1 AND language = $2
+	`
+	var t models.MessageTranslation
+	err := r.db.QueryRow(query, messageID, language).Scan(&t.MessageID, &t.Language, &t.Text, &t.SourceLanguage, &t.Provider, &t.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get translation: %w", err)
+	}
+	return &t, nil
+}
+
+// Save stores a translation. When another request translated the message
+// into the same language first, that translation is kept and returned in t.
+func (r *TranslationRepository) Save(t *models.MessageTranslation) error {
+	query := `
+		INSERT INTO message_translations (message_id, language, text, source_language, provider)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (message_id, language) DO UPDATE SET message_id = EXCLUDED.message_id
+		RETURNING text, source_language, provider, created_at
+	`
+	err := r.db.QueryRow(query, t.MessageID, t.Language, t.Text, t.SourceLanguage, t.Provider).Scan(&t.Text, &t.SourceLanguage, &t.Provider, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save translation: %w", err)
+	}
+	return nil
+}
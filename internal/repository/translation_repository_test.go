@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestTranslations(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+	translations := NewTranslationRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "translations@example.com", DisplayName: "translations", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if err := convs.Create(conv); err != nil {
+		t.Fatal(err)
+	}
+	m := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: u.ID, Body: "good morning", CreatedAt: now, UpdatedAt: now}
+	if err := messages.Create(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := translations.Get(m.ID, "de"); err != nil || got != nil {
+		t.Fatalf("Get before any translation = %+v, %v", got, err)
+	}
+	en := "en"
+	if err := translations.Save(&models.MessageTranslation{MessageID: m.ID, Language: "de", Text: "guten Morgen", SourceLanguage: &en, Provider: "deepl"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A concurrent request that lost the race gets the stored translation
+	late := &models.MessageTranslation{MessageID: m.ID, Language: "de", Text: "Guten Morgen!", Provider: "google"}
+	if err := translations.Save(late); err != nil {
+		t.Fatal(err)
+	}
+	if late.Text != "guten Morgen" || late.Provider != "deepl" {
+		t.Errorf("Save of a second translation = %+v, want the first one", late)
+	}
+
+	got, err := translations.Get(m.ID, "de")
+	if err != nil || got == nil || got.Text != "guten Morgen" || got.SourceLanguage == nil || *got.SourceLanguage != "en" {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+}
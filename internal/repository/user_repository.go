@@ -1,11 +1,14 @@
 package repository
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/tullo/backend/internal/database"
 	"github.com/tullo/backend/internal/models"
 )
@@ -18,12 +21,17 @@ func NewUserRepository(db *database.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// Create creates a new user
+// ErrEmailTaken is returned by Create and Restore when a live account has
+// the email
+var ErrEmailTaken = errors.New("email taken")
+
+// Create creates a new user. Deleted accounts do not hold on to their
+// email.
 func (r *UserRepository) Create(user *models.User) error {
 	query := `
 		INSERT INTO users (id, email, display_name, avatar_url, password_hash, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, created_at, updated_at
+		RETURNING id, role, created_at, updated_at
 	`
 
 	err := r.db.QueryRow(
@@ -35,8 +43,12 @@ func (r *UserRepository) Create(user *models.User) error {
 		user.PasswordHash,
 		user.CreatedAt,
 		user.UpdatedAt,
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEmailTaken
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -46,24 +58,38 @@ func (r *UserRepository) Create(user *models.User) error {
 
 // GetByID retrieves a user by ID
 func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
+	return r.getByID(id, false)
+}
+
+// GetByIDIncludeDeleted retrieves a user by ID even if it has been soft-deleted (admin use)
+func (r *UserRepository) GetByIDIncludeDeleted(id uuid.UUID) (*models.User, error) {
+	return r.getByID(id, true)
+}
+
+func (r *UserRepository) getByID(id uuid.UUID, includeDeleted bool) (*models.User, error) {
 	query := `
-		SELECT id, email, display_name, avatar_url, password_hash, created_at, updated_at
+		SELECT id, email, display_name, username, avatar_url, password_hash, email_verified_at, role, created_at, updated_at, deleted_at, version
 		FROM users
-		WHERE id = $1
+		WHERE id = $1 AND ($2 OR deleted_at IS NULL)
 	`
 
 	user := &models.User{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRow(query, id, includeDeleted).Scan(
 		&user.ID,
 		&user.Email,
 		&user.DisplayName,
+		&user.Username,
 		&user.AvatarURL,
 		&user.PasswordHash,
+		&user.EmailVerifiedAt,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeletedAt,
+		&user.Version,
 	)
 
-	if err == sql.ErrNoRows {
+	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("user not found")
 	}
 	if err != nil {
@@ -76,9 +102,9 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 // GetByEmail retrieves a user by email
 func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, email, display_name, avatar_url, password_hash, created_at, updated_at
+		SELECT id, email, display_name, username, avatar_url, password_hash, email_verified_at, role, created_at, updated_at
 		FROM users
-		WHERE email = $1
+		WHERE email = $1 AND deleted_at IS NULL
 	`
 
 	user := &models.User{}
@@ -86,13 +112,16 @@ func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 		&user.ID,
 		&user.Email,
 		&user.DisplayName,
+		&user.Username,
 		&user.AvatarURL,
 		&user.PasswordHash,
+		&user.EmailVerifiedAt,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 
-	if err == sql.ErrNoRows {
+	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("user not found")
 	}
 	if err != nil {
@@ -109,18 +138,12 @@ func (r *UserRepository) GetByIDs(ids []uuid.UUID) ([]models.User, error) {
 	}
 
 	query := `
-		SELECT id, email, display_name, avatar_url, password_hash, created_at, updated_at
+		SELECT id, email, display_name, username, avatar_url, password_hash, created_at, updated_at
 		FROM users
-		WHERE id = ANY($1)
+		WHERE id = ANY($1) AND deleted_at IS NULL
 	`
 
-	// Convert UUIDs to strings for the query
-	idStrings := make([]string, len(ids))
-	for i, id := range ids {
-		idStrings[i] = id.String()
-	}
-
-	rows, err := r.db.Query(query, idStrings)
+	rows, err := r.db.Query(query, ids)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
@@ -133,6 +156,7 @@ func (r *UserRepository) GetByIDs(ids []uuid.UUID) ([]models.User, error) {
 			&user.ID,
 			&user.Email,
 			&user.DisplayName,
+			&user.Username,
 			&user.AvatarURL,
 			&user.PasswordHash,
 			&user.CreatedAt,
@@ -147,16 +171,23 @@ func (r *UserRepository) GetByIDs(ids []uuid.UUID) ([]models.User, error) {
 	return users, nil
 }
 
-// Update updates a user
+// Update updates a user's profile fields. user.Version must hold the version the
+// caller read; ErrVersionConflict is returned if the row changed in the meantime.
 func (r *UserRepository) Update(user *models.User) error {
 	query := `
 		UPDATE users
-		SET display_name = $1, avatar_url = $2, updated_at = NOW()
-		WHERE id = $3
-		RETURNING updated_at
+		SET display_name = $1, avatar_url = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+		RETURNING updated_at, version
 	`
 
-	err := r.db.QueryRow(query, user.DisplayName, user.AvatarURL, user.ID).Scan(&user.UpdatedAt)
+	err := r.db.QueryRow(query, user.DisplayName, user.AvatarURL, user.ID, user.Version).Scan(&user.UpdatedAt, &user.Version)
+	if err == pgx.ErrNoRows {
+		if _, getErr := r.GetByID(user.ID); getErr != nil {
+			return fmt.Errorf("user not found")
+		}
+		return ErrVersionConflict
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -164,27 +195,221 @@ func (r *UserRepository) Update(user *models.User) error {
 	return nil
 }
 
-// Delete deletes a user
+// ErrUserNotFound is returned for unknown and deleted users
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUsernameTaken is returned when another account holds the username
+var ErrUsernameTaken = errors.New("username taken")
+
+// SetUsername gives the user a new username, which must already be
+// normalized (see models.NormalizeUsername)
+func (r *UserRepository) SetUsername(user *models.User, username string) error {
+	query := `
+		UPDATE users
+		SET username = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING updated_at, version
+	`
+
+	err := r.db.QueryRow(query, username, user.ID).Scan(&user.UpdatedAt, &user.Version)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrUsernameTaken
+	}
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set username: %w", err)
+	}
+
+	user.Username = &username
+	return nil
+}
+
+// MarkEmailVerified records that the user confirmed their email address
+func (r *UserRepository) MarkEmailVerified(id uuid.UUID) error {
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// RehashPassword replaces a password hash with the same password hashed
+// again, e.g. with a newer algorithm. Unlike UpdatePassword it keeps the
+// version and updated_at, and it does nothing if the hash changed since
+// oldHash was read, so a concurrent password reset wins.
+func (r *UserRepository) RehashPassword(id uuid.UUID, oldHash, newHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`
+	if _, err := r.db.Exec(query, newHash, id, oldHash); err != nil {
+		return fmt.Errorf("failed to rehash password: %w", err)
+	}
+	return nil
+}
+
+// UpdatePassword replaces the user's password hash
+func (r *UserRepository) UpdatePassword(id uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1, updated_at = NOW(), version = version + 1 WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := r.db.Exec(query, passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// Delete soft-deletes a user so the account can be restored and audit trails survive
 func (r *UserRepository) Delete(id uuid.UUID) error {
-	query := `DELETE FROM users WHERE id = $1`
+	query := `UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
 
 	result, err := r.db.Exec(query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
-	rows, err := result.RowsAffected()
+	rows := result.RowsAffected()
+
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// DeleteAccount soft-deletes a user at their own request, in one
+// transaction with the cleanup: their channels are soft-deleted, their
+// conversation memberships, follows and security log removed and their
+// refresh tokens and API keys revoked. When anonymizeTo is set their messages are reassigned to
+// that user, otherwise they are soft-deleted (archived ones are removed).
+func (r *UserRepository) DeleteAccount(id, anonymizeTo uuid.UUID) error {
+	ctx := context.Background()
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	if rows == 0 {
+	tag, err := tx.Exec(ctx, `UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
 		return fmt.Errorf("user not found")
 	}
 
+	messages := []string{
+		`UPDATE messages SET deleted_at = NOW() WHERE sender_id = $1 AND deleted_at IS NULL`,
+		`DELETE FROM messages_archive WHERE sender_id = $1`,
+	}
+	args := []any{id}
+	if anonymizeTo != uuid.Nil {
+		messages = []string{
+			`UPDATE messages SET sender_id = $2 WHERE sender_id = $1`,
+			`UPDATE messages_archive SET sender_id = $2 WHERE sender_id = $1`,
+		}
+		args = append(args, anonymizeTo)
+	}
+	for _, query := range messages {
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to clean up messages: %w", err)
+		}
+	}
+
+	cleanup := []string{
+		`UPDATE channels SET deleted_at = NOW() WHERE owner_id = $1 AND deleted_at IS NULL`,
+		`DELETE FROM conversation_members WHERE user_id = $1`,
+		`DELETE FROM channel_follows WHERE user_id = $1`,
+		`DELETE FROM watch_history WHERE user_id = $1`,
+		`DELETE FROM channel_points WHERE user_id = $1`,
+		`DELETE FROM device_keys WHERE user_id = $1`,
+		`DELETE FROM bot_scores WHERE user_id = $1`,
+		`UPDATE analytics_events SET user_id = NULL WHERE user_id = $1`,
+		`UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		`DELETE FROM auth_events WHERE user_id = $1`,
+	}
+	for _, query := range cleanup {
+		if _, err := tx.Exec(ctx, query, id); err != nil {
+			return fmt.Errorf("failed to clean up account: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE refresh_token_families SET revoked_at = NOW(), revoked_reason = $2 WHERE user_id = $1 AND revoked_at IS NULL`, id, RevokedAccountDelete); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetRole changes a user's platform role. A changed role signs out all of
+// the user's sessions, so tokens carrying the old role stop working; changed
+// reports whether it did.
+func (r *UserRepository) SetRole(id uuid.UUID, role string) (changed bool, err error) {
+	query := `
+		WITH u AS (
+			SELECT id, role FROM users WHERE id = $1 AND deleted_at IS NULL
+		), updated AS (
+			UPDATE users SET role = $2, updated_at = NOW()
+			WHERE id IN (SELECT id FROM u WHERE role <> $2)
+			RETURNING id
+		), revoked AS (
+			UPDATE refresh_token_families SET revoked_at = NOW(), revoked_reason = $3
+			WHERE user_id IN (SELECT id FROM updated) AND revoked_at IS NULL
+		)
+		SELECT EXISTS (SELECT 1 FROM updated) FROM u
+	`
+	err = r.db.QueryRow(query, id, role, RevokedRoleChange).Scan(&changed)
+	if err == pgx.ErrNoRows {
+		return false, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to set role: %w", err)
+	}
+	return changed, nil
+}
+
+// Restore clears the soft-delete marker on a user. It returns ErrEmailTaken
+// if another account has registered with the email since.
+func (r *UserRepository) Restore(id uuid.UUID) error {
+	query := `UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	result, err := r.db.Exec(query, id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	rows := result.RowsAffected()
+
+	if rows == 0 {
+		return fmt.Errorf("deleted user not found")
+	}
+
 	return nil
 }
 
+// PurgeDeleted permanently removes users soft-deleted before the cutoff
+func (r *UserRepository) PurgeDeleted(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge users: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
 // EnsureSystemUser creates or returns a system user by email (used for TulloBot)
 func (r *UserRepository) EnsureSystemUser(email, displayName string) (*models.User, error) {
 	u, err := r.GetByEmail(email)
@@ -204,3 +429,53 @@ func (r *UserRepository) EnsureSystemUser(email, displayName string) (*models.Us
 	}
 	return user, nil
 }
+
+// GetDMPolicy returns who may start a direct conversation with the user
+func (r *UserRepository) GetDMPolicy(id uuid.UUID) (string, error) {
+	var policy string
+	err := r.db.QueryRow(`SELECT dm_policy FROM users WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&policy)
+	if err == pgx.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get DM policy: %w", err)
+	}
+	return policy, nil
+}
+
+// SetDMPolicy changes who may start a direct conversation with the user
+func (r *UserRepository) SetDMPolicy(id uuid.UUID, policy string) error {
+	tag, err := r.db.Exec(`UPDATE users SET dm_policy = $1 WHERE id = $2 AND deleted_at IS NULL`, policy, id)
+	if err != nil {
+		return fmt.Errorf("failed to set DM policy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetDoNotDisturb returns when the user's do not disturb ends, or nil if it is off
+func (r *UserRepository) GetDoNotDisturb(id uuid.UUID) (*time.Time, error) {
+	var until *time.Time
+	err := r.db.QueryRow(`SELECT CASE WHEN dnd_until > NOW() THEN dnd_until END FROM users WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&until)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get do not disturb: %w", err)
+	}
+	return until, nil
+}
+
+// SetDoNotDisturb turns the user's do not disturb on until until, or off if until is nil
+func (r *UserRepository) SetDoNotDisturb(id uuid.UUID, until *time.Time) error {
+	tag, err := r.db.Exec(`UPDATE users SET dnd_until = $1 WHERE id = $2 AND deleted_at IS NULL`, until, id)
+	if err != nil {
+		return fmt.Errorf("failed to set do not disturb: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	convs := NewConversationRepository(db)
+	messages := NewMessageRepository(db)
+	keys := NewAPIKeyRepository(db)
+	tokens := NewRefreshTokenRepository(db)
+	sessions := NewSessionRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	leaving, staying, ghost := newUser("leaving"), newUser("staying"), newUser("ghost")
+
+	ch := &models.Channel{ID: uuid.New(), OwnerID: staying.ID, Slug: "stays", Title: "Stays", CreatedAt: now, UpdatedAt: now}
+	owned := &models.Channel{ID: uuid.New(), OwnerID: leaving.ID, Slug: "goes", Title: "Goes", CreatedAt: now, UpdatedAt: now}
+	for _, c := range []*models.Channel{ch, owned} {
+		if err := channels.Create(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := channels.AddFollower(ch.ID, leaving.ID, models.FollowOrigin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conv := &models.Conversation{ID: uuid.New(), IsGroup: true, CreatedAt: now, UpdatedAt: now}
+	if _, err := convs.CreateWithMembers(conv, []models.ConversationMember{
+		{ID: uuid.New(), ConversationID: conv.ID, UserID: leaving.ID, Role: "member", JoinedAt: now},
+		{ID: uuid.New(), ConversationID: conv.ID, UserID: staying.ID, Role: "member", JoinedAt: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	msg := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: leaving.ID, Body: "bye", CreatedAt: now, UpdatedAt: now}
+	if err := messages.Create(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keys.Create(&models.APIKey{ID: uuid.New(), UserID: leaving.ID, Name: "bot", Hint: "tlk_x", Scopes: []string{models.ScopeRead}}, "leaving-key"); err != nil {
+		t.Fatal(err)
+	}
+	session, err := tokens.Create(leaving.ID, "leaving-refresh", now.Add(time.Hour), models.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.DeleteAccount(leaving.ID, ghost.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.GetByID(leaving.ID); err == nil {
+		t.Error("deleted user still found")
+	}
+	if got, err := messages.GetByID(msg.ID); err != nil || got.SenderID != ghost.ID || got.Body != "bye" {
+		t.Errorf("message = %+v, %v; want it kept and sent by the placeholder", got, err)
+	}
+	if member, _ := convs.IsMember(conv.ID, leaving.ID); member {
+		t.Error("membership not removed")
+	}
+	if follows, _ := channels.IsFollower(ch.ID, leaving.ID); follows {
+		t.Error("follow not removed")
+	}
+	if _, err := channels.GetBySlug(owned.Slug); err == nil {
+		t.Error("owned channel not deleted")
+	}
+	if _, err := keys.Authenticate("leaving-key"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Authenticate err = %v, want ErrAPIKeyNotFound", err)
+	}
+	if active, err := sessions.Active(session); err != nil || active {
+		t.Errorf("Active = %v, %v; want the session signed out", active, err)
+	}
+	if err := users.DeleteAccount(leaving.ID, ghost.ID); err == nil {
+		t.Error("second DeleteAccount succeeded")
+	}
+
+	// Without a placeholder the messages go too
+	other := newUser("other")
+	gone := &models.Message{ID: uuid.New(), ConversationID: conv.ID, SenderID: other.ID, Body: "gone", CreatedAt: now, UpdatedAt: now}
+	if err := messages.Create(gone); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.DeleteAccount(other.ID, uuid.Nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := messages.GetByID(gone.ID); err == nil {
+		t.Error("message of deleted account still visible")
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	tokens := NewRefreshTokenRepository(db)
+	sessions := NewSessionRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "promoted@example.com", DisplayName: "promoted", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Role != models.RoleUser {
+		t.Errorf("new user role = %q, want %q", u.Role, models.RoleUser)
+	}
+	session, err := tokens.Create(u.ID, "promoted-refresh", now.Add(time.Hour), models.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting the current role changes nothing and keeps the session
+	if changed, err := users.SetRole(u.ID, models.RoleUser); err != nil || changed {
+		t.Fatalf("SetRole(user) = %v, %v; want no change", changed, err)
+	}
+	if active, err := sessions.Active(session); err != nil || !active {
+		t.Fatalf("session active = %v, %v after no-op role change", active, err)
+	}
+
+	if changed, err := users.SetRole(u.ID, models.RoleAdmin); err != nil || !changed {
+		t.Fatalf("SetRole(admin) = %v, %v; want changed", changed, err)
+	}
+	if got, err := users.GetByID(u.ID); err != nil || got.Role != models.RoleAdmin {
+		t.Fatalf("role after SetRole = %v, %v", got, err)
+	}
+	if active, err := sessions.Active(session); err != nil || active {
+		t.Errorf("session active = %v, %v after role change; want signed out", active, err)
+	}
+
+	if _, err := users.SetRole(uuid.New(), models.RoleAdmin); err == nil {
+		t.Error("SetRole on unknown user succeeded")
+	}
+}
+
+func TestRehashPassword(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+
+	now := time.Now()
+	u := &models.User{ID: uuid.New(), Email: "rehash@example.com", DisplayName: "rehash", PasswordHash: "old", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	before, err := users.GetByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A hash that changed in the meantime is left alone
+	if err := users.RehashPassword(u.ID, "stale", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := users.GetByID(u.ID); got.PasswordHash != "old" {
+		t.Errorf("hash = %q after stale rehash, want old", got.PasswordHash)
+	}
+
+	if err := users.RehashPassword(u.ID, "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := users.GetByID(u.ID)
+	if err != nil || got.PasswordHash != "new" || got.Version != before.Version {
+		t.Errorf("after rehash = %+v, %v; want hash new, version %d", got, err, before.Version)
+	}
+}
+
+func TestSetUsername(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+
+	now := time.Now()
+	newUser := func(name string) *models.User {
+		u := &models.User{ID: uuid.New(), Email: name + "@example.com", DisplayName: name, PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	ada, bob := newUser("ada"), newUser("bob")
+
+	if err := users.SetUsername(ada, "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetUsername(bob, "ada"); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("SetUsername(taken) = %v, want ErrUsernameTaken", err)
+	}
+	// Renaming frees the old name
+	if err := users.SetUsername(ada, "lovelace"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetUsername(bob, "ada"); err != nil {
+		t.Errorf("SetUsername(freed) = %v", err)
+	}
+
+	got, err := users.GetByID(ada.ID)
+	if err != nil || got.Username == nil || *got.Username != "lovelace" || got.Version != ada.Version {
+		t.Errorf("ada = %+v, %v; want username lovelace at version %d", got, err, ada.Version)
+	}
+}
+
+func TestRegisterAfterDelete(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+
+	now := time.Now()
+	gone := &models.User{ID: uuid.New(), Email: "again@example.com", DisplayName: "again", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(gone); err != nil {
+		t.Fatal(err)
+	}
+	twin := &models.User{ID: uuid.New(), Email: gone.Email, DisplayName: "twin", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	if err := users.Create(twin); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("Create with a live account's email = %v, want ErrEmailTaken", err)
+	}
+
+	if err := users.DeleteAccount(gone.ID, uuid.Nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Create(twin); err != nil {
+		t.Fatalf("Create with a deleted account's email = %v", err)
+	}
+	if got, err := users.GetByEmail(gone.Email); err != nil || got.ID != twin.ID {
+		t.Errorf("GetByEmail = %+v, %v; want the new account", got, err)
+	}
+	if err := users.Restore(gone.ID); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Restore with the email taken again = %v, want ErrEmailTaken", err)
+	}
+}
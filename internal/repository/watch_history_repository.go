@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/database"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/pagination"
+)
+
+// ErrStreamNotFound is returned when recording progress in a stream that does
+// not exist or whose channel was deleted
+var ErrStreamNotFound = errors.New("stream not found")
+
+// WatchHistoryRepository stores which streams each user watched and where
+// they left off
+type WatchHistoryRepository struct {
+	db *database.DB
+}
+
+func NewWatchHistoryRepository(db *database.DB) *WatchHistoryRepository {
+	return &WatchHistoryRepository{db: db}
+}
+
+// Record saves a heartbeat from userID's player in streamID. The time since
+// the previous heartbeat counts as watched, up to maxGap, so a paused or
+// closed player does not keep adding up.
+func (r *WatchHistoryRepository) Record(userID, streamID uuid.UUID, position int, maxGap time.Duration) (*models.WatchEntry, error) {
+	query := `
+		INSERT INTO watch_history (user_id, stream_id, position_seconds)
+		SELECT $1, s.id, $3
+		FROM streams s
+		JOIN channels c ON c.id = s.channel_id AND c.deleted_at IS NULL
+		WHERE s.id = $2
+		ON CONFLICT (user_id, stream_id) DO UPDATE
+		SET position_seconds = EXCLUDED.position_seconds,
+			watched_seconds = watch_history.watched_seconds +
+				LEAST(GREATEST(EXTRACT(EPOCH FROM NOW() - watch_history.last_watched_at), 0), $4::int)::int,
+			last_watched_at = NOW()
+		RETURNING stream_id, position_seconds, watched_seconds, first_watched_at, last_watched_at
+	`
+	e := &models.WatchEntry{}
+	err := r.db.QueryRow(query, userID, streamID, position, int(maxGap.Seconds())).Scan(
+		&e.StreamID, &e.PositionSeconds, &e.WatchedSeconds, &e.FirstWatchedAt, &e.LastWatchedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrStreamNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record watch progress: %w", err)
+	}
+	return e, nil
+}
+
+// ListByUser returns a page of userID's history, most recently watched
+// first. Streams of deleted channels are left out.
+func (r *WatchHistoryRepository) ListByUser(userID uuid.UUID, limit int, cursor *pagination.Cursor) ([]models.WatchHistoryEntry, error) {
+	if limit <= 0 {
+		limit = pagination.DefaultLimit
+	}
+	var before *time.Time
+	beforeID := uuid.Nil
+	if cursor != nil {
+		before, beforeID = &cursor.Time, cursor.ID
+	}
+	query := `
+		SELECT w.stream_id, w.position_seconds, w.watched_seconds, w.first_watched_at, w.last_watched_at,
+		       s.channel_id, c.slug, c.title, s.status, s.hls_url, s.mature, s.started_at, s.ended_at
+		FROM watch_history w
+		JOIN streams s ON s.id = w.stream_id
+		JOIN channels c ON c.id = s.channel_id AND c.deleted_at IS NULL
+		WHERE w.user_id = $1 AND ($2::timestamp IS NULL OR (w.last_watched_at, w.stream_id) < ($2, $3))
+		ORDER BY w.last_watched_at DESC, w.stream_id DESC LIMIT $4
+	`
+	rows, err := r.db.Query(query, userID, before, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watch history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.WatchHistoryEntry{}
+	for rows.Next() {
+		var e models.WatchHistoryEntry
+		if err := rows.Scan(&e.StreamID, &e.PositionSeconds, &e.WatchedSeconds, &e.FirstWatchedAt, &e.LastWatchedAt,
+			&e.ChannelID, &e.Slug, &e.Title, &e.StreamStatus, &e.HLSURL, &e.Mature, &e.StartedAt, &e.EndedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan watch history: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list watch history: %w", err)
+	}
+	return entries, nil
+}
+
+// WatchTimeByChannels sums how long userID watched each of channelIDs'
+// streams since the given time, in seconds. Channels not watched are
+// missing from the map.
+func (r *WatchHistoryRepository) WatchTimeByChannels(userID uuid.UUID, channelIDs []uuid.UUID, since time.Time) (map[uuid.UUID]int, error) {
+	out := make(map[uuid.UUID]int, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return out, nil
+	}
+	query := `
+		SELECT s.channel_id, SUM(w.watched_seconds)
+		FROM watch_history w
+		JOIN streams s ON s.id = w.stream_id
+		WHERE w.user_id = $1 AND s.channel_id = ANY($2) AND w.last_watched_at >= $3
+		GROUP BY s.channel_id
+	`
+	rows, err := r.db.Query(query, userID, channelIDs, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum watch time: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var seconds int
+		if err := rows.Scan(&id, &seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan watch time: %w", err)
+		}
+		out[id] = seconds
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/database/dbtest"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestWatchHistory(t *testing.T) {
+	db := dbtest.Open(t)
+	users := NewUserRepository(db)
+	channels := NewChannelRepository(db)
+	streams := NewStreamRepository(db)
+	history := NewWatchHistoryRepository(db)
+
+	now := time.Now()
+	viewer := &models.User{ID: uuid.New(), Email: "viewer@example.com", DisplayName: "Viewer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	owner := &models.User{ID: uuid.New(), Email: "streamer@example.com", DisplayName: "Streamer", PasswordHash: "x", CreatedAt: now, UpdatedAt: now}
+	for _, u := range []*models.User{viewer, owner} {
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ch := &models.Channel{ID: uuid.New(), OwnerID: owner.ID, Slug: "watched", Title: "Watched", CreatedAt: now, UpdatedAt: now}
+	if err := channels.Create(ch); err != nil {
+		t.Fatal(err)
+	}
+	var ids []uuid.UUID
+	for i := 0; i < 2; i++ {
+		s := &models.Stream{ID: uuid.New(), ChannelID: ch.ID, Status: "ended", CreatedAt: now, UpdatedAt: now}
+		if err := streams.Create(s); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, s.ID)
+	}
+
+	if _, err := history.Record(viewer.ID, uuid.New(), 0, time.Minute); !errors.Is(err, ErrStreamNotFound) {
+		t.Fatalf("Record unknown stream err = %v, want ErrStreamNotFound", err)
+	}
+	first, err := history.Record(viewer.ID, ids[0], 10, time.Minute)
+	if err != nil || first.PositionSeconds != 10 || first.WatchedSeconds != 0 {
+		t.Fatalf("first Record = %+v, %v", first, err)
+	}
+	// Pretend the last heartbeat was long ago: only maxGap counts as watched
+	if _, err := db.Exec(`UPDATE watch_history SET last_watched_at = NOW() - INTERVAL '1 hour' WHERE stream_id = $1`, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	again, err := history.Record(viewer.ID, ids[0], 95, time.Minute)
+	if err != nil || again.PositionSeconds != 95 || again.WatchedSeconds != 60 {
+		t.Fatalf("second Record = %+v, %v", again, err)
+	}
+	if _, err := history.Record(viewer.ID, ids[1], 5, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := history.ListByUser(viewer.ID, 1, nil)
+	if err != nil || len(page) != 2 || page[0].StreamID != ids[1] || page[0].Slug != "watched" {
+		t.Fatalf("ListByUser = %+v, %v", page, err)
+	}
+
+	watched, err := history.WatchTimeByChannels(viewer.ID, []uuid.UUID{ch.ID}, now.Add(-time.Hour))
+	if err != nil || watched[ch.ID] != 60 {
+		t.Fatalf("WatchTimeByChannels = %v, %v", watched, err)
+	}
+}
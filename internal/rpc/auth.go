@@ -0,0 +1,28 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TokenAuthInterceptor rejects calls whose "authorization" metadata is not
+// "Bearer <token>". Internal callers share one token (GRPC_AUTH_TOKEN).
+func TokenAuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var got string
+		if vals := md.Get("authorization"); len(vals) > 0 {
+			got, _ = strings.CutPrefix(vals[0], "Bearer ")
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing token")
+		}
+		return handler(ctx, req)
+	}
+}
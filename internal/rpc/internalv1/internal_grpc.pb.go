@@ -0,0 +1,236 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: tullo/internal/v1/internal.proto
+
+// Internal API for trusted backend services (media server controller,
+// recommendation worker). Not exposed to clients: callers authenticate with
+// the shared GRPC_AUTH_TOKEN rather than a user JWT.
+
+package internalv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	InternalService_SendMessage_FullMethodName     = "/tullo.internal.v1.InternalService/SendMessage"
+	InternalService_CheckMembership_FullMethodName = "/tullo.internal.v1.InternalService/CheckMembership"
+	InternalService_GetStreamStatus_FullMethodName = "/tullo.internal.v1.InternalService/GetStreamStatus"
+	InternalService_ListLiveStreams_FullMethodName = "/tullo.internal.v1.InternalService/ListLiveStreams"
+)
+
+// InternalServiceClient is the client API for InternalService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InternalServiceClient interface {
+	// SendMessage posts a message on behalf of a user. The sender must be a
+	// member of the conversation and not muted or banned.
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*Message, error)
+	// CheckMembership reports whether a user belongs to a conversation, with
+	// their role and moderation state.
+	CheckMembership(ctx context.Context, in *CheckMembershipRequest, opts ...grpc.CallOption) (*Membership, error)
+	// GetStreamStatus returns the latest stream of a channel.
+	GetStreamStatus(ctx context.Context, in *GetStreamStatusRequest, opts ...grpc.CallOption) (*StreamStatus, error)
+	// ListLiveStreams returns streams that are currently live, newest first.
+	ListLiveStreams(ctx context.Context, in *ListLiveStreamsRequest, opts ...grpc.CallOption) (*ListLiveStreamsResponse, error)
+}
+
+type internalServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInternalServiceClient(cc grpc.ClientConnInterface) InternalServiceClient {
+	return &internalServiceClient{cc}
+}
+
+func (c *internalServiceClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*Message, error) {
+	out := new(Message)
+	err := c.cc.Invoke(ctx, InternalService_SendMessage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) CheckMembership(ctx context.Context, in *CheckMembershipRequest, opts ...grpc.CallOption) (*Membership, error) {
+	out := new(Membership)
+	err := c.cc.Invoke(ctx, InternalService_CheckMembership_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) GetStreamStatus(ctx context.Context, in *GetStreamStatusRequest, opts ...grpc.CallOption) (*StreamStatus, error) {
+	out := new(StreamStatus)
+	err := c.cc.Invoke(ctx, InternalService_GetStreamStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) ListLiveStreams(ctx context.Context, in *ListLiveStreamsRequest, opts ...grpc.CallOption) (*ListLiveStreamsResponse, error) {
+	out := new(ListLiveStreamsResponse)
+	err := c.cc.Invoke(ctx, InternalService_ListLiveStreams_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InternalServiceServer is the server API for InternalService service.
+// All implementations must embed UnimplementedInternalServiceServer
+// for forward compatibility
+type InternalServiceServer interface {
+	// SendMessage posts a message on behalf of a user. The sender must be a
+	// member of the conversation and not muted or banned.
+	SendMessage(context.Context, *SendMessageRequest) (*Message, error)
+	// CheckMembership reports whether a user belongs to a conversation, with
+	// their role and moderation state.
+	CheckMembership(context.Context, *CheckMembershipRequest) (*Membership, error)
+	// GetStreamStatus returns the latest stream of a channel.
+	GetStreamStatus(context.Context, *GetStreamStatusRequest) (*StreamStatus, error)
+	// ListLiveStreams returns streams that are currently live, newest first.
+	ListLiveStreams(context.Context, *ListLiveStreamsRequest) (*ListLiveStreamsResponse, error)
+	mustEmbedUnimplementedInternalServiceServer()
+}
+
+// UnimplementedInternalServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedInternalServiceServer struct {
+}
+
+func (UnimplementedInternalServiceServer) SendMessage(context.Context, *SendMessageRequest) (*Message, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedInternalServiceServer) CheckMembership(context.Context, *CheckMembershipRequest) (*Membership, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckMembership not implemented")
+}
+func (UnimplementedInternalServiceServer) GetStreamStatus(context.Context, *GetStreamStatusRequest) (*StreamStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStreamStatus not implemented")
+}
+func (UnimplementedInternalServiceServer) ListLiveStreams(context.Context, *ListLiveStreamsRequest) (*ListLiveStreamsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLiveStreams not implemented")
+}
+func (UnimplementedInternalServiceServer) mustEmbedUnimplementedInternalServiceServer() {}
+
+// UnsafeInternalServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InternalServiceServer will
+// result in compilation errors.
+type UnsafeInternalServiceServer interface {
+	mustEmbedUnimplementedInternalServiceServer()
+}
+
+func RegisterInternalServiceServer(s grpc.ServiceRegistrar, srv InternalServiceServer) {
+	s.RegisterService(&InternalService_ServiceDesc, srv)
+}
+
+func _InternalService_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_CheckMembership_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckMembershipRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).CheckMembership(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_CheckMembership_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).CheckMembership(ctx, req.(*CheckMembershipRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_GetStreamStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStreamStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).GetStreamStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_GetStreamStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).GetStreamStatus(ctx, req.(*GetStreamStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_ListLiveStreams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLiveStreamsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).ListLiveStreams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_ListLiveStreams_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).ListLiveStreams(ctx, req.(*ListLiveStreamsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// InternalService_ServiceDesc is the grpc.ServiceDesc for InternalService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var InternalService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tullo.internal.v1.InternalService",
+	HandlerType: (*InternalServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendMessage",
+			Handler:    _InternalService_SendMessage_Handler,
+		},
+		{
+			MethodName: "CheckMembership",
+			Handler:    _InternalService_CheckMembership_Handler,
+		},
+		{
+			MethodName: "GetStreamStatus",
+			Handler:    _InternalService_GetStreamStatus_Handler,
+		},
+		{
+			MethodName: "ListLiveStreams",
+			Handler:    _InternalService_ListLiveStreams_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "tullo/internal/v1/internal.proto",
+}
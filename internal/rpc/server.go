@@ -0,0 +1,201 @@
+// Package rpc serves the internal gRPC API (proto/tullo/internal/v1) used by
+// trusted backend services, so they don't go through the public REST+JWT path.
+// Regenerate internalv1 with `cd proto && buf generate`.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/tullo/backend/internal/authz"
+	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/preview"
+	"github.com/tullo/backend/internal/repository"
+	pb "github.com/tullo/backend/internal/rpc/internalv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxMessageLength mirrors the REST send message validation
+const maxMessageLength = 10000
+
+// Server implements InternalService on top of the repositories
+type Server struct {
+	pb.UnimplementedInternalServiceServer
+
+	convRepo    *repository.ConversationRepository
+	msgRepo     *repository.MessageRepository
+	channelRepo *repository.ChannelRepository
+	streamRepo  *repository.StreamRepository
+	redis       *cache.RedisClient
+	policy      *authz.Policy
+	previews    *preview.Service
+}
+
+func NewServer(convRepo *repository.ConversationRepository, msgRepo *repository.MessageRepository, chRepo *repository.ChannelRepository, streamRepo *repository.StreamRepository, redis *cache.RedisClient, policy *authz.Policy, previews *preview.Service) *Server {
+	return &Server{
+		convRepo:    convRepo,
+		msgRepo:     msgRepo,
+		channelRepo: chRepo,
+		streamRepo:  streamRepo,
+		redis:       redis,
+		policy:      policy,
+		previews:    previews,
+	}
+}
+
+// NewGRPCServer creates a gRPC server that requires token on every call and
+// registers s on it
+func NewGRPCServer(s *Server, token string) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(TokenAuthInterceptor(token)),
+	)
+	pb.RegisterInternalServiceServer(srv, s)
+	return srv
+}
+
+func (s *Server) SendMessage(ctx context.Context, req *pb.SendMessageRequest) (*pb.Message, error) {
+	convID, err := parseID("conversation_id", req.GetConversationId())
+	if err != nil {
+		return nil, err
+	}
+	senderID, err := parseID("sender_id", req.GetSenderId())
+	if err != nil {
+		return nil, err
+	}
+	body := req.GetBody()
+	if strings.TrimSpace(body) == "" || utf8.RuneCountInString(body) > maxMessageLength {
+		return nil, status.Errorf(codes.InvalidArgument, "body must be 1-%d characters", maxMessageLength)
+	}
+
+	switch _, err := s.policy.CanPost(convID, senderID); {
+	case errors.Is(err, authz.ErrNotMember):
+		return nil, status.Error(codes.PermissionDenied, "sender is not a member of this conversation")
+	case errors.Is(err, authz.ErrBanned), errors.Is(err, authz.ErrMuted):
+		return nil, status.Error(codes.PermissionDenied, "sender is muted or banned in this conversation")
+	case err != nil:
+		return nil, status.Error(codes.Internal, "failed to check membership")
+	}
+
+	now := time.Now()
+	message := &models.Message{
+		ID:             uuid.New(),
+		ConversationID: convID,
+		SenderID:       senderID,
+		Body:           body,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.msgRepo.Create(message); err != nil {
+		return nil, status.Error(codes.Internal, "failed to send message")
+	}
+
+	// Deliver to connected clients like a REST or WebSocket send would
+	if s.redis != nil {
+		s.redis.PublishMessage(models.WSMessage{Event: models.EventMessageNew, Payload: message})
+		s.redis.RecordChatMessage(convID, senderID)
+	}
+	s.previews.Enqueue(message)
+
+	return &pb.Message{
+		Id:             message.ID.String(),
+		ConversationId: message.ConversationID.String(),
+		SenderId:       message.SenderID.String(),
+		Body:           message.Body,
+		CreatedAt:      timestamppb.New(message.CreatedAt),
+	}, nil
+}
+
+func (s *Server) CheckMembership(ctx context.Context, req *pb.CheckMembershipRequest) (*pb.Membership, error) {
+	convID, err := parseID("conversation_id", req.GetConversationId())
+	if err != nil {
+		return nil, err
+	}
+	userID, err := parseID("user_id", req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	isMember, err := s.convRepo.IsMember(convID, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to check membership")
+	}
+	if !isMember {
+		return &pb.Membership{}, nil
+	}
+
+	role, err := s.convRepo.GetMemberRole(convID, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get member role")
+	}
+	muted, banned, err := s.convRepo.IsUserMutedOrBanned(convID, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to check moderation")
+	}
+
+	return &pb.Membership{IsMember: true, Role: role, Muted: muted, Banned: banned}, nil
+}
+
+func (s *Server) GetStreamStatus(ctx context.Context, req *pb.GetStreamStatusRequest) (*pb.StreamStatus, error) {
+	if req.GetChannelSlug() == "" {
+		return nil, status.Error(codes.InvalidArgument, "channel_slug is required")
+	}
+	ch, err := s.channelRepo.GetBySlug(req.GetChannelSlug())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "channel not found")
+	}
+
+	stream, err := s.streamRepo.GetByChannel(ch.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &pb.StreamStatus{ChannelId: ch.ID.String(), Status: "offline"}, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get stream")
+	}
+
+	return streamStatus(stream), nil
+}
+
+func (s *Server) ListLiveStreams(ctx context.Context, req *pb.ListLiveStreamsRequest) (*pb.ListLiveStreamsResponse, error) {
+	streams, err := s.streamRepo.GetActiveStreams(int(req.GetLimit()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list live streams")
+	}
+
+	out := &pb.ListLiveStreamsResponse{Streams: make([]*pb.StreamStatus, 0, len(streams))}
+	for i := range streams {
+		out.Streams = append(out.Streams, streamStatus(&streams[i]))
+	}
+	return out, nil
+}
+
+func streamStatus(st *models.Stream) *pb.StreamStatus {
+	out := &pb.StreamStatus{
+		ChannelId: st.ChannelID.String(),
+		StreamId:  st.ID.String(),
+		Status:    st.Status,
+	}
+	if st.StartedAt != nil {
+		out.StartedAt = timestamppb.New(*st.StartedAt)
+	}
+	if st.EndedAt != nil {
+		out.EndedAt = timestamppb.New(*st.EndedAt)
+	}
+	return out
+}
+
+func parseID(field, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid %s", field)
+	}
+	return id, nil
+}
@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	pb "github.com/tullo/backend/internal/rpc/internalv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves a Server without repositories, so only calls rejected
+// before touching the database can be exercised
+func newTestClient(t *testing.T, token string) pb.InternalServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewGRPCServer(&Server{}, token)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewInternalServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestRequiresToken(t *testing.T) {
+	client := newTestClient(t, "secret")
+
+	for name, ctx := range map[string]context.Context{
+		"missing": context.Background(),
+		"wrong":   withToken("nope"),
+	} {
+		_, err := client.CheckMembership(ctx, &pb.CheckMembershipRequest{})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s token: got %v, want Unauthenticated", name, err)
+		}
+	}
+}
+
+func TestEmptyTokenRejectsEverything(t *testing.T) {
+	client := newTestClient(t, "")
+	_, err := client.CheckMembership(withToken(""), &pb.CheckMembershipRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+}
+
+func TestInvalidArguments(t *testing.T) {
+	client := newTestClient(t, "secret")
+	ctx := withToken("secret")
+
+	_, err := client.SendMessage(ctx, &pb.SendMessageRequest{ConversationId: "not-a-uuid"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendMessage: got %v, want InvalidArgument", err)
+	}
+
+	_, err = client.SendMessage(ctx, &pb.SendMessageRequest{
+		ConversationId: "6f1c7f2e-8a59-4a43-9d1d-3b7a2c6a1e11",
+		SenderId:       "0b6a7c1e-2f41-4d9b-8a3e-5c2d1f0e9a77",
+		Body:           "   ",
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SendMessage with blank body: got %v, want InvalidArgument", err)
+	}
+
+	_, err = client.GetStreamStatus(ctx, &pb.GetStreamStatusRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetStreamStatus: got %v, want InvalidArgument", err)
+	}
+}
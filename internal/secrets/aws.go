@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// AWSConfig names a Secrets Manager secret whose SecretString is a JSON
+// object with one field per secret name
+type AWSConfig struct {
+	SecretID string
+	Region   string
+}
+
+// AWSProvider reads secrets from AWS Secrets Manager. Like cmd/backup it
+// shells out to the aws CLI, which handles credentials and regions.
+type AWSProvider struct {
+	cfg AWSConfig
+	// run executes the aws CLI; replaced in tests
+	run func(ctx context.Context, args ...string) ([]byte, error)
+}
+
+func NewAWSProvider(cfg AWSConfig) *AWSProvider {
+	return &AWSProvider{cfg: cfg, run: runAWS}
+}
+
+func runAWS(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "aws", args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("aws %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
+
+func (p *AWSProvider) Get(ctx context.Context, name string) (string, error) {
+	args := []string{"secretsmanager", "get-secret-value", "--secret-id", p.cfg.SecretID,
+		"--query", "SecretString", "--output", "text"}
+	if p.cfg.Region != "" {
+		args = append(args, "--region", p.cfg.Region)
+	}
+	out, err := p.run(ctx, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to get AWS secret: %w", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(out, &fields); err != nil {
+		return "", fmt.Errorf("AWS secret %s is not a JSON object: %w", p.cfg.SecretID, err)
+	}
+	v, ok := fields[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("AWS secret field %s is not a string", name)
+	}
+	return s, nil
+}
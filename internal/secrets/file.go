@@ -0,0 +1,27 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider reads each secret from a file named after it in Dir, such as
+// /run/secrets/jwt_secret. Trailing newlines are trimmed.
+type FileProvider struct {
+	Dir string
+}
+
+func (p FileProvider) Get(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,86 @@
+// Package secrets loads credentials from an external secret store instead of
+// plain environment variables, and notifies the server when they rotate.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Names of the secrets the server reads; each provider maps them to its own
+// storage (a file name, a Vault key, a field of the AWS secret)
+const (
+	JWTSecret     = "jwt_secret"
+	DBPassword    = "db_password"
+	RedisPassword = "redis_password"
+)
+
+// Names lists every secret the server reads
+var Names = []string{JWTSecret, DBPassword, RedisPassword}
+
+// ErrNotFound is returned when the store has no value for a secret
+var ErrNotFound = errors.New("secret not found")
+
+// Provider fetches the current value of a secret
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Provider names accepted by NewProvider
+const (
+	ProviderFile  = "file"
+	ProviderVault = "vault"
+	ProviderAWS   = "aws"
+)
+
+// Config selects and configures the provider
+type Config struct {
+	Provider string
+	// Dir holds one file per secret for the file provider (Docker and
+	// Kubernetes mount secrets this way)
+	Dir   string
+	Vault VaultConfig
+	AWS   AWSConfig
+}
+
+// NewProvider returns the Provider for cfg.Provider, or nil when no provider
+// is configured
+func NewProvider(cfg Config) (Provider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case ProviderFile:
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("a secrets directory is required for the file provider")
+		}
+		return FileProvider{Dir: cfg.Dir}, nil
+	case ProviderVault:
+		if cfg.Vault.Addr == "" || cfg.Vault.Path == "" {
+			return nil, fmt.Errorf("vault address and path are required for the vault provider")
+		}
+		return NewVaultProvider(cfg.Vault), nil
+	case ProviderAWS:
+		if cfg.AWS.SecretID == "" {
+			return nil, fmt.Errorf("a secret id is required for the aws provider")
+		}
+		return NewAWSProvider(cfg.AWS), nil
+	}
+	return nil, fmt.Errorf("unknown secrets provider %q", cfg.Provider)
+}
+
+// Load fetches every secret in names, skipping those the store doesn't have
+func Load(ctx context.Context, p Provider, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		v, err := p.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load secret %s: %w", name, err)
+		}
+		values[name] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, JWTSecret), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := FileProvider{Dir: dir}
+
+	v, err := p.Get(context.Background(), JWTSecret)
+	if err != nil || v != "s3cret" {
+		t.Fatalf("Get = %q, %v; want s3cret", v, err)
+	}
+	if _, err := p.Get(context.Background(), DBPassword); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing file: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/tullo/prod" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"jwt_secret":"from-vault"},"metadata":{"version":3}}}`))
+	}))
+	defer srv.Close()
+
+	p := NewVaultProvider(VaultConfig{Addr: srv.URL, Token: "root", Mount: "kv", Path: "tullo/prod"})
+	v, err := p.Get(context.Background(), JWTSecret)
+	if err != nil || v != "from-vault" {
+		t.Fatalf("Get = %q, %v; want from-vault", v, err)
+	}
+	if _, err := p.Get(context.Background(), RedisPassword); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing key: err = %v, want ErrNotFound", err)
+	}
+
+	bad := NewVaultProvider(VaultConfig{Addr: srv.URL, Token: "wrong", Mount: "kv", Path: "tullo/prod"})
+	if _, err := bad.Get(context.Background(), JWTSecret); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("bad token: err = %v, want a non-NotFound error", err)
+	}
+}
+
+func TestAWSProvider(t *testing.T) {
+	p := NewAWSProvider(AWSConfig{SecretID: "tullo/prod", Region: "eu-west-1"})
+	var gotArgs []string
+	p.run = func(ctx context.Context, args ...string) ([]byte, error) {
+		gotArgs = args
+		return []byte(`{"db_password":"from-aws"}` + "\n"), nil
+	}
+
+	v, err := p.Get(context.Background(), DBPassword)
+	if err != nil || v != "from-aws" {
+		t.Fatalf("Get = %q, %v; want from-aws", v, err)
+	}
+	if gotArgs[len(gotArgs)-1] != "eu-west-1" {
+		t.Errorf("region not passed: %v", gotArgs)
+	}
+	if _, err := p.Get(context.Background(), JWTSecret); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing field: err = %v, want ErrNotFound", err)
+	}
+}
+
+type mapProvider map[string]string
+
+func (m mapProvider) Get(ctx context.Context, name string) (string, error) {
+	v, ok := m[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func TestWatcher(t *testing.T) {
+	store := mapProvider{JWTSecret: "v1", DBPassword: "pw1"}
+	values, err := Load(context.Background(), store, Names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 {
+		t.Fatalf("Load = %v, want the two stored secrets", values)
+	}
+
+	w := NewWatcher(store, values)
+	var rotated []string
+	w.OnChange(JWTSecret, func(v string) { rotated = append(rotated, "jwt:"+v) })
+	w.OnChange(DBPassword, func(v string) { rotated = append(rotated, "db:"+v) })
+
+	w.Refresh(context.Background())
+	if len(rotated) != 0 {
+		t.Fatalf("unchanged secrets ran hooks: %v", rotated)
+	}
+
+	store[JWTSecret] = "v2"
+	w.Refresh(context.Background())
+	if len(rotated) != 1 || rotated[0] != "jwt:v2" {
+		t.Fatalf("rotated = %v, want [jwt:v2]", rotated)
+	}
+
+	// A secret that disappears keeps its current value
+	delete(store, DBPassword)
+	w.Refresh(context.Background())
+	if len(rotated) != 1 {
+		t.Fatalf("failed fetch ran hooks: %v", rotated)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if p, err := NewProvider(Config{}); p != nil || err != nil {
+		t.Errorf("empty provider = %v, %v; want nil, nil", p, err)
+	}
+	for _, cfg := range []Config{
+		{Provider: ProviderVault},
+		{Provider: ProviderAWS},
+		{Provider: "keychain"},
+	} {
+		if _, err := NewProvider(cfg); err == nil {
+			t.Errorf("NewProvider(%+v) should fail", cfg)
+		}
+	}
+}
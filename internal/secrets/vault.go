@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultConfig points at a KV version 2 secret holding one key per secret name
+type VaultConfig struct {
+	Addr  string
+	Token string
+	// Mount is the KV engine mount, "secret" by default
+	Mount string
+	// Path is the secret path within the mount, e.g. "tullo/prod"
+	Path string
+}
+
+// VaultProvider reads secrets from HashiCorp Vault over its HTTP API
+type VaultProvider struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+func NewVaultProvider(cfg VaultConfig) *VaultProvider {
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	return &VaultProvider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(p.cfg.Addr, "/"), strings.Trim(p.cfg.Mount, "/"), strings.Trim(p.cfg.Path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.cfg.Token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	v, ok := out.Data.Data[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("vault key %s is not a string", name)
+	}
+	return s, nil
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Watcher polls a provider and calls the hooks registered for a secret when
+// its value changes, so credentials can rotate without a restart
+type Watcher struct {
+	provider Provider
+
+	mu     sync.Mutex
+	values map[string]string
+	hooks  map[string][]func(value string)
+}
+
+// NewWatcher watches the secrets in initial, whose values are the ones
+// currently in use
+func NewWatcher(p Provider, initial map[string]string) *Watcher {
+	values := make(map[string]string, len(initial))
+	for k, v := range initial {
+		values[k] = v
+	}
+	return &Watcher{provider: p, values: values, hooks: map[string][]func(string){}}
+}
+
+// OnChange registers fn to be called with the new value of name. Hooks for
+// secrets that were not in the initial set are never called.
+func (w *Watcher) OnChange(name string, fn func(value string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hooks[name] = append(w.hooks[name], fn)
+}
+
+// Run refreshes on the given interval until the process exits
+func (w *Watcher) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		w.Refresh(context.Background())
+	}
+}
+
+// Refresh fetches every watched secret once and runs the hooks of those that
+// changed. A failed fetch keeps the current value.
+func (w *Watcher) Refresh(ctx context.Context) {
+	w.mu.Lock()
+	names := make([]string, 0, len(w.values))
+	for name := range w.values {
+		names = append(names, name)
+	}
+	w.mu.Unlock()
+
+	for _, name := range names {
+		v, err := w.provider.Get(ctx, name)
+		if err != nil {
+			log.Printf("Secret refresh of %s failed: %v", name, err)
+			continue
+		}
+
+		w.mu.Lock()
+		changed := v != w.values[name]
+		w.values[name] = v
+		hooks := w.hooks[name]
+		w.mu.Unlock()
+
+		if changed {
+			log.Printf("Secret %s rotated", name)
+			for _, fn := range hooks {
+				fn(v)
+			}
+		}
+	}
+}
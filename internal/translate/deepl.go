@@ -0,0 +1,74 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DeepL API endpoints; keys of free accounts end in ":fx" and only work
+// against the free one
+const (
+	deeplEndpoint     = "https://api.deepl.com/v2/translate"
+	deeplFreeEndpoint = "https://api-free.deepl.com/v2/translate"
+)
+
+type deepl struct {
+	key      string
+	endpoint string
+	client   *http.Client
+}
+
+func newDeepL(key, endpoint string, client *http.Client) *deepl {
+	if endpoint == "" {
+		endpoint = deeplEndpoint
+		if strings.HasSuffix(key, ":fx") {
+			endpoint = deeplFreeEndpoint
+		}
+	}
+	return &deepl{key: key, endpoint: endpoint, client: client}
+}
+
+func (d *deepl) Translate(ctx context.Context, text, target string) (Result, error) {
+	body, _ := json.Marshal(map[string]any{
+		"text":        []string{text},
+		"target_lang": strings.ToUpper(target),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+d.key)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("deepl translation failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		// DeepL answers unknown target languages with 400
+		return Result{}, ErrUnsupportedLanguage
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, &apiError{provider: ProviderDeepL, status: resp.StatusCode}
+	}
+
+	var out struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, fmt.Errorf("failed to decode deepl response: %w", err)
+	}
+	if len(out.Translations) == 0 {
+		return Result{}, fmt.Errorf("deepl returned no translation")
+	}
+	t := out.Translations[0]
+	return Result{Text: t.Text, Source: strings.ToLower(t.DetectedSourceLanguage)}, nil
+}
@@ -0,0 +1,77 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// googleEndpoint is the Cloud Translation basic (v2) API
+const googleEndpoint = "https://translation.googleapis.com/language/translate/v2"
+
+type google struct {
+	key      string
+	endpoint string
+	client   *http.Client
+}
+
+func newGoogle(key, endpoint string, client *http.Client) *google {
+	if endpoint == "" {
+		endpoint = googleEndpoint
+	}
+	return &google{key: key, endpoint: endpoint, client: client}
+}
+
+func (g *google) Translate(ctx context.Context, text, target string) (Result, error) {
+	body, _ := json.Marshal(map[string]string{
+		"q":      text,
+		"target": target,
+		"format": "text",
+	})
+	u := g.endpoint + "?key=" + url.QueryEscape(g.key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		// The URL carries the key; keep it out of the error
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return Result{}, fmt.Errorf("google translation failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		// Google answers unknown target languages with 400
+		return Result{}, ErrUnsupportedLanguage
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, &apiError{provider: ProviderGoogle, status: resp.StatusCode}
+	}
+
+	var out struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText         string `json:"translatedText"`
+				DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, fmt.Errorf("failed to decode google response: %w", err)
+	}
+	if len(out.Data.Translations) == 0 {
+		return Result{}, fmt.Errorf("google returned no translation")
+	}
+	t := out.Data.Translations[0]
+	return Result{Text: t.TranslatedText, Source: strings.ToLower(t.DetectedSourceLanguage)}, nil
+}
@@ -0,0 +1,85 @@
+// Package translate translates chat messages through a pluggable Provider:
+// DeepL or Google Cloud Translation. Callers cache the results, so each
+// message is sent to the provider at most once per language.
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Provider names accepted by NewProvider
+const (
+	ProviderDeepL  = "deepl"
+	ProviderGoogle = "google"
+)
+
+// ErrUnsupportedLanguage is returned for target languages the provider
+// does not translate into
+var ErrUnsupportedLanguage = errors.New("unsupported target language")
+
+// Result is a translated text
+type Result struct {
+	Text string
+	// Source is the language the provider detected in the original, lower
+	// case; empty if it did not say
+	Source string
+}
+
+// Provider translates text into the target language, a lower case language
+// tag such as "de" or "pt-br" (see NormalizeLanguage)
+type Provider interface {
+	Translate(ctx context.Context, text, target string) (Result, error)
+}
+
+// Config selects and configures the provider
+type Config struct {
+	Provider string
+	APIKey   string
+	// Endpoint overrides the provider's API URL, e.g. for a proxy or tests
+	Endpoint string
+	Timeout  time.Duration
+}
+
+// NewProvider returns the Provider for cfg.Provider, or nil when
+// cfg.Provider is empty and translation is off
+func NewProvider(cfg Config) (Provider, error) {
+	if cfg.Provider == "" {
+		return nil, nil
+	}
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("an API key is required for the %s translation provider", cfg.Provider)
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	switch cfg.Provider {
+	case ProviderDeepL:
+		return newDeepL(cfg.APIKey, cfg.Endpoint, client), nil
+	case ProviderGoogle:
+		return newGoogle(cfg.APIKey, cfg.Endpoint, client), nil
+	}
+	return nil, fmt.Errorf("unknown translation provider %q", cfg.Provider)
+}
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,4})?$`)
+
+// NormalizeLanguage lower-cases a language tag such as "pt-BR" or "de" and
+// reports whether it is well-formed
+func NormalizeLanguage(tag string) (string, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	return tag, languagePattern.MatchString(tag)
+}
+
+// apiError is a failed provider request
+type apiError struct {
+	provider string
+	status   int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s translation failed with status %d", e.provider, e.status)
+}
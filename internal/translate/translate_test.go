@@ -0,0 +1,119 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"de", "de", true},
+		{"pt-BR", "pt-br", true},
+		{"zh_Hant", "zh-hant", true},
+		{" EN ", "en", true},
+		{"english", "english", false},
+		{"", "", false},
+		{"de;DROP", "de;drop", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeLanguage(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizeLanguage(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if p, err := NewProvider(Config{}); p != nil || err != nil {
+		t.Errorf("NewProvider without a provider = %v, %v; want nil, nil", p, err)
+	}
+	if _, err := NewProvider(Config{Provider: ProviderDeepL}); err == nil {
+		t.Error("NewProvider without an API key succeeded")
+	}
+	if _, err := NewProvider(Config{Provider: "babelfish", APIKey: "k"}); err == nil {
+		t.Error("NewProvider with an unknown provider succeeded")
+	}
+	if d := newDeepL("abc:fx", "", nil); d.endpoint != deeplFreeEndpoint {
+		t.Errorf("free DeepL key uses %s", d.endpoint)
+	}
+}
+
+func TestDeepL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "DeepL-Auth-Key secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var in struct {
+			Text       []string `json:"text"`
+			TargetLang string   `json:"target_lang"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		if in.TargetLang == "XX" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"translations": []map[string]string{
+			{"detected_source_language": "EN", "text": in.TargetLang + ": " + in.Text[0]},
+		}})
+	}))
+	defer srv.Close()
+
+	p, err := NewProvider(Config{Provider: ProviderDeepL, APIKey: "secret", Endpoint: srv.URL, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.Translate(context.Background(), "hello", "pt-br")
+	if err != nil || res.Text != "PT-BR: hello" || res.Source != "en" {
+		t.Errorf("Translate = %+v, %v", res, err)
+	}
+	if _, err := p.Translate(context.Background(), "hello", "xx"); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("Translate to xx = %v, want ErrUnsupportedLanguage", err)
+	}
+
+	bad, _ := NewProvider(Config{Provider: ProviderDeepL, APIKey: "wrong", Endpoint: srv.URL, Timeout: time.Second})
+	if _, err := bad.Translate(context.Background(), "hello", "de"); err == nil {
+		t.Error("Translate with a wrong key succeeded")
+	}
+}
+
+func TestGoogle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var in struct {
+			Q      string `json:"q"`
+			Target string `json:"target"`
+			Format string `json:"format"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		if in.Format != "text" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"translations": []map[string]string{
+			{"translatedText": in.Target + ": " + in.Q, "detectedSourceLanguage": "en"},
+		}}})
+	}))
+	defer srv.Close()
+
+	p, err := NewProvider(Config{Provider: ProviderGoogle, APIKey: "secret", Endpoint: srv.URL, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.Translate(context.Background(), "fish & chips", "de")
+	if err != nil || res.Text != "de: fish & chips" || res.Source != "en" {
+		t.Errorf("Translate = %+v, %v", res, err)
+	}
+}
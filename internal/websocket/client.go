@@ -2,13 +2,19 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/tullo/backend/internal/apierror"
+	"github.com/tullo/backend/internal/authz"
 	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/middleware"
 	"github.com/tullo/backend/internal/models"
+	"github.com/tullo/backend/internal/preview"
+	"github.com/tullo/backend/internal/ratelimit"
 	"github.com/tullo/backend/internal/repository"
 )
 
@@ -24,6 +30,12 @@ const (
 
 	// Maximum message size allowed from peer
 	maxMessageSize = 10240 // 10KB
+
+	// Maximum channel chats one connection can have open
+	maxOpenChats = 20
+
+	// Maximum conversations one connection can get typing events of
+	maxTypingSubs = 5
 )
 
 // Client represents a WebSocket client
@@ -34,16 +46,43 @@ type Client struct {
 	userID      uuid.UUID
 	email       string
 	connectedAt time.Time
+	// done is closed when the hub drops the client; send is never closed,
+	// as ReadPump may still be queueing replies
+	done chan struct{}
+	// sessionID is the login session the token was issued for, if any
+	sessionID uuid.UUID
+	// protocol is the WebSocket protocol version negotiated at connect
+	protocol int
+	// guest connections, made with a guest token, may only open channel
+	// chats to read them
+	guest bool
+	// chats maps the channels whose chat is open to their conversations,
+	// touched only by ReadPump
+	chats map[uuid.UUID]uuid.UUID
+	// typing holds the conversations subscribed to with typing.subscribe,
+	// touched only by ReadPump
+	typing map[uuid.UUID]struct{}
+	// resumeToken names this connection's subscriptions once it closes, for
+	// resumeWindow; resumeFrom is the token it was opened with, if any
+	resumeToken  string
+	resumeWindow time.Duration
+	resumeFrom   string
 
 	// Repositories
-	msgRepo  *repository.MessageRepository
-	convRepo *repository.ConversationRepository
-	redis    *cache.RedisClient
-	// simple token-bucket rate limiter
-	tokens       int
-	maxTokens    int
-	refillPeriod time.Duration
-	lastRefill   time.Time
+	msgRepo     *repository.MessageRepository
+	convRepo    *repository.ConversationRepository
+	channelRepo *repository.ChannelRepository
+	redis       *cache.RedisClient
+	// sends limits messages per conversation, shared with the REST API
+	sends *middleware.SendLimiter
+	// policy decides who may post, shared with the REST API
+	policy *authz.Policy
+	// previews fetches link previews of sent messages, nil when disabled
+	previews *preview.Service
+	// frames limits the frames read from the peer by framePolicy; each
+	// connection has its own bucket
+	frames      ratelimit.Limiter
+	framePolicy ratelimit.Policy
 }
 
 // NewClient creates a new WebSocket client
@@ -54,28 +93,39 @@ func NewClient(
 	email string,
 	msgRepo *repository.MessageRepository,
 	convRepo *repository.ConversationRepository,
+	channelRepo *repository.ChannelRepository,
 	redis *cache.RedisClient,
+	protocol int,
 ) *Client {
 	return &Client{
-		hub:          hub,
-		conn:         conn,
-		send:         make(chan []byte, 256),
-		userID:       userID,
-		email:        email,
-		connectedAt:  time.Now(),
-		msgRepo:      msgRepo,
-		convRepo:     convRepo,
-		redis:        redis,
-		tokens:       20,
-		maxTokens:    20,
-		refillPeriod: time.Second,
-		lastRefill:   time.Now(),
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		done:        make(chan struct{}),
+		userID:      userID,
+		email:       email,
+		connectedAt: time.Now(),
+		protocol:    protocol,
+		chats:       make(map[uuid.UUID]uuid.UUID),
+		msgRepo:     msgRepo,
+		convRepo:    convRepo,
+		channelRepo: channelRepo,
+		redis:       redis,
+		frames:      ratelimit.New(nil, ""),
 	}
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
 func (c *Client) ReadPump() {
 	defer func() {
+		c.saveResume()
+		// Leave chats before unregistering, which closes c.done
+		for channelID, convID := range c.chats {
+			c.hub.leaveChat(channelID, convID, c)
+		}
+		if c.typing != nil {
+			c.hub.forgetTyping(c, c.typing)
+		}
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
@@ -87,6 +137,10 @@ func (c *Client) ReadPump() {
 		return nil
 	})
 
+	if c.resumeToken != "" {
+		c.sendEvent(models.WSMessage{Event: models.EventReady, Payload: c.resume(c.resumeFrom)})
+	}
+
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
@@ -96,25 +150,10 @@ func (c *Client) ReadPump() {
 			break
 		}
 
-		// Rate limit: simple token bucket (in-memory). If Redis present, you may implement a global limiter.
-		now := time.Now()
-		elapsed := now.Sub(c.lastRefill)
-		if elapsed >= c.refillPeriod {
-			// add tokens proportional to elapsed seconds
-			add := int(elapsed / c.refillPeriod)
-			c.tokens += add
-			if c.tokens > c.maxTokens {
-				c.tokens = c.maxTokens
-			}
-			c.lastRefill = now
-		}
-
-		if c.tokens <= 0 {
-			// drop the message and optionally send a rate limit error
+		if !c.frames.Allow("frames", c.framePolicy).Allowed {
 			c.sendError("rate_limited")
 			continue
 		}
-		c.tokens--
 
 		// Handle incoming message
 		c.handleMessage(message)
@@ -131,14 +170,8 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
+		case message := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
 			w, err := c.conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
@@ -156,6 +189,17 @@ func (c *Client) WritePump() {
 				return
 			}
 
+		case <-c.done:
+			// The hub dropped the client; write what was queued until then
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			for n := len(c.send); n > 0; n-- {
+				if err := c.conn.WriteMessage(websocket.TextMessage, <-c.send); err != nil {
+					return
+				}
+			}
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -167,12 +211,17 @@ func (c *Client) WritePump() {
 
 // handleMessage handles incoming WebSocket messages
 func (c *Client) handleMessage(data []byte) {
-	var wsMsg models.WSMessage
-	if err := json.Unmarshal(data, &wsMsg); err != nil {
+	wsMsg, err := decodeEvent(data, c.protocol)
+	if err != nil {
 		c.sendError("Invalid message format")
 		return
 	}
 
+	if c.guest && wsMsg.Event != models.EventChatJoin && wsMsg.Event != models.EventChatLeave {
+		c.sendErrorCode(apierror.Forbidden, "Sign up or log in to do this")
+		return
+	}
+
 	switch wsMsg.Event {
 	case models.EventMessageSend:
 		c.handleMessageSend(wsMsg.Payload)
@@ -186,6 +235,18 @@ func (c *Client) handleMessage(data []byte) {
 	case models.EventTypingStop:
 		c.handleTypingStop(wsMsg.Payload)
 
+	case models.EventTypingSubscribe:
+		c.handleTypingSubscribe(wsMsg.Payload)
+
+	case models.EventTypingUnsubscribe:
+		c.handleTypingUnsubscribe(wsMsg.Payload)
+
+	case models.EventChatJoin:
+		c.handleChatJoin(wsMsg.Payload)
+
+	case models.EventChatLeave:
+		c.handleChatLeave(wsMsg.Payload)
+
 	default:
 		c.sendError("Unknown event type")
 	}
@@ -200,11 +261,35 @@ func (c *Client) handleMessageSend(payload interface{}) {
 		return
 	}
 
-	// Check if user is a member of the conversation
-	isMember, err := c.convRepo.IsMember(req.ConversationID, c.userID)
-	if err != nil || !isMember {
+	kind, err := c.policy.CanPost(req.ConversationID, c.userID)
+	switch {
+	case errors.Is(err, authz.ErrNotMember):
 		c.sendError("Access denied")
 		return
+	case errors.Is(err, authz.ErrBanned):
+		c.sendErrorCode(apierror.Banned, "You are banned from this chat")
+		return
+	case errors.Is(err, authz.ErrMuted):
+		c.sendErrorCode(apierror.Muted, "You are muted in this chat")
+		return
+	case err != nil:
+		c.sendError("Failed to send message")
+		return
+	}
+	switch req.Kind {
+	case "", models.MessageText:
+	case models.MessageEncrypted:
+		if kind != models.ConversationDirect {
+			c.sendError("Encrypted messages are only allowed in direct conversations")
+			return
+		}
+	default:
+		c.sendError("Invalid message kind")
+		return
+	}
+	if !c.sends.Allow(kind, req.ConversationID, c.userID).Allowed {
+		c.sendError("rate_limited")
+		return
 	}
 
 	// Create message
@@ -213,11 +298,17 @@ func (c *Client) handleMessageSend(payload interface{}) {
 		ConversationID: req.ConversationID,
 		SenderID:       c.userID,
 		Body:           req.Body,
+		Kind:           req.Kind,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
 
 	if err := c.msgRepo.Create(message); err != nil {
+		var limit *repository.ChatLimitError
+		if errors.As(err, &limit) {
+			c.sendErrorCode(limit.Reason())
+			return
+		}
 		c.sendError("Failed to send message")
 		return
 	}
@@ -227,33 +318,63 @@ func (c *Client) handleMessageSend(payload interface{}) {
 		Event:   models.EventMessageNew,
 		Payload: message,
 	})
+	c.redis.RecordChatMessage(message.ConversationID, c.userID)
+	c.previews.Enqueue(message)
 }
 
 // handleMessageRead handles marking a message as read
 func (c *Client) handleMessageRead(payload interface{}) {
 	data, _ := json.Marshal(payload)
 	var req models.WSMessageReadPayload
-	if err := json.Unmarshal(data, &req); err != nil {
+	if err := json.Unmarshal(data, &req); err != nil || req.MessageID == uuid.Nil {
 		c.sendError("Invalid read payload")
 		return
 	}
 
-	// Mark message as read
-	if err := c.msgRepo.MarkAsRead(req.MessageID, c.userID); err != nil {
+	// Only members may read the message, as on the REST API
+	message, err := c.msgRepo.GetByID(req.MessageID)
+	if err != nil {
+		c.sendErrorCode(apierror.MessageNotFound, "Message not found")
+		return
+	}
+	isMember, err := c.convRepo.IsMember(message.ConversationID, c.userID)
+	if err != nil || !isMember {
+		c.sendErrorCode(apierror.NotMember, "Not a member of this conversation")
+		return
+	}
+
+	// Mark message as read, along with everything before it. Nothing moves
+	// when the marker already is past the message.
+	marker, err := c.msgRepo.AdvanceReadMarker(req.MessageID, c.userID)
+	if err != nil {
 		c.sendError("Failed to mark message as read")
 		return
 	}
+	if marker == nil {
+		return
+	}
 
 	// Publish read receipt
 	c.redis.PublishMessage(models.WSMessage{
 		Event: models.EventMessageRead,
 		Payload: map[string]interface{}{
 			"message_id":      req.MessageID,
-			"conversation_id": req.ConversationID,
+			"conversation_id": marker.ConversationID,
 			"user_id":         c.userID,
-			"read_at":         time.Now(),
+			"read_at":         marker.ReadAt,
 		},
 	})
+
+	// Sync the marker to the user's other devices
+	unread, err := c.msgRepo.GetUnreadCount(marker.ConversationID, c.userID)
+	if err != nil {
+		log.Printf("Failed to count unread messages for read marker: %v", err)
+		return
+	}
+	c.redis.PublishMessage(models.WSMessage{
+		Event:   models.EventReadMarker,
+		Payload: models.WSReadMarkerPayload{ReadMarker: *marker, UnreadCount: unread},
+	})
 }
 
 // handleTypingStart handles typing start event
@@ -302,18 +423,183 @@ func (c *Client) handleTypingStop(payload interface{}) {
 	})
 }
 
+// handleTypingSubscribe starts the typing events of a conversation the
+// client has open, beginning with a typing.start for everyone typing now.
+// Once a connection subscribed, it gets no typing events of other
+// conversations.
+func (c *Client) handleTypingSubscribe(payload interface{}) {
+	data, _ := json.Marshal(payload)
+	var req models.WSTypingPayload
+	if err := json.Unmarshal(data, &req); err != nil || req.ConversationID == uuid.Nil {
+		c.sendError("Invalid typing payload")
+		return
+	}
+	if _, ok := c.typing[req.ConversationID]; ok {
+		return
+	}
+	if len(c.typing) >= maxTypingSubs {
+		c.sendError("Too many typing subscriptions")
+		return
+	}
+	isMember, err := c.convRepo.IsMember(req.ConversationID, c.userID)
+	if err != nil || !isMember {
+		c.sendError("Access denied")
+		return
+	}
+
+	if c.typing == nil {
+		c.typing = make(map[uuid.UUID]struct{})
+	}
+	c.typing[req.ConversationID] = struct{}{}
+	c.hub.subscribeTyping(req.ConversationID, c)
+
+	typers, err := c.redis.GetTypingUsers(req.ConversationID)
+	if err != nil {
+		return
+	}
+	for _, userID := range typers {
+		if userID == c.userID {
+			continue
+		}
+		raw, _ := json.Marshal(models.TypingIndicator{ConversationID: req.ConversationID, UserID: userID, IsTyping: true})
+		f := legacyFrame(models.WSMessage{Event: models.EventTypingStart, Payload: json.RawMessage(raw)}, raw)
+		if data, err := f.bytes(c.protocol); err == nil {
+			c.queue(data)
+		}
+	}
+}
+
+// handleTypingUnsubscribe ends a typing.subscribe, typically when the user
+// switches to another conversation
+func (c *Client) handleTypingUnsubscribe(payload interface{}) {
+	data, _ := json.Marshal(payload)
+	var req models.WSTypingPayload
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.sendError("Invalid typing payload")
+		return
+	}
+	if _, ok := c.typing[req.ConversationID]; !ok {
+		return
+	}
+	delete(c.typing, req.ConversationID)
+	c.hub.unsubscribeTyping(req.ConversationID, c)
+}
+
+// handleChatJoin opens a channel's chat: the user counts as a chat viewer
+// and receives chat.viewers updates, starting with the current count, and
+// the chat's messages even without being a member. Users banned from the
+// chat are turned away, as on GET /channels/:slug/chat.
+func (c *Client) handleChatJoin(payload interface{}) {
+	data, _ := json.Marshal(payload)
+	var req models.WSChatPayload
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.sendError("Invalid chat payload")
+		return
+	}
+	if convID, open := c.chats[req.ChannelID]; open {
+		if c.hub.hasChatOpen(convID, c) {
+			return
+		}
+		// Closed by banFromChat
+		delete(c.chats, req.ChannelID)
+	}
+	if len(c.chats) >= maxOpenChats {
+		c.sendError("Too many open chats")
+		return
+	}
+
+	channels, err := c.channelRepo.GetByIDs([]uuid.UUID{req.ChannelID})
+	if err != nil || len(channels) == 0 {
+		c.sendError("Channel not found")
+		return
+	}
+
+	convID, err := c.channelRepo.GetOrCreateConversation(req.ChannelID)
+	if err != nil {
+		c.sendError("Failed to join chat")
+		return
+	}
+	switch err := c.policy.CanViewChat(convID, c.userID); {
+	case errors.Is(err, authz.ErrBanned):
+		c.sendErrorCode(apierror.Banned, "You are banned from this chat")
+		return
+	case err != nil:
+		c.sendError("Failed to join chat")
+		return
+	}
+	n, err := c.hub.joinChat(req.ChannelID, convID, c)
+	if err != nil {
+		c.sendError("Failed to join chat")
+		return
+	}
+	c.chats[req.ChannelID] = convID
+
+	c.sendEvent(models.WSMessage{
+		Event:   models.EventChatViewers,
+		Payload: models.WSChatViewersPayload{ChannelID: req.ChannelID, ChatViewers: n},
+	})
+}
+
+// handleChatLeave closes a channel's chat opened with chat.join
+func (c *Client) handleChatLeave(payload interface{}) {
+	data, _ := json.Marshal(payload)
+	var req models.WSChatPayload
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.sendError("Invalid chat payload")
+		return
+	}
+	convID, open := c.chats[req.ChannelID]
+	if !open {
+		return
+	}
+	delete(c.chats, req.ChannelID)
+	c.hub.leaveChat(req.ChannelID, convID, c)
+}
+
 // sendError sends an error message to the client
 func (c *Client) sendError(message string) {
-	errorMsg := models.WSMessage{
+	c.sendEvent(models.WSMessage{
+		Event: models.EventError,
+		Payload: models.WSErrorPayload{
+			Message: message,
+		},
+	})
+}
+
+// sendErrorCode sends an error with one of the REST API's error codes, so
+// clients can handle it the same way on both
+func (c *Client) sendErrorCode(code apierror.Code, message string) {
+	c.sendEvent(models.WSMessage{
 		Event: models.EventError,
 		Payload: models.WSErrorPayload{
 			Message: message,
+			Code:    string(code),
 		},
+	})
+}
+
+// sendEvent queues an event for this client only, dropping it if the send
+// buffer is full
+func (c *Client) sendEvent(msg models.WSMessage) {
+	data, err := encodeEvent(msg, c.protocol)
+	if err != nil {
+		return
 	}
+	c.queue(data)
+}
 
-	data, _ := json.Marshal(errorMsg)
+// queue adds data to the send buffer without blocking. It reports false if
+// the buffer is full or the hub has dropped the client.
+func (c *Client) queue(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
 	select {
 	case c.send <- data:
+		return true
 	default:
+		return false
 	}
 }
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/models"
+)
+
+var (
+	fanoutQueueDepth = metrics.Default.NewGaugeVec(
+		"tullo_ws_fanout_queue_depth",
+		"Conversation events waiting for a fan-out worker.",
+	)
+	fanoutFull = metrics.Default.NewCounterVec(
+		"tullo_ws_fanout_queue_full_total",
+		"Conversation events that waited for room in a full fan-out queue, holding up the Redis subscriber.",
+	)
+	fanoutLatency = metrics.Default.NewHistogramVec(
+		"tullo_ws_fanout_seconds",
+		"Time from receiving a conversation event from Redis to handing it to the members' connections.",
+		metrics.DefaultBuckets,
+	)
+)
+
+// fanoutJob is a conversation-scoped event waiting for delivery
+type fanoutJob struct {
+	conversationID uuid.UUID
+	msg            models.WSMessage
+	received       time.Time
+}
+
+// fanout delivers conversation-scoped events off the Redis subscriber loop,
+// so a slow member lookup no longer holds up every other event. Events are
+// sharded by conversation over a fixed set of workers: each conversation's
+// events are delivered in the order received, and a slow conversation only
+// delays the ones sharing its worker. When a worker's queue is full, submit
+// waits, pushing back on the subscriber rather than dropping events.
+type fanout struct {
+	queues  []chan fanoutJob
+	deliver func(conversationID uuid.UUID, msg models.WSMessage)
+}
+
+// newFanout creates a pool of workers, each queueing up to queueSize events,
+// that hand events to deliver. Call start before submitting.
+func newFanout(workers, queueSize int, deliver func(conversationID uuid.UUID, msg models.WSMessage)) *fanout {
+	if workers < 1 {
+		workers = 1
+	}
+	f := &fanout{queues: make([]chan fanoutJob, workers), deliver: deliver}
+	for i := range f.queues {
+		f.queues[i] = make(chan fanoutJob, queueSize)
+	}
+	return f
+}
+
+func (f *fanout) start() {
+	for _, q := range f.queues {
+		go f.work(q)
+	}
+}
+
+func (f *fanout) work(q chan fanoutJob) {
+	for job := range q {
+		fanoutQueueDepth.Add(-1)
+		f.deliver(job.conversationID, job.msg)
+		fanoutLatency.Observe(time.Since(job.received).Seconds())
+	}
+}
+
+// queue returns the worker queue that carries conversationID's events
+func (f *fanout) queue(conversationID uuid.UUID) chan fanoutJob {
+	h := fnv.New32a()
+	h.Write(conversationID[:])
+	return f.queues[h.Sum32()%uint32(len(f.queues))]
+}
+
+// submit queues msg for the members of conversationID
+func (f *fanout) submit(conversationID uuid.UUID, msg models.WSMessage) {
+	q := f.queue(conversationID)
+	job := fanoutJob{conversationID: conversationID, msg: msg, received: time.Now()}
+	fanoutQueueDepth.Add(1)
+	select {
+	case q <- job:
+	default:
+		fanoutFull.Inc()
+		q <- job
+	}
+}
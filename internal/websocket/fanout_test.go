@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestFanoutOrderAndIsolation(t *testing.T) {
+	type delivery struct {
+		conv uuid.UUID
+		seq  int
+	}
+	delivered := make(chan delivery, 16)
+	release := make(chan struct{})
+
+	slow, fast := uuid.New(), uuid.New()
+	f := newFanout(2, 8, func(conv uuid.UUID, msg models.WSMessage) {
+		if conv == slow {
+			<-release
+		}
+		delivered <- delivery{conv, msg.Payload.(int)}
+	})
+	// Put the two conversations on different workers
+	for f.queue(fast) == f.queue(slow) {
+		fast = uuid.New()
+	}
+	f.start()
+
+	for i := 0; i < 3; i++ {
+		f.submit(slow, models.WSMessage{Event: models.EventMessageNew, Payload: i})
+	}
+	for i := 0; i < 3; i++ {
+		f.submit(fast, models.WSMessage{Event: models.EventMessageNew, Payload: i})
+	}
+
+	// A stuck conversation doesn't hold up the other worker
+	for i := 0; i < 3; i++ {
+		select {
+		case d := <-delivered:
+			if d.conv != fast || d.seq != i {
+				t.Fatalf("delivery %d = %+v, want fast conversation in order", i, d)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("fast conversation stalled behind the slow one")
+		}
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		select {
+		case d := <-delivered:
+			if d.conv != slow || d.seq != i {
+				t.Fatalf("delivery %d = %+v, want slow conversation in order", i, d)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the slow conversation")
+		}
+	}
+}
@@ -3,34 +3,86 @@ package websocket
 import (
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/tullo/backend/internal/apierror"
 	"github.com/tullo/backend/internal/auth"
+	"github.com/tullo/backend/internal/authz"
 	"github.com/tullo/backend/internal/cache"
+	"github.com/tullo/backend/internal/metrics"
+	"github.com/tullo/backend/internal/middleware"
+	"github.com/tullo/backend/internal/origin"
+	"github.com/tullo/backend/internal/preview"
+	"github.com/tullo/backend/internal/ratelimit"
 	"github.com/tullo/backend/internal/repository"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// In production, validate origin properly
-		return true
-	},
-}
-
 // Handler handles WebSocket connections
 type Handler struct {
-	hub            *Hub
-	jwtService     *auth.JWTService
-	msgRepo        *repository.MessageRepository
-	convRepo       *repository.ConversationRepository
-	redis          *cache.RedisClient
-	allowedOrigins []string
+	hub        *Hub
+	jwtService *auth.JWTService
+	msgRepo    *repository.MessageRepository
+	convRepo   *repository.ConversationRepository
+	chRepo     *repository.ChannelRepository
+	sessions   *repository.SessionRepository
+	redis      *cache.RedisClient
+	sends      *middleware.SendLimiter
+	policy     *authz.Policy
+	previews   *preview.Service
+	upgrader   websocket.Upgrader
+	// queryToken accepts the deprecated ?token= parameter, which ends up in
+	// access logs and proxy logs
+	queryToken bool
+	// resumeWindow is how long a closed connection's subscriptions can be
+	// resumed; zero disables resume tokens
+	resumeWindow time.Duration
+	// frames limits the frames each connection may send
+	frames ratelimit.Policy
+}
+
+// wsAuthConnections counts authenticated upgrades by where the token came
+// from, to see when the ?token= parameter can be turned off
+var wsAuthConnections = metrics.Default.NewCounterVec(
+	"tullo_ws_auth_connections_total",
+	"WebSocket upgrades by where the access token came from (header, subprotocol, query).",
+	"source",
+)
+
+// wsOriginDenied counts upgrades refused by the origin check, by whether the
+// Origin header was missing or not allowed
+var wsOriginDenied = metrics.Default.NewCounterVec(
+	"tullo_ws_origin_denied_total",
+	"WebSocket upgrades refused because of their Origin header (missing, not_allowed).",
+	"reason",
+)
+
+// authSubprotocolPrefix carries the access token in Sec-WebSocket-Protocol
+// for browsers, which cannot set headers on WebSocket requests. It is never
+// echoed back, so clients offer a tullo.vN protocol alongside it.
+const authSubprotocolPrefix = "tullo.auth."
+
+// requestToken returns the access token of an upgrade request and where it
+// came from: the Authorization header, an auth subprotocol or, when
+// allowQuery is set, the token query parameter
+func requestToken(r *http.Request, allowQuery bool) (token, source string) {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && bearer != "" {
+		return bearer, "header"
+	}
+	for _, sp := range websocket.Subprotocols(r) {
+		if t, ok := strings.CutPrefix(sp, authSubprotocolPrefix); ok && t != "" {
+			return t, "subprotocol"
+		}
+	}
+	if allowQuery {
+		if t := r.URL.Query().Get("token"); t != "" {
+			return t, "query"
+		}
+	}
+	return "", ""
 }
 
 // NewHandler creates a new WebSocket handler
@@ -39,54 +91,116 @@ func NewHandler(
 	jwtService *auth.JWTService,
 	msgRepo *repository.MessageRepository,
 	convRepo *repository.ConversationRepository,
+	chRepo *repository.ChannelRepository,
+	sessions *repository.SessionRepository,
 	redis *cache.RedisClient,
+	sends *middleware.SendLimiter,
+	frames ratelimit.Policy,
+	policy *authz.Policy,
+	previews *preview.Service,
 	allowedOrigins []string,
+	queryToken bool,
+	resumeWindow time.Duration,
 ) *Handler {
-	// If allowedOrigins is empty, default to allow localhost origins used in development
 	return &Handler{
-		hub:            hub,
-		jwtService:     jwtService,
-		msgRepo:        msgRepo,
-		convRepo:       convRepo,
-		redis:          redis,
-		allowedOrigins: allowedOrigins,
+		hub:          hub,
+		jwtService:   jwtService,
+		msgRepo:      msgRepo,
+		convRepo:     convRepo,
+		chRepo:       chRepo,
+		sessions:     sessions,
+		redis:        redis,
+		sends:        sends,
+		frames:       frames,
+		policy:       policy,
+		previews:     previews,
+		queryToken:   queryToken,
+		resumeWindow: resumeWindow,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     checkOrigin(allowedOrigins),
+		},
 	}
 }
 
-// HandleWebSocket handles WebSocket upgrade requests
+// checkOrigin matches the Origin header with the same rules as the CORS
+// middleware. With no configured origins every origin is accepted. It is
+// built once per Handler; refusals are counted and logged.
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	if len(allowedOrigins) == 0 {
+		return func(r *http.Request) bool { return true }
+	}
+	m := origin.NewMatcher(allowedOrigins)
+	return func(r *http.Request) bool {
+		o := r.Header.Get("Origin")
+		if m.Allowed(o) {
+			return true
+		}
+		reason := "not_allowed"
+		if o == "" {
+			reason = "missing"
+		}
+		wsOriginDenied.Inc(reason)
+		log.Printf("Refused WebSocket upgrade from %s with origin %q", r.RemoteAddr, o)
+		return false
+	}
+}
+
+// HandleWebSocket handles WebSocket upgrade requests. The access token comes
+// from a bearer Authorization header or a tullo.auth.<token> subprotocol
+// (see requestToken). ?resume= takes the resume token of a connection of the
+// same user that closed within the resume window and restores its
+// subscriptions.
 func (h *Handler) HandleWebSocket(c *gin.Context) {
-	// Get token from query parameter
-	token := c.Query("token")
+	token, source := requestToken(c.Request, h.queryToken)
 	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required"})
+		apierror.Write(c, http.StatusUnauthorized, apierror.Unauthorized, "Token required in the Authorization header or a tullo.auth.<token> subprotocol", nil)
 		return
 	}
+	wsAuthConnections.Inc(source)
 
 	// Validate token
 	claims, err := h.jwtService.ValidateToken(token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		apierror.Write(c, http.StatusUnauthorized, apierror.Unauthorized, "Invalid token", nil)
 		return
 	}
+	if claims.SessionID != uuid.Nil {
+		active, err := h.sessions.Active(claims.SessionID)
+		if err != nil {
+			apierror.Write(c, http.StatusInternalServerError, apierror.Internal, "Failed to check session", nil)
+			return
+		}
+		if !active {
+			apierror.Write(c, http.StatusUnauthorized, apierror.Unauthorized, "Session has been signed out", nil)
+			return
+		}
+	}
 
-	// Validate origin using configured allowed origins if provided
-	if len(h.allowedOrigins) > 0 {
-		upgrader.CheckOrigin = func(r *http.Request) bool {
-			origin := r.Header.Get("Origin")
-			if origin == "" {
-				return false
-			}
-			// allow exact match or wildcard like *.example.com
-			for _, pattern := range h.allowedOrigins {
-				if matchOrigin(pattern, origin) {
-					return true
-				}
-			}
-			return false
+	protocol, subprotocol, err := negotiateProtocol(c.Request)
+	if err != nil {
+		apierror.Write(c, http.StatusBadRequest, apierror.BadRequest, err.Error(), nil)
+		return
+	}
+	if source == "subprotocol" && subprotocol == "" {
+		// Browsers drop a connection whose offered subprotocols got no answer
+		apierror.Write(c, http.StatusBadRequest, apierror.BadRequest, "Offer a tullo.vN subprotocol alongside tullo.auth.<token>", nil)
+		return
+	}
+	var header http.Header
+	if subprotocol != "" {
+		header = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
+	}
+	if source == "query" {
+		if header == nil {
+			header = http.Header{}
 		}
+		header.Set("Deprecation", "true")
 	}
+
 	// Upgrade connection
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, header)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
@@ -100,8 +214,23 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 		claims.Email,
 		h.msgRepo,
 		h.convRepo,
+		h.chRepo,
 		h.redis,
+		protocol,
 	)
+	client.sessionID = claims.SessionID
+	client.guest = claims.Guest
+	client.sends = h.sends
+	client.framePolicy = h.frames
+	client.policy = h.policy
+	client.previews = h.previews
+	if h.resumeWindow > 0 {
+		if token, err := newResumeToken(); err == nil {
+			client.resumeToken = token
+			client.resumeWindow = h.resumeWindow
+			client.resumeFrom = c.Query("resume")
+		}
+	}
 
 	// Register client
 	h.hub.register <- client
@@ -115,7 +244,7 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 func (h *Handler) GetOnlineUsers(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		apierror.Write(c, http.StatusUnauthorized, apierror.Unauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -127,25 +256,3 @@ func (h *Handler) GetOnlineUsers(c *gin.Context) {
 		"count":        len(onlineUsers),
 	})
 }
-
-// matchOrigin supports exact matches or wildcard patterns like *.example.com
-func matchOrigin(pattern, origin string) bool {
-	if pattern == origin {
-		return true
-	}
-	// simple wildcard support: pattern starts with *.
-	if strings.HasPrefix(pattern, "*.") {
-		// strip scheme from origin if present
-		// e.g., https://sub.example.com -> sub.example.com
-		originHost := origin
-		if u, err := url.Parse(origin); err == nil {
-			originHost = u.Hostname()
-		}
-		patHost := strings.TrimPrefix(pattern, "*.")
-		// ensure originHost ends with patHost
-		if strings.HasSuffix(originHost, patHost) {
-			return true
-		}
-	}
-	return false
-}
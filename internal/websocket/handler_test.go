@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		header     http.Header
+		allowQuery bool
+		wantToken  string
+		wantSource string
+	}{
+		{"bearer header", "/ws", http.Header{"Authorization": {"Bearer abc"}}, false, "abc", "header"},
+		{"auth subprotocol", "/ws", http.Header{"Sec-Websocket-Protocol": {"tullo.v2, tullo.auth.abc"}}, false, "abc", "subprotocol"},
+		{"header wins", "/ws?token=q", http.Header{"Authorization": {"Bearer abc"}, "Sec-Websocket-Protocol": {"tullo.auth.sp"}}, true, "abc", "header"},
+		{"query allowed", "/ws?token=q", nil, true, "q", "query"},
+		{"query disabled", "/ws?token=q", nil, false, "", ""},
+		{"empty auth subprotocol", "/ws", http.Header{"Sec-Websocket-Protocol": {"tullo.auth."}}, false, "", ""},
+		{"none", "/ws", nil, true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			token, source := requestToken(r, tt.allowQuery)
+			if token != tt.wantToken || source != tt.wantSource {
+				t.Errorf("requestToken = %q, %q; want %q, %q", token, source, tt.wantToken, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"no list allows all", nil, "https://evil.example", true},
+		{"no list allows missing", nil, "", true},
+		{"exact", []string{"https://app.example.com"}, "https://app.example.com", true},
+		{"wildcard", []string{"*.example.com"}, "https://app.example.com", true},
+		{"not allowed", []string{"https://app.example.com"}, "https://evil.example", false},
+		{"missing", []string{"https://app.example.com"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(tt.allowed)(r); got != tt.want {
+				t.Errorf("checkOrigin(%v)(%q) = %v, want %v", tt.allowed, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
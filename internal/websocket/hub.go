@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/auth"
 	"github.com/tullo/backend/internal/cache"
 	"github.com/tullo/backend/internal/models"
 	"github.com/tullo/backend/internal/repository"
@@ -13,11 +15,12 @@ import (
 
 // Hub maintains the set of active clients and broadcasts messages to clients
 type Hub struct {
-	// Registered clients
-	clients map[uuid.UUID]*Client
+	// Registered clients by user; a user may be connected from several
+	// devices at once
+	clients map[uuid.UUID]map[*Client]struct{}
 
-	// Inbound messages from clients
-	broadcast chan []byte
+	// Events for every connected client
+	broadcast chan *frame
 
 	// Register requests from clients
 	register chan *Client
@@ -31,34 +34,98 @@ type Hub struct {
 	// Conversation repository to resolve members for conversation-scoped broadcasts
 	convRepo *repository.ConversationRepository
 
+	// reports signs the report token delivered with each new message
+	reports *auth.ReportSigner
+
+	// fanout delivers conversation-scoped events off the subscriber loop
+	fanout *fanout
+
+	// chatSubs holds the local clients with each channel's chat open; they
+	// get chat.viewers updates every chatViewersEvery when the count changes
+	chatSubs         map[uuid.UUID]map[*Client]struct{}
+	chatViewersEvery time.Duration
+	// chatReaders holds the same clients by the chat's conversation; they
+	// get its messages whether or not they are members
+	chatReaders map[uuid.UUID]map[*Client]struct{}
+	// chatChannels maps the conversation of each open chat to its channel
+	chatChannels map[uuid.UUID]uuid.UUID
+	// chatViewersSent is the last count sent per channel, owned by Run
+	chatViewersSent map[uuid.UUID]int
+	// onChatViewers is called with each channel whose count changed
+	onChatViewers func(channelID uuid.UUID)
+	// streamers picks the channel owners among connected users, for
+	// announcements to streamers
+	streamers func(userIDs []uuid.UUID) ([]uuid.UUID, error)
+
+	// typingSubs holds the clients subscribed to each conversation's typing
+	// events. Clients in typingScoped subscribed at least once and only get
+	// the typing events of their subscriptions; the others get them all.
+	typingSubs   map[uuid.UUID]map[*Client]struct{}
+	typingScoped map[*Client]struct{}
+
+	// overlays holds the local overlay feeds by channel, see SubscribeOverlay
+	overlays map[uuid.UUID]map[chan models.WSMessage]struct{}
+
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
 }
 
-// NewHub creates a new Hub
-func NewHub(redis *cache.RedisClient, convRepo *repository.ConversationRepository) *Hub {
-	return &Hub{
-		clients:    make(map[uuid.UUID]*Client),
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		redis:      redis,
-		convRepo:   convRepo,
+// NewHub creates a new Hub. Chat viewer counts are pushed to open chats
+// every chatViewersEvery; zero disables the updates. Conversation events are
+// delivered by fanoutWorkers workers, each queueing up to fanoutQueue events.
+func NewHub(redis *cache.RedisClient, convRepo *repository.ConversationRepository, reports *auth.ReportSigner, chatViewersEvery time.Duration, fanoutWorkers, fanoutQueue int) *Hub {
+	h := &Hub{
+		clients:          make(map[uuid.UUID]map[*Client]struct{}),
+		broadcast:        make(chan *frame, 256),
+		register:         make(chan *Client),
+		unregister:       make(chan *Client),
+		redis:            redis,
+		convRepo:         convRepo,
+		reports:          reports,
+		chatSubs:         make(map[uuid.UUID]map[*Client]struct{}),
+		chatReaders:      make(map[uuid.UUID]map[*Client]struct{}),
+		chatChannels:     make(map[uuid.UUID]uuid.UUID),
+		chatViewersEvery: chatViewersEvery,
+		chatViewersSent:  make(map[uuid.UUID]int),
+		typingSubs:       make(map[uuid.UUID]map[*Client]struct{}),
+		typingScoped:     make(map[*Client]struct{}),
+		overlays:         make(map[uuid.UUID]map[chan models.WSMessage]struct{}),
 	}
+	h.fanout = newFanout(fanoutWorkers, fanoutQueue, h.deliverToConversation)
+	return h
 }
 
 // Run starts the hub
 func (h *Hub) Run() {
 	// Subscribe to Redis channels
+	h.fanout.start()
 	go h.subscribeToRedis()
 
+	var chatViewersTick <-chan time.Time
+	if h.chatViewersEvery > 0 {
+		ticker := time.NewTicker(h.chatViewersEvery)
+		defer ticker.Stop()
+		chatViewersTick = ticker.C
+	}
+
 	for {
 		select {
+		case <-chatViewersTick:
+			h.sendChatViewers()
+
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client.userID] = client
+			if h.clients[client.userID] == nil {
+				h.clients[client.userID] = make(map[*Client]struct{})
+			}
+			h.clients[client.userID][client] = struct{}{}
 			h.mu.Unlock()
 
+			// Guests are nobody's contacts
+			if client.guest {
+				continue
+			}
+
 			// Set user online in Redis
 			h.redis.SetUserOnline(client.userID)
 
@@ -74,12 +141,17 @@ func (h *Hub) Run() {
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client.userID]; ok {
-				delete(h.clients, client.userID)
-				close(client.send)
-			}
+			h.removeClient(client)
+			_, online := h.clients[client.userID]
 			h.mu.Unlock()
 
+			log.Printf("Client unregistered: %s", client.userID)
+
+			// The user is still connected from another device
+			if online || client.guest {
+				continue
+			}
+
 			// Set user offline in Redis
 			h.redis.SetUserOffline(client.userID)
 
@@ -90,24 +162,40 @@ func (h *Hub) Run() {
 			}
 			h.redis.PublishPresence(presence)
 
-			log.Printf("Client unregistered: %s", client.userID)
-
-		case message := <-h.broadcast:
+		case f := <-h.broadcast:
 			// Broadcast to all connected clients
-			h.mu.RLock()
-			for _, client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client.userID)
+			h.mu.Lock()
+			for _, conns := range h.clients {
+				for client := range conns {
+					message, err := f.bytes(client.protocol)
+					if err != nil {
+						log.Printf("Failed to encode event for protocol %d: %v", client.protocol, err)
+						continue
+					}
+					if !client.queue(message) {
+						h.removeClient(client)
+					}
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
 		}
 	}
 }
 
+// removeClient drops client and closes its done channel, unless that already
+// happened. The caller holds h.mu.
+func (h *Hub) removeClient(client *Client) {
+	conns := h.clients[client.userID]
+	if _, ok := conns[client]; !ok {
+		return
+	}
+	delete(conns, client)
+	if len(conns) == 0 {
+		delete(h.clients, client.userID)
+	}
+	close(client.done)
+}
+
 // subscribeToRedis subscribes to Redis pub/sub channels
 func (h *Hub) subscribeToRedis() {
 	// Subscribe to messages channel
@@ -134,58 +222,213 @@ func (h *Hub) subscribeToRedis() {
 			// Try to unmarshal into WSMessage and handle conversation-scoped delivery
 			var wsMsg models.WSMessage
 			if err := json.Unmarshal([]byte(msg.Payload), &wsMsg); err == nil {
-				// If it's a message event with a Message payload, attempt scoped delivery
-				if wsMsg.Event == models.EventMessageNew {
+				// If it's a message event with a Message payload, attempt scoped
+				// delivery; restored messages are sent again like new ones
+				if wsMsg.Event == models.EventMessageNew || wsMsg.Event == models.EventMessageRestored {
 					// payload may be a nested object; marshal/unmarshal to Message
 					raw, _ := json.Marshal(wsMsg.Payload)
 					var m models.Message
 					if err := json.Unmarshal(raw, &m); err == nil {
-						// resolve members for conversation
-						members, err := h.convRepo.GetMembers(m.ConversationID)
-						if err == nil {
-							ids := make([]uuid.UUID, 0, len(members))
-							for _, u := range members {
-								ids = append(ids, u.ID)
-							}
-							// send to only conversation members
-							h.SendToConversation(ids, wsMsg)
-							continue
+						// Whoever is shown the message may report it later
+						if h.reports != nil {
+							m.ReportToken = h.reports.Token(m.ID)
+							wsMsg.Payload = m
 						}
+						// send to only conversation members
+						h.fanout.submit(m.ConversationID, wsMsg)
+						continue
+					}
+				}
+				// A bulk mark-as-read only syncs the reader's own sessions
+				if wsMsg.Event == models.EventMessageReadAll {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSReadAllPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.SendToUser(p.UserID, wsMsg)
+						continue
+					}
+				}
+				// So does a moved read marker
+				if wsMsg.Event == models.EventReadMarker {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSReadMarkerPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.SendToUser(p.UserID, wsMsg)
+						continue
+					}
+				}
+				// Follow alerts are for the channel's owner and overlays only
+				if wsMsg.Event == models.EventChannelFollowed {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSChannelFollowedPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.SendToUser(p.OwnerID, wsMsg)
+						h.sendToOverlays(p.ChannelID, wsMsg)
+						continue
+					}
+				}
+				// A signed-out session is dropped from every instance
+				if wsMsg.Event == models.EventSessionRevoked {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSSessionRevokedPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.EndSession(p.UserID, p.SessionID, wsMsg)
+						continue
+					}
+				}
+				// Deleted messages go to the conversation, like new ones
+				if wsMsg.Event == models.EventMessageDeleted {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSMessageDeletedPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.fanout.submit(p.ConversationID, wsMsg)
+						continue
+					}
+				}
+				// So do late additions such as link previews
+				if wsMsg.Event == models.EventMessageUpdated {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSMessageUpdatedPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.fanout.submit(p.ConversationID, wsMsg)
+						continue
+					}
+				}
+				// Announcements to streamers skip everyone else; the rest
+				// are broadcast below
+				if wsMsg.Event == models.EventAnnouncement {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var a models.Announcement
+					if err := json.Unmarshal(raw, &a); err == nil && a.Audience == models.AudienceStreamers {
+						go h.sendToStreamers(wsMsg)
+						continue
+					}
+				}
+				// A banned user is put out of the chat
+				if wsMsg.Event == models.EventUserBanned {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSUserBannedPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.banFromChat(p)
+						continue
+					}
+				}
+				// Lapsed and lifted mutes and bans concern only the conversation
+				if wsMsg.Event == models.EventUserUnmuted || wsMsg.Event == models.EventUserUnbanned {
+					raw, _ := json.Marshal(wsMsg.Payload)
+					var p models.WSModerationPayload
+					if err := json.Unmarshal(raw, &p); err == nil {
+						h.fanout.submit(p.ConversationID, wsMsg)
+						continue
 					}
 				}
 			}
 
-			// fallback: broadcast raw message to everyone
-			h.broadcast <- []byte(msg.Payload)
+			// fallback: broadcast to everyone
+			if wsMsg.Event != "" {
+				f, _ := newFrame(wsMsg)
+				h.broadcast <- f
+			} else {
+				h.broadcast <- &frame{raw: []byte(msg.Payload)}
+			}
 
 		case presence := <-presenceChan:
-			// Broadcast presence update
-			h.broadcast <- []byte(presence.Payload)
+			// Legacy clients get the bare presence object
+			raw := json.RawMessage(presence.Payload)
+			h.broadcast <- legacyFrame(models.WSMessage{Event: models.EventPresenceUpdate, Payload: raw}, raw)
 
 		case typing := <-typingChan:
-			// Broadcast typing indicator
-			h.broadcast <- []byte(typing.Payload)
+			// Legacy clients get the bare typing indicator
+			raw := json.RawMessage(typing.Payload)
+			event := models.EventTypingStop
+			var t models.TypingIndicator
+			if err := json.Unmarshal(raw, &t); err != nil {
+				h.broadcast <- legacyFrame(models.WSMessage{Event: event, Payload: raw}, raw)
+				continue
+			}
+			if t.IsTyping {
+				event = models.EventTypingStart
+			}
+			h.sendTyping(t.ConversationID, legacyFrame(models.WSMessage{Event: event, Payload: raw}, raw))
 		}
 	}
 }
 
-// SendToUser sends a message to a specific user
+// deliverToConversation sends message to the members of conversationID. It
+// runs on a fanout worker; when the members can't be resolved the event is
+// dropped rather than broadcast to every connected client.
+func (h *Hub) deliverToConversation(conversationID uuid.UUID, message models.WSMessage) {
+	members, err := h.convRepo.GetMembers(conversationID)
+	if err != nil {
+		log.Printf("Failed to resolve members of conversation %s, dropping %s: %v", conversationID, message.Event, err)
+		return
+	}
+	ids := make([]uuid.UUID, 0, len(members))
+	isMember := make(map[uuid.UUID]bool, len(members))
+	for _, u := range members {
+		ids = append(ids, u.ID)
+		isMember[u.ID] = true
+	}
+	h.SendToConversation(ids, message)
+	h.sendToChatReaders(conversationID, isMember, message)
+}
+
+// sendToChatReaders sends message to the clients that have the chat of
+// conversationID open, apart from members, who already got it: viewers read
+// a channel's chat along without joining it
+func (h *Hub) sendToChatReaders(conversationID uuid.UUID, isMember map[uuid.UUID]bool, message models.WSMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var f *frame
+	for client := range h.chatReaders[conversationID] {
+		if isMember[client.userID] {
+			continue
+		}
+		if f == nil {
+			f, _ = newFrame(message)
+		}
+		data, err := f.bytes(client.protocol)
+		if err != nil {
+			continue
+		}
+		client.queue(data)
+	}
+}
+
+// EndSession sends message to every connection of the user, then
+// disconnects the ones opened with sessionID. Their queued messages,
+// including this one, are still written before the socket closes.
+func (h *Hub) EndSession(userID, sessionID uuid.UUID, message interface{}) error {
+	if err := h.SendToUser(userID, message); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients[userID] {
+		if client.sessionID == sessionID {
+			h.removeClient(client)
+		}
+	}
+	return nil
+}
+
+// SendToUser sends a message to every connection of a specific user
 func (h *Hub) SendToUser(userID uuid.UUID, message interface{}) error {
-	data, err := json.Marshal(message)
+	f, err := newFrame(message)
 	if err != nil {
 		return err
 	}
 
 	h.mu.RLock()
-	client, ok := h.clients[userID]
-	h.mu.RUnlock()
+	defer h.mu.RUnlock()
 
-	if ok {
-		select {
-		case client.send <- data:
-		default:
-			// Client's send channel is full, skip
+	for client := range h.clients[userID] {
+		data, err := f.bytes(client.protocol)
+		if err != nil {
+			return err
 		}
+		client.queue(data)
 	}
 
 	return nil
@@ -193,7 +436,7 @@ func (h *Hub) SendToUser(userID uuid.UUID, message interface{}) error {
 
 // SendToConversation sends a message to all members of a conversation
 func (h *Hub) SendToConversation(memberIDs []uuid.UUID, message interface{}) error {
-	data, err := json.Marshal(message)
+	f, err := newFrame(message)
 	if err != nil {
 		return err
 	}
@@ -202,26 +445,330 @@ func (h *Hub) SendToConversation(memberIDs []uuid.UUID, message interface{}) err
 	defer h.mu.RUnlock()
 
 	for _, memberID := range memberIDs {
-		if client, ok := h.clients[memberID]; ok {
-			select {
-			case client.send <- data:
-			default:
-				// Client's send channel is full, skip
+		for client := range h.clients[memberID] {
+			data, err := f.bytes(client.protocol)
+			if err != nil {
+				log.Printf("Failed to encode %T for protocol %d: %v", message, client.protocol, err)
+				continue
 			}
+			client.queue(data)
 		}
 	}
 
 	return nil
 }
 
+// OnChatViewersChanged registers fn to be called, from the hub's goroutine,
+// for each channel whose chat viewer count was seen to change. Call it before
+// Run.
+func (h *Hub) OnChatViewersChanged(fn func(channelID uuid.UUID)) {
+	h.onChatViewers = fn
+}
+
+// OnStreamerLookup registers fn to pick the channel owners among connected
+// users. Without it announcements to streamers reach nobody. Call it before
+// Run.
+func (h *Hub) OnStreamerLookup(fn func(userIDs []uuid.UUID) ([]uuid.UUID, error)) {
+	h.streamers = fn
+}
+
+// sendToStreamers sends message to the connected users who own a channel
+func (h *Hub) sendToStreamers(message models.WSMessage) {
+	if h.streamers == nil {
+		return
+	}
+	owners, err := h.streamers(h.GetOnlineUsers())
+	if err != nil {
+		log.Printf("Failed to look up streamers for %s: %v", message.Event, err)
+		return
+	}
+	for _, id := range owners {
+		h.SendToUser(id, message)
+	}
+}
+
+// overlayBuffer is how many alerts an overlay feed holds before new ones
+// are dropped
+const overlayBuffer = 16
+
+// SubscribeOverlay returns a feed of channelID's alerts (channel.followed)
+// for a stream overlay, and the function that ends it
+func (h *Hub) SubscribeOverlay(channelID uuid.UUID) (<-chan models.WSMessage, func()) {
+	ch := make(chan models.WSMessage, overlayBuffer)
+	h.mu.Lock()
+	if h.overlays[channelID] == nil {
+		h.overlays[channelID] = make(map[chan models.WSMessage]struct{})
+	}
+	h.overlays[channelID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.overlays[channelID], ch)
+		if len(h.overlays[channelID]) == 0 {
+			delete(h.overlays, channelID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// sendToOverlays hands message to channelID's overlay feeds, skipping full
+// ones
+func (h *Hub) sendToOverlays(channelID uuid.UUID, message models.WSMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.overlays[channelID] {
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+}
+
+// joinChat subscribes c to channelID's viewer updates and to the messages of
+// its chat conversation convID, and counts its user as a viewer, returning
+// the channel's chat viewers
+func (h *Hub) joinChat(channelID, convID uuid.UUID, c *Client) (int, error) {
+	n, err := h.redis.JoinChat(channelID, c.userID)
+	if err != nil {
+		return 0, err
+	}
+	h.mu.Lock()
+	if h.chatSubs[channelID] == nil {
+		h.chatSubs[channelID] = make(map[*Client]struct{})
+	}
+	h.chatSubs[channelID][c] = struct{}{}
+	if h.chatReaders[convID] == nil {
+		h.chatReaders[convID] = make(map[*Client]struct{})
+	}
+	h.chatReaders[convID][c] = struct{}{}
+	h.chatChannels[convID] = channelID
+	h.mu.Unlock()
+	return n, nil
+}
+
+// leaveChat undoes joinChat, unless banFromChat already did
+func (h *Hub) leaveChat(channelID, convID uuid.UUID, c *Client) {
+	h.mu.Lock()
+	open := h.inChat(convID, c)
+	h.dropChat(channelID, convID, c)
+	h.mu.Unlock()
+
+	if !open {
+		return
+	}
+	if _, err := h.redis.LeaveChat(channelID, c.userID); err != nil {
+		log.Printf("Failed to leave chat %s for %s: %v", channelID, c.userID, err)
+	}
+}
+
+// hasChatOpen reports whether c still has the chat of convID open; the hub
+// closes it when c's user is banned from it
+func (h *Hub) hasChatOpen(convID uuid.UUID, c *Client) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.inChat(convID, c)
+}
+
+// inChat reports whether c has the chat of convID open. The caller holds
+// h.mu.
+func (h *Hub) inChat(convID uuid.UUID, c *Client) bool {
+	_, ok := h.chatReaders[convID][c]
+	return ok
+}
+
+// dropChat removes c from the chat of channelID and its conversation convID.
+// The caller holds h.mu.
+func (h *Hub) dropChat(channelID, convID uuid.UUID, c *Client) {
+	delete(h.chatSubs[channelID], c)
+	if len(h.chatSubs[channelID]) == 0 {
+		delete(h.chatSubs, channelID)
+	}
+	delete(h.chatReaders[convID], c)
+	if len(h.chatReaders[convID]) == 0 {
+		delete(h.chatReaders, convID)
+		delete(h.chatChannels, convID)
+	}
+}
+
+// banFromChat closes the chat of p.ConversationID on the local connections
+// of p.UserID, who was banned from it, and sends them chat.user_banned. They
+// get no more of its messages; ReadPump finds the chat closed on the next
+// chat.join or chat.leave.
+func (h *Hub) banFromChat(p models.WSUserBannedPayload) {
+	channelID, closed := h.closeChat(p)
+	for i := 0; i < closed; i++ {
+		if _, err := h.redis.LeaveChat(channelID, p.UserID); err != nil {
+			log.Printf("Failed to leave chat %s for %s: %v", channelID, p.UserID, err)
+		}
+	}
+}
+
+// closeChat does the part of banFromChat that needs no Redis, returning the
+// chat's channel and the number of connections it was closed on
+func (h *Hub) closeChat(p models.WSUserBannedPayload) (uuid.UUID, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	channelID, ok := h.chatChannels[p.ConversationID]
+	if !ok {
+		return uuid.Nil, 0
+	}
+	p.ChannelID = channelID
+	f, err := newFrame(models.WSMessage{Event: models.EventUserBanned, Payload: p})
+	if err != nil {
+		return channelID, 0
+	}
+	closed := 0
+	for client := range h.chatReaders[p.ConversationID] {
+		if client.userID != p.UserID {
+			continue
+		}
+		h.dropChat(channelID, p.ConversationID, client)
+		closed++
+		if data, err := f.bytes(client.protocol); err == nil {
+			client.queue(data)
+		}
+	}
+	return channelID, closed
+}
+
+// subscribeTyping makes c get the typing events of convID, and from now on
+// only those of the conversations it subscribed to
+func (h *Hub) subscribeTyping(convID uuid.UUID, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.typingSubs[convID] == nil {
+		h.typingSubs[convID] = make(map[*Client]struct{})
+	}
+	h.typingSubs[convID][c] = struct{}{}
+	h.typingScoped[c] = struct{}{}
+}
+
+// unsubscribeTyping undoes subscribeTyping for convID; c stays scoped, so
+// it gets no typing events once it has no subscriptions left
+func (h *Hub) unsubscribeTyping(convID uuid.UUID, c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.typingSubs[convID], c)
+	if len(h.typingSubs[convID]) == 0 {
+		delete(h.typingSubs, convID)
+	}
+}
+
+// forgetTyping drops a disconnecting client's typing subscriptions, convIDs
+func (h *Hub) forgetTyping(c *Client, convIDs map[uuid.UUID]struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for convID := range convIDs {
+		delete(h.typingSubs[convID], c)
+		if len(h.typingSubs[convID]) == 0 {
+			delete(h.typingSubs, convID)
+		}
+	}
+	delete(h.typingScoped, c)
+}
+
+// sendTyping sends a typing event of convID to the clients subscribed to
+// it and to those that never subscribed to any conversation
+func (h *Hub) sendTyping(convID uuid.UUID, f *frame) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	subs := h.typingSubs[convID]
+	for _, conns := range h.clients {
+		for client := range conns {
+			if _, scoped := h.typingScoped[client]; scoped {
+				if _, ok := subs[client]; !ok {
+					continue
+				}
+			}
+			data, err := f.bytes(client.protocol)
+			if err != nil {
+				continue
+			}
+			client.queue(data)
+		}
+	}
+}
+
+// sendChatViewers pushes chat.viewers to the local clients of every open
+// chat whose count changed since the last push
+func (h *Hub) sendChatViewers() {
+	h.mu.RLock()
+	ids := make([]uuid.UUID, 0, len(h.chatSubs))
+	for id := range h.chatSubs {
+		ids = append(ids, id)
+	}
+	var closed []uuid.UUID
+	for id := range h.chatViewersSent {
+		if _, open := h.chatSubs[id]; !open {
+			delete(h.chatViewersSent, id)
+			closed = append(closed, id)
+		}
+	}
+	h.mu.RUnlock()
+
+	// The last local viewer left; the count changed at least by them
+	if h.onChatViewers != nil {
+		for _, id := range closed {
+			h.onChatViewers(id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	counts, err := h.redis.ChatViewers(ids)
+	if err != nil {
+		log.Printf("Failed to read chat viewers: %v", err)
+		return
+	}
+
+	var changed []uuid.UUID
+	h.mu.RLock()
+	defer func() {
+		h.mu.RUnlock()
+		if h.onChatViewers != nil {
+			for _, id := range changed {
+				h.onChatViewers(id)
+			}
+		}
+	}()
+	for _, id := range ids {
+		n := counts[id]
+		if sent, ok := h.chatViewersSent[id]; ok && sent == n {
+			continue
+		}
+		h.chatViewersSent[id] = n
+		changed = append(changed, id)
+
+		f, _ := newFrame(models.WSMessage{
+			Event:   models.EventChatViewers,
+			Payload: models.WSChatViewersPayload{ChannelID: id, ChatViewers: n},
+		})
+		for client := range h.chatSubs[id] {
+			data, err := f.bytes(client.protocol)
+			if err != nil {
+				continue
+			}
+			client.queue(data)
+		}
+	}
+}
+
 // GetOnlineUsers returns the list of online user IDs
 func (h *Hub) GetOnlineUsers() []uuid.UUID {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	userIDs := make([]uuid.UUID, 0, len(h.clients))
-	for userID := range h.clients {
-		userIDs = append(userIDs, userID)
+	for userID, conns := range h.clients {
+		for client := range conns {
+			if !client.guest {
+				userIDs = append(userIDs, userID)
+			}
+			break
+		}
 	}
 
 	return userIDs
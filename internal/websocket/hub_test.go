@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
 )
 
 // fakeClient is a minimal client that exposes a send channel
@@ -18,8 +19,8 @@ func (f *fakeClient) start() {}
 
 func TestHubSendToUserAndConversation(t *testing.T) {
 	h := &Hub{
-		clients:    make(map[uuid.UUID]*Client),
-		broadcast:  make(chan []byte, 10),
+		clients:    make(map[uuid.UUID]map[*Client]struct{}),
+		broadcast:  make(chan *frame, 10),
 		register:   make(chan *Client, 1),
 		unregister: make(chan *Client, 1),
 	}
@@ -32,8 +33,8 @@ func TestHubSendToUserAndConversation(t *testing.T) {
 	c1 := &Client{userID: id1, send: make(chan []byte, 4)}
 	c2 := &Client{userID: id2, send: make(chan []byte, 4)}
 
-	h.clients[id1] = c1
-	h.clients[id2] = c2
+	h.clients[id1] = map[*Client]struct{}{c1: {}}
+	h.clients[id2] = map[*Client]struct{}{c2: {}}
 
 	// Send to single user
 	msg := map[string]string{"hello": "world"}
@@ -72,3 +73,249 @@ func TestHubSendToUserAndConversation(t *testing.T) {
 		}
 	}
 }
+
+func TestHubUserWithSeveralConnections(t *testing.T) {
+	h := &Hub{clients: make(map[uuid.UUID]map[*Client]struct{})}
+
+	id := uuid.New()
+	phone := &Client{userID: id, send: make(chan []byte, 1), done: make(chan struct{})}
+	desktop := &Client{userID: id, send: make(chan []byte, 1), done: make(chan struct{})}
+	h.clients[id] = map[*Client]struct{}{phone: {}, desktop: {}}
+
+	if err := h.SendToUser(id, map[string]string{"hello": "world"}); err != nil {
+		t.Fatalf("SendToUser error: %v", err)
+	}
+	for _, c := range []*Client{phone, desktop} {
+		select {
+		case <-c.send:
+		default:
+			t.Fatal("expected every connection of the user to get the message")
+		}
+	}
+
+	h.removeClient(phone)
+	if _, ok := <-phone.done; ok {
+		t.Error("expected removed connection's done channel to be closed")
+	}
+	if !h.IsUserOnline(id) {
+		t.Error("expected user to stay online on the other connection")
+	}
+	h.removeClient(phone) // already removed; must not close twice
+	h.removeClient(desktop)
+	if h.IsUserOnline(id) {
+		t.Error("expected user offline after the last connection left")
+	}
+}
+
+func TestHubEndSession(t *testing.T) {
+	h := &Hub{clients: make(map[uuid.UUID]map[*Client]struct{})}
+
+	id, signedOut := uuid.New(), uuid.New()
+	phone := &Client{userID: id, sessionID: signedOut, send: make(chan []byte, 2), done: make(chan struct{})}
+	desktop := &Client{userID: id, sessionID: uuid.New(), send: make(chan []byte, 1), done: make(chan struct{})}
+	h.clients[id] = map[*Client]struct{}{phone: {}, desktop: {}}
+
+	if err := h.EndSession(id, signedOut, map[string]string{"event": "session.revoked"}); err != nil {
+		t.Fatalf("EndSession error: %v", err)
+	}
+
+	select {
+	case <-phone.done:
+	default:
+		t.Error("expected the signed-out connection to be dropped")
+	}
+	// ReadPump may still reply after the hub dropped the connection
+	phone.sendEvent(models.WSMessage{Event: "error"})
+	if n := len(phone.send); n != 1 {
+		t.Errorf("signed-out connection has %d queued messages, want only the event", n)
+	}
+	select {
+	case <-desktop.send:
+	default:
+		t.Error("expected the user's other connection to get the event")
+	}
+	if _, ok := h.clients[id][desktop]; !ok {
+		t.Error("expected the user's other connection to stay open")
+	}
+}
+
+func TestHubChatReadersAndGuests(t *testing.T) {
+	h := &Hub{
+		clients:     make(map[uuid.UUID]map[*Client]struct{}),
+		chatReaders: make(map[uuid.UUID]map[*Client]struct{}),
+	}
+
+	convID, memberID := uuid.New(), uuid.New()
+	member := &Client{userID: memberID, send: make(chan []byte, 1)}
+	guest := &Client{userID: uuid.New(), guest: true, send: make(chan []byte, 1)}
+	h.clients[member.userID] = map[*Client]struct{}{member: {}}
+	h.clients[guest.userID] = map[*Client]struct{}{guest: {}}
+	h.chatReaders[convID] = map[*Client]struct{}{member: {}, guest: {}}
+
+	h.sendToChatReaders(convID, map[uuid.UUID]bool{memberID: true}, models.WSMessage{Event: models.EventMessageNew})
+	select {
+	case <-guest.send:
+	default:
+		t.Error("expected the guest reading the chat to get the message")
+	}
+	select {
+	case <-member.send:
+		t.Error("expected the member not to get the message twice")
+	default:
+	}
+
+	if online := h.GetOnlineUsers(); len(online) != 1 || online[0] != memberID {
+		t.Errorf("online users = %v, want only the member", online)
+	}
+}
+
+func TestHubBanClosesChat(t *testing.T) {
+	h := &Hub{
+		clients:      make(map[uuid.UUID]map[*Client]struct{}),
+		chatSubs:     make(map[uuid.UUID]map[*Client]struct{}),
+		chatReaders:  make(map[uuid.UUID]map[*Client]struct{}),
+		chatChannels: make(map[uuid.UUID]uuid.UUID),
+	}
+
+	channelID, convID := uuid.New(), uuid.New()
+	banned := &Client{userID: uuid.New(), send: make(chan []byte, 2)}
+	viewer := &Client{userID: uuid.New(), send: make(chan []byte, 2)}
+	for _, c := range []*Client{banned, viewer} {
+		h.clients[c.userID] = map[*Client]struct{}{c: {}}
+	}
+	// As joinChat leaves them
+	h.chatSubs[channelID] = map[*Client]struct{}{banned: {}, viewer: {}}
+	h.chatReaders[convID] = map[*Client]struct{}{banned: {}, viewer: {}}
+	h.chatChannels[convID] = channelID
+
+	got, closed := h.closeChat(models.WSUserBannedPayload{ConversationID: convID, UserID: banned.userID})
+	if got != channelID || closed != 1 {
+		t.Fatalf("closeChat = %s, %d; want the channel, closed on 1 connection", got, closed)
+	}
+	select {
+	case b := <-banned.send:
+		var msg struct {
+			Event   string                     `json:"event"`
+			Payload models.WSUserBannedPayload `json:"payload"`
+		}
+		if err := json.Unmarshal(b, &msg); err != nil || msg.Event != models.EventUserBanned || msg.Payload.ChannelID != channelID {
+			t.Errorf("banned user got %s, want chat.user_banned for the channel", b)
+		}
+	default:
+		t.Fatal("expected the banned user to be told")
+	}
+	if h.hasChatOpen(convID, banned) || !h.hasChatOpen(convID, viewer) {
+		t.Error("expected the chat closed for the banned user only")
+	}
+
+	h.sendToChatReaders(convID, nil, models.WSMessage{Event: models.EventMessageNew})
+	select {
+	case <-banned.send:
+		t.Error("expected the banned user to get no more messages")
+	default:
+	}
+	select {
+	case <-viewer.send:
+	default:
+		t.Error("expected the other viewer to still get messages")
+	}
+}
+
+func TestHubOverlayFeeds(t *testing.T) {
+	h := &Hub{overlays: make(map[uuid.UUID]map[chan models.WSMessage]struct{})}
+
+	channelID := uuid.New()
+	feed, stop := h.SubscribeOverlay(channelID)
+	other, stopOther := h.SubscribeOverlay(uuid.New())
+	defer stopOther()
+
+	h.sendToOverlays(channelID, models.WSMessage{Event: models.EventChannelFollowed})
+	select {
+	case msg := <-feed:
+		if msg.Event != models.EventChannelFollowed {
+			t.Errorf("event = %q", msg.Event)
+		}
+	default:
+		t.Fatal("expected the channel's overlay to get the alert")
+	}
+	select {
+	case <-other:
+		t.Error("expected other channels' overlays not to get the alert")
+	default:
+	}
+
+	stop()
+	h.sendToOverlays(channelID, models.WSMessage{Event: models.EventChannelFollowed})
+	select {
+	case <-feed:
+		t.Error("expected no alerts after the feed ended")
+	default:
+	}
+	if len(h.overlays) != 1 {
+		t.Errorf("overlays = %d channels, want 1", len(h.overlays))
+	}
+}
+
+func TestHubTypingSubscriptions(t *testing.T) {
+	h := &Hub{
+		clients:      make(map[uuid.UUID]map[*Client]struct{}),
+		typingSubs:   make(map[uuid.UUID]map[*Client]struct{}),
+		typingScoped: make(map[*Client]struct{}),
+	}
+
+	open, other := uuid.New(), uuid.New()
+	focused := &Client{userID: uuid.New(), send: make(chan []byte, 4)}
+	legacy := &Client{userID: uuid.New(), send: make(chan []byte, 4)}
+	h.clients[focused.userID] = map[*Client]struct{}{focused: {}}
+	h.clients[legacy.userID] = map[*Client]struct{}{legacy: {}}
+	h.subscribeTyping(open, focused)
+
+	typing := func(convID uuid.UUID) *frame {
+		raw, _ := json.Marshal(models.TypingIndicator{ConversationID: convID, UserID: uuid.New(), IsTyping: true})
+		return legacyFrame(models.WSMessage{Event: models.EventTypingStart, Payload: json.RawMessage(raw)}, raw)
+	}
+	h.sendTyping(open, typing(open))
+	h.sendTyping(other, typing(other))
+
+	if n := len(focused.send); n != 1 {
+		t.Errorf("subscribed client got %d typing events, want only the open conversation's", n)
+	}
+	if n := len(legacy.send); n != 2 {
+		t.Errorf("client without subscriptions got %d typing events, want all 2", n)
+	}
+
+	// Unsubscribing from the last conversation does not bring back the rest
+	h.unsubscribeTyping(open, focused)
+	h.sendTyping(other, typing(other))
+	if n := len(focused.send); n != 1 {
+		t.Errorf("client got %d typing events after unsubscribing, want 1", n)
+	}
+
+	h.forgetTyping(focused, map[uuid.UUID]struct{}{open: {}})
+	if len(h.typingSubs) != 0 || len(h.typingScoped) != 0 {
+		t.Errorf("typing state left after disconnect: %v, %v", h.typingSubs, h.typingScoped)
+	}
+}
+
+func TestHubAnnouncementToStreamers(t *testing.T) {
+	h := &Hub{clients: make(map[uuid.UUID]map[*Client]struct{})}
+	streamer := &Client{userID: uuid.New(), send: make(chan []byte, 1)}
+	viewer := &Client{userID: uuid.New(), send: make(chan []byte, 1)}
+	h.clients[streamer.userID] = map[*Client]struct{}{streamer: {}}
+	h.clients[viewer.userID] = map[*Client]struct{}{viewer: {}}
+
+	msg := models.WSMessage{Event: models.EventAnnouncement, Payload: models.Announcement{ID: uuid.New(), Audience: models.AudienceStreamers}}
+	// Without a lookup nobody counts as a streamer
+	h.sendToStreamers(msg)
+	if len(streamer.send)+len(viewer.send) != 0 {
+		t.Fatal("announcement delivered without a streamer lookup")
+	}
+
+	h.OnStreamerLookup(func(ids []uuid.UUID) ([]uuid.UUID, error) {
+		return []uuid.UUID{streamer.userID}, nil
+	})
+	h.sendToStreamers(msg)
+	if len(streamer.send) != 1 || len(viewer.send) != 0 {
+		t.Errorf("streamer got %d, viewer %d announcements; want 1 and 0", len(streamer.send), len(viewer.send))
+	}
+}
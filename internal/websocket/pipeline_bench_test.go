@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+)
+
+// The pipeline benchmarks cover the in-process half of message delivery,
+// after Redis: encoding, fan-out to the members' send buffers and the
+// worker pool. cmd/loadgen measures the whole path against a running server.
+//
+//	go test ./internal/websocket -run '^$' -bench Pipeline -benchmem
+
+func benchMessage() models.WSMessage {
+	now := time.Now()
+	return models.WSMessage{Event: models.EventMessageNew, Payload: models.Message{
+		ID: uuid.New(), ConversationID: uuid.New(), SenderID: uuid.New(),
+		Body: "that play was insane", CreatedAt: now, UpdatedAt: now,
+	}}
+}
+
+// benchHub has members connected clients whose send buffers are drained in
+// the background, half of them on the legacy protocol
+func benchHub(b *testing.B, members int) (*Hub, []uuid.UUID) {
+	h := &Hub{clients: make(map[uuid.UUID]map[*Client]struct{})}
+	ids := make([]uuid.UUID, members)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range ids {
+		ids[i] = uuid.New()
+		c := &Client{userID: ids[i], protocol: ProtocolLegacy + i%2, send: make(chan []byte, 256)}
+		h.clients[ids[i]] = map[*Client]struct{}{c: {}}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-c.send:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	b.Cleanup(func() {
+		close(done)
+		wg.Wait()
+	})
+	return h, ids
+}
+
+func BenchmarkPipelineEncode(b *testing.B) {
+	msg := benchMessage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encodeEvent(msg, ProtocolLatest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPipelineSendToConversation(b *testing.B) {
+	for _, members := range []int{2, 50, 500} {
+		b.Run(fmt.Sprintf("members=%d", members), func(b *testing.B) {
+			h, ids := benchHub(b, members)
+			msg := benchMessage()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.SendToConversation(ids, msg)
+			}
+		})
+	}
+}
+
+// BenchmarkPipelineFanout submits events for many conversations to the
+// worker pool and waits until all are delivered
+func BenchmarkPipelineFanout(b *testing.B) {
+	for _, workers := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			h, ids := benchHub(b, 20)
+			var wg sync.WaitGroup
+			f := newFanout(workers, 256, func(_ uuid.UUID, msg models.WSMessage) {
+				h.SendToConversation(ids, msg)
+				wg.Done()
+			})
+			f.start()
+
+			convs := make([]uuid.UUID, 64)
+			for i := range convs {
+				convs[i] = uuid.New()
+			}
+			msg := benchMessage()
+			b.ReportAllocs()
+			b.ResetTimer()
+			wg.Add(b.N)
+			for i := 0; i < b.N; i++ {
+				f.submit(convs[i%len(convs)], msg)
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/tullo/backend/internal/models"
+)
+
+// Protocol versions. A protocol pins the schema version of every event, so a
+// client keeps receiving the payload shapes it was written against while
+// newer protocols change them. Clients pick one at connect time with
+// ?protocol=N or the Sec-WebSocket-Protocol header (tullo.vN).
+const (
+	// ProtocolLegacy is spoken by clients that do not ask for a version.
+	// Presence and typing updates arrive as bare payloads without the event
+	// envelope, and no event carries a "v" field.
+	ProtocolLegacy = 1
+	// ProtocolLatest wraps every event as {"event", "v", "payload"}, where v
+	// is the payload's schema version
+	ProtocolLatest = 2
+)
+
+// subprotocolPrefix names protocols in Sec-WebSocket-Protocol
+const subprotocolPrefix = "tullo.v"
+
+// eventSchemas lists, per protocol, the events whose payload schema is newer
+// than 1. Changing a payload shape means adding a protocol whose entry bumps
+// the event, plus a downgrade (and upgrade) between the two schemas.
+var eventSchemas = map[int]map[string]int{
+	ProtocolLegacy: {},
+	ProtocolLatest: {},
+}
+
+// converter rewrites a payload between adjacent schema versions of an event
+type converter func(payload json.RawMessage) (json.RawMessage, error)
+
+var (
+	// downgrades[event][v] turns a schema v payload into schema v-1 for
+	// clients on an older protocol
+	downgrades = map[string]map[int]converter{}
+	// upgrades[event][v] turns a schema v payload into schema v+1, for events
+	// sent by older clients and by older instances during a rolling deploy
+	upgrades = map[string]map[int]converter{}
+)
+
+// SchemaVersion is the payload schema of event under protocol
+func SchemaVersion(protocol int, event string) int {
+	if v, ok := eventSchemas[protocol][event]; ok {
+		return v
+	}
+	return 1
+}
+
+func supportedProtocol(n int) bool {
+	_, ok := eventSchemas[n]
+	return ok
+}
+
+// negotiateProtocol picks the protocol for a connection: ?protocol=N if set,
+// otherwise the highest supported tullo.vN subprotocol offered, otherwise
+// ProtocolLegacy. The subprotocol to echo in the handshake is returned too,
+// since browsers drop connections that offered one and got none back.
+func negotiateProtocol(r *http.Request) (int, string, error) {
+	offered := map[int]bool{}
+	best := 0
+	for _, sp := range websocket.Subprotocols(r) {
+		if !strings.HasPrefix(sp, subprotocolPrefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(sp, subprotocolPrefix))
+		if err != nil || !supportedProtocol(n) {
+			continue
+		}
+		offered[n] = true
+		if n > best {
+			best = n
+		}
+	}
+
+	if q := r.URL.Query().Get("protocol"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || !supportedProtocol(n) {
+			return 0, "", fmt.Errorf("unsupported protocol %q (supported: %d-%d)", q, ProtocolLegacy, ProtocolLatest)
+		}
+		if offered[n] {
+			return n, subprotocolPrefix + q, nil
+		}
+		return n, "", nil
+	}
+	if best > 0 {
+		return best, subprotocolPrefix + strconv.Itoa(best), nil
+	}
+	return ProtocolLegacy, "", nil
+}
+
+// convert walks payload from schema from to schema to one version at a time
+func convert(event string, payload json.RawMessage, from, to int) (json.RawMessage, error) {
+	var err error
+	for ; from > to; from-- {
+		down, ok := downgrades[event][from]
+		if !ok {
+			return nil, fmt.Errorf("no downgrade for %s schema %d", event, from)
+		}
+		if payload, err = down(payload); err != nil {
+			return nil, fmt.Errorf("failed to downgrade %s schema %d: %w", event, from, err)
+		}
+	}
+	for ; from < to; from++ {
+		up, ok := upgrades[event][from]
+		if !ok {
+			return nil, fmt.Errorf("no upgrade for %s schema %d", event, from)
+		}
+		if payload, err = up(payload); err != nil {
+			return nil, fmt.Errorf("failed to upgrade %s schema %d: %w", event, from, err)
+		}
+	}
+	return payload, nil
+}
+
+// encodeEvent renders a server event for a client speaking protocol. A zero
+// msg.Version means the payload has the current schema.
+func encodeEvent(msg models.WSMessage, protocol int) ([]byte, error) {
+	if protocol < ProtocolLegacy {
+		protocol = ProtocolLegacy
+	}
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	from := msg.Version
+	if from == 0 {
+		from = SchemaVersion(ProtocolLatest, msg.Event)
+	}
+	to := SchemaVersion(protocol, msg.Event)
+	if payload, err = convert(msg.Event, payload, from, to); err != nil {
+		return nil, err
+	}
+
+	out := models.WSMessage{Event: msg.Event, Payload: json.RawMessage(payload)}
+	if protocol > ProtocolLegacy {
+		out.Version = to
+	}
+	return json.Marshal(out)
+}
+
+// decodeEvent parses a client event and brings its payload to the current
+// schema. Without a "v" field the payload is taken to have the schema of the
+// client's protocol.
+func decodeEvent(data []byte, protocol int) (models.WSMessage, error) {
+	var in struct {
+		Event   string          `json:"event"`
+		Version int             `json:"v"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return models.WSMessage{}, err
+	}
+	from := in.Version
+	if from == 0 {
+		from = SchemaVersion(protocol, in.Event)
+	}
+	payload, err := convert(in.Event, in.Payload, from, SchemaVersion(ProtocolLatest, in.Event))
+	if err != nil {
+		return models.WSMessage{}, err
+	}
+	return models.WSMessage{Event: in.Event, Payload: payload}, nil
+}
+
+// frame is one outgoing event, encoded at most once per protocol however
+// many clients receive it. Frames are not safe for concurrent use.
+type frame struct {
+	// msg is nil for data sent verbatim to every client
+	msg *models.WSMessage
+	// raw is what legacy clients receive instead of msg, if set
+	raw     []byte
+	encoded map[int][]byte
+}
+
+// newFrame wraps a models.WSMessage for per-protocol encoding; anything else
+// is sent to every client as its JSON encoding
+func newFrame(message interface{}) (*frame, error) {
+	if m, ok := message.(models.WSMessage); ok {
+		return &frame{msg: &m}, nil
+	}
+	raw, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &frame{raw: raw}, nil
+}
+
+// legacyFrame is msg for versioned clients and raw, the pre-envelope shape,
+// for legacy ones
+func legacyFrame(msg models.WSMessage, raw []byte) *frame {
+	return &frame{msg: &msg, raw: raw}
+}
+
+func (f *frame) bytes(protocol int) ([]byte, error) {
+	if protocol < ProtocolLegacy {
+		protocol = ProtocolLegacy
+	}
+	if f.msg == nil || (protocol == ProtocolLegacy && f.raw != nil) {
+		return f.raw, nil
+	}
+	if b, ok := f.encoded[protocol]; ok {
+		return b, nil
+	}
+	b, err := encodeEvent(*f.msg, protocol)
+	if err != nil {
+		return nil, err
+	}
+	if f.encoded == nil {
+		f.encoded = map[int][]byte{}
+	}
+	f.encoded[protocol] = b
+	return b, nil
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tullo/backend/internal/models"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		offered     string
+		want        int
+		subprotocol string
+		wantErr     bool
+	}{
+		{name: "default", want: ProtocolLegacy},
+		{name: "query", query: "?protocol=2", want: 2},
+		{name: "subprotocol", offered: "tullo.v1, tullo.v2, tullo.v99", want: 2, subprotocol: "tullo.v2"},
+		{name: "foreign subprotocol", offered: "graphql-ws", want: ProtocolLegacy},
+		{name: "query picks offered", query: "?protocol=1", offered: "tullo.v1, tullo.v2", want: 1, subprotocol: "tullo.v1"},
+		{name: "unsupported", query: "?protocol=99", wantErr: true},
+		{name: "malformed", query: "?protocol=latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws"+tt.query, nil)
+			if tt.offered != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.offered)
+			}
+			got, sp, err := negotiateProtocol(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got != tt.want || sp != tt.subprotocol) {
+				t.Errorf("got %d, %q; want %d, %q", got, sp, tt.want, tt.subprotocol)
+			}
+		})
+	}
+}
+
+func TestEncodeEventEnvelope(t *testing.T) {
+	msg := models.WSMessage{Event: models.EventError, Payload: models.WSErrorPayload{Message: "boom"}}
+
+	legacy, err := encodeEvent(msg, ProtocolLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(legacy) != `{"event":"error","payload":{"message":"boom"}}` {
+		t.Errorf("legacy encoding = %s", legacy)
+	}
+
+	latest, err := encodeEvent(msg, ProtocolLatest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Event   string `json:"event"`
+		Version int    `json:"v"`
+	}
+	if err := json.Unmarshal(latest, &got); err != nil || got.Event != models.EventError || got.Version != 1 {
+		t.Errorf("latest encoding = %s", latest)
+	}
+}
+
+// withSchemaChange pretends protocol 2 moved "test.event" to schema 2, which
+// renamed "text" to "body"
+func withSchemaChange(t *testing.T) {
+	t.Helper()
+	eventSchemas[ProtocolLatest]["test.event"] = 2
+	downgrades["test.event"] = map[int]converter{2: func(p json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(strings.Replace(string(p), `"body"`, `"text"`, 1)), nil
+	}}
+	upgrades["test.event"] = map[int]converter{1: func(p json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(strings.Replace(string(p), `"text"`, `"body"`, 1)), nil
+	}}
+	t.Cleanup(func() {
+		delete(eventSchemas[ProtocolLatest], "test.event")
+		delete(downgrades, "test.event")
+		delete(upgrades, "test.event")
+	})
+}
+
+func TestEventTranslation(t *testing.T) {
+	withSchemaChange(t)
+	msg := models.WSMessage{Event: "test.event", Payload: map[string]string{"body": "hi"}}
+
+	f, err := newFrame(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := f.bytes(ProtocolLegacy)
+	if err != nil || string(legacy) != `{"event":"test.event","payload":{"text":"hi"}}` {
+		t.Errorf("legacy = %s, %v", legacy, err)
+	}
+	latest, err := f.bytes(ProtocolLatest)
+	if err != nil || string(latest) != `{"event":"test.event","v":2,"payload":{"body":"hi"}}` {
+		t.Errorf("latest = %s, %v", latest, err)
+	}
+
+	// A legacy client's event is upgraded before the server handles it
+	in, err := decodeEvent([]byte(`{"event":"test.event","payload":{"text":"hi"}}`), ProtocolLegacy)
+	if err != nil || string(in.Payload.(json.RawMessage)) != `{"body":"hi"}` {
+		t.Errorf("decoded = %+v, %v", in, err)
+	}
+
+	// Without a converter the event cannot be delivered at that schema
+	delete(downgrades, "test.event")
+	if _, err := encodeEvent(msg, ProtocolLegacy); err == nil {
+		t.Error("expected an error without a downgrade")
+	}
+}
+
+func TestLegacyFrame(t *testing.T) {
+	raw := json.RawMessage(`{"user_id":"u","status":"online"}`)
+	f := legacyFrame(models.WSMessage{Event: models.EventPresenceUpdate, Payload: raw}, raw)
+
+	if b, _ := f.bytes(ProtocolLegacy); string(b) != string(raw) {
+		t.Errorf("legacy = %s, want the bare payload", b)
+	}
+	if b, _ := f.bytes(ProtocolLatest); string(b) != `{"event":"presence.update","v":1,"payload":{"user_id":"u","status":"online"}}` {
+		t.Errorf("latest = %s", b)
+	}
+}
@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tullo/backend/internal/models"
+)
+
+// resumeKeyPrefix prefixes the Redis keys holding the subscriptions of
+// closed connections by resume token
+const resumeKeyPrefix = "ws:resume:"
+
+// resumeState is what a connection had subscribed to when it closed
+type resumeState struct {
+	UserID uuid.UUID `json:"user_id"`
+	// Chats are the channels whose chat was open
+	Chats []uuid.UUID `json:"chats,omitempty"`
+	// Typing are the conversations subscribed to with typing.subscribe
+	Typing []uuid.UUID `json:"typing,omitempty"`
+}
+
+// newResumeToken returns an opaque token naming a connection's subscriptions
+func newResumeToken() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// saveResume keeps the connection's subscriptions under its resume token for
+// the resume window, so a reconnect can pick them up. Touched only by
+// ReadPump, like the subscriptions themselves.
+func (c *Client) saveResume() {
+	if c.resumeToken == "" || (len(c.chats) == 0 && len(c.typing) == 0) {
+		return
+	}
+	state := resumeState{UserID: c.userID}
+	for channelID := range c.chats {
+		state.Chats = append(state.Chats, channelID)
+	}
+	for convID := range c.typing {
+		state.Typing = append(state.Typing, convID)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	if err := c.redis.SetString(resumeKeyPrefix+c.resumeToken, string(data), c.resumeWindow); err != nil {
+		log.Printf("Failed to save WebSocket resume state: %v", err)
+	}
+}
+
+// resume restores the subscriptions saved under token by a closed connection
+// of the same user, going through chat.join and typing.subscribe so access is
+// checked again. A token is good for one reconnect; unknown, expired and
+// other users' tokens restore nothing.
+func (c *Client) resume(token string) models.WSReadyPayload {
+	ready := models.WSReadyPayload{
+		ResumeToken:  c.resumeToken,
+		ResumeWindow: int(c.resumeWindow / time.Second),
+	}
+	if token == "" || c.resumeToken == "" {
+		return ready
+	}
+	key := resumeKeyPrefix + token
+	data, err := c.redis.GetString(key)
+	if err != nil || data == "" {
+		return ready
+	}
+	var state resumeState
+	if err := json.Unmarshal([]byte(data), &state); err != nil || state.UserID != c.userID {
+		return ready
+	}
+	c.redis.Delete(key)
+
+	ready.Resumed = true
+	for _, channelID := range state.Chats {
+		c.handleChatJoin(models.WSChatPayload{ChannelID: channelID})
+		if _, ok := c.chats[channelID]; ok {
+			ready.Chats = append(ready.Chats, channelID)
+		}
+	}
+	if c.guest {
+		return ready
+	}
+	for _, convID := range state.Typing {
+		c.handleTypingSubscribe(models.WSTypingPayload{ConversationID: convID})
+		if _, ok := c.typing[convID]; ok {
+			ready.Typing = append(ready.Typing, convID)
+		}
+	}
+	return ready
+}
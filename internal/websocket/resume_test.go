@@ -0,0 +1,27 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestResumeWithoutToken(t *testing.T) {
+	token, err := newResumeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := newResumeToken(); other == token {
+		t.Fatalf("newResumeToken returned %q twice", token)
+	}
+
+	c := &Client{userID: uuid.New(), resumeToken: token, resumeWindow: 2 * time.Minute}
+	ready := c.resume("")
+	if ready.ResumeToken != token || ready.ResumeWindow != 120 || ready.Resumed {
+		t.Errorf("resume(\"\") = %+v, want token %q, window 120 and nothing resumed", ready, token)
+	}
+
+	// Nothing is saved for a connection without subscriptions
+	c.saveResume()
+}